@@ -62,6 +62,9 @@ func InitEnv() {
 	} else {
 		CryptoSecret = SessionSecret
 	}
+	if err := InitSecretMasterKeys(); err != nil {
+		log.Fatal(err)
+	}
 	if err := InitSessionCookieSettings(); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,240 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 敏感字段（渠道密钥）静态加密，采用信封加密：
+// 每个值使用随机生成的数据密钥（DEK）以 AES-256-GCM 加密，DEK 再由主密钥加密。
+// 主密钥带版本号，新写入的值总是使用版本号最大的主密钥，旧版本仅用于解密，
+// 因此轮换主密钥只需追加新版本并重新加密已有数据。
+//
+// 密文格式：enc:v1:<主密钥版本>:<base64 加密后的 DEK>:<base64 nonce|密文>
+
+const (
+	secretCipherPrefix = "enc:v1:"
+	secretKeySize      = 32
+)
+
+var (
+	secretMasterKeysMu sync.RWMutex
+	secretMasterKeys   = map[int][]byte{}
+	secretLatestKey    int
+)
+
+// InitSecretMasterKeys loads the master keys from CHANNEL_KEY_ENCRYPTION_KEYS
+// ("1:<base64>,2:<base64>") and CHANNEL_KEY_ENCRYPTION_KEY_FILE (one
+// "version:base64" per line). Encryption stays disabled when neither is set.
+func InitSecretMasterKeys() error {
+	var entries []string
+	if keys := os.Getenv("CHANNEL_KEY_ENCRYPTION_KEYS"); keys != "" {
+		entries = append(entries, strings.Split(keys, ",")...)
+	}
+	if path := os.Getenv("CHANNEL_KEY_ENCRYPTION_KEY_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read channel key encryption key file: %w", err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	keys, err := ParseSecretMasterKeys(entries)
+	if err != nil {
+		return err
+	}
+	SetSecretMasterKeys(keys)
+	return nil
+}
+
+// ParseSecretMasterKeys parses "version:base64" entries into master keys.
+func ParseSecretMasterKeys(entries []string) (map[int][]byte, error) {
+	keys := make(map[int][]byte, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		versionStr, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, errors.New("invalid channel key encryption key, expected version:base64")
+		}
+		version, err := strconv.Atoi(strings.TrimSpace(versionStr))
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid channel key encryption key version %q", versionStr)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != secretKeySize {
+			return nil, fmt.Errorf("channel key encryption key version %d must be %d bytes in base64", version, secretKeySize)
+		}
+		if _, exists := keys[version]; exists {
+			return nil, fmt.Errorf("duplicate channel key encryption key version %d", version)
+		}
+		keys[version] = key
+	}
+	return keys, nil
+}
+
+// SetSecretMasterKeys replaces the master keys. The highest version becomes the
+// key used for new values; an empty map disables encryption.
+func SetSecretMasterKeys(keys map[int][]byte) {
+	secretMasterKeysMu.Lock()
+	defer secretMasterKeysMu.Unlock()
+	secretMasterKeys = make(map[int][]byte, len(keys))
+	secretLatestKey = 0
+	for version, key := range keys {
+		secretMasterKeys[version] = key
+		if version > secretLatestKey {
+			secretLatestKey = version
+		}
+	}
+}
+
+// SecretEncryptionEnabled reports whether a master key is configured.
+func SecretEncryptionEnabled() bool {
+	return LatestSecretKeyVersion() > 0
+}
+
+// LatestSecretKeyVersion returns the master key version used for new values,
+// or 0 when encryption is disabled.
+func LatestSecretKeyVersion() int {
+	secretMasterKeysMu.RLock()
+	defer secretMasterKeysMu.RUnlock()
+	return secretLatestKey
+}
+
+func getSecretMasterKey(version int) ([]byte, bool) {
+	secretMasterKeysMu.RLock()
+	defer secretMasterKeysMu.RUnlock()
+	key, ok := secretMasterKeys[version]
+	return key, ok
+}
+
+// IsEncryptedSecret reports whether value is in the encrypted format.
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretCipherPrefix)
+}
+
+// SecretKeyVersion returns the master key version of an encrypted value, or 0
+// for plaintext.
+func SecretKeyVersion(value string) int {
+	if !IsEncryptedSecret(value) {
+		return 0
+	}
+	versionStr, _, _ := strings.Cut(strings.TrimPrefix(value, secretCipherPrefix), ":")
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+func sealAESGCM(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openAESGCM(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// EncryptSecret encrypts plaintext with the latest master key. Values are
+// returned unchanged when encryption is disabled, empty or already encrypted.
+func EncryptSecret(plaintext string) (string, error) {
+	version := LatestSecretKeyVersion()
+	if version == 0 || plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	masterKey, _ := getSecretMasterKey(version)
+
+	dataKey := make([]byte, secretKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := sealAESGCM(masterKey, dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := sealAESGCM(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d:%s:%s", secretCipherPrefix, version,
+		base64.StdEncoding.EncodeToString(wrappedKey),
+		base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// DecryptSecret decrypts a value produced by EncryptSecret. Plaintext values
+// written before encryption was enabled are returned unchanged.
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, secretCipherPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted secret")
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "", errors.New("malformed encrypted secret")
+	}
+	masterKey, ok := getSecretMasterKey(version)
+	if !ok {
+		return "", fmt.Errorf("channel key encryption key version %d is not configured", version)
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed encrypted secret")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed encrypted secret")
+	}
+	dataKey, err := openAESGCM(masterKey, wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	plaintext, err := openAESGCM(dataKey, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
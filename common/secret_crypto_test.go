@@ -0,0 +1,70 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testSecretMasterKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, secretKeySize)
+}
+
+func TestSecretEncryptionRoundTrip(t *testing.T) {
+	t.Cleanup(func() { SetSecretMasterKeys(nil) })
+
+	// 未配置主密钥时原样保存
+	SetSecretMasterKeys(nil)
+	value, err := EncryptSecret("sk-plain")
+	require.NoError(t, err)
+	require.Equal(t, "sk-plain", value)
+
+	SetSecretMasterKeys(map[int][]byte{1: testSecretMasterKey(1)})
+	encrypted, err := EncryptSecret("sk-secret")
+	require.NoError(t, err)
+	require.True(t, IsEncryptedSecret(encrypted))
+	require.NotContains(t, encrypted, "sk-secret")
+	require.Equal(t, 1, SecretKeyVersion(encrypted))
+	again, err := EncryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, encrypted, again)
+
+	// 新增版本后旧密文仍可解密，新值使用最新版本
+	SetSecretMasterKeys(map[int][]byte{1: testSecretMasterKey(1), 2: testSecretMasterKey(2)})
+	plaintext, err := DecryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", plaintext)
+	rotated, err := EncryptSecret(plaintext)
+	require.NoError(t, err)
+	require.Equal(t, 2, SecretKeyVersion(rotated))
+
+	plaintext, err = DecryptSecret("sk-legacy")
+	require.NoError(t, err)
+	require.Equal(t, "sk-legacy", plaintext)
+
+	SetSecretMasterKeys(map[int][]byte{2: testSecretMasterKey(2)})
+	_, err = DecryptSecret(encrypted)
+	require.Error(t, err)
+	SetSecretMasterKeys(map[int][]byte{1: testSecretMasterKey(9)})
+	_, err = DecryptSecret(encrypted)
+	require.Error(t, err)
+}
+
+func TestParseSecretMasterKeys(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testSecretMasterKey(1))
+	keys, err := ParseSecretMasterKeys([]string{"1:" + encoded, " 3:" + encoded + " "})
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+
+	for _, entries := range [][]string{
+		{encoded},
+		{"0:" + encoded},
+		{"1:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{"1:" + encoded, "1:" + encoded},
+	} {
+		_, err := ParseSecretMasterKeys(entries)
+		require.Error(t, err, entries)
+	}
+}
@@ -20,6 +20,12 @@ const (
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
 	ContextKeyTokenAutoGroups        ContextKey = "token_auto_groups"
+	ContextKeyTokenSystemPrompt      ContextKey = "token_system_prompt"
+	ContextKeyTokenSystemSuffix      ContextKey = "token_system_prompt_suffix"
+	ContextKeyTokenScopes            ContextKey = "token_scopes"
+	ContextKeyTokenBudgetLimited     ContextKey = "token_budget_limited"
+	ContextKeyDerivedTokenId         ContextKey = "derived_token_id"
+	ContextKeyTokenOrgId             ContextKey = "token_org_id"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -39,10 +45,43 @@ const (
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
 	ContextKeyChannelKey               ContextKey = "channel_key"
 
+	// ContextKeyModelSplitAlias stores the split alias the client asked for when
+	// the request was routed to one of its concrete models.
+	ContextKeyModelSplitAlias ContextKey = "model_split_alias"
+
 	ContextKeyAutoGroup           ContextKey = "auto_group"
 	ContextKeyAutoGroupIndex      ContextKey = "auto_group_index"
 	ContextKeyAutoGroupRetryIndex ContextKey = "auto_group_retry_index"
 
+	// ContextKeySameChannelRetries stores same-channel retry delays (ms) keyed by channel id.
+	ContextKeySameChannelRetries ContextKey = "same_channel_retries"
+
+	// ContextKeyShadowTraffic marks a request sampled for shadow traffic mirroring.
+	ContextKeyShadowTraffic ContextKey = "shadow_traffic"
+	// ContextKeyShadowTrafficUsage stores the final usage of a mirrored primary or shadow call.
+	ContextKeyShadowTrafficUsage ContextKey = "shadow_traffic_usage"
+
+	// ContextKeyGeminiCachedContent stores the cachedContents record a Gemini request is bound to.
+	ContextKeyGeminiCachedContent ContextKey = "gemini_cached_content"
+
+	// ContextKeyResponseOverride stores the response override rules of the channel serving the current attempt.
+	ContextKeyResponseOverride ContextKey = "response_override"
+
+	// ContextKeyPromptTemplate stores the prompt template rendered into the request, for the consume log.
+	ContextKeyPromptTemplate ContextKey = "prompt_template"
+
+	// ContextKeySystemPromptInjected lists the sources ("group", "token") whose system prompts were injected.
+	ContextKeySystemPromptInjected ContextKey = "system_prompt_injected"
+
+	// ContextKeyPIIRedaction stores the placeholder mapping of the redacted request
+	ContextKeyPIIRedaction ContextKey = "pii_redaction"
+
+	// ContextKeySensitiveCompletionFilter stores the completion sensitive-word filter of the request
+	ContextKeySensitiveCompletionFilter ContextKey = "sensitive_completion_filter"
+
+	// ContextKeyGuardrail stores the guardrail pipeline and audit records of the request
+	ContextKeyGuardrail ContextKey = "guardrail"
+
 	/* user related keys */
 	ContextKeyUserId      ContextKey = "id"
 	ContextKeyUserSetting ContextKey = "user_setting"
@@ -52,6 +91,8 @@ const (
 	ContextKeyUserGroup   ContextKey = "user_group"
 	ContextKeyUsingGroup  ContextKey = "group"
 	ContextKeyUserName    ContextKey = "username"
+	// ContextKeyUserParentId 子账户所属转售商的用户 ID
+	ContextKeyUserParentId ContextKey = "user_parent_id"
 
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
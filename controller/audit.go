@@ -29,6 +29,10 @@ var auditContentTemplates = map[string]string{
 	"user.passkey_delete":   "Deleted a passkey",
 	"user.reset_passkey":    "Reset the user passkey",
 	"option.update":         "Updated system setting ${key}",
+	"option.scim_token":     "Regenerated the SCIM bearer token",
+	"scim.user_provision":   "Provisioned user ${username} over SCIM",
+	"scim.user_deprovision": "Deprovisioned user ${username} over SCIM",
+	"scim.user_delete":      "Deleted user ${username} over SCIM",
 
 	"channel.create":             "Created channel ${name} (type ${type}, count ${count})",
 	"channel.update":             "Updated channel ${name} (ID: ${id})",
@@ -49,6 +53,11 @@ var auditContentTemplates = map[string]string{
 
 	"subscription.plan_reset":      "Reset active subscriptions for plan ${plan_id}",
 	"subscription.user_plan_reset": "Reset active plan ${plan_id} subscriptions for user ${target_user_id}",
+
+	"organization.update": "Updated organization ${name} (ID: ${id}): status ${status}, quota delta ${quota_delta}",
+
+	"reseller.enable":  "Enabled reseller for user ${id}",
+	"reseller.disable": "Disabled reseller for user ${id}",
 }
 
 // auditContentEN 按 action 模板渲染英文兜底文本；未登记的 action 退回 action 本身。
@@ -72,9 +72,11 @@ func GetChannelAffinityUsageCacheStats(c *gin.Context) {
 		return
 	}
 	if keyFp == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "missing param: key_fp",
+		// 不指定 key_fp 时返回整条规则的汇总
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    service.GetChannelAffinityRuleUsageCacheStats(ruleName, usingGroup),
 		})
 		return
 	}
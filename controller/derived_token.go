@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// derivedTokenParent 返回发起请求的父令牌。子令牌不能再签发或管理子令牌。
+func derivedTokenParent(c *gin.Context) (*model.Token, bool) {
+	if common.GetContextKeyString(c, constant.ContextKeyDerivedTokenId) != "" {
+		common.ApiErrorI18n(c, i18n.MsgDerivedTokenNested)
+		return nil, false
+	}
+	token, err := model.GetTokenById(common.GetContextKeyInt(c, constant.ContextKeyTokenId))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			common.ApiErrorI18n(c, i18n.MsgTokenInvalid)
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, false
+	}
+	return token, true
+}
+
+func CreateDerivedToken(c *gin.Context) {
+	parent, ok := derivedTokenParent(c)
+	if !ok {
+		return
+	}
+	request := service.DerivedTokenRequest{}
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	result, err := service.MintDerivedToken(parent, request)
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgDerivedTokenInvalid, map[string]any{"Error": err.Error()})
+		return
+	}
+	common.ApiSuccess(c, result)
+}
+
+func GetDerivedTokens(c *gin.Context) {
+	parent, ok := derivedTokenParent(c)
+	if !ok {
+		return
+	}
+	tokens, err := model.GetDerivedTokensByParent(parent.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, tokens)
+}
+
+func RevokeDerivedToken(c *gin.Context) {
+	parent, ok := derivedTokenParent(c)
+	if !ok {
+		return
+	}
+	revoked, err := model.RevokeDerivedToken(c.Param("id"), parent.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !revoked {
+		common.ApiErrorI18n(c, i18n.MsgDerivedTokenNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	geminiCachedContentDefaultPageSize = 100
+	geminiCachedContentMaxPageSize     = 1000
+)
+
+func geminiCachedContentError(c *gin.Context, newAPIError *types.NewAPIError) {
+	logger.LogError(c, fmt.Sprintf("cachedContents relay error: %s", common.LocalLogPreview(newAPIError.Error())))
+	newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), c.GetString(common.RequestIdKey)))
+	c.JSON(newAPIError.StatusCode, gin.H{
+		"error": newAPIError.ToOpenAIError(),
+	})
+}
+
+// RelayGeminiCachedContentCreate creates a context cache on the channel picked
+// by Distribute and bills its storage up to the expire time.
+func RelayGeminiCachedContentCreate(c *gin.Context) {
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatGemini, nil, nil)
+	if err != nil {
+		geminiCachedContentError(c, types.NewError(err, types.ErrorCodeGenRelayInfoFailed))
+		return
+	}
+	groupRatioInfo := helper.HandleGroupRatio(c, info)
+	reservation, newAPIError := reserveGeminiCachedContentCreate(c, info, groupRatioInfo.GroupRatio)
+	if newAPIError != nil {
+		geminiCachedContentError(c, newAPIError)
+		return
+	}
+	defer reservation.Release()
+	body, newAPIError := relay.GeminiCachedContentHelper(c, info, "")
+	if newAPIError != nil {
+		geminiCachedContentError(c, newAPIError)
+		return
+	}
+	meta, err := service.ParseGeminiCachedContent(body)
+	if err != nil {
+		geminiCachedContentError(c, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError))
+		return
+	}
+
+	cache := &model.GeminiCachedContent{
+		Name:           service.GeminiCachedContentName(meta.Name),
+		UpstreamName:   meta.Name,
+		UserId:         info.UserId,
+		TokenId:        info.TokenId,
+		ChannelId:      info.ChannelId,
+		KeyIndex:       info.ChannelMultiKeyIndex,
+		Group:          info.UsingGroup,
+		GroupRatio:     groupRatioInfo.GroupRatio,
+		ResellerId:     info.ResellerId,
+		ResellerMarkup: info.ResellerMarkup,
+		ModelName:      info.OriginModelName,
+		DisplayName:    meta.DisplayName,
+		TokenCount:     meta.TokenCount,
+		ExpireTime:     meta.ExpireTime,
+		BilledUntil:    common.GetTimestamp(),
+	}
+	service.SettleGeminiCachedContentStorage(c, cache, cache.ExpireTime, "创建")
+	if err := cache.Insert(); err != nil {
+		// 上游缓存已创建且已计费，映射丢失只影响后续请求的渠道绑定
+		logger.LogError(c, fmt.Sprintf("failed to save cached content %s: %s", cache.Name, err.Error()))
+	}
+	c.Data(http.StatusOK, "application/json", service.RewriteGeminiCachedContent(body, cache))
+}
+
+// reserveGeminiCachedContentCreate holds the estimated storage cost of the cache
+// being created until the real cost, known from the upstream token count, is
+// settled; a failed upstream call releases it untouched.
+func reserveGeminiCachedContentCreate(c *gin.Context, info *relaycommon.RelayInfo, groupRatio float64) (*service.GeminiCachedContentReservation, *types.NewAPIError) {
+	body, err := readGeminiCachedContentBody(c)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	now := time.Now()
+	expireTime, ok := service.EstimateGeminiCachedContentExpireTime(body, now)
+	if !ok {
+		expireTime = now.Add(service.GeminiCachedContentDefaultTTL).Unix()
+	}
+	tokens := service.EstimateGeminiCachedContentTokens(body, info.OriginModelName)
+	return reserveGeminiCachedContentStorage(info, groupRatio, tokens, expireTime-now.Unix())
+}
+
+func reserveGeminiCachedContentStorage(info *relaycommon.RelayInfo, groupRatio float64, tokens int, seconds int64) (*service.GeminiCachedContentReservation, *types.NewAPIError) {
+	quota := 0
+	if tokens > 0 && seconds > 0 {
+		estimated, _, err := service.GeminiCachedContentStorageQuota(info.OriginModelName, groupRatio, float64(tokens)*float64(seconds)/3600)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeModelPriceError, types.ErrOptionWithSkipRetry())
+		}
+		quota = estimated
+	}
+	return service.ReserveGeminiCachedContentStorage(info, quota)
+}
+
+func readGeminiCachedContentBody(c *gin.Context) ([]byte, error) {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Bytes()
+}
+
+// RelayGeminiCachedContentList answers cachedContents.list from the local
+// records, since the caches of one user can live on several channels.
+func RelayGeminiCachedContentList(c *gin.Context) {
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+	if pageSize <= 0 {
+		pageSize = geminiCachedContentDefaultPageSize
+	}
+	if pageSize > geminiCachedContentMaxPageSize {
+		pageSize = geminiCachedContentMaxPageSize
+	}
+	offset, _ := strconv.Atoi(c.Query("pageToken"))
+	if offset < 0 {
+		offset = 0
+	}
+	caches, err := model.ListGeminiCachedContents(common.GetContextKeyInt(c, constant.ContextKeyUserId), offset, pageSize+1)
+	if err != nil {
+		geminiCachedContentError(c, types.NewError(err, types.ErrorCodeQueryDataError))
+		return
+	}
+	resp := gin.H{}
+	if len(caches) > pageSize {
+		caches = caches[:pageSize]
+		resp["nextPageToken"] = strconv.Itoa(offset + pageSize)
+	}
+	items := make([]map[string]any, 0, len(caches))
+	for _, cache := range caches {
+		items = append(items, service.GeminiCachedContentView(cache))
+	}
+	resp["cachedContents"] = items
+	c.JSON(http.StatusOK, resp)
+}
+
+// RelayGeminiCachedContentGet fetches the cache from the channel and key that
+// created it.
+func RelayGeminiCachedContentGet(c *gin.Context) {
+	cache, info, newAPIError := setupGeminiCachedContentChannel(c)
+	if newAPIError != nil {
+		geminiCachedContentError(c, newAPIError)
+		return
+	}
+	body, newAPIError := relay.GeminiCachedContentHelper(c, info, cache.UpstreamName)
+	if newAPIError != nil {
+		geminiCachedContentError(c, newAPIError)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", service.RewriteGeminiCachedContent(body, cache))
+}
+
+// RelayGeminiCachedContentPatch updates the ttl/expireTime upstream and settles
+// the storage difference.
+func RelayGeminiCachedContentPatch(c *gin.Context) {
+	cache, info, newAPIError := setupGeminiCachedContentChannel(c)
+	if newAPIError != nil {
+		geminiCachedContentError(c, newAPIError)
+		return
+	}
+	// 延长过期时间同样先预扣，避免额度不足的用户无限续期
+	requestBody, err := readGeminiCachedContentBody(c)
+	if err != nil {
+		geminiCachedContentError(c, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry()))
+		return
+	}
+	if expireTime, ok := service.EstimateGeminiCachedContentExpireTime(requestBody, time.Now()); ok && expireTime > cache.BilledUntil {
+		reservation, newAPIError := reserveGeminiCachedContentStorage(info, cache.GroupRatio, cache.TokenCount, expireTime-cache.BilledUntil)
+		if newAPIError != nil {
+			geminiCachedContentError(c, newAPIError)
+			return
+		}
+		defer reservation.Release()
+	}
+	body, newAPIError := relay.GeminiCachedContentHelper(c, info, cache.UpstreamName)
+	if newAPIError != nil {
+		geminiCachedContentError(c, newAPIError)
+		return
+	}
+	if meta, err := service.ParseGeminiCachedContent(body); err == nil && meta.ExpireTime > 0 {
+		// 延长补扣，缩短按剩余时长退还
+		service.SettleGeminiCachedContentStorage(c, cache, meta.ExpireTime, "更新过期时间")
+		cache.ExpireTime = meta.ExpireTime
+		if err := cache.Update(); err != nil {
+			logger.LogError(c, fmt.Sprintf("failed to update cached content %s: %s", cache.Name, err.Error()))
+		}
+	}
+	c.Data(http.StatusOK, "application/json", service.RewriteGeminiCachedContent(body, cache))
+}
+
+// RelayGeminiCachedContentDelete deletes the cache upstream and refunds the
+// storage time that was paid for but not used.
+func RelayGeminiCachedContentDelete(c *gin.Context) {
+	cache, info, newAPIError := setupGeminiCachedContentChannel(c)
+	if newAPIError != nil {
+		geminiCachedContentError(c, newAPIError)
+		return
+	}
+	body, newAPIError := relay.GeminiCachedContentHelper(c, info, cache.UpstreamName)
+	// 上游已不存在时同样清理记录
+	if newAPIError == nil || newAPIError.StatusCode == http.StatusNotFound {
+		if now := common.GetTimestamp(); now < cache.BilledUntil {
+			service.SettleGeminiCachedContentStorage(c, cache, now, "提前删除")
+		}
+		if err := cache.Delete(); err != nil {
+			logger.LogError(c, fmt.Sprintf("failed to delete cached content %s: %s", cache.Name, err.Error()))
+		}
+	}
+	if newAPIError != nil {
+		geminiCachedContentError(c, newAPIError)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", body)
+}
+
+func setupGeminiCachedContentChannel(c *gin.Context) (*model.GeminiCachedContent, *relaycommon.RelayInfo, *types.NewAPIError) {
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	cache, err := model.GetGeminiCachedContent(userId, "cachedContents/"+c.Param("id"))
+	if err != nil {
+		return nil, nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if cache == nil {
+		return nil, nil, types.NewErrorWithStatusCode(errors.New("cached content not found"), types.ErrorCodeInvalidRequest, http.StatusNotFound, types.ErrOptionWithSkipRetry())
+	}
+	channel, err := model.GetChannelById(cache.ChannelId, true)
+	if err != nil {
+		return nil, nil, types.NewErrorWithStatusCode(fmt.Errorf("channel of cached content is unavailable: %w", err), types.ErrorCodeGetChannelFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+	}
+	if channel.Status != common.ChannelStatusEnabled {
+		return nil, nil, types.NewErrorWithStatusCode(errors.New("channel of cached content is disabled"), types.ErrorCodeGetChannelFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+	}
+	common.SetContextKey(c, constant.ContextKeyGeminiCachedContent, cache)
+	common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
+	if newAPIError := middleware.SetupContextForSelectedChannel(c, channel, cache.ModelName); newAPIError != nil {
+		return nil, nil, newAPIError
+	}
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatGemini, nil, nil)
+	if err != nil {
+		return nil, nil, types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+	}
+	return cache, info, nil
+}
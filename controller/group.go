@@ -28,12 +28,16 @@ func GetUserGroups(c *gin.Context) {
 	userGroup := ""
 	userId := c.GetInt("id")
 	userGroup, _ = model.GetUserGroup(userId, false)
+	var markup *model.ResellerMarkup
+	if user, err := model.GetUserCache(userId); err == nil {
+		markup = resellerMarkupForUser(user.ParentId)
+	}
 	userUsableGroups := service.GetUserUsableGroups(userGroup)
 	for groupName, _ := range ratio_setting.GetGroupRatioCopy() {
 		// UserUsableGroups contains the groups that the user can use
 		if desc, ok := userUsableGroups[groupName]; ok {
 			usableGroups[groupName] = map[string]interface{}{
-				"ratio": service.GetUserGroupRatio(userGroup, groupName),
+				"ratio": service.GetUserGroupRatio(userGroup, groupName) * markup.GroupRatio(groupName),
 				"desc":  desc,
 			}
 		}
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errLDAPUserNotProvisioned = errors.New("LDAP user is not provisioned")
+
+// LDAPLogin 使用目录账号密码登录。账号不存在与密码错误返回同一提示，避免枚举目录用户。
+func LDAPLogin(c *gin.Context) {
+	settings := system_setting.GetLDAPSettings()
+	if !settings.Enabled {
+		common.ApiErrorMsg(c, "管理员未开启 LDAP 登录")
+		return
+	}
+	var request LoginRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil || request.Username == "" || request.Password == "" {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	entry, ok := authenticateLDAPRequest(c, request)
+	if !ok {
+		return
+	}
+	match := settings.MapGroups(entry.Groups)
+	if settings.RequireGroupMatch && !match.Matched {
+		common.ApiErrorMsg(c, "该目录账号无权登录")
+		return
+	}
+	user, err := findOrCreateLDAPUser(settings, entry, match)
+	if err != nil {
+		var emailTaken *OAuthEmailAlreadyTakenError
+		var userDeleted *OAuthUserDeletedError
+		switch {
+		case errors.Is(err, errLDAPUserNotProvisioned):
+			common.ApiErrorMsg(c, "该目录账号尚未开通，请先使用其他方式登录后绑定 LDAP 账号")
+		case errors.As(err, &emailTaken), errors.Is(err, model.ErrEmailAlreadyTaken):
+			common.ApiErrorI18n(c, i18n.MsgUserEmailAlreadyTaken)
+		case errors.As(err, &userDeleted):
+			common.ApiErrorI18n(c, i18n.MsgOAuthUserDeleted)
+		default:
+			common.SysError("LDAP login failed: " + err.Error())
+			common.ApiErrorI18n(c, i18n.MsgDatabaseError)
+		}
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		common.ApiErrorI18n(c, i18n.MsgOAuthUserBanned)
+		return
+	}
+	completePasswordLogin(user, c)
+}
+
+func authenticateLDAPRequest(c *gin.Context, request LoginRequest) (*service.LDAPEntry, bool) {
+	entry, err := service.AuthenticateLDAP(request.Username, request.Password)
+	if err == nil {
+		return entry, true
+	}
+	switch {
+	case errors.Is(err, service.ErrLDAPInvalidCredentials), errors.Is(err, service.ErrLDAPUserNotFound):
+		common.ApiErrorI18n(c, i18n.MsgUserUsernameOrPasswordError)
+	case errors.Is(err, service.ErrLDAPDisabled):
+		common.ApiErrorMsg(c, "管理员未开启 LDAP 登录")
+	default:
+		common.SysError("LDAP authentication failed: " + err.Error())
+		common.ApiErrorMsg(c, "LDAP 服务暂不可用，请稍后重试")
+	}
+	return nil, false
+}
+
+// findOrCreateLDAPUser 按目录唯一标识查找已绑定的用户并同步分组与角色；
+// 未绑定时仅在开启自动开通后创建用户。
+func findOrCreateLDAPUser(settings *system_setting.LDAPSettings, entry *service.LDAPEntry, match system_setting.LDAPGroupMatch) (*model.User, error) {
+	userId, err := model.GetExternalIdentityOwner(model.ExternalIdentityProviderLDAP, entry.Subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// SCIM 开通的账号没有密码，首次 LDAP 登录时按配置的属性关联
+		userId, err = service.LinkSCIMUserExternalIdentity(model.ExternalIdentityProviderLDAP, entry.Subject, service.SCIMSSOIdentity{
+			UserName:      entry.Username,
+			ExternalId:    entry.Subject,
+			Email:         entry.Email,
+			EmailVerified: true,
+		})
+	}
+	if err == nil {
+		user, err := model.GetUserById(userId, false)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &OAuthUserDeletedError{}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user.Status != common.UserStatusEnabled {
+			return user, nil
+		}
+		changed, err := service.SyncLDAPUserAccess(user, match)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			// 分组或角色变化会提升 auth_version，重新加载以签发新会话
+			return model.GetUserById(userId, false)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if !settings.AutoProvision {
+		return nil, errLDAPUserNotProvisioned
+	}
+
+	user := &model.User{
+		Username: "ldap_" + strconv.Itoa(model.GetMaxUserId()+1),
+		Role:     common.RoleCommonUser,
+		Status:   common.UserStatusEnabled,
+	}
+	if entry.Username != "" && len(entry.Username) <= model.UserNameMaxLength {
+		if exists, err := model.CheckUserExistOrDeleted(entry.Username, ""); err == nil && !exists {
+			user.Username = entry.Username
+		}
+	}
+	switch {
+	case entry.DisplayName != "":
+		user.DisplayName = entry.DisplayName
+	case entry.Username != "":
+		user.DisplayName = entry.Username
+	default:
+		user.DisplayName = settings.GetEffectiveDisplayName() + " User"
+	}
+	if entry.Email != "" {
+		user.Email = model.NormalizeEmail(entry.Email)
+		if err := model.EnsureEmailAvailable(user.Email, 0); err != nil {
+			if errors.Is(err, model.ErrEmailAlreadyTaken) {
+				return nil, &OAuthEmailAlreadyTakenError{}
+			}
+			return nil, err
+		}
+	}
+	if match.Group != "" {
+		user.Group = match.Group
+	}
+	if match.Admin {
+		user.Role = common.RoleAdminUser
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := user.InsertWithTx(tx, 0); err != nil {
+			return err
+		}
+		return model.ClaimExternalIdentityWithTx(tx, model.ExternalIdentityProviderLDAP, entry.Subject, user.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.FinalizeOAuthUserCreation(0)
+	return user, nil
+}
+
+// LDAPBind 将当前账号与目录账号绑定，需要提供目录密码。
+func LDAPBind(c *gin.Context) {
+	if !system_setting.GetLDAPSettings().Enabled {
+		common.ApiErrorMsg(c, "管理员未开启 LDAP 登录")
+		return
+	}
+	var request LoginRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil || request.Username == "" || request.Password == "" {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	entry, ok := authenticateLDAPRequest(c, request)
+	if !ok {
+		return
+	}
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		return model.ClaimExternalIdentityWithTx(tx, model.ExternalIdentityProviderLDAP, entry.Subject, c.GetInt("id"))
+	})
+	if err != nil {
+		if errors.Is(err, model.ErrExternalIdentityAlreadyClaimed) {
+			common.ApiErrorMsg(c, "该目录账号已绑定其他账号，或当前账号已绑定其他目录账号")
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "绑定成功",
+	})
+}
+
+func GetUserLDAPBinding(c *gin.Context) {
+	claims, err := model.GetExternalIdentitiesByUserId(c.GetInt("id"), model.ExternalIdentityProviderLDAP)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	data := gin.H{"bound": false}
+	for _, claim := range claims {
+		if claim.Provider == model.ExternalIdentityProviderLDAP {
+			data = gin.H{"bound": true, "subject": claim.Subject}
+			break
+		}
+	}
+	common.ApiSuccess(c, data)
+}
+
+func UnbindLDAP(c *gin.Context) {
+	if err := model.ReleaseExternalIdentity(model.ExternalIdentityProviderLDAP, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "解绑成功",
+	})
+}
+
+// TestLDAPSettings 使用当前配置连接目录并查找用户，返回目录中匹配过滤器的用户数。
+func TestLDAPSettings(c *gin.Context) {
+	settings := system_setting.GetLDAPSettings()
+	if err := service.ValidateLDAPSettings(settings); err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	users, err := service.SearchLDAPUsers()
+	if err != nil {
+		common.ApiErrorMsg(c, "LDAP 连接测试失败: "+strings.TrimSpace(err.Error()))
+		return
+	}
+	common.ApiSuccess(c, gin.H{"users": len(users)})
+}
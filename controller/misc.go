@@ -112,6 +112,8 @@ func GetStatus(c *gin.Context) {
 		"oidc_client_id":              system_setting.GetOIDCSettings().ClientId,
 		"oidc_authorization_endpoint": system_setting.GetOIDCSettings().AuthorizationEndpoint,
 		"oidc_display_name":           system_setting.GetOIDCSettings().GetEffectiveDisplayName(),
+		"ldap_login":                  system_setting.GetLDAPSettings().Enabled,
+		"ldap_display_name":           system_setting.GetLDAPSettings().GetEffectiveDisplayName(),
 		"passkey_login":               passkeySetting.Enabled,
 		"passkey_display_name":        passkeySetting.RPDisplayName,
 		"passkey_rp_id":               passkeySetting.RPID,
@@ -164,6 +166,26 @@ func GetStatus(c *gin.Context) {
 		data["custom_oauth_providers"] = providersInfo
 	}
 
+	// Add enabled SAML identity providers
+	if samlProviders, err := model.GetEnabledSAMLProviders(); err == nil && len(samlProviders) > 0 {
+		type SAMLProviderInfo struct {
+			Id   int    `json:"id"`
+			Name string `json:"name"`
+			Slug string `json:"slug"`
+			Icon string `json:"icon"`
+		}
+		providersInfo := make([]SAMLProviderInfo, 0, len(samlProviders))
+		for _, p := range samlProviders {
+			providersInfo = append(providersInfo, SAMLProviderInfo{
+				Id:   p.Id,
+				Name: p.Name,
+				Slug: p.Slug,
+				Icon: p.Icon,
+			})
+		}
+		data["saml_providers"] = providersInfo
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type modelSplitArmComparison struct {
+	Model  string                    `json:"model"`
+	Weight int                       `json:"weight"`
+	Perf   *perfmetrics.ModelSummary `json:"perf,omitempty"`
+	Logs   *model.ModelAliasLogStat  `json:"logs,omitempty"`
+}
+
+// GetModelSplitComparison lines up the arms of a split alias side by side.
+// Log stats only count requests that came in through the alias, while perf
+// metrics are per model and also include direct traffic to the arm model.
+func GetModelSplitComparison(c *gin.Context) {
+	aliasName := c.Query("alias")
+	alias, ok := model_setting.GetModelSplitSettings().FindAlias(aliasName)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "model split alias not found",
+		})
+		return
+	}
+	hours := 24
+	if rawHours := c.Query("hours"); rawHours != "" {
+		if parsed, err := strconv.Atoi(rawHours); err == nil && parsed > 0 {
+			hours = parsed
+		}
+	}
+	if hours > 24*30 {
+		hours = 24 * 30
+	}
+
+	perfResult, err := perfmetrics.QuerySummaryAll(hours, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	endTs := time.Now().Unix()
+	logStats, err := model.GetModelAliasLogStats(alias.Alias, endTs-int64(hours)*3600, endTs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	arms := make([]modelSplitArmComparison, 0, len(alias.Arms))
+	for _, arm := range alias.Arms {
+		item := modelSplitArmComparison{Model: arm.Model, Weight: arm.Weight}
+		for i := range perfResult.Models {
+			if perfResult.Models[i].ModelName == arm.Model {
+				item.Perf = &perfResult.Models[i]
+				break
+			}
+		}
+		for i := range logStats {
+			if logStats[i].ModelName == arm.Model {
+				item.Logs = &logStats[i]
+				break
+			}
+		}
+		arms = append(arms, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"alias":     alias.Alias,
+			"sticky_by": alias.StickyBy,
+			"hours":     hours,
+			"arms":      arms,
+		},
+	})
+}
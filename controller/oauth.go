@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -325,6 +326,23 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 		}
 	}
 
+	// SCIM 开通的账号没有密码，首次通过系统 OIDC 登录时按配置的属性关联
+	if _, ok := provider.(*oauth.OIDCProvider); ok {
+		emailVerified, _ := oauthUser.Extra["email_verified"].(bool)
+		userId, err := service.LinkSCIMUserOidcId(oauthUser.ProviderUserID, service.SCIMSSOIdentity{
+			UserName:      oauthUser.Username,
+			ExternalId:    oauthUser.ProviderUserID,
+			Email:         oauthUser.Email,
+			EmailVerified: emailVerified,
+		})
+		if err == nil {
+			return model.GetUserById(userId, false)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
 	// User doesn't exist, create new user if registration is enabled
 	if !common.RegisterEnabled {
 		return nil, &OAuthRegistrationDisabledError{}
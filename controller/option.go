@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/console_setting"
 	"github.com/QuantumNous/new-api/setting/model_setting"
@@ -89,6 +91,8 @@ func GetOptions(c *gin.Context) {
 			strings.HasSuffix(k, "Secret") ||
 			strings.HasSuffix(k, "Key") ||
 			strings.HasSuffix(k, "secret") ||
+			strings.HasSuffix(k, "password") ||
+			strings.HasSuffix(k, "hash") ||
 			strings.HasSuffix(k, "api_key")
 		if isSensitiveKey {
 			continue
@@ -178,6 +182,46 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ldap.enabled":
+		if option.Value == "true" {
+			if err := service.ValidateLDAPSettings(system_setting.GetLDAPSettings()); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无法启用 LDAP 登录：" + err.Error(),
+				})
+				return
+			}
+		}
+	case "scim.enabled":
+		if option.Value == "true" && system_setting.GetSCIMSettings().TokenHash == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用 SCIM：请先生成 SCIM 令牌",
+			})
+			return
+		}
+	case "scim.sso_link_attribute":
+		if !system_setting.IsValidSCIMSSOLinkAttribute(option.Value.(string)) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "SCIM SSO 关联属性只能是 user_name、external_id、email 或留空",
+			})
+			return
+		}
+	case "scim.token_hash":
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "SCIM 令牌只能通过生成令牌接口设置",
+		})
+		return
+	case "ldap.group_mapping":
+		if err := validateLDAPGroupMapping(option.Value.(string)); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "LinuxDOOAuthEnabled":
 		if option.Value == "true" && common.LinuxDOClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -308,6 +352,24 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "SensitivePatterns":
+		err = setting.CheckSensitivePatterns(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "SensitiveGroupRules":
+		err = setting.CheckSensitiveGroupRules(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "AutomaticDisableStatusCodes":
 		_, err = operation_setting.ParseHTTPStatusCodeRanges(option.Value.(string))
 		if err != nil {
@@ -326,6 +388,78 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "proxy_pool_setting.pools":
+		err = system_setting.ValidateProxyPools(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "model_split.aliases":
+		err = model_setting.ValidateModelSplitAliases(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "pii_redaction_setting.detectors":
+		err = operation_setting.ValidatePIIDetectors(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "pii_redaction_setting.custom_rules":
+		err = operation_setting.ValidatePIICustomRules(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "shadow_traffic_setting.rules":
+		err = operation_setting.ValidateShadowTrafficRules(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "guardrail_setting.hooks":
+		err = operation_setting.ValidateGuardrailHooks(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "image_policy_setting.default":
+		err = operation_setting.ValidateImagePolicyRule(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "image_policy_setting.group_rules":
+		err = operation_setting.ValidateImagePolicyGroupRules(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "console_setting.api_info":
 		err = console_setting.ValidateConsoleSettings(option.Value.(string), "ApiInfo")
 		if err != nil {
@@ -377,3 +511,25 @@ func UpdateOption(c *gin.Context) {
 		"message": "",
 	})
 }
+
+func validateLDAPGroupMapping(value string) error {
+	mappings, err := system_setting.ParseLDAPGroupMapping(value)
+	if err != nil {
+		return errors.New("LDAP 分组映射必须是合法的 JSON 数组")
+	}
+	for index, mapping := range mappings {
+		if strings.TrimSpace(mapping.LDAPGroup) == "" {
+			return fmt.Errorf("LDAP 分组映射第 %d 项缺少 ldap_group", index+1)
+		}
+		if mapping.Group == "" && mapping.Role == "" {
+			return fmt.Errorf("LDAP 分组映射第 %d 项至少需要 group 或 role", index+1)
+		}
+		if mapping.Group != "" && !ratio_setting.ContainsGroupRatio(mapping.Group) {
+			return fmt.Errorf("LDAP 分组映射第 %d 项的分组 %s 不存在", index+1, mapping.Group)
+		}
+		if mapping.Role != "" && mapping.Role != system_setting.LDAPRoleAdmin {
+			return fmt.Errorf("LDAP 分组映射第 %d 项的角色只能为 admin", index+1)
+		}
+	}
+	return nil
+}
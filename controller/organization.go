@@ -0,0 +1,511 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const organizationNameMaxLength = 64
+
+type organizationRequest struct {
+	Name string `json:"name"`
+}
+
+type organizationMemberRequest struct {
+	UserId    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	QuotaCap  int    `json:"quota_cap"`
+	ResetUsed bool   `json:"reset_used"`
+}
+
+type organizationFundRequest struct {
+	Quota int `json:"quota"`
+}
+
+type organizationAdminRequest struct {
+	Status     int `json:"status"`
+	QuotaDelta int `json:"quota_delta"`
+}
+
+type organizationResponse struct {
+	*model.Organization
+	Role string `json:"role"`
+}
+
+// requireOrganizationPermission 校验当前用户是组织成员且角色具有 permission，
+// 失败时已写入响应。
+func requireOrganizationPermission(c *gin.Context, orgId int, permission string) (*model.Organization, *model.OrganizationMember, bool) {
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		if errors.Is(err, model.ErrOrganizationNotFound) {
+			common.ApiErrorMsg(c, "组织不存在")
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, nil, false
+	}
+	member, err := model.GetOrganizationMember(orgId, c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			common.ApiErrorMsg(c, "组织不存在")
+		} else {
+			common.ApiError(c, err)
+		}
+		return nil, nil, false
+	}
+	if permission != "" && !model.OrganizationRoleAllows(member.Role, permission) {
+		common.ApiErrorMsg(c, "无权进行此操作")
+		return nil, nil, false
+	}
+	return org, member, true
+}
+
+func organizationIdParam(c *gin.Context) int {
+	id, _ := strconv.Atoi(c.Param("id"))
+	return id
+}
+
+func validateOrganizationName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > organizationNameMaxLength {
+		return "", fmt.Errorf("组织名称不能为空且长度不能超过 %d", organizationNameMaxLength)
+	}
+	return name, nil
+}
+
+func GetUserOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, orgs)
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req organizationRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	name, err := validateOrganizationName(req.Name)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org, err := model.CreateOrganization(name, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organizationResponse{Organization: org, Role: model.OrganizationRoleOwner})
+}
+
+func GetOrganization(c *gin.Context) {
+	org, member, ok := requireOrganizationPermission(c, organizationIdParam(c), "")
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, organizationResponse{Organization: org, Role: member.Role})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	org, member, ok := requireOrganizationPermission(c, organizationIdParam(c), "")
+	if !ok {
+		return
+	}
+	if member.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以修改组织信息")
+		return
+	}
+	var req organizationRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	name, err := validateOrganizationName(req.Name)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := org.UpdateName(name); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, organizationResponse{Organization: org, Role: member.Role})
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	org, _, ok := requireOrganizationPermission(c, organizationIdParam(c), model.OrganizationPermViewMembers)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+// checkOrganizationRoleChange 所有者角色不能授予或变更；管理员角色只能由所有者授予或管理。
+func checkOrganizationRoleChange(operator *model.OrganizationMember, target *model.OrganizationMember, role string) error {
+	if !model.IsValidOrganizationRole(role) || role == model.OrganizationRoleOwner {
+		return errors.New("无效的成员角色")
+	}
+	if target != nil && target.Role == model.OrganizationRoleOwner {
+		return errors.New("不能修改组织所有者")
+	}
+	if operator.Role != model.OrganizationRoleOwner &&
+		(role == model.OrganizationRoleAdmin || (target != nil && target.Role == model.OrganizationRoleAdmin)) {
+		return errors.New("只有组织所有者可以管理管理员")
+	}
+	return nil
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	org, operator, ok := requireOrganizationPermission(c, organizationIdParam(c), model.OrganizationPermManageMembers)
+	if !ok {
+		return
+	}
+	var req organizationMemberRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := checkOrganizationRoleChange(operator, nil, req.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.QuotaCap < 0 {
+		common.ApiErrorMsg(c, "成员额度上限不能为负数")
+		return
+	}
+	var user *model.User
+	var err error
+	if req.UserId > 0 {
+		user, err = model.GetUserById(req.UserId, false)
+	} else {
+		user = &model.User{}
+		err = model.DB.Where("username = ?", strings.TrimSpace(req.Username)).First(user).Error
+	}
+	if err != nil {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	if _, err := model.GetOrganizationMember(org.Id, user.Id); err == nil {
+		common.ApiErrorMsg(c, "该用户已是组织成员")
+		return
+	}
+	member, err := model.AddOrganizationMember(org.Id, user.Id, req.Role, req.QuotaCap)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	member.Username = user.Username
+	common.ApiSuccess(c, member)
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	org, operator, ok := requireOrganizationPermission(c, organizationIdParam(c), model.OrganizationPermManageMembers)
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	target, err := model.GetOrganizationMember(org.Id, userId)
+	if err != nil {
+		common.ApiErrorMsg(c, "成员不存在")
+		return
+	}
+	var req organizationMemberRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.QuotaCap < 0 {
+		common.ApiErrorMsg(c, "成员额度上限不能为负数")
+		return
+	}
+	role := req.Role
+	if target.Role == model.OrganizationRoleOwner {
+		// 所有者只能调整自己的额度上限
+		if role != "" && role != model.OrganizationRoleOwner {
+			common.ApiErrorMsg(c, "不能修改组织所有者")
+			return
+		}
+		if operator.Role != model.OrganizationRoleOwner {
+			common.ApiErrorMsg(c, "不能修改组织所有者")
+			return
+		}
+		role = model.OrganizationRoleOwner
+	} else {
+		if role == "" {
+			role = target.Role
+		}
+		if err := checkOrganizationRoleChange(operator, target, role); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if err := model.UpdateOrganizationMember(target, role, req.QuotaCap, req.ResetUsed); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, target)
+}
+
+// RemoveOrganizationMember 移除成员，成员也可以通过该接口退出组织。
+// 成员创建的组织令牌转移给所有者并被禁用（离开的成员仍知道密钥），
+// 通过 RotateOrganizationTokenKey 换发新密钥后恢复使用，令牌设置与用量记录保持不变。
+func RemoveOrganizationMember(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	permission := model.OrganizationPermManageMembers
+	if userId == c.GetInt("id") {
+		permission = ""
+	}
+	org, operator, ok := requireOrganizationPermission(c, organizationIdParam(c), permission)
+	if !ok {
+		return
+	}
+	target, err := model.GetOrganizationMember(org.Id, userId)
+	if err != nil {
+		common.ApiErrorMsg(c, "成员不存在")
+		return
+	}
+	if target.Role == model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "组织所有者不能被移除或退出组织")
+		return
+	}
+	if target.UserId != operator.UserId && target.Role == model.OrganizationRoleAdmin && operator.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以管理管理员")
+		return
+	}
+	if err := model.RemoveOrganizationMember(org, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetOrganizationTokens 列出组织令牌；没有令牌管理权限的成员只能看到自己的组织令牌。
+func GetOrganizationTokens(c *gin.Context) {
+	org, member, ok := requireOrganizationPermission(c, organizationIdParam(c), "")
+	if !ok {
+		return
+	}
+	userId := member.UserId
+	if model.OrganizationRoleAllows(member.Role, model.OrganizationPermManageTokens) {
+		userId = 0
+	}
+	tokens, err := model.GetOrganizationTokens(org.Id, userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	responses := make([]*tokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		responses = append(responses, buildMaskedTokenResponse(token))
+	}
+	common.ApiSuccess(c, responses)
+}
+
+func DeleteOrganizationToken(c *gin.Context) {
+	org, member, ok := requireOrganizationPermission(c, organizationIdParam(c), "")
+	if !ok {
+		return
+	}
+	tokenId, _ := strconv.Atoi(c.Param("token_id"))
+	var err error
+	if model.OrganizationRoleAllows(member.Role, model.OrganizationPermManageTokens) {
+		err = model.DeleteOrganizationToken(org.Id, tokenId)
+	} else {
+		err = model.DeleteTokenById(tokenId, member.UserId)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// RotateOrganizationTokenKey 为组织令牌换发新密钥，旧密钥立即失效；被禁用的令牌同时恢复启用。
+// 没有令牌管理权限的成员只能轮换自己的组织令牌。
+func RotateOrganizationTokenKey(c *gin.Context) {
+	org, member, ok := requireOrganizationPermission(c, organizationIdParam(c), "")
+	if !ok {
+		return
+	}
+	tokenId, _ := strconv.Atoi(c.Param("token_id"))
+	userId := member.UserId
+	if model.OrganizationRoleAllows(member.Role, model.OrganizationPermManageTokens) {
+		userId = 0
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenGenerateFailed)
+		common.SysLog("failed to generate token key: " + err.Error())
+		return
+	}
+	token, err := model.RotateOrganizationTokenKey(org.Id, tokenId, userId, key)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 明文密钥只在这里返回一次，之后无法再查看
+	response := buildMaskedTokenResponse(token)
+	response.Key = key
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    response,
+	})
+}
+
+// FundOrganization 从当前用户的钱包向组织钱包转入额度。
+func FundOrganization(c *gin.Context) {
+	org, member, ok := requireOrganizationPermission(c, organizationIdParam(c), model.OrganizationPermFund)
+	if !ok {
+		return
+	}
+	var req organizationFundRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Quota <= 0 {
+		common.ApiErrorMsg(c, "转入额度必须大于 0")
+		return
+	}
+	// 子账户的额度按转售价计，转入组织钱包会绕过转售商的平台价结算
+	user, err := model.GetUserCache(member.UserId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.ParentId > 0 {
+		common.ApiErrorMsg(c, "子账户不能向组织转入额度")
+		return
+	}
+	reserved, err := model.TryReserveUserQuota(member.UserId, req.Quota)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !reserved {
+		common.ApiErrorMsg(c, "用户额度不足")
+		return
+	}
+	if err := model.IncreaseOrganizationQuota(org.Id, req.Quota); err != nil {
+		if rollbackErr := model.IncreaseUserQuota(member.UserId, req.Quota, false); rollbackErr != nil {
+			common.SysError(fmt.Sprintf("failed to roll back organization funding (userId=%d, orgId=%d, quota=%d): %s",
+				member.UserId, org.Id, req.Quota, rollbackErr.Error()))
+		}
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(member.UserId, model.LogTypeManage, fmt.Sprintf("向组织 %s（ID: %d）转入额度 %s", org.Name, org.Id, logger.LogQuota(req.Quota)))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetOrganizationUsage 按成员和模型汇总组织令牌的用量；没有查看用量权限的成员只能看到自己的用量。
+func GetOrganizationUsage(c *gin.Context) {
+	org, member, ok := requireOrganizationPermission(c, organizationIdParam(c), "")
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	stats, err := model.GetOrganizationUsage(org.Id, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !model.OrganizationRoleAllows(member.Role, model.OrganizationPermViewUsage) {
+		own := make([]model.OrganizationUsageStat, 0)
+		for _, stat := range stats {
+			if stat.UserId == member.UserId {
+				own = append(own, stat)
+			}
+		}
+		stats = own
+	}
+	common.ApiSuccess(c, gin.H{
+		"organization": org,
+		"items":        stats,
+	})
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminUpdateOrganization 管理员启用/禁用组织或调整组织钱包余额。
+func AdminUpdateOrganization(c *gin.Context) {
+	org, err := model.GetOrganizationById(organizationIdParam(c))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req organizationAdminRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Status != 0 {
+		if req.Status != model.OrganizationStatusEnabled && req.Status != model.OrganizationStatusDisabled {
+			common.ApiErrorMsg(c, "无效的组织状态")
+			return
+		}
+		if err := model.UpdateOrganizationStatus(org.Id, req.Status); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if req.QuotaDelta != 0 {
+		if err := model.IncreaseOrganizationQuota(org.Id, req.QuotaDelta); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	recordManageAudit(c, "organization.update", map[string]interface{}{
+		"id":          org.Id,
+		"name":        org.Name,
+		"status":      req.Status,
+		"quota_delta": req.QuotaDelta,
+	})
+	org, err = model.GetOrganizationById(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
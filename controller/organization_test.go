@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupOrganizationControllerTestDB(t *testing.T) *model.Organization {
+	t.Helper()
+
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}, &model.Organization{}, &model.OrganizationMember{}, &model.Log{}))
+	model.InitLogDB()
+	for _, user := range []*model.User{
+		{Id: 1, Username: "owner", AffCode: "aff-1", Quota: 5000, Status: common.UserStatusEnabled},
+		{Id: 2, Username: "admin", AffCode: "aff-2", Status: common.UserStatusEnabled},
+		{Id: 3, Username: "dev", AffCode: "aff-3", Status: common.UserStatusEnabled},
+		{Id: 4, Username: "outsider", AffCode: "aff-4", Status: common.UserStatusEnabled},
+	} {
+		require.NoError(t, db.Create(user).Error)
+	}
+	org, err := model.CreateOrganization("acme", 1)
+	require.NoError(t, err)
+	_, err = model.AddOrganizationMember(org.Id, 2, model.OrganizationRoleAdmin, 0)
+	require.NoError(t, err)
+	_, err = model.AddOrganizationMember(org.Id, 3, model.OrganizationRoleDeveloper, 0)
+	require.NoError(t, err)
+	return org
+}
+
+func newOrganizationContext(t *testing.T, method string, org *model.Organization, body any, userId int, params ...gin.Param) (*gin.Context, func() tokenAPIResponse) {
+	t.Helper()
+	ctx, recorder := newAuthenticatedContext(t, method, "/api/organization/", body, userId)
+	ctx.Params = append(gin.Params{{Key: "id", Value: strconv.Itoa(org.Id)}}, params...)
+	return ctx, func() tokenAPIResponse { return decodeAPIResponse(t, recorder) }
+}
+
+func TestOrganizationMemberManagementRespectsRoles(t *testing.T) {
+	org := setupOrganizationControllerTestDB(t)
+
+	ctx, response := newOrganizationContext(t, http.MethodPost, org, map[string]any{"username": "outsider", "role": model.OrganizationRoleDeveloper}, 3)
+	AddOrganizationMember(ctx)
+	assert.False(t, response().Success, "developers cannot manage members")
+
+	ctx, response = newOrganizationContext(t, http.MethodPost, org, map[string]any{"username": "outsider", "role": model.OrganizationRoleAdmin}, 2)
+	AddOrganizationMember(ctx)
+	assert.False(t, response().Success, "only the owner can grant admin")
+
+	ctx, response = newOrganizationContext(t, http.MethodPost, org, map[string]any{"username": "outsider", "role": model.OrganizationRoleOwner}, 1)
+	AddOrganizationMember(ctx)
+	assert.False(t, response().Success, "the owner role cannot be granted")
+
+	ctx, response = newOrganizationContext(t, http.MethodPost, org, map[string]any{"username": "outsider", "role": model.OrganizationRoleBilling, "quota_cap": 100}, 2)
+	AddOrganizationMember(ctx)
+	require.True(t, response().Success)
+
+	ctx, response = newOrganizationContext(t, http.MethodDelete, org, nil, 2, gin.Param{Key: "user_id", Value: "1"})
+	RemoveOrganizationMember(ctx)
+	assert.False(t, response().Success, "the owner cannot be removed")
+
+	// 成员可以自行退出组织
+	ctx, response = newOrganizationContext(t, http.MethodDelete, org, nil, 3, gin.Param{Key: "user_id", Value: "3"})
+	RemoveOrganizationMember(ctx)
+	require.True(t, response().Success)
+	_, err := model.GetOrganizationMember(org.Id, 3)
+	assert.Error(t, err)
+
+	ctx, response = newOrganizationContext(t, http.MethodGet, org, nil, 3)
+	GetOrganizationMembers(ctx)
+	assert.False(t, response().Success, "former members lose access")
+}
+
+func TestFundOrganizationMovesQuotaFromMemberWallet(t *testing.T) {
+	org := setupOrganizationControllerTestDB(t)
+
+	ctx, response := newOrganizationContext(t, http.MethodPost, org, map[string]any{"quota": 1000}, 2)
+	FundOrganization(ctx)
+	assert.False(t, response().Success, "admins cannot fund the wallet")
+
+	ctx, response = newOrganizationContext(t, http.MethodPost, org, map[string]any{"quota": 6000}, 1)
+	FundOrganization(ctx)
+	assert.False(t, response().Success, "funding is limited to the member's own balance")
+
+	ctx, response = newOrganizationContext(t, http.MethodPost, org, map[string]any{"quota": 2000}, 1)
+	FundOrganization(ctx)
+	require.True(t, response().Success)
+
+	quota, err := model.GetOrganizationQuota(org.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 2000, quota)
+	userQuota, err := model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3000, userQuota)
+}
+
+func TestAddTokenRequiresOrganizationPermission(t *testing.T) {
+	org := setupOrganizationControllerTestDB(t)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{
+		"name":            "org-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"org_id":          org.Id,
+	}, 4)
+	AddToken(ctx)
+	assert.False(t, decodeAPIResponse(t, recorder).Success, "non-members cannot create organization tokens")
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{
+		"name":            "org-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"org_id":          org.Id,
+	}, 3)
+	AddToken(ctx)
+	response := decodeAPIResponse(t, recorder)
+	require.True(t, response.Success, response.Message)
+	var created tokenResponseItem
+	require.NoError(t, common.Unmarshal(response.Data, &created))
+	stored, err := model.GetTokenById(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, org.Id, stored.OrgId)
+	assert.Equal(t, 3, stored.UserId)
+}
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"fmt"
+
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
@@ -33,6 +35,30 @@ func filterPricingByUsableGroups(pricing []model.Pricing, usableGroup map[string
 	return filtered
 }
 
+// resellerMarkupForUser 返回子账户所属转售商的加价配置，普通账户返回 nil。
+func resellerMarkupForUser(parentId int) *model.ResellerMarkup {
+	if parentId == 0 {
+		return nil
+	}
+	markup, err := model.GetResellerMarkup(parentId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to load reseller markup of user %d: %s", parentId, err.Error()))
+		return nil
+	}
+	return markup
+}
+
+func applyResellerModelMarkup(pricing []model.Pricing, markup *model.ResellerMarkup) []model.Pricing {
+	marked := make([]model.Pricing, len(pricing))
+	for i, item := range pricing {
+		ratio := markup.ModelRatio(item.ModelName)
+		item.ModelRatio *= ratio
+		item.ModelPrice *= ratio
+		marked[i] = item
+	}
+	return marked
+}
+
 func GetPricing(c *gin.Context) {
 	pricing := model.GetPricing()
 	userId, exists := c.Get("id")
@@ -42,6 +68,7 @@ func GetPricing(c *gin.Context) {
 		groupRatio[s] = f
 	}
 	var group string
+	var markup *model.ResellerMarkup
 	if exists {
 		user, err := model.GetUserCache(userId.(int))
 		if err == nil {
@@ -52,7 +79,15 @@ func GetPricing(c *gin.Context) {
 					groupRatio[g] = ratio
 				}
 			}
+			markup = resellerMarkupForUser(user.ParentId)
+		}
+	}
+	if markup != nil {
+		// 转售商子账户看到的是加价后的倍率
+		for g := range groupRatio {
+			groupRatio[g] *= markup.GroupRatio(g)
 		}
+		pricing = applyResellerModelMarkup(pricing, markup)
 	}
 
 	usableGroup = service.GetUserUsableGroups(group)
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const promptTemplateMaxContentLength = 100000
+
+type promptTemplateRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Public      bool              `json:"public"`
+	TokenIds    []int             `json:"token_ids"`
+	Content     string            `json:"content"`
+	Variables   map[string]string `json:"variables"`
+}
+
+type promptTemplateVersionResponse struct {
+	*model.PromptTemplateVersion
+	Variables     map[string]string `json:"variables"`
+	VariableNames []string          `json:"variable_names"`
+}
+
+type promptTemplateResponse struct {
+	*model.PromptTemplate
+	TokenIds []int                            `json:"token_ids"`
+	Owned    bool                             `json:"owned"`
+	Versions []*promptTemplateVersionResponse `json:"versions,omitempty"`
+}
+
+func buildPromptTemplateResponse(template *model.PromptTemplate, userId int) *promptTemplateResponse {
+	resp := &promptTemplateResponse{PromptTemplate: template, Owned: template.UserId == userId}
+	// 他人的公开模板不暴露其令牌设置
+	if resp.Owned {
+		resp.TokenIds = template.GetTokenIds()
+	}
+	return resp
+}
+
+func buildPromptTemplateVersionResponse(version *model.PromptTemplateVersion) *promptTemplateVersionResponse {
+	return &promptTemplateVersionResponse{
+		PromptTemplateVersion: version,
+		Variables:             version.GetVariables(),
+		VariableNames:         service.PromptTemplateVariableNames(version.Content),
+	}
+}
+
+func validatePromptTemplateContent(req *promptTemplateRequest) error {
+	if strings.TrimSpace(req.Content) == "" {
+		return fmt.Errorf("模板内容不能为空")
+	}
+	if len(req.Content) > promptTemplateMaxContentLength {
+		return fmt.Errorf("模板内容过长")
+	}
+	return nil
+}
+
+// applyPromptTemplateMeta validates and copies the metadata fields of req.
+func applyPromptTemplateMeta(c *gin.Context, template *model.PromptTemplate, req *promptTemplateRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 128 {
+		return fmt.Errorf("模板名称不能为空且长度不能超过 128")
+	}
+	if req.Public && c.GetInt("role") < common.RoleAdminUser {
+		return fmt.Errorf("仅管理员可以创建公开模板")
+	}
+	userId := c.GetInt("id")
+	for _, tokenId := range req.TokenIds {
+		if _, err := model.GetTokenByIds(tokenId, userId); err != nil {
+			return fmt.Errorf("令牌 %d 不存在", tokenId)
+		}
+	}
+	template.Name = name
+	template.Description = req.Description
+	template.Public = req.Public
+	return template.SetTokenIds(req.TokenIds)
+}
+
+func getOwnedPromptTemplate(c *gin.Context) (*model.PromptTemplate, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	template, err := model.GetPromptTemplateById(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return template, true
+}
+
+// GetPromptTemplates 列出当前用户的模板以及公开模板
+func GetPromptTemplates(c *gin.Context) {
+	userId := c.GetInt("id")
+	pageInfo := common.GetPageQuery(c)
+	templates, total, err := model.GetUserPromptTemplates(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]*promptTemplateResponse, 0, len(templates))
+	for _, template := range templates {
+		items = append(items, buildPromptTemplateResponse(template, userId))
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(items)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetPromptTemplate 获取模板及其全部版本，公开模板对所有用户可见
+func GetPromptTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	userId := c.GetInt("id")
+	template, err := model.GetVisiblePromptTemplateById(id, userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	versions, err := model.GetPromptTemplateVersions(template.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	resp := buildPromptTemplateResponse(template, userId)
+	for _, version := range versions {
+		resp.Versions = append(resp.Versions, buildPromptTemplateVersionResponse(version))
+	}
+	common.ApiSuccess(c, resp)
+}
+
+// CreatePromptTemplate 创建模板及其第一个版本
+func CreatePromptTemplate(c *gin.Context) {
+	var req promptTemplateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validatePromptTemplateContent(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	template := &model.PromptTemplate{UserId: c.GetInt("id")}
+	if err := applyPromptTemplateMeta(c, template, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	version := &model.PromptTemplateVersion{Content: req.Content}
+	if err := version.SetVariables(req.Variables); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := template.Insert(version); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	resp := buildPromptTemplateResponse(template, template.UserId)
+	resp.Versions = []*promptTemplateVersionResponse{buildPromptTemplateVersionResponse(version)}
+	common.ApiSuccess(c, resp)
+}
+
+// UpdatePromptTemplate 更新模板名称、描述和可用范围，内容修改需创建新版本
+func UpdatePromptTemplate(c *gin.Context) {
+	template, ok := getOwnedPromptTemplate(c)
+	if !ok {
+		return
+	}
+	var req promptTemplateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := applyPromptTemplateMeta(c, template, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := template.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, buildPromptTemplateResponse(template, template.UserId))
+}
+
+// CreatePromptTemplateVersion 发布新版本，已发布的版本不可修改
+func CreatePromptTemplateVersion(c *gin.Context) {
+	template, ok := getOwnedPromptTemplate(c)
+	if !ok {
+		return
+	}
+	var req promptTemplateRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validatePromptTemplateContent(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	version := &model.PromptTemplateVersion{Content: req.Content}
+	if err := version.SetVariables(req.Variables); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := template.AddVersion(version); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, buildPromptTemplateVersionResponse(version))
+}
+
+// DeletePromptTemplate 删除模板及其全部版本
+func DeletePromptTemplate(c *gin.Context) {
+	template, ok := getOwnedPromptTemplate(c)
+	if !ok {
+		return
+	}
+	if err := template.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
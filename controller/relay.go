@@ -68,6 +68,19 @@ func geminiRelayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewA
 	return err
 }
 
+func relayByFormat(c *gin.Context, relayFormat types.RelayFormat, info *relaycommon.RelayInfo) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		return relay.WssHelper(c, info)
+	case types.RelayFormatClaude:
+		return relay.ClaudeHelper(c, info)
+	case types.RelayFormatGemini:
+		return geminiRelayHandler(c, info)
+	default:
+		return relayHandler(c, info)
+	}
+}
+
 func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	requestId := c.GetString(common.RequestIdKey)
@@ -109,6 +122,19 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
+	if newAPIError = service.ApplyPromptTemplate(c, relayFormat); newAPIError != nil {
+		return
+	}
+	if newAPIError = service.ApplySystemPromptInjection(c, relayFormat); newAPIError != nil {
+		return
+	}
+	if newAPIError = service.ApplyPIIRedaction(c, relayFormat); newAPIError != nil {
+		return
+	}
+	if newAPIError = service.ApplyGuardrails(c, relayFormat); newAPIError != nil {
+		return
+	}
+
 	request, err := helper.GetAndValidateRequest(c, relayFormat)
 	if err != nil {
 		// Map "request body too large" to 413 so clients can handle it correctly
@@ -126,25 +152,41 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	if newAPIError = service.CheckGuardrailStream(c, relayInfo.IsStream); newAPIError != nil {
+		return
+	}
+
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
 	needCountToken := constant.CountToken
+	needImagePolicy := service.ImagePolicyEnabled()
+	needScopeMeta := service.TokenScopesNeedRequestMeta(c)
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needCountToken || needImagePolicy || needScopeMeta {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
 	}
 
 	if needSensitiveCheck && meta != nil {
-		contains, words := service.CheckSensitiveText(meta.CombineText)
+		contains, words := service.CheckSensitiveTextForGroup(meta.CombineText, relayInfo.UserGroup)
 		if contains {
 			logger.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
-			newAPIError = types.NewError(err, types.ErrorCodeSensitiveWordsDetected)
+			newAPIError = types.NewError(errors.New("sensitive words detected"), types.ErrorCodeSensitiveWordsDetected)
+			return
+		}
+	}
+
+	if needImagePolicy && meta != nil {
+		if newAPIError = service.CheckImagePolicy(c, meta.Files, relayInfo.UserGroup); newAPIError != nil {
 			return
 		}
 	}
 
+	if newAPIError = service.CheckTokenScopeRequest(c, request, meta); newAPIError != nil {
+		return
+	}
+
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
@@ -159,6 +201,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	if newAPIError = service.CheckTokenScopeCost(c, priceData.QuotaToPreConsume); newAPIError != nil {
+		return
+	}
+
 	// common.SetContextKey(c, constant.ContextKeyTokenCountMeta, meta)
 
 	if priceData.FreeModel {
@@ -190,7 +236,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 	relayInfo.RetryIndex = 0
 	relayInfo.LastError = nil
+	shadowSample := service.SampleShadowTraffic(c, relayFormat, relayInfo)
 
+retryLoop:
 	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
 		relayInfo.RetryIndex = retryParam.GetRetry()
 		channel, channelErr := getChannel(c, relayInfo, retryParam)
@@ -205,38 +253,51 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			break
 		}
 
-		bodyStorage, bodyErr := common.GetBodyStorage(c)
-		if bodyErr != nil {
-			// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
-			if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
-				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
-			} else {
-				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
-			}
-			break
+		var sameChannelRetry *service.SameChannelRetry
+		if channelSetting, ok := common.GetContextKeyType[dto.ChannelSettings](c, constant.ContextKeyChannelSetting); ok {
+			sameChannelRetry = service.NewSameChannelRetry(channelSetting.SameChannelRetry)
 		}
-		c.Request.Body = io.NopCloser(bodyStorage)
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
-		}
+		for {
+			bodyStorage, bodyErr := common.GetBodyStorage(c)
+			if bodyErr != nil {
+				// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
+				if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
+					newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+				} else {
+					newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+				}
+				break retryLoop
+			}
+			c.Request.Body = io.NopCloser(bodyStorage)
+			// 每次尝试使用新的过滤状态，失败尝试的命中不计入
+			service.InitSensitiveCompletionFilter(c, relayFormat)
 
-		if newAPIError == nil {
-			relayInfo.LastError = nil
-			return
-		}
+			newAPIError = relayByFormat(c, relayFormat, relayInfo)
 
-		newAPIError = service.NormalizeViolationFeeError(newAPIError)
-		relayInfo.LastError = newAPIError
+			if newAPIError == nil {
+				relayInfo.LastError = nil
+				if shadowSample != nil {
+					mirrorShadowTraffic(c, relayFormat, relayInfo, shadowSample)
+				}
+				return
+			}
+
+			newAPIError = service.NormalizeViolationFeeError(newAPIError)
+			relayInfo.LastError = newAPIError
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+			processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+
+			delay, ok := sameChannelRetry.Next(c, newAPIError)
+			if !ok {
+				break
+			}
+			logger.LogInfo(c, fmt.Sprintf("same channel retry #%d on channel #%d after %dms (status code %d)", sameChannelRetry.Attempts(), channel.Id, delay.Milliseconds(), newAPIError.StatusCode))
+			if !service.WaitSameChannelRetry(c.Request.Context(), delay) {
+				break retryLoop
+			}
+			recordSameChannelRetry(c, channel.Id, sameChannelRetry)
+		}
 
 		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
 			break
@@ -262,6 +323,17 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// recordSameChannelRetry keeps the per-channel retry delays for the admin-only
+// log info; use_channel lists each selected channel once.
+func recordSameChannelRetry(c *gin.Context, channelId int, retry *service.SameChannelRetry) {
+	retries, _ := common.GetContextKeyType[map[string][]int64](c, constant.ContextKeySameChannelRetries)
+	if retries == nil {
+		retries = make(map[string][]int64)
+	}
+	retries[fmt.Sprintf("%d", channelId)] = retry.DelaysMs()
+	common.SetContextKey(c, constant.ContextKeySameChannelRetries, retries)
+}
+
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
 	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
@@ -396,6 +468,7 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 			adminInfo["multi_key_index"] = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
 		}
 		service.AppendChannelAffinityAdminInfo(c, adminInfo)
+		service.AppendSameChannelRetryAdminInfo(c, adminInfo)
 		other["admin_info"] = adminInfo
 		startTime := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime)
 		if startTime.IsZero() {
@@ -588,6 +661,11 @@ func RelayTask(c *gin.Context) {
 		task.PrivateData.UpstreamTaskID = result.UpstreamTaskID
 		task.PrivateData.BillingSource = relayInfo.BillingSource
 		task.PrivateData.SubscriptionId = relayInfo.SubscriptionId
+		task.PrivateData.OrgId = relayInfo.OrgId
+		if relayInfo.BillingSource == service.BillingSourceWallet {
+			task.PrivateData.ResellerId = relayInfo.ResellerId
+			task.PrivateData.ResellerMarkup = relayInfo.ResellerMarkup
+		}
 		task.PrivateData.TokenId = relayInfo.TokenId
 		task.PrivateData.NodeName = common.NodeName
 		task.PrivateData.BillingContext = &model.TaskBillingContext{
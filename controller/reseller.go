@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type resellerChildRequest struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	DisplayName string `json:"display_name"`
+	Status      int    `json:"status"`
+}
+
+type resellerQuotaRequest struct {
+	Mode  string `json:"mode"` // add 或 subtract
+	Quota int    `json:"quota"`
+}
+
+type resellerResponse struct {
+	*model.Reseller
+	Markup *model.ResellerMarkup `json:"markup"`
+}
+
+// requireReseller 校验当前用户是转售商，失败时已写入响应。
+func requireReseller(c *gin.Context) (*model.Reseller, bool) {
+	reseller, err := model.GetReseller(c.GetInt("id"))
+	if errors.Is(err, model.ErrResellerNotEnabled) {
+		common.ApiErrorMsg(c, "当前账户未开通转售功能")
+		return nil, false
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return reseller, true
+}
+
+// requireResellerChild 校验 :id 是当前转售商的子账户。
+func requireResellerChild(c *gin.Context) (*model.Reseller, *model.User, bool) {
+	reseller, ok := requireReseller(c)
+	if !ok {
+		return nil, nil, false
+	}
+	childId, _ := strconv.Atoi(c.Param("id"))
+	child, err := model.GetChildUser(reseller.UserId, childId)
+	if err != nil {
+		common.ApiErrorMsg(c, "子账户不存在")
+		return nil, nil, false
+	}
+	return reseller, child, true
+}
+
+func GetResellerSelf(c *gin.Context) {
+	reseller, ok := requireReseller(c)
+	if !ok {
+		return
+	}
+	markup, err := reseller.GetMarkup()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, resellerResponse{Reseller: reseller, Markup: markup})
+}
+
+func UpdateResellerMarkup(c *gin.Context) {
+	reseller, ok := requireReseller(c)
+	if !ok {
+		return
+	}
+	var markup model.ResellerMarkup
+	if err := common.DecodeJson(c.Request.Body, &markup); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := markup.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateResellerMarkup(reseller.UserId, &markup); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, markup)
+}
+
+func GetResellerChildren(c *gin.Context) {
+	reseller, ok := requireReseller(c)
+	if !ok {
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	children, total, err := model.GetChildUsers(reseller.UserId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(children)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func CreateResellerChild(c *gin.Context) {
+	reseller, ok := requireReseller(c)
+	if !ok {
+		return
+	}
+	var req resellerChildRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	child := &model.User{
+		Username:    strings.TrimSpace(req.Username),
+		Password:    req.Password,
+		DisplayName: strings.TrimSpace(req.DisplayName),
+	}
+	if child.Username == "" || child.Password == "" {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if child.DisplayName == "" {
+		child.DisplayName = child.Username
+	}
+	if err := common.Validate.Struct(child); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgUserInputInvalid, map[string]any{"Error": err.Error()})
+		return
+	}
+	if err := model.CreateChildUser(reseller.UserId, child); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	child.Password = ""
+	common.ApiSuccess(c, child)
+}
+
+// UpdateResellerChild 修改子账户的显示名称或启用/禁用子账户。
+func UpdateResellerChild(c *gin.Context) {
+	_, child, ok := requireResellerChild(c)
+	if !ok {
+		return
+	}
+	var req resellerChildRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if displayName := strings.TrimSpace(req.DisplayName); displayName != "" {
+		if err := common.Validate.Var(displayName, "max=20"); err != nil {
+			common.ApiErrorI18n(c, i18n.MsgUserInputInvalid, map[string]any{"Error": err.Error()})
+			return
+		}
+		child.DisplayName = displayName
+	}
+	switch req.Status {
+	case 0:
+	case common.UserStatusEnabled, common.UserStatusDisabled:
+		child.Status = req.Status
+	default:
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := child.Update(false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 禁用后立即让子账户的令牌失效
+	if err := model.InvalidateUserTokensCache(child.Id); err != nil {
+		common.SysLog(fmt.Sprintf("failed to invalidate tokens cache for user %d: %s", child.Id, err.Error()))
+	}
+	child.Password = ""
+	common.ApiSuccess(c, child)
+}
+
+// AllocateResellerChildQuota 为子账户增加或扣回额度。子账户额度按转售价计，
+// 分配时不扣转售商的额度，转售商在子账户实际消费时按平台价支付。
+func AllocateResellerChildQuota(c *gin.Context) {
+	reseller, child, ok := requireResellerChild(c)
+	if !ok {
+		return
+	}
+	var req resellerQuotaRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.Quota <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgUserQuotaChangeZero)
+		return
+	}
+	var content string
+	switch req.Mode {
+	case "add":
+		if err := model.IncreaseUserQuota(child.Id, req.Quota, true); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		content = fmt.Sprintf("转售商（ID: %d）分配额度 %s", reseller.UserId, logger.LogQuota(req.Quota))
+	case "subtract":
+		reserved, err := model.TryReserveUserQuota(child.Id, req.Quota)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if !reserved {
+			common.ApiErrorMsg(c, "子账户剩余额度不足")
+			return
+		}
+		content = fmt.Sprintf("转售商（ID: %d）扣回额度 %s", reseller.UserId, logger.LogQuota(req.Quota))
+	default:
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	model.RecordLog(child.Id, model.LogTypeManage, content)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetResellerChildUsage 按子账户和模型汇总子账户的用量（转售价）。
+func GetResellerChildUsage(c *gin.Context) {
+	reseller, ok := requireReseller(c)
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	stats, err := model.GetResellerChildUsage(reseller.UserId, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, stats)
+}
+
+func GetAllResellers(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	resellers, total, err := model.GetAllResellers(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(resellers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func EnableReseller(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	reseller, err := model.EnableReseller(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAuditFor(c, userId, "reseller.enable", map[string]interface{}{
+		"id": userId,
+	})
+	common.ApiSuccess(c, reseller)
+}
+
+func DisableReseller(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	if err := model.DisableReseller(userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAuditFor(c, userId, "reseller.disable", map[string]interface{}{
+		"id": userId,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
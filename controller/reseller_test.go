@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupResellerControllerTestDB(t *testing.T) {
+	t.Helper()
+
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.UserSession{}, &model.Reseller{}, &model.Log{}))
+	model.InitLogDB()
+	require.NoError(t, db.Create(&model.User{Id: 1, Username: "reseller", AffCode: "aff-1", Quota: 1000, Status: common.UserStatusEnabled}).Error)
+	require.NoError(t, db.Create(&model.User{Id: 2, Username: "plain", AffCode: "aff-2", Status: common.UserStatusEnabled}).Error)
+	_, err := model.EnableReseller(1)
+	require.NoError(t, err)
+}
+
+func TestResellerManagesChildAccounts(t *testing.T) {
+	setupResellerControllerTestDB(t)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/reseller/child", map[string]any{"username": "child", "password": "password123"}, 2)
+	CreateResellerChild(ctx)
+	assert.False(t, decodeAPIResponse(t, recorder).Success, "users without reseller access cannot create children")
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/reseller/child", map[string]any{"username": "child", "password": "password123"}, 1)
+	CreateResellerChild(ctx)
+	response := decodeAPIResponse(t, recorder)
+	require.True(t, response.Success, response.Message)
+	var child model.User
+	require.NoError(t, common.Unmarshal(response.Data, &child))
+	assert.Empty(t, child.Password)
+	assert.Equal(t, 1, child.ParentId)
+
+	childParam := gin.Param{Key: "id", Value: common.Interface2String(child.Id)}
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/reseller/child/quota", map[string]any{"mode": "add", "quota": 500}, 1)
+	ctx.Params = gin.Params{childParam}
+	AllocateResellerChildQuota(ctx)
+	require.True(t, decodeAPIResponse(t, recorder).Success)
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/reseller/child/quota", map[string]any{"mode": "subtract", "quota": 600}, 1)
+	ctx.Params = gin.Params{childParam}
+	AllocateResellerChildQuota(ctx)
+	assert.False(t, decodeAPIResponse(t, recorder).Success, "cannot take back more than the child has")
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/reseller/child/quota", map[string]any{"mode": "subtract", "quota": 200}, 1)
+	ctx.Params = gin.Params{childParam}
+	AllocateResellerChildQuota(ctx)
+	require.True(t, decodeAPIResponse(t, recorder).Success)
+
+	childQuota, err := model.GetUserQuota(child.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 300, childQuota)
+	resellerQuota, err := model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, resellerQuota, "allocation does not charge the reseller")
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPut, "/api/reseller/child", map[string]any{"status": common.UserStatusDisabled}, 1)
+	ctx.Params = gin.Params{childParam}
+	UpdateResellerChild(ctx)
+	response = decodeAPIResponse(t, recorder)
+	require.True(t, response.Success, response.Message)
+	stored, err := model.GetUserById(child.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, common.UserStatusDisabled, stored.Status)
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPut, "/api/reseller/markup", map[string]any{"default": 0.5, "models": map[string]float64{"gpt-4o": -1}}, 1)
+	UpdateResellerMarkup(ctx)
+	assert.False(t, decodeAPIResponse(t, recorder).Success, "negative markups are rejected")
+}
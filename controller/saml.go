@@ -0,0 +1,517 @@
+package controller
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	samlAuthFlowTTL = 10 * time.Minute
+	// ACS 校验断言后签发的一次性登录凭证，由前端立即兑换为登录会话
+	samlLoginFlowTTL = 2 * time.Minute
+
+	samlErrorDisabled         = "SAML_DISABLED"
+	samlErrorFlowInvalid      = "SAML_FLOW_INVALID"
+	samlErrorAssertionInvalid = "SAML_ASSERTION_INVALID"
+	samlErrorAccessDenied     = "SAML_ACCESS_DENIED"
+	samlErrorNotProvisioned   = "SAML_USER_NOT_PROVISIONED"
+	samlErrorEmailTaken       = "SAML_EMAIL_TAKEN"
+	samlErrorAlreadyBound     = "SAML_ALREADY_BOUND"
+	samlErrorSessionInvalid   = "SAML_SESSION_INVALID"
+	samlErrorUserDeleted      = "SAML_USER_DELETED"
+	samlErrorUserDisabled     = "SAML_USER_DISABLED"
+	samlErrorInternal         = "SAML_INTERNAL_ERROR"
+)
+
+var (
+	errSAMLUserNotProvisioned = errors.New("saml user is not provisioned")
+	errSAMLAlreadyBound       = errors.New("saml identity is already bound")
+	errSAMLAssertionReplayed  = errors.New("saml assertion was already used")
+	errSAMLBindUserDisabled   = errors.New("saml bind user is disabled")
+)
+
+type samlStartRequest struct {
+	Intent string `json:"intent"`
+	Aff    string `json:"aff,omitempty"`
+}
+
+type samlFlowPayload struct {
+	RequestId     string `json:"request_id"`
+	AffiliateCode string `json:"affiliate_code,omitempty"`
+}
+
+type samlLoginRequest struct {
+	FlowToken string `json:"flow_token"`
+}
+
+// getEnabledSAMLProvider 返回已启用的 IdP 配置，未启用时已写入响应。
+func getEnabledSAMLProvider(c *gin.Context) (*model.SAMLProvider, bool) {
+	config, err := model.GetSAMLProviderBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.T(c, i18n.MsgOAuthUnknownProvider),
+		})
+		return nil, false
+	}
+	if !config.Enabled {
+		common.ApiErrorI18n(c, i18n.MsgOAuthNotEnabled, providerParams(config.Name))
+		return nil, false
+	}
+	return config, true
+}
+
+// GetSAMLMetadata serves the SP metadata to be imported into the IdP. It is
+// available before the provider is enabled so the IdP side can be set up first.
+func GetSAMLMetadata(c *gin.Context) {
+	config, err := model.GetSAMLProviderBySlug(c.Param("slug"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	sp, err := oauth.NewSAMLServiceProvider(config)
+	if err != nil {
+		common.SysError("SAML metadata for " + config.Slug + " failed: " + err.Error())
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// StartSAML issues an AuthnRequest (HTTP-Redirect binding). The flow token is
+// sent as RelayState and the request ID is kept in the flow, so the ACS only
+// accepts responses to requests we issued.
+func StartSAML(c *gin.Context) {
+	config, ok := getEnabledSAMLProvider(c)
+	if !ok {
+		return
+	}
+	var request samlStartRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	request.Intent = strings.TrimSpace(request.Intent)
+	request.Aff = strings.TrimSpace(request.Aff)
+	if (request.Intent != model.AuthFlowIntentLogin && request.Intent != model.AuthFlowIntentBind) ||
+		len(request.Aff) > 32 ||
+		(request.Intent == model.AuthFlowIntentBind && request.Aff != "") {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	userID := 0
+	sessionID := ""
+	if request.Intent == model.AuthFlowIntentBind {
+		identity, ok := middleware.GetSessionAuthIdentity(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "绑定操作需要登录"})
+			return
+		}
+		userID = identity.UserID
+		sessionID = identity.SessionID
+	}
+
+	sp, err := oauth.NewSAMLServiceProvider(config)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	ssoURL := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if ssoURL == "" {
+		common.ApiErrorMsg(c, "IdP 未提供 HTTP-Redirect 绑定的单点登录地址")
+		return
+	}
+	authnRequest, err := sp.MakeAuthenticationRequest(ssoURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	payload, err := common.Marshal(samlFlowPayload{RequestId: authnRequest.ID, AffiliateCode: request.Aff})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	expiresAt := time.Now().Add(samlAuthFlowTTL)
+	flowToken, _, err := model.CreateAuthFlow(model.AuthFlowCreate{
+		Purpose:   model.AuthFlowPurposeSAML,
+		Provider:  config.Slug,
+		Intent:    request.Intent,
+		UserId:    userID,
+		SessionId: sessionID,
+		Payload:   string(payload),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	redirectURL, err := authnRequest.Redirect(flowToken, sp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"redirect_url": redirectURL.String(),
+			"flow_token":   flowToken,
+			"expires_at":   expiresAt.Unix(),
+		},
+	})
+}
+
+// SAMLAssertionConsumer is the ACS endpoint (HTTP-POST binding). The browser
+// arrives here from the IdP, so results are reported by redirecting back to
+// the frontend instead of JSON.
+func SAMLAssertionConsumer(c *gin.Context) {
+	slug := c.Param("slug")
+	config, err := model.GetSAMLProviderBySlug(slug)
+	if err != nil || !config.Enabled {
+		samlCallbackFailure(c, slug, "", samlErrorDisabled)
+		return
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		samlCallbackFailure(c, slug, "", samlErrorAssertionInvalid)
+		return
+	}
+	flowToken := c.Request.PostForm.Get("RelayState")
+	pendingFlow, err := model.GetAuthFlow(flowToken, model.AuthFlowMatch{
+		Purpose:  model.AuthFlowPurposeSAML,
+		Provider: slug,
+	})
+	if err != nil {
+		if !errors.Is(err, model.ErrAuthFlowInvalid) &&
+			!errors.Is(err, model.ErrAuthFlowExpired) &&
+			!errors.Is(err, model.ErrAuthFlowConsumed) {
+			common.SysError("SAML flow lookup failed: " + err.Error())
+			samlCallbackFailure(c, slug, "", samlErrorInternal)
+			return
+		}
+		samlCallbackFailure(c, slug, "", samlErrorFlowInvalid)
+		return
+	}
+	intent := pendingFlow.Intent
+	var payload samlFlowPayload
+	if err := common.UnmarshalJsonStr(pendingFlow.Payload, &payload); err != nil || payload.RequestId == "" {
+		samlCallbackFailure(c, slug, intent, samlErrorFlowInvalid)
+		return
+	}
+
+	sp, err := oauth.NewSAMLServiceProvider(config)
+	if err != nil {
+		common.SysError("SAML provider " + slug + " is misconfigured: " + err.Error())
+		samlCallbackFailure(c, slug, intent, samlErrorInternal)
+		return
+	}
+	assertion, err := sp.ParseResponse(c.Request, []string{payload.RequestId})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			err = invalid.PrivateErr
+		}
+		common.SysLog("SAML assertion from " + slug + " rejected: " + err.Error())
+		samlCallbackFailure(c, slug, intent, samlErrorAssertionInvalid)
+		return
+	}
+	samlUser, err := oauth.SAMLUserFromAssertion(config, assertion)
+	if err != nil {
+		common.SysLog("SAML assertion from " + slug + " rejected: " + err.Error())
+		samlCallbackFailure(c, slug, intent, samlErrorAssertionInvalid)
+		return
+	}
+
+	switch intent {
+	case model.AuthFlowIntentLogin:
+		handleSAMLLogin(c, config, flowToken, pendingFlow, assertion, samlUser, payload)
+	case model.AuthFlowIntentBind:
+		handleSAMLBind(c, config, flowToken, pendingFlow, assertion, samlUser)
+	default:
+		samlCallbackFailure(c, slug, intent, samlErrorFlowInvalid)
+	}
+}
+
+// claimSAMLAssertion 记录断言 ID，同一断言不能被重放。
+func claimSAMLAssertion(tx *gorm.DB, config *model.SAMLProvider, assertion *saml.Assertion) error {
+	err := model.ClaimExternalAuthAssertionWithTx(
+		tx,
+		model.AuthFlowPurposeSAMLAssertion,
+		config.Slug+":"+assertion.ID,
+		oauth.SAMLAssertionExpiresAt(assertion),
+	)
+	if errors.Is(err, model.ErrAuthFlowInvalid) || errors.Is(err, model.ErrAuthFlowConsumed) {
+		return errors.Join(errSAMLAssertionReplayed, err)
+	}
+	return err
+}
+
+func handleSAMLLogin(c *gin.Context, config *model.SAMLProvider, flowToken string, pendingFlow *model.AuthFlow, assertion *saml.Assertion, samlUser *oauth.SAMLUser, payload samlFlowPayload) {
+	_, err := model.ConsumeAuthFlowWithAction(flowToken, model.AuthFlowMatch{
+		Purpose:  model.AuthFlowPurposeSAML,
+		Provider: config.Slug,
+		Intent:   model.AuthFlowIntentLogin,
+	}, func(tx *gorm.DB, flow *model.AuthFlow) error {
+		return claimSAMLAssertion(tx, config, assertion)
+	})
+	if err != nil {
+		samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlFlowErrorCode(err))
+		return
+	}
+
+	group, groupMatched := config.MapGroup(samlUser.Groups)
+	if config.RequireGroupMatch && !groupMatched {
+		samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorAccessDenied)
+		return
+	}
+	user, err := findOrCreateSAMLUser(config, samlUser, group, groupMatched, payload.AffiliateCode)
+	if err != nil {
+		var emailTaken *OAuthEmailAlreadyTakenError
+		var userDeleted *OAuthUserDeletedError
+		switch {
+		case errors.Is(err, errSAMLUserNotProvisioned):
+			samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorNotProvisioned)
+		case errors.As(err, &emailTaken), errors.Is(err, model.ErrEmailAlreadyTaken):
+			samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorEmailTaken)
+		case errors.As(err, &userDeleted):
+			samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorUserDeleted)
+		default:
+			common.SysError("SAML login for " + config.Slug + " failed: " + err.Error())
+			samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorInternal)
+		}
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorUserDisabled)
+		return
+	}
+
+	loginToken, _, err := model.CreateAuthFlow(model.AuthFlowCreate{
+		Purpose:   model.AuthFlowPurposeSAMLLogin,
+		Provider:  config.Slug,
+		Intent:    model.AuthFlowIntentLogin,
+		UserId:    user.Id,
+		ExpiresAt: time.Now().Add(samlLoginFlowTTL),
+	})
+	if err != nil {
+		common.SysError("SAML login flow creation failed: " + err.Error())
+		samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorInternal)
+		return
+	}
+	samlCallbackRedirect(c, url.Values{
+		"intent":     {model.AuthFlowIntentLogin},
+		"status":     {"success"},
+		"provider":   {config.Slug},
+		"flow_token": {loginToken},
+	})
+}
+
+func handleSAMLBind(c *gin.Context, config *model.SAMLProvider, flowToken string, pendingFlow *model.AuthFlow, assertion *saml.Assertion, samlUser *oauth.SAMLUser) {
+	// 浏览器从 IdP 跨站 POST 回来时不会携带登录凭证，改为校验发起绑定时记录的会话
+	if _, err := service.ValidateSessionReference(pendingFlow.UserId, pendingFlow.SessionId); err != nil {
+		samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorSessionInvalid)
+		return
+	}
+	_, err := model.ConsumeAuthFlowWithAction(flowToken, model.AuthFlowMatch{
+		Purpose:   model.AuthFlowPurposeSAML,
+		Provider:  config.Slug,
+		Intent:    model.AuthFlowIntentBind,
+		UserId:    pendingFlow.UserId,
+		SessionId: pendingFlow.SessionId,
+	}, func(tx *gorm.DB, flow *model.AuthFlow) error {
+		if err := claimSAMLAssertion(tx, config, assertion); err != nil {
+			return err
+		}
+		var user model.User
+		if err := tx.First(&user, flow.UserId).Error; err != nil {
+			return err
+		}
+		if user.Status != common.UserStatusEnabled {
+			return errSAMLBindUserDisabled
+		}
+		if err := model.ClaimExternalIdentityWithTx(tx, config.IdentityProvider(), samlUser.ProviderUserID, user.Id); err != nil {
+			if errors.Is(err, model.ErrExternalIdentityAlreadyClaimed) {
+				return errSAMLAlreadyBound
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errSAMLAlreadyBound):
+			samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorAlreadyBound)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorUserDeleted)
+		case errors.Is(err, errSAMLBindUserDisabled):
+			samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlErrorUserDisabled)
+		default:
+			samlCallbackFailure(c, config.Slug, pendingFlow.Intent, samlFlowErrorCode(err))
+		}
+		return
+	}
+	samlCallbackRedirect(c, url.Values{
+		"intent":   {model.AuthFlowIntentBind},
+		"status":   {"success"},
+		"provider": {config.Slug},
+	})
+}
+
+func samlFlowErrorCode(err error) string {
+	switch {
+	case errors.Is(err, errSAMLAssertionReplayed):
+		return samlErrorAssertionInvalid
+	case errors.Is(err, model.ErrAuthFlowInvalid), errors.Is(err, model.ErrAuthFlowExpired), errors.Is(err, model.ErrAuthFlowConsumed):
+		return samlErrorFlowInvalid
+	default:
+		common.SysError("SAML flow failed: " + err.Error())
+		return samlErrorInternal
+	}
+}
+
+func samlCallbackFailure(c *gin.Context, slug, intent, errorCode string) {
+	if intent == "" {
+		intent = model.AuthFlowIntentLogin
+	}
+	samlCallbackRedirect(c, url.Values{
+		"intent":     {intent},
+		"status":     {"error"},
+		"provider":   {slug},
+		"error_code": {errorCode},
+	})
+}
+
+func samlCallbackRedirect(c *gin.Context, query url.Values) {
+	c.Redirect(http.StatusSeeOther, "/oauth/saml?"+query.Encode())
+}
+
+// findOrCreateSAMLUser 按 NameID 查找已绑定的用户；未绑定时仅在 IdP 开启自动开通后创建用户。
+// 映射到分组时，以 IdP 下发的分组为准同步已有用户的分组。
+func findOrCreateSAMLUser(config *model.SAMLProvider, samlUser *oauth.SAMLUser, group string, groupMatched bool, affiliateCode string) (*model.User, error) {
+	providerKey := config.IdentityProvider()
+	userId, err := model.GetExternalIdentityOwner(providerKey, samlUser.ProviderUserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// SCIM 开通的账号没有密码，首次 SSO 登录时按配置的属性关联
+		userId, err = service.LinkSCIMUserExternalIdentity(providerKey, samlUser.ProviderUserID, service.SCIMSSOIdentity{
+			UserName:      samlUser.Username,
+			ExternalId:    samlUser.ProviderUserID,
+			Email:         samlUser.Email,
+			EmailVerified: true,
+		})
+	}
+	if err == nil {
+		user, err := model.GetUserById(userId, false)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &OAuthUserDeletedError{}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if groupMatched && user.Group != group {
+			if _, err := model.UpdateUserGroupFromIdentityProvider(user.Id, group); err != nil {
+				return nil, err
+			}
+			user.Group = group
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if !config.AutoProvision {
+		return nil, errSAMLUserNotProvisioned
+	}
+
+	user := &model.User{
+		Username: "saml_" + strconv.Itoa(model.GetMaxUserId()+1),
+		Role:     common.RoleCommonUser,
+		Status:   common.UserStatusEnabled,
+	}
+	if samlUser.Username != "" && len(samlUser.Username) <= model.UserNameMaxLength {
+		if exists, err := model.CheckUserExistOrDeleted(samlUser.Username, ""); err == nil && !exists {
+			user.Username = samlUser.Username
+		}
+	}
+	switch {
+	case samlUser.DisplayName != "":
+		user.DisplayName = samlUser.DisplayName
+	case samlUser.Username != "":
+		user.DisplayName = samlUser.Username
+	default:
+		user.DisplayName = config.Name + " User"
+	}
+	if samlUser.Email != "" {
+		user.Email = model.NormalizeEmail(samlUser.Email)
+		if err := model.EnsureEmailAvailable(user.Email, 0); err != nil {
+			if errors.Is(err, model.ErrEmailAlreadyTaken) {
+				return nil, &OAuthEmailAlreadyTakenError{}
+			}
+			return nil, err
+		}
+	}
+	if groupMatched {
+		user.Group = group
+	}
+	inviterId := 0
+	if affiliateCode != "" {
+		inviterId, _ = model.GetUserIdByAffCode(affiliateCode)
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := user.InsertWithTx(tx, inviterId); err != nil {
+			return err
+		}
+		return model.ClaimExternalIdentityWithTx(tx, providerKey, samlUser.ProviderUserID, user.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.FinalizeOAuthUserCreation(inviterId)
+	return user, nil
+}
+
+// SAMLLogin exchanges the one-time token issued by the ACS for a login session.
+func SAMLLogin(c *gin.Context) {
+	var request samlLoginRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	flow, err := model.ConsumeAuthFlow(strings.TrimSpace(request.FlowToken), model.AuthFlowMatch{
+		Purpose: model.AuthFlowPurposeSAMLLogin,
+		Intent:  model.AuthFlowIntentLogin,
+	})
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": i18n.T(c, i18n.MsgOAuthStateInvalid)})
+		return
+	}
+	user, err := model.GetUserById(flow.UserId, false)
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgOAuthUserDeleted)
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		common.ApiErrorI18n(c, i18n.MsgOAuthUserBanned)
+		return
+	}
+	setupLogin(user, c)
+}
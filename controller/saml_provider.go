@@ -0,0 +1,355 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/oauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// samlMetadataMaxBytes 限制拉取的 IdP 元数据大小
+const samlMetadataMaxBytes = 1 << 20
+
+// SAMLProviderResponse adds the SP endpoints an admin needs to register the
+// provider at the IdP. The SP private key is never returned.
+type SAMLProviderResponse struct {
+	*model.SAMLProvider
+	EntityID    string `json:"entity_id"`
+	ACSURL      string `json:"acs_url"`
+	MetadataURL string `json:"metadata_url"`
+}
+
+// SAMLProviderRequest is used for both create and update. On update, nil
+// pointers keep the existing value.
+type SAMLProviderRequest struct {
+	Name                 string  `json:"name"`
+	Slug                 string  `json:"slug"`
+	Icon                 *string `json:"icon"`
+	Enabled              *bool   `json:"enabled"`
+	IdPMetadata          *string `json:"idp_metadata"`
+	MetadataURL          *string `json:"idp_metadata_url"`
+	NameIDFormat         *string `json:"name_id_format"`
+	UsernameAttribute    *string `json:"username_attribute"`
+	EmailAttribute       *string `json:"email_attribute"`
+	DisplayNameAttribute *string `json:"display_name_attribute"`
+	GroupAttribute       *string `json:"group_attribute"`
+	GroupMapping         *string `json:"group_mapping"`
+	RequireGroupMatch    *bool   `json:"require_group_match"`
+	AutoProvision        *bool   `json:"auto_provision"`
+	// SP 密钥对可选：创建时留空自动生成；更新时同时提供证书和私钥用于轮换
+	SPCertificate string `json:"sp_certificate"`
+	SPPrivateKey  string `json:"sp_private_key"`
+}
+
+type FetchSAMLMetadataRequest struct {
+	URL string `json:"url"`
+}
+
+type UserSAMLBindingResponse struct {
+	ProviderName string `json:"provider_name"`
+	ProviderSlug string `json:"provider_slug"`
+	ProviderIcon string `json:"provider_icon"`
+	Subject      string `json:"subject"`
+}
+
+func toSAMLProviderResponse(p *model.SAMLProvider) *SAMLProviderResponse {
+	return &SAMLProviderResponse{
+		SAMLProvider: p,
+		EntityID:     oauth.SAMLMetadataURL(p.Slug),
+		ACSURL:       oauth.SAMLACSURL(p.Slug),
+		MetadataURL:  oauth.SAMLMetadataURL(p.Slug),
+	}
+}
+
+func applySAMLProviderRequest(provider *model.SAMLProvider, req *SAMLProviderRequest) {
+	if req.Name != "" {
+		provider.Name = req.Name
+	}
+	if req.Icon != nil {
+		provider.Icon = *req.Icon
+	}
+	if req.Enabled != nil {
+		provider.Enabled = *req.Enabled
+	}
+	if req.IdPMetadata != nil {
+		provider.IdPMetadata = strings.TrimSpace(*req.IdPMetadata)
+	}
+	if req.MetadataURL != nil {
+		provider.MetadataURL = strings.TrimSpace(*req.MetadataURL)
+	}
+	if req.NameIDFormat != nil {
+		provider.NameIDFormat = strings.TrimSpace(*req.NameIDFormat)
+	}
+	if req.UsernameAttribute != nil {
+		provider.UsernameAttribute = strings.TrimSpace(*req.UsernameAttribute)
+	}
+	if req.EmailAttribute != nil {
+		provider.EmailAttribute = strings.TrimSpace(*req.EmailAttribute)
+	}
+	if req.DisplayNameAttribute != nil {
+		provider.DisplayNameAttribute = strings.TrimSpace(*req.DisplayNameAttribute)
+	}
+	if req.GroupAttribute != nil {
+		provider.GroupAttribute = strings.TrimSpace(*req.GroupAttribute)
+	}
+	if req.GroupMapping != nil {
+		provider.GroupMapping = *req.GroupMapping
+	}
+	if req.RequireGroupMatch != nil {
+		provider.RequireGroupMatch = *req.RequireGroupMatch
+	}
+	if req.AutoProvision != nil {
+		provider.AutoProvision = *req.AutoProvision
+	}
+}
+
+// checkSAMLProvider 在保存前确认元数据和密钥可以构造出可用的 SP。
+func checkSAMLProvider(c *gin.Context, provider *model.SAMLProvider) bool {
+	if _, err := oauth.NewSAMLServiceProvider(provider); err != nil {
+		common.ApiErrorMsg(c, "SAML 配置无效: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func GetSAMLProviders(c *gin.Context) {
+	providers, err := model.GetAllSAMLProviders()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	response := make([]*SAMLProviderResponse, len(providers))
+	for i, p := range providers {
+		response[i] = toSAMLProviderResponse(p)
+	}
+	common.ApiSuccess(c, response)
+}
+
+func GetSAMLProvider(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的 ID")
+		return
+	}
+	provider, err := model.GetSAMLProviderById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "未找到该 SAML 身份提供商")
+		return
+	}
+	common.ApiSuccess(c, toSAMLProviderResponse(provider))
+}
+
+func CreateSAMLProvider(c *gin.Context) {
+	var req SAMLProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的请求参数: "+err.Error())
+		return
+	}
+	slug := strings.ToLower(strings.TrimSpace(req.Slug))
+	if model.IsSAMLSlugTaken(slug, 0) {
+		common.ApiErrorMsg(c, "该 Slug 已被使用")
+		return
+	}
+	provider := &model.SAMLProvider{Slug: slug}
+	applySAMLProviderRequest(provider, &req)
+	if req.SPCertificate != "" || req.SPPrivateKey != "" {
+		provider.SPCertificate = req.SPCertificate
+		provider.SPPrivateKey = req.SPPrivateKey
+	} else {
+		certPEM, keyPEM, err := oauth.GenerateSAMLKeyPair(oauth.SAMLMetadataURL(slug))
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		provider.SPCertificate = certPEM
+		provider.SPPrivateKey = keyPEM
+	}
+	if !checkSAMLProvider(c, provider) {
+		return
+	}
+	if err := model.CreateSAMLProvider(provider); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "创建成功",
+		"data":    toSAMLProviderResponse(provider),
+	})
+}
+
+// UpdateSAMLProvider updates an IdP. The slug is part of the entity ID, the
+// ACS URL and every identity binding, so it cannot be changed.
+func UpdateSAMLProvider(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的 ID")
+		return
+	}
+	var req SAMLProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的请求参数: "+err.Error())
+		return
+	}
+	provider, err := model.GetSAMLProviderById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "未找到该 SAML 身份提供商")
+		return
+	}
+	if req.Slug != "" && strings.ToLower(strings.TrimSpace(req.Slug)) != provider.Slug {
+		common.ApiErrorMsg(c, "SAML 身份提供商的 Slug 创建后不可修改")
+		return
+	}
+	applySAMLProviderRequest(provider, &req)
+	if req.SPCertificate != "" || req.SPPrivateKey != "" {
+		if req.SPCertificate == "" || req.SPPrivateKey == "" {
+			common.ApiErrorMsg(c, "轮换 SP 密钥需要同时提供证书和私钥")
+			return
+		}
+		provider.SPCertificate = req.SPCertificate
+		provider.SPPrivateKey = req.SPPrivateKey
+	}
+	if !checkSAMLProvider(c, provider) {
+		return
+	}
+	if err := model.UpdateSAMLProvider(provider); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+		"data":    toSAMLProviderResponse(provider),
+	})
+}
+
+func DeleteSAMLProvider(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的 ID")
+		return
+	}
+	provider, err := model.GetSAMLProviderById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "未找到该 SAML 身份提供商")
+		return
+	}
+	count, err := model.CountExternalIdentities(provider.IdentityProvider())
+	if err != nil {
+		common.SysError("Failed to get binding count for SAML provider " + provider.Slug + ": " + err.Error())
+		common.ApiErrorMsg(c, "检查用户绑定时发生错误，请稍后重试")
+		return
+	}
+	if count > 0 {
+		common.ApiErrorMsg(c, "该 SAML 身份提供商还有用户绑定，无法删除。请先停用或解除所有用户绑定。")
+		return
+	}
+	if err := model.DeleteSAMLProvider(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "删除成功",
+	})
+}
+
+// FetchSAMLIdPMetadata downloads and validates IdP metadata so the admin can
+// review it before saving.
+func FetchSAMLIdPMetadata(c *gin.Context) {
+	var req FetchSAMLMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的请求参数: "+err.Error())
+		return
+	}
+	targetURL := strings.TrimSpace(req.URL)
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil || parsedURL.Host == "" || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		common.ApiErrorMsg(c, "元数据 URL 无效，仅支持 http/https")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		common.ApiErrorMsg(c, "创建元数据请求失败: "+err.Error())
+		return
+	}
+	httpReq.Header.Set("Accept", "application/samlmetadata+xml, application/xml, text/xml")
+	client := &http.Client{Timeout: 20 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		common.ApiErrorMsg(c, "获取 IdP 元数据失败: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		common.ApiErrorMsg(c, "获取 IdP 元数据失败: "+resp.Status)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, samlMetadataMaxBytes))
+	if err != nil {
+		common.ApiErrorMsg(c, "获取 IdP 元数据失败: "+err.Error())
+		return
+	}
+	entity, err := oauth.ParseSAMLIdPMetadata(body)
+	if err != nil {
+		common.ApiErrorMsg(c, "解析 IdP 元数据失败: "+err.Error())
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"idp_metadata_url": targetURL,
+		"idp_metadata":     string(body),
+		"entity_id":        entity.EntityID,
+	})
+}
+
+// GetUserSAMLBindings returns the SAML identities bound to the current user.
+func GetUserSAMLBindings(c *gin.Context) {
+	claims, err := model.GetExternalIdentitiesByUserId(c.GetInt("id"), model.ExternalIdentityProviderSAMLPrefix)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	response := make([]UserSAMLBindingResponse, 0, len(claims))
+	for _, claim := range claims {
+		slug := strings.TrimPrefix(claim.Provider, model.ExternalIdentityProviderSAMLPrefix)
+		provider, err := model.GetSAMLProviderBySlug(slug)
+		if err != nil {
+			continue
+		}
+		response = append(response, UserSAMLBindingResponse{
+			ProviderName: provider.Name,
+			ProviderSlug: provider.Slug,
+			ProviderIcon: provider.Icon,
+			Subject:      claim.Subject,
+		})
+	}
+	common.ApiSuccess(c, response)
+}
+
+func UnbindSAML(c *gin.Context) {
+	slug := c.Param("slug")
+	if _, err := model.GetSAMLProviderBySlug(slug); err != nil {
+		common.ApiErrorMsg(c, "未找到该 SAML 身份提供商")
+		return
+	}
+	if err := model.ReleaseExternalIdentity(model.ExternalIdentityProviderSAMLPrefix+slug, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "解绑成功",
+	})
+}
@@ -0,0 +1,332 @@
+package controller
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/xml"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const samlTestSlug = "corp"
+
+// samlTestIdP is a minimal in-process IdP built on crewjam/saml.
+type samlTestIdP struct {
+	idp     *saml.IdentityProvider
+	session *saml.Session
+	config  *model.SAMLProvider
+}
+
+func (s *samlTestIdP) GetServiceProvider(*http.Request, string) (*saml.EntityDescriptor, error) {
+	sp, err := oauth.NewSAMLServiceProvider(s.config)
+	if err != nil {
+		return nil, err
+	}
+	return sp.Metadata(), nil
+}
+
+func (s *samlTestIdP) GetSession(http.ResponseWriter, *http.Request, *saml.IdpAuthnRequest) *saml.Session {
+	return s.session
+}
+
+func samlTestAttribute(name string, values ...string) saml.Attribute {
+	attribute := saml.Attribute{Name: name, NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"}
+	for _, value := range values {
+		attribute.Values = append(attribute.Values, saml.AttributeValue{Type: "xs:string", Value: value})
+	}
+	return attribute
+}
+
+func setupSAMLControllerTest(t *testing.T) *samlTestIdP {
+	t.Helper()
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(
+		&model.User{}, &model.UserSession{}, &model.AuthFlow{},
+		&model.ExternalIdentityClaim{}, &model.SAMLProvider{}, &model.Log{},
+	))
+	model.InitLogDB()
+	require.NoError(t, i18n.Init())
+	previousAddress := system_setting.ServerAddress
+	system_setting.ServerAddress = "http://sp.test"
+	t.Cleanup(func() { system_setting.ServerAddress = previousAddress })
+
+	idpCertPEM, idpKeyPEM, err := oauth.GenerateSAMLKeyPair("idp.test")
+	require.NoError(t, err)
+	certBlock, _ := pem.Decode([]byte(idpCertPEM))
+	idpCert, err := x509.ParseCertificate(certBlock.Bytes)
+	require.NoError(t, err)
+	keyBlock, _ := pem.Decode([]byte(idpKeyPEM))
+	idpKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	require.NoError(t, err)
+
+	stub := &samlTestIdP{
+		session: &saml.Session{
+			ID:           "idp-session",
+			NameID:       "alice@corp.test",
+			NameIDFormat: oauth.SAMLNameIDFormatEmail,
+			UserName:     "alice",
+			CustomAttributes: []saml.Attribute{
+				samlTestAttribute("email", "alice@corp.test"),
+				samlTestAttribute("displayName", "Alice"),
+				samlTestAttribute("groups", "staff", "engineering"),
+			},
+		},
+	}
+	metadataURL, _ := url.Parse("http://idp.test/metadata")
+	ssoURL, _ := url.Parse("http://idp.test/sso")
+	stub.idp = &saml.IdentityProvider{
+		Key:                     idpKey,
+		Certificate:             idpCert,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: stub,
+		SessionProvider:         stub,
+	}
+	idpMetadata, err := xml.Marshal(stub.idp.Metadata())
+	require.NoError(t, err)
+
+	spCertPEM, spKeyPEM, err := oauth.GenerateSAMLKeyPair("sp.test")
+	require.NoError(t, err)
+	stub.config = &model.SAMLProvider{
+		Name:          "Corp",
+		Slug:          samlTestSlug,
+		Enabled:       true,
+		IdPMetadata:   string(idpMetadata),
+		SPCertificate: spCertPEM,
+		SPPrivateKey:  spKeyPEM,
+		GroupMapping:  `[{"idp_group":"engineering","group":"vip"}]`,
+		AutoProvision: true,
+	}
+	require.NoError(t, model.CreateSAMLProvider(stub.config))
+	return stub
+}
+
+var samlFormInputPattern = regexp.MustCompile(`name="(SAMLResponse|RelayState)" value="([^"]*)"`)
+
+// runSAMLRoundTrip starts a flow, lets the stub IdP answer it and returns the
+// form the browser would POST to the ACS.
+func (s *samlTestIdP) runSAMLRoundTrip(t *testing.T, intent string, userId int) url.Values {
+	t.Helper()
+	c, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/saml/"+samlTestSlug+"/start", samlStartRequest{Intent: intent}, userId)
+	return s.answerSAMLStart(t, c, recorder)
+}
+
+func (s *samlTestIdP) runSAMLRoundTripWithSession(t *testing.T, userId int, sid string) url.Values {
+	t.Helper()
+	c, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/saml/"+samlTestSlug+"/start", samlStartRequest{Intent: model.AuthFlowIntentBind}, userId)
+	c.Set("session_id", sid)
+	c.Set("auth_version", int64(1))
+	c.Set("session_version", int64(1))
+	return s.answerSAMLStart(t, c, recorder)
+}
+
+func (s *samlTestIdP) answerSAMLStart(t *testing.T, c *gin.Context, recorder *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+	c.Params = gin.Params{{Key: "slug", Value: samlTestSlug}}
+	StartSAML(c)
+	response := decodeAPIResponse(t, recorder)
+	require.True(t, response.Success, response.Message)
+	var data struct {
+		RedirectURL string `json:"redirect_url"`
+		FlowToken   string `json:"flow_token"`
+	}
+	require.NoError(t, common.Unmarshal(response.Data, &data))
+	require.True(t, strings.HasPrefix(data.RedirectURL, "http://idp.test/sso?"))
+
+	idpRecorder := httptest.NewRecorder()
+	s.idp.ServeSSO(idpRecorder, httptest.NewRequest(http.MethodGet, data.RedirectURL, nil))
+	require.Equal(t, http.StatusOK, idpRecorder.Code, idpRecorder.Body.String())
+
+	form := url.Values{}
+	for _, match := range samlFormInputPattern.FindAllStringSubmatch(idpRecorder.Body.String(), -1) {
+		form.Set(match[1], html.UnescapeString(match[2]))
+	}
+	require.NotEmpty(t, form.Get("SAMLResponse"))
+	require.Equal(t, data.FlowToken, form.Get("RelayState"))
+	return form
+}
+
+func postSAMLAssertion(t *testing.T, form url.Values) url.Values {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "http://sp.test/api/saml/"+samlTestSlug+"/acs", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c.Params = gin.Params{{Key: "slug", Value: samlTestSlug}}
+	SAMLAssertionConsumer(c)
+	c.Writer.WriteHeaderNow()
+	require.Equal(t, http.StatusSeeOther, recorder.Code)
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "/oauth/saml", location.Path)
+	return location.Query()
+}
+
+func TestSAMLLoginAutoProvisionsMappedUser(t *testing.T) {
+	stub := setupSAMLControllerTest(t)
+
+	form := stub.runSAMLRoundTrip(t, model.AuthFlowIntentLogin, 0)
+	result := postSAMLAssertion(t, form)
+	require.Equal(t, "success", result.Get("status"), result.Get("error_code"))
+	require.NotEmpty(t, result.Get("flow_token"))
+
+	userId, err := model.GetExternalIdentityOwner(stub.config.IdentityProvider(), "alice@corp.test")
+	require.NoError(t, err)
+	user, err := model.GetUserById(userId, false)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "Alice", user.DisplayName)
+	assert.Equal(t, "alice@corp.test", user.Email)
+	assert.Equal(t, "vip", user.Group)
+
+	c, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/saml/login", samlLoginRequest{FlowToken: result.Get("flow_token")}, 0)
+	SAMLLogin(c)
+	assert.True(t, decodeAPIResponse(t, recorder).Success)
+
+	// 登录令牌只能兑换一次
+	c, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/saml/login", samlLoginRequest{FlowToken: result.Get("flow_token")}, 0)
+	SAMLLogin(c)
+	assert.False(t, decodeAPIResponse(t, recorder).Success)
+
+	// 同一响应不能被重放
+	replay := postSAMLAssertion(t, form)
+	assert.Equal(t, "error", replay.Get("status"))
+	assert.Equal(t, samlErrorFlowInvalid, replay.Get("error_code"))
+}
+
+func TestSAMLLoginSyncsGroupOfBoundUser(t *testing.T) {
+	stub := setupSAMLControllerTest(t)
+	result := postSAMLAssertion(t, stub.runSAMLRoundTrip(t, model.AuthFlowIntentLogin, 0))
+	require.Equal(t, "success", result.Get("status"), result.Get("error_code"))
+
+	stub.session.CustomAttributes[2] = samlTestAttribute("groups", "staff")
+	stub.config.GroupMapping = `[{"idp_group":"engineering","group":"vip"},{"idp_group":"staff","group":"svip"}]`
+	require.NoError(t, model.UpdateSAMLProvider(stub.config))
+
+	result = postSAMLAssertion(t, stub.runSAMLRoundTrip(t, model.AuthFlowIntentLogin, 0))
+	require.Equal(t, "success", result.Get("status"), result.Get("error_code"))
+	userId, err := model.GetExternalIdentityOwner(stub.config.IdentityProvider(), "alice@corp.test")
+	require.NoError(t, err)
+	user, err := model.GetUserById(userId, false)
+	require.NoError(t, err)
+	assert.Equal(t, "svip", user.Group)
+}
+
+func TestSAMLAssertionRejectsTamperedResponse(t *testing.T) {
+	stub := setupSAMLControllerTest(t)
+	form := stub.runSAMLRoundTrip(t, model.AuthFlowIntentLogin, 0)
+
+	// 换用另一把密钥签名的 IdP，签名校验必须失败
+	otherCertPEM, otherKeyPEM, err := oauth.GenerateSAMLKeyPair("evil.test")
+	require.NoError(t, err)
+	certBlock, _ := pem.Decode([]byte(otherCertPEM))
+	otherCert, err := x509.ParseCertificate(certBlock.Bytes)
+	require.NoError(t, err)
+	keyBlock, _ := pem.Decode([]byte(otherKeyPEM))
+	var otherKey *rsa.PrivateKey
+	otherKey, err = x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	require.NoError(t, err)
+	genuineKey, genuineCert := stub.idp.Key, stub.idp.Certificate
+	stub.idp.Key, stub.idp.Certificate = otherKey, otherCert
+	forged := stub.runSAMLRoundTrip(t, model.AuthFlowIntentLogin, 0)
+	stub.idp.Key, stub.idp.Certificate = genuineKey, genuineCert
+
+	result := postSAMLAssertion(t, forged)
+	assert.Equal(t, "error", result.Get("status"))
+	assert.Equal(t, samlErrorAssertionInvalid, result.Get("error_code"))
+
+	// 响应与流程不匹配（RelayState 指向另一个请求）同样被拒绝
+	mismatched := url.Values{"SAMLResponse": {form.Get("SAMLResponse")}, "RelayState": {forged.Get("RelayState")}}
+	result = postSAMLAssertion(t, mismatched)
+	assert.Equal(t, "error", result.Get("status"))
+	assert.Equal(t, samlErrorAssertionInvalid, result.Get("error_code"))
+
+	var count int64
+	require.NoError(t, model.DB.Model(&model.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestSAMLLoginPolicies(t *testing.T) {
+	stub := setupSAMLControllerTest(t)
+
+	stub.config.AutoProvision = false
+	require.NoError(t, model.UpdateSAMLProvider(stub.config))
+	result := postSAMLAssertion(t, stub.runSAMLRoundTrip(t, model.AuthFlowIntentLogin, 0))
+	assert.Equal(t, samlErrorNotProvisioned, result.Get("error_code"))
+
+	stub.config.AutoProvision = true
+	stub.config.RequireGroupMatch = true
+	require.NoError(t, model.UpdateSAMLProvider(stub.config))
+	stub.session.CustomAttributes[2] = samlTestAttribute("groups", "contractors")
+	result = postSAMLAssertion(t, stub.runSAMLRoundTrip(t, model.AuthFlowIntentLogin, 0))
+	assert.Equal(t, samlErrorAccessDenied, result.Get("error_code"))
+
+	stub.session.NameIDFormat = oauth.SAMLNameIDFormatTransient
+	stub.session.CustomAttributes[2] = samlTestAttribute("groups", "engineering")
+	result = postSAMLAssertion(t, stub.runSAMLRoundTrip(t, model.AuthFlowIntentLogin, 0))
+	assert.Equal(t, samlErrorAssertionInvalid, result.Get("error_code"))
+
+	var count int64
+	require.NoError(t, model.DB.Model(&model.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestSAMLBindClaimsIdentityForSessionUser(t *testing.T) {
+	stub := setupSAMLControllerTest(t)
+	user := &model.User{
+		Username: "saml-bind-user", Password: "unused", Role: common.RoleCommonUser,
+		Status: common.UserStatusEnabled, Group: "default", AuthVersion: 1,
+	}
+	require.NoError(t, model.DB.Create(user).Error)
+	login, err := service.CreateLoginSession(user.Id, "password", "127.0.0.1", "agent")
+	require.NoError(t, err)
+
+	c, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/saml/"+samlTestSlug+"/start", samlStartRequest{Intent: model.AuthFlowIntentBind}, user.Id)
+	c.Params = gin.Params{{Key: "slug", Value: samlTestSlug}}
+	StartSAML(c)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	form := stub.runSAMLRoundTripWithSession(t, user.Id, login.Session.SID)
+	result := postSAMLAssertion(t, form)
+	require.Equal(t, "success", result.Get("status"), result.Get("error_code"))
+	assert.Equal(t, model.AuthFlowIntentBind, result.Get("intent"))
+
+	owner, err := model.GetExternalIdentityOwner(stub.config.IdentityProvider(), "alice@corp.test")
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, owner)
+
+	// 已被绑定的 IdP 身份不能再绑定到其他账号
+	other := &model.User{
+		Username: "saml-bind-other", Password: "unused", Role: common.RoleCommonUser,
+		Status: common.UserStatusEnabled, Group: "default", AuthVersion: 1, AffCode: "saml-other",
+	}
+	require.NoError(t, model.DB.Create(other).Error)
+	otherLogin, err := service.CreateLoginSession(other.Id, "password", "127.0.0.1", "agent")
+	require.NoError(t, err)
+	result = postSAMLAssertion(t, stub.runSAMLRoundTripWithSession(t, other.Id, otherLogin.Session.SID))
+	assert.Equal(t, samlErrorAlreadyBound, result.Get("error_code"))
+
+	// 发起绑定的会话被吊销后回调失效
+	_, err = model.RevokeAllUserSessions(user.Id, "test")
+	require.NoError(t, err)
+	require.NoError(t, model.ReleaseExternalIdentity(stub.config.IdentityProvider(), user.Id))
+	result = postSAMLAssertion(t, stub.runSAMLRoundTripWithSession(t, user.Id, login.Session.SID))
+	assert.Equal(t, samlErrorSessionInvalid, result.Get("error_code"))
+}
@@ -0,0 +1,912 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SCIM 2.0 (RFC 7643 / RFC 7644) provisioning for users and groups.
+//
+// Users are the local accounts created through SCIM (see model.SCIMUser); the
+// SCIM id is the local user id. Groups are the user groups defined by the
+// group ratio settings; the SCIM id and displayName are the group name. A user
+// belongs to exactly one group, so adding it to a group moves it out of its
+// previous one.
+
+const (
+	scimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema         = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimServiceConfigURN   = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimResourceTypeSchema = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	scimDefaultCount     = 100
+	scimMaxCount         = 200
+	scimGroupMemberLimit = 10000
+)
+
+// scimFilterPattern matches the single `attribute eq "value"` filters sent by
+// IdPs when looking up a resource.
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9.]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+var errSCIMInvalidFilter = errors.New("unsupported filter, only `attribute eq \"value\"` is supported")
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location"`
+}
+
+type scimUserResource struct {
+	Schemas     []string         `json:"schemas"`
+	Id          string           `json:"id"`
+	ExternalId  string           `json:"externalId,omitempty"`
+	UserName    string           `json:"userName"`
+	Name        *scimName        `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Active      bool             `json:"active"`
+	Emails      []scimMultiValue `json:"emails,omitempty"`
+	Groups      []scimMultiValue `json:"groups,omitempty"`
+	Meta        scimMeta         `json:"meta"`
+}
+
+type scimGroupResource struct {
+	Schemas     []string          `json:"schemas"`
+	Id          string            `json:"id"`
+	DisplayName string            `json:"displayName"`
+	Members     *[]scimMultiValue `json:"members,omitempty"`
+	Meta        scimMeta          `json:"meta"`
+}
+
+type scimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type scimUserRequest struct {
+	UserName    string           `json:"userName"`
+	ExternalId  string           `json:"externalId"`
+	DisplayName string           `json:"displayName"`
+	Name        *scimName        `json:"name"`
+	Active      *bool            `json:"active"`
+	Emails      []scimMultiValue `json:"emails"`
+}
+
+type scimGroupRequest struct {
+	DisplayName string           `json:"displayName"`
+	Members     []scimMultiValue `json:"members"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+func scimJSON(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+func scimError(c *gin.Context, status int, scimType string, detail string) {
+	body := gin.H{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+func scimInternalError(c *gin.Context, err error) {
+	common.SysError("SCIM request failed: " + err.Error())
+	scimError(c, http.StatusInternalServerError, "", "internal server error")
+}
+
+func scimLocation(resource string, id string) string {
+	location := strings.TrimRight(system_setting.ServerAddress, "/") + "/scim/v2/" + resource
+	if id != "" {
+		location += "/" + id
+	}
+	return location
+}
+
+func scimTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseSCIMFilter returns the attribute (lower case) and value of a filter.
+func parseSCIMFilter(filter string) (string, string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", errSCIMInvalidFilter
+	}
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return "", "", errSCIMInvalidFilter
+	}
+	return strings.ToLower(match[1]), value, nil
+}
+
+// parseSCIMPagination reads the 1-based startIndex and count parameters.
+func parseSCIMPagination(c *gin.Context) (int, int) {
+	startIndex, err := strconv.Atoi(c.Query("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count < 0 {
+		count = scimDefaultCount
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+func scimExcludesMembers(c *gin.Context) bool {
+	for _, attribute := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateSCIMToken replaces the SCIM bearer token. Only its hash is stored,
+// the token is returned once; the previous token stops working immediately.
+func GenerateSCIMToken(c *gin.Context) {
+	key, err := common.GenerateRandomCharsKey(48)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	token := "scim-" + key
+	if err := model.UpdateOption("scim.token_hash", system_setting.HashSCIMToken(token)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	recordManageAudit(c, "option.scim_token", nil)
+	common.ApiSuccess(c, gin.H{"token": token})
+}
+
+// ---------------------------------------------------------------------------
+// Discovery
+// ---------------------------------------------------------------------------
+
+func SCIMServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimServiceConfigURN},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with the SCIM bearer token generated in the system settings",
+			"primary":     true,
+		}},
+		"meta": gin.H{"resourceType": "ServiceProviderConfig", "location": scimLocation("ServiceProviderConfig", "")},
+	})
+}
+
+func SCIMResourceTypes(c *gin.Context) {
+	resources := []any{
+		gin.H{"schemas": []string{scimResourceTypeSchema}, "id": "User", "name": "User", "endpoint": "/Users", "schema": scimUserSchema,
+			"meta": gin.H{"resourceType": "ResourceType", "location": scimLocation("ResourceTypes", "User")}},
+		gin.H{"schemas": []string{scimResourceTypeSchema}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": scimGroupSchema,
+			"meta": gin.H{"resourceType": "ResourceType", "location": scimLocation("ResourceTypes", "Group")}},
+	}
+	scimJSON(c, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Users
+// ---------------------------------------------------------------------------
+
+func buildSCIMUserResource(user *model.User, scimUser *model.SCIMUser) scimUserResource {
+	id := strconv.Itoa(user.Id)
+	resource := scimUserResource{
+		Schemas:     []string{scimUserSchema},
+		Id:          id,
+		ExternalId:  scimUser.ExternalId,
+		UserName:    scimUser.UserName,
+		DisplayName: user.DisplayName,
+		Active:      user.Status == common.UserStatusEnabled,
+		Meta: scimMeta{
+			ResourceType: "User",
+			Created:      scimTime(scimUser.CreatedAt),
+			LastModified: scimTime(scimUser.UpdatedAt),
+			Location:     scimLocation("Users", id),
+		},
+	}
+	if user.DisplayName != "" {
+		resource.Name = &scimName{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		resource.Emails = []scimMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	if user.Group != "" {
+		resource.Groups = []scimMultiValue{{Value: user.Group, Display: user.Group, Ref: scimLocation("Groups", user.Group)}}
+	}
+	return resource
+}
+
+func scimUserEmail(emails []scimMultiValue) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	for _, email := range emails {
+		if strings.EqualFold(email.Type, "work") {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+func (request *scimUserRequest) attributes() service.SCIMUserAttributes {
+	attrs := service.SCIMUserAttributes{
+		UserName:    request.UserName,
+		ExternalId:  request.ExternalId,
+		DisplayName: request.DisplayName,
+		Email:       scimUserEmail(request.Emails),
+		Active:      request.Active == nil || *request.Active,
+	}
+	if strings.TrimSpace(attrs.DisplayName) == "" && request.Name != nil {
+		attrs.DisplayName = request.Name.Formatted
+		if strings.TrimSpace(attrs.DisplayName) == "" {
+			attrs.DisplayName = strings.TrimSpace(request.Name.GivenName + " " + request.Name.FamilyName)
+		}
+	}
+	return attrs
+}
+
+// loadSCIMUser resolves the :id of a SCIM user; users not provisioned through
+// SCIM are reported as missing.
+func loadSCIMUser(c *gin.Context) (*model.User, *model.SCIMUser, bool) {
+	userId, _ := strconv.Atoi(c.Param("id"))
+	user, scimUser, err := getSCIMUserById(userId)
+	if err != nil {
+		scimInternalError(c, err)
+		return nil, nil, false
+	}
+	if user == nil {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return nil, nil, false
+	}
+	return user, scimUser, true
+}
+
+// respondSCIMUserWriteError maps provisioning errors to SCIM errors.
+func respondSCIMUserWriteError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrSCIMInvalidUserName):
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required and must not exceed 255 characters")
+	case errors.Is(err, model.ErrSCIMUserNameTaken):
+		scimError(c, http.StatusConflict, "uniqueness", "userName is already in use")
+	case errors.Is(err, model.ErrEmailAlreadyTaken):
+		scimError(c, http.StatusConflict, "uniqueness", "email is already in use by another account")
+	default:
+		scimInternalError(c, err)
+	}
+}
+
+func GetSCIMUsers(c *gin.Context) {
+	attribute, value, err := parseSCIMFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	startIndex, count := parseSCIMPagination(c)
+	query := model.SCIMUserQuery{}
+	switch attribute {
+	case "":
+	case "username":
+		query.UserName = value
+	case "externalid":
+		query.ExternalId = value
+	case "id":
+		userId, _ := strconv.Atoi(value)
+		user, scimUser, err := getSCIMUserById(userId)
+		if err != nil {
+			scimInternalError(c, err)
+			return
+		}
+		resources := []any{}
+		if user != nil {
+			resources = append(resources, buildSCIMUserResource(user, scimUser))
+		}
+		scimJSON(c, http.StatusOK, scimListResponse{Schemas: []string{scimListSchema}, TotalResults: len(resources), StartIndex: 1, ItemsPerPage: len(resources), Resources: resources})
+		return
+	default:
+		scimError(c, http.StatusBadRequest, "invalidFilter", "unsupported filter attribute "+attribute)
+		return
+	}
+
+	scimUsers, total, err := model.ListSCIMUsers(query, startIndex-1, count)
+	if err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	resources := make([]any, 0, len(scimUsers))
+	for _, scimUser := range scimUsers {
+		user, err := model.GetUserById(scimUser.UserId, false)
+		if err != nil {
+			scimInternalError(c, err)
+			return
+		}
+		resources = append(resources, buildSCIMUserResource(user, scimUser))
+	}
+	scimJSON(c, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: int(total),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// getSCIMUserById returns nil without error when the user is not a live SCIM user.
+func getSCIMUserById(userId int) (*model.User, *model.SCIMUser, error) {
+	if userId <= 0 {
+		return nil, nil, nil
+	}
+	scimUser, err := model.GetSCIMUser(userId)
+	if err == nil {
+		var user *model.User
+		if user, err = model.GetUserById(userId, false); err == nil {
+			return user, scimUser, nil
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	return nil, nil, err
+}
+
+func GetSCIMUser(c *gin.Context) {
+	user, scimUser, ok := loadSCIMUser(c)
+	if !ok {
+		return
+	}
+	scimJSON(c, http.StatusOK, buildSCIMUserResource(user, scimUser))
+}
+
+func CreateSCIMUser(c *gin.Context) {
+	var request scimUserRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	user, scimUser, err := service.ProvisionSCIMUser(request.attributes())
+	if err != nil {
+		respondSCIMUserWriteError(c, err)
+		return
+	}
+	user, err = model.GetUserById(user.Id, false)
+	if err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	recordUserSecurityAudit(c, user.Id, "scim.user_provision", map[string]interface{}{
+		"username":  user.Username,
+		"user_name": scimUser.UserName,
+	})
+	resource := buildSCIMUserResource(user, scimUser)
+	c.Header("Location", resource.Meta.Location)
+	scimJSON(c, http.StatusCreated, resource)
+}
+
+func ReplaceSCIMUser(c *gin.Context) {
+	user, _, ok := loadSCIMUser(c)
+	if !ok {
+		return
+	}
+	var request scimUserRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	writeSCIMUserUpdate(c, user, request.attributes())
+}
+
+func PatchSCIMUser(c *gin.Context) {
+	user, scimUser, ok := loadSCIMUser(c)
+	if !ok {
+		return
+	}
+	var request scimPatchRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil || len(request.Operations) == 0 {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid PatchOp request")
+		return
+	}
+	attrs := service.SCIMUserAttributes{
+		UserName:    scimUser.UserName,
+		ExternalId:  scimUser.ExternalId,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Active:      user.Status == common.UserStatusEnabled,
+	}
+	for _, operation := range request.Operations {
+		if err := applySCIMUserPatch(&attrs, operation); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	writeSCIMUserUpdate(c, user, attrs)
+}
+
+func writeSCIMUserUpdate(c *gin.Context, user *model.User, attrs service.SCIMUserAttributes) {
+	wasActive := user.Status == common.UserStatusEnabled
+	if err := service.UpdateSCIMUser(user.Id, attrs); err != nil {
+		respondSCIMUserWriteError(c, err)
+		return
+	}
+	if wasActive && !attrs.Active {
+		recordUserSecurityAudit(c, user.Id, "scim.user_deprovision", map[string]interface{}{
+			"username": user.Username,
+		})
+	}
+	user, scimUser, ok := loadSCIMUser(c)
+	if !ok {
+		return
+	}
+	scimJSON(c, http.StatusOK, buildSCIMUserResource(user, scimUser))
+}
+
+// applySCIMUserPatch applies one PatchOp operation. Attributes this service
+// does not store (name parts, enterprise extension, ...) are ignored so IdPs
+// can send their full attribute mapping.
+func applySCIMUserPatch(attrs *service.SCIMUserAttributes, operation scimPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return errors.New("unsupported patch op " + operation.Op)
+	}
+	if operation.Path == "" {
+		if op == "remove" {
+			return errors.New("remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := common.Unmarshal(operation.Value, &values); err != nil {
+			return errors.New("patch value must be an object when path is omitted")
+		}
+		for path, value := range values {
+			if err := setSCIMUserAttribute(attrs, path, value, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setSCIMUserAttribute(attrs, operation.Path, operation.Value, op == "remove")
+}
+
+func setSCIMUserAttribute(attrs *service.SCIMUserAttributes, path string, value json.RawMessage, remove bool) error {
+	path = strings.ToLower(strings.TrimSpace(path))
+	path = strings.TrimPrefix(path, strings.ToLower(scimUserSchema)+":")
+	switch {
+	case path == "active":
+		if remove {
+			return errors.New("active cannot be removed")
+		}
+		active, err := decodeSCIMBool(value)
+		if err != nil {
+			return err
+		}
+		attrs.Active = active
+	case path == "username":
+		if remove {
+			return errors.New("userName cannot be removed")
+		}
+		return decodeSCIMString(value, &attrs.UserName)
+	case path == "externalid":
+		if remove {
+			attrs.ExternalId = ""
+			return nil
+		}
+		return decodeSCIMString(value, &attrs.ExternalId)
+	case path == "displayname", path == "name.formatted":
+		if remove {
+			attrs.DisplayName = ""
+			return nil
+		}
+		return decodeSCIMString(value, &attrs.DisplayName)
+	case path == "emails":
+		if remove {
+			attrs.Email = ""
+			return nil
+		}
+		var emails []scimMultiValue
+		if err := common.Unmarshal(value, &emails); err != nil {
+			return errors.New("emails must be an array")
+		}
+		attrs.Email = scimUserEmail(emails)
+	case strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value"), path == "emails.value":
+		if remove {
+			attrs.Email = ""
+			return nil
+		}
+		return decodeSCIMString(value, &attrs.Email)
+	}
+	return nil
+}
+
+func decodeSCIMString(value json.RawMessage, target *string) error {
+	if err := common.Unmarshal(value, target); err != nil {
+		return errors.New("expected a string value")
+	}
+	return nil
+}
+
+// decodeSCIMBool accepts JSON booleans as well as "True"/"False" strings,
+// which Microsoft Entra sends for active.
+func decodeSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := common.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := common.Unmarshal(value, &s); err == nil {
+		if parsed, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, errors.New("active must be a boolean")
+}
+
+func DeleteSCIMUser(c *gin.Context) {
+	user, _, ok := loadSCIMUser(c)
+	if !ok {
+		return
+	}
+	if err := service.DeleteSCIMUser(user.Id); err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	recordUserSecurityAudit(c, user.Id, "scim.user_delete", map[string]interface{}{
+		"username": user.Username,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// ---------------------------------------------------------------------------
+// Groups
+// ---------------------------------------------------------------------------
+
+func buildSCIMGroupResource(group string, withMembers bool) (scimGroupResource, error) {
+	resource := scimGroupResource{
+		Schemas:     []string{scimGroupSchema},
+		Id:          group,
+		DisplayName: group,
+		Meta:        scimMeta{ResourceType: "Group", Location: scimLocation("Groups", group)},
+	}
+	if !withMembers {
+		return resource, nil
+	}
+	scimUsers, _, err := model.ListSCIMUsers(model.SCIMUserQuery{Group: group}, 0, scimGroupMemberLimit)
+	if err != nil {
+		return resource, err
+	}
+	members := make([]scimMultiValue, 0, len(scimUsers))
+	for _, scimUser := range scimUsers {
+		id := strconv.Itoa(scimUser.UserId)
+		members = append(members, scimMultiValue{Value: id, Display: scimUser.UserName, Ref: scimLocation("Users", id)})
+	}
+	resource.Members = &members
+	return resource, nil
+}
+
+func loadSCIMGroup(c *gin.Context) (string, bool) {
+	group := c.Param("id")
+	if !ratio_setting.ContainsGroupRatio(group) {
+		scimError(c, http.StatusNotFound, "", "group not found")
+		return "", false
+	}
+	return group, true
+}
+
+func respondSCIMGroup(c *gin.Context, status int, group string) {
+	resource, err := buildSCIMGroupResource(group, !scimExcludesMembers(c))
+	if err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	if status == http.StatusCreated {
+		c.Header("Location", resource.Meta.Location)
+	}
+	scimJSON(c, status, resource)
+}
+
+func GetSCIMGroups(c *gin.Context) {
+	attribute, value, err := parseSCIMFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	var groups []string
+	switch attribute {
+	case "":
+		groups = service.SCIMGroupNames()
+	case "displayname", "id":
+		if ratio_setting.ContainsGroupRatio(value) {
+			groups = []string{value}
+		}
+	default:
+		scimError(c, http.StatusBadRequest, "invalidFilter", "unsupported filter attribute "+attribute)
+		return
+	}
+	startIndex, count := parseSCIMPagination(c)
+	withMembers := !scimExcludesMembers(c)
+	resources := []any{}
+	for i := startIndex - 1; i < len(groups) && len(resources) < count; i++ {
+		resource, err := buildSCIMGroupResource(groups[i], withMembers)
+		if err != nil {
+			scimInternalError(c, err)
+			return
+		}
+		resources = append(resources, resource)
+	}
+	scimJSON(c, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(groups),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func GetSCIMGroup(c *gin.Context) {
+	group, ok := loadSCIMGroup(c)
+	if !ok {
+		return
+	}
+	respondSCIMGroup(c, http.StatusOK, group)
+}
+
+// CreateSCIMGroup links an IdP group to an existing user group: groups are
+// defined by the group ratio settings and cannot be created over SCIM.
+func CreateSCIMGroup(c *gin.Context) {
+	var request scimGroupRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	group := strings.TrimSpace(request.DisplayName)
+	if !ratio_setting.ContainsGroupRatio(group) {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName must name an existing user group")
+		return
+	}
+	if request.Members != nil && !applySCIMGroupMembers(c, group, "add", request.Members) {
+		return
+	}
+	respondSCIMGroup(c, http.StatusCreated, group)
+}
+
+func ReplaceSCIMGroup(c *gin.Context) {
+	group, ok := loadSCIMGroup(c)
+	if !ok {
+		return
+	}
+	var request scimGroupRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	if request.DisplayName != "" && request.DisplayName != group {
+		scimError(c, http.StatusBadRequest, "mutability", "groups cannot be renamed")
+		return
+	}
+	if !applySCIMGroupMembers(c, group, "replace", request.Members) {
+		return
+	}
+	respondSCIMGroup(c, http.StatusOK, group)
+}
+
+func PatchSCIMGroup(c *gin.Context) {
+	group, ok := loadSCIMGroup(c)
+	if !ok {
+		return
+	}
+	var request scimPatchRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil || len(request.Operations) == 0 {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid PatchOp request")
+		return
+	}
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		path := strings.ToLower(strings.TrimSpace(operation.Path))
+		switch {
+		case path == "" && op != "remove":
+			var value struct {
+				DisplayName *string          `json:"displayName"`
+				Members     []scimMultiValue `json:"members"`
+			}
+			if err := common.Unmarshal(operation.Value, &value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", "patch value must be an object when path is omitted")
+				return
+			}
+			if value.DisplayName != nil && *value.DisplayName != group {
+				scimError(c, http.StatusBadRequest, "mutability", "groups cannot be renamed")
+				return
+			}
+			if value.Members != nil && !applySCIMGroupMembers(c, group, op, value.Members) {
+				return
+			}
+		case path == "displayname":
+			var displayName string
+			if err := common.Unmarshal(operation.Value, &displayName); err != nil || displayName != group {
+				scimError(c, http.StatusBadRequest, "mutability", "groups cannot be renamed")
+				return
+			}
+		case path == "members":
+			var members []scimMultiValue
+			if len(operation.Value) > 0 {
+				if err := common.Unmarshal(operation.Value, &members); err != nil {
+					scimError(c, http.StatusBadRequest, "invalidValue", "members must be an array")
+					return
+				}
+			}
+			if op == "remove" && len(members) == 0 {
+				// 不带 value 的 remove 表示清空全部成员
+				op = "replace"
+			}
+			if !applySCIMGroupMembers(c, group, op, members) {
+				return
+			}
+		case op == "remove" && strings.HasPrefix(path, "members["):
+			inner := strings.TrimSuffix(strings.TrimSpace(operation.Path)[len("members["):], "]")
+			attribute, value, err := parseSCIMFilter(inner)
+			if err != nil || attribute != "value" {
+				scimError(c, http.StatusBadRequest, "invalidPath", "unsupported members filter")
+				return
+			}
+			if !applySCIMGroupMembers(c, group, "remove", []scimMultiValue{{Value: value}}) {
+				return
+			}
+		default:
+			scimError(c, http.StatusBadRequest, "invalidPath", "unsupported patch path "+operation.Path)
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// applySCIMGroupMembers adds, removes or replaces the members of group. Only
+// SCIM users can be members; referencing any other user is rejected before
+// anything is changed.
+func applySCIMGroupMembers(c *gin.Context, group string, op string, members []scimMultiValue) bool {
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userId, err := strconv.Atoi(member.Value)
+		if err != nil || userId <= 0 {
+			scimError(c, http.StatusBadRequest, "invalidValue", "member "+member.Value+" not found")
+			return false
+		}
+		userIds = append(userIds, userId)
+	}
+	known, err := model.GetSCIMUsersByUserIds(userIds)
+	if err != nil {
+		scimInternalError(c, err)
+		return false
+	}
+	for _, userId := range userIds {
+		if known[userId] == nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", "member "+strconv.Itoa(userId)+" not found")
+			return false
+		}
+	}
+
+	switch op {
+	case "add":
+		for _, userId := range userIds {
+			if err := service.SetSCIMUserGroup(userId, group); err != nil {
+				scimInternalError(c, err)
+				return false
+			}
+		}
+	case "remove":
+		for _, userId := range userIds {
+			if err := service.RemoveSCIMUserFromGroup(userId, group); err != nil {
+				scimInternalError(c, err)
+				return false
+			}
+		}
+	case "replace":
+		current, _, err := model.ListSCIMUsers(model.SCIMUserQuery{Group: group}, 0, scimGroupMemberLimit)
+		if err != nil {
+			scimInternalError(c, err)
+			return false
+		}
+		keep := make(map[int]bool, len(userIds))
+		for _, userId := range userIds {
+			keep[userId] = true
+		}
+		for _, scimUser := range current {
+			if keep[scimUser.UserId] {
+				continue
+			}
+			if err := service.RemoveSCIMUserFromGroup(scimUser.UserId, group); err != nil {
+				scimInternalError(c, err)
+				return false
+			}
+		}
+		for _, userId := range userIds {
+			if err := service.SetSCIMUserGroup(userId, group); err != nil {
+				scimInternalError(c, err)
+				return false
+			}
+		}
+	default:
+		scimError(c, http.StatusBadRequest, "invalidValue", "unsupported patch op "+op)
+		return false
+	}
+	return true
+}
+
+// DeleteSCIMGroup is not supported: user groups belong to the group ratio
+// settings, not to the IdP.
+func DeleteSCIMGroup(c *gin.Context) {
+	if _, ok := loadSCIMGroup(c); !ok {
+		return
+	}
+	scimError(c, http.StatusNotImplemented, "", "user groups are managed in the system settings and cannot be deleted over SCIM")
+}
@@ -0,0 +1,295 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const scimTestToken = "scim-test-token"
+
+func setupSCIMControllerTest(t *testing.T) *gin.Engine {
+	t.Helper()
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(
+		&model.User{}, &model.UserSession{}, &model.Token{}, &model.SCIMUser{},
+		&model.Option{}, &model.Log{},
+	))
+	model.InitLogDB()
+	previousAddress := system_setting.ServerAddress
+	system_setting.ServerAddress = "http://sp.test"
+	settings := system_setting.GetSCIMSettings()
+	previousSettings := *settings
+	settings.Enabled = true
+	settings.TokenHash = system_setting.HashSCIMToken(scimTestToken)
+	t.Cleanup(func() {
+		system_setting.ServerAddress = previousAddress
+		*settings = previousSettings
+	})
+
+	engine := gin.New()
+	scimRouter := engine.Group("/scim/v2", middleware.SCIMAuth())
+	scimRouter.GET("/Users", GetSCIMUsers)
+	scimRouter.POST("/Users", CreateSCIMUser)
+	scimRouter.GET("/Users/:id", GetSCIMUser)
+	scimRouter.PUT("/Users/:id", ReplaceSCIMUser)
+	scimRouter.PATCH("/Users/:id", PatchSCIMUser)
+	scimRouter.DELETE("/Users/:id", DeleteSCIMUser)
+	scimRouter.GET("/Groups", GetSCIMGroups)
+	scimRouter.GET("/Groups/:id", GetSCIMGroup)
+	scimRouter.PUT("/Groups/:id", ReplaceSCIMGroup)
+	scimRouter.PATCH("/Groups/:id", PatchSCIMGroup)
+	return engine
+}
+
+func scimRequest(t *testing.T, engine *gin.Engine, method string, target string, body any) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Authorization", "Bearer "+scimTestToken)
+	req.Header.Set("Content-Type", "application/scim+json")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	var decoded map[string]any
+	if recorder.Body.Len() > 0 {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &decoded), recorder.Body.String())
+	}
+	return recorder, decoded
+}
+
+func createSCIMTestUser(t *testing.T, engine *gin.Engine, userName string) int {
+	t.Helper()
+	recorder, body := scimRequest(t, engine, http.MethodPost, "/scim/v2/Users", map[string]any{
+		"schemas":    []string{scimUserSchema},
+		"userName":   userName,
+		"externalId": "ext-" + userName,
+		"name":       map[string]any{"givenName": "Test", "familyName": userName},
+		"emails":     []map[string]any{{"value": userName + "@corp.test", "type": "work", "primary": true}},
+		"active":     true,
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	userId, err := strconv.Atoi(body["id"].(string))
+	require.NoError(t, err)
+	return userId
+}
+
+func TestSCIMRequiresBearerToken(t *testing.T) {
+	engine := setupSCIMControllerTest(t)
+
+	for _, authorization := range []string{"", "Bearer wrong-token", "Basic " + scimTestToken} {
+		req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, authorization)
+		assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "Bearer")
+	}
+
+	system_setting.GetSCIMSettings().Enabled = false
+	recorder, _ := scimRequest(t, engine, http.MethodGet, "/scim/v2/Users", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestGenerateSCIMTokenStoresOnlyHash(t *testing.T) {
+	setupSCIMControllerTest(t)
+	previousMap := common.OptionMap
+	common.OptionMap = map[string]string{}
+	t.Cleanup(func() { common.OptionMap = previousMap })
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/option/scim/token", nil, 1)
+	GenerateSCIMToken(ctx)
+	response := decodeAPIResponse(t, recorder)
+	require.True(t, response.Success, response.Message)
+	var data struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(response.Data, &data))
+
+	settings := system_setting.GetSCIMSettings()
+	assert.True(t, settings.VerifyToken(data.Token))
+	assert.False(t, settings.VerifyToken(scimTestToken), "the previous token stops working")
+	assert.NotContains(t, settings.TokenHash, data.Token)
+}
+
+func TestSCIMUserLifecycle(t *testing.T) {
+	engine := setupSCIMControllerTest(t)
+	userId := createSCIMTestUser(t, engine, "alice")
+
+	user, err := model.GetUserById(userId, false)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "alice@corp.test", user.Email)
+	assert.Equal(t, "Test alice", user.DisplayName)
+	assert.Equal(t, common.UserStatusEnabled, user.Status)
+
+	recorder, body := scimRequest(t, engine, http.MethodGet, `/scim/v2/Users?filter=userName+eq+%22ALICE%22`, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.EqualValues(t, 1, body["totalResults"], "userName lookups are case-insensitive")
+
+	recorder, body = scimRequest(t, engine, http.MethodPost, "/scim/v2/Users", map[string]any{"userName": "Alice"})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, "uniqueness", body["scimType"])
+
+	login, err := service.CreateLoginSession(userId, "oidc", "127.0.0.1", "test")
+	require.NoError(t, err)
+	require.NotNil(t, login.Session)
+	require.NoError(t, model.DB.Create(&model.Token{UserId: userId, Key: "scim-user-token", Name: "t", Status: common.TokenStatusEnabled}).Error)
+
+	// Microsoft Entra 以字符串形式发送 active
+	recorder, body = scimRequest(t, engine, http.MethodPatch, "/scim/v2/Users/"+strconv.Itoa(userId), map[string]any{
+		"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		"Operations": []map[string]any{{"op": "Replace", "path": "active", "value": "False"}},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, false, body["active"])
+
+	user, err = model.GetUserById(userId, false)
+	require.NoError(t, err)
+	assert.Equal(t, common.UserStatusDisabled, user.Status)
+	active, err := model.CountActiveUserSessions(userId, common.GetTimestamp())
+	require.NoError(t, err)
+	assert.Zero(t, active, "deprovisioning revokes every session")
+	var token model.Token
+	require.NoError(t, model.DB.Where("user_id = ?", userId).First(&token).Error)
+	assert.Equal(t, common.TokenStatusDisabled, token.Status, "deprovisioning disables every token")
+
+	// Okta 风格：无 path 的 replace
+	recorder, body = scimRequest(t, engine, http.MethodPatch, "/scim/v2/Users/"+strconv.Itoa(userId), map[string]any{
+		"Operations": []map[string]any{{"op": "replace", "value": map[string]any{"active": true, "displayName": "Alice A."}}},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, true, body["active"])
+	assert.Equal(t, "Alice A.", body["displayName"])
+	require.NoError(t, model.DB.Where("user_id = ?", userId).First(&token).Error)
+	assert.Equal(t, common.TokenStatusDisabled, token.Status, "re-activation does not re-enable tokens")
+
+	recorder, _ = scimRequest(t, engine, http.MethodDelete, "/scim/v2/Users/"+strconv.Itoa(userId), nil)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	recorder, _ = scimRequest(t, engine, http.MethodGet, "/scim/v2/Users/"+strconv.Itoa(userId), nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	_, err = model.GetUserById(userId, false)
+	assert.Error(t, err, "the user is soft-deleted")
+}
+
+func TestSCIMDoesNotExposeLocalUsers(t *testing.T) {
+	engine := setupSCIMControllerTest(t)
+	local := &model.User{Username: "local-admin", AffCode: "aff-local", Role: common.RoleRootUser, Status: common.UserStatusEnabled}
+	require.NoError(t, model.DB.Create(local).Error)
+
+	recorder, body := scimRequest(t, engine, http.MethodGet, "/scim/v2/Users", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.EqualValues(t, 0, body["totalResults"])
+	recorder, _ = scimRequest(t, engine, http.MethodPatch, "/scim/v2/Users/"+strconv.Itoa(local.Id), map[string]any{
+		"Operations": []map[string]any{{"op": "replace", "path": "active", "value": false}},
+	})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestSCIMGroupMembership(t *testing.T) {
+	engine := setupSCIMControllerTest(t)
+	alice := createSCIMTestUser(t, engine, "alice")
+	bob := createSCIMTestUser(t, engine, "bob")
+
+	recorder, _ := scimRequest(t, engine, http.MethodPatch, "/scim/v2/Groups/vip", map[string]any{
+		"Operations": []map[string]any{{"op": "add", "path": "members", "value": []map[string]any{
+			{"value": strconv.Itoa(alice)}, {"value": strconv.Itoa(bob)},
+		}}},
+	})
+	require.Equal(t, http.StatusNoContent, recorder.Code, recorder.Body.String())
+
+	recorder, body := scimRequest(t, engine, http.MethodGet, "/scim/v2/Groups/vip", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, body["members"], 2)
+
+	recorder, _ = scimRequest(t, engine, http.MethodPatch, "/scim/v2/Groups/vip", map[string]any{
+		"Operations": []map[string]any{{"op": "remove", "path": `members[value eq "` + strconv.Itoa(alice) + `"]`}},
+	})
+	require.Equal(t, http.StatusNoContent, recorder.Code, recorder.Body.String())
+	user, err := model.GetUserById(alice, false)
+	require.NoError(t, err)
+	assert.Equal(t, service.SCIMDefaultGroup, user.Group)
+
+	recorder, _ = scimRequest(t, engine, http.MethodPatch, "/scim/v2/Groups/vip", map[string]any{
+		"Operations": []map[string]any{{"op": "add", "path": "members", "value": []map[string]any{{"value": "999"}}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "only SCIM users can be members")
+
+	recorder, _ = scimRequest(t, engine, http.MethodPut, "/scim/v2/Groups/vip", map[string]any{
+		"displayName": "vip",
+		"members":     []map[string]any{},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	user, err = model.GetUserById(bob, false)
+	require.NoError(t, err)
+	assert.Equal(t, service.SCIMDefaultGroup, user.Group)
+
+	recorder, _ = scimRequest(t, engine, http.MethodGet, `/scim/v2/Groups?filter=displayName+eq+%22missing%22`, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder, _ = scimRequest(t, engine, http.MethodGet, "/scim/v2/Groups/missing", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestSCIMUserLinksToSSOIdentity(t *testing.T) {
+	engine := setupSCIMControllerTest(t)
+	require.NoError(t, model.DB.AutoMigrate(&model.ExternalIdentityClaim{}))
+	ldapUserId := createSCIMTestUser(t, engine, "alice")
+	oidcUserId := createSCIMTestUser(t, engine, "bob")
+	settings := system_setting.GetSCIMSettings()
+	ldapSettings := &system_setting.LDAPSettings{}
+
+	// 未配置关联属性时保持原行为
+	_, err := findOrCreateLDAPUser(ldapSettings, &service.LDAPEntry{Subject: "uid-alice", Username: "alice"}, system_setting.LDAPGroupMatch{})
+	require.ErrorIs(t, err, errLDAPUserNotProvisioned)
+
+	settings.SSOLinkAttribute = system_setting.SCIMSSOLinkExternalId
+	user, err := findOrCreateLDAPUser(ldapSettings, &service.LDAPEntry{Subject: "ext-alice", Username: "someone"}, system_setting.LDAPGroupMatch{})
+	require.NoError(t, err)
+	assert.Equal(t, ldapUserId, user.Id)
+	owner, err := model.GetExternalIdentityOwner(model.ExternalIdentityProviderLDAP, "ext-alice")
+	require.NoError(t, err)
+	assert.Equal(t, ldapUserId, owner)
+
+	settings.SSOLinkAttribute = system_setting.SCIMSSOLinkEmail
+	previousRegisterEnabled := common.RegisterEnabled
+	common.RegisterEnabled = false
+	t.Cleanup(func() { common.RegisterEnabled = previousRegisterEnabled })
+	provider := &oauth.OIDCProvider{}
+	unverified := &oauth.OAuthUser{ProviderUserID: "oidc-bob", Email: "bob@corp.test", Extra: map[string]any{"email_verified": false}}
+	_, err = findOrCreateOAuthUser(nil, provider, unverified, "")
+	var registrationDisabled *OAuthRegistrationDisabledError
+	require.ErrorAs(t, err, &registrationDisabled)
+
+	verified := &oauth.OAuthUser{ProviderUserID: "oidc-bob", Email: "Bob@corp.test", Extra: map[string]any{"email_verified": true}}
+	user, err = findOrCreateOAuthUser(nil, provider, verified, "")
+	require.NoError(t, err)
+	assert.Equal(t, oidcUserId, user.Id)
+	assert.True(t, model.IsOidcIdAlreadyTaken("oidc-bob"))
+
+	// 已绑定其他 OIDC 账号的用户不会被再次关联
+	other := &oauth.OAuthUser{ProviderUserID: "oidc-bob-2", Email: "bob@corp.test", Extra: map[string]any{"email_verified": true}}
+	_, err = findOrCreateOAuthUser(nil, provider, other, "")
+	require.ErrorAs(t, err, &registrationDisabled)
+}
@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// shadowTrafficContextKeys are the user/token keys a shadow request inherits from
+// the primary request. Channel keys are set again for the shadow channel, and
+// affinity or retry state is deliberately left behind.
+var shadowTrafficContextKeys = []string{
+	common.RequestIdKey,
+	string(constant.ContextKeyUserId),
+	string(constant.ContextKeyUserGroup),
+	string(constant.ContextKeyUsingGroup),
+	string(constant.ContextKeyUserQuota),
+	string(constant.ContextKeyUserStatus),
+	string(constant.ContextKeyUserEmail),
+	string(constant.ContextKeyUserName),
+	string(constant.ContextKeyUserSetting),
+	string(constant.ContextKeyTokenId),
+	string(constant.ContextKeyTokenKey),
+	string(constant.ContextKeyTokenGroup),
+	string(constant.ContextKeyTokenUnlimited),
+	string(constant.ContextKeyLanguage),
+	"token_name",
+	"relay_mode",
+}
+
+type shadowTrafficJob struct {
+	rule                 operation_setting.ShadowTrafficRule
+	relayFormat          types.RelayFormat
+	method               string
+	url                  string
+	header               http.Header
+	params               gin.Params
+	keys                 map[string]any
+	body                 []byte
+	estimatePromptTokens int
+	primaryResponse      []byte
+	record               *model.ShadowTrafficRecord
+}
+
+// mirrorShadowTraffic snapshots a successful primary request and replays it
+// against the rule's shadow channel in the background. The client response has
+// already been written, so nothing here can affect it.
+func mirrorShadowTraffic(c *gin.Context, relayFormat types.RelayFormat, info *relaycommon.RelayInfo, sample *service.ShadowTrafficSample) {
+	if !service.AcquireShadowTrafficSlot() {
+		return
+	}
+	bodyStorage, err := common.GetBodyStorage(c)
+	if err != nil {
+		service.ReleaseShadowTrafficSlot()
+		return
+	}
+	body, err := bodyStorage.Bytes()
+	if err != nil {
+		service.ReleaseShadowTrafficSlot()
+		return
+	}
+	rule := sample.Rule
+	job := &shadowTrafficJob{
+		rule:                 rule,
+		relayFormat:          relayFormat,
+		method:               c.Request.Method,
+		url:                  c.Request.URL.String(),
+		header:               shadowTrafficHeader(c.Request.Header),
+		params:               append(gin.Params(nil), c.Params...),
+		keys:                 make(map[string]any, len(shadowTrafficContextKeys)),
+		body:                 append([]byte(nil), body...),
+		estimatePromptTokens: info.GetEstimatePromptTokens(),
+		primaryResponse:      append([]byte(nil), sample.PrimaryResponse()...),
+		record: &model.ShadowTrafficRecord{
+			RuleName:       rule.Name,
+			RequestId:      c.GetString(common.RequestIdKey),
+			UserId:         info.UserId,
+			TokenId:        info.TokenId,
+			Group:          info.UsingGroup,
+			RequestPath:    c.Request.URL.Path,
+			IsStream:       info.IsStream,
+			PrimaryModel:   info.OriginModelName,
+			ShadowModel:    info.OriginModelName,
+			PrimaryChannel: info.ChannelId,
+			ShadowChannel:  rule.ShadowChannelId,
+			PrimaryLatency: time.Since(info.StartTime).Milliseconds(),
+		},
+	}
+	for _, key := range shadowTrafficContextKeys {
+		if value, ok := c.Get(key); ok {
+			job.keys[key] = value
+		}
+	}
+	if usage, ok := service.GetShadowTrafficUsage(c); ok {
+		job.record.PrimaryPrompt = usage.PromptTokens
+		job.record.PrimaryOutput = usage.CompletionTokens
+	}
+	if rule.ShadowModel != "" {
+		job.record.ShadowModel = rule.ShadowModel
+		if gjson.GetBytes(job.body, "model").Exists() {
+			if replaced, err := sjson.SetBytes(job.body, "model", rule.ShadowModel); err == nil {
+				job.body = replaced
+			}
+		}
+		for i := range job.params {
+			if job.params[i].Key == "model" {
+				job.params[i].Value = rule.ShadowModel
+			}
+		}
+	}
+	gopool.Go(func() {
+		defer service.ReleaseShadowTrafficSlot()
+		runShadowTraffic(job)
+	})
+}
+
+// shadowTrafficCredentialHeaders are client credentials that must never reach
+// the shadow channel; the shadow adaptor sets the channel's own credentials.
+var shadowTrafficCredentialHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+	"X-Goog-Api-Key",
+}
+
+func shadowTrafficHeader(header http.Header) http.Header {
+	cloned := header.Clone()
+	for _, name := range shadowTrafficCredentialHeaders {
+		cloned.Del(name)
+	}
+	return cloned
+}
+
+func runShadowTraffic(job *shadowTrafficJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("shadow traffic rule %s panic: %v", job.rule.Name, r))
+		}
+	}()
+	record := job.record
+	w, apiErr := relayShadowTraffic(job)
+	if apiErr != nil {
+		record.ShadowStatus = apiErr.StatusCode
+		record.ShadowError = apiErr.MaskSensitiveError()
+	} else {
+		record.ShadowSuccess = true
+		record.ShadowStatus = w.Code
+	}
+	if job.rule.RecordResponseDiff {
+		record.PrimaryResponse = service.ExtractShadowTrafficResponseText(job.primaryResponse)
+		record.ShadowResponse = service.ExtractShadowTrafficResponseText(w.Body.Bytes())
+		record.ResponseDiff = service.BuildShadowTrafficDiff(record.PrimaryResponse, record.ShadowResponse)
+	}
+	if err := record.Insert(); err != nil {
+		common.SysError(fmt.Sprintf("failed to save shadow traffic record for rule %s: %v", job.rule.Name, err))
+	}
+}
+
+// relayShadowTraffic runs the mirrored request through the regular relay
+// helpers on a detached context. RelayInfo.IsShadowTraffic makes the quota
+// settlement skip billing and consume logs.
+func relayShadowTraffic(job *shadowTrafficJob) (*httptest.ResponseRecorder, *types.NewAPIError) {
+	timeout := time.Duration(operation_setting.GetShadowTrafficSetting().TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, err := http.NewRequestWithContext(ctx, job.method, job.url, bytes.NewReader(job.body))
+	if err != nil {
+		return w, types.NewError(err, types.ErrorCodeInvalidRequest)
+	}
+	req.Header = job.header
+	req.ContentLength = int64(len(job.body))
+	c.Request = req
+	c.Params = job.params
+	for key, value := range job.keys {
+		c.Set(key, value)
+	}
+	c.Set(common.KeyRequestBody, job.body)
+	defer common.CleanupBodyStorage(c)
+	common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
+
+	channel, err := model.CacheGetChannel(job.rule.ShadowChannelId)
+	if err != nil {
+		channel, err = model.GetChannelById(job.rule.ShadowChannelId, true)
+		if err != nil {
+			return w, types.NewError(err, types.ErrorCodeGetChannelFailed)
+		}
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(c, channel, job.record.ShadowModel); apiErr != nil {
+		return w, apiErr
+	}
+	request, err := helper.GetAndValidateRequest(c, job.relayFormat)
+	if err != nil {
+		return w, types.NewError(err, types.ErrorCodeInvalidRequest)
+	}
+	info, err := relaycommon.GenRelayInfo(c, job.relayFormat, request, nil)
+	if err != nil {
+		return w, types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+	}
+	info.IsShadowTraffic = true
+	info.SetEstimatePromptTokens(job.estimatePromptTokens)
+
+	start := time.Now()
+	apiErr := relayByFormat(c, job.relayFormat, info)
+	job.record.ShadowLatency = time.Since(start).Milliseconds()
+	if usage, ok := service.GetShadowTrafficUsage(c); ok {
+		job.record.ShadowPrompt = usage.PromptTokens
+		job.record.ShadowOutput = usage.CompletionTokens
+	}
+	return w, apiErr
+}
+
+func shadowTrafficQueryParams(c *gin.Context) model.ShadowTrafficQueryParams {
+	channelId, _ := strconv.Atoi(c.Query("shadow_channel"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.ShadowTrafficQueryParams{
+		RuleName:       c.Query("rule_name"),
+		ShadowChannel:  channelId,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetShadowTrafficRecords(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	records, total, err := model.GetShadowTrafficRecords(shadowTrafficQueryParams(c), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(records)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetShadowTrafficSummary(c *gin.Context) {
+	summaries, err := model.GetShadowTrafficSummaries(shadowTrafficQueryParams(c))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, summaries)
+}
+
+func DeleteShadowTrafficRecords(c *gin.Context) {
+	deleted, err := model.DeleteShadowTrafficRecords(c.Query("rule_name"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"deleted": deleted})
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadowTrafficHeaderStripsCredentials(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer sk-client")
+	header.Set("x-api-key", "sk-client")
+	header.Set("X-Goog-Api-Key", "sk-client")
+	header.Set("Cookie", "session=1")
+	header.Set("Content-Type", "application/json")
+	header.Set("Anthropic-Version", "2023-06-01")
+
+	cloned := shadowTrafficHeader(header)
+	assert.Empty(t, cloned.Get("Authorization"))
+	assert.Empty(t, cloned.Get("X-Api-Key"))
+	assert.Empty(t, cloned.Get("X-Goog-Api-Key"))
+	assert.Empty(t, cloned.Get("Cookie"))
+	assert.Equal(t, "application/json", cloned.Get("Content-Type"))
+	assert.Equal(t, "2023-06-01", cloned.Get("Anthropic-Version"))
+	assert.Equal(t, "Bearer sk-client", header.Get("Authorization"), "the client request is left untouched")
+}
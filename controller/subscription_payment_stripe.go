@@ -30,6 +30,10 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 		common.ApiErrorMsg(c, "参数错误")
 		return
 	}
+	if err := model.CheckResellerChildSelfFunding(c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 
 	plan, err := model.GetSubscriptionPlanById(req.PlanId)
 	if err != nil {
@@ -7,6 +7,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -34,6 +35,126 @@ func CreateLogCleanupSystemTask(c *gin.Context) {
 	})
 }
 
+// CreateChannelKeyRotationSystemTask re-encrypts all channel keys with the
+// newest master key. Rejected when encryption is off or a rotation is active.
+func CreateChannelKeyRotationSystemTask(c *gin.Context) {
+	if !common.SecretEncryptionEnabled() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未配置渠道密钥加密主密钥（CHANNEL_KEY_ENCRYPTION_KEYS）",
+		})
+		return
+	}
+	task, created, err := service.EnqueueSystemTask(model.SystemTaskTypeChannelKeyRotation, nil)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !created {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "已有渠道密钥轮换任务正在运行或等待中",
+			"data":    task.ToResponse(),
+		})
+		return
+	}
+
+	recordManageAudit(c, "channel.key_rotation", map[string]interface{}{
+		"task_id":     task.TaskID,
+		"key_version": common.LatestSecretKeyVersion(),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    task.ToResponse(),
+	})
+}
+
+// CreateTokenKeyHashSystemTask hashes the keys of tokens created before keys
+// were stored hashed. Their plaintext keys can no longer be viewed afterwards.
+func CreateTokenKeyHashSystemTask(c *gin.Context) {
+	task, created, err := service.EnqueueSystemTask(model.SystemTaskTypeTokenKeyHash, nil)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !created {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "已有令牌密钥哈希迁移任务正在运行或等待中",
+			"data":    task.ToResponse(),
+		})
+		return
+	}
+
+	recordManageAudit(c, "token.key_hash_migration", map[string]interface{}{
+		"task_id": task.TaskID,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    task.ToResponse(),
+	})
+}
+
+// CreateTokenBudgetSystemTask rolls ended token budget periods over and sends
+// pending budget alerts without waiting for the next scheduled run.
+func CreateTokenBudgetSystemTask(c *gin.Context) {
+	task, created, err := service.EnqueueSystemTask(model.SystemTaskTypeTokenBudget, nil)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !created {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "已有令牌预算任务正在运行或等待中",
+			"data":    task.ToResponse(),
+		})
+		return
+	}
+
+	recordManageAudit(c, "token.budget_maintenance", map[string]interface{}{
+		"task_id": task.TaskID,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    task.ToResponse(),
+	})
+}
+
+// CreateLDAPSyncSystemTask reconciles LDAP-bound users with the directory
+// without waiting for the next scheduled run.
+func CreateLDAPSyncSystemTask(c *gin.Context) {
+	if !system_setting.GetLDAPSettings().Enabled {
+		common.ApiErrorMsg(c, "管理员未开启 LDAP 登录")
+		return
+	}
+	task, created, err := service.EnqueueSystemTask(model.SystemTaskTypeLDAPSync, nil)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !created {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "已有 LDAP 同步任务正在运行或等待中",
+			"data":    task.ToResponse(),
+		})
+		return
+	}
+
+	recordManageAudit(c, "user.ldap_sync", map[string]interface{}{
+		"task_id": task.TaskID,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    task.ToResponse(),
+	})
+}
+
 func GetCurrentSystemTask(c *gin.Context) {
 	taskType := c.Query("type")
 	if taskType == "" {
@@ -17,6 +17,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const tokenSystemPromptMaxLength = 10000
+
 type tokenAutoGroupsInput struct {
 	Set    bool
 	Groups []string
@@ -34,11 +36,14 @@ func (input *tokenAutoGroupsInput) UnmarshalJSON(data []byte) error {
 type tokenRequest struct {
 	model.Token
 	AutoGroups tokenAutoGroupsInput `json:"auto_groups"`
+	Scopes     *model.TokenScopes   `json:"scopes"` // 为空时更新令牌不修改权限范围
 }
 
 type tokenResponse struct {
 	*model.Token
-	AutoGroups []string `json:"auto_groups"`
+	AutoGroups []string           `json:"auto_groups"`
+	Scopes     *model.TokenScopes `json:"scopes"`
+	BudgetUsed int                `json:"budget_used"` // 当前预算周期已用额度
 }
 
 func buildMaskedTokenResponse(token *model.Token) *tokenResponse {
@@ -55,7 +60,12 @@ func buildMaskedTokenResponse(token *model.Token) *tokenResponse {
 	if len(autoGroups) == 0 {
 		autoGroups = nil
 	}
-	return &tokenResponse{Token: &maskedToken, AutoGroups: autoGroups}
+	scopes, err := token.GetScopes()
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to parse scopes for token %d: %v", token.Id, err))
+		scopes = nil
+	}
+	return &tokenResponse{Token: &maskedToken, AutoGroups: autoGroups, Scopes: scopes, BudgetUsed: token.GetBudgetUsed()}
 }
 
 func buildMaskedTokenResponses(tokens []*model.Token) []*tokenResponse {
@@ -116,6 +126,39 @@ func setTokenAutoGroups(c *gin.Context, token *model.Token, groups []string) boo
 	return true
 }
 
+func setTokenScopes(c *gin.Context, token *model.Token, scopes *model.TokenScopes) bool {
+	if scopes != nil {
+		if err := scopes.Normalize(); err != nil {
+			common.ApiErrorI18n(c, i18n.MsgTokenScopesInvalid, map[string]any{"Error": err.Error()})
+			return false
+		}
+	}
+	if err := token.SetScopes(scopes); err != nil {
+		common.ApiError(c, err)
+		return false
+	}
+	return true
+}
+
+func validateTokenBudget(c *gin.Context, token *model.Token) bool {
+	if token.BudgetQuota < 0 {
+		common.ApiErrorI18n(c, i18n.MsgTokenBudgetInvalid, map[string]any{"Error": "budget_quota must not be negative"})
+		return false
+	}
+	if token.BudgetAlertPercent < 0 || token.BudgetAlertPercent > 100 {
+		common.ApiErrorI18n(c, i18n.MsgTokenBudgetInvalid, map[string]any{"Error": "budget_alert_percent must be between 0 and 100"})
+		return false
+	}
+	if token.BudgetQuota == 0 && token.BudgetPeriod == "" {
+		return true
+	}
+	if err := model.ValidateTokenBudget(token.BudgetPeriod, token.BudgetTimezone); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenBudgetInvalid, map[string]any{"Error": err.Error()})
+		return false
+	}
+	return true
+}
+
 func GetAllTokens(c *gin.Context) {
 	userId := c.GetInt("id")
 	pageInfo := common.GetPageQuery(c)
@@ -186,6 +229,10 @@ func GetTokenKey(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if token.KeyHashed {
+		common.ApiErrorI18n(c, i18n.MsgTokenKeyHashed)
+		return
+	}
 	common.ApiSuccess(c, gin.H{
 		"key": token.GetFullKey(),
 	})
@@ -232,7 +279,7 @@ func GetTokenUsage(c *gin.Context) {
 	}
 	tokenKey := parts[1]
 
-	token, err := model.GetTokenByKey(strings.TrimPrefix(tokenKey, "sk-"), false)
+	token, err := model.GetTokenByAPIKey(strings.TrimPrefix(tokenKey, "sk-"), false)
 	if err != nil {
 		common.SysError("failed to get token by key: " + err.Error())
 		common.ApiErrorI18n(c, i18n.MsgTokenGetInfoFailed)
@@ -273,6 +320,10 @@ func AddToken(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
 	}
+	if len(token.SystemPrompt) > tokenSystemPromptMaxLength || len(token.SystemPromptSuffix) > tokenSystemPromptMaxLength {
+		common.ApiErrorI18n(c, i18n.MsgTokenSystemPromptTooLong, map[string]any{"Max": tokenSystemPromptMaxLength})
+		return
+	}
 	// 非无限额度时，检查额度值是否超出有效范围
 	if !token.UnlimitedQuota {
 		if token.RemainQuota < 0 {
@@ -307,6 +358,18 @@ func AddToken(c *gin.Context) {
 		token.CrossGroupRetry = false
 		_ = token.SetAutoGroups(nil)
 	}
+	if !setTokenScopes(c, &token, request.Scopes) {
+		return
+	}
+	if !validateTokenBudget(c, &token) {
+		return
+	}
+	// 组织令牌从组织钱包扣费，创建者需要有创建组织令牌的权限
+	if token.OrgId > 0 {
+		if _, _, ok := requireOrganizationPermission(c, token.OrgId, model.OrganizationPermCreateTokens); !ok {
+			return
+		}
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		common.ApiErrorI18n(c, i18n.MsgTokenGenerateFailed)
@@ -316,7 +379,6 @@ func AddToken(c *gin.Context) {
 	cleanToken := model.Token{
 		UserId:             c.GetInt("id"),
 		Name:               token.Name,
-		Key:                key,
 		CreatedTime:        common.GetTimestamp(),
 		AccessedTime:       common.GetTimestamp(),
 		ExpiredTime:        token.ExpiredTime,
@@ -328,15 +390,33 @@ func AddToken(c *gin.Context) {
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
 		AutoGroups:         token.AutoGroups,
+		SystemPrompt:       token.SystemPrompt,
+		SystemPromptSuffix: token.SystemPromptSuffix,
+		Scopes:             token.Scopes,
+		BudgetPeriod:       token.BudgetPeriod,
+		BudgetQuota:        token.BudgetQuota,
+		BudgetTimezone:     token.BudgetTimezone,
+		BudgetAlertPercent: token.BudgetAlertPercent,
+		BudgetSoftLimit:    token.BudgetSoftLimit,
+		OrgId:              token.OrgId,
+	}
+	if err := cleanToken.InitBudgetWindow(); err != nil {
+		common.ApiError(c, err)
+		return
 	}
+	cleanToken.SetHashedKey(key)
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	// 明文密钥只在这里返回一次，之后无法再查看
+	response := buildMaskedTokenResponse(&cleanToken)
+	response.Key = key
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    response,
 	})
 }
 
@@ -368,6 +448,10 @@ func UpdateToken(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
 	}
+	if len(token.SystemPrompt) > tokenSystemPromptMaxLength || len(token.SystemPromptSuffix) > tokenSystemPromptMaxLength {
+		common.ApiErrorI18n(c, i18n.MsgTokenSystemPromptTooLong, map[string]any{"Max": tokenSystemPromptMaxLength})
+		return
+	}
 	if !token.UnlimitedQuota {
 		if token.RemainQuota < 0 {
 			common.ApiErrorI18n(c, i18n.MsgTokenQuotaNegative)
@@ -394,9 +478,16 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	resetBudgetWindow := false
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
+		if !validateTokenBudget(c, &token) {
+			return
+		}
+		// 周期或时区变化、或新启用预算时重新开始计算预算周期
+		resetBudgetWindow = token.BudgetQuota > 0 && (!cleanToken.BudgetEnabled() ||
+			cleanToken.BudgetPeriod != token.BudgetPeriod || cleanToken.BudgetTimezone != token.BudgetTimezone)
 		// If you add more fields, please also update token.Update()
 		cleanToken.Name = token.Name
 		cleanToken.ExpiredTime = token.ExpiredTime
@@ -407,6 +498,13 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.SystemPrompt = token.SystemPrompt
+		cleanToken.SystemPromptSuffix = token.SystemPromptSuffix
+		cleanToken.BudgetPeriod = token.BudgetPeriod
+		cleanToken.BudgetQuota = token.BudgetQuota
+		cleanToken.BudgetTimezone = token.BudgetTimezone
+		cleanToken.BudgetAlertPercent = token.BudgetAlertPercent
+		cleanToken.BudgetSoftLimit = token.BudgetSoftLimit
 		if token.Group != "auto" {
 			cleanToken.CrossGroupRetry = false
 			_ = cleanToken.SetAutoGroups(nil)
@@ -415,12 +513,22 @@ func UpdateToken(c *gin.Context) {
 				return
 			}
 		}
+		if request.Scopes != nil && !setTokenScopes(c, cleanToken, request.Scopes) {
+			return
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if resetBudgetWindow {
+		if err := model.ResetTokenBudgetWindow(cleanToken.Id, cleanToken.Key); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		cleanToken.BudgetWindowEnd = 0
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -467,9 +575,15 @@ func GetTokenKeysBatch(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	// 哈希保存的令牌无法取回明文，单独列出
 	keysMap := make(map[int]string)
+	hashedIds := make([]int, 0)
 	for _, t := range tokens {
+		if t.KeyHashed {
+			hashedIds = append(hashedIds, t.Id)
+			continue
+		}
 		keysMap[t.Id] = t.GetFullKey()
 	}
-	common.ApiSuccess(c, gin.H{"keys": keysMap})
+	common.ApiSuccess(c, gin.H{"keys": keysMap, "hashed_ids": hashedIds})
 }
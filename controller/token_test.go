@@ -578,3 +578,249 @@ func TestGetTokenKeyRequiresOwnershipAndReturnsFullKey(t *testing.T) {
 		t.Fatalf("unauthorized key response leaked raw token key: %s", unauthorizedRecorder.Body.String())
 	}
 }
+
+func TestAddTokenReturnsKeyOnceAndStoresHash(t *testing.T) {
+	db := setupTokenControllerTestDB(t)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{
+		"name":            "hashed-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+	}, 1)
+	AddToken(ctx)
+
+	response := decodeAPIResponse(t, recorder)
+	if !response.Success {
+		t.Fatalf("expected token creation to succeed, got message: %s", response.Message)
+	}
+	var created tokenResponseItem
+	if err := common.Unmarshal(response.Data, &created); err != nil {
+		t.Fatalf("failed to decode created token: %v", err)
+	}
+	if len(created.Key) != 48 {
+		t.Fatalf("expected the plaintext key in the creation response, got %q", created.Key)
+	}
+
+	var stored model.Token
+	if err := db.First(&stored, "id = ?", created.ID).Error; err != nil {
+		t.Fatalf("failed to load created token: %v", err)
+	}
+	if !stored.KeyHashed || stored.Key != model.HashTokenKey(created.Key) {
+		t.Fatalf("expected the key to be stored hashed, got %q", stored.Key)
+	}
+	if stored.KeyPrefix != created.Key[:8] {
+		t.Fatalf("expected display prefix %q, got %q", created.Key[:8], stored.KeyPrefix)
+	}
+	if !strings.HasPrefix(stored.GetMaskedKey(), stored.KeyPrefix) {
+		t.Fatalf("expected masked key to start with the display prefix, got %q", stored.GetMaskedKey())
+	}
+
+	keyCtx, keyRecorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/"+strconv.Itoa(stored.Id)+"/key", nil, 1)
+	keyCtx.Params = gin.Params{{Key: "id", Value: strconv.Itoa(stored.Id)}}
+	GetTokenKey(keyCtx)
+	if decodeAPIResponse(t, keyRecorder).Success {
+		t.Fatalf("expected key reveal to fail for hashed token")
+	}
+
+	legacy := seedToken(t, db, 1, "legacy-token", "legacy1234token5678")
+	batchCtx, batchRecorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/batch/keys", map[string]any{
+		"ids": []int{stored.Id, legacy.Id},
+	}, 1)
+	GetTokenKeysBatch(batchCtx)
+	batchResponse := decodeAPIResponse(t, batchRecorder)
+	var keys struct {
+		Keys      map[int]string `json:"keys"`
+		HashedIds []int          `json:"hashed_ids"`
+	}
+	if err := common.Unmarshal(batchResponse.Data, &keys); err != nil {
+		t.Fatalf("failed to decode batch keys: %v", err)
+	}
+	if len(keys.Keys) != 1 || keys.Keys[legacy.Id] != legacy.Key {
+		t.Fatalf("expected only the legacy key to be revealed, got %v", keys.Keys)
+	}
+	if len(keys.HashedIds) != 1 || keys.HashedIds[0] != stored.Id {
+		t.Fatalf("expected hashed ids [%d], got %v", stored.Id, keys.HashedIds)
+	}
+}
+
+func TestTokenScopesAreValidatedAndKeptOnUpdate(t *testing.T) {
+	db := setupTokenControllerTestDB(t)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{
+		"name":            "scoped-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"scopes":          map[string]any{"endpoints": []string{"chat", "teleport"}},
+	}, 1)
+	AddToken(ctx)
+	if decodeAPIResponse(t, recorder).Success {
+		t.Fatalf("expected unknown scope endpoint to be rejected")
+	}
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{
+		"name":            "scoped-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"scopes": map[string]any{
+			"endpoints":     []string{" Embeddings ", "embeddings"},
+			"max_tokens":    1024,
+			"disable_tools": true,
+		},
+	}, 1)
+	AddToken(ctx)
+	response := decodeAPIResponse(t, recorder)
+	if !response.Success {
+		t.Fatalf("expected token creation to succeed, got message: %s", response.Message)
+	}
+	var created tokenResponseItem
+	if err := common.Unmarshal(response.Data, &created); err != nil {
+		t.Fatalf("failed to decode created token: %v", err)
+	}
+
+	var stored model.Token
+	if err := db.First(&stored, "id = ?", created.ID).Error; err != nil {
+		t.Fatalf("failed to load created token: %v", err)
+	}
+	scopes, err := stored.GetScopes()
+	if err != nil || scopes == nil {
+		t.Fatalf("expected stored scopes, got %v (%v)", scopes, err)
+	}
+	if len(scopes.Endpoints) != 1 || scopes.Endpoints[0] != model.TokenScopeEndpointEmbeddings || scopes.MaxTokens != 1024 || !scopes.DisableTools {
+		t.Fatalf("unexpected stored scopes: %+v", scopes)
+	}
+
+	// 更新时不带 scopes 字段，权限范围保持不变
+	updateCtx, updateRecorder := newAuthenticatedContext(t, http.MethodPut, "/api/token/", map[string]any{
+		"id":              stored.Id,
+		"name":            "renamed-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+	}, 1)
+	UpdateToken(updateCtx)
+	if response := decodeAPIResponse(t, updateRecorder); !response.Success {
+		t.Fatalf("expected token update to succeed, got message: %s", response.Message)
+	}
+	var updated model.Token
+	if err := db.First(&updated, "id = ?", stored.Id).Error; err != nil {
+		t.Fatalf("failed to load updated token: %v", err)
+	}
+	if updated.Name != "renamed-token" || updated.Scopes != stored.Scopes {
+		t.Fatalf("expected scopes to be kept, got name %q scopes %q", updated.Name, updated.Scopes)
+	}
+
+	// 传入空对象清除权限范围
+	clearCtx, clearRecorder := newAuthenticatedContext(t, http.MethodPut, "/api/token/", map[string]any{
+		"id":              stored.Id,
+		"name":            "renamed-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"scopes":          map[string]any{},
+	}, 1)
+	UpdateToken(clearCtx)
+	if response := decodeAPIResponse(t, clearRecorder); !response.Success {
+		t.Fatalf("expected token update to succeed, got message: %s", response.Message)
+	}
+	if err := db.First(&updated, "id = ?", stored.Id).Error; err != nil {
+		t.Fatalf("failed to load updated token: %v", err)
+	}
+	if updated.Scopes != "" {
+		t.Fatalf("expected scopes to be cleared, got %q", updated.Scopes)
+	}
+}
+
+func TestTokenBudgetIsValidatedAndResetOnPeriodChange(t *testing.T) {
+	db := setupTokenControllerTestDB(t)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{
+		"name":            "budget-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"budget_quota":    1000,
+	}, 1)
+	AddToken(ctx)
+	if decodeAPIResponse(t, recorder).Success {
+		t.Fatalf("expected budget without period to be rejected")
+	}
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{
+		"name":            "budget-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"budget_period":   model.TokenBudgetPeriodDaily,
+		"budget_quota":    1000,
+		"budget_timezone": "Mars/Olympus",
+	}, 1)
+	AddToken(ctx)
+	if decodeAPIResponse(t, recorder).Success {
+		t.Fatalf("expected unknown budget timezone to be rejected")
+	}
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodPost, "/api/token/", map[string]any{
+		"name":                 "budget-token",
+		"expired_time":         -1,
+		"unlimited_quota":      true,
+		"budget_period":        model.TokenBudgetPeriodDaily,
+		"budget_quota":         1000,
+		"budget_timezone":      "Asia/Shanghai",
+		"budget_alert_percent": 80,
+	}, 1)
+	AddToken(ctx)
+	response := decodeAPIResponse(t, recorder)
+	if !response.Success {
+		t.Fatalf("expected token creation to succeed, got message: %s", response.Message)
+	}
+	var created tokenResponseItem
+	if err := common.Unmarshal(response.Data, &created); err != nil {
+		t.Fatalf("failed to decode created token: %v", err)
+	}
+	var stored model.Token
+	if err := db.First(&stored, "id = ?", created.ID).Error; err != nil {
+		t.Fatalf("failed to load created token: %v", err)
+	}
+	if stored.BudgetQuota != 1000 || stored.BudgetAlertPercent != 80 || stored.BudgetWindowEnd <= common.GetTimestamp() {
+		t.Fatalf("unexpected stored budget: quota=%d alert=%d window_end=%d", stored.BudgetQuota, stored.BudgetAlertPercent, stored.BudgetWindowEnd)
+	}
+
+	// 只修改预算额度时保留当前周期
+	updateCtx, updateRecorder := newAuthenticatedContext(t, http.MethodPut, "/api/token/", map[string]any{
+		"id":              stored.Id,
+		"name":            "budget-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"budget_period":   model.TokenBudgetPeriodDaily,
+		"budget_quota":    2000,
+		"budget_timezone": "Asia/Shanghai",
+	}, 1)
+	UpdateToken(updateCtx)
+	if response := decodeAPIResponse(t, updateRecorder); !response.Success {
+		t.Fatalf("expected token update to succeed, got message: %s", response.Message)
+	}
+	var updated model.Token
+	if err := db.First(&updated, "id = ?", stored.Id).Error; err != nil {
+		t.Fatalf("failed to load updated token: %v", err)
+	}
+	if updated.BudgetQuota != 2000 || updated.BudgetWindowEnd != stored.BudgetWindowEnd {
+		t.Fatalf("expected budget window to be kept, got quota=%d window_end=%d", updated.BudgetQuota, updated.BudgetWindowEnd)
+	}
+
+	// 修改周期后从下一次请求重新开始计算
+	updateCtx, updateRecorder = newAuthenticatedContext(t, http.MethodPut, "/api/token/", map[string]any{
+		"id":              stored.Id,
+		"name":            "budget-token",
+		"expired_time":    -1,
+		"unlimited_quota": true,
+		"budget_period":   model.TokenBudgetPeriodMonthly,
+		"budget_quota":    2000,
+		"budget_timezone": "Asia/Shanghai",
+	}, 1)
+	UpdateToken(updateCtx)
+	if response := decodeAPIResponse(t, updateRecorder); !response.Success {
+		t.Fatalf("expected token update to succeed, got message: %s", response.Message)
+	}
+	if err := db.First(&updated, "id = ?", stored.Id).Error; err != nil {
+		t.Fatalf("failed to load updated token: %v", err)
+	}
+	if updated.BudgetPeriod != model.TokenBudgetPeriodMonthly || updated.BudgetWindowEnd != 0 {
+		t.Fatalf("expected budget window to be reset, got period=%q window_end=%d", updated.BudgetPeriod, updated.BudgetWindowEnd)
+	}
+}
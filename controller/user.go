@@ -72,7 +72,12 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 检查是否启用2FA
+	completePasswordLogin(&user, c)
+}
+
+// completePasswordLogin 在密码（本地或 LDAP）校验通过后完成登录：开启 2FA 的用户
+// 先签发二次验证流程，否则直接建立会话。
+func completePasswordLogin(user *model.User, c *gin.Context) {
 	twoFAEnabled, err := model.IsTwoFAEnabled(user.Id)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("Login failed to load 2FA status for user %d: %v", user.Id, err))
@@ -109,7 +114,7 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	setupLogin(&user, c)
+	setupLogin(user, c)
 }
 
 // loginMethodFromContext 根据请求路径推导登录方式，用于登录审计日志。
@@ -125,6 +130,10 @@ func loginMethodFromContext(c *gin.Context) string {
 		return "wechat"
 	case "/api/oauth/telegram/login":
 		return "telegram"
+	case "/api/saml/login":
+		return "saml"
+	case "/api/user/ldap/login":
+		return "ldap"
 	case "/api/oauth/:provider":
 		if provider := c.Param("provider"); provider != "" {
 			return "oauth:" + provider
@@ -287,6 +296,10 @@ func Register(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgUserRegisterFailed)
 		return
 	}
+	response := gin.H{
+		"success": true,
+		"message": "",
+	}
 	// 生成默认令牌
 	if constant.GenerateDefaultToken {
 		key, err := common.GenerateKey()
@@ -299,7 +312,6 @@ func Register(c *gin.Context) {
 		token := model.Token{
 			UserId:             insertedUser.Id, // 使用插入后的用户ID
 			Name:               cleanUser.Username + "的初始令牌",
-			Key:                key,
 			CreatedTime:        common.GetTimestamp(),
 			AccessedTime:       common.GetTimestamp(),
 			ExpiredTime:        -1,     // 永不过期
@@ -310,16 +322,16 @@ func Register(c *gin.Context) {
 		if setting.DefaultUseAutoGroup {
 			token.Group = "auto"
 		}
+		token.SetHashedKey(key)
 		if err := token.Insert(); err != nil {
 			common.ApiErrorI18n(c, i18n.MsgCreateDefaultTokenErr)
 			return
 		}
+		// 明文密钥只在这里返回一次，之后无法再查看
+		response["data"] = gin.H{"key": key}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-	})
+	c.JSON(http.StatusOK, response)
 	return
 }
 
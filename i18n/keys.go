@@ -58,6 +58,13 @@ const (
 	MsgTokenAutoGroupsTooMany    = "token.auto_groups_too_many"
 	MsgTokenAutoGroupsDuplicate  = "token.auto_groups_duplicate"
 	MsgTokenAutoGroupsInvalid    = "token.auto_groups_invalid"
+	MsgTokenKeyHashed            = "token.key_hashed"
+	MsgTokenScopesInvalid        = "token.scopes_invalid"
+	MsgTokenBudgetInvalid        = "token.budget_invalid"
+	MsgTokenSystemPromptTooLong  = "token.system_prompt_too_long"
+	MsgDerivedTokenInvalid       = "derived_token.invalid"
+	MsgDerivedTokenNested        = "derived_token.nested"
+	MsgDerivedTokenNotFound      = "derived_token.not_found"
 )
 
 // Redemption related messages
@@ -317,6 +324,7 @@ const (
 	MsgDistributorAffinityChannelDisabled = "distributor.affinity_channel_disabled"
 	MsgDistributorTokenNoModelAccess      = "distributor.token_no_model_access"
 	MsgDistributorTokenModelForbidden     = "distributor.token_model_forbidden"
+	MsgDistributorTokenEndpointForbidden  = "distributor.token_endpoint_forbidden"
 	MsgDistributorModelNameRequired       = "distributor.model_name_required"
 	MsgDistributorInvalidPlayground       = "distributor.invalid_playground_request"
 	MsgDistributorGroupAccessDenied       = "distributor.group_access_denied"
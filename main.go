@@ -125,6 +125,9 @@ func main() {
 	// Codex credential auto-refresh check every 10 minutes, refresh when expires within 1 day
 	service.StartCodexCredentialAutoRefreshTask()
 
+	// Health-check pooled channel proxies and eject failing ones
+	service.StartProxyPoolHealthCheck()
+
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
@@ -323,6 +326,10 @@ func InitResources() error {
 		}
 	}
 	model.InitOptionMap()
+	if err = model.InitTokenKeyHashSecret(); err != nil {
+		common.FatalLog("failed to initialize token key hash secret: " + err.Error())
+		return err
+	}
 
 	// 清理旧的磁盘缓存文件
 	common.CleanupOldCacheFiles()
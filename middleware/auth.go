@@ -294,7 +294,7 @@ func TokenAuthReadOnly() func(c *gin.Context) {
 		parts := strings.Split(key, "-")
 		key = parts[0]
 
-		token, err := model.GetTokenByKey(key, false)
+		token, err := model.GetTokenByAPIKey(key, false)
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				c.JSON(http.StatusUnauthorized, gin.H{
@@ -302,7 +302,7 @@ func TokenAuthReadOnly() func(c *gin.Context) {
 					"message": common.TranslateMessage(c, i18n.MsgTokenInvalid),
 				})
 			} else {
-				common.SysLog("TokenAuthReadOnly GetTokenByKey database error: " + err.Error())
+				common.SysLog("TokenAuthReadOnly GetTokenByAPIKey database error: " + err.Error())
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"success": false,
 					"message": common.TranslateMessage(c, i18n.MsgDatabaseError),
@@ -377,6 +377,7 @@ func TokenAuth() func(c *gin.Context) {
 		if c.Request.URL.Path == "/v1/models" ||
 			strings.HasPrefix(c.Request.URL.Path, "/v1beta/models") ||
 			strings.HasPrefix(c.Request.URL.Path, "/v1beta/openai/models") ||
+			strings.HasPrefix(c.Request.URL.Path, "/v1beta/cachedContents") ||
 			strings.HasPrefix(c.Request.URL.Path, "/v1/models/") {
 			skKey := c.Query("key")
 			if skKey != "" {
@@ -393,6 +394,11 @@ func TokenAuth() func(c *gin.Context) {
 		if strings.HasPrefix(key, "Bearer ") || strings.HasPrefix(key, "bearer ") {
 			key = strings.TrimSpace(key[7:])
 		}
+		// 父令牌签发的子令牌是 JWT，其中的 "-" 不能当作渠道分隔符
+		derivedKey := ""
+		if raw := strings.TrimPrefix(key, "sk-"); service.IsDerivedTokenKey(raw) {
+			derivedKey = raw
+		}
 		if key == "" || key == "midjourney-proxy" {
 			key = c.Request.Header.Get("mj-api-secret")
 			if strings.HasPrefix(key, "Bearer ") || strings.HasPrefix(key, "bearer ") {
@@ -406,7 +412,15 @@ func TokenAuth() func(c *gin.Context) {
 			parts = strings.Split(key, "-")
 			key = parts[0]
 		}
-		token, err := model.ValidateUserToken(key)
+		var token *model.Token
+		var derived *model.DerivedToken
+		var err error
+		if derivedKey != "" {
+			parts = nil
+			token, derived, err = service.ValidateDerivedToken(derivedKey)
+		} else {
+			token, err = model.ValidateUserToken(key)
+		}
 		if token != nil {
 			id := c.GetInt("id")
 			if id == 0 {
@@ -479,6 +493,12 @@ func TokenAuth() func(c *gin.Context) {
 		if err != nil {
 			return
 		}
+		if derived != nil {
+			common.SetContextKey(c, constant.ContextKeyDerivedTokenId, derived.Id)
+			if derived.SpendCap > 0 {
+				common.SetContextKey(c, constant.ContextKeyTokenBudgetLimited, true)
+			}
+		}
 		c.Next()
 	}
 }
@@ -503,6 +523,12 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	if token.SystemPrompt != "" {
+		common.SetContextKey(c, constant.ContextKeyTokenSystemPrompt, token.SystemPrompt)
+	}
+	if token.SystemPromptSuffix != "" {
+		common.SetContextKey(c, constant.ContextKeyTokenSystemSuffix, token.SystemPromptSuffix)
+	}
 	if token.AutoGroups != "" {
 		autoGroups, err := token.GetAutoGroups()
 		if err != nil {
@@ -513,6 +539,24 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 			common.SetContextKey(c, constant.ContextKeyTokenAutoGroups, autoGroups)
 		}
 	}
+	if token.BudgetEnabled() && !token.BudgetSoftLimit {
+		common.SetContextKey(c, constant.ContextKeyTokenBudgetLimited, true)
+	}
+	if token.OrgId > 0 {
+		common.SetContextKey(c, constant.ContextKeyTokenOrgId, token.OrgId)
+	}
+	if token.Scopes != "" {
+		scopes, err := token.GetScopes()
+		if err != nil {
+			// 权限范围无法解析时拒绝请求，避免受限令牌变成不受限
+			common.SysError(fmt.Sprintf("failed to parse scopes for token %d: %v", token.Id, err))
+			abortWithOpenAiMessage(c, http.StatusForbidden, i18n.T(c, i18n.MsgTokenScopesInvalid, map[string]any{"Error": err.Error()}), types.ErrorCodeAccessDenied)
+			return err
+		}
+		if !scopes.IsEmpty() {
+			common.SetContextKey(c, constant.ContextKeyTokenScopes, scopes)
+		}
+	}
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"slices"
 	"strconv"
 	"strings"
@@ -23,6 +27,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 )
 
 type ModelRequest struct {
@@ -30,9 +35,33 @@ type ModelRequest struct {
 	Group string `json:"group,omitempty"`
 }
 
+// abortIfTokenEndpointForbidden rejects the request when the token scopes do
+// not allow its endpoint.
+func abortIfTokenEndpointForbidden(c *gin.Context) bool {
+	endpoint, allowed := service.CheckTokenScopeEndpoint(service.GetTokenScopes(c), c.Request.URL.Path)
+	if !allowed {
+		abortWithOpenAiMessage(c, http.StatusForbidden, i18n.T(c, i18n.MsgDistributorTokenEndpointForbidden, map[string]any{"Endpoint": endpoint}), types.ErrorCodeAccessDenied)
+	}
+	return !allowed
+}
+
+// TokenEndpointScope applies the token endpoint scopes to relay routes that
+// do not go through Distribute.
+func TokenEndpointScope() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if abortIfTokenEndpointForbidden(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		var channel *model.Channel
+		if abortIfTokenEndpointForbidden(c) {
+			return
+		}
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
@@ -54,6 +83,7 @@ func Distribute() func(c *gin.Context) {
 				abortWithOpenAiMessage(c, http.StatusForbidden, i18n.T(c, i18n.MsgDistributorChannelDisabled))
 				return
 			}
+			applyModelSplit(c, modelRequest)
 		} else {
 			// Select a channel for the user
 			// check token model mapping
@@ -76,6 +106,8 @@ func Distribute() func(c *gin.Context) {
 					return
 				}
 			}
+			// 令牌模型限制按客户端请求的别名校验，之后再落到具体的分流模型上
+			applyModelSplit(c, modelRequest)
 
 			if shouldSelectChannel {
 				if modelRequest.Model == "" {
@@ -102,7 +134,9 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+				if bound := bindGeminiCachedContent(c, usingGroup); bound != nil {
+					channel = bound
+				} else if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
 					affinityUsable := false
 					preferred, err := model.CacheGetChannel(preferredChannelID)
 					if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled &&
@@ -206,6 +240,199 @@ func getModelFromRequest(c *gin.Context) (*ModelRequest, error) {
 	return &modelRequest, nil
 }
 
+// applyModelSplit routes a split alias to one of its concrete models. The model
+// is rewritten where the client put it (JSON or form body, Gemini URL path) so
+// pass-through channels see the concrete model; requests whose model cannot be
+// rewritten are not split rather than sending the alias upstream.
+func applyModelSplit(c *gin.Context, modelRequest *ModelRequest) {
+	target, ok := service.ResolveModelSplit(c, modelRequest.Model)
+	if !ok {
+		return
+	}
+	if !rewriteRequestModel(c, modelRequest.Model, target) {
+		common.SetContextKey(c, constant.ContextKeyModelSplitAlias, "")
+		return
+	}
+	modelRequest.Model = target
+}
+
+func rewriteRequestModel(c *gin.Context, alias string, target string) bool {
+	if c.GetInt("relay_mode") == relayconstant.RelayModeGemini && extractModelNameFromGeminiPath(c.Request.URL.Path) == alias {
+		rewriteGeminiPathModel(c, alias, target)
+		return true
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return false
+	}
+	requestBody, err := storage.Bytes()
+	if err != nil {
+		return false
+	}
+	var replaced []byte
+	switch c.ContentType() {
+	case gin.MIMEJSON:
+		replaced, err = rewriteJSONModel(requestBody, alias, target)
+	case gin.MIMEMultipartPOSTForm:
+		replaced, err = rewriteMultipartModel(c, requestBody, alias, target)
+	case gin.MIMEPOSTForm:
+		replaced, err = rewriteFormModel(requestBody, alias, target)
+	default:
+		return false
+	}
+	if err != nil {
+		return false
+	}
+	common.CleanupBodyStorage(c)
+	c.Set(common.KeyRequestBody, replaced)
+	c.Request.MultipartForm = nil
+	c.Request.PostForm = nil
+	return true
+}
+
+var errModelNotInRequest = errors.New("model not found in request body")
+
+// rewriteGeminiPathModel replaces the model segment of /v1beta/models/{model}:{action}.
+func rewriteGeminiPathModel(c *gin.Context, alias string, target string) {
+	replace := func(path string) string {
+		return strings.Replace(path, "/models/"+alias, "/models/"+target, 1)
+	}
+	c.Request.URL.Path = replace(c.Request.URL.Path)
+	if c.Request.URL.RawPath != "" {
+		c.Request.URL.RawPath = replace(c.Request.URL.RawPath)
+	}
+	for i := range c.Params {
+		if c.Params[i].Key == "path" {
+			c.Params[i].Value = strings.Replace(c.Params[i].Value, "/"+alias, "/"+target, 1)
+		}
+	}
+}
+
+func rewriteJSONModel(requestBody []byte, alias string, target string) ([]byte, error) {
+	switch gjson.GetBytes(requestBody, "model").String() {
+	case alias:
+		return sjson.SetBytes(requestBody, "model", target)
+	case "models/" + alias:
+		// Gemini 上下文缓存创建
+		return sjson.SetBytes(requestBody, "model", "models/"+target)
+	default:
+		return nil, errModelNotInRequest
+	}
+}
+
+func rewriteFormModel(requestBody []byte, alias string, target string) ([]byte, error) {
+	values, err := url.ParseQuery(string(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	if values.Get("model") != alias {
+		return nil, errModelNotInRequest
+	}
+	values.Set("model", target)
+	return []byte(values.Encode()), nil
+}
+
+// rewriteMultipartModel copies every part unchanged except the model field. The
+// original boundary is kept so the client's Content-Type stays valid.
+func rewriteMultipartModel(c *gin.Context, requestBody []byte, alias string, target string) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, errModelNotInRequest
+	}
+	reader := multipart.NewReader(bytes.NewReader(requestBody), boundary)
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	found := false
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		dst, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "model" && part.FileName() == "" {
+			value, err := io.ReadAll(part)
+			if err != nil {
+				return nil, err
+			}
+			if string(value) != alias {
+				return nil, errModelNotInRequest
+			}
+			found = true
+			_, err = io.WriteString(dst, target)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := io.Copy(dst, part); err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, errModelNotInRequest
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// bindGeminiCachedContent returns the channel that created the context cache a
+// Gemini request refers to. Caches only exist under the creating key, so the
+// request is pinned to that channel and key and not retried on other channels.
+func bindGeminiCachedContent(c *gin.Context, usingGroup string) *model.Channel {
+	if c.GetInt("relay_mode") != relayconstant.RelayModeGemini {
+		return nil
+	}
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil
+	}
+	requestBody, err := storage.Bytes()
+	if err != nil {
+		return nil
+	}
+	name := gjson.GetBytes(requestBody, "cachedContent").String()
+	if name == "" {
+		return nil
+	}
+	cache, err := model.GetGeminiCachedContent(common.GetContextKeyInt(c, constant.ContextKeyUserId), name)
+	if err != nil || cache == nil || cache.ExpireTime <= common.GetTimestamp() {
+		return nil
+	}
+	channel, err := model.CacheGetChannel(cache.ChannelId)
+	if err != nil || channel == nil || channel.Status != common.ChannelStatusEnabled {
+		return nil
+	}
+	if cache.UpstreamName != name {
+		replaced, err := sjson.SetBytes(requestBody, "cachedContent", cache.UpstreamName)
+		if err != nil {
+			return nil
+		}
+		common.CleanupBodyStorage(c)
+		c.Set(common.KeyRequestBody, replaced)
+	}
+	common.SetContextKey(c, constant.ContextKeyGeminiCachedContent, cache)
+	c.Set(string(constant.ContextKeyTokenSpecificChannelId), strconv.Itoa(channel.Id))
+	if usingGroup == "auto" {
+		common.SetContextKey(c, constant.ContextKeyAutoGroup, cache.Group)
+	}
+	return channel
+}
+
 func getModelFromJSONBody(c *gin.Context) (*ModelRequest, error) {
 	storage, err := common.GetBodyStorage(c)
 	if err != nil {
@@ -336,6 +563,16 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		if _, ok := c.Get("relay_mode"); !ok {
 			c.Set("relay_mode", relayMode)
 		}
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1beta/cachedContents") {
+		// Gemini 上下文缓存创建: model 字段形如 models/gemini-2.0-flash-001
+		req, err := getModelFromRequest(c)
+		if err != nil {
+			return nil, false, err
+		}
+		modelRequest.Model = req.Model
+		if idx := strings.LastIndex(req.Model, "models/"); idx >= 0 {
+			modelRequest.Model = req.Model[idx+len("models/"):]
+		}
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") || strings.HasPrefix(c.Request.URL.Path, "/v1/models/") {
 		// Gemini API 路径处理: /v1beta/models/gemini-2.0-flash:generateContent
 		relayMode := relayconstant.RelayModeGemini
@@ -463,7 +700,20 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
-	key, index, newAPIError := channel.GetNextEnabledKey()
+	var (
+		key         string
+		index       int
+		newAPIError *types.NewAPIError
+	)
+	if cache, ok := common.GetContextKeyType[*model.GeminiCachedContent](c, constant.ContextKeyGeminiCachedContent); ok && cache.ChannelId == channel.Id {
+		// 上下文缓存只存在于创建它的 key 下
+		key, index, newAPIError = channel.GetEnabledKeyByIndex(cache.KeyIndex)
+	} else if seed, ok := service.GetChannelAffinityKeySeed(c); ok {
+		// prompt_prefix 亲和性需要同时固定 key，上游的 prompt cache 按 key 隔离
+		key, index, newAPIError = channel.GetStickyEnabledKey(seed)
+	} else {
+		key, index, newAPIError = channel.GetNextEnabledKey()
+	}
 	if newAPIError != nil {
 		return newAPIError
 	}
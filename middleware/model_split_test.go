@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useModelSplitAlias(t *testing.T) {
+	t.Helper()
+	settings := model_setting.GetModelSplitSettings()
+	saved := *settings
+	t.Cleanup(func() { *settings = saved })
+	*settings = model_setting.ModelSplitSettings{
+		Enabled: true,
+		Aliases: []model_setting.ModelSplitAlias{{
+			Alias: "chat-default",
+			Arms:  []model_setting.ModelSplitArm{{Model: "gemini-x", Weight: 1}},
+		}},
+	}
+}
+
+func newModelSplitContext(t *testing.T, target string, contentType string, body []byte) *gin.Context {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	c.Set(common.KeyRequestBody, body)
+	t.Cleanup(func() { common.CleanupBodyStorage(c) })
+	return c
+}
+
+func requestBodyBytes(t *testing.T, c *gin.Context) []byte {
+	t.Helper()
+	storage, err := common.GetBodyStorage(c)
+	require.NoError(t, err)
+	body, err := storage.Bytes()
+	require.NoError(t, err)
+	return body
+}
+
+func TestApplyModelSplitRewritesGeminiPath(t *testing.T) {
+	useModelSplitAlias(t)
+	c := newModelSplitContext(t, "/v1beta/models/chat-default:generateContent", "application/json", []byte(`{"contents":[]}`))
+	c.Params = gin.Params{{Key: "path", Value: "/chat-default:generateContent"}}
+	c.Set("relay_mode", relayconstant.RelayModeGemini)
+
+	modelRequest := &ModelRequest{Model: "chat-default"}
+	applyModelSplit(c, modelRequest)
+	assert.Equal(t, "gemini-x", modelRequest.Model)
+	assert.Equal(t, "/v1beta/models/gemini-x:generateContent", c.Request.URL.Path)
+	assert.Equal(t, "/gemini-x:generateContent", c.Param("path"))
+}
+
+func TestApplyModelSplitRewritesMultipartForm(t *testing.T) {
+	useModelSplitAlias(t)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("model", "chat-default"))
+	require.NoError(t, writer.WriteField("prompt", "a cat"))
+	file, err := writer.CreateFormFile("image", "cat.png")
+	require.NoError(t, err)
+	_, err = file.Write([]byte("png-bytes"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	c := newModelSplitContext(t, "/v1/images/edits", writer.FormDataContentType(), body.Bytes())
+
+	modelRequest := &ModelRequest{Model: "chat-default"}
+	applyModelSplit(c, modelRequest)
+	assert.Equal(t, "gemini-x", modelRequest.Model)
+
+	form, err := common.ParseMultipartFormReusable(c)
+	require.NoError(t, err)
+	defer form.RemoveAll()
+	assert.Equal(t, []string{"gemini-x"}, form.Value["model"])
+	assert.Equal(t, []string{"a cat"}, form.Value["prompt"])
+	require.Len(t, form.File["image"], 1)
+	assert.Equal(t, "cat.png", form.File["image"][0].Filename)
+}
+
+func TestApplyModelSplitSkipsUnrewritableRequests(t *testing.T) {
+	useModelSplitAlias(t)
+	c := newModelSplitContext(t, "/v1/audio/speech", "application/octet-stream", []byte("raw"))
+
+	modelRequest := &ModelRequest{Model: "chat-default"}
+	applyModelSplit(c, modelRequest)
+	assert.Equal(t, "chat-default", modelRequest.Model, "the alias is kept when it cannot be rewritten")
+	assert.Empty(t, common.GetContextKeyString(c, constant.ContextKeyModelSplitAlias))
+	assert.Equal(t, []byte("raw"), requestBodyBytes(t, c))
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const scimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+// SCIMAuth authenticates SCIM provisioning requests with the bearer token
+// configured in the scim settings. Failures use the SCIM error format so the
+// IdP can surface them.
+func SCIMAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := system_setting.GetSCIMSettings()
+		if !settings.Enabled {
+			abortSCIM(c, http.StatusNotFound, "SCIM provisioning is disabled")
+			return
+		}
+		scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || !settings.VerifyToken(strings.TrimSpace(token)) {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			abortSCIM(c, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortSCIM(c *gin.Context, status int, detail string) {
+	c.Header("Content-Type", "application/scim+json")
+	c.AbortWithStatusJSON(status, gin.H{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	})
+}
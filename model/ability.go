@@ -3,12 +3,13 @@ package model
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
-	"github.com/QuantumNous/new-api/relaykit/dto"
 
 	"github.com/samber/lo"
 	"gorm.io/gorm"
@@ -60,68 +61,20 @@ func GetAllEnableAbilities() []Ability {
 	return abilities
 }
 
-func getPriority(group string, model string, retry int) (int, error) {
-
-	var priorities []int
-	err := DB.Model(&Ability{}).
-		Select("DISTINCT(priority)").
-		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).
-		Order("priority DESC").              // 按优先级降序排序
-		Pluck("priority", &priorities).Error // Pluck用于将查询的结果直接扫描到一个切片中
-
-	if err != nil {
-		// 处理错误
-		return 0, err
-	}
-
-	if len(priorities) == 0 {
-		// 如果没有查询到优先级，则返回错误
-		return 0, errors.New("数据库一致性被破坏")
-	}
-
-	// 确定要使用的优先级
-	var priorityToUse int
-	if retry >= len(priorities) {
-		// 如果重试次数大于优先级数，则使用最小的优先级
-		priorityToUse = priorities[len(priorities)-1]
-	} else {
-		priorityToUse = priorities[retry]
-	}
-	return priorityToUse, nil
-}
-
-func getChannelQuery(group string, model string, retry int) (*gorm.DB, error) {
-	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true)
-	channelQuery := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = (?)", group, model, true, maxPrioritySubQuery)
-	if retry != 0 {
-		priority, err := getPriority(group, model, retry)
-		if err != nil {
-			return nil, err
-		} else {
-			channelQuery = DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = ?", group, model, true, priority)
-		}
-	}
-
-	return channelQuery, nil
-}
-
+// GetChannel selects a channel from the abilities table when the memory cache
+// is off. Like the memory cache path, candidates are filtered by request path
+// and schedule before the priority tier for retry is chosen, so an off-window
+// top tier falls through to the next one.
 func GetChannel(group string, model string, retry int, requestPath string) (*Channel, error) {
 	var abilities []Ability
-
-	var err error = nil
-	channelQuery, err := getChannelQuery(group, model, retry)
-	if err != nil {
-		return nil, err
-	}
-	if common.UsingMainDatabase(common.DatabaseTypeSQLite) || common.UsingMainDatabase(common.DatabaseTypePostgreSQL) {
-		err = channelQuery.Order("weight DESC").Find(&abilities).Error
-	} else {
-		err = channelQuery.Order("weight DESC").Find(&abilities).Error
-	}
+	err := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).
+		Order("priority DESC, weight DESC").
+		Find(&abilities).Error
 	if err != nil {
 		return nil, err
 	}
-	abilities = filterAbilitiesByRequestPathAndModel(abilities, requestPath, model)
+	abilities = filterAbilitiesForSelection(abilities, requestPath, model, time.Now())
+	abilities = abilitiesAtRetryPriority(abilities, retry)
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
@@ -146,51 +99,69 @@ func GetChannel(group string, model string, retry int, requestPath string) (*Cha
 	return &channel, err
 }
 
-// filterAbilitiesByRequestPathAndModel restricts candidates by request path and
-// model for the DB (non-memory-cache) selection path. Only Advanced Custom
-// (type 58) channels are path-checked: kept only when one of their routes matches
-// requestPath and model; all other channel types always pass. When requestPath is
-// empty, filtering is skipped.
-func filterAbilitiesByRequestPathAndModel(abilities []Ability, requestPath string, model string) []Ability {
-	if requestPath == "" || len(abilities) == 0 {
+// abilitiesAtRetryPriority keeps the abilities of the priority tier used for
+// the given retry; retries beyond the number of tiers stay on the lowest one.
+func abilitiesAtRetryPriority(abilities []Ability, retry int) []Ability {
+	if len(abilities) == 0 {
 		return abilities
 	}
+	priorities := lo.Uniq(lo.Map(abilities, func(a Ability, _ int) int64 { return lo.FromPtr(a.Priority) }))
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+	if retry >= len(priorities) {
+		retry = len(priorities) - 1
+	}
+	target := priorities[retry]
+	return lo.Filter(abilities, func(a Ability, _ int) bool {
+		return lo.FromPtr(a.Priority) == target
+	})
+}
 
-	channelIds := make([]int, 0, len(abilities))
-	seen := make(map[int]struct{}, len(abilities))
-	for _, ability := range abilities {
-		if _, ok := seen[ability.ChannelId]; ok {
-			continue
-		}
-		seen[ability.ChannelId] = struct{}{}
-		channelIds = append(channelIds, ability.ChannelId)
+// filterAbilitiesForSelection restricts candidates for the DB (non-memory-cache)
+// selection path with a single channel lookup:
+//   - Advanced Custom (type 58) channels are kept only when one of their routes
+//     matches requestPath and model; when requestPath is empty, this check is skipped.
+//   - Channels with an availability schedule that does not cover now are dropped.
+func filterAbilitiesForSelection(abilities []Ability, requestPath string, model string, now time.Time) []Ability {
+	if len(abilities) == 0 {
+		return abilities
 	}
+	channelIds := lo.Uniq(lo.Map(abilities, func(a Ability, _ int) int { return a.ChannelId }))
 
 	var channels []*Channel
-	if err := DB.Where("id IN ?", channelIds).Find(&channels).Error; err != nil {
+	if err := DB.Select("id", "type", "setting", "settings").Where("id IN ?", channelIds).Find(&channels).Error; err != nil {
 		// On error, fall back to unfiltered candidates to avoid blocking selection
 		return abilities
 	}
 
-	advancedConfigs := make(map[int]*dto.AdvancedCustomConfig)
+	excluded := make(map[int]struct{})
 	for _, channel := range channels {
-		if channel.Type == constant.ChannelTypeAdvancedCustom {
-			advancedConfigs[channel.Id] = channel.GetOtherSettings().AdvancedCustom
-		}
-	}
-
-	filtered := make([]Ability, 0, len(abilities))
-	for _, ability := range abilities {
-		config, isAdvancedCustom := advancedConfigs[ability.ChannelId]
-		if !isAdvancedCustom {
-			filtered = append(filtered, ability)
+		if !channel.GetCompiledSchedule().ActiveAt(now) {
+			excluded[channel.Id] = struct{}{}
 			continue
 		}
-		if config != nil && config.SupportsPathForModel(requestPath, model) {
-			filtered = append(filtered, ability)
+		if requestPath != "" && channel.Type == constant.ChannelTypeAdvancedCustom {
+			config := channel.GetOtherSettings().AdvancedCustom
+			if config == nil || !config.SupportsPathForModel(requestPath, model) {
+				excluded[channel.Id] = struct{}{}
+			}
 		}
 	}
-	return filtered
+	if len(excluded) == 0 {
+		return abilities
+	}
+	return lo.Filter(abilities, func(a Ability, _ int) bool {
+		_, skip := excluded[a.ChannelId]
+		return !skip
+	})
+}
+
+// isChannelScheduledAtDB reports whether the stored schedule of channelId covers now.
+func isChannelScheduledAtDB(channelId int, now time.Time) bool {
+	channel := Channel{}
+	if err := DB.Select("id", "setting").First(&channel, "id = ?", channelId).Error; err != nil {
+		return true
+	}
+	return channel.GetCompiledSchedule().ActiveAt(now)
 }
 
 func (channel *Channel) AddAbilities(tx *gorm.DB) error {
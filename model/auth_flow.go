@@ -22,6 +22,9 @@ const (
 	AuthFlowPurposePasskeyStepUp     = "passkey_step_up"
 	AuthFlowPurposeTelegramBind      = "telegram_bind"
 	AuthFlowPurposeTelegramAssertion = "telegram_assertion"
+	AuthFlowPurposeSAML              = "saml"
+	AuthFlowPurposeSAMLLogin         = "saml_login"
+	AuthFlowPurposeSAMLAssertion     = "saml_assertion"
 	AuthFlowIntentLogin              = "login"
 	AuthFlowIntentBind               = "bind"
 	AuthFlowTokenBytes               = 32
@@ -14,6 +14,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/relaykit/dto"
 	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/samber/lo"
 	"gorm.io/gorm"
@@ -23,7 +24,7 @@ import (
 type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"not null"`
+	Key                string  `json:"key" gorm:"not null;serializer:channel_secret"`
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -282,6 +283,43 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	}
 }
 
+// GetStickyEnabledKey picks an enabled key by seed instead of the channel's
+// multi-key mode, so callers with the same seed keep landing on the same key.
+func (channel *Channel) GetStickyEnabledKey(seed uint64) (string, int, *types.NewAPIError) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.Key, 0, nil
+	}
+	keys := channel.GetKeys()
+	enabledIdx := make([]int, 0, len(keys))
+	for i := range keys {
+		status, ok := channel.ChannelInfo.MultiKeyStatusList[i]
+		if !ok || status == common.ChannelStatusEnabled {
+			enabledIdx = append(enabledIdx, i)
+		}
+	}
+	if len(enabledIdx) == 0 {
+		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
+	}
+	selectedIdx := enabledIdx[seed%uint64(len(enabledIdx))]
+	return keys[selectedIdx], selectedIdx, nil
+}
+
+// GetEnabledKeyByIndex returns the key at index when it is still enabled, for
+// requests bound to upstream state that only exists under one key.
+func (channel *Channel) GetEnabledKeyByIndex(index int) (string, int, *types.NewAPIError) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.Key, 0, nil
+	}
+	keys := channel.GetKeys()
+	if index < 0 || index >= len(keys) {
+		return "", 0, types.NewError(fmt.Errorf("key index %d out of range", index), types.ErrorCodeChannelNoAvailableKey)
+	}
+	if status, ok := channel.ChannelInfo.MultiKeyStatusList[index]; ok && status != common.ChannelStatusEnabled {
+		return "", 0, types.NewError(fmt.Errorf("key index %d is disabled", index), types.ErrorCodeChannelNoAvailableKey)
+	}
+	return keys[index], index, nil
+}
+
 func (channel *Channel) SaveChannelInfo() error {
 	return DB.Model(channel).Update("channel_info", channel.ChannelInfo).Error
 }
@@ -375,6 +413,14 @@ func GetAllChannels(startIdx int, num int, selectAll bool, idSort bool, sortOpti
 	return channels, err
 }
 
+// GetChannelsWithProxyPool returns the id and setting of the channels whose
+// setting may configure a proxy pool.
+func GetChannelsWithProxyPool() ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Select("id", "setting").Where("setting LIKE ?", "%proxy_pool%").Find(&channels).Error
+	return channels, err
+}
+
 func GetChannelsByTag(tag string, idSort bool, selectAll bool, sortOptions ...ChannelSortOptions) ([]*Channel, error) {
 	var channels []*Channel
 	order := resolveChannelSortOptions(idSort, sortOptions)
@@ -407,8 +453,11 @@ func SearchChannels(keyword string, group string, model string, idSort bool, sor
 	baseQuery := DB.Model(&Channel{}).Omit("key")
 
 	// 构造WHERE子句
-	whereClause := "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-	args := []any{common.String2Int(keyword), "%" + keyword + "%", keyword, "%" + keyword + "%", "%" + model + "%"}
+	keyClause, keyArgs := channelKeySearchCondition(keyword)
+	whereClause := "(id = ? OR name LIKE ? OR " + keyClause + " OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
+	args := []any{common.String2Int(keyword), "%" + keyword + "%"}
+	args = append(args, keyArgs...)
+	args = append(args, "%"+keyword+"%", "%"+model+"%")
 	baseQuery = ApplyChannelGroupFilter(baseQuery.Where(whereClause, args...), group)
 
 	// 执行查询
@@ -934,8 +983,11 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 	baseQuery := DB.Model(&Channel{}).Omit("key")
 
 	// 构造WHERE子句
-	whereClause := "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-	args := []any{common.String2Int(keyword), "%" + keyword + "%", keyword, "%" + keyword + "%", "%" + model + "%"}
+	keyClause, keyArgs := channelKeySearchCondition(keyword)
+	whereClause := "(id = ? OR name LIKE ? OR " + keyClause + " OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
+	args := []any{common.String2Int(keyword), "%" + keyword + "%"}
+	args = append(args, keyArgs...)
+	args = append(args, "%"+keyword+"%", "%"+model+"%")
 	baseQuery = ApplyChannelGroupFilter(baseQuery.Where(whereClause, args...), group)
 
 	subQuery := baseQuery.
@@ -968,6 +1020,30 @@ func (channel *Channel) ValidateSettings() error {
 	if err := channelParams.ValidateHTTPTransport(); err != nil {
 		return err
 	}
+	if err := channelParams.ValidateSameChannelRetry(); err != nil {
+		return err
+	}
+	if _, err := channelParams.Schedule.Compile(); err != nil {
+		return err
+	}
+	if err := channelParams.ValidateProxyPool(); err != nil {
+		return err
+	}
+	if err := channelParams.ValidateResponseOverride(); err != nil {
+		return err
+	}
+	if pool := channelParams.ProxyPool; pool != nil {
+		if name := strings.TrimSpace(pool.Name); name != "" {
+			if _, ok := system_setting.GetProxyPoolSetting().FindProxyPool(name); !ok {
+				return fmt.Errorf("proxy pool not found: %s", name)
+			}
+		}
+		for _, proxyURL := range pool.Proxies {
+			if _, err := common.ParseProxyURLStrict(proxyURL); err != nil {
+				return fmt.Errorf("invalid channel proxy pool: %w", err)
+			}
+		}
+	}
 	channelOtherSettings := &dto.ChannelOtherSettings{}
 	if channel.OtherSettings != "" {
 		err := common.UnmarshalJsonStr(channel.OtherSettings, channelOtherSettings)
@@ -1006,6 +1082,26 @@ func (channel *Channel) GetSetting() dto.ChannelSettings {
 	return setting
 }
 
+// GetCompiledSchedule returns the channel's compiled availability schedule, or
+// nil when the channel has none. An invalid stored schedule is logged and
+// ignored so that a bad setting never silently removes a channel from rotation.
+// Unlike GetSetting it never writes back, so it is safe on partially loaded rows.
+func (channel *Channel) GetCompiledSchedule() *dto.CompiledChannelSchedule {
+	if channel.Setting == nil || *channel.Setting == "" {
+		return nil
+	}
+	setting := dto.ChannelSettings{}
+	if err := common.Unmarshal([]byte(*channel.Setting), &setting); err != nil || setting.Schedule == nil {
+		return nil
+	}
+	schedule, err := setting.Schedule.Compile()
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to compile channel schedule: channel_id=%d, error=%v", channel.Id, err))
+		return nil
+	}
+	return schedule
+}
+
 func (channel *Channel) SetSetting(setting dto.ChannelSettings) {
 	settingBytes, err := common.Marshal(setting)
 	if err != nil {
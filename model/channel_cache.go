@@ -21,6 +21,10 @@ var channelsIDM map[int]*Channel                     // all channels include dis
 // channel2advancedCustomConfig caches parsed Advanced Custom (type 58) configs so
 // path-aware selection avoids re-parsing JSON per request. Refreshed on full sync.
 var channel2advancedCustomConfig map[int]*dto.AdvancedCustomConfig
+
+// channel2schedule caches compiled availability schedules for channels that
+// define one. Channels absent from the map are always available.
+var channel2schedule map[int]*dto.CompiledChannelSchedule
 var channelSyncLock sync.RWMutex
 
 func InitChannelCache() {
@@ -30,6 +34,7 @@ func InitChannelCache() {
 	}
 	newChannelId2channel := make(map[int]*Channel)
 	newChannel2advancedCustomConfig := make(map[int]*dto.AdvancedCustomConfig)
+	newChannel2schedule := make(map[int]*dto.CompiledChannelSchedule)
 	var channels []*Channel
 	DB.Find(&channels)
 	for _, channel := range channels {
@@ -39,6 +44,9 @@ func InitChannelCache() {
 				newChannel2advancedCustomConfig[channel.Id] = config
 			}
 		}
+		if schedule := channel.GetCompiledSchedule(); schedule != nil {
+			newChannel2schedule[channel.Id] = schedule
+		}
 	}
 	var abilities []*Ability
 	DB.Find(&abilities)
@@ -94,6 +102,7 @@ func InitChannelCache() {
 	}
 	channelsIDM = newChannelId2channel
 	channel2advancedCustomConfig = newChannel2advancedCustomConfig
+	channel2schedule = newChannel2schedule
 	channelSyncLock.Unlock()
 	// Lock ordering: InvalidatePricingCache acquires updatePricingLock, and
 	// GetPricing (holding updatePricingLock) nests channelSyncLock.RLock via
@@ -120,13 +129,15 @@ func GetRandomSatisfiedChannel(group string, model string, retry int, requestPat
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
 
+	now := time.Now()
+
 	// First, try to find channels with the exact model name.
-	channels := filterChannelsByRequestPathAndModel(group2model2channels[group][model], requestPath, model)
+	channels := filterChannelsBySchedule(filterChannelsByRequestPathAndModel(group2model2channels[group][model], requestPath, model), now)
 
 	// If no channels found, try to find channels with the normalized model name.
 	if len(channels) == 0 {
 		normalizedModel := ratio_setting.FormatMatchingModelName(model)
-		channels = filterChannelsByRequestPathAndModel(group2model2channels[group][normalizedModel], requestPath, model)
+		channels = filterChannelsBySchedule(filterChannelsByRequestPathAndModel(group2model2channels[group][normalizedModel], requestPath, model), now)
 	}
 
 	if len(channels) == 0 {
@@ -236,6 +247,30 @@ func filterChannelsByRequestPathAndModel(channels []int, requestPath string, mod
 	return filtered
 }
 
+// filterChannelsBySchedule drops channels whose availability schedule does not
+// cover now. Caller must hold channelSyncLock (read lock). The cached slice is
+// never mutated, and is returned as-is when no channel defines a schedule.
+func filterChannelsBySchedule(channels []int, now time.Time) []int {
+	if len(channel2schedule) == 0 || len(channels) == 0 {
+		return channels
+	}
+	filtered := make([]int, 0, len(channels))
+	for _, channelId := range channels {
+		if schedule, ok := channel2schedule[channelId]; ok && !schedule.ActiveAt(now) {
+			continue
+		}
+		filtered = append(filtered, channelId)
+	}
+	return filtered
+}
+
+// isChannelScheduledAt reports whether the cached schedule of channelId covers now.
+// Caller must hold channelSyncLock (read lock).
+func isChannelScheduledAt(channelId int, now time.Time) bool {
+	schedule, ok := channel2schedule[channelId]
+	return !ok || schedule.ActiveAt(now)
+}
+
 func CacheGetChannel(id int) (*Channel, error) {
 	if !common.MemoryCacheEnabled {
 		return GetChannelById(id, true)
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 )
@@ -19,6 +21,9 @@ func IsChannelEnabledForGroupModel(group string, modelName string, channelID int
 	if group2model2channels == nil {
 		return false
 	}
+	if !isChannelScheduledAt(channelID, time.Now()) {
+		return false
+	}
 
 	if isChannelIDInList(group2model2channels[group][modelName], channelID) {
 		return true
@@ -48,7 +53,7 @@ func isChannelEnabledForGroupModelDB(group string, modelName string, channelID i
 		Where(commonGroupCol+" = ? and model = ? and channel_id = ? and enabled = ?", group, modelName, channelID, true).
 		Count(&count).Error
 	if err == nil && count > 0 {
-		return true
+		return isChannelScheduledAtDB(channelID, time.Now())
 	}
 	normalized := ratio_setting.FormatMatchingModelName(modelName)
 	if normalized == "" || normalized == modelName {
@@ -58,7 +63,7 @@ func isChannelEnabledForGroupModelDB(group string, modelName string, channelID i
 	err = DB.Model(&Ability{}).
 		Where(commonGroupCol+" = ? and model = ? and channel_id = ? and enabled = ?", group, normalized, channelID, true).
 		Count(&count).Error
-	return err == nil && count > 0
+	return err == nil && count > 0 && isChannelScheduledAtDB(channelID, time.Now())
 }
 
 func isChannelIDInList(list []int, channelID int) bool {
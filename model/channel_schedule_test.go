@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertScheduledChannel(t *testing.T, channelID int, schedule *dto.ChannelSchedule) {
+	t.Helper()
+	insertScheduledChannelWithPriority(t, channelID, 0, schedule)
+}
+
+func insertScheduledChannelWithPriority(t *testing.T, channelID int, priority int64, schedule *dto.ChannelSchedule) {
+	t.Helper()
+	channel := &Channel{
+		Id:       channelID,
+		Key:      fmt.Sprintf("key-%d", channelID),
+		Status:   common.ChannelStatusEnabled,
+		Name:     fmt.Sprintf("channel-%d", channelID),
+		Group:    "default",
+		Models:   "scheduled-model",
+		Priority: &priority,
+	}
+	channel.SetSetting(dto.ChannelSettings{Schedule: schedule})
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, channel.AddAbilities(nil))
+}
+
+// offWindowSchedule returns a schedule whose only window is twelve hours away from now.
+func offWindowSchedule() *dto.ChannelSchedule {
+	hour := (time.Now().UTC().Hour() + 12) % 24
+	return &dto.ChannelSchedule{Timezone: "UTC", Windows: []string{fmt.Sprintf("* %d * * *", hour)}}
+}
+
+func TestGetRandomSatisfiedChannelRespectsSchedule(t *testing.T) {
+	for _, memoryCache := range []bool{true, false} {
+		t.Run(fmt.Sprintf("memory_cache=%v", memoryCache), func(t *testing.T) {
+			resetPricingEndpointTestTables(t)
+			common.MemoryCacheEnabled = memoryCache
+
+			insertScheduledChannel(t, 201, offWindowSchedule())
+			insertScheduledChannel(t, 202, &dto.ChannelSchedule{Windows: []string{"* * * * *"}})
+			InitChannelCache()
+
+			for i := 0; i < 20; i++ {
+				channel, err := GetRandomSatisfiedChannel("default", "scheduled-model", 0, "")
+				require.NoError(t, err)
+				require.NotNil(t, channel)
+				assert.Equal(t, 202, channel.Id)
+			}
+			assert.False(t, IsChannelEnabledForGroupModel("default", "scheduled-model", 201))
+			assert.True(t, IsChannelEnabledForGroupModel("default", "scheduled-model", 202))
+		})
+	}
+}
+
+func TestGetRandomSatisfiedChannelAllOffWindow(t *testing.T) {
+	resetPricingEndpointTestTables(t)
+
+	insertScheduledChannel(t, 211, offWindowSchedule())
+	InitChannelCache()
+
+	channel, err := GetRandomSatisfiedChannel("default", "scheduled-model", 0, "")
+	require.NoError(t, err)
+	assert.Nil(t, channel)
+}
+
+func TestGetRandomSatisfiedChannelScheduleFallsThroughPriorities(t *testing.T) {
+	for _, memoryCache := range []bool{true, false} {
+		t.Run(fmt.Sprintf("memory_cache=%v", memoryCache), func(t *testing.T) {
+			resetPricingEndpointTestTables(t)
+			common.MemoryCacheEnabled = memoryCache
+
+			insertScheduledChannelWithPriority(t, 221, 10, offWindowSchedule())
+			insertScheduledChannelWithPriority(t, 222, 5, nil)
+			insertScheduledChannelWithPriority(t, 223, 0, nil)
+			InitChannelCache()
+
+			for i := 0; i < 20; i++ {
+				channel, err := GetRandomSatisfiedChannel("default", "scheduled-model", 0, "")
+				require.NoError(t, err)
+				require.NotNil(t, channel)
+				assert.Equal(t, 222, channel.Id, "off-window top tier falls through to the next one")
+			}
+			channel, err := GetRandomSatisfiedChannel("default", "scheduled-model", 1, "")
+			require.NoError(t, err)
+			require.NotNil(t, channel)
+			assert.Equal(t, 223, channel.Id, "retries walk the in-window tiers")
+		})
+	}
+}
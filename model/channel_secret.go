@@ -0,0 +1,125 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/schema"
+)
+
+// channelSecretSerializer 渠道密钥的字段序列化器：写入数据库时加密，读取时解密。
+// 明文只存在于内存（渠道缓存、适配器构造请求），数据库中保存的是密文。
+// 注意：Update("key", v) / Updates(map) 不经过序列化器，需改用 UpdateChannelKey。
+type channelSecretSerializer struct{}
+
+func init() {
+	schema.RegisterSerializer("channel_secret", channelSecretSerializer{})
+}
+
+func (channelSecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("unsupported channel key value type %T", dbValue)
+	}
+	plaintext, err := common.DecryptSecret(stored)
+	if err != nil {
+		// 解密失败时保留密文，避免整批渠道加载失败；该渠道请求上游时会因密钥无效而报错
+		common.SysError(fmt.Sprintf("failed to decrypt channel key: %s", err.Error()))
+		plaintext = stored
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (channelSecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, _ := fieldValue.(string)
+	return common.EncryptSecret(plaintext)
+}
+
+// UpdateChannelKey replaces the stored key of a channel. Column updates bypass
+// the field serializer, so the key is encrypted here.
+func UpdateChannelKey(id int, key string) error {
+	stored, err := common.EncryptSecret(key)
+	if err != nil {
+		return err
+	}
+	return DB.Model(&Channel{}).Where("id = ?", id).Update("key", stored).Error
+}
+
+// ChannelKeyRotationBatch re-encrypts up to limit channel keys with id greater
+// than afterId that are still plaintext or use an older master key. It returns
+// the last scanned id, the number of scanned rows and the number of updated rows.
+func ChannelKeyRotationBatch(afterId int, limit int) (lastId int, scanned int, rotated int, err error) {
+	// 使用不带序列化器的结构读取，拿到数据库中的原始值
+	var rows []struct {
+		Id  int
+		Key string
+	}
+	err = DB.Model(&Channel{}).Select("id", "key").Where("id > ?", afterId).Order("id asc").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return afterId, 0, 0, err
+	}
+	lastId = afterId
+	latest := common.LatestSecretKeyVersion()
+	for _, row := range rows {
+		lastId = row.Id
+		scanned++
+		if row.Key == "" || common.SecretKeyVersion(row.Key) == latest {
+			continue
+		}
+		plaintext, decryptErr := common.DecryptSecret(row.Key)
+		if decryptErr != nil {
+			return lastId, scanned, rotated, fmt.Errorf("channel #%d: %w", row.Id, decryptErr)
+		}
+		stored, encryptErr := common.EncryptSecret(plaintext)
+		if encryptErr != nil {
+			return lastId, scanned, rotated, encryptErr
+		}
+		// 以原值为条件更新，期间被管理员修改过的渠道保持新值不变
+		result := DB.Model(&Channel{}).Where(map[string]interface{}{"id": row.Id, "key": row.Key}).Update("key", stored)
+		if result.Error != nil {
+			return lastId, scanned, rotated, result.Error
+		}
+		rotated += int(result.RowsAffected)
+	}
+	return lastId, scanned, rotated, nil
+}
+
+// channelKeySearchCondition returns the exact key match of a channel search.
+// Encrypted keys cannot be compared in SQL, so with encryption enabled the
+// keyword is matched against the decrypted keys of the channel cache instead;
+// without the memory cache nothing matches by key.
+func channelKeySearchCondition(keyword string) (string, []any) {
+	if !common.SecretEncryptionEnabled() {
+		return commonKeyCol + " = ?", []any{keyword}
+	}
+	ids := cachedChannelIdsByKey(keyword)
+	if len(ids) == 0 {
+		return "1 = 0", nil
+	}
+	return "id IN ?", []any{ids}
+}
+
+func cachedChannelIdsByKey(key string) []int {
+	if key == "" || !common.MemoryCacheEnabled {
+		return nil
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	var ids []int
+	for id, channel := range channelsIDM {
+		if channel.Key == key {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
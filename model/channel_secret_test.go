@@ -0,0 +1,92 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func storedChannelKey(t *testing.T, id int) string {
+	var row struct{ Key string }
+	require.NoError(t, DB.Model(&Channel{}).Select("key").Where("id = ?", id).Find(&row).Error)
+	return row.Key
+}
+
+func TestChannelKeyEncryptedAtRest(t *testing.T) {
+	setupChannelStatusTest(t)
+	t.Cleanup(func() { common.SetSecretMasterKeys(nil) })
+
+	legacy := Channel{Name: "legacy", Key: "sk-legacy"}
+	require.NoError(t, DB.Create(&legacy).Error)
+	require.Equal(t, "sk-legacy", storedChannelKey(t, legacy.Id))
+
+	common.SetSecretMasterKeys(map[int][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	channel := Channel{Name: "encrypted", Key: "sk-one"}
+	require.NoError(t, DB.Create(&channel).Error)
+	stored := storedChannelKey(t, channel.Id)
+	require.Equal(t, 1, common.SecretKeyVersion(stored))
+	require.Equal(t, "sk-one", channel.Key)
+
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-one", loaded.Key)
+	loaded, err = GetChannelById(legacy.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-legacy", loaded.Key)
+
+	require.NoError(t, UpdateChannelKey(channel.Id, "sk-two"))
+	require.Equal(t, 1, common.SecretKeyVersion(storedChannelKey(t, channel.Id)))
+	loaded, err = GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-two", loaded.Key)
+
+	// 轮换：明文与旧版本密文都改用最新主密钥
+	common.SetSecretMasterKeys(map[int][]byte{1: bytes.Repeat([]byte{1}, 32), 2: bytes.Repeat([]byte{2}, 32)})
+	lastId, scanned, rotated, err := ChannelKeyRotationBatch(0, 100)
+	require.NoError(t, err)
+	require.Equal(t, channel.Id, lastId)
+	require.Equal(t, 2, scanned)
+	require.Equal(t, 2, rotated)
+	require.Equal(t, 2, common.SecretKeyVersion(storedChannelKey(t, legacy.Id)))
+	require.Equal(t, 2, common.SecretKeyVersion(storedChannelKey(t, channel.Id)))
+
+	_, _, rotated, err = ChannelKeyRotationBatch(0, 100)
+	require.NoError(t, err)
+	require.Zero(t, rotated)
+	loaded, err = GetChannelById(legacy.Id, true)
+	require.NoError(t, err)
+	require.Equal(t, "sk-legacy", loaded.Key)
+}
+
+func TestSearchChannelsByEncryptedKey(t *testing.T) {
+	setupChannelStatusTest(t)
+	t.Cleanup(func() { common.SetSecretMasterKeys(nil) })
+
+	common.SetSecretMasterKeys(map[int][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	channel := Channel{Name: "encrypted", Key: "sk-search", Models: "gpt-4o", Group: "default", Status: common.ChannelStatusEnabled}
+	require.NoError(t, DB.Create(&channel).Error)
+	require.NoError(t, channel.AddAbilities(nil))
+	other := Channel{Name: "other", Key: "sk-other", Models: "gpt-4o", Group: "default", Status: common.ChannelStatusEnabled}
+	require.NoError(t, DB.Create(&other).Error)
+	require.NoError(t, other.AddAbilities(nil))
+
+	// 不开启内存缓存时无法按加密后的密钥搜索，也不能把关键字与密文比较
+	channels, err := SearchChannels("sk-search", "", "", true)
+	require.NoError(t, err)
+	require.Empty(t, channels)
+
+	common.MemoryCacheEnabled = true
+	InitChannelCache()
+	channels, err = SearchChannels("sk-search", "", "", true)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	require.Equal(t, channel.Id, channels[0].Id)
+	require.Empty(t, channels[0].Key)
+
+	channels, err = SearchChannels("other", "", "", true)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	require.Equal(t, other.Id, channels[0].Id)
+}
@@ -57,6 +57,9 @@ func UserCheckin(userId int) (*Checkin, error) {
 	if !setting.Enabled {
 		return nil, errors.New("签到功能未启用")
 	}
+	if err := CheckResellerChildSelfFunding(userId); err != nil {
+		return nil, err
+	}
 
 	// 检查今天是否已签到
 	hasChecked, err := HasCheckedInToday(userId)
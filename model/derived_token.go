@@ -0,0 +1,122 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// DerivedToken 记录由父令牌签发的短期子令牌。子令牌本身是签名的 JWT，携带模型、
+// 权限范围与过期时间（见 service/derived_token.go）；这里只保存校验和计费需要的状态：
+// 所属父令牌、消费上限与已用额度。删除记录即吊销子令牌。
+// 子令牌的用量计入父令牌，UsedQuota 仅用于执行消费上限。
+type DerivedToken struct {
+	Id             string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	ParentTokenId  int    `json:"parent_token_id" gorm:"index"`
+	ParentTokenKey string `json:"-" gorm:"type:varchar(128)"` // 父令牌存储的 key，用于命中令牌缓存
+	UserId         int    `json:"user_id" gorm:"index"`
+	Name           string `json:"name" gorm:"type:varchar(64);default:''"`
+	SpendCap       int    `json:"spend_cap" gorm:"default:0"` // 消费上限，0 表示只受父令牌额度限制
+	UsedQuota      int    `json:"used_quota" gorm:"default:0"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	ExpiredTime    int64  `json:"expired_time" gorm:"bigint;index"`
+}
+
+// derivedTokenRetentionSeconds 过期子令牌记录保留一段时间，便于按日志中的子令牌 ID 追查用量。
+const derivedTokenRetentionSeconds = 7 * 24 * 3600
+
+func (token *DerivedToken) Insert() error {
+	return DB.Create(token).Error
+}
+
+func GetDerivedTokenById(id string) (*DerivedToken, error) {
+	if id == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var token DerivedToken
+	if err := DB.First(&token, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ValidateDerivedToken loads a derived token and its parent and checks that
+// both can still be used. The parent token is read through the token cache.
+func ValidateDerivedToken(id string, parentTokenId int) (*DerivedToken, *Token, error) {
+	derived, err := GetDerivedTokenById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrTokenInvalid
+		}
+		return nil, nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if derived.ParentTokenId != parentTokenId || derived.ExpiredTime < common.GetTimestamp() {
+		return derived, nil, ErrTokenInvalid
+	}
+	if derived.SpendCap > 0 && derived.UsedQuota >= derived.SpendCap {
+		return derived, nil, ErrTokenInvalid
+	}
+	parent, err := GetTokenByKey(derived.ParentTokenKey, false)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return derived, nil, ErrTokenInvalid
+		}
+		return derived, nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if parent.Id != derived.ParentTokenId {
+		return derived, nil, ErrTokenInvalid
+	}
+	return derived, parent, checkTokenUsable(parent)
+}
+
+// TryReserveDerivedTokenQuota atomically adds quota to the used quota of a
+// derived token, unless that would exceed its spend cap.
+func TryReserveDerivedTokenQuota(id string, quota int) (bool, error) {
+	if quota < 0 {
+		return false, errors.New("quota 不能为负数！")
+	}
+	if quota == 0 {
+		return true, nil
+	}
+	result := DB.Model(&DerivedToken{}).
+		Where("id = ? AND (spend_cap <= ? OR used_quota + ? <= spend_cap)", id, 0, quota).
+		Update("used_quota", gorm.Expr("used_quota + ?", quota))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// AdjustDerivedTokenQuota applies a settlement delta (positive to charge more,
+// negative to refund) to the used quota of a derived token.
+func AdjustDerivedTokenQuota(id string, delta int) error {
+	if id == "" || delta == 0 {
+		return nil
+	}
+	return DB.Model(&DerivedToken{}).Where("id = ?", id).
+		Update("used_quota", gorm.Expr("used_quota + ?", delta)).Error
+}
+
+// RevokeDerivedToken deletes a derived token of the given parent token.
+func RevokeDerivedToken(id string, parentTokenId int) (bool, error) {
+	result := DB.Where("id = ? AND parent_token_id = ?", id, parentTokenId).Delete(&DerivedToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetDerivedTokensByParent lists the unexpired derived tokens of a parent token.
+func GetDerivedTokensByParent(parentTokenId int) ([]*DerivedToken, error) {
+	var tokens []*DerivedToken
+	err := DB.Where("parent_token_id = ? AND expired_time >= ?", parentTokenId, common.GetTimestamp()).
+		Order("created_time desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteExpiredDerivedTokens removes derived tokens of a parent token that
+// expired longer ago than the retention period.
+func DeleteExpiredDerivedTokens(parentTokenId int) error {
+	return DB.Where("parent_token_id = ? AND expired_time < ?", parentTokenId, common.GetTimestamp()-derivedTokenRetentionSeconds).
+		Delete(&DerivedToken{}).Error
+}
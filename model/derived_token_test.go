@@ -0,0 +1,80 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntersectTokenScopes(t *testing.T) {
+	assert.Nil(t, IntersectTokenScopes(nil, &TokenScopes{}))
+
+	parent := &TokenScopes{
+		Endpoints:       []string{TokenScopeEndpointChat, TokenScopeEndpointEmbeddings},
+		DeniedEndpoints: []string{TokenScopeEndpointImages},
+		MaxTokens:       4096,
+		DisableTools:    true,
+	}
+	child := &TokenScopes{
+		Endpoints:        []string{TokenScopeEndpointChat, TokenScopeEndpointAudio},
+		DeniedEndpoints:  []string{TokenScopeEndpointImages, TokenScopeEndpointRerank},
+		MaxTokens:        8192,
+		MaxRequestQuota:  500,
+		DisableWebSearch: true,
+	}
+	merged := IntersectTokenScopes(parent, child)
+	require.NotNil(t, merged)
+	assert.Equal(t, []string{TokenScopeEndpointChat}, merged.Endpoints)
+	assert.Equal(t, []string{TokenScopeEndpointImages, TokenScopeEndpointRerank}, merged.DeniedEndpoints)
+	assert.Equal(t, 4096, merged.MaxTokens)
+	assert.Equal(t, 500, merged.MaxRequestQuota)
+	assert.True(t, merged.DisableTools)
+	assert.True(t, merged.DisableWebSearch)
+
+	// 允许的接口没有交集时拒绝所有接口
+	disjoint := IntersectTokenScopes(parent, &TokenScopes{Endpoints: []string{TokenScopeEndpointAudio}})
+	require.NotNil(t, disjoint)
+	assert.False(t, disjoint.AllowsEndpoint(TokenScopeEndpointChat))
+	assert.False(t, disjoint.AllowsEndpoint(TokenScopeEndpointAudio))
+}
+
+func TestTryReserveDerivedTokenQuotaEnforcesSpendCap(t *testing.T) {
+	truncateTables(t)
+
+	now := common.GetTimestamp()
+	capped := &DerivedToken{Id: "derived-capped", ParentTokenId: 1, UserId: 1, SpendCap: 100, CreatedTime: now, ExpiredTime: now + 3600}
+	require.NoError(t, capped.Insert())
+
+	reserved, err := TryReserveDerivedTokenQuota(capped.Id, 60)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	reserved, err = TryReserveDerivedTokenQuota(capped.Id, 41)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+
+	require.NoError(t, AdjustDerivedTokenQuota(capped.Id, -20))
+	reserved, err = TryReserveDerivedTokenQuota(capped.Id, 60)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	reloaded, err := GetDerivedTokenById(capped.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 100, reloaded.UsedQuota)
+
+	uncapped := &DerivedToken{Id: "derived-uncapped", ParentTokenId: 1, UserId: 1, CreatedTime: now, ExpiredTime: now + 3600}
+	require.NoError(t, uncapped.Insert())
+	reserved, err = TryReserveDerivedTokenQuota(uncapped.Id, 1000000)
+	require.NoError(t, err)
+	assert.True(t, reserved, "spend cap 0 is only limited by the parent token")
+
+	revoked, err := RevokeDerivedToken(capped.Id, 2)
+	require.NoError(t, err)
+	assert.False(t, revoked, "only the parent token can revoke")
+	revoked, err = RevokeDerivedToken(capped.Id, 1)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	reserved, err = TryReserveDerivedTokenQuota(capped.Id, 1)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -10,7 +12,13 @@ import (
 	"gorm.io/gorm/clause"
 )
 
-const ExternalIdentityProviderTelegram = "telegram"
+const (
+	ExternalIdentityProviderTelegram = "telegram"
+	ExternalIdentityProviderLDAP     = "ldap"
+
+	// external_identity_claims.subject 为 varchar(128)，更长的主体以哈希存储
+	externalIdentitySubjectMaxLength = 128
+)
 
 var ErrExternalIdentityAlreadyClaimed = errors.New("external identity is already claimed")
 
@@ -67,6 +75,17 @@ func ClaimExternalIdentityWithTx(tx *gorm.DB, provider, subject string, userId i
 	return nil
 }
 
+// ExternalIdentitySubject normalizes a provider subject so it fits the
+// subject column; longer values are replaced by their SHA-256 digest.
+func ExternalIdentitySubject(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) <= externalIdentitySubjectMaxLength {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
 func ReleaseExternalIdentityWithTx(tx *gorm.DB, provider string, userId int) error {
 	provider = strings.TrimSpace(provider)
 	if tx == nil || provider == "" || userId == 0 {
@@ -76,6 +95,44 @@ func ReleaseExternalIdentityWithTx(tx *gorm.DB, provider string, userId int) err
 		Delete(&ExternalIdentityClaim{}).Error
 }
 
+// GetExternalIdentityOwner returns the user that claimed a provider subject.
+func GetExternalIdentityOwner(provider, subject string) (int, error) {
+	var claim ExternalIdentityClaim
+	if err := DB.Where("provider = ? AND subject = ?", provider, subject).First(&claim).Error; err != nil {
+		return 0, err
+	}
+	return claim.UserId, nil
+}
+
+// GetExternalIdentitiesByUserId lists a user's claims whose provider starts
+// with providerPrefix, e.g. "saml:".
+func GetExternalIdentitiesByUserId(userId int, providerPrefix string) ([]*ExternalIdentityClaim, error) {
+	var claims []*ExternalIdentityClaim
+	err := DB.Where("user_id = ? AND provider LIKE ?", userId, providerPrefix+"%").
+		Order("id asc").Find(&claims).Error
+	return claims, err
+}
+
+func CountExternalIdentities(provider string) (int64, error) {
+	var count int64
+	err := DB.Model(&ExternalIdentityClaim{}).Where("provider = ?", provider).Count(&count).Error
+	return count, err
+}
+
+// GetExternalIdentityClaimsAfter pages through a provider's claims by id.
+func GetExternalIdentityClaimsAfter(provider string, afterId int64, limit int) ([]*ExternalIdentityClaim, error) {
+	var claims []*ExternalIdentityClaim
+	err := DB.Where("provider = ? AND id > ?", provider, afterId).
+		Order("id asc").Limit(limit).Find(&claims).Error
+	return claims, err
+}
+
+func ReleaseExternalIdentity(provider string, userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return ReleaseExternalIdentityWithTx(tx, provider, userId)
+	})
+}
+
 func releaseAllExternalIdentitiesWithTx(tx *gorm.DB, userId int) error {
 	if tx == nil || userId == 0 {
 		return errors.New("external identity release is invalid")
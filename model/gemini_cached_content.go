@@ -0,0 +1,77 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// GeminiCachedContent remembers which channel and key own a Gemini/Vertex
+// context cache. Caches only exist on the upstream account that created them,
+// so generateContent calls referencing the cache must go back to the same key.
+type GeminiCachedContent struct {
+	Id int `json:"id" gorm:"primaryKey"`
+	// Name is the client-facing resource name, always "cachedContents/<id>".
+	Name string `json:"name" gorm:"type:varchar(191);uniqueIndex"`
+	// UpstreamName is the provider resource name; Vertex prefixes it with the
+	// project and location of the channel, which is never shown to clients.
+	UpstreamName string  `json:"-" gorm:"type:varchar(512)"`
+	UserId       int     `json:"user_id" gorm:"index"`
+	TokenId      int     `json:"token_id"`
+	ChannelId    int     `json:"channel_id" gorm:"index"`
+	KeyIndex     int     `json:"key_index"`
+	Group        string  `json:"group" gorm:"column:group;type:varchar(64)"`
+	GroupRatio   float64 `json:"group_ratio"` // 创建时冻结，延长和退款都按同一倍率结算
+	ModelName    string  `json:"model_name" gorm:"type:varchar(191)"`
+	DisplayName  string  `json:"display_name" gorm:"type:varchar(255)"`
+	TokenCount   int     `json:"token_count"`
+	ExpireTime   int64   `json:"expire_time" gorm:"bigint;index"`
+	BilledUntil  int64   `json:"billed_until" gorm:"bigint"` // 存储费已结算到的时间点
+	Quota        int     `json:"quota"`                      // 累计结算的存储费用
+	CreatedAt    int64   `json:"created_at" gorm:"bigint"`
+	UpdatedAt    int64   `json:"updated_at" gorm:"bigint"`
+
+	// 子账户所属转售商与加价倍率，与 GroupRatio 一同在创建时冻结，转售商按同一倍率结算平台价
+	ResellerId     int     `json:"-"`
+	ResellerMarkup float64 `json:"-"`
+}
+
+func (cache *GeminiCachedContent) Insert() error {
+	now := common.GetTimestamp()
+	cache.CreatedAt = now
+	cache.UpdatedAt = now
+	return DB.Create(cache).Error
+}
+
+func (cache *GeminiCachedContent) Update() error {
+	cache.UpdatedAt = common.GetTimestamp()
+	return DB.Save(cache).Error
+}
+
+func (cache *GeminiCachedContent) Delete() error {
+	return DB.Delete(cache).Error
+}
+
+// GetGeminiCachedContent returns the cache owned by userId, or (nil, nil) when
+// the name is unknown or belongs to someone else.
+func GetGeminiCachedContent(userId int, name string) (*GeminiCachedContent, error) {
+	var cache GeminiCachedContent
+	err := DB.Where("name = ? AND user_id = ?", name, userId).First(&cache).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// ListGeminiCachedContents lists the user's caches that have not expired yet.
+func ListGeminiCachedContents(userId int, offset int, limit int) ([]*GeminiCachedContent, error) {
+	var caches []*GeminiCachedContent
+	err := DB.Where("user_id = ? AND expire_time > ?", userId, common.GetTimestamp()).
+		Order("id desc").Offset(offset).Limit(limit).Find(&caches).Error
+	return caches, err
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/types"
 
@@ -279,12 +280,26 @@ func RecordTopupLog(userId int, content string, callerIp string, paymentMethod s
 	}
 }
 
+// withDerivedTokenId 记录发起请求的子令牌 ID，子令牌的用量记在父令牌名下。
+func withDerivedTokenId(c *gin.Context, other map[string]interface{}) map[string]interface{} {
+	derivedTokenId := common.GetContextKeyString(c, constant.ContextKeyDerivedTokenId)
+	if derivedTokenId == "" {
+		return other
+	}
+	if other == nil {
+		other = make(map[string]interface{})
+	}
+	other["derived_token_id"] = derivedTokenId
+	return other
+}
+
 func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string, tokenName string, content string, tokenId int, useTimeSeconds int,
 	isStream bool, group string, other map[string]interface{}) {
 	logger.LogInfo(c, fmt.Sprintf("record error log: userId=%d, channelId=%d, modelName=%s, tokenName=%s, content=%s", userId, channelId, modelName, tokenName, common.LocalLogPreview(content)))
 	username := c.GetString("username")
 	requestId := c.GetString(common.RequestIdKey)
 	upstreamRequestId := c.GetString(common.UpstreamRequestIdKey)
+	other = withDerivedTokenId(c, other)
 	otherStr := common.MapToJsonStr(other)
 	// 判断是否需要记录 IP
 	needRecordIp := false
@@ -349,6 +364,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 	requestId := c.GetString(common.RequestIdKey)
 	upstreamRequestId := c.GetString(common.UpstreamRequestIdKey)
 	createdAt := common.GetTimestamp()
+	params.Other = withDerivedTokenId(c, params.Other)
 	otherStr := common.MapToJsonStr(params.Other)
 	// 判断是否需要记录 IP
 	needRecordIp := false
@@ -735,3 +751,34 @@ func DeleteOldLogBatch(ctx context.Context, targetTimestamp int64, limit int) (i
 	}
 	return result.RowsAffected, nil
 }
+
+// ModelAliasLogStat aggregates consume logs of one split arm.
+type ModelAliasLogStat struct {
+	ModelName        string  `json:"model_name"`
+	RequestCount     int64   `json:"request_count"`
+	Quota            int64   `json:"quota"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	AvgUseTime       float64 `json:"avg_use_time"`
+}
+
+// GetModelAliasLogStats groups the consume logs tagged with a model split alias
+// by the concrete model that served them.
+func GetModelAliasLogStats(alias string, startTimestamp int64, endTimestamp int64) (stats []ModelAliasLogStat, err error) {
+	condition, pattern, err := buildLogLikeCondition("other", `%"model_alias":"`+alias+`"%`)
+	if err != nil {
+		return nil, err
+	}
+	tx := LOG_DB.Table("logs").
+		Select("model_name, count(*) request_count, COALESCE(sum(quota), 0) quota, COALESCE(sum(prompt_tokens), 0) prompt_tokens, COALESCE(sum(completion_tokens), 0) completion_tokens, COALESCE(avg(use_time), 0) avg_use_time").
+		Where("type = ?", LogTypeConsume).
+		Where(condition, pattern)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Group("model_name").Scan(&stats).Error
+	return stats, err
+}
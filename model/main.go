@@ -292,6 +292,16 @@ func migrateDB() error {
 		&SystemTaskLock{},
 		&CasbinRule{},
 		&AuthzRole{},
+		&ShadowTrafficRecord{},
+		&GeminiCachedContent{},
+		&PromptTemplate{},
+		&PromptTemplateVersion{},
+		&DerivedToken{},
+		&Organization{},
+		&OrganizationMember{},
+		&Reseller{},
+		&SAMLProvider{},
+		&SCIMUser{},
 	)
 	if err != nil {
 		return err
@@ -353,6 +363,16 @@ func migrateDBFast() error {
 		{&SystemInstance{}, "SystemInstance"},
 		{&SystemTask{}, "SystemTask"},
 		{&SystemTaskLock{}, "SystemTaskLock"},
+		{&ShadowTrafficRecord{}, "ShadowTrafficRecord"},
+		{&GeminiCachedContent{}, "GeminiCachedContent"},
+		{&PromptTemplate{}, "PromptTemplate"},
+		{&PromptTemplateVersion{}, "PromptTemplateVersion"},
+		{&DerivedToken{}, "DerivedToken"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&Reseller{}, "Reseller"},
+		{&SAMLProvider{}, "SAMLProvider"},
+		{&SCIMUser{}, "SCIMUser"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -0,0 +1,431 @@
+package model
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 组织成员角色
+const (
+	OrganizationRoleOwner     = "owner"     // 创建者，拥有全部权限，每个组织只有一个
+	OrganizationRoleAdmin     = "admin"     // 管理成员、额度上限与组织令牌
+	OrganizationRoleDeveloper = "developer" // 创建组织令牌并使用组织钱包
+	OrganizationRoleBilling   = "billing"   // 查看用量、为组织钱包充值，不能使用组织钱包
+)
+
+// 组织权限
+const (
+	OrganizationPermViewMembers   = "members.view"
+	OrganizationPermManageMembers = "members.manage"
+	OrganizationPermCreateTokens  = "tokens.create" // 创建自己的组织令牌，使用组织钱包
+	OrganizationPermManageTokens  = "tokens.manage" // 查看、删除所有成员的组织令牌
+	OrganizationPermViewUsage     = "usage.view"
+	OrganizationPermFund          = "wallet.fund"
+)
+
+var organizationRolePermissions = map[string][]string{
+	OrganizationRoleOwner: {
+		OrganizationPermViewMembers, OrganizationPermManageMembers, OrganizationPermCreateTokens,
+		OrganizationPermManageTokens, OrganizationPermViewUsage, OrganizationPermFund,
+	},
+	OrganizationRoleAdmin: {
+		OrganizationPermViewMembers, OrganizationPermManageMembers, OrganizationPermCreateTokens,
+		OrganizationPermManageTokens, OrganizationPermViewUsage,
+	},
+	OrganizationRoleDeveloper: {OrganizationPermCreateTokens},
+	OrganizationRoleBilling:   {OrganizationPermViewMembers, OrganizationPermViewUsage, OrganizationPermFund},
+}
+
+const (
+	OrganizationStatusEnabled  = 1
+	OrganizationStatusDisabled = 2
+)
+
+var ErrOrganizationNotFound = errors.New("organization not found")
+
+// Organization 组织拥有共享钱包，组织令牌（Token.OrgId）的请求从组织钱包扣费，
+// 用量仍计入创建令牌的成员名下。
+type Organization struct {
+	Id          int            `json:"id"`
+	Name        string         `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId     int            `json:"owner_id" gorm:"index"`
+	Status      int            `json:"status" gorm:"default:1"`
+	Quota       int            `json:"quota" gorm:"default:0"`      // 组织钱包余额
+	UsedQuota   int            `json:"used_quota" gorm:"default:0"` // 组织钱包累计消费
+	CreatedTime int64          `json:"created_time" gorm:"bigint"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// OrganizationMember 组织成员。QuotaCap 限制成员从组织钱包累计消费的额度，
+// UsedQuota 达到上限后该成员的组织令牌不能再发起请求，管理员可以调整上限或清零用量。
+type OrganizationMember struct {
+	Id          int    `json:"id"`
+	OrgId       int    `json:"org_id" gorm:"uniqueIndex:idx_org_member_user,priority:1"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_org_member_user,priority:2;index"`
+	Role        string `json:"role" gorm:"type:varchar(16)"`
+	QuotaCap    int    `json:"quota_cap" gorm:"default:0"` // 0 表示不限
+	UsedQuota   int    `json:"used_quota" gorm:"default:0"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	Username    string `json:"username" gorm:"-:all"`
+}
+
+// UserOrganization 是用户所在的组织及其角色。
+type UserOrganization struct {
+	Organization
+	Role          string `json:"role"`
+	QuotaCap      int    `json:"quota_cap"`
+	MemberUsed    int    `json:"member_used_quota"`
+	MemberCreated int64  `json:"joined_time"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	_, ok := organizationRolePermissions[role]
+	return ok
+}
+
+// OrganizationRoleAllows reports whether role grants permission.
+func OrganizationRoleAllows(role string, permission string) bool {
+	return slices.Contains(organizationRolePermissions[role], permission)
+}
+
+// CreateOrganization creates an organization with ownerId as its owner.
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	now := common.GetTimestamp()
+	org := &Organization{Name: name, OwnerId: ownerId, Status: OrganizationStatusEnabled, CreatedTime: now}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{OrgId: org.Id, UserId: ownerId, Role: OrganizationRoleOwner, CreatedTime: now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	var org Organization
+	if err := DB.First(&org, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	tx := DB.Model(&Organization{})
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+func (org *Organization) UpdateName(name string) error {
+	org.Name = name
+	return DB.Model(org).Update("name", name).Error
+}
+
+func UpdateOrganizationStatus(id int, status int) error {
+	return DB.Model(&Organization{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// GetOrganizationMember returns the membership of userId, or
+// gorm.ErrRecordNotFound when the user is not a member.
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	if err := DB.First(&member, "org_id = ? AND user_id = ?", orgId, userId).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("org_id = ?", orgId).Order("id asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+	var users []User
+	if len(userIds) > 0 {
+		if err := DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+			return nil, err
+		}
+	}
+	usernames := make(map[int]string, len(users))
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+	for _, member := range members {
+		member.Username = usernames[member.UserId]
+	}
+	return members, nil
+}
+
+// GetUserOrganizations lists the organizations userId belongs to.
+func GetUserOrganizations(userId int) ([]*UserOrganization, error) {
+	var members []OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	orgs := make([]*UserOrganization, 0, len(members))
+	for _, member := range members {
+		org, err := GetOrganizationById(member.OrgId)
+		if err != nil {
+			if errors.Is(err, ErrOrganizationNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		orgs = append(orgs, &UserOrganization{
+			Organization:  *org,
+			Role:          member.Role,
+			QuotaCap:      member.QuotaCap,
+			MemberUsed:    member.UsedQuota,
+			MemberCreated: member.CreatedTime,
+		})
+	}
+	return orgs, nil
+}
+
+func AddOrganizationMember(orgId int, userId int, role string, quotaCap int) (*OrganizationMember, error) {
+	member := &OrganizationMember{OrgId: orgId, UserId: userId, Role: role, QuotaCap: quotaCap, CreatedTime: common.GetTimestamp()}
+	if err := DB.Create(member).Error; err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// UpdateOrganizationMember changes the role and quota cap of a member,
+// optionally resetting the quota counted against the cap.
+func UpdateOrganizationMember(member *OrganizationMember, role string, quotaCap int, resetUsed bool) error {
+	updates := map[string]interface{}{"role": role, "quota_cap": quotaCap}
+	if resetUsed {
+		updates["used_quota"] = 0
+	}
+	if err := DB.Model(&OrganizationMember{}).Where("id = ?", member.Id).Updates(updates).Error; err != nil {
+		return err
+	}
+	member.Role = role
+	member.QuotaCap = quotaCap
+	if resetUsed {
+		member.UsedQuota = 0
+	}
+	return nil
+}
+
+// RemoveOrganizationMember removes a member. Organization tokens created by
+// the member are transferred to the owner and disabled, since the removed
+// member still knows their keys; RotateOrganizationTokenKey brings them back
+// with a new key.
+func RemoveOrganizationMember(org *Organization, userId int) error {
+	var tokens []Token
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id", commonKeyCol).Where("org_id = ? AND user_id = ?", org.Id, userId).Find(&tokens).Error; err != nil {
+			return err
+		}
+		if err := invalidateTokensCache(tokens); err != nil {
+			common.SysLog("failed to invalidate token cache before organization member removal: " + err.Error())
+		}
+		if err := tx.Model(&Token{}).Where("org_id = ? AND user_id = ?", org.Id, userId).
+			Updates(map[string]interface{}{"user_id": org.OwnerId, "status": common.TokenStatusDisabled}).Error; err != nil {
+			return err
+		}
+		return tx.Where("org_id = ? AND user_id = ?", org.Id, userId).Delete(&OrganizationMember{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	// 提交后再次清理，避免事务期间被其他请求写回的旧快照继续放行已禁用的令牌
+	if err := invalidateTokensCache(tokens); err != nil {
+		common.SysLog("failed to invalidate token cache after organization member removal: " + err.Error())
+	}
+	return nil
+}
+
+// GetOrganizationTokens lists the tokens owned by an organization. A
+// non-zero userId restricts the list to the tokens of that member.
+func GetOrganizationTokens(orgId int, userId int) ([]*Token, error) {
+	var tokens []*Token
+	tx := DB.Where("org_id = ?", orgId)
+	if userId > 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err := tx.Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+func DeleteOrganizationToken(orgId int, tokenId int) error {
+	var token Token
+	if err := DB.First(&token, "id = ? AND org_id = ?", tokenId, orgId).Error; err != nil {
+		return err
+	}
+	return token.Delete()
+}
+
+// RotateOrganizationTokenKey replaces the key of an organization token and
+// re-enables it if it was disabled, e.g. after its creator left. The old key
+// and the derived tokens issued with it stop working at once. A non-zero
+// userId restricts the rotation to the tokens of that member.
+func RotateOrganizationTokenKey(orgId int, tokenId int, userId int, key string) (*Token, error) {
+	var token Token
+	var oldKeys []Token
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("id = ? AND org_id = ?", tokenId, orgId)
+		if userId > 0 {
+			query = query.Where("user_id = ?", userId)
+		}
+		if err := query.First(&token).Error; err != nil {
+			return err
+		}
+		oldKeys = []Token{{Id: token.Id, Key: token.Key}}
+		if err := invalidateTokensCache(oldKeys); err != nil {
+			common.SysLog("failed to invalidate token cache before organization token rotation: " + err.Error())
+		}
+		token.SetHashedKey(key)
+		updates := map[string]interface{}{
+			"key":        token.Key,
+			"key_prefix": token.KeyPrefix,
+			"key_hashed": true,
+		}
+		if token.Status == common.TokenStatusDisabled {
+			token.Status = common.TokenStatusEnabled
+			updates["status"] = token.Status
+		}
+		return tx.Model(&Token{}).Where("id = ?", token.Id).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := invalidateTokensCache(oldKeys); err != nil {
+		common.SysLog("failed to invalidate token cache after organization token rotation: " + err.Error())
+	}
+	return &token, nil
+}
+
+// TryReserveOrganizationQuota atomically deducts quota from the organization
+// wallet on behalf of a member, unless the wallet balance or the quota cap of
+// the member is not enough, or the member is not allowed to use the wallet.
+func TryReserveOrganizationQuota(orgId int, userId int, quota int) (bool, error) {
+	if quota < 0 {
+		return false, errors.New("quota 不能为负数！")
+	}
+	reserved := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&OrganizationMember{}).
+			Where("org_id = ? AND user_id = ? AND role IN ? AND (quota_cap <= ? OR used_quota + ? <= quota_cap)",
+				orgId, userId, organizationWalletRoles(), 0, quota).
+			Update("used_quota", gorm.Expr("used_quota + ?", quota))
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		result = tx.Model(&Organization{}).
+			Where("id = ? AND status = ? AND quota >= ?", orgId, OrganizationStatusEnabled, quota).
+			Updates(map[string]interface{}{
+				"quota":      gorm.Expr("quota - ?", quota),
+				"used_quota": gorm.Expr("used_quota + ?", quota),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			// 回滚成员用量
+			return errOrganizationQuotaRejected
+		}
+		reserved = true
+		return nil
+	})
+	if errors.Is(err, errOrganizationQuotaRejected) {
+		return false, nil
+	}
+	return reserved, err
+}
+
+var errOrganizationQuotaRejected = errors.New("organization quota rejected")
+
+func organizationWalletRoles() []string {
+	roles := make([]string, 0, len(organizationRolePermissions))
+	for role, permissions := range organizationRolePermissions {
+		if slices.Contains(permissions, OrganizationPermCreateTokens) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// AdjustOrganizationQuota applies a settlement delta (positive to charge more,
+// negative to refund) to the organization wallet and the member's usage. The
+// wallet may go negative on a post-charge, like a user wallet does.
+func AdjustOrganizationQuota(orgId int, userId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", delta),
+			"used_quota": gorm.Expr("used_quota + ?", delta),
+		}).Error; err != nil {
+			return err
+		}
+		// 成员可能已离开组织，此时只调整组织钱包
+		return tx.Model(&OrganizationMember{}).Where("org_id = ? AND user_id = ?", orgId, userId).
+			Update("used_quota", gorm.Expr("used_quota + ?", delta)).Error
+	})
+}
+
+func GetOrganizationQuota(orgId int) (quota int, err error) {
+	err = DB.Model(&Organization{}).Where("id = ?", orgId).Select("quota").Scan(&quota).Error
+	return quota, err
+}
+
+// IncreaseOrganizationQuota adds quota to the organization wallet (top-up or
+// admin adjustment; a negative value deducts).
+func IncreaseOrganizationQuota(orgId int, quota int) error {
+	return DB.Model(&Organization{}).Where("id = ?", orgId).
+		Update("quota", gorm.Expr("quota + ?", quota)).Error
+}
+
+// OrganizationUsageStat is one row of an organization usage report.
+type OrganizationUsageStat struct {
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	ModelName        string `json:"model_name"`
+	RequestCount     int64  `json:"request_count"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// GetOrganizationUsage groups the consume logs of the organization's tokens,
+// including deleted ones, by member and model.
+func GetOrganizationUsage(orgId int, startTimestamp int64, endTimestamp int64) (stats []OrganizationUsageStat, err error) {
+	var tokenIds []int
+	if err = DB.Unscoped().Model(&Token{}).Where("org_id = ?", orgId).Pluck("id", &tokenIds).Error; err != nil {
+		return nil, err
+	}
+	if len(tokenIds) == 0 {
+		return []OrganizationUsageStat{}, nil
+	}
+	tx := LOG_DB.Table("logs").
+		Select("user_id, username, model_name, count(*) request_count, COALESCE(sum(quota), 0) quota, COALESCE(sum(prompt_tokens), 0) prompt_tokens, COALESCE(sum(completion_tokens), 0) completion_tokens").
+		Where("type = ?", LogTypeConsume).
+		Where("token_id IN ?", tokenIds)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Group("user_id, username, model_name").Order("quota desc").Scan(&stats).Error
+	return stats, err
+}
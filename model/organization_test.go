@@ -0,0 +1,149 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedOrganization(t *testing.T, quota int) *Organization {
+	t.Helper()
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "owner", Status: common.UserStatusEnabled}).Error)
+	org, err := CreateOrganization("acme", 1)
+	require.NoError(t, err)
+	require.NoError(t, IncreaseOrganizationQuota(org.Id, quota))
+	return org
+}
+
+func TestTryReserveOrganizationQuotaEnforcesWalletAndMemberCap(t *testing.T) {
+	truncateTables(t)
+	org := seedOrganization(t, 1000)
+
+	_, err := AddOrganizationMember(org.Id, 2, OrganizationRoleDeveloper, 300)
+	require.NoError(t, err)
+	_, err = AddOrganizationMember(org.Id, 3, OrganizationRoleBilling, 0)
+	require.NoError(t, err)
+
+	reserved, err := TryReserveOrganizationQuota(org.Id, 2, 200)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	reserved, err = TryReserveOrganizationQuota(org.Id, 2, 101)
+	require.NoError(t, err)
+	assert.False(t, reserved, "member quota cap exceeded")
+
+	reserved, err = TryReserveOrganizationQuota(org.Id, 3, 10)
+	require.NoError(t, err)
+	assert.False(t, reserved, "billing members cannot spend from the wallet")
+	reserved, err = TryReserveOrganizationQuota(org.Id, 4, 10)
+	require.NoError(t, err)
+	assert.False(t, reserved, "non-members cannot spend from the wallet")
+
+	// 钱包余额不足时成员用量不变
+	reserved, err = TryReserveOrganizationQuota(org.Id, 1, 900)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	owner, err := GetOrganizationMember(org.Id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, owner.UsedQuota)
+
+	require.NoError(t, AdjustOrganizationQuota(org.Id, 2, -50))
+	reserved, err = TryReserveOrganizationQuota(org.Id, 2, 150)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	reloaded, err := GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 700, reloaded.Quota)
+	assert.Equal(t, 300, reloaded.UsedQuota)
+	member, err := GetOrganizationMember(org.Id, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 300, member.UsedQuota)
+
+	require.NoError(t, UpdateOrganizationStatus(org.Id, OrganizationStatusDisabled))
+	reserved, err = TryReserveOrganizationQuota(org.Id, 1, 1)
+	require.NoError(t, err)
+	assert.False(t, reserved, "disabled organizations cannot be charged")
+}
+
+func TestRemoveOrganizationMemberDisablesTransferredTokens(t *testing.T) {
+	truncateTables(t)
+	org := seedOrganization(t, 1000)
+	_, err := AddOrganizationMember(org.Id, 2, OrganizationRoleDeveloper, 0)
+	require.NoError(t, err)
+
+	orgToken := &Token{UserId: 2, OrgId: org.Id, Key: "org-token-key", Name: "shared", Status: common.TokenStatusEnabled, ExpiredTime: -1}
+	personalToken := &Token{UserId: 2, Key: "personal-token-key", Name: "personal", Status: common.TokenStatusEnabled, ExpiredTime: -1}
+	require.NoError(t, DB.Create(orgToken).Error)
+	require.NoError(t, DB.Create(personalToken).Error)
+
+	require.NoError(t, RemoveOrganizationMember(org, 2))
+
+	_, err = GetOrganizationMember(org.Id, 2)
+	assert.Error(t, err)
+	reloaded, err := GetTokenById(orgToken.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reloaded.UserId)
+	assert.Equal(t, common.TokenStatusDisabled, reloaded.Status, "the removed member still knows the key")
+	reloaded, err = GetTokenById(personalToken.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reloaded.UserId, "personal tokens stay with the member")
+	assert.Equal(t, common.TokenStatusEnabled, reloaded.Status)
+}
+
+func TestRotateOrganizationTokenKeyRestoresTransferredToken(t *testing.T) {
+	truncateTables(t)
+	org := seedOrganization(t, 1000)
+	_, err := AddOrganizationMember(org.Id, 2, OrganizationRoleDeveloper, 0)
+	require.NoError(t, err)
+	orgToken := &Token{UserId: 2, OrgId: org.Id, Name: "shared", Status: common.TokenStatusEnabled, ExpiredTime: -1}
+	orgToken.SetHashedKey("old-org-token-key")
+	require.NoError(t, DB.Create(orgToken).Error)
+	require.NoError(t, RemoveOrganizationMember(org, 2))
+
+	_, err = RotateOrganizationTokenKey(org.Id, orgToken.Id, 2, "new-org-token-key")
+	require.Error(t, err, "members can only rotate their own organization tokens")
+
+	rotated, err := RotateOrganizationTokenKey(org.Id, orgToken.Id, 0, "new-org-token-key")
+	require.NoError(t, err)
+	assert.Equal(t, common.TokenStatusEnabled, rotated.Status)
+	reloaded, err := GetTokenById(orgToken.Id)
+	require.NoError(t, err)
+	assert.Equal(t, common.TokenStatusEnabled, reloaded.Status)
+	assert.Equal(t, 1, reloaded.UserId)
+	assert.Equal(t, "shared", reloaded.Name)
+	assert.True(t, IsTokenKeyOf(reloaded.Key, "new-org-token-key"))
+	assert.False(t, IsTokenKeyOf(reloaded.Key, "old-org-token-key"), "the removed member's key no longer works")
+}
+
+func TestGetOrganizationUsageGroupsByMemberAndModel(t *testing.T) {
+	truncateTables(t)
+	org := seedOrganization(t, 1000)
+
+	orgToken := &Token{UserId: 2, OrgId: org.Id, Key: "org-usage-key", Name: "shared", Status: common.TokenStatusEnabled, ExpiredTime: -1}
+	require.NoError(t, DB.Create(orgToken).Error)
+	now := common.GetTimestamp()
+	logs := []*Log{
+		{UserId: 2, Username: "dev", TokenId: orgToken.Id, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 100, PromptTokens: 10, CompletionTokens: 5, CreatedAt: now},
+		{UserId: 2, Username: "dev", TokenId: orgToken.Id, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 50, PromptTokens: 4, CompletionTokens: 2, CreatedAt: now},
+		{UserId: 2, Username: "dev", TokenId: orgToken.Id, Type: LogTypeError, ModelName: "gpt-4o", CreatedAt: now},
+		{UserId: 2, Username: "dev", TokenId: orgToken.Id + 100, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 999, CreatedAt: now},
+	}
+	require.NoError(t, LOG_DB.Create(&logs).Error)
+	// 删除的令牌仍计入组织用量
+	require.NoError(t, orgToken.Delete())
+
+	stats, err := GetOrganizationUsage(org.Id, now-60, 0)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, OrganizationUsageStat{
+		UserId:           2,
+		Username:         "dev",
+		ModelName:        "gpt-4o",
+		RequestCount:     2,
+		Quota:            150,
+		PromptTokens:     14,
+		CompletionTokens: 7,
+	}, stats[0])
+}
@@ -0,0 +1,224 @@
+package model
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// PromptTemplateIdPrefix marks prompt ids managed by the gateway. Other ids
+// in `prompt.id` (e.g. OpenAI stored prompts) are passed through untouched.
+const PromptTemplateIdPrefix = "tpl_"
+
+// PromptTemplate is a named system prompt that requests reference through
+// `prompt: {id, version, variables}`. Its content lives in immutable
+// PromptTemplateVersion rows.
+type PromptTemplate struct {
+	Id          int    `json:"id"`
+	PromptId    string `json:"prompt_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Name        string `json:"name" gorm:"type:varchar(128)"`
+	Description string `json:"description" gorm:"type:text"`
+	// Public 仅管理员可设置，公开模板对所有用户的令牌可用
+	Public bool `json:"public" gorm:"column:is_public"`
+	// TokenIds 是允许使用该模板的所有者令牌（JSON 数组），为空时所有者的全部令牌可用
+	TokenIds      string `json:"-" gorm:"type:text"`
+	LatestVersion int    `json:"latest_version"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime   int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// PromptTemplateVersion is one immutable revision of a template.
+type PromptTemplateVersion struct {
+	Id               int    `json:"id"`
+	PromptTemplateId int    `json:"prompt_template_id" gorm:"uniqueIndex:idx_prompt_template_version"`
+	Version          int    `json:"version" gorm:"uniqueIndex:idx_prompt_template_version"`
+	Content          string `json:"content" gorm:"type:text"`
+	// Variables 是变量默认值（JSON 对象），请求未提供且没有默认值的变量会导致请求失败
+	Variables   string `json:"-" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+func (template *PromptTemplate) GetTokenIds() []int {
+	if template.TokenIds == "" {
+		return nil
+	}
+	var tokenIds []int
+	if err := common.UnmarshalJsonStr(template.TokenIds, &tokenIds); err != nil {
+		common.SysError("failed to parse token ids of prompt template " + template.PromptId + ": " + err.Error())
+		return nil
+	}
+	return tokenIds
+}
+
+func (template *PromptTemplate) SetTokenIds(tokenIds []int) error {
+	if len(tokenIds) == 0 {
+		template.TokenIds = ""
+		return nil
+	}
+	data, err := common.Marshal(tokenIds)
+	if err != nil {
+		return err
+	}
+	template.TokenIds = string(data)
+	return nil
+}
+
+// UsableBy reports whether a request authenticated with tokenId of userId may
+// render the template.
+func (template *PromptTemplate) UsableBy(userId int, tokenId int) bool {
+	if template.Public {
+		return true
+	}
+	if template.UserId != userId {
+		return false
+	}
+	tokenIds := template.GetTokenIds()
+	return len(tokenIds) == 0 || slices.Contains(tokenIds, tokenId)
+}
+
+func (version *PromptTemplateVersion) GetVariables() map[string]string {
+	if version.Variables == "" {
+		return nil
+	}
+	var variables map[string]string
+	if err := common.UnmarshalJsonStr(version.Variables, &variables); err != nil {
+		common.SysError("failed to parse variables of prompt template version: " + err.Error())
+		return nil
+	}
+	return variables
+}
+
+func (version *PromptTemplateVersion) SetVariables(variables map[string]string) error {
+	if len(variables) == 0 {
+		version.Variables = ""
+		return nil
+	}
+	data, err := common.Marshal(variables)
+	if err != nil {
+		return err
+	}
+	version.Variables = string(data)
+	return nil
+}
+
+// Insert creates the template together with its first version.
+func (template *PromptTemplate) Insert(version *PromptTemplateVersion) error {
+	now := common.GetTimestamp()
+	template.PromptId = PromptTemplateIdPrefix + common.GetRandomString(24)
+	template.LatestVersion = 1
+	template.CreatedTime = now
+	template.UpdatedTime = now
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(template).Error; err != nil {
+			return err
+		}
+		version.PromptTemplateId = template.Id
+		version.Version = 1
+		version.CreatedTime = now
+		return tx.Create(version).Error
+	})
+}
+
+// Update saves the template metadata; versions are never modified.
+func (template *PromptTemplate) Update() error {
+	template.UpdatedTime = common.GetTimestamp()
+	return DB.Model(template).Select("name", "description", "is_public", "token_ids", "updated_time").Updates(template).Error
+}
+
+// AddVersion appends a new version and makes it the latest.
+func (template *PromptTemplate) AddVersion(version *PromptTemplateVersion) error {
+	now := common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PromptTemplate{}).Where("id = ?", template.Id).Updates(map[string]interface{}{
+			"latest_version": gorm.Expr("latest_version + 1"),
+			"updated_time":   now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Select("latest_version").Where("id = ?", template.Id).First(template).Error; err != nil {
+			return err
+		}
+		version.PromptTemplateId = template.Id
+		version.Version = template.LatestVersion
+		version.CreatedTime = now
+		template.UpdatedTime = now
+		return tx.Create(version).Error
+	})
+}
+
+func (template *PromptTemplate) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("prompt_template_id = ?", template.Id).Delete(&PromptTemplateVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(template).Error
+	})
+}
+
+// GetPromptTemplateByPromptId returns (nil, nil) when the id is unknown.
+func GetPromptTemplateByPromptId(promptId string) (*PromptTemplate, error) {
+	var template PromptTemplate
+	err := DB.Where("prompt_id = ?", promptId).First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// GetPromptTemplateById returns the template only if userId owns it.
+func GetPromptTemplateById(id int, userId int) (*PromptTemplate, error) {
+	var template PromptTemplate
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&template).Error
+	return &template, err
+}
+
+// GetVisiblePromptTemplateById returns the template if userId owns it or it
+// is public.
+func GetVisiblePromptTemplateById(id int, userId int) (*PromptTemplate, error) {
+	var template PromptTemplate
+	err := DB.Where("id = ? AND (user_id = ? OR is_public = ?)", id, userId, true).First(&template).Error
+	return &template, err
+}
+
+// GetPromptTemplateVersion returns the given version, or the latest one when
+// version is 0. It returns (nil, nil) when the version does not exist.
+func GetPromptTemplateVersion(template *PromptTemplate, version int) (*PromptTemplateVersion, error) {
+	if version <= 0 {
+		version = template.LatestVersion
+	}
+	var templateVersion PromptTemplateVersion
+	err := DB.Where("prompt_template_id = ? AND version = ?", template.Id, version).First(&templateVersion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &templateVersion, nil
+}
+
+func GetPromptTemplateVersions(templateId int) ([]*PromptTemplateVersion, error) {
+	var versions []*PromptTemplateVersion
+	err := DB.Where("prompt_template_id = ?", templateId).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+// GetUserPromptTemplates lists the user's own templates and the public ones.
+func GetUserPromptTemplates(userId int, startIdx int, num int) ([]*PromptTemplate, int64, error) {
+	var templates []*PromptTemplate
+	var total int64
+	query := DB.Model(&PromptTemplate{}).Where("user_id = ? OR is_public = ?", userId, true)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id desc").Limit(num).Offset(startIdx).Find(&templates).Error
+	return templates, total, err
+}
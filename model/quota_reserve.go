@@ -39,15 +39,28 @@ end
 redis.call('HINCRBY', KEYS[1], 'Quota', tonumber(ARGV[1]))
 return 1`
 
+// tokenQuotaReserveScript 同时校验剩余额度（无限额度令牌跳过）与周期预算：
+// 周期用量为 UsedQuota - BudgetUsedBase，周期已结束时返回 0，由调用方切换周期后重试。
 const tokenQuotaReserveScript = `
 if tonumber(redis.call('HGET', KEYS[1], 'Id') or '0') ~= tonumber(ARGV[2])
   or redis.call('HEXISTS', KEYS[1], 'RemainQuota') == 0
   or redis.call('HEXISTS', KEYS[1], 'UsedQuota') == 0 then
   return -1
 end
-local remain = tonumber(redis.call('HGET', KEYS[1], 'RemainQuota'))
-if remain == nil or remain < tonumber(ARGV[1]) then
-  return 0
+if ARGV[4] ~= '1' then
+  local remain = tonumber(redis.call('HGET', KEYS[1], 'RemainQuota'))
+  if remain == nil or remain < tonumber(ARGV[1]) then
+    return 0
+  end
+end
+local budget = tonumber(redis.call('HGET', KEYS[1], 'BudgetQuota') or '0') or 0
+if budget > 0 and redis.call('HGET', KEYS[1], 'BudgetSoftLimit') ~= 'true' then
+  local windowEnd = tonumber(redis.call('HGET', KEYS[1], 'BudgetWindowEnd') or '0') or 0
+  local used = tonumber(redis.call('HGET', KEYS[1], 'UsedQuota')) or 0
+  local base = tonumber(redis.call('HGET', KEYS[1], 'BudgetUsedBase') or '0') or 0
+  if windowEnd <= tonumber(ARGV[3]) or used - base + tonumber(ARGV[1]) > budget then
+    return 0
+  end
 end
 redis.call('HINCRBY', KEYS[1], 'RemainQuota', -tonumber(ARGV[1]))
 redis.call('HINCRBY', KEYS[1], 'UsedQuota', tonumber(ARGV[1]))
@@ -91,9 +104,13 @@ func cacheApplyUserQuotaDelta(userID int, delta int64) (cacheQuotaResult, error)
 	return quotaResultFromLua(result, err)
 }
 
-func cacheTryReserveTokenQuota(id int, key string, amount int64) (cacheQuotaResult, error) {
+func cacheTryReserveTokenQuota(id int, key string, amount int64, unlimited bool) (cacheQuotaResult, error) {
+	unlimitedFlag := "0"
+	if unlimited {
+		unlimitedFlag = "1"
+	}
 	result, err := common.RDB.Eval(context.Background(), tokenQuotaReserveScript,
-		[]string{getTokenCacheKey(key)}, amount, id, common.GetTimestamp()).Int()
+		[]string{getTokenCacheKey(key)}, amount, id, common.GetTimestamp(), unlimitedFlag).Int()
 	return quotaResultFromLua(result, err)
 }
 
@@ -148,9 +165,14 @@ func reserveUserQuotaDB(id int, quota int) (bool, error) {
 	return result.RowsAffected == 1, result.Error
 }
 
-func reserveTokenQuotaDB(id int, quota int) (bool, error) {
-	result := DB.Model(&Token{}).
-		Where("id = ? AND remain_quota >= ?", id, quota).
+func reserveTokenQuotaDB(id int, quota int, unlimited bool) (bool, error) {
+	query := DB.Model(&Token{}).Where("id = ?", id)
+	if !unlimited {
+		query = query.Where("remain_quota >= ?", quota)
+	}
+	result := query.
+		Where("budget_quota <= ? OR budget_soft_limit = ? OR (budget_window_end > ? AND used_quota - budget_used_base + ? <= budget_quota)",
+			0, true, common.GetTimestamp(), quota).
 		Updates(map[string]interface{}{
 			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
 			"used_quota":    gorm.Expr("used_quota + ?", quota),
@@ -198,8 +220,9 @@ func TryReserveUserQuota(id int, quota int) (bool, error) {
 	return true, nil
 }
 
-// TryReserveTokenQuota atomically checks and deducts a token quota. Unlimited
-// tokens skip the balance check but still update remain/used accounting.
+// TryReserveTokenQuota atomically checks and deducts a token quota, together
+// with the recurring budget of the token. Unlimited tokens skip the balance
+// check but still update remain/used accounting and respect their budget.
 func TryReserveTokenQuota(id int, key string, quota int, unlimited bool) (bool, error) {
 	if quota < 0 {
 		return false, errors.New("quota 不能为负数！")
@@ -207,24 +230,38 @@ func TryReserveTokenQuota(id int, key string, quota int, unlimited bool) (bool,
 	if quota == 0 {
 		return true, nil
 	}
-	if unlimited {
-		return true, DecreaseTokenQuota(id, key, quota)
+	reserved, err := tryReserveTokenQuota(id, key, quota, unlimited)
+	if err != nil || reserved {
+		return reserved, err
 	}
+	// 预扣被拒绝时检查预算周期是否已结束，切换周期后重试一次
+	rolled, rollErr := rollTokenBudgetWindowById(id)
+	if rollErr != nil {
+		common.SysLog(fmt.Sprintf("failed to roll token budget window (tokenId=%d): %s", id, rollErr.Error()))
+		return false, nil
+	}
+	if !rolled {
+		return false, nil
+	}
+	return tryReserveTokenQuota(id, key, quota, unlimited)
+}
+
+func tryReserveTokenQuota(id int, key string, quota int, unlimited bool) (bool, error) {
 	if !common.RedisEnabled {
-		return reserveTokenQuotaDB(id, quota)
+		return reserveTokenQuotaDB(id, quota, unlimited)
 	}
 
-	result, err := cacheTryReserveTokenQuota(id, key, int64(quota))
+	result, err := cacheTryReserveTokenQuota(id, key, int64(quota), unlimited)
 	if err == nil && result == cacheQuotaMiss {
 		if _, hydrateErr := GetTokenByKey(key, true); hydrateErr == nil {
-			result, err = cacheTryReserveTokenQuota(id, key, int64(quota))
+			result, err = cacheTryReserveTokenQuota(id, key, int64(quota), unlimited)
 		}
 	}
 	if err != nil || result == cacheQuotaMiss {
 		if err != nil {
 			common.SysLog("token quota cache reserve unavailable, falling back to database: " + err.Error())
 		}
-		return reserveTokenQuotaDB(id, quota)
+		return reserveTokenQuotaDB(id, quota, unlimited)
 	}
 	if result == cacheQuotaInsufficient {
 		return false, nil
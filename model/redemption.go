@@ -141,6 +141,9 @@ func Redeem(key string, userId int) (quota int, err error) {
 	if userId == 0 {
 		return 0, errors.New("无效的 user id")
 	}
+	if err := CheckResellerChildSelfFunding(userId); err != nil {
+		return 0, err
+	}
 	redemption := &Redemption{}
 
 	keyCol := "`key`"
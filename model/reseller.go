@@ -0,0 +1,286 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 加价倍率上限，防止误填导致子账户被按离谱的价格扣费
+const ResellerMarkupMax = 100.0
+
+var ErrResellerNotEnabled = errors.New("reseller not enabled")
+
+var ErrResellerChildSelfFunding = errors.New("子账户的额度由转售商分配，不能自行充值、签到或购买订阅")
+
+// Reseller 转售商（上级账户）。转售商可以创建子账户（User.ParentId）并为其分配额度，
+// 子账户按加价后的价格从自己的钱包扣费，转售商再按平台价从自己的钱包扣费。
+type Reseller struct {
+	UserId      int    `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Markup      string `json:"-" gorm:"type:text"` // ResellerMarkup 的 JSON
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+	Username    string `json:"username" gorm:"-:all"`
+}
+
+// ResellerMarkup 转售商对子账户看到的倍率的加价。子账户实际使用的分组倍率为
+// 平台分组倍率 × 分组加价 × 模型加价：分组加价未单独设置时使用 Default，
+// 模型加价未设置时为 1。
+type ResellerMarkup struct {
+	Default float64            `json:"default,omitempty"`
+	Groups  map[string]float64 `json:"groups,omitempty"`
+	Models  map[string]float64 `json:"models,omitempty"`
+}
+
+func (m *ResellerMarkup) GroupRatio(group string) float64 {
+	if m == nil {
+		return 1
+	}
+	if ratio, ok := m.Groups[group]; ok && ratio > 0 {
+		return ratio
+	}
+	if m.Default > 0 {
+		return m.Default
+	}
+	return 1
+}
+
+func (m *ResellerMarkup) ModelRatio(modelName string) float64 {
+	if m == nil {
+		return 1
+	}
+	if ratio, ok := m.Models[modelName]; ok && ratio > 0 {
+		return ratio
+	}
+	return 1
+}
+
+// Ratio 返回子账户在 group 分组下使用 modelName 的总加价倍率。
+func (m *ResellerMarkup) Ratio(group string, modelName string) float64 {
+	return m.GroupRatio(group) * m.ModelRatio(modelName)
+}
+
+func (m *ResellerMarkup) Validate() error {
+	check := func(name string, ratio float64) error {
+		if ratio <= 0 || ratio > ResellerMarkupMax {
+			return fmt.Errorf("加价倍率 %s 必须大于 0 且不超过 %g", name, ResellerMarkupMax)
+		}
+		return nil
+	}
+	if m.Default != 0 {
+		if err := check("default", m.Default); err != nil {
+			return err
+		}
+	}
+	for group, ratio := range m.Groups {
+		if err := check(group, ratio); err != nil {
+			return err
+		}
+	}
+	for modelName, ratio := range m.Models {
+		if err := check(modelName, ratio); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (reseller *Reseller) GetMarkup() (*ResellerMarkup, error) {
+	markup := &ResellerMarkup{}
+	if reseller.Markup == "" {
+		return markup, nil
+	}
+	if err := common.UnmarshalJsonStr(reseller.Markup, markup); err != nil {
+		return nil, err
+	}
+	return markup, nil
+}
+
+func (reseller *Reseller) SetMarkup(markup *ResellerMarkup) error {
+	data, err := common.Marshal(markup)
+	if err != nil {
+		return err
+	}
+	reseller.Markup = string(data)
+	return nil
+}
+
+func GetReseller(userId int) (*Reseller, error) {
+	var reseller Reseller
+	err := DB.First(&reseller, "user_id = ?", userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrResellerNotEnabled
+	}
+	return &reseller, err
+}
+
+func GetAllResellers(startIdx int, num int) (resellers []*Reseller, total int64, err error) {
+	tx := DB.Model(&Reseller{})
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err = tx.Order("user_id desc").Limit(num).Offset(startIdx).Find(&resellers).Error; err != nil {
+		return nil, 0, err
+	}
+	userIds := make([]int, 0, len(resellers))
+	for _, reseller := range resellers {
+		userIds = append(userIds, reseller.UserId)
+	}
+	var users []User
+	if len(userIds) > 0 {
+		if err = DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	usernames := make(map[int]string, len(users))
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+	for _, reseller := range resellers {
+		reseller.Username = usernames[reseller.UserId]
+	}
+	return resellers, total, nil
+}
+
+// EnableReseller 允许用户成为转售商。子账户不能再成为转售商。
+func EnableReseller(userId int) (*Reseller, error) {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	if user.ParentId > 0 {
+		return nil, errors.New("子账户不能成为转售商")
+	}
+	if reseller, err := GetReseller(userId); err == nil {
+		return reseller, nil
+	}
+	now := common.GetTimestamp()
+	reseller := &Reseller{UserId: userId, CreatedTime: now, UpdatedTime: now}
+	if err := DB.Create(reseller).Error; err != nil {
+		return nil, err
+	}
+	return reseller, nil
+}
+
+// DisableReseller 取消转售商资格，已有子账户保留，仍按平台价由转售商结算（不再加价）。
+func DisableReseller(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&Reseller{}).Error
+}
+
+func UpdateResellerMarkup(userId int, markup *ResellerMarkup) error {
+	reseller := &Reseller{}
+	if err := reseller.SetMarkup(markup); err != nil {
+		return err
+	}
+	result := DB.Model(&Reseller{}).Where("user_id = ?", userId).Updates(map[string]interface{}{
+		"markup":       reseller.Markup,
+		"updated_time": common.GetTimestamp(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrResellerNotEnabled
+	}
+	return nil
+}
+
+// GetResellerMarkup 返回转售商当前的加价配置，转售商资格已取消时返回 nil（不加价）。
+func GetResellerMarkup(resellerId int) (*ResellerMarkup, error) {
+	reseller, err := GetReseller(resellerId)
+	if errors.Is(err, ErrResellerNotEnabled) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reseller.GetMarkup()
+}
+
+// CreateChildUser 以转售商的分组创建子账户。子账户初始额度为 0，由转售商分配。
+func CreateChildUser(resellerId int, user *User) error {
+	parent, err := GetUserById(resellerId, false)
+	if err != nil {
+		return err
+	}
+	user.ParentId = resellerId
+	user.Group = parent.Group
+	user.Role = common.RoleCommonUser
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := user.InsertWithTx(tx, 0); err != nil {
+			return err
+		}
+		user.Quota = 0
+		return tx.Model(&User{}).Where("id = ?", user.Id).Update("quota", 0).Error
+	}); err != nil {
+		return err
+	}
+	user.FinishInsert(0)
+	return nil
+}
+
+// CheckResellerChildSelfFunding 拒绝子账户自行充值、兑换、签到或购买订阅。
+// 这些入账都不经过转售商的平台价结算，子账户的额度只能由转售商分配。
+func CheckResellerChildSelfFunding(userId int) error {
+	var user User
+	if err := DB.Select("parent_id").Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+	if user.ParentId > 0 {
+		return ErrResellerChildSelfFunding
+	}
+	return nil
+}
+
+func GetChildUser(resellerId int, childId int) (*User, error) {
+	var user User
+	err := DB.Omit("password", "access_token").
+		First(&user, "id = ? AND parent_id = ?", childId, resellerId).Error
+	return &user, err
+}
+
+func GetChildUsers(resellerId int, startIdx int, num int) (users []*User, total int64, err error) {
+	tx := DB.Model(&User{}).Where("parent_id = ?", resellerId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("password", "access_token").Order("id desc").Limit(num).Offset(startIdx).Find(&users).Error
+	return users, total, err
+}
+
+// ResellerChildUsageStat 是转售商查看的子账户用量汇总，Quota 为子账户支付的转售价。
+type ResellerChildUsageStat struct {
+	UserId           int    `json:"user_id"`
+	Username         string `json:"username"`
+	ModelName        string `json:"model_name"`
+	RequestCount     int64  `json:"request_count"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// GetResellerChildUsage 按子账户和模型汇总子账户（包括已删除的子账户）的消费日志。
+func GetResellerChildUsage(resellerId int, startTimestamp int64, endTimestamp int64) (stats []ResellerChildUsageStat, err error) {
+	var childIds []int
+	if err = DB.Unscoped().Model(&User{}).Where("parent_id = ?", resellerId).Pluck("id", &childIds).Error; err != nil {
+		return nil, err
+	}
+	if len(childIds) == 0 {
+		return []ResellerChildUsageStat{}, nil
+	}
+	tx := LOG_DB.Table("logs").
+		Select("user_id, username, model_name, count(*) request_count, COALESCE(sum(quota), 0) quota, COALESCE(sum(prompt_tokens), 0) prompt_tokens, COALESCE(sum(completion_tokens), 0) completion_tokens").
+		Where("type = ?", LogTypeConsume).
+		Where("user_id IN ?", childIds)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Group("user_id, username, model_name").Order("quota desc").Scan(&stats).Error
+	return stats, err
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResellerMarkupRatio(t *testing.T) {
+	var unset *ResellerMarkup
+	assert.Equal(t, 1.0, unset.Ratio("default", "gpt-4o"))
+
+	markup := &ResellerMarkup{
+		Default: 1.2,
+		Groups:  map[string]float64{"vip": 1.5},
+		Models:  map[string]float64{"gpt-4o": 2},
+	}
+	assert.InDelta(t, 1.2, markup.Ratio("default", "gpt-4o-mini"), 1e-9)
+	assert.InDelta(t, 1.5, markup.Ratio("vip", "gpt-4o-mini"), 1e-9)
+	assert.InDelta(t, 3.0, markup.Ratio("vip", "gpt-4o"), 1e-9)
+	require.NoError(t, markup.Validate())
+
+	assert.Error(t, (&ResellerMarkup{Groups: map[string]float64{"vip": 0}}).Validate())
+	assert.Error(t, (&ResellerMarkup{Models: map[string]float64{"gpt-4o": ResellerMarkupMax + 1}}).Validate())
+}
+
+func TestCreateChildUserInheritsResellerGroup(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "reseller", AffCode: "aff-reseller", Group: "vip", Status: common.UserStatusEnabled}).Error)
+	_, err := EnableReseller(1)
+	require.NoError(t, err)
+
+	child := &User{Username: "child", Password: "password123", DisplayName: "child"}
+	require.NoError(t, CreateChildUser(1, child))
+
+	stored, err := GetChildUser(1, child.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.ParentId)
+	assert.Equal(t, "vip", stored.Group)
+	assert.Equal(t, 0, stored.Quota, "child quota is allocated by the reseller")
+	assert.Equal(t, common.RoleCommonUser, stored.Role)
+
+	_, err = GetChildUser(2, child.Id)
+	assert.Error(t, err, "other resellers cannot see the child")
+	_, err = EnableReseller(child.Id)
+	assert.Error(t, err, "child accounts cannot become resellers")
+
+	require.NoError(t, UpdateResellerMarkup(1, &ResellerMarkup{Default: 1.5}))
+	markup, err := GetResellerMarkup(1)
+	require.NoError(t, err)
+	assert.InDelta(t, 1.5, markup.Ratio("vip", "gpt-4o"), 1e-9)
+
+	// 取消转售商资格后不再加价
+	require.NoError(t, DisableReseller(1))
+	markup, err = GetResellerMarkup(1)
+	require.NoError(t, err)
+	assert.Nil(t, markup)
+	assert.ErrorIs(t, UpdateResellerMarkup(1, &ResellerMarkup{Default: 2}), ErrResellerNotEnabled)
+}
+
+func TestResellerChildCannotSelfFund(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "reseller", AffCode: "aff-reseller", Status: common.UserStatusEnabled}).Error)
+	_, err := EnableReseller(1)
+	require.NoError(t, err)
+	child := &User{Username: "child", Password: "password123", DisplayName: "child"}
+	require.NoError(t, CreateChildUser(1, child))
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", child.Id).Update("quota", 100000000).Error)
+	plan := insertSubscriptionPlanForPaymentGuardTest(t, 4701)
+
+	assert.ErrorIs(t, CheckResellerChildSelfFunding(child.Id), ErrResellerChildSelfFunding)
+	assert.ErrorIs(t, ValidateTopUpQuotaCapacity(child.Id, 1000), ErrResellerChildSelfFunding)
+	assert.ErrorIs(t, PurchaseSubscriptionWithBalance(child.Id, plan.Id), ErrResellerChildSelfFunding)
+
+	var count int64
+	require.NoError(t, DB.Model(&UserSubscription{}).Where("user_id = ?", child.Id).Count(&count).Error)
+	assert.Zero(t, count)
+
+	assert.NoError(t, CheckResellerChildSelfFunding(1))
+	assert.NoError(t, ValidateTopUpQuotaCapacity(1, 1000))
+}
+
+func TestGetResellerChildUsageOnlyCountsChildren(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "reseller", AffCode: "aff-1", Status: common.UserStatusEnabled}).Error)
+	require.NoError(t, DB.Create(&User{Id: 2, Username: "child", AffCode: "aff-2", ParentId: 1, Status: common.UserStatusEnabled}).Error)
+	require.NoError(t, DB.Create(&User{Id: 3, Username: "other", AffCode: "aff-3", Status: common.UserStatusEnabled}).Error)
+
+	now := common.GetTimestamp()
+	logs := []*Log{
+		{UserId: 2, Username: "child", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 200, PromptTokens: 10, CompletionTokens: 5, CreatedAt: now},
+		{UserId: 2, Username: "child", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 100, PromptTokens: 4, CompletionTokens: 2, CreatedAt: now},
+		{UserId: 3, Username: "other", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 999, CreatedAt: now},
+		{UserId: 1, Username: "reseller", Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 999, CreatedAt: now},
+	}
+	require.NoError(t, LOG_DB.Create(&logs).Error)
+
+	stats, err := GetResellerChildUsage(1, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, ResellerChildUsageStat{
+		UserId:           2,
+		Username:         "child",
+		ModelName:        "gpt-4o",
+		RequestCount:     2,
+		Quota:            300,
+		PromptTokens:     14,
+		CompletionTokens: 7,
+	}, stats[0])
+}
@@ -0,0 +1,224 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// ExternalIdentityProviderSAMLPrefix + slug 作为 external_identity_claims.provider，
+	// 该列为 varchar(32)，因此 slug 最长 27 个字符。
+	ExternalIdentityProviderSAMLPrefix = "saml:"
+	SAMLProviderSlugMaxLength          = 32 - len(ExternalIdentityProviderSAMLPrefix)
+)
+
+// SAMLProvider stores the configuration of one SAML 2.0 identity provider.
+// The SP key pair is generated per provider so that rotating one IdP never
+// affects the others.
+type SAMLProvider struct {
+	Id           int    `json:"id" gorm:"primaryKey"`
+	Name         string `json:"name" gorm:"type:varchar(64);not null"`
+	Slug         string `json:"slug" gorm:"type:varchar(32);uniqueIndex;not null"`
+	Icon         string `json:"icon" gorm:"type:varchar(128);default:''"`
+	Enabled      bool   `json:"enabled" gorm:"default:false"`
+	IdPMetadata  string `json:"idp_metadata" gorm:"type:text"`             // IdP metadata XML
+	MetadataURL  string `json:"idp_metadata_url" gorm:"type:varchar(512)"` // Where IdPMetadata was fetched from (informational)
+	NameIDFormat string `json:"name_id_format" gorm:"type:varchar(128)"`   // Requested NameID format, empty lets the IdP decide
+
+	SPCertificate string `json:"sp_certificate" gorm:"type:text"` // PEM, published in SP metadata
+	SPPrivateKey  string `json:"-" gorm:"type:text"`              // PEM, signs AuthnRequests and decrypts assertions
+
+	// Attribute mapping, matched against the attribute Name or FriendlyName
+	UsernameAttribute    string `json:"username_attribute" gorm:"type:varchar(256);default:'uid'"`
+	EmailAttribute       string `json:"email_attribute" gorm:"type:varchar(256);default:'email'"`
+	DisplayNameAttribute string `json:"display_name_attribute" gorm:"type:varchar(256);default:'displayName'"`
+	GroupAttribute       string `json:"group_attribute" gorm:"type:varchar(256);default:'groups'"`
+
+	GroupMapping      string `json:"group_mapping" gorm:"type:text"`           // JSON []SAMLGroupMapping
+	RequireGroupMatch bool   `json:"require_group_match" gorm:"default:false"` // Deny login when no mapping matches
+	AutoProvision     bool   `json:"auto_provision" gorm:"default:false"`      // Create users on first login
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (SAMLProvider) TableName() string {
+	return "saml_providers"
+}
+
+// SAMLGroupMapping maps one IdP group value to a user group. Mappings are
+// evaluated in order and the first match wins.
+type SAMLGroupMapping struct {
+	IdPGroup string `json:"idp_group"`
+	Group    string `json:"group"`
+}
+
+// IdentityProvider returns the external_identity_claims provider key.
+func (p *SAMLProvider) IdentityProvider() string {
+	return ExternalIdentityProviderSAMLPrefix + p.Slug
+}
+
+func (p *SAMLProvider) GetGroupMapping() ([]SAMLGroupMapping, error) {
+	var mappings []SAMLGroupMapping
+	if strings.TrimSpace(p.GroupMapping) == "" {
+		return mappings, nil
+	}
+	if err := common.UnmarshalJsonStr(p.GroupMapping, &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// MapGroup 按配置顺序返回第一个匹配的用户分组。
+func (p *SAMLProvider) MapGroup(idpGroups []string) (string, bool) {
+	mappings, err := p.GetGroupMapping()
+	if err != nil {
+		return "", false
+	}
+	for _, mapping := range mappings {
+		for _, idpGroup := range idpGroups {
+			if mapping.IdPGroup == idpGroup {
+				return mapping.Group, true
+			}
+		}
+	}
+	return "", false
+}
+
+// SAMLSubject 将 NameID 规范化为 external_identity_claims.subject。
+func SAMLSubject(nameID string) string {
+	return ExternalIdentitySubject(nameID)
+}
+
+func GetAllSAMLProviders() ([]*SAMLProvider, error) {
+	var providers []*SAMLProvider
+	err := DB.Order("id asc").Find(&providers).Error
+	return providers, err
+}
+
+func GetEnabledSAMLProviders() ([]*SAMLProvider, error) {
+	var providers []*SAMLProvider
+	err := DB.Where("enabled = ?", true).Order("id asc").Find(&providers).Error
+	return providers, err
+}
+
+func GetSAMLProviderById(id int) (*SAMLProvider, error) {
+	var provider SAMLProvider
+	if err := DB.First(&provider, id).Error; err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func GetSAMLProviderBySlug(slug string) (*SAMLProvider, error) {
+	var provider SAMLProvider
+	if err := DB.Where("slug = ?", slug).First(&provider).Error; err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// IsSAMLSlugTaken returns true on DB errors (fail-closed), like IsSlugTaken.
+func IsSAMLSlugTaken(slug string, excludeId int) bool {
+	var count int64
+	query := DB.Model(&SAMLProvider{}).Where("slug = ?", slug)
+	if excludeId > 0 {
+		query = query.Where("id != ?", excludeId)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return true
+	}
+	return count > 0
+}
+
+func CreateSAMLProvider(provider *SAMLProvider) error {
+	if err := validateSAMLProvider(provider); err != nil {
+		return err
+	}
+	return DB.Create(provider).Error
+}
+
+func UpdateSAMLProvider(provider *SAMLProvider) error {
+	if err := validateSAMLProvider(provider); err != nil {
+		return err
+	}
+	return DB.Save(provider).Error
+}
+
+// DeleteSAMLProvider 删除 IdP 配置及其全部身份绑定。
+func DeleteSAMLProvider(id int) error {
+	provider, err := GetSAMLProviderById(id)
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("provider = ?", provider.IdentityProvider()).Delete(&ExternalIdentityClaim{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&SAMLProvider{}, id).Error
+	})
+}
+
+func validateSAMLProvider(provider *SAMLProvider) error {
+	provider.Name = strings.TrimSpace(provider.Name)
+	if provider.Name == "" {
+		return errors.New("provider name is required")
+	}
+	slug := strings.ToLower(strings.TrimSpace(provider.Slug))
+	if slug == "" {
+		return errors.New("provider slug is required")
+	}
+	if len(slug) > SAMLProviderSlugMaxLength {
+		return fmt.Errorf("provider slug must be at most %d characters", SAMLProviderSlugMaxLength)
+	}
+	for _, c := range slug {
+		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-') {
+			return errors.New("provider slug must contain only lowercase letters, numbers, and hyphens")
+		}
+	}
+	provider.Slug = slug
+
+	if strings.TrimSpace(provider.IdPMetadata) == "" {
+		return errors.New("IdP metadata is required")
+	}
+	if provider.SPCertificate == "" || provider.SPPrivateKey == "" {
+		return errors.New("SP key pair is required")
+	}
+
+	if provider.UsernameAttribute == "" {
+		provider.UsernameAttribute = "uid"
+	}
+	if provider.EmailAttribute == "" {
+		provider.EmailAttribute = "email"
+	}
+	if provider.DisplayNameAttribute == "" {
+		provider.DisplayNameAttribute = "displayName"
+	}
+	if provider.GroupAttribute == "" {
+		provider.GroupAttribute = "groups"
+	}
+
+	mappings, err := provider.GetGroupMapping()
+	if err != nil {
+		return errors.New("group_mapping must be valid JSON")
+	}
+	for index, mapping := range mappings {
+		if strings.TrimSpace(mapping.IdPGroup) == "" {
+			return fmt.Errorf("group_mapping[%d].idp_group is required", index)
+		}
+		if !ratio_setting.ContainsGroupRatio(mapping.Group) {
+			return fmt.Errorf("group_mapping[%d].group %q does not exist", index, mapping.Group)
+		}
+	}
+	if provider.RequireGroupMatch && len(mappings) == 0 {
+		return errors.New("require_group_match needs at least one group mapping")
+	}
+	return nil
+}
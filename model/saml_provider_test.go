@@ -0,0 +1,89 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSAMLProviderMapGroupFirstMatchWins(t *testing.T) {
+	provider := &SAMLProvider{GroupMapping: `[{"idp_group":"admins","group":"svip"},{"idp_group":"staff","group":"vip"}]`}
+
+	group, ok := provider.MapGroup([]string{"staff", "admins"})
+	assert.True(t, ok)
+	assert.Equal(t, "svip", group)
+
+	group, ok = provider.MapGroup([]string{"staff"})
+	assert.True(t, ok)
+	assert.Equal(t, "vip", group)
+
+	_, ok = provider.MapGroup([]string{"Staff", "contractors"})
+	assert.False(t, ok)
+}
+
+func TestSAMLSubjectHashesLongNameID(t *testing.T) {
+	assert.Equal(t, "alice@corp.test", SAMLSubject("  alice@corp.test "))
+
+	long := strings.Repeat("a", externalIdentitySubjectMaxLength+1)
+	subject := SAMLSubject(long)
+	assert.True(t, strings.HasPrefix(subject, "sha256:"))
+	assert.LessOrEqual(t, len(subject), externalIdentitySubjectMaxLength)
+	assert.Equal(t, subject, SAMLSubject(long))
+}
+
+func TestValidateSAMLProvider(t *testing.T) {
+	valid := func() *SAMLProvider {
+		return &SAMLProvider{
+			Name:          "Corp",
+			Slug:          " Corp-SSO ",
+			IdPMetadata:   "<EntityDescriptor/>",
+			SPCertificate: "cert",
+			SPPrivateKey:  "key",
+		}
+	}
+
+	provider := valid()
+	require.NoError(t, validateSAMLProvider(provider))
+	assert.Equal(t, "corp-sso", provider.Slug)
+	assert.Equal(t, "uid", provider.UsernameAttribute)
+	assert.Equal(t, "groups", provider.GroupAttribute)
+
+	provider = valid()
+	provider.Slug = strings.Repeat("a", SAMLProviderSlugMaxLength+1)
+	assert.Error(t, validateSAMLProvider(provider))
+
+	provider = valid()
+	provider.Slug = "corp_sso"
+	assert.Error(t, validateSAMLProvider(provider))
+
+	provider = valid()
+	provider.GroupMapping = `[{"idp_group":"staff","group":"no-such-group"}]`
+	assert.Error(t, validateSAMLProvider(provider))
+
+	provider = valid()
+	provider.RequireGroupMatch = true
+	assert.Error(t, validateSAMLProvider(provider))
+	provider.GroupMapping = `[{"idp_group":"staff","group":"vip"}]`
+	assert.NoError(t, validateSAMLProvider(provider))
+}
+
+func TestDeleteSAMLProviderReleasesIdentities(t *testing.T) {
+	truncateTables(t)
+	provider := &SAMLProvider{
+		Name: "Corp", Slug: "corp", IdPMetadata: "<EntityDescriptor/>",
+		SPCertificate: "cert", SPPrivateKey: "key",
+	}
+	require.NoError(t, CreateSAMLProvider(provider))
+	require.NoError(t, DB.Create(&ExternalIdentityClaim{Provider: provider.IdentityProvider(), Subject: "alice", UserId: 1}).Error)
+
+	count, err := CountExternalIdentities(provider.IdentityProvider())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	require.NoError(t, DeleteSAMLProvider(provider.Id))
+	count, err = CountExternalIdentities(provider.IdentityProvider())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
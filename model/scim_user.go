@@ -0,0 +1,140 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const SCIMUserNameMaxLength = 255
+
+var ErrSCIMUserNameTaken = errors.New("scim userName is already taken")
+
+// SCIMUser links a local user to the identity provisioned over SCIM. Only
+// users with a row here are visible to the IdP; accounts created in any other
+// way are never listed, changed or deprovisioned through SCIM.
+//
+// userName is kept verbatim so it round-trips to the IdP, while UserNameKey is
+// its case-insensitive form (SCIM userName is caseExact=false) and is unique.
+type SCIMUser struct {
+	UserId      int       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	UserName    string    `json:"user_name" gorm:"type:varchar(255);not null"`
+	UserNameKey string    `json:"-" gorm:"type:varchar(255);not null;uniqueIndex"`
+	ExternalId  string    `json:"external_id" gorm:"type:varchar(255);index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (SCIMUser) TableName() string {
+	return "scim_users"
+}
+
+func SCIMUserNameKey(userName string) string {
+	return strings.ToLower(strings.TrimSpace(userName))
+}
+
+// SCIMUserQuery filters SCIM users; empty fields are ignored.
+type SCIMUserQuery struct {
+	UserName   string
+	ExternalId string
+	Email      string
+	Group      string
+}
+
+func scimUserScope(query SCIMUserQuery) *gorm.DB {
+	tx := DB.Model(&SCIMUser{}).
+		Joins("JOIN users ON users.id = scim_users.user_id AND users.deleted_at IS NULL")
+	if query.UserName != "" {
+		tx = tx.Where("scim_users.user_name_key = ?", SCIMUserNameKey(query.UserName))
+	}
+	if query.ExternalId != "" {
+		tx = tx.Where("scim_users.external_id = ?", query.ExternalId)
+	}
+	if query.Email != "" {
+		tx = tx.Where("users.email = ?", NormalizeEmail(query.Email))
+	}
+	if query.Group != "" {
+		tx = tx.Where("users."+commonGroupCol+" = ?", query.Group)
+	}
+	return tx
+}
+
+// ListSCIMUsers returns one page of SCIM users ordered by user id together
+// with the total number of matches. Soft-deleted users are excluded.
+func ListSCIMUsers(query SCIMUserQuery, offset int, limit int) ([]*SCIMUser, int64, error) {
+	var total int64
+	if err := scimUserScope(query).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var scimUsers []*SCIMUser
+	if limit <= 0 {
+		return scimUsers, total, nil
+	}
+	err := scimUserScope(query).Select("scim_users.*").
+		Order("scim_users.user_id asc").Offset(offset).Limit(limit).
+		Find(&scimUsers).Error
+	return scimUsers, total, err
+}
+
+// FindSCIMUserId returns the id of the only SCIM user matching query, or
+// gorm.ErrRecordNotFound when none or several match.
+func FindSCIMUserId(query SCIMUserQuery) (int, error) {
+	var userIds []int
+	if err := scimUserScope(query).Limit(2).Pluck("scim_users.user_id", &userIds).Error; err != nil {
+		return 0, err
+	}
+	if len(userIds) != 1 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return userIds[0], nil
+}
+
+func GetSCIMUser(userId int) (*SCIMUser, error) {
+	var scimUser SCIMUser
+	if err := DB.Where("user_id = ?", userId).First(&scimUser).Error; err != nil {
+		return nil, err
+	}
+	return &scimUser, nil
+}
+
+// GetSCIMUsersByUserIds returns the SCIM users among userIds, keyed by user id.
+func GetSCIMUsersByUserIds(userIds []int) (map[int]*SCIMUser, error) {
+	result := make(map[int]*SCIMUser, len(userIds))
+	if len(userIds) == 0 {
+		return result, nil
+	}
+	var scimUsers []*SCIMUser
+	if err := DB.Where("user_id IN ?", userIds).Find(&scimUsers).Error; err != nil {
+		return nil, err
+	}
+	for _, scimUser := range scimUsers {
+		result[scimUser.UserId] = scimUser
+	}
+	return result, nil
+}
+
+// SaveSCIMUserWithTx creates or updates the SCIM link of a user. The userName
+// is checked inside tx so a rename cannot collide with another SCIM user.
+func SaveSCIMUserWithTx(tx *gorm.DB, scimUser *SCIMUser) error {
+	scimUser.UserName = strings.TrimSpace(scimUser.UserName)
+	scimUser.UserNameKey = SCIMUserNameKey(scimUser.UserName)
+	if scimUser.UserId == 0 || scimUser.UserNameKey == "" {
+		return errors.New("scim user is invalid")
+	}
+	var count int64
+	if err := tx.Model(&SCIMUser{}).
+		Where("user_name_key = ? AND user_id <> ?", scimUser.UserNameKey, scimUser.UserId).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSCIMUserNameTaken
+	}
+	return tx.Save(scimUser).Error
+}
+
+func DeleteSCIMUserWithTx(tx *gorm.DB, userId int) error {
+	return tx.Where("user_id = ?", userId).Delete(&SCIMUser{}).Error
+}
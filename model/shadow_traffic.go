@@ -0,0 +1,115 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// ShadowTrafficRecord stores one mirrored request: the primary call that served
+// the client and the shadow call that was sent to the channel under evaluation.
+// Shadow calls are never billed; these rows are the only trace they leave.
+type ShadowTrafficRecord struct {
+	Id              int    `json:"id" gorm:"primaryKey"`
+	RuleName        string `json:"rule_name" gorm:"type:varchar(128);index:idx_shadow_rule_created,priority:1"`
+	RequestId       string `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId          int    `json:"user_id" gorm:"index"`
+	TokenId         int    `json:"token_id"`
+	Group           string `json:"group" gorm:"column:group;type:varchar(64)"`
+	RequestPath     string `json:"request_path" gorm:"type:varchar(255)"`
+	IsStream        bool   `json:"is_stream"`
+	PrimaryModel    string `json:"primary_model" gorm:"type:varchar(128)"`
+	ShadowModel     string `json:"shadow_model" gorm:"type:varchar(128)"`
+	PrimaryChannel  int    `json:"primary_channel"`
+	ShadowChannel   int    `json:"shadow_channel" gorm:"index"`
+	PrimaryLatency  int64  `json:"primary_latency_ms"`
+	ShadowLatency   int64  `json:"shadow_latency_ms"`
+	PrimaryPrompt   int    `json:"primary_prompt_tokens"`
+	PrimaryOutput   int    `json:"primary_completion_tokens"`
+	ShadowPrompt    int    `json:"shadow_prompt_tokens"`
+	ShadowOutput    int    `json:"shadow_completion_tokens"`
+	ShadowSuccess   bool   `json:"shadow_success"`
+	ShadowStatus    int    `json:"shadow_status_code"`
+	ShadowError     string `json:"shadow_error" gorm:"type:text"`
+	PrimaryResponse string `json:"primary_response,omitempty" gorm:"type:text"`
+	ShadowResponse  string `json:"shadow_response,omitempty" gorm:"type:text"`
+	ResponseDiff    string `json:"response_diff,omitempty" gorm:"type:text"`
+	CreatedAt       int64  `json:"created_at" gorm:"bigint;index:idx_shadow_rule_created,priority:2"`
+}
+
+type ShadowTrafficQueryParams struct {
+	RuleName       string
+	ShadowChannel  int
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+// ShadowTrafficSummary aggregates records of one rule for side-by-side comparison.
+type ShadowTrafficSummary struct {
+	RuleName            string `json:"rule_name"`
+	Count               int64  `json:"count"`
+	ShadowSuccessCount  int64  `json:"shadow_success_count"`
+	PrimaryLatencyMsSum int64  `json:"primary_latency_ms_sum"`
+	ShadowLatencyMsSum  int64  `json:"shadow_latency_ms_sum"`
+	PrimaryPromptSum    int64  `json:"primary_prompt_tokens_sum"`
+	PrimaryOutputSum    int64  `json:"primary_completion_tokens_sum"`
+	ShadowPromptSum     int64  `json:"shadow_prompt_tokens_sum"`
+	ShadowOutputSum     int64  `json:"shadow_completion_tokens_sum"`
+}
+
+func (record *ShadowTrafficRecord) Insert() error {
+	if record.CreatedAt == 0 {
+		record.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(record).Error
+}
+
+func shadowTrafficQuery(params ShadowTrafficQueryParams) *gorm.DB {
+	query := DB.Model(&ShadowTrafficRecord{})
+	if params.RuleName != "" {
+		query = query.Where("rule_name = ?", params.RuleName)
+	}
+	if params.ShadowChannel != 0 {
+		query = query.Where("shadow_channel = ?", params.ShadowChannel)
+	}
+	if params.StartTimestamp != 0 {
+		query = query.Where("created_at >= ?", params.StartTimestamp)
+	}
+	if params.EndTimestamp != 0 {
+		query = query.Where("created_at <= ?", params.EndTimestamp)
+	}
+	return query
+}
+
+func GetShadowTrafficRecords(params ShadowTrafficQueryParams, startIdx int, num int) ([]*ShadowTrafficRecord, int64, error) {
+	var total int64
+	if err := shadowTrafficQuery(params).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []*ShadowTrafficRecord
+	err := shadowTrafficQuery(params).Order("id desc").Limit(num).Offset(startIdx).Find(&records).Error
+	return records, total, err
+}
+
+func GetShadowTrafficSummaries(params ShadowTrafficQueryParams) ([]ShadowTrafficSummary, error) {
+	var summaries []ShadowTrafficSummary
+	err := shadowTrafficQuery(params).
+		Select("rule_name, COUNT(*) as count, "+
+			"SUM(CASE WHEN shadow_success = ? THEN 1 ELSE 0 END) as shadow_success_count, "+
+			"SUM(primary_latency) as primary_latency_ms_sum, SUM(shadow_latency) as shadow_latency_ms_sum, "+
+			"SUM(primary_prompt) as primary_prompt_sum, SUM(primary_output) as primary_output_sum, "+
+			"SUM(shadow_prompt) as shadow_prompt_sum, SUM(shadow_output) as shadow_output_sum", true).
+		Group("rule_name").
+		Order("rule_name").
+		Scan(&summaries).Error
+	return summaries, err
+}
+
+func DeleteShadowTrafficRecords(ruleName string) (int64, error) {
+	query := DB.Where("1 = 1")
+	if ruleName != "" {
+		query = DB.Where("rule_name = ?", ruleName)
+	}
+	result := query.Delete(&ShadowTrafficRecord{})
+	return result.RowsAffected, result.Error
+}
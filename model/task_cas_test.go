@@ -41,6 +41,12 @@ func TestMain(m *testing.M) {
 		&AuthFlow{},
 		&ExternalIdentityClaim{},
 		&Token{},
+		&DerivedToken{},
+		&Organization{},
+		&OrganizationMember{},
+		&Reseller{},
+		&SAMLProvider{},
+		&SCIMUser{},
 		&PasskeyCredential{},
 		&TwoFA{},
 		&TwoFABackupCode{},
@@ -75,6 +81,12 @@ func truncateTables(t *testing.T) {
 		DB.Exec("DELETE FROM two_fa_backup_codes")
 		DB.Exec("DELETE FROM two_fas")
 		DB.Exec("DELETE FROM tokens")
+		DB.Exec("DELETE FROM derived_tokens")
+		DB.Exec("DELETE FROM scim_users")
+		DB.Exec("DELETE FROM organizations")
+		DB.Exec("DELETE FROM organization_members")
+		DB.Exec("DELETE FROM resellers")
+		DB.Exec("DELETE FROM saml_providers")
 		DB.Exec("DELETE FROM user_oauth_bindings")
 		DB.Exec("DELETE FROM users")
 		DB.Exec("DELETE FROM logs")
@@ -15,6 +15,8 @@ type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index"`
 	Key                string         `json:"key" gorm:"type:varchar(128);uniqueIndex"`
+	KeyPrefix          string         `json:"key_prefix" gorm:"type:varchar(16);default:''"` // 哈希令牌的展示前缀
+	KeyHashed          bool           `json:"key_hashed" gorm:"default:false"`               // key 字段保存的是哈希
 	Status             int            `json:"status" gorm:"default:1"`
 	Name               string         `json:"name" gorm:"index" `
 	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
@@ -29,6 +31,18 @@ type Token struct {
 	Group              string         `json:"group" gorm:"default:''"`
 	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
 	AutoGroups         string         `json:"-" gorm:"type:text"`
+	SystemPrompt       string         `json:"system_prompt" gorm:"type:text"`                     // 注入到请求系统提示词开头
+	SystemPromptSuffix string         `json:"system_prompt_suffix" gorm:"type:text"`              // 追加到请求系统提示词末尾
+	Scopes             string         `json:"-" gorm:"type:text"`                                 // 权限范围，JSON 格式的 TokenScopes
+	BudgetPeriod       string         `json:"budget_period" gorm:"type:varchar(16);default:''"`   // 周期预算：daily/weekly/monthly
+	BudgetQuota        int            `json:"budget_quota" gorm:"default:0"`                      // 每个周期的额度上限，0 表示不限
+	BudgetTimezone     string         `json:"budget_timezone" gorm:"type:varchar(64);default:''"` // 周期边界的时区，为空使用服务器时区
+	BudgetAlertPercent int            `json:"budget_alert_percent" gorm:"default:0"`              // 周期用量达到该百分比时提醒
+	BudgetSoftLimit    bool           `json:"budget_soft_limit" gorm:"default:false"`             // 超出预算只提醒不拦截
+	BudgetWindowEnd    int64          `json:"budget_window_end" gorm:"bigint;default:0"`          // 当前周期的结束时间
+	BudgetUsedBase     int            `json:"-" gorm:"default:0"`                                 // 当前周期开始时的 used_quota
+	BudgetAlerted      bool           `json:"-" gorm:"default:false"`                             // 当前周期是否已提醒
+	OrgId              int            `json:"org_id" gorm:"index;default:0"`                      // 组织令牌从组织钱包扣费，0 表示个人令牌
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -73,11 +87,22 @@ func MaskTokenKey(key string) string {
 	return key[:4] + "**********" + key[len(key)-4:]
 }
 
+// GetFullKey returns the plaintext key, or "" for hashed tokens whose key
+// cannot be recovered.
 func (token *Token) GetFullKey() string {
+	if token.KeyHashed {
+		return ""
+	}
 	return token.Key
 }
 
 func (token *Token) GetMaskedKey() string {
+	if token.KeyHashed {
+		if token.KeyPrefix == "" {
+			return "**********"
+		}
+		return token.KeyPrefix + "**********"
+	}
 	return MaskTokenKey(token.Key)
 }
 
@@ -198,7 +223,14 @@ func SearchUserTokens(userId int, keyword string, token string, offset int, limi
 		if err != nil {
 			return nil, 0, err
 		}
-		baseQuery = baseQuery.Where(commonKeyCol+" LIKE ? ESCAPE '!'", tokenPattern)
+		if strings.Contains(tokenPattern, "%") {
+			// 哈希令牌只能按展示前缀模糊搜索
+			baseQuery = baseQuery.Where("((key_hashed = ? AND "+commonKeyCol+" LIKE ? ESCAPE '!') OR (key_hashed = ? AND key_prefix LIKE ? ESCAPE '!'))",
+				false, tokenPattern, true, tokenPattern)
+		} else {
+			baseQuery = baseQuery.Where("((key_hashed = ? AND "+commonKeyCol+" = ?) OR (key_hashed = ? AND "+commonKeyCol+" = ?))",
+				false, token, true, HashTokenKey(token))
+		}
 	}
 
 	// 先查匹配总数（用于分页，受 maxTokens 上限保护，避免全表 COUNT）
@@ -221,34 +253,9 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	if key == "" {
 		return nil, ErrTokenNotProvided
 	}
-	token, err = GetTokenByKey(key, false)
+	token, err = GetTokenByAPIKey(key, false)
 	if err == nil {
-		if token.Status == common.TokenStatusExhausted ||
-			token.Status == common.TokenStatusExpired ||
-			token.Status != common.TokenStatusEnabled {
-			return token, ErrTokenInvalid
-		}
-		if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
-			if !common.RedisEnabled {
-				token.Status = common.TokenStatusExpired
-				err := token.SelectUpdate()
-				if err != nil {
-					common.SysLog("failed to update token status" + err.Error())
-				}
-			}
-			return token, ErrTokenInvalid
-		}
-		if !token.UnlimitedQuota && token.RemainQuota <= 0 {
-			if !common.RedisEnabled {
-				token.Status = common.TokenStatusExhausted
-				err := token.SelectUpdate()
-				if err != nil {
-					common.SysLog("failed to update token status" + err.Error())
-				}
-			}
-			return token, ErrTokenInvalid
-		}
-		return token, nil
+		return token, checkTokenUsable(token)
 	}
 	common.SysLog("ValidateUserToken: failed to get token: " + err.Error())
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -257,6 +264,36 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
 }
 
+// checkTokenUsable 检查令牌状态、过期时间与剩余额度，未启用 Redis 时顺便更新过期/耗尽状态。
+func checkTokenUsable(token *Token) error {
+	if token.Status == common.TokenStatusExhausted ||
+		token.Status == common.TokenStatusExpired ||
+		token.Status != common.TokenStatusEnabled {
+		return ErrTokenInvalid
+	}
+	if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
+		if !common.RedisEnabled {
+			token.Status = common.TokenStatusExpired
+			err := token.SelectUpdate()
+			if err != nil {
+				common.SysLog("failed to update token status" + err.Error())
+			}
+		}
+		return ErrTokenInvalid
+	}
+	if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		if !common.RedisEnabled {
+			token.Status = common.TokenStatusExhausted
+			err := token.SelectUpdate()
+			if err != nil {
+				common.SysLog("failed to update token status" + err.Error())
+			}
+		}
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
 func GetTokenByIds(id int, userId int) (*Token, error) {
 	if id == 0 || userId == 0 {
 		return nil, errors.New("id 或 userId 为空！")
@@ -290,14 +327,47 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	if err = DB.Where(commonKeyCol+" = ?", key).First(token).Error; err != nil {
 		return nil, err
 	}
-	if common.RedisEnabled {
-		// 冷缓存时用数据库快照初始化；已存在的哈希只刷新 TTL，
-		// 避免快照覆盖 Redis 中已被原子预扣的余额。初始化失败不影响本次读取。
-		if _, cacheErr := cacheInitToken(*token); cacheErr != nil {
-			common.SysLog("failed to init token cache: " + cacheErr.Error())
+	initTokenCache(token)
+	return token, nil
+}
+
+// GetTokenByAPIKey looks up the token of a key presented by a client (without
+// the sk- prefix). Unlike GetTokenByKey, which takes the stored key, it matches
+// hashed tokens by the hash of key and legacy tokens by the plaintext.
+func GetTokenByAPIKey(key string, fromDB bool) (*Token, error) {
+	if key == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	hashed := HashTokenKey(key)
+	if !fromDB && common.RedisEnabled {
+		for _, lookup := range []string{hashed, key} {
+			if token, err := cacheGetTokenByKey(lookup); err == nil && token.matchesAPIKey(key, hashed) {
+				return token, nil
+			}
 		}
 	}
-	return token, nil
+	var tokens []Token
+	if err := DB.Where(commonKeyCol+" IN ?", []string{hashed, key}).Limit(2).Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		if tokens[i].matchesAPIKey(key, hashed) {
+			initTokenCache(&tokens[i])
+			return &tokens[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func initTokenCache(token *Token) {
+	if !common.RedisEnabled {
+		return
+	}
+	// 冷缓存时用数据库快照初始化；已存在的哈希只刷新 TTL，
+	// 避免快照覆盖 Redis 中已被原子预扣的余额。初始化失败不影响本次读取。
+	if _, cacheErr := cacheInitToken(*token); cacheErr != nil {
+		common.SysLog("failed to init token cache: " + cacheErr.Error())
+	}
 }
 
 func (token *Token) Insert() error {
@@ -313,7 +383,9 @@ func (token *Token) Update() (err error) {
 		common.SysLog("failed to invalidate token cache before update: " + cacheErr.Error())
 	}
 	return DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "auto_groups").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "auto_groups",
+		"system_prompt", "system_prompt_suffix", "scopes", "budget_period", "budget_quota", "budget_timezone",
+		"budget_alert_percent", "budget_soft_limit").Updates(token).Error
 }
 
 func (token *Token) SelectUpdate() (err error) {
@@ -472,12 +544,30 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 
 func GetTokenKeysByIds(ids []int, userId int) ([]Token, error) {
 	var tokens []Token
-	err := DB.Select("id", commonKeyCol).
+	err := DB.Select("id", commonKeyCol, "key_hashed").
 		Where("user_id = ? AND id IN (?)", userId, ids).
 		Find(&tokens).Error
 	return tokens, err
 }
 
+// DisableUserTokens 禁用用户全部已启用的令牌并清理令牌缓存，用于账号被取消开通等需要
+// 立即阻断 API 访问的场景。派生令牌依赖父令牌状态，随父令牌一并失效。
+func DisableUserTokens(userId int) (int64, error) {
+	if userId <= 0 {
+		return 0, errors.New("userId 无效")
+	}
+	result := DB.Model(&Token{}).
+		Where("user_id = ? AND status = ?", userId, common.TokenStatusEnabled).
+		Update("status", common.TokenStatusDisabled)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := InvalidateUserTokensCache(userId); err != nil {
+		common.SysLog(fmt.Sprintf("failed to invalidate tokens cache for user %d: %s", userId, err.Error()))
+	}
+	return result.RowsAffected, nil
+}
+
 // InvalidateUserTokensCache 清理指定用户所有令牌在 Redis 中的缓存，
 // 配合 InvalidateUserCache 使用，可在用户被禁用/删除时立即阻断其令牌的请求。
 // 下一次请求将从数据库重新加载令牌及用户状态，从而立即识别出被禁用的用户。
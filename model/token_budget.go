@@ -0,0 +1,227 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 令牌周期预算：在生命周期额度（RemainQuota）之外，按日/周/月限制令牌的消费。
+// 周期用量 = used_quota - budget_used_base，周期切换时把 budget_used_base 设为当时的
+// used_quota，因此所有扣费、退款路径无需额外记账，预扣时与剩余额度在同一原子操作中校验。
+// 周期边界按令牌配置的时区计算；过期的周期在下一次预扣时惰性切换，
+// 同时由系统任务 token_budget 定期切换并发送用量提醒。
+
+const (
+	TokenBudgetPeriodDaily   = "daily"
+	TokenBudgetPeriodWeekly  = "weekly"
+	TokenBudgetPeriodMonthly = "monthly"
+)
+
+// ValidateTokenBudget checks the budget period and timezone of a token.
+func ValidateTokenBudget(period string, timezone string) error {
+	switch period {
+	case TokenBudgetPeriodDaily, TokenBudgetPeriodWeekly, TokenBudgetPeriodMonthly:
+	default:
+		return fmt.Errorf("invalid budget period %q", period)
+	}
+	if _, err := loadTokenBudgetLocation(timezone); err != nil {
+		return fmt.Errorf("invalid budget timezone %q", timezone)
+	}
+	return nil
+}
+
+func loadTokenBudgetLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(timezone)
+}
+
+// TokenBudgetWindow returns the budget period containing now. Days start at
+// midnight, weeks on Monday and months on the 1st, in the given timezone.
+func TokenBudgetWindow(period string, timezone string, now time.Time) (start time.Time, end time.Time, err error) {
+	loc, err := loadTokenBudgetLocation(timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	local := now.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	switch period {
+	case TokenBudgetPeriodDaily:
+		return day, day.AddDate(0, 0, 1), nil
+	case TokenBudgetPeriodWeekly:
+		offset := (int(day.Weekday()) + 6) % 7 // 周一为一周的第一天
+		start = day.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 7), nil
+	case TokenBudgetPeriodMonthly:
+		start = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid budget period %q", period)
+}
+
+// BudgetEnabled reports whether the token has a recurring budget.
+func (token *Token) BudgetEnabled() bool {
+	return token.BudgetQuota > 0 && token.BudgetPeriod != ""
+}
+
+// GetBudgetUsed returns the quota used in the current budget period.
+func (token *Token) GetBudgetUsed() int {
+	if !token.BudgetEnabled() || token.BudgetWindowEnd <= common.GetTimestamp() {
+		return 0
+	}
+	used := token.UsedQuota - token.BudgetUsedBase
+	if used < 0 {
+		return 0
+	}
+	return used
+}
+
+// BudgetResetTime returns the end of the current budget period in the budget
+// timezone of the token.
+func (token *Token) BudgetResetTime() time.Time {
+	reset := time.Unix(token.BudgetWindowEnd, 0)
+	if loc, err := loadTokenBudgetLocation(token.BudgetTimezone); err == nil {
+		reset = reset.In(loc)
+	}
+	return reset
+}
+
+// budgetAlertPercent 返回提醒阈值；软限制未设置阈值时在用满预算时提醒。
+func (token *Token) budgetAlertPercent() int {
+	if token.BudgetAlertPercent > 0 {
+		return token.BudgetAlertPercent
+	}
+	if token.BudgetSoftLimit {
+		return 100
+	}
+	return 0
+}
+
+// InitBudgetWindow starts a new budget period for a token that is about to be
+// created, counting from its current used quota.
+func (token *Token) InitBudgetWindow() error {
+	if !token.BudgetEnabled() {
+		token.BudgetWindowEnd = 0
+		return nil
+	}
+	_, end, err := TokenBudgetWindow(token.BudgetPeriod, token.BudgetTimezone, time.Now())
+	if err != nil {
+		return err
+	}
+	token.BudgetWindowEnd = end.Unix()
+	token.BudgetUsedBase = token.UsedQuota
+	token.BudgetAlerted = false
+	return nil
+}
+
+func tokenBudgetColumns() []string {
+	return []string{"id", "user_id", "name", commonKeyCol, "used_quota", "budget_period", "budget_quota", "budget_timezone",
+		"budget_alert_percent", "budget_soft_limit", "budget_window_end", "budget_used_base", "budget_alerted"}
+}
+
+// rollTokenBudgetWindow 在令牌预算周期已结束时切换到新周期，返回是否发生了切换
+// （包括被其他请求抢先切换）。以旧的结束时间为条件更新，并发切换只会生效一次。
+func rollTokenBudgetWindow(token *Token, now time.Time) (bool, error) {
+	if !token.BudgetEnabled() || token.BudgetWindowEnd > now.Unix() {
+		return false, nil
+	}
+	_, end, err := TokenBudgetWindow(token.BudgetPeriod, token.BudgetTimezone, now)
+	if err != nil {
+		return false, err
+	}
+	if cacheErr := invalidateTokenCacheForMutation(token.Key); cacheErr != nil {
+		common.SysLog("failed to invalidate token cache before budget reset: " + cacheErr.Error())
+	}
+	err = DB.Model(&Token{}).Where("id = ? AND budget_window_end = ?", token.Id, token.BudgetWindowEnd).
+		Updates(map[string]interface{}{
+			"budget_window_end": end.Unix(),
+			"budget_used_base":  gorm.Expr("used_quota"),
+			"budget_alerted":    false,
+		}).Error
+	return err == nil, err
+}
+
+// rollTokenBudgetWindowById is called when a reservation was rejected, to tell
+// an exhausted budget apart from one whose period has just ended.
+func rollTokenBudgetWindowById(id int) (bool, error) {
+	var token Token
+	if err := DB.Select(tokenBudgetColumns()).Where("id = ?", id).First(&token).Error; err != nil {
+		return false, err
+	}
+	return rollTokenBudgetWindow(&token, time.Now())
+}
+
+// ResetTokenBudgetWindow ends the current budget period of a token, so the
+// next request starts a new one. Used after the budget period or timezone of
+// a token has been changed.
+func ResetTokenBudgetWindow(id int, key string) error {
+	if cacheErr := invalidateTokenCacheForMutation(key); cacheErr != nil {
+		common.SysLog("failed to invalidate token cache before budget reset: " + cacheErr.Error())
+	}
+	return DB.Model(&Token{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"budget_window_end": 0,
+		"budget_alerted":    false,
+	}).Error
+}
+
+// HasTokenBudgets reports whether any token has a recurring budget.
+func HasTokenBudgets() (bool, error) {
+	var ids []int
+	err := DB.Model(&Token{}).Where("budget_quota > ?", 0).Limit(1).Pluck("id", &ids).Error
+	return len(ids) > 0, err
+}
+
+// CountTokenBudgets returns the number of tokens with a recurring budget.
+func CountTokenBudgets() (int64, error) {
+	var count int64
+	err := DB.Model(&Token{}).Where("budget_quota > ?", 0).Count(&count).Error
+	return count, err
+}
+
+// TokenBudgetMaintenanceBatch processes up to limit budgeted tokens with id
+// greater than afterId: ended periods are rolled over, and tokens whose usage
+// reached the alert threshold are marked alerted and returned so the caller can
+// notify their owners. Each alert is returned at most once per period.
+func TokenBudgetMaintenanceBatch(afterId int, limit int, now time.Time) (lastId int, scanned int, rolled int, alerts []Token, err error) {
+	var tokens []Token
+	err = DB.Select(tokenBudgetColumns()).
+		Where("id > ? AND budget_quota > ?", afterId, 0).Order("id asc").Limit(limit).Find(&tokens).Error
+	if err != nil {
+		return afterId, 0, 0, nil, err
+	}
+	lastId = afterId
+	for i := range tokens {
+		token := &tokens[i]
+		lastId = token.Id
+		scanned++
+		if token.BudgetWindowEnd <= now.Unix() {
+			ok, rollErr := rollTokenBudgetWindow(token, now)
+			if rollErr != nil {
+				return lastId, scanned, rolled, alerts, fmt.Errorf("token #%d: %w", token.Id, rollErr)
+			}
+			if ok {
+				rolled++
+			}
+			continue
+		}
+		percent := token.budgetAlertPercent()
+		if percent <= 0 || token.BudgetAlerted || token.GetBudgetUsed()*100 < token.BudgetQuota*percent {
+			continue
+		}
+		result := DB.Model(&Token{}).
+			Where("id = ? AND budget_window_end = ? AND budget_alerted = ?", token.Id, token.BudgetWindowEnd, false).
+			Update("budget_alerted", true)
+		if result.Error != nil {
+			return lastId, scanned, rolled, alerts, fmt.Errorf("token #%d: %w", token.Id, result.Error)
+		}
+		if result.RowsAffected == 1 {
+			alerts = append(alerts, *token)
+		}
+	}
+	return lastId, scanned, rolled, alerts, nil
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createBudgetTestToken(t *testing.T, remainQuota int, unlimited bool, budgetQuota int, softLimit bool) Token {
+	t.Helper()
+	token := Token{
+		UserId:          1,
+		Key:             "budget-token-" + common.GetRandomString(8),
+		Name:            "budget-test",
+		Status:          common.TokenStatusEnabled,
+		ExpiredTime:     -1,
+		RemainQuota:     remainQuota,
+		UnlimitedQuota:  unlimited,
+		BudgetPeriod:    TokenBudgetPeriodDaily,
+		BudgetQuota:     budgetQuota,
+		BudgetTimezone:  "Asia/Shanghai",
+		BudgetSoftLimit: softLimit,
+	}
+	require.NoError(t, token.InitBudgetWindow())
+	require.NoError(t, token.Insert())
+	return token
+}
+
+func expireTokenBudgetWindow(t *testing.T, token Token) {
+	t.Helper()
+	require.NoError(t, invalidateTokenCacheForMutation(token.Key))
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).
+		Update("budget_window_end", common.GetTimestamp()-1).Error)
+}
+
+func TestTokenBudgetWindow(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	// 2026-03-04 17:30 UTC 是上海时间 3 月 5 日（周四）凌晨 1:30
+	now := time.Date(2026, 3, 4, 17, 30, 0, 0, time.UTC)
+
+	start, end, err := TokenBudgetWindow(TokenBudgetPeriodDaily, "Asia/Shanghai", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 5, 0, 0, 0, 0, shanghai).Unix(), start.Unix())
+	assert.Equal(t, time.Date(2026, 3, 6, 0, 0, 0, 0, shanghai).Unix(), end.Unix())
+
+	start, end, err = TokenBudgetWindow(TokenBudgetPeriodWeekly, "Asia/Shanghai", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 2, 0, 0, 0, 0, shanghai).Unix(), start.Unix())
+	assert.Equal(t, time.Date(2026, 3, 9, 0, 0, 0, 0, shanghai).Unix(), end.Unix())
+
+	start, end, err = TokenBudgetWindow(TokenBudgetPeriodMonthly, "UTC", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC).Unix(), start.Unix())
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC).Unix(), end.Unix())
+
+	_, _, err = TokenBudgetWindow("yearly", "", now)
+	assert.Error(t, err)
+	assert.Error(t, ValidateTokenBudget(TokenBudgetPeriodDaily, "Mars/Olympus"))
+	assert.NoError(t, ValidateTokenBudget(TokenBudgetPeriodMonthly, ""))
+}
+
+func TestTryReserveTokenQuotaEnforcesBudget(t *testing.T) {
+	truncateTables(t)
+	resetBatchUpdateTestState(t)
+
+	token := createBudgetTestToken(t, 1000, false, 100, false)
+	reserved, err := TryReserveTokenQuota(token.Id, token.Key, 60, false)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	reserved, err = TryReserveTokenQuota(token.Id, token.Key, 50, false)
+	require.NoError(t, err)
+	assert.False(t, reserved, "budget must stop the request although remain quota is enough")
+	reloaded := getTokenFromDB(t, token.Id)
+	assert.Equal(t, 940, reloaded.RemainQuota)
+	assert.Equal(t, 60, reloaded.GetBudgetUsed())
+
+	// 周期结束后下一次预扣自动切换周期
+	expireTokenBudgetWindow(t, token)
+	reserved, err = TryReserveTokenQuota(token.Id, token.Key, 50, false)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	reloaded = getTokenFromDB(t, token.Id)
+	assert.Equal(t, 890, reloaded.RemainQuota)
+	assert.Equal(t, 50, reloaded.GetBudgetUsed())
+	assert.Greater(t, reloaded.BudgetWindowEnd, common.GetTimestamp())
+
+	unlimited := createBudgetTestToken(t, 0, true, 100, false)
+	reserved, err = TryReserveTokenQuota(unlimited.Id, unlimited.Key, 100, true)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	reserved, err = TryReserveTokenQuota(unlimited.Id, unlimited.Key, 1, true)
+	require.NoError(t, err)
+	assert.False(t, reserved, "unlimited tokens still respect their budget")
+
+	soft := createBudgetTestToken(t, 1000, false, 100, true)
+	reserved, err = TryReserveTokenQuota(soft.Id, soft.Key, 150, false)
+	require.NoError(t, err)
+	assert.True(t, reserved, "soft limit only alerts")
+}
+
+func TestTryReserveTokenQuotaEnforcesBudgetWithRedis(t *testing.T) {
+	truncateTables(t)
+	resetBatchUpdateTestState(t)
+	useUserCacheMiniRedis(t)
+
+	token := createBudgetTestToken(t, 1000, false, 100, false)
+	reserved, err := TryReserveTokenQuota(token.Id, token.Key, 70, false)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	reserved, err = TryReserveTokenQuota(token.Id, token.Key, 31, false)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	reserved, err = TryReserveTokenQuota(token.Id, token.Key, 30, false)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	cached, err := GetTokenByKey(token.Key, false)
+	require.NoError(t, err)
+	assert.Equal(t, 100, cached.GetBudgetUsed())
+
+	expireTokenBudgetWindow(t, token)
+	reserved, err = TryReserveTokenQuota(token.Id, token.Key, 40, false)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	reloaded := getTokenFromDB(t, token.Id)
+	assert.Equal(t, 40, reloaded.GetBudgetUsed())
+}
+
+func TestTokenBudgetMaintenanceBatch(t *testing.T) {
+	truncateTables(t)
+	resetBatchUpdateTestState(t)
+
+	alerting := createBudgetTestToken(t, 1000, false, 100, false)
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", alerting.Id).Update("budget_alert_percent", 80).Error)
+	reserved, err := TryReserveTokenQuota(alerting.Id, alerting.Key, 85, false)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	expired := createBudgetTestToken(t, 1000, false, 100, false)
+	reserved, err = TryReserveTokenQuota(expired.Id, expired.Key, 30, false)
+	require.NoError(t, err)
+	require.True(t, reserved)
+	expireTokenBudgetWindow(t, expired)
+
+	createReserveTestToken(t, 1000) // 未设置预算的令牌不参与
+
+	_, scanned, rolled, alerts, err := TokenBudgetMaintenanceBatch(0, 100, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, scanned)
+	assert.Equal(t, 1, rolled)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, alerting.Id, alerts[0].Id)
+	rolledToken := getTokenFromDB(t, expired.Id)
+	assert.Equal(t, 0, rolledToken.GetBudgetUsed())
+
+	_, _, _, alerts, err = TokenBudgetMaintenanceBatch(0, 100, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, alerts, "each period alerts at most once")
+}
@@ -74,7 +74,11 @@ redis.call('HSET', KEYS[1],
   'CreatedTime', ARGV[5], 'AccessedTime', ARGV[6], 'ExpiredTime', ARGV[7],
   'UnlimitedQuota', ARGV[8], 'ModelLimitsEnabled', ARGV[9], 'ModelLimits', ARGV[10],
   'AllowIps', ARGV[11], 'Group', ARGV[12], 'CrossGroupRetry', ARGV[13],
-  'AutoGroups', ARGV[14], 'RemainQuota', ARGV[15], 'UsedQuota', ARGV[16])
+  'AutoGroups', ARGV[14], 'RemainQuota', ARGV[15], 'UsedQuota', ARGV[16],
+  'SystemPrompt', ARGV[18], 'SystemPromptSuffix', ARGV[19], 'KeyHashed', ARGV[20],
+  'Scopes', ARGV[21], 'BudgetPeriod', ARGV[22], 'BudgetQuota', ARGV[23],
+  'BudgetTimezone', ARGV[24], 'BudgetAlertPercent', ARGV[25], 'BudgetSoftLimit', ARGV[26],
+  'BudgetWindowEnd', ARGV[27], 'BudgetUsedBase', ARGV[28], 'OrgId', ARGV[29])
 redis.call('EXPIRE', KEYS[1], ARGV[17])
 return 1`
 
@@ -86,7 +90,11 @@ return 1`
 		strconv.FormatBool(token.UnlimitedQuota), strconv.FormatBool(token.ModelLimitsEnabled),
 		token.ModelLimits, allowIps, token.Group, strconv.FormatBool(token.CrossGroupRetry),
 		token.AutoGroups, token.RemainQuota, token.UsedQuota,
-		tokenCacheTTLSeconds(),
+		tokenCacheTTLSeconds(), token.SystemPrompt, token.SystemPromptSuffix,
+		strconv.FormatBool(token.KeyHashed), token.Scopes,
+		token.BudgetPeriod, token.BudgetQuota, token.BudgetTimezone, token.BudgetAlertPercent,
+		strconv.FormatBool(token.BudgetSoftLimit), token.BudgetWindowEnd, token.BudgetUsedBase,
+		token.OrgId,
 	).Int()
 }
 
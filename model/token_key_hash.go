@@ -0,0 +1,142 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// 令牌密钥以加盐哈希保存：tokens.key 存 HMAC-SHA256(盐, 明文密钥)，
+// key_prefix 保存明文前几位用于展示。明文只在创建时返回一次。
+// 迁移前创建的令牌仍以明文保存（key_hashed=false），鉴权时两种都会尝试。
+
+const (
+	tokenKeyHashSecretOptionKey = "TokenKeyHashSecret"
+	tokenKeyDisplayPrefixLength = 8
+)
+
+var (
+	tokenKeyHashSecretMu sync.RWMutex
+	tokenKeyHashSecret   []byte
+)
+
+// InitTokenKeyHashSecret loads the salt used to hash token keys. TOKEN_KEY_HASH_SECRET
+// takes precedence; otherwise a random salt is generated on first start and
+// persisted in the options table. Changing the salt invalidates all hashed keys.
+func InitTokenKeyHashSecret() error {
+	if secret := os.Getenv("TOKEN_KEY_HASH_SECRET"); secret != "" {
+		setTokenKeyHashSecret(secret)
+		return nil
+	}
+	generated, err := common.GenerateRandomKey(48)
+	if err != nil {
+		return err
+	}
+	// 多个节点同时首次启动时以先写入的为准
+	if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&Option{Key: tokenKeyHashSecretOptionKey, Value: generated}).Error; err != nil {
+		return err
+	}
+	var option Option
+	if err := DB.Where(commonKeyCol+" = ?", tokenKeyHashSecretOptionKey).First(&option).Error; err != nil {
+		return err
+	}
+	if option.Value == "" {
+		return errors.New("token key hash secret is empty")
+	}
+	setTokenKeyHashSecret(option.Value)
+	return nil
+}
+
+func setTokenKeyHashSecret(secret string) {
+	tokenKeyHashSecretMu.Lock()
+	defer tokenKeyHashSecretMu.Unlock()
+	tokenKeyHashSecret = []byte(secret)
+}
+
+// HashTokenKey returns the stored form of a token key (without the sk- prefix).
+func HashTokenKey(key string) string {
+	tokenKeyHashSecretMu.RLock()
+	defer tokenKeyHashSecretMu.RUnlock()
+	return common.GenerateHMACWithKey(tokenKeyHashSecret, key)
+}
+
+func tokenKeyDisplayPrefix(key string) string {
+	if len(key) <= tokenKeyDisplayPrefixLength {
+		return ""
+	}
+	return key[:tokenKeyDisplayPrefixLength]
+}
+
+// SetHashedKey stores key as a salted hash plus a display prefix. The caller
+// must return the plaintext key to the user now, it cannot be recovered later.
+func (token *Token) SetHashedKey(key string) {
+	token.Key = HashTokenKey(key)
+	token.KeyPrefix = tokenKeyDisplayPrefix(key)
+	token.KeyHashed = true
+}
+
+// matchesAPIKey 校验令牌是否由客户端提交的密钥命中：哈希令牌只能由明文的哈希命中，
+// 防止泄露的哈希值被直接当作密钥使用。
+func (token *Token) matchesAPIKey(key string, hashed string) bool {
+	if token.KeyHashed {
+		return token.Key == hashed
+	}
+	return token.Key == key
+}
+
+// IsTokenKeyOf reports whether storedKey (the token_key of a request) belongs to
+// the plaintext apiKey, for both hashed and legacy tokens.
+func IsTokenKeyOf(storedKey string, apiKey string) bool {
+	if storedKey == "" || apiKey == "" {
+		return false
+	}
+	return storedKey == apiKey || storedKey == HashTokenKey(apiKey)
+}
+
+// HashLegacyTokenKeysBatch hashes up to limit plaintext token keys with id greater
+// than afterId, including soft-deleted tokens. It returns the last scanned id,
+// the number of scanned rows and the number of hashed rows.
+func HashLegacyTokenKeysBatch(afterId int, limit int) (lastId int, scanned int, hashed int, err error) {
+	var tokens []Token
+	err = DB.Unscoped().Select("id", commonKeyCol, "key_hashed").
+		Where("id > ?", afterId).Order("id asc").Limit(limit).Find(&tokens).Error
+	if err != nil {
+		return afterId, 0, 0, err
+	}
+	lastId = afterId
+	for _, token := range tokens {
+		lastId = token.Id
+		scanned++
+		if token.KeyHashed || token.Key == "" {
+			continue
+		}
+		if cacheErr := invalidateTokenCacheForMutation(token.Key); cacheErr != nil {
+			common.SysLog("failed to invalidate token cache before key hashing: " + cacheErr.Error())
+		}
+		result := DB.Unscoped().Model(&Token{}).
+			Where("id = ? AND key_hashed = ?", token.Id, false).
+			Where(commonKeyCol+" = ?", token.Key).
+			Updates(map[string]interface{}{
+				"key":        HashTokenKey(token.Key),
+				"key_prefix": tokenKeyDisplayPrefix(token.Key),
+				"key_hashed": true,
+			})
+		if result.Error != nil {
+			return lastId, scanned, hashed, fmt.Errorf("token #%d: %w", token.Id, result.Error)
+		}
+		hashed += int(result.RowsAffected)
+	}
+	return lastId, scanned, hashed, nil
+}
+
+// CountAllTokens returns the number of tokens including soft-deleted ones.
+func CountAllTokens() (int64, error) {
+	var count int64
+	err := DB.Unscoped().Model(&Token{}).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func seedTokenKeyHashToken(t *testing.T, name string, key string, hashed bool) *Token {
+	t.Helper()
+	token := &Token{
+		UserId:         1,
+		Name:           name,
+		Status:         common.TokenStatusEnabled,
+		ExpiredTime:    -1,
+		UnlimitedQuota: true,
+	}
+	if hashed {
+		token.SetHashedKey(key)
+	} else {
+		token.Key = key
+	}
+	require.NoError(t, DB.Create(token).Error)
+	return token
+}
+
+func TestGetTokenByAPIKeyMatchesHashedAndLegacyTokens(t *testing.T) {
+	truncateTables(t)
+	hashed := seedTokenKeyHashToken(t, "hashed", "hashedkey1234567890", true)
+	legacy := seedTokenKeyHashToken(t, "legacy", "legacykey1234567890", false)
+
+	token, err := GetTokenByAPIKey("hashedkey1234567890", false)
+	require.NoError(t, err)
+	require.Equal(t, hashed.Id, token.Id)
+	token, err = ValidateUserToken("legacykey1234567890")
+	require.NoError(t, err)
+	require.Equal(t, legacy.Id, token.Id)
+
+	// 泄露的哈希值不能直接当作密钥使用
+	_, err = GetTokenByAPIKey(hashed.Key, false)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	require.True(t, IsTokenKeyOf(hashed.Key, "hashedkey1234567890"))
+	require.True(t, IsTokenKeyOf(legacy.Key, "legacykey1234567890"))
+	require.False(t, IsTokenKeyOf(hashed.Key, hashed.Key+"x"))
+
+	tokens, _, err := SearchUserTokens(1, "", "sk-hashedkey1234567890", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	tokens, _, err = SearchUserTokens(1, "", "hashedke%", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.Equal(t, hashed.Id, tokens[0].Id)
+}
+
+func TestHashLegacyTokenKeysBatch(t *testing.T) {
+	truncateTables(t)
+	seedTokenKeyHashToken(t, "hashed", "hashedkey1234567890", true)
+	legacy := seedTokenKeyHashToken(t, "legacy", "legacykey1234567890", false)
+	deleted := seedTokenKeyHashToken(t, "deleted", "deletedkey123456789", false)
+	require.NoError(t, DB.Delete(deleted).Error)
+
+	_, scanned, hashed, err := HashLegacyTokenKeysBatch(0, 100)
+	require.NoError(t, err)
+	require.Equal(t, 3, scanned)
+	require.Equal(t, 2, hashed)
+
+	var migrated Token
+	require.NoError(t, DB.First(&migrated, "id = ?", legacy.Id).Error)
+	require.True(t, migrated.KeyHashed)
+	require.Equal(t, "legacyke", migrated.KeyPrefix)
+	require.Empty(t, migrated.GetFullKey())
+	token, err := GetTokenByAPIKey("legacykey1234567890", true)
+	require.NoError(t, err)
+	require.Equal(t, legacy.Id, token.Id)
+
+	var deletedToken Token
+	require.NoError(t, DB.Unscoped().First(&deletedToken, "id = ?", deleted.Id).Error)
+	require.True(t, deletedToken.KeyHashed)
+
+	_, _, hashed, err = HashLegacyTokenKeysBatch(0, 100)
+	require.NoError(t, err)
+	require.Zero(t, hashed)
+}
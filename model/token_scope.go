@@ -0,0 +1,217 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 令牌权限范围中可限制的接口类别
+const (
+	TokenScopeEndpointChat        = "chat"        // /v1/chat/completions、/v1/completions
+	TokenScopeEndpointMessages    = "messages"    // Claude /v1/messages
+	TokenScopeEndpointResponses   = "responses"   // /v1/responses
+	TokenScopeEndpointGemini      = "gemini"      // Gemini generateContent
+	TokenScopeEndpointEmbeddings  = "embeddings"  // OpenAI / Gemini 向量
+	TokenScopeEndpointModerations = "moderations" // /v1/moderations
+	TokenScopeEndpointImages      = "images"      // 图片生成与编辑
+	TokenScopeEndpointAudio       = "audio"       // 语音合成与识别
+	TokenScopeEndpointRerank      = "rerank"      // /v1/rerank
+	TokenScopeEndpointRealtime    = "realtime"    // /v1/realtime
+	TokenScopeEndpointSearch      = "search"      // /v1/alpha/search
+	TokenScopeEndpointMidjourney  = "midjourney"  // /mj
+	TokenScopeEndpointSuno        = "suno"        // /suno
+	TokenScopeEndpointVideo       = "video"       // 视频任务
+)
+
+var tokenScopeEndpoints = []string{
+	TokenScopeEndpointChat,
+	TokenScopeEndpointMessages,
+	TokenScopeEndpointResponses,
+	TokenScopeEndpointGemini,
+	TokenScopeEndpointEmbeddings,
+	TokenScopeEndpointModerations,
+	TokenScopeEndpointImages,
+	TokenScopeEndpointAudio,
+	TokenScopeEndpointRerank,
+	TokenScopeEndpointRealtime,
+	TokenScopeEndpointSearch,
+	TokenScopeEndpointMidjourney,
+	TokenScopeEndpointSuno,
+	TokenScopeEndpointVideo,
+}
+
+// TokenScopes 令牌的权限范围，零值表示不做限制。
+type TokenScopes struct {
+	Endpoints         []string `json:"endpoints,omitempty"`          // 允许访问的接口类别，为空表示不限
+	DeniedEndpoints   []string `json:"denied_endpoints,omitempty"`   // 禁止访问的接口类别，优先于 Endpoints
+	MaxTokens         int      `json:"max_tokens,omitempty"`         // 单次请求 max_tokens 上限
+	MaxRequestQuota   int      `json:"max_request_quota,omitempty"`  // 单次请求预估费用上限（额度）
+	DisableTools      bool     `json:"disable_tools,omitempty"`      // 禁止携带工具定义
+	DisableWebSearch  bool     `json:"disable_web_search,omitempty"` // 禁止联网搜索
+	DisableImageInput bool     `json:"disable_image_input,omitempty"`
+}
+
+// TokenScopeEndpoints returns the endpoint categories a token scope can name.
+func TokenScopeEndpoints() []string {
+	return append([]string(nil), tokenScopeEndpoints...)
+}
+
+func isTokenScopeEndpoint(endpoint string) bool {
+	for _, e := range tokenScopeEndpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEmpty reports whether the scopes place no restriction on the token.
+func (scopes *TokenScopes) IsEmpty() bool {
+	return scopes == nil || (len(scopes.Endpoints) == 0 && len(scopes.DeniedEndpoints) == 0 &&
+		scopes.MaxTokens == 0 && scopes.MaxRequestQuota == 0 &&
+		!scopes.DisableTools && !scopes.DisableWebSearch && !scopes.DisableImageInput)
+}
+
+// Normalize trims and deduplicates endpoint names and checks every value.
+func (scopes *TokenScopes) Normalize() error {
+	var err error
+	if scopes.Endpoints, err = normalizeTokenScopeEndpoints(scopes.Endpoints); err != nil {
+		return err
+	}
+	if scopes.DeniedEndpoints, err = normalizeTokenScopeEndpoints(scopes.DeniedEndpoints); err != nil {
+		return err
+	}
+	if scopes.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	if scopes.MaxRequestQuota < 0 {
+		return fmt.Errorf("max_request_quota must not be negative")
+	}
+	return nil
+}
+
+func normalizeTokenScopeEndpoints(endpoints []string) ([]string, error) {
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(endpoints))
+	seen := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		endpoint = strings.ToLower(strings.TrimSpace(endpoint))
+		if endpoint == "" || seen[endpoint] {
+			continue
+		}
+		if !isTokenScopeEndpoint(endpoint) {
+			return nil, fmt.Errorf("unknown endpoint %q", endpoint)
+		}
+		seen[endpoint] = true
+		normalized = append(normalized, endpoint)
+	}
+	return normalized, nil
+}
+
+// AllowsEndpoint reports whether the endpoint category may be used with the token.
+func (scopes *TokenScopes) AllowsEndpoint(endpoint string) bool {
+	if scopes == nil {
+		return true
+	}
+	for _, denied := range scopes.DeniedEndpoints {
+		if denied == endpoint {
+			return false
+		}
+	}
+	if len(scopes.Endpoints) == 0 {
+		return true
+	}
+	for _, allowed := range scopes.Endpoints {
+		if allowed == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+func (token *Token) GetScopes() (*TokenScopes, error) {
+	if token.Scopes == "" {
+		return nil, nil
+	}
+	var scopes TokenScopes
+	if err := common.UnmarshalJsonStr(token.Scopes, &scopes); err != nil {
+		return nil, err
+	}
+	return &scopes, nil
+}
+
+func (token *Token) SetScopes(scopes *TokenScopes) error {
+	if scopes.IsEmpty() {
+		token.Scopes = ""
+		return nil
+	}
+	data, err := common.Marshal(scopes)
+	if err != nil {
+		return err
+	}
+	token.Scopes = string(data)
+	return nil
+}
+
+// IntersectTokenScopes returns scopes that are at least as restrictive as both
+// parent and child: allowed endpoints are intersected, denied endpoints and
+// disabled features are merged, and the smaller non-zero limit wins. Used for
+// derived tokens, which can never widen the scopes of their parent.
+func IntersectTokenScopes(parent *TokenScopes, child *TokenScopes) *TokenScopes {
+	if parent.IsEmpty() && child.IsEmpty() {
+		return nil
+	}
+	if parent == nil {
+		parent = &TokenScopes{}
+	}
+	if child == nil {
+		child = &TokenScopes{}
+	}
+	merged := &TokenScopes{
+		MaxTokens:         minPositive(parent.MaxTokens, child.MaxTokens),
+		MaxRequestQuota:   minPositive(parent.MaxRequestQuota, child.MaxRequestQuota),
+		DisableTools:      parent.DisableTools || child.DisableTools,
+		DisableWebSearch:  parent.DisableWebSearch || child.DisableWebSearch,
+		DisableImageInput: parent.DisableImageInput || child.DisableImageInput,
+	}
+	switch {
+	case len(parent.Endpoints) == 0:
+		merged.Endpoints = append([]string(nil), child.Endpoints...)
+	case len(child.Endpoints) == 0:
+		merged.Endpoints = append([]string(nil), parent.Endpoints...)
+	default:
+		for _, endpoint := range child.Endpoints {
+			if parent.AllowsEndpoint(endpoint) {
+				merged.Endpoints = append(merged.Endpoints, endpoint)
+			}
+		}
+		if len(merged.Endpoints) == 0 {
+			// 交集为空时拒绝所有接口，不能退化为不限制
+			merged.DeniedEndpoints = TokenScopeEndpoints()
+		}
+	}
+	if merged.DeniedEndpoints == nil {
+		seen := make(map[string]bool)
+		for _, endpoint := range append(append([]string(nil), parent.DeniedEndpoints...), child.DeniedEndpoints...) {
+			if !seen[endpoint] {
+				seen[endpoint] = true
+				merged.DeniedEndpoints = append(merged.DeniedEndpoints, endpoint)
+			}
+		}
+	}
+	return merged
+}
+
+func minPositive(a int, b int) int {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
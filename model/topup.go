@@ -65,6 +65,7 @@ func topUpQuotaMaxCurrent(creditedQuota int) (int, error) {
 // ValidateTopUpQuotaCapacity performs the user-facing pre-payment check. The
 // settlement path repeats the same invariant with an atomic conditional
 // update, because the wallet balance can change after checkout creation.
+// Reseller child accounts cannot top up, see CheckResellerChildSelfFunding.
 func ValidateTopUpQuotaCapacity(userId int, creditedQuota int) error {
 	maxCurrentQuota, err := topUpQuotaMaxCurrent(creditedQuota)
 	if err != nil {
@@ -72,9 +73,12 @@ func ValidateTopUpQuotaCapacity(userId int, creditedQuota int) error {
 	}
 
 	var user User
-	if err := DB.Select("quota").Where("id = ?", userId).First(&user).Error; err != nil {
+	if err := DB.Select("quota", "parent_id").Where("id = ?", userId).First(&user).Error; err != nil {
 		return err
 	}
+	if user.ParentId > 0 {
+		return ErrResellerChildSelfFunding
+	}
 	if user.Quota > maxCurrentQuota {
 		return ErrTopUpQuotaLimitExceeded
 	}
@@ -101,6 +101,7 @@ type User struct {
 	AffQuota         int                        `json:"aff_quota" gorm:"type:int;default:0;column:aff_quota"`           // 邀请剩余额度
 	AffHistoryQuota  int                        `json:"aff_history_quota" gorm:"type:int;default:0;column:aff_history"` // 邀请历史额度
 	InviterId        int                        `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	ParentId         int                        `json:"parent_id" gorm:"type:int;default:0;column:parent_id;index"` // 转售商（上级账户）ID，0 表示普通账户
 	DeletedAt        gorm.DeletedAt             `gorm:"index"`
 	LinuxDOId        string                     `json:"linux_do_id" gorm:"column:linux_do_id;index"`
 	Setting          string                     `json:"setting" gorm:"type:text;column:setting"`
@@ -122,6 +123,7 @@ func (user *User) ToBaseUser() *UserBase {
 		Username:    user.Username,
 		Setting:     user.Setting,
 		Email:       user.Email,
+		ParentId:    user.ParentId,
 		AuthVersion: user.AuthVersion,
 		CacheSchema: userCacheSchemaVersion,
 	}
@@ -214,6 +216,74 @@ func UpdateUserBindColumn(userId int, column string, value string) error {
 	return DB.Model(&User{}).Where("id = ?", userId).Update(column, value).Error
 }
 
+// BindUserColumnIfEmpty 仅在用户尚未绑定该列时写入，返回是否写入成功。
+func BindUserColumnIfEmpty(userId int, column string, value string) (bool, error) {
+	if userId <= 0 || value == "" {
+		return false, errors.New("invalid user bind")
+	}
+	if !userBindColumns[column] {
+		return false, fmt.Errorf("invalid user bind column: %s", column)
+	}
+	result := DB.Model(&User{}).
+		Where("id = ? AND ("+column+" = '' OR "+column+" IS NULL)", userId).
+		Update(column, value)
+	return result.RowsAffected == 1, result.Error
+}
+
+// UpdateUserGroupFromIdentityProvider 由外部身份源（SAML 等）同步用户分组。
+// 分组属于鉴权敏感字段，变化时与管理员修改分组一致：递增 AuthVersion 并吊销已有会话。
+func UpdateUserGroupFromIdentityProvider(userId int, group string) (bool, error) {
+	if userId <= 0 || group == "" {
+		return false, errors.New("invalid user group update")
+	}
+	changed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var current User
+		if err := tx.First(&current, userId).Error; err != nil {
+			return err
+		}
+		if current.Group == group {
+			return nil
+		}
+		if _, err := IncrementUserAuthVersionWithTx(tx, userId); err != nil {
+			return err
+		}
+		changed = true
+		return tx.Model(&User{}).Where("id = ?", userId).Update("group", group).Error
+	})
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := invalidateUserCache(userId); err != nil {
+		common.SysLog(fmt.Sprintf("failed to invalidate user cache for user %d: %s", userId, err.Error()))
+	}
+	_, err = RevokeAllUserSessions(userId, "user_security_changed")
+	return true, err
+}
+
+// UpdateUserProfileFromIdentityProvider 由外部身份源（SCIM 等）同步显示名称与邮箱。
+// 两者都不是鉴权敏感字段，不提升 AuthVersion；邮箱与绑定邮箱一样在锁内校验唯一性。
+func UpdateUserProfileFromIdentityProvider(userId int, displayName string, email string) error {
+	if userId <= 0 {
+		return errors.New("id 为空！")
+	}
+	email = NormalizeEmail(email)
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		return withNormalizedEmailLock(tx, email, func(tx *gorm.DB) error {
+			if err := ensureEmailAvailableWithTx(tx, email, userId); err != nil {
+				return err
+			}
+			return tx.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+				"display_name": displayName,
+				"email":        email,
+			}).Error
+		})
+	}); err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
 // 根据用户角色生成默认的边栏配置
 func generateDefaultSidebarConfigForRole(userRole int) string {
 	defaultConfig := map[string]interface{}{}
@@ -975,6 +1045,7 @@ func deleteUserAuthenticationData(tx *gorm.DB, userId int) error {
 		&AuthFlow{},
 		&PasskeyCredential{},
 		&Token{},
+		&SCIMUser{},
 	} {
 		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(authenticationData).Error; err != nil {
 			return err
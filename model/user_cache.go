@@ -11,7 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-const userCacheSchemaVersion = 2
+const userCacheSchemaVersion = 3
 
 type UserBase struct {
 	Id          int    `json:"id"`
@@ -22,6 +22,7 @@ type UserBase struct {
 	Role        int    `json:"role"`
 	Username    string `json:"username"`
 	Setting     string `json:"setting"`
+	ParentId    int    `json:"parent_id"`
 	AuthVersion int64  `json:"-"`
 	CacheSchema int    `json:"-"`
 }
@@ -33,6 +34,9 @@ func (user *UserBase) WriteContext(c *gin.Context) {
 	common.SetContextKey(c, constant.ContextKeyUserEmail, user.Email)
 	common.SetContextKey(c, constant.ContextKeyUserName, user.Username)
 	common.SetContextKey(c, constant.ContextKeyUserSetting, user.GetSetting())
+	if user.ParentId > 0 {
+		common.SetContextKey(c, constant.ContextKeyUserParentId, user.ParentId)
+	}
 }
 
 func (user *UserBase) GetSetting() dto.UserSetting {
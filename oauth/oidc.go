@@ -38,6 +38,8 @@ type oidcUser struct {
 	Name              string `json:"name"`
 	PreferredUsername string `json:"preferred_username"`
 	Picture           string `json:"picture"`
+	// 部分 IdP 以字符串 "true" 下发
+	EmailVerified any `json:"email_verified"`
 }
 
 func (p *OIDCProvider) GetName() string {
@@ -156,6 +158,9 @@ func (p *OIDCProvider) GetUserInfo(ctx context.Context, token *OAuthToken) (*OAu
 		Username:       oidcUser.PreferredUsername,
 		DisplayName:    oidcUser.Name,
 		Email:          oidcUser.Email,
+		Extra: map[string]any{
+			"email_verified": oidcUser.EmailVerified == true || oidcUser.EmailVerified == "true",
+		},
 	}, nil
 }
 
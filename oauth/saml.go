@@ -0,0 +1,251 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	samlKeyBits             = 2048
+	samlCertificateValidFor = 10 * 365 * 24 * time.Hour
+
+	SAMLNameIDFormatEmail     = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	SAMLNameIDFormatTransient = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+)
+
+// SAMLUser is the identity asserted by a SAML IdP after attribute mapping.
+type SAMLUser struct {
+	OAuthUser
+	// Groups contains every value of the configured group attribute
+	Groups []string
+}
+
+// SAMLMetadataURL is both the SP entity ID and where the SP metadata is served.
+func SAMLMetadataURL(slug string) string {
+	return fmt.Sprintf("%s/api/saml/%s/metadata", system_setting.ServerAddress, slug)
+}
+
+// SAMLACSURL is the assertion consumer service (HTTP-POST binding).
+func SAMLACSURL(slug string) string {
+	return fmt.Sprintf("%s/api/saml/%s/acs", system_setting.ServerAddress, slug)
+}
+
+// GenerateSAMLKeyPair generates the SP RSA key and a self-signed certificate,
+// both PEM encoded. IdPs only pin the certificate, so self-signed is enough.
+func GenerateSAMLKeyPair(commonName string) (certPEM string, keyPEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, samlKeyBits)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(samlCertificateValidFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return certPEM, keyPEM, nil
+}
+
+func parseSAMLKeyPair(certPEM, keyPEM string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if certBlock == nil {
+		return nil, nil, errors.New("invalid SP certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid SP certificate: %w", err)
+	}
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, nil, errors.New("invalid SP private key")
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes); err == nil {
+		key = parsed
+	} else {
+		parsedAny, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid SP private key: %w", err)
+		}
+		rsaKey, ok := parsedAny.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("SP private key must be RSA")
+		}
+		key = rsaKey
+	}
+	return cert, key, nil
+}
+
+// ParseSAMLIdPMetadata parses IdP metadata. An EntitiesDescriptor is accepted
+// as long as it contains exactly one IdP.
+func ParseSAMLIdPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err != nil {
+		var entities saml.EntitiesDescriptor
+		if err2 := xml.Unmarshal(data, &entities); err2 != nil {
+			return nil, fmt.Errorf("invalid IdP metadata: %w", err)
+		}
+		var found *saml.EntityDescriptor
+		for i := range entities.EntityDescriptors {
+			if len(entities.EntityDescriptors[i].IDPSSODescriptors) == 0 {
+				continue
+			}
+			if found != nil {
+				return nil, errors.New("IdP metadata contains more than one IdP")
+			}
+			found = &entities.EntityDescriptors[i]
+		}
+		if found == nil {
+			return nil, errors.New("IdP metadata contains no IdP")
+		}
+		entity = *found
+	}
+	if entity.EntityID == "" || len(entity.IDPSSODescriptors) == 0 {
+		return nil, errors.New("IdP metadata contains no IDPSSODescriptor")
+	}
+	hasSigningKey := false
+	for _, descriptor := range entity.IDPSSODescriptors {
+		for _, keyDescriptor := range descriptor.KeyDescriptors {
+			if keyDescriptor.Use == "" || keyDescriptor.Use == "signing" {
+				hasSigningKey = true
+			}
+		}
+	}
+	if !hasSigningKey {
+		return nil, errors.New("IdP metadata contains no signing certificate")
+	}
+	return &entity, nil
+}
+
+// NewSAMLServiceProvider builds the SP for one configured IdP. IdP-initiated
+// logins are rejected: every response must answer an AuthnRequest we issued.
+func NewSAMLServiceProvider(config *model.SAMLProvider) (*saml.ServiceProvider, error) {
+	cert, key, err := parseSAMLKeyPair(config.SPCertificate, config.SPPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	idpMetadata, err := ParseSAMLIdPMetadata([]byte(config.IdPMetadata))
+	if err != nil {
+		return nil, err
+	}
+	metadataURL, err := url.Parse(SAMLMetadataURL(config.Slug))
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := url.Parse(SAMLACSURL(config.Slug))
+	if err != nil {
+		return nil, err
+	}
+	sp := &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.NameIDFormat(config.NameIDFormat),
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+		AllowIDPInitiated: false,
+	}
+	if config.NameIDFormat == "" {
+		sp.AuthnNameIDFormat = saml.UnspecifiedNameIDFormat
+	}
+	return sp, nil
+}
+
+// SAMLUserFromAssertion applies the provider's attribute mapping to a
+// verified assertion. The NameID is the stable binding subject.
+func SAMLUserFromAssertion(config *model.SAMLProvider, assertion *saml.Assertion) (*SAMLUser, error) {
+	if assertion == nil || assertion.Subject == nil || assertion.Subject.NameID == nil {
+		return nil, errors.New("SAML assertion has no NameID")
+	}
+	nameID := strings.TrimSpace(assertion.Subject.NameID.Value)
+	if nameID == "" {
+		return nil, errors.New("SAML assertion has no NameID")
+	}
+	// 临时 NameID 每次登录都会变化，无法用于绑定账号
+	if assertion.Subject.NameID.Format == SAMLNameIDFormatTransient {
+		return nil, errors.New("SAML transient NameID cannot identify a user")
+	}
+	user := &SAMLUser{
+		OAuthUser: OAuthUser{
+			ProviderUserID: model.SAMLSubject(nameID),
+			Username:       firstSAMLAttribute(assertion, config.UsernameAttribute),
+			DisplayName:    firstSAMLAttribute(assertion, config.DisplayNameAttribute),
+			Email:          firstSAMLAttribute(assertion, config.EmailAttribute),
+			Extra:          map[string]any{"name_id": nameID},
+		},
+		Groups: samlAttributeValues(assertion, config.GroupAttribute),
+	}
+	if user.Email == "" && assertion.Subject.NameID.Format == SAMLNameIDFormatEmail {
+		user.Email = nameID
+	}
+	return user, nil
+}
+
+func samlAttributeValues(assertion *saml.Assertion, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if !strings.EqualFold(attribute.Name, name) && !strings.EqualFold(attribute.FriendlyName, name) {
+				continue
+			}
+			for _, value := range attribute.Values {
+				if v := strings.TrimSpace(value.Value); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func firstSAMLAttribute(assertion *saml.Assertion, name string) string {
+	values := samlAttributeValues(assertion, name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// SAMLAssertionExpiresAt returns until when the assertion could be replayed,
+// used to size the replay-protection record.
+func SAMLAssertionExpiresAt(assertion *saml.Assertion) time.Time {
+	expiresAt := time.Now().Add(saml.MaxIssueDelay)
+	if assertion.Conditions != nil && assertion.Conditions.NotOnOrAfter.After(expiresAt) {
+		expiresAt = assertion.Conditions.NotOnOrAfter
+	}
+	return expiresAt.Add(saml.MaxClockSkew)
+}
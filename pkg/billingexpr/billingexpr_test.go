@@ -970,6 +970,21 @@ func TestImageAudioZero(t *testing.T) {
 	}
 }
 
+func TestCacheStorageVariable(t *testing.T) {
+	exprStr := `tier("base", p * 0.3 + c * 2.5 + cr * 0.075 + csh * 1)`
+	// storage settlement: only csh is set
+	cost, _, err := billingexpr.RunExpr(exprStr, billingexpr.TokenParams{CSH: 100000 * 2.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(cost-250000) > 1e-6 {
+		t.Errorf("cost = %f, want 250000", cost)
+	}
+	if !billingexpr.UsedVars(exprStr)["csh"] {
+		t.Error("csh should be reported as used")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // len variable tests — tier conditions based on context length
 // ---------------------------------------------------------------------------
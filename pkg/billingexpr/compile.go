@@ -128,6 +128,7 @@ var compileEnvPrototypeV1 = map[string]interface{}{
 	"cr":         float64(0),
 	"cc":         float64(0),
 	"cc1h":       float64(0),
+	"csh":        float64(0),
 	"img":        float64(0),
 	"img_o":      float64(0),
 	"ai":         float64(0),
@@ -16,6 +16,7 @@ import (
 //   - p, c             — prompt / completion tokens (auto-excluding separately-priced sub-categories)
 //   - len              — total input context length for tier conditions (never reduced by sub-category exclusion)
 //   - cr, cc, cc1h     — cache read / creation / creation-1h tokens
+//   - csh              — cached-content storage token-hours (storage charges only)
 //   - tier(name, value) — trace callback that records which tier matched
 //   - max, min, abs, ceil, floor — standard math helpers
 //
@@ -61,6 +62,7 @@ func runProgram(prog *vm.Program, requestRules []RequestRuleTrace, params TokenP
 		"cr":    params.CR,
 		"cc":    params.CC,
 		"cc1h":  params.CC1h,
+		"csh":   params.CSH,
 		"img":   params.Img,
 		"img_o": params.ImgO,
 		"ai":    params.AI,
@@ -0,0 +1,51 @@
+package cohere
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newCohereTestContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	var rules map[string]interface{}
+	require.NoError(t, common.UnmarshalJsonStr(`{"operations":[{"path":"model","mode":"set","value":"my-model"}]}`, &rules))
+	common.SetContextKey(c, constant.ContextKeyChannelSetting, dto.ChannelSettings{ResponseOverride: rules})
+	info := &relaycommon.RelayInfo{OriginModelName: "command-r"}
+	info.InitChannelMeta(c)
+	info.UpstreamModelName = "command-r"
+	return c, recorder, info
+}
+
+func newCohereTestResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestCohereHandlerAppliesResponseOverride(t *testing.T) {
+	c, recorder, info := newCohereTestContext(t)
+	resp := newCohereTestResponse(`{"response_id":"r1","text":"hi","finish_reason":"COMPLETE","meta":{"billed_units":{"input_tokens":3,"output_tokens":1}}}`)
+
+	usage, newAPIError := cohereHandler(c, info, resp)
+	require.Nil(t, newAPIError)
+	require.Equal(t, 4, usage.TotalTokens)
+	require.Contains(t, recorder.Body.String(), `"model":"my-model"`)
+}
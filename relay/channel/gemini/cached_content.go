@@ -0,0 +1,24 @@
+package gemini
+
+import (
+	"fmt"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// cachedContents 目前只在 v1beta 提供，不跟随模型的版本设置
+const cachedContentsAPIVersion = "v1beta"
+
+// CachedContentsURL returns the cachedContents endpoint of the channel. name is
+// empty for the collection (create) and the resource name otherwise.
+func (a *Adaptor) CachedContentsURL(info *relaycommon.RelayInfo, name string) (string, error) {
+	if name == "" {
+		name = "cachedContents"
+	}
+	return fmt.Sprintf("%s/%s/%s", info.ChannelBaseUrl, cachedContentsAPIVersion, name), nil
+}
+
+// CachedContentModel returns the model field expected by cachedContents.create.
+func (a *Adaptor) CachedContentModel(info *relaycommon.RelayInfo, modelName string) (string, error) {
+	return "models/" + modelName, nil
+}
@@ -205,9 +205,7 @@ func miniMaxImageHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 
 	c.Writer.Header().Set("Content-Type", "application/json")
 	c.Writer.WriteHeader(resp.StatusCode)
-	if _, err := c.Writer.Write(jsonResponse); err != nil {
-		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
-	}
+	service.IOCopyBytesGracefully(c, resp, jsonResponse)
 
 	return &dto.Usage{}, nil
 }
@@ -0,0 +1,49 @@
+package vertex
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+)
+
+// loadCredentials decodes the service account of the channel. Context caches
+// are project resources, so API key (express mode) channels cannot host them.
+func (a *Adaptor) loadCredentials(info *relaycommon.RelayInfo) error {
+	if info.ChannelOtherSettings.VertexKeyType == dto.VertexKeyTypeAPIKey {
+		return errors.New("vertex cachedContents requires service account credentials")
+	}
+	adc := &Credentials{}
+	if err := common.Unmarshal([]byte(info.ApiKey), adc); err != nil {
+		return fmt.Errorf("failed to decode credentials file: %w", err)
+	}
+	a.AccountCredentials = *adc
+	return nil
+}
+
+// CachedContentsURL returns the cachedContents endpoint of the channel. name is
+// empty for the collection (create) and the full resource name otherwise, whose
+// location decides the regional host.
+func (a *Adaptor) CachedContentsURL(info *relaycommon.RelayInfo, name string) (string, error) {
+	if err := a.loadCredentials(info); err != nil {
+		return "", err
+	}
+	if name == "" {
+		region := GetModelRegion(info.ApiVersion, info.OriginModelName)
+		return BuildAPIBaseURL(info.ChannelBaseUrl, DefaultAPIVersion, a.AccountCredentials.ProjectID, region) + "/cachedContents", nil
+	}
+	return BuildResourceURL(info.ChannelBaseUrl, DefaultAPIVersion, name), nil
+}
+
+// CachedContentModel returns the publisher model resource expected by
+// cachedContents.create.
+func (a *Adaptor) CachedContentModel(info *relaycommon.RelayInfo, modelName string) (string, error) {
+	if err := a.loadCredentials(info); err != nil {
+		return "", err
+	}
+	region := normalizeVertexRegion(GetModelRegion(info.ApiVersion, info.OriginModelName))
+	return fmt.Sprintf("projects/%s/locations/%s/publishers/%s/models/%s",
+		a.AccountCredentials.ProjectID, region, PublisherGoogle, modelName), nil
+}
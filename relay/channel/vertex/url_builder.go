@@ -84,3 +84,25 @@ func BuildOpenSourceChatCompletionsURL(baseURL, projectID, region string) string
 		BuildAPIBaseURL(baseURL, OpenSourceAPIVersion, projectID, region),
 	)
 }
+
+// BuildResourceURL returns the URL of a full resource name such as
+// projects/p/locations/us-central1/cachedContents/123, served from the host of
+// the resource's location unless the channel has a custom base URL.
+func BuildResourceURL(baseURL, version, name string) string {
+	name = strings.TrimLeft(name, "/")
+	if normalized := normalizeVertexBaseURL(baseURL); normalized != "" {
+		return appendVertexAPIVersion(normalized, version) + "/" + name
+	}
+	region := "global"
+	parts := strings.Split(name, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "locations" {
+			region = normalizeVertexRegion(parts[i+1])
+			break
+		}
+	}
+	if region == "global" {
+		return fmt.Sprintf("https://aiplatform.googleapis.com/%s/%s", version, name)
+	}
+	return fmt.Sprintf("https://%s-aiplatform.googleapis.com/%s/%s", region, version, name)
+}
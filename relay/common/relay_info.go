@@ -88,6 +88,10 @@ type RelayInfo struct {
 	UsingGroup        string // 使用的分组，当auto跨分组重试时，会变动
 	UserGroup         string // 用户所在分组
 	TokenUnlimited    bool
+	DerivedTokenId    string  // 使用父令牌签发的子令牌时为子令牌 ID，用量计入父令牌
+	OrgId             int     // 组织令牌所属组织，非 0 时从组织钱包扣费
+	ResellerId        int     // 子账户所属转售商，非 0 时转售商按平台价二次结算
+	ResellerMarkup    float64 // 转售商加价倍率，由 HandleGroupRatio 计算，子账户扣费 ÷ 倍率 = 平台价
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
@@ -143,6 +147,7 @@ type RelayInfo struct {
 	SubscriptionAmountUsedAfterPreConsume int64
 	IsClaudeBetaQuery                     bool // /v1/messages?beta=true
 	IsChannelTest                         bool // channel test request
+	IsShadowTraffic                       bool // mirrored shadow request, never billed or logged
 	RetryIndex                            int
 	LastError                             *types.NewAPIError
 	RuntimeHeadersOverride                map[string]interface{}
@@ -175,6 +180,9 @@ type RelayInfo struct {
 
 	// convOptions caches the converter settings snapshot (see ConvOptions).
 	convOptions *convmeta.Options
+	// AutoCacheBreakpoints is the number of cache_control breakpoints inserted
+	// by the Claude conversion, used to report prompt caching savings.
+	AutoCacheBreakpoints int
 
 	ThinkingContentInfo
 	TokenCountMeta
@@ -230,10 +238,12 @@ func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 	}
 
 	info.ChannelMeta = channelMeta
+	info.initResponseOverride(c)
 
 	// Channel identity feeds the converter options snapshot (e.g.
 	// OpenRouterDialect); drop the cache so a cross-channel retry rebuilds it.
 	info.convOptions = nil
+	info.AutoCacheBreakpoints = 0
 	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || channelMeta.ChannelSetting.PassThroughBodyEnabled {
 		info.ReasoningEffort = ""
 	} else {
@@ -518,6 +528,9 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
+		DerivedTokenId: common.GetContextKeyString(c, constant.ContextKeyDerivedTokenId),
+		OrgId:          common.GetContextKeyInt(c, constant.ContextKeyTokenOrgId),
+		ResellerId:     common.GetContextKeyInt(c, constant.ContextKeyUserParentId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -822,6 +835,7 @@ func (info *RelayInfo) ConvOptions() *convmeta.Options {
 			ThinkingAdapterEnabled:                claudeSettings.ThinkingAdapterEnabled,
 			ThinkingAdapterBudgetTokensPercentage: claudeSettings.ThinkingAdapterBudgetTokensPercentage,
 			DefaultMaxTokens:                      claudeSettings.GetDefaultMaxTokens,
+			AutoCacheControl:                      info.autoCacheControlOptions(claudeSettings),
 		},
 		Gemini: convmeta.GeminiOptions{
 			ThinkingAdapterEnabled:                geminiSettings.ThinkingAdapterEnabled,
@@ -839,6 +853,42 @@ func (info *RelayInfo) ConvOptions() *convmeta.Options {
 	return options
 }
 
+// autoCacheControlOptions resolves the channel policy first and then the
+// group opt-in list of the claude settings.
+func (info *RelayInfo) autoCacheControlOptions(claudeSettings *model_setting.ClaudeSettings) *convmeta.AutoCacheControlOptions {
+	if info == nil {
+		return nil
+	}
+	options := &convmeta.AutoCacheControlOptions{
+		MinTokens: claudeSettings.AutoCacheControlMinTokens,
+		TTL:       claudeSettings.AutoCacheControlTTL,
+	}
+	if info.ChannelMeta != nil && info.ChannelSetting.AutoCacheControl != nil {
+		policy := info.ChannelSetting.AutoCacheControl
+		if !policy.Enabled {
+			return nil
+		}
+		if policy.MinTokens > 0 {
+			options.MinTokens = policy.MinTokens
+		}
+		if policy.TTL != "" {
+			options.TTL = policy.TTL
+		}
+		return options
+	}
+	if claudeSettings.IsAutoCacheControlGroup(info.UsingGroup) {
+		return options
+	}
+	return nil
+}
+
+func (info *RelayInfo) SetAutoCacheBreakpoints(count int) {
+	if info == nil {
+		return
+	}
+	info.AutoCacheBreakpoints = count
+}
+
 func (info *RelayInfo) SetFirstResponseTime() {
 	if info.isFirstResponse {
 		info.FirstResponseTime = time.Now()
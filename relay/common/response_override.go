@@ -0,0 +1,230 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relaykit/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	responseOverrideContextStatusCode = "status_code"
+	responseOverrideContextIsStream   = "is_stream"
+)
+
+// ResponseOverride applies a channel's response_override rules to the
+// responses of one relay attempt. The rule language is the same as
+// param_override; conditions look up the response body first and then the
+// relay context, which additionally carries status_code and is_stream.
+type ResponseOverride struct {
+	info     *RelayInfo
+	override map[string]interface{}
+	context  map[string]interface{}
+	// blocked is set once a stream chunk was replaced by return_error; the
+	// rest of that stream is dropped.
+	blocked bool
+}
+
+// initResponseOverride stores the response rules of the channel serving this
+// attempt, so a cross-channel retry never keeps the previous channel's rules.
+func (info *RelayInfo) initResponseOverride(c *gin.Context) {
+	if c == nil {
+		return
+	}
+	var override *ResponseOverride
+	if info.ChannelMeta != nil && len(info.ChannelSetting.ResponseOverride) > 0 {
+		override = &ResponseOverride{
+			info:     info,
+			override: info.ChannelSetting.ResponseOverride,
+		}
+	}
+	common.SetContextKey(c, constant.ContextKeyResponseOverride, override)
+}
+
+// GetResponseOverride returns the response rules of the current attempt, or
+// nil when the channel has none.
+func GetResponseOverride(c *gin.Context) *ResponseOverride {
+	override, _ := common.GetContextKeyType[*ResponseOverride](c, constant.ContextKeyResponseOverride)
+	return override
+}
+
+// Blocked reports whether an earlier chunk of the stream was replaced by a
+// return_error, in which case no further chunk may be sent.
+func (o *ResponseOverride) Blocked() bool {
+	return o != nil && o.blocked
+}
+
+// Apply runs the rules against a non-stream response body or a single SSE
+// chunk. Non-JSON data is passed through untouched. A return_error rule yields
+// the error to send instead of data; rule failures are logged and the data is
+// passed through so a broken rule never breaks the response.
+func (o *ResponseOverride) Apply(data []byte, statusCode int, isStream bool) ([]byte, *types.NewAPIError) {
+	return o.apply(data, statusCode, isStream, nil)
+}
+
+// ApplyWithHeader is Apply for a non-stream response that also runs the
+// header operations against header, the response headers about to be sent.
+// Header changes are only kept when the rules succeed.
+func (o *ResponseOverride) ApplyWithHeader(data []byte, statusCode int, header http.Header) ([]byte, *types.NewAPIError) {
+	return o.apply(data, statusCode, false, header)
+}
+
+// ApplyStreamHeaders runs the header operations against the headers of an SSE
+// response before its first event is written. Only the header operations are
+// run, so their conditions can only use context fields; body operations and
+// return_error take effect on the chunks.
+func (o *ResponseOverride) ApplyStreamHeaders(header http.Header) {
+	if o == nil || header == nil {
+		return
+	}
+	headerOverride := responseHeaderOperations(o.override)
+	if headerOverride == nil {
+		return
+	}
+	o.prepareContext(http.StatusOK, true, header)
+	if _, err := ApplyParamOverride([]byte("{}"), headerOverride, o.context); err != nil {
+		common.SysError(fmt.Sprintf("response override failed (channel %d): %s", o.channelId(), err.Error()))
+		return
+	}
+	syncResponseHeaders(header, o.context)
+}
+
+func (o *ResponseOverride) apply(data []byte, statusCode int, isStream bool, header http.Header) ([]byte, *types.NewAPIError) {
+	if o == nil || len(data) == 0 || !gjson.ValidBytes(data) {
+		return data, nil
+	}
+	o.prepareContext(statusCode, isStream, header)
+
+	result, err := ApplyParamOverride(data, o.override, o.context)
+	if err != nil {
+		if fixedErr, ok := AsParamOverrideReturnError(err); ok {
+			if isStream {
+				o.blocked = true
+			}
+			return nil, NewAPIErrorFromParamOverride(fixedErr)
+		}
+		common.SysError(fmt.Sprintf("response override failed (channel %d): %s", o.channelId(), err.Error()))
+		return data, nil
+	}
+	if header != nil {
+		syncResponseHeaders(header, o.context)
+	}
+	return result, nil
+}
+
+// prepareContext refreshes the per-response fields of the rule context. The
+// header operations of a response work on header_override, which starts as
+// the response headers, so copy_header and pass_headers read the response
+// header first and fall back to the client's request header.
+func (o *ResponseOverride) prepareContext(statusCode int, isStream bool, header http.Header) {
+	if o.context == nil {
+		o.context = ensureContextMap(BuildParamOverrideContext(o.info))
+	}
+	o.context[responseOverrideContextStatusCode] = statusCode
+	o.context[responseOverrideContextIsStream] = isStream
+	o.context[paramOverrideContextHeaderOverride] = responseHeadersContext(header)
+}
+
+var responseOverrideHeaderModes = map[string]bool{
+	"set_header":    true,
+	"delete_header": true,
+	"copy_header":   true,
+	"move_header":   true,
+	"pass_headers":  true,
+}
+
+// responseHeaderOperations keeps only the header operations of the rules, or
+// returns nil when there are none.
+func responseHeaderOperations(override map[string]interface{}) map[string]interface{} {
+	operations, ok := override["operations"].([]interface{})
+	if !ok {
+		return nil
+	}
+	headerOperations := make([]interface{}, 0, len(operations))
+	for _, rawOperation := range operations {
+		operation, ok := rawOperation.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mode, _ := operation["mode"].(string)
+		if responseOverrideHeaderModes[strings.ToLower(strings.TrimSpace(mode))] {
+			headerOperations = append(headerOperations, operation)
+		}
+	}
+	if len(headerOperations) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"operations": headerOperations}
+}
+
+func responseHeadersContext(header http.Header) map[string]interface{} {
+	headers := make(map[string]interface{}, len(header))
+	for name, values := range header {
+		name = normalizeHeaderContextKey(name)
+		value := strings.TrimSpace(strings.Join(values, ", "))
+		if name == "" || value == "" {
+			continue
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+// syncResponseHeaders writes the header_override left by the rules back to
+// header. Headers the rules did not touch keep their original values.
+func syncResponseHeaders(header http.Header, context map[string]interface{}) {
+	updated := sanitizeHeaderOverrideMap(ensureMapKeyInContext(context, paramOverrideContextHeaderOverride))
+	original := responseHeadersContext(header)
+	for name := range original {
+		if value, ok := updated[name]; !ok || value == "" {
+			header.Del(name)
+		}
+	}
+	for name, value := range updated {
+		headerValue := fmt.Sprintf("%v", value)
+		if headerValue == "" || original[name] == headerValue {
+			continue
+		}
+		header.Set(name, headerValue)
+	}
+}
+
+// ErrorResponseBody renders a return_error in the error shape of the client's
+// relay format.
+func (o *ResponseOverride) ErrorResponseBody(newAPIError *types.NewAPIError) []byte {
+	var relayFormat types.RelayFormat
+	if o != nil && o.info != nil {
+		relayFormat = o.info.RelayFormat
+	}
+	return ErrorResponseBody(relayFormat, newAPIError)
+}
+
+// ErrorResponseBody renders an error that replaces a non-stream response in
+// the error shape of the given relay format.
+func ErrorResponseBody(relayFormat types.RelayFormat, newAPIError *types.NewAPIError) []byte {
+	var body []byte
+	if relayFormat == types.RelayFormatClaude {
+		body, _ = common.Marshal(gin.H{
+			"type":  "error",
+			"error": newAPIError.ToClaudeError(),
+		})
+	} else {
+		body, _ = common.Marshal(gin.H{
+			"error": newAPIError.ToOpenAIError(),
+		})
+	}
+	return body
+}
+
+func (o *ResponseOverride) channelId() int {
+	if o.info == nil || o.info.ChannelMeta == nil {
+		return 0
+	}
+	return o.info.ChannelId
+}
@@ -0,0 +1,192 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	common2 "github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newResponseOverrideTestInfo(t *testing.T, override string) (*gin.Context, *RelayInfo) {
+	t.Helper()
+	var rules map[string]interface{}
+	require.NoError(t, common2.UnmarshalJsonStr(override, &rules))
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	common2.SetContextKey(ctx, constant.ContextKeyChannelSetting, dto.ChannelSettings{ResponseOverride: rules})
+	common2.SetContextKey(ctx, constant.ContextKeyOriginalModel, "gpt-4o")
+
+	info := &RelayInfo{OriginModelName: "gpt-4o"}
+	info.InitChannelMeta(ctx)
+	return ctx, info
+}
+
+func TestResponseOverrideRewritesBody(t *testing.T) {
+	ctx, _ := newResponseOverrideTestInfo(t, `{
+		"operations": [
+			{"path": "model", "mode": "set", "value": "my-model"},
+			{"path": "system_fingerprint", "mode": "delete"},
+			{
+				"path": "choices.0.finish_reason",
+				"mode": "set",
+				"value": "stop",
+				"conditions": [{"path": "choices.0.finish_reason", "mode": "full", "value": "end_turn"}]
+			}
+		]
+	}`)
+	override := GetResponseOverride(ctx)
+	require.NotNil(t, override)
+
+	out, newAPIError := override.Apply([]byte(`{"model":"gpt-4o-2024-08-06","system_fingerprint":"fp_1","choices":[{"finish_reason":"end_turn"}]}`), http.StatusOK, false)
+	require.Nil(t, newAPIError)
+	require.JSONEq(t, `{"model":"my-model","choices":[{"finish_reason":"stop"}]}`, string(out))
+
+	// 非 JSON 数据原样透传
+	out, newAPIError = override.Apply([]byte("not json"), http.StatusOK, false)
+	require.Nil(t, newAPIError)
+	require.Equal(t, "not json", string(out))
+}
+
+func TestResponseOverrideConditionsOnStatusAndStream(t *testing.T) {
+	ctx, _ := newResponseOverrideTestInfo(t, `{
+		"operations": [
+			{
+				"path": "gateway.stream",
+				"mode": "set",
+				"value": true,
+				"logic": "AND",
+				"conditions": [
+					{"path": "is_stream", "mode": "full", "value": true},
+					{"path": "status_code", "mode": "full", "value": 200}
+				]
+			}
+		]
+	}`)
+	override := GetResponseOverride(ctx)
+
+	out, _ := override.Apply([]byte(`{"id":"1"}`), http.StatusOK, false)
+	require.JSONEq(t, `{"id":"1"}`, string(out))
+
+	out, _ = override.Apply([]byte(`{"id":"1"}`), http.StatusOK, true)
+	require.JSONEq(t, `{"id":"1","gateway":{"stream":true}}`, string(out))
+}
+
+func TestResponseOverrideReturnErrorBlocksStream(t *testing.T) {
+	ctx, _ := newResponseOverrideTestInfo(t, `{
+		"operations": [
+			{
+				"mode": "return_error",
+				"value": {"message": "blocked by policy", "status_code": 451},
+				"conditions": [{"path": "choices.0.delta.content", "mode": "contains", "value": "secret"}]
+			}
+		]
+	}`)
+	override := GetResponseOverride(ctx)
+
+	_, newAPIError := override.Apply([]byte(`{"choices":[{"delta":{"content":"hello"}}]}`), http.StatusOK, true)
+	require.Nil(t, newAPIError)
+	require.False(t, override.Blocked())
+
+	_, newAPIError = override.Apply([]byte(`{"choices":[{"delta":{"content":"the secret is"}}]}`), http.StatusOK, true)
+	require.NotNil(t, newAPIError)
+	require.Equal(t, 451, newAPIError.StatusCode)
+	require.True(t, override.Blocked())
+	require.JSONEq(t, `{"error":{"message":"blocked by policy","type":"invalid_request_error","param":"","code":"invalid_request"}}`, string(override.ErrorResponseBody(newAPIError)))
+}
+
+func TestResponseOverrideResetOnChannelWithoutRules(t *testing.T) {
+	ctx, info := newResponseOverrideTestInfo(t, `{"operations":[{"path":"model","mode":"set","value":"x"}]}`)
+	require.NotNil(t, GetResponseOverride(ctx))
+
+	// 重试到没有响应规则的渠道时不能沿用上一个渠道的规则
+	common2.SetContextKey(ctx, constant.ContextKeyChannelSetting, dto.ChannelSettings{})
+	info.InitChannelMeta(ctx)
+	require.Nil(t, GetResponseOverride(ctx))
+}
+
+func TestResponseOverrideRewritesHeaders(t *testing.T) {
+	ctx, info := newResponseOverrideTestInfo(t, `{
+		"operations": [
+			{"path": "X-Gateway", "mode": "set_header", "value": "new-api"},
+			{"path": "OpenAI-Organization", "mode": "delete_header"},
+			{"mode": "move_header", "from": "X-Upstream-Region", "to": "X-Region"},
+			{"mode": "copy_header", "from": "OpenAI-Processing-Ms", "to": "X-Latency-Ms"},
+			{"mode": "pass_headers", "value": ["X-Client-Trace"]},
+			{
+				"path": "X-Model-Rewritten",
+				"mode": "set_header",
+				"value": "1",
+				"conditions": [{"path": "model", "mode": "prefix", "value": "gpt-4o-"}]
+			}
+		]
+	}`)
+	info.RequestHeaders = map[string]string{"X-Client-Trace": "trace-1"}
+	override := GetResponseOverride(ctx)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("OpenAI-Organization", "org-123")
+	header.Set("X-Upstream-Region", "us-east")
+	header.Set("OpenAI-Processing-Ms", "42")
+
+	out, newAPIError := override.ApplyWithHeader([]byte(`{"model":"gpt-4o-2024-08-06"}`), http.StatusOK, header)
+	require.Nil(t, newAPIError)
+	require.JSONEq(t, `{"model":"gpt-4o-2024-08-06"}`, string(out))
+	require.Equal(t, http.Header{
+		"Content-Type":         {"application/json"},
+		"X-Region":             {"us-east"},
+		"Openai-Processing-Ms": {"42"},
+		"X-Latency-Ms":         {"42"},
+		"X-Gateway":            {"new-api"},
+		"X-Client-Trace":       {"trace-1"},
+		"X-Model-Rewritten":    {"1"},
+	}, header)
+}
+
+func TestResponseOverrideHeadersKeptOnReturnError(t *testing.T) {
+	ctx, _ := newResponseOverrideTestInfo(t, `{
+		"operations": [
+			{"path": "X-Gateway", "mode": "set_header", "value": "new-api"},
+			{"mode": "return_error", "value": "blocked", "conditions": [{"path": "id", "mode": "full", "value": "bad"}]}
+		]
+	}`)
+	override := GetResponseOverride(ctx)
+
+	header := http.Header{}
+	_, newAPIError := override.ApplyWithHeader([]byte(`{"id":"bad"}`), http.StatusOK, header)
+	require.NotNil(t, newAPIError)
+	require.Empty(t, header, "headers are only changed when the rules succeed")
+}
+
+func TestResponseOverrideStreamHeaders(t *testing.T) {
+	ctx, _ := newResponseOverrideTestInfo(t, `{
+		"operations": [
+			{"path": "X-Accel-Buffering", "mode": "delete_header"},
+			{"path": "X-Stream", "mode": "set_header", "value": "1", "conditions": [{"path": "is_stream", "mode": "full", "value": true}]},
+			{"path": "X-Body", "mode": "set_header", "value": "1", "conditions": [{"path": "choices.0.delta.content", "mode": "full", "value": "hi"}]},
+			{"path": "model", "mode": "set", "value": "my-model"}
+		]
+	}`)
+	override := GetResponseOverride(ctx)
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("X-Accel-Buffering", "no")
+	override.ApplyStreamHeaders(header)
+	require.Equal(t, http.Header{
+		"Content-Type": {"text/event-stream"},
+		"X-Stream":     {"1"},
+	}, header)
+
+	// 数据块仍按完整规则处理，头部操作不再影响已发送的响应头
+	out, newAPIError := override.Apply([]byte(`{"model":"gpt-4o","choices":[{"delta":{"content":"hi"}}]}`), http.StatusOK, true)
+	require.Nil(t, newAPIError)
+	require.JSONEq(t, `{"model":"my-model","choices":[{"delta":{"content":"hi"}}]}`, string(out))
+}
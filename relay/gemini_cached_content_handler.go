@@ -0,0 +1,105 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// geminiCachedContentAdaptor is implemented by channels that can host Gemini
+// context caches (Gemini and Vertex).
+type geminiCachedContentAdaptor interface {
+	channel.Adaptor
+	CachedContentsURL(info *relaycommon.RelayInfo, name string) (string, error)
+	CachedContentModel(info *relaycommon.RelayInfo, modelName string) (string, error)
+}
+
+// cachedContentRequestAdaptor reuses the channel's auth headers and overrides
+// only the request URL.
+type cachedContentRequestAdaptor struct {
+	geminiCachedContentAdaptor
+	requestURL string
+}
+
+func (a *cachedContentRequestAdaptor) GetRequestURL(*relaycommon.RelayInfo) (string, error) {
+	return a.requestURL, nil
+}
+
+// GeminiCachedContentHelper relays one cachedContents call to the channel set up
+// in the context and returns the upstream JSON on success. upstreamName is empty
+// for create, where the body model is rewritten to the channel's model resource.
+func GeminiCachedContentHelper(c *gin.Context, info *relaycommon.RelayInfo, upstreamName string) ([]byte, *types.NewAPIError) {
+	info.InitChannelMeta(c)
+	if err := helper.ModelMappedHelper(c, info, nil); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	adaptor, ok := GetAdaptor(info.ApiType).(geminiCachedContentAdaptor)
+	if !ok {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("channel type %d does not support cachedContents", info.ChannelType), types.ErrorCodeInvalidApiType, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	adaptor.Init(info)
+
+	requestURL, err := adaptor.CachedContentsURL(info, upstreamName)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelInvalidKey, types.ErrOptionWithSkipRetry())
+	}
+	// 只透传 updateMask，客户端的 key 查询参数是本站令牌，不能发给上游
+	if updateMask := c.Query("updateMask"); updateMask != "" {
+		requestURL += "?updateMask=" + url.QueryEscape(updateMask)
+	}
+
+	var requestBody io.Reader
+	if c.Request.Method == http.MethodPost || c.Request.Method == http.MethodPatch {
+		storage, err := common.GetBodyStorage(c)
+		if err != nil {
+			return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		body, err := storage.Bytes()
+		if err != nil {
+			return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		if upstreamName == "" {
+			upstreamModel, err := adaptor.CachedContentModel(info, info.UpstreamModelName)
+			if err != nil {
+				return nil, types.NewError(err, types.ErrorCodeChannelInvalidKey, types.ErrOptionWithSkipRetry())
+			}
+			if body, err = sjson.SetBytes(body, "model", upstreamModel); err != nil {
+				return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+			}
+		}
+		requestBody = bytes.NewReader(body)
+	}
+
+	resp, err := channel.DoApiRequest(&cachedContentRequestAdaptor{geminiCachedContentAdaptor: adaptor, requestURL: requestURL}, c, info, requestBody)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	if resp == nil {
+		return nil, types.NewOpenAIError(errors.New("empty upstream response"), types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		newAPIError := service.RelayErrorHandler(c.Request.Context(), resp, false)
+		service.ResetStatusCode(newAPIError, c.GetString("status_code_mapping"))
+		return nil, newAPIError
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	return responseBody, nil
+}
@@ -7,11 +7,14 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relaykit/dto"
 	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
 )
 
 func FlushWriter(c *gin.Context) (err error) {
@@ -56,6 +59,7 @@ func SetEventStreamHeaders(c *gin.Context) {
 	c.Writer.Header().Set("Connection", "keep-alive")
 	c.Writer.Header().Set("Transfer-Encoding", "chunked")
 	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	relaycommon.GetResponseOverride(c).ApplyStreamHeaders(c.Writer.Header())
 }
 
 func ClaudeData(c *gin.Context, resp dto.ClaudeResponse) error {
@@ -66,9 +70,22 @@ func ClaudeData(c *gin.Context, resp dto.ClaudeResponse) error {
 	jsonData, err := common.Marshal(resp)
 	if err != nil {
 		common.SysError("error marshalling stream response: " + err.Error())
-	} else {
-		c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
-		c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonData)})
+		_ = FlushWriter(c)
+		return nil
+	}
+	chunks, newAPIError := rewriteStreamChunk(c, string(jsonData))
+	if newAPIError != nil {
+		renderClaudeOverrideError(c, newAPIError)
+	}
+	for i, chunk := range chunks {
+		data, newAPIError, send := responseOverrideChunk(c, chunk)
+		if newAPIError != nil {
+			renderClaudeOverrideError(c, newAPIError)
+			break
+		} else if send {
+			c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", streamEventType(chunks, i, resp.Type))})
+			c.Render(-1, common.CustomEvent{Data: "data: " + data})
+		}
 	}
 	_ = FlushWriter(c)
 	return nil
@@ -79,18 +96,54 @@ func ClaudeChunkData(c *gin.Context, resp dto.ClaudeResponse, data string) {
 		return
 	}
 
-	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
-	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("data: %s\n", data)})
+	chunks, newAPIError := rewriteStreamChunk(c, data)
+	if newAPIError != nil {
+		renderClaudeOverrideError(c, newAPIError)
+	}
+	for i, chunk := range chunks {
+		data, newAPIError, send := responseOverrideChunk(c, chunk)
+		if newAPIError != nil {
+			renderClaudeOverrideError(c, newAPIError)
+			break
+		} else if send {
+			c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", streamEventType(chunks, i, resp.Type))})
+			c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("data: %s\n", data)})
+		}
+	}
 	_ = FlushWriter(c)
 }
 
+// streamEventType returns the SSE event name of chunks[i]. Only the last chunk
+// is the upstream event; the ones before it were inserted by the PII restorer
+// or the sensitive-word filter and carry their own type.
+func streamEventType(chunks []string, i int, eventType string) string {
+	if i < len(chunks)-1 {
+		if chunkType := gjson.Get(chunks[i], "type").String(); chunkType != "" {
+			return chunkType
+		}
+	}
+	return eventType
+}
+
 func ResponseChunkData(c *gin.Context, resp dto.ResponsesStreamResponse, data string) error {
 	if requestContextDone(c) {
 		return fmt.Errorf("request context done: %w", c.Request.Context().Err())
 	}
 
-	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", resp.Type)})
-	c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("data: %s", data)})
+	chunks, newAPIError := rewriteStreamChunk(c, data)
+	if newAPIError != nil {
+		renderResponsesError(c, newAPIError)
+	}
+	for i, chunk := range chunks {
+		data, newAPIError, send := responseOverrideChunk(c, chunk)
+		if newAPIError != nil {
+			renderResponsesError(c, newAPIError)
+			break
+		} else if send {
+			c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("event: %s\n", streamEventType(chunks, i, resp.Type))})
+			c.Render(-1, common.CustomEvent{Data: fmt.Sprintf("data: %s", data)})
+		}
+	}
 	return FlushWriter(c)
 }
 
@@ -103,10 +156,85 @@ func StringData(c *gin.Context, str string) error {
 		return fmt.Errorf("request context done: %w", c.Request.Context().Err())
 	}
 
-	c.Render(-1, common.CustomEvent{Data: "data: " + str})
+	if str == "[DONE]" {
+		if relaycommon.GetResponseOverride(c).Blocked() || service.StreamBlocked(c) {
+			return nil
+		}
+		c.Render(-1, common.CustomEvent{Data: "data: " + str})
+		return FlushWriter(c)
+	}
+
+	chunks, newAPIError := rewriteStreamChunk(c, str)
+	if newAPIError != nil {
+		renderOpenAIStreamError(c, newAPIError)
+	}
+	for _, chunk := range chunks {
+		data, newAPIError, send := responseOverrideChunk(c, chunk)
+		if newAPIError != nil {
+			renderOpenAIStreamError(c, newAPIError)
+			break
+		} else if !send {
+			return nil
+		}
+		c.Render(-1, common.CustomEvent{Data: "data: " + data})
+	}
 	return FlushWriter(c)
 }
 
+// rewriteStreamChunk restores PII placeholders and runs the completion
+// sensitive-word filter on one SSE chunk. Nothing is returned once the filter
+// has aborted the stream.
+func rewriteStreamChunk(c *gin.Context, data string) ([]string, *types.NewAPIError) {
+	if service.StreamBlocked(c) {
+		return nil, nil
+	}
+	return service.RewriteStreamChunk(c, data)
+}
+
+// responseOverrideChunk applies the channel's response_override rules to one
+// SSE chunk. A non-nil error replaces the chunk; send is false once an earlier
+// chunk was replaced, so the rest of the stream is dropped.
+func responseOverrideChunk(c *gin.Context, data string) (string, *types.NewAPIError, bool) {
+	override := relaycommon.GetResponseOverride(c)
+	if override == nil {
+		return data, nil, true
+	}
+	if override.Blocked() {
+		return "", nil, false
+	}
+	result, newAPIError := override.Apply([]byte(data), http.StatusOK, true)
+	if newAPIError != nil {
+		return "", newAPIError, true
+	}
+	return string(result), nil, true
+}
+
+func renderClaudeOverrideError(c *gin.Context, newAPIError *types.NewAPIError) {
+	errorData, _ := common.Marshal(gin.H{
+		"type":  "error",
+		"error": newAPIError.ToClaudeError(),
+	})
+	c.Render(-1, common.CustomEvent{Data: "event: error\n"})
+	c.Render(-1, common.CustomEvent{Data: "data: " + string(errorData)})
+}
+
+func renderResponsesError(c *gin.Context, newAPIError *types.NewAPIError) {
+	openaiError := newAPIError.ToOpenAIError()
+	errorData, _ := common.Marshal(gin.H{
+		"type":    "error",
+		"code":    openaiError.Code,
+		"message": openaiError.Message,
+		"param":   openaiError.Param,
+	})
+	c.Render(-1, common.CustomEvent{Data: "event: error\n"})
+	c.Render(-1, common.CustomEvent{Data: "data: " + string(errorData)})
+}
+
+func renderOpenAIStreamError(c *gin.Context, newAPIError *types.NewAPIError) {
+	errorData, _ := common.Marshal(gin.H{"error": newAPIError.ToOpenAIError()})
+	c.Render(-1, common.CustomEvent{Data: "data: " + string(errorData)})
+}
+
 func PingData(c *gin.Context) error {
 	if c == nil || c.Writer == nil {
 		return errors.New("context or writer is nil")
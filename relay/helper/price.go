@@ -67,6 +67,19 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) hostty
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// 转售商子账户按加价后的倍率计费，转售商在结算时按平台价支付；组织令牌从组织钱包扣费，不加价
+	if relayInfo.ResellerId > 0 && relayInfo.OrgId == 0 {
+		markup, err := model.GetResellerMarkup(relayInfo.ResellerId)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to load reseller markup for user %d: %s", relayInfo.UserId, err.Error()))
+		}
+		relayInfo.ResellerMarkup = markup.Ratio(relayInfo.UsingGroup, relayInfo.OriginModelName)
+		groupRatioInfo.GroupRatio *= relayInfo.ResellerMarkup
+		if groupRatioInfo.HasSpecialRatio {
+			groupRatioInfo.GroupSpecialRatio *= relayInfo.ResellerMarkup
+		}
+	}
+
 	return groupRatioInfo
 }
 
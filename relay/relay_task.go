@@ -202,12 +202,9 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (*TaskSubmitRe
 		noteTaskQuotaClamp(info, clamp)
 	}
 
-	// 7. 预扣费（仅首次 — 重试时 info.Billing 已存在，跳过）
-	if info.Billing == nil && !info.PriceData.FreeModel {
-		info.ForcePreConsume = true
-		if apiErr := service.PreConsumeBilling(c, info.PriceData.Quota, info); apiErr != nil {
-			return nil, service.TaskErrorFromAPIError(apiErr)
-		}
+	// 7. 令牌单次额度上限检查 + 预扣费（仅首次 — 重试时 info.Billing 已存在，跳过）
+	if taskErr := preConsumeTaskBilling(c, info); taskErr != nil {
+		return nil, taskErr
 	}
 
 	// 8. 构建请求体
@@ -440,7 +437,7 @@ func tryRealtimeFetch(task *model.Task, isOpenAIVideoAPI bool) []byte {
 	if channelModel.GetBaseURL() != "" {
 		baseURL = channelModel.GetBaseURL()
 	}
-	proxy := channelModel.GetSetting().Proxy
+	proxy := service.ResolveProxyForChannel(channelModel)
 	adaptor := GetTaskAdaptor(constant.TaskPlatform(strconv.Itoa(channelModel.Type)))
 	if adaptor == nil {
 		return nil
@@ -571,3 +568,18 @@ func TaskModel2Dto(task *model.Task) *dto.TaskDto {
 		Data:       task.Data,
 	}
 }
+
+// preConsumeTaskBilling rejects a task whose estimated cost exceeds the
+// per-request limit of the token, then pre-consumes it on the first attempt.
+func preConsumeTaskBilling(c *gin.Context, info *relaycommon.RelayInfo) *dto.TaskError {
+	if apiErr := service.CheckTokenScopeCost(c, info.PriceData.Quota); apiErr != nil {
+		return service.TaskErrorFromAPIError(apiErr)
+	}
+	if info.Billing == nil && !info.PriceData.FreeModel {
+		info.ForcePreConsume = true
+		if apiErr := service.PreConsumeBilling(c, info.PriceData.Quota, info); apiErr != nil {
+			return service.TaskErrorFromAPIError(apiErr)
+		}
+	}
+	return nil
+}
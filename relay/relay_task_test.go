@@ -0,0 +1,32 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	hosttypes "github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreConsumeTaskBillingRejectsOverTokenLimit(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/video/generations", nil)
+	common.SetContextKey(c, constant.ContextKeyTokenScopes, &model.TokenScopes{MaxRequestQuota: 1000})
+
+	info := &relaycommon.RelayInfo{PriceData: hosttypes.PriceData{Quota: 5000}}
+	taskErr := preConsumeTaskBilling(c, info)
+	require.NotNil(t, taskErr)
+	assert.Equal(t, string(types.ErrorCodeTokenScopeViolation), taskErr.Code)
+	assert.Equal(t, http.StatusForbidden, taskErr.StatusCode)
+	assert.Nil(t, info.Billing, "a rejected task must not pre-consume quota")
+	assert.False(t, info.ForcePreConsume)
+}
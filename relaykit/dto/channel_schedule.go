@@ -0,0 +1,201 @@
+package dto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChannelSchedule restricts a channel to recurring time windows. Each window is
+// a cron-like expression with five fields (minute hour day-of-month month
+// day-of-week); the channel takes traffic during every minute matched by at
+// least one window, evaluated in Timezone (UTC when empty).
+//
+// Example: "* 0-7 * * *" keeps the channel in rotation from 00:00 to 07:59,
+// "* 9-17 * * 1-5" during office hours on weekdays.
+type ChannelSchedule struct {
+	Timezone string   `json:"timezone,omitempty"`
+	Windows  []string `json:"windows,omitempty"`
+}
+
+// CompiledChannelSchedule is the parsed, ready-to-match form of ChannelSchedule.
+type CompiledChannelSchedule struct {
+	location *time.Location
+	windows  []cronWindow
+}
+
+type cronWindow struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domStar / dowStar follow cron semantics: when both day fields are
+	// restricted, a day matches if either of them matches.
+	domStar bool
+	dowStar bool
+}
+
+type cronFieldSpec struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronMinuteSpec = cronFieldSpec{name: "minute", min: 0, max: 59}
+	cronHourSpec   = cronFieldSpec{name: "hour", min: 0, max: 23}
+	cronDomSpec    = cronFieldSpec{name: "day-of-month", min: 1, max: 31}
+	cronMonthSpec  = cronFieldSpec{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// day-of-week accepts 0-7 where both 0 and 7 mean Sunday.
+	cronDowSpec = cronFieldSpec{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Compile validates the schedule and returns its matcher. A nil schedule or a
+// schedule without windows compiles to nil, meaning "always available".
+func (s *ChannelSchedule) Compile() (*CompiledChannelSchedule, error) {
+	if s == nil || len(s.Windows) == 0 {
+		return nil, nil
+	}
+	location := time.UTC
+	if tz := strings.TrimSpace(s.Timezone); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule.timezone: %s", s.Timezone)
+		}
+		location = loc
+	}
+	compiled := &CompiledChannelSchedule{
+		location: location,
+		windows:  make([]cronWindow, 0, len(s.Windows)),
+	}
+	for i, expr := range s.Windows {
+		window, err := parseCronWindow(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule.windows[%d]: %w", i, err)
+		}
+		compiled.windows = append(compiled.windows, window)
+	}
+	return compiled, nil
+}
+
+// ActiveAt reports whether t falls inside any window. A nil schedule is always active.
+func (s *CompiledChannelSchedule) ActiveAt(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.location)
+	for _, window := range s.windows {
+		if window.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w cronWindow) matches(t time.Time) bool {
+	if w.minute&(1<<uint(t.Minute())) == 0 ||
+		w.hour&(1<<uint(t.Hour())) == 0 ||
+		w.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := w.dom&(1<<uint(t.Day())) != 0
+	dowMatch := w.dow&(1<<uint(t.Weekday())) != 0
+	if w.domStar || w.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func parseCronWindow(expr string) (cronWindow, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronWindow{}, fmt.Errorf("expected 5 fields, got %d: %q", len(fields), expr)
+	}
+	var (
+		window cronWindow
+		err    error
+	)
+	if window.minute, err = parseCronField(fields[0], cronMinuteSpec); err != nil {
+		return cronWindow{}, err
+	}
+	if window.hour, err = parseCronField(fields[1], cronHourSpec); err != nil {
+		return cronWindow{}, err
+	}
+	if window.dom, err = parseCronField(fields[2], cronDomSpec); err != nil {
+		return cronWindow{}, err
+	}
+	if window.month, err = parseCronField(fields[3], cronMonthSpec); err != nil {
+		return cronWindow{}, err
+	}
+	if window.dow, err = parseCronField(fields[4], cronDowSpec); err != nil {
+		return cronWindow{}, err
+	}
+	if window.dow&(1<<7) != 0 {
+		window.dow |= 1
+	}
+	window.domStar = fields[2] == "*"
+	window.dowStar = fields[4] == "*"
+	return window, nil
+}
+
+// parseCronField parses one cron field into a bitset. Supported forms: "*",
+// "n", "a-b", "*/step", "a-b/step", "n/step" and comma-separated lists thereof.
+func parseCronField(field string, spec cronFieldSpec) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		if part == "" {
+			return 0, fmt.Errorf("empty %s entry in %q", spec.name, field)
+		}
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangePart = part[:idx]
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step in %q", spec.name, part)
+			}
+			step = n
+		}
+		start, end := spec.min, spec.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = parseCronValue(bounds[0], spec); err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], spec); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				end = spec.max
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid %s range %q", spec.name, rangePart)
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, spec cronFieldSpec) (int, error) {
+	if n, ok := spec.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < spec.min || n > spec.max {
+		return 0, fmt.Errorf("invalid %s value %q", spec.name, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package dto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelScheduleCompileEmpty(t *testing.T) {
+	var schedule *ChannelSchedule
+	compiled, err := schedule.Compile()
+	require.NoError(t, err)
+	assert.Nil(t, compiled)
+	assert.True(t, compiled.ActiveAt(time.Now()))
+
+	compiled, err = (&ChannelSchedule{Timezone: "Asia/Shanghai"}).Compile()
+	require.NoError(t, err)
+	assert.Nil(t, compiled)
+}
+
+func TestChannelScheduleActiveAt(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		windows []string
+		at      time.Time
+		want    bool
+	}{
+		{name: "night window inside", windows: []string{"* 0-7 * * *"}, at: time.Date(2025, 3, 5, 3, 30, 0, 0, shanghai), want: true},
+		{name: "night window outside", windows: []string{"* 0-7 * * *"}, at: time.Date(2025, 3, 5, 8, 0, 0, 0, shanghai), want: false},
+		{name: "weekday office hours", windows: []string{"* 9-17 * * mon-fri"}, at: time.Date(2025, 3, 7, 10, 0, 0, 0, shanghai), want: true},
+		{name: "weekend excluded", windows: []string{"* 9-17 * * 1-5"}, at: time.Date(2025, 3, 8, 10, 0, 0, 0, shanghai), want: false},
+		{name: "sunday as 7", windows: []string{"* * * * 7"}, at: time.Date(2025, 3, 9, 10, 0, 0, 0, shanghai), want: true},
+		{name: "any window matches", windows: []string{"* 0-1 * * *", "* 22-23 * * *"}, at: time.Date(2025, 3, 5, 23, 59, 0, 0, shanghai), want: true},
+		{name: "minute step", windows: []string{"*/15 * * * *"}, at: time.Date(2025, 3, 5, 12, 45, 0, 0, shanghai), want: true},
+		{name: "minute step miss", windows: []string{"*/15 * * * *"}, at: time.Date(2025, 3, 5, 12, 46, 0, 0, shanghai), want: false},
+		{name: "dom or dow when both restricted", windows: []string{"* * 1 * sat"}, at: time.Date(2025, 3, 8, 12, 0, 0, 0, shanghai), want: true},
+		{name: "month list", windows: []string{"* * * jan,dec *"}, at: time.Date(2025, 3, 5, 12, 0, 0, 0, shanghai), want: false},
+		{name: "timezone conversion", windows: []string{"* 0-7 * * *"}, at: time.Date(2025, 3, 4, 20, 0, 0, 0, time.UTC), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := (&ChannelSchedule{Timezone: "Asia/Shanghai", Windows: tt.windows}).Compile()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, compiled.ActiveAt(tt.at))
+		})
+	}
+}
+
+func TestChannelScheduleCompileInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule ChannelSchedule
+		want     string
+	}{
+		{name: "bad timezone", schedule: ChannelSchedule{Timezone: "Mars/Olympus", Windows: []string{"* * * * *"}}, want: "schedule.timezone"},
+		{name: "field count", schedule: ChannelSchedule{Windows: []string{"* * *"}}, want: "expected 5 fields"},
+		{name: "hour out of range", schedule: ChannelSchedule{Windows: []string{"* 24 * * *"}}, want: "invalid hour value"},
+		{name: "reversed range", schedule: ChannelSchedule{Windows: []string{"* 8-2 * * *"}}, want: "invalid hour range"},
+		{name: "zero step", schedule: ChannelSchedule{Windows: []string{"*/0 * * * *"}}, want: "invalid minute step"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.schedule.Compile()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
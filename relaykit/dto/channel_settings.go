@@ -23,6 +23,60 @@ type ChannelSettings struct {
 	// HTTP2ConnectionShards spreads HTTP/2 traffic across N independent transports
 	// (1-8). Zero/unset means 1. Ignored when HTTPProtocol is "http1".
 	HTTP2ConnectionShards int `json:"http2_connection_shards,omitempty"`
+	// SameChannelRetry retries transient upstream failures on the same channel
+	// before the relay falls back to picking another channel. Nil disables it.
+	SameChannelRetry *SameChannelRetryPolicy `json:"same_channel_retry,omitempty"`
+	// Schedule limits the channel to recurring time windows. Nil means always available.
+	Schedule *ChannelSchedule `json:"schedule,omitempty"`
+	// ProxyPool rotates outbound traffic across several proxies. When set it
+	// takes precedence over Proxy, which remains the single-proxy form.
+	ProxyPool *ChannelProxyPool `json:"proxy_pool,omitempty"`
+	// AutoCacheControl inserts Claude prompt-caching breakpoints into requests
+	// converted to Claude Messages. Nil falls back to the group policy in the
+	// claude settings.
+	AutoCacheControl *AutoCacheControlPolicy `json:"auto_cache_control,omitempty"`
+	// ResponseOverride post-processes upstream responses (non-stream bodies and
+	// every SSE chunk) with the param_override rule language.
+	ResponseOverride map[string]interface{} `json:"response_override,omitempty"`
+}
+
+// AutoCacheControlPolicy configures automatic cache_control insertion.
+type AutoCacheControlPolicy struct {
+	Enabled bool `json:"enabled"`
+	// MinTokens is the estimated prefix length a breakpoint must cover. Zero
+	// uses the global claude.auto_cache_control_min_tokens.
+	MinTokens int `json:"min_tokens,omitempty"`
+	// TTL is "5m" or "1h". Empty uses the global setting.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// ChannelProxyPool is either an inline proxy list or a reference to a shared
+// named pool configured in proxy_pool_setting.
+type ChannelProxyPool struct {
+	// Name references a shared pool. When set, Proxies and Strategy are ignored.
+	Name     string   `json:"name,omitempty"`
+	Proxies  []string `json:"proxies,omitempty"`
+	Strategy string   `json:"strategy,omitempty"`
+}
+
+// SameChannelRetryPolicy configures jittered exponential backoff retries
+// against the channel that just failed.
+type SameChannelRetryPolicy struct {
+	Enabled bool `json:"enabled"`
+	// MaxAttempts is the number of extra attempts on the same channel (1-5).
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// BaseDelayMs is the first backoff step; it doubles on every attempt.
+	BaseDelayMs int `json:"base_delay_ms,omitempty"`
+	// MaxDelayMs caps a single backoff step.
+	MaxDelayMs int `json:"max_delay_ms,omitempty"`
+	// MaxTotalWaitMs caps the accumulated wait across all attempts. A retry
+	// whose delay would exceed the remaining budget is not attempted.
+	MaxTotalWaitMs int `json:"max_total_wait_ms,omitempty"`
+	// RespectRetryAfter uses the upstream Retry-After header as the delay when present.
+	RespectRetryAfter bool `json:"respect_retry_after,omitempty"`
+	// StatusCodes lists upstream status codes eligible for a same-channel retry.
+	// Empty means DefaultSameChannelRetryStatusCodes.
+	StatusCodes []int `json:"status_codes,omitempty"`
 }
 
 const (
@@ -31,6 +85,36 @@ const (
 	MaxHTTP2ConnectionShards = 8
 )
 
+const (
+	MaxSameChannelRetryAttempts     = 5
+	MaxSameChannelRetryTotalWaitMs  = 60000
+	DefaultSameChannelRetryAttempts = 1
+	DefaultSameChannelRetryBaseMs   = 500
+	DefaultSameChannelRetryMaxMs    = 5000
+	DefaultSameChannelRetryTotalMs  = 10000
+)
+
+const (
+	// ProxyPoolStrategyRoundRobin spreads requests evenly across healthy proxies.
+	ProxyPoolStrategyRoundRobin = "round_robin"
+	// ProxyPoolStrategySticky pins each upstream key to one healthy proxy.
+	ProxyPoolStrategySticky = "sticky"
+)
+
+// IsValidProxyPoolStrategy reports whether strategy is empty or a known rotation policy.
+func IsValidProxyPoolStrategy(strategy string) bool {
+	switch strategy {
+	case "", ProxyPoolStrategyRoundRobin, ProxyPoolStrategySticky:
+		return true
+	default:
+		return false
+	}
+}
+
+// DefaultSameChannelRetryStatusCodes are the transient upstream failures retried
+// on the same channel when the policy does not list its own status codes.
+var DefaultSameChannelRetryStatusCodes = []int{500, 502, 503, 529}
+
 // ValidateHTTPTransport validates save-time HTTP transport channel settings.
 func (s *ChannelSettings) ValidateHTTPTransport() error {
 	if s == nil {
@@ -51,6 +135,130 @@ func (s *ChannelSettings) ValidateHTTPTransport() error {
 	return nil
 }
 
+// ValidateSameChannelRetry validates save-time same-channel retry settings.
+func (s *ChannelSettings) ValidateSameChannelRetry() error {
+	if s == nil || s.SameChannelRetry == nil {
+		return nil
+	}
+	p := s.SameChannelRetry
+	if p.MaxAttempts < 0 || p.MaxAttempts > MaxSameChannelRetryAttempts {
+		return fmt.Errorf("invalid same_channel_retry.max_attempts: %d", p.MaxAttempts)
+	}
+	if p.BaseDelayMs < 0 || p.MaxDelayMs < 0 {
+		return fmt.Errorf("same_channel_retry delays must not be negative")
+	}
+	if p.MaxDelayMs > 0 && p.BaseDelayMs > p.MaxDelayMs {
+		return fmt.Errorf("same_channel_retry.base_delay_ms must not exceed max_delay_ms")
+	}
+	if p.MaxTotalWaitMs < 0 || p.MaxTotalWaitMs > MaxSameChannelRetryTotalWaitMs {
+		return fmt.Errorf("invalid same_channel_retry.max_total_wait_ms: %d", p.MaxTotalWaitMs)
+	}
+	for _, code := range p.StatusCodes {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("invalid same_channel_retry.status_codes entry: %d", code)
+		}
+	}
+	return nil
+}
+
+// Normalized returns a copy with defaults applied to unset fields.
+func (p SameChannelRetryPolicy) Normalized() SameChannelRetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultSameChannelRetryAttempts
+	}
+	if p.MaxAttempts > MaxSameChannelRetryAttempts {
+		p.MaxAttempts = MaxSameChannelRetryAttempts
+	}
+	if p.BaseDelayMs <= 0 {
+		p.BaseDelayMs = DefaultSameChannelRetryBaseMs
+	}
+	if p.MaxDelayMs <= 0 {
+		p.MaxDelayMs = DefaultSameChannelRetryMaxMs
+	}
+	if p.BaseDelayMs > p.MaxDelayMs {
+		p.BaseDelayMs = p.MaxDelayMs
+	}
+	if p.MaxTotalWaitMs <= 0 {
+		p.MaxTotalWaitMs = DefaultSameChannelRetryTotalMs
+	}
+	if p.MaxTotalWaitMs > MaxSameChannelRetryTotalWaitMs {
+		p.MaxTotalWaitMs = MaxSameChannelRetryTotalWaitMs
+	}
+	if len(p.StatusCodes) == 0 {
+		p.StatusCodes = DefaultSameChannelRetryStatusCodes
+	}
+	return p
+}
+
+// MatchStatusCode reports whether statusCode is eligible for a same-channel retry.
+func (p SameChannelRetryPolicy) MatchStatusCode(statusCode int) bool {
+	codes := p.StatusCodes
+	if len(codes) == 0 {
+		codes = DefaultSameChannelRetryStatusCodes
+	}
+	for _, code := range codes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateProxyPool validates the shape of the inline proxy pool. Proxy URL
+// syntax and shared pool existence are checked by the caller, which owns them.
+func (s *ChannelSettings) ValidateProxyPool() error {
+	if s == nil || s.ProxyPool == nil {
+		return nil
+	}
+	pool := s.ProxyPool
+	if strings.TrimSpace(pool.Name) != "" {
+		return nil
+	}
+	if len(pool.Proxies) == 0 {
+		return fmt.Errorf("proxy_pool requires either name or proxies")
+	}
+	if !IsValidProxyPoolStrategy(pool.Strategy) {
+		return fmt.Errorf("invalid proxy_pool.strategy: %s", pool.Strategy)
+	}
+	return nil
+}
+
+// responseOverrideUnsupportedModes lists the param_override operations that
+// only make sense for outbound requests.
+var responseOverrideUnsupportedModes = map[string]bool{
+	"sync_fields": true,
+}
+
+// ValidateResponseOverride validates the shape of response_override. The
+// operations themselves are interpreted by relay/common.
+func (s *ChannelSettings) ValidateResponseOverride() error {
+	if s == nil || len(s.ResponseOverride) == 0 {
+		return nil
+	}
+	rawOperations, ok := s.ResponseOverride["operations"]
+	if !ok {
+		return nil
+	}
+	operations, ok := rawOperations.([]interface{})
+	if !ok {
+		return fmt.Errorf("response_override.operations must be an array")
+	}
+	for i, rawOperation := range operations {
+		operation, ok := rawOperation.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("response_override.operations[%d] must be an object", i)
+		}
+		mode, _ := operation["mode"].(string)
+		if strings.TrimSpace(mode) == "" {
+			return fmt.Errorf("response_override.operations[%d].mode is required", i)
+		}
+		if responseOverrideUnsupportedModes[strings.ToLower(strings.TrimSpace(mode))] {
+			return fmt.Errorf("response_override does not support mode %s", mode)
+		}
+	}
+	return nil
+}
+
 type VertexKeyType string
 
 const (
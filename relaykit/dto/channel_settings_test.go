@@ -642,3 +642,20 @@ func TestChannelSettingsValidateHTTPTransport(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "http2_connection_shards")
 }
+
+func TestChannelSettingsValidateResponseOverride(t *testing.T) {
+	parse := func(raw string) *ChannelSettings {
+		var settings ChannelSettings
+		require.NoError(t, json.Unmarshal([]byte(raw), &settings))
+		return &settings
+	}
+
+	require.NoError(t, parse(`{}`).ValidateResponseOverride())
+	require.NoError(t, parse(`{"response_override":{"operations":[{"path":"model","mode":"set","value":"x"}]}}`).ValidateResponseOverride())
+	require.NoError(t, parse(`{"response_override":{"usage.extra":1}}`).ValidateResponseOverride())
+	require.NoError(t, parse(`{"response_override":{"operations":[{"path":"X-Foo","mode":"set_header","value":"1"}]}}`).ValidateResponseOverride())
+
+	require.Error(t, parse(`{"response_override":{"operations":{"mode":"set"}}}`).ValidateResponseOverride())
+	require.Error(t, parse(`{"response_override":{"operations":[{"path":"model"}]}}`).ValidateResponseOverride())
+	require.Error(t, parse(`{"response_override":{"operations":[{"mode":"sync_fields","from":"header:x","to":"json:x"}]}}`).ValidateResponseOverride())
+}
@@ -44,6 +44,10 @@ type Meta interface {
 	// AppendRequestConversion records a hop in the request format chain.
 	AppendRequestConversion(format types.RelayFormat)
 
+	// SetAutoCacheBreakpoints records how many cache_control breakpoints a
+	// converter inserted on its own so the host can report the savings.
+	SetAutoCacheBreakpoints(count int)
+
 	// ConvOptions returns the request-scoped conversion options snapshot.
 	// Must never return nil.
 	ConvOptions() *Options
@@ -81,9 +85,10 @@ type Values struct {
 	ReasoningEffort      string
 	EstimatePromptTokens int
 
-	ClaudeConvertInfo *ClaudeConvertInfo
-	SendResponseCount int
-	ConversionChain   []types.RelayFormat
+	ClaudeConvertInfo    *ClaudeConvertInfo
+	SendResponseCount    int
+	ConversionChain      []types.RelayFormat
+	AutoCacheBreakpoints int
 
 	Options *Options
 }
@@ -179,6 +184,12 @@ func (v *Values) AppendRequestConversion(format types.RelayFormat) {
 	v.ConversionChain = append(v.ConversionChain, format)
 }
 
+func (v *Values) SetAutoCacheBreakpoints(count int) {
+	if v != nil {
+		v.AutoCacheBreakpoints = count
+	}
+}
+
 func (v *Values) ConvOptions() *Options {
 	if v == nil {
 		return &Options{}
@@ -36,6 +36,20 @@ type ClaudeOptions struct {
 	// standalone relaykit users must supply one or guarantee max_tokens on
 	// every request.
 	DefaultMaxTokens func(modelName string) int
+	// AutoCacheControl inserts prompt-caching breakpoints into converted
+	// Claude requests that carry no cache_control of their own. Nil disables
+	// it.
+	AutoCacheControl *AutoCacheControlOptions
+}
+
+// AutoCacheControlOptions configures automatic cache_control insertion.
+type AutoCacheControlOptions struct {
+	// MinTokens is the estimated prefix length a breakpoint must cover.
+	// Anthropic ignores shorter prefixes (1024 tokens for most models, 2048
+	// for Haiku). Zero means 1024.
+	MinTokens int
+	// TTL is "5m" (default) or "1h".
+	TTL string
 }
 
 type GeminiOptions struct {
@@ -391,6 +391,9 @@ func OpenAIChatRequestToClaudeMessages(c context.Context, info convmeta.Meta, te
 
 	claudeRequest.Prompt = ""
 	claudeRequest.Messages = claudeMessages
+	if inserted := sharedclaude.ApplyAutoCacheControl(&claudeRequest, opts.Claude.AutoCacheControl); inserted > 0 && info != nil {
+		info.SetAutoCacheBreakpoints(inserted)
+	}
 	// Checked last so every injection path (default hook, thinking adapter
 	// floor) has had its chance to satisfy the required field.
 	if claudeRequest.MaxTokens == nil {
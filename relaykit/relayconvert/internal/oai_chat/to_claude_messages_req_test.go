@@ -2,9 +2,11 @@ package oaichat
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/relayconvert/convmeta"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -79,3 +81,51 @@ func TestOpenAIChatRequestToClaudeMessagesNormalizesToolInputSchema(t *testing.T
 		})
 	}
 }
+
+func TestOpenAIChatRequestToClaudeMessagesAutoCacheControl(t *testing.T) {
+	longSystem := strings.Repeat("You are a meticulous assistant. ", 40)
+	maxTokens := uint(1024)
+	request := dto.GeneralOpenAIRequest{
+		Model:     "claude-test",
+		MaxTokens: &maxTokens,
+		Messages: []dto.Message{
+			{Role: "system", Content: longSystem},
+			{Role: "user", Content: "first question"},
+			{Role: "assistant", Content: "first answer"},
+			{Role: "user", Content: "second question"},
+		},
+		Tools: []dto.ToolCallRequest{
+			{Type: "function", Function: dto.FunctionRequest{Name: "lookup", Parameters: map[string]any{"type": "object"}}},
+		},
+	}
+	meta := &convmeta.Values{Options: &convmeta.Options{Claude: convmeta.ClaudeOptions{
+		AutoCacheControl: &convmeta.AutoCacheControlOptions{MinTokens: 200, TTL: "1h"},
+	}}}
+
+	got, err := OpenAIChatRequestToClaudeMessages(context.Background(), meta, request)
+	require.NoError(t, err)
+	assert.Equal(t, 2, meta.AutoCacheBreakpoints, "tools are below the minimum on their own")
+
+	tool := got.Tools.([]any)[0].(*dto.Tool)
+	assert.Empty(t, tool.CacheControl)
+	system := got.System.([]dto.ClaudeMediaMessage)
+	assert.JSONEq(t, `{"type":"ephemeral","ttl":"1h"}`, string(system[len(system)-1].CacheControl))
+	require.Len(t, got.Messages, 3)
+	stable := got.Messages[1].Content.([]dto.ClaudeMediaMessage)
+	assert.Equal(t, "first answer", stable[0].GetText())
+	assert.NotEmpty(t, stable[0].CacheControl)
+	assert.Equal(t, "second question", got.Messages[2].Content, "the newest user turn is left alone")
+
+	disabled := &convmeta.Values{}
+	got, err = OpenAIChatRequestToClaudeMessages(context.Background(), disabled, request)
+	require.NoError(t, err)
+	assert.Zero(t, disabled.AutoCacheBreakpoints)
+	assert.Empty(t, got.System.([]dto.ClaudeMediaMessage)[0].CacheControl)
+
+	short := &convmeta.Values{Options: &convmeta.Options{Claude: convmeta.ClaudeOptions{
+		AutoCacheControl: &convmeta.AutoCacheControlOptions{},
+	}}}
+	_, err = OpenAIChatRequestToClaudeMessages(context.Background(), short, request)
+	require.NoError(t, err)
+	assert.Zero(t, short.AutoCacheBreakpoints, "prefixes below 1024 tokens are not cacheable")
+}
@@ -120,6 +120,9 @@ func OpenAIResponsesRequestToClaudeMessages(c context.Context, info convmeta.Met
 		claudeRequest.System = systemMessages
 	}
 	claudeRequest.Messages = ensureClaudeMessagesStartWithUser(claudeRequest.Messages)
+	if inserted := sharedclaude.ApplyAutoCacheControl(claudeRequest, convmeta.OptionsOf(info).Claude.AutoCacheControl); inserted > 0 && info != nil {
+		info.SetAutoCacheBreakpoints(inserted)
+	}
 	// Checked last so every injection path has had its chance to satisfy the
 	// required field.
 	if claudeRequest.MaxTokens == nil {
@@ -0,0 +1,175 @@
+package claude
+
+import (
+	"encoding/json"
+
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/relayconvert/convmeta"
+	kitutil "github.com/QuantumNous/new-api/relaykit/relayconvert/kitutil"
+)
+
+const (
+	// MaxCacheBreakpoints is Anthropic's per-request cache_control limit.
+	MaxCacheBreakpoints = 4
+
+	defaultAutoCacheMinTokens = 1024
+)
+
+// ApplyAutoCacheControl marks the tool definitions, the system prompt and the
+// last stable turn (the message before the newest user message) as cache
+// breakpoints, in Anthropic's prefix order tools -> system -> messages. A
+// breakpoint is only placed once the prefix it covers reaches MinTokens, and
+// requests that already carry cache_control are left to the client. Returns
+// the number of inserted breakpoints.
+func ApplyAutoCacheControl(req *dto.ClaudeRequest, opts *convmeta.AutoCacheControlOptions) int {
+	if req == nil || opts == nil || hasCacheControl(req) {
+		return 0
+	}
+	minTokens := opts.MinTokens
+	if minTokens <= 0 {
+		minTokens = defaultAutoCacheMinTokens
+	}
+	marker := json.RawMessage(`{"type":"ephemeral"}`)
+	if opts.TTL == "1h" {
+		marker = json.RawMessage(`{"type":"ephemeral","ttl":"1h"}`)
+	}
+
+	inserted := 0
+	prefixTokens := 0
+
+	if tools, ok := req.Tools.([]any); ok {
+		lastTool := -1
+		lastToolPrefix := 0
+		for i, tool := range tools {
+			prefixTokens += estimateJSONTokens(tool)
+			if _, ok := tool.(*dto.Tool); ok {
+				lastTool = i
+				lastToolPrefix = prefixTokens
+			}
+		}
+		if lastTool >= 0 && lastToolPrefix >= minTokens {
+			tools[lastTool].(*dto.Tool).CacheControl = marker
+			inserted++
+		}
+	}
+
+	if system := systemBlocks(req); len(system) > 0 {
+		for _, block := range system {
+			prefixTokens += estimateTokens(block.GetText())
+		}
+		if last := lastCacheableBlock(system); last >= 0 && prefixTokens >= minTokens {
+			system[last].CacheControl = marker
+			req.System = system
+			inserted++
+		}
+	}
+
+	stable := -1
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			stable = i - 1
+			break
+		}
+	}
+	if stable >= 0 && inserted < MaxCacheBreakpoints {
+		for i := 0; i <= stable; i++ {
+			prefixTokens += estimateJSONTokens(req.Messages[i].Content)
+		}
+		if prefixTokens >= minTokens {
+			blocks := messageBlocks(req.Messages[stable])
+			if last := lastCacheableBlock(blocks); last >= 0 {
+				blocks[last].CacheControl = marker
+				req.Messages[stable].Content = blocks
+				inserted++
+			}
+		}
+	}
+	return inserted
+}
+
+func hasCacheControl(req *dto.ClaudeRequest) bool {
+	if len(req.CacheControl) > 0 {
+		return true
+	}
+	if tools, ok := req.Tools.([]any); ok {
+		for _, tool := range tools {
+			if t, ok := tool.(*dto.Tool); ok && len(t.CacheControl) > 0 {
+				return true
+			}
+		}
+	}
+	if blocks, ok := req.System.([]dto.ClaudeMediaMessage); ok {
+		for _, block := range blocks {
+			if len(block.CacheControl) > 0 {
+				return true
+			}
+		}
+	}
+	for _, message := range req.Messages {
+		if blocks, ok := message.Content.([]dto.ClaudeMediaMessage); ok {
+			for _, block := range blocks {
+				if len(block.CacheControl) > 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func systemBlocks(req *dto.ClaudeRequest) []dto.ClaudeMediaMessage {
+	switch system := req.System.(type) {
+	case []dto.ClaudeMediaMessage:
+		return system
+	case string:
+		if system == "" {
+			return nil
+		}
+		return []dto.ClaudeMediaMessage{{Type: "text", Text: kitutil.GetPointer(system)}}
+	default:
+		return nil
+	}
+}
+
+func messageBlocks(message dto.ClaudeMessage) []dto.ClaudeMediaMessage {
+	switch content := message.Content.(type) {
+	case []dto.ClaudeMediaMessage:
+		return content
+	case string:
+		if content == "" {
+			return nil
+		}
+		return []dto.ClaudeMediaMessage{{Type: "text", Text: kitutil.GetPointer(content)}}
+	default:
+		return nil
+	}
+}
+
+// lastCacheableBlock skips thinking blocks, which cannot carry cache_control.
+func lastCacheableBlock(blocks []dto.ClaudeMediaMessage) int {
+	for i := len(blocks) - 1; i >= 0; i-- {
+		switch blocks[i].Type {
+		case "thinking", "redacted_thinking":
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// estimateTokens is a rough 4-bytes-per-token estimate. It undercounts CJK
+// text, which only makes the minimum length check more conservative.
+func estimateTokens(text string) int {
+	return len(text) / 4
+}
+
+func estimateJSONTokens(v any) int {
+	if s, ok := v.(string); ok {
+		return estimateTokens(s)
+	}
+	raw, err := kitutil.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return estimateTokens(string(raw))
+}
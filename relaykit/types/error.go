@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	kitutil "github.com/QuantumNous/new-api/relaykit/relayconvert/kitutil"
 )
@@ -41,6 +42,11 @@ const (
 	ErrorCodeInvalidRequest         ErrorCode = "invalid_request"
 	ErrorCodeSensitiveWordsDetected ErrorCode = "sensitive_words_detected"
 	ErrorCodeViolationFeeGrokCSAM   ErrorCode = "violation_fee.grok.csam"
+	ErrorCodeGuardrailBlocked       ErrorCode = "guardrail_blocked"
+	ErrorCodeGuardrailFailed        ErrorCode = "guardrail_failed"
+	ErrorCodeGuardrailStream        ErrorCode = "guardrail_stream_unsupported"
+	ErrorCodeImagePolicyViolation   ErrorCode = "image_policy_violation"
+	ErrorCodeTokenScopeViolation    ErrorCode = "token_scope_violation"
 
 	// new api error
 	ErrorCodeCountTokenFailed   ErrorCode = "count_token_failed"
@@ -96,6 +102,7 @@ type NewAPIError struct {
 	errorCode      ErrorCode
 	StatusCode     int
 	Metadata       json.RawMessage
+	retryAfter     time.Duration
 }
 
 // Unwrap enables errors.Is / errors.As to work with NewAPIError by exposing the underlying error.
@@ -120,6 +127,14 @@ func (e *NewAPIError) GetErrorType() ErrorType {
 	return e.errorType
 }
 
+// GetRetryAfter returns the upstream Retry-After hint, or zero when absent.
+func (e *NewAPIError) GetRetryAfter() time.Duration {
+	if e == nil {
+		return 0
+	}
+	return e.retryAfter
+}
+
 func (e *NewAPIError) Error() string {
 	if e == nil {
 		return ""
@@ -396,6 +411,14 @@ func ErrOptionWithStatusCode(statusCode int) NewAPIErrorOptions {
 	}
 }
 
+func ErrOptionWithRetryAfter(retryAfter time.Duration) NewAPIErrorOptions {
+	return func(e *NewAPIError) {
+		if retryAfter > 0 {
+			e.retryAfter = retryAfter
+		}
+	}
+}
+
 func ErrOptionWithHideErrMsg(replaceStr string) NewAPIErrorOptions {
 	return func(e *NewAPIError) {
 		if kitutil.Debug.Load() {
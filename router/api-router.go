@@ -53,6 +53,11 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/telegram/bind/:flow_token", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.TelegramBind)
 		// Standard OAuth providers (GitHub, Discord, OIDC, LinuxDO) - unified route
 		apiRouter.GET("/oauth/:provider", middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.TryUserAuth(), controller.HandleOAuth)
+		// SAML 2.0 SP: metadata, SP-initiated login/bind and the assertion consumer service
+		apiRouter.POST("/saml/login", middleware.CriticalRateLimit(), middleware.DisableCache(), anonymousRequestBodyLimit, controller.SAMLLogin)
+		apiRouter.GET("/saml/:slug/metadata", middleware.DisableCache(), controller.GetSAMLMetadata)
+		apiRouter.POST("/saml/:slug/start", middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.TryUserAuth(), anonymousRequestBodyLimit, controller.StartSAML)
+		apiRouter.POST("/saml/:slug/acs", middleware.CriticalRateLimit(), middleware.DisableCache(), anonymousRequestBodyLimit, controller.SAMLAssertionConsumer)
 		apiRouter.GET("/ratio_config", middleware.CriticalRateLimit(), controller.GetRatioConfig)
 
 		apiRouter.POST("/stripe/webhook", anonymousRequestBodyLimit, controller.StripeWebhook)
@@ -71,6 +76,7 @@ func SetApiRouter(router *gin.Engine) {
 			userRoute.POST("/auth/logout", middleware.SessionCookieOriginGuard(), middleware.CriticalRateLimit(), middleware.DisableCache(), controller.AuthLogout)
 			userRoute.POST("/register", middleware.CriticalRateLimit(), anonymousRequestBodyLimit, middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.DisableCache(), anonymousRequestBodyLimit, middleware.TurnstileCheck(), controller.Login)
+			userRoute.POST("/ldap/login", middleware.CriticalRateLimit(), middleware.DisableCache(), anonymousRequestBodyLimit, middleware.TurnstileCheck(), controller.LDAPLogin)
 			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), middleware.DisableCache(), anonymousRequestBodyLimit, controller.Verify2FALogin)
 			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), middleware.DisableCache(), anonymousRequestBodyLimit, controller.PasskeyLoginBegin)
 			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), middleware.DisableCache(), anonymousRequestBodyLimit, controller.PasskeyLoginFinish)
@@ -127,6 +133,11 @@ func SetApiRouter(router *gin.Engine) {
 				// Custom OAuth bindings
 				selfRoute.GET("/oauth/bindings", controller.GetUserOAuthBindings)
 				selfRoute.DELETE("/oauth/bindings/:provider_id", controller.UnbindCustomOAuth)
+				selfRoute.GET("/saml/bindings", controller.GetUserSAMLBindings)
+				selfRoute.DELETE("/saml/bindings/:slug", controller.UnbindSAML)
+				selfRoute.GET("/ldap/binding", controller.GetUserLDAPBinding)
+				selfRoute.POST("/ldap/bind", middleware.CriticalRateLimit(), controller.LDAPBind)
+				selfRoute.DELETE("/ldap/binding", controller.UnbindLDAP)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -183,6 +194,50 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionAdminRoute.DELETE("/user_subscriptions/:id", controller.AdminDeleteUserSubscription)
 		}
 
+		// Organizations (shared wallets, members, org-owned tokens)
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/", controller.GetUserOrganizations)
+			organizationRoute.POST("/", controller.CreateOrganization)
+			organizationRoute.GET("/:id", controller.GetOrganization)
+			organizationRoute.PUT("/:id", controller.UpdateOrganization)
+			organizationRoute.GET("/:id/member", controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/member", controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/member/:user_id", controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/member/:user_id", controller.RemoveOrganizationMember)
+			organizationRoute.GET("/:id/token", controller.GetOrganizationTokens)
+			organizationRoute.DELETE("/:id/token/:token_id", controller.DeleteOrganizationToken)
+			organizationRoute.POST("/:id/token/:token_id/rotate", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.RotateOrganizationTokenKey)
+			organizationRoute.POST("/:id/fund", middleware.CriticalRateLimit(), controller.FundOrganization)
+			organizationRoute.GET("/:id/usage", controller.GetOrganizationUsage)
+		}
+		organizationAdminRoute := apiRouter.Group("/organization/admin")
+		organizationAdminRoute.Use(middleware.AdminAuth())
+		{
+			organizationAdminRoute.GET("/", controller.GetAllOrganizations)
+			organizationAdminRoute.PUT("/:id", controller.AdminUpdateOrganization)
+		}
+
+		resellerRoute := apiRouter.Group("/reseller")
+		resellerRoute.Use(middleware.UserAuth())
+		{
+			resellerRoute.GET("/", controller.GetResellerSelf)
+			resellerRoute.PUT("/markup", controller.UpdateResellerMarkup)
+			resellerRoute.GET("/child", controller.GetResellerChildren)
+			resellerRoute.POST("/child", middleware.CriticalRateLimit(), controller.CreateResellerChild)
+			resellerRoute.PUT("/child/:id", controller.UpdateResellerChild)
+			resellerRoute.POST("/child/:id/quota", middleware.CriticalRateLimit(), controller.AllocateResellerChildQuota)
+			resellerRoute.GET("/usage", controller.GetResellerChildUsage)
+		}
+		resellerAdminRoute := apiRouter.Group("/reseller/admin")
+		resellerAdminRoute.Use(middleware.AdminAuth())
+		{
+			resellerAdminRoute.GET("/", controller.GetAllResellers)
+			resellerAdminRoute.POST("/:user_id", controller.EnableReseller)
+			resellerAdminRoute.DELETE("/:user_id", controller.DisableReseller)
+		}
+
 		// Subscription payment callbacks (no auth)
 		apiRouter.POST("/subscription/epay/notify", anonymousRequestBodyLimit, controller.SubscriptionEpayNotify)
 		apiRouter.GET("/subscription/epay/notify", controller.SubscriptionEpayNotify)
@@ -196,6 +251,9 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.POST("/payment_compliance", controller.ConfirmPaymentCompliance)
 			optionRoute.GET("/channel_affinity_cache", controller.GetChannelAffinityCacheStats)
 			optionRoute.DELETE("/channel_affinity_cache", controller.ClearChannelAffinityCache)
+			optionRoute.GET("/proxy_pool_health", controller.GetProxyPoolHealth)
+			optionRoute.POST("/ldap/test", controller.TestLDAPSettings)
+			optionRoute.POST("/scim/token", controller.GenerateSCIMToken)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 			optionRoute.GET("/waffo-pancake/catalog", controller.ListWaffoPancakeCatalog)
 			optionRoute.POST("/waffo-pancake/pair", controller.CreateWaffoPancakePair)
@@ -215,6 +273,17 @@ func SetApiRouter(router *gin.Engine) {
 			customOAuthRoute.PUT("/:id", controller.UpdateCustomOAuthProvider)
 			customOAuthRoute.DELETE("/:id", controller.DeleteCustomOAuthProvider)
 		}
+		// SAML identity provider management (root only)
+		samlProviderRoute := apiRouter.Group("/saml-provider")
+		samlProviderRoute.Use(middleware.RootAuth())
+		{
+			samlProviderRoute.POST("/metadata", controller.FetchSAMLIdPMetadata)
+			samlProviderRoute.GET("/", controller.GetSAMLProviders)
+			samlProviderRoute.GET("/:id", controller.GetSAMLProvider)
+			samlProviderRoute.POST("/", controller.CreateSAMLProvider)
+			samlProviderRoute.PUT("/:id", controller.UpdateSAMLProvider)
+			samlProviderRoute.DELETE("/:id", controller.DeleteSAMLProvider)
+		}
 		performanceRoute := apiRouter.Group("/performance")
 		performanceRoute.Use(middleware.RootAuth())
 		{
@@ -225,6 +294,18 @@ func SetApiRouter(router *gin.Engine) {
 			performanceRoute.GET("/logs", controller.GetLogFiles)
 			performanceRoute.DELETE("/logs", controller.CleanupLogFiles)
 		}
+		shadowTrafficRoute := apiRouter.Group("/shadow_traffic")
+		shadowTrafficRoute.Use(middleware.RootAuth())
+		{
+			shadowTrafficRoute.GET("/records", controller.GetShadowTrafficRecords)
+			shadowTrafficRoute.GET("/summary", controller.GetShadowTrafficSummary)
+			shadowTrafficRoute.DELETE("/records", controller.DeleteShadowTrafficRecords)
+		}
+		modelSplitRoute := apiRouter.Group("/model_split")
+		modelSplitRoute.Use(middleware.AdminAuth())
+		{
+			modelSplitRoute.GET("/compare", controller.GetModelSplitComparison)
+		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
 		ratioSyncRoute.Use(middleware.RootAuth())
 		{
@@ -248,6 +329,17 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/batch/keys", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.GetTokenKeysBatch)
 		}
 
+		promptTemplateRoute := apiRouter.Group("/prompt_template")
+		promptTemplateRoute.Use(middleware.UserAuth())
+		{
+			promptTemplateRoute.GET("/", controller.GetPromptTemplates)
+			promptTemplateRoute.GET("/:id", controller.GetPromptTemplate)
+			promptTemplateRoute.POST("/", controller.CreatePromptTemplate)
+			promptTemplateRoute.PUT("/:id", controller.UpdatePromptTemplate)
+			promptTemplateRoute.POST("/:id/versions", controller.CreatePromptTemplateVersion)
+			promptTemplateRoute.DELETE("/:id", controller.DeletePromptTemplate)
+		}
+
 		usageRoute := apiRouter.Group("/usage")
 		usageRoute.Use(middleware.CORS(), middleware.CriticalRateLimit())
 		{
@@ -258,6 +350,14 @@ func SetApiRouter(router *gin.Engine) {
 			}
 		}
 
+		derivedTokenRoute := apiRouter.Group("/derived-token")
+		derivedTokenRoute.Use(middleware.CORS(), middleware.CriticalRateLimit(), middleware.TokenAuth())
+		{
+			derivedTokenRoute.GET("/", controller.GetDerivedTokens)
+			derivedTokenRoute.POST("/", middleware.DisableCache(), controller.CreateDerivedToken)
+			derivedTokenRoute.DELETE("/:id", controller.RevokeDerivedToken)
+		}
+
 		redemptionRoute := apiRouter.Group("/redemption")
 		redemptionRoute.Use(middleware.AdminAuth())
 		{
@@ -282,6 +382,10 @@ func SetApiRouter(router *gin.Engine) {
 		systemTaskRoute.Use(middleware.RootAuth())
 		{
 			systemTaskRoute.POST("/log-cleanup", controller.CreateLogCleanupSystemTask)
+			systemTaskRoute.POST("/channel-key-rotation", controller.CreateChannelKeyRotationSystemTask)
+			systemTaskRoute.POST("/token-key-hash", controller.CreateTokenKeyHashSystemTask)
+			systemTaskRoute.POST("/token-budget", controller.CreateTokenBudgetSystemTask)
+			systemTaskRoute.POST("/ldap-sync", controller.CreateLDAPSyncSystemTask)
 			systemTaskRoute.GET("/list", controller.ListSystemTasks)
 			systemTaskRoute.GET("/current", controller.GetCurrentSystemTask)
 			systemTaskRoute.GET("/:task_id", controller.GetSystemTask)
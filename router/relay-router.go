@@ -202,6 +202,21 @@ func SetRelayRouter(router *gin.Engine) {
 		relayGeminiRouter.POST("/models/*path", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatGemini)
 		})
+		// 上下文缓存创建按 model 选择渠道
+		relayGeminiRouter.POST("/cachedContents", controller.RelayGeminiCachedContentCreate)
+	}
+
+	// 其余上下文缓存操作发往创建缓存的渠道和 key，不经过渠道分发
+	geminiCachedContentRouter := router.Group("/v1beta/cachedContents")
+	geminiCachedContentRouter.Use(middleware.RouteTag("relay"))
+	geminiCachedContentRouter.Use(middleware.SystemPerformanceCheck())
+	geminiCachedContentRouter.Use(middleware.TokenAuth())
+	geminiCachedContentRouter.Use(middleware.TokenEndpointScope())
+	{
+		geminiCachedContentRouter.GET("", controller.RelayGeminiCachedContentList)
+		geminiCachedContentRouter.GET("/:id", controller.RelayGeminiCachedContentGet)
+		geminiCachedContentRouter.PATCH("/:id", controller.RelayGeminiCachedContentPatch)
+		geminiCachedContentRouter.DELETE("/:id", controller.RelayGeminiCachedContentDelete)
 	}
 }
 
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetSCIMRouter registers the SCIM 2.0 provisioning endpoints used by IdPs.
+func SetSCIMRouter(router *gin.Engine) {
+	scimRouter := router.Group("/scim/v2")
+	scimRouter.Use(middleware.RouteTag("scim"))
+	scimRouter.Use(middleware.GlobalAPIRateLimit())
+	scimRouter.Use(middleware.AnonymousRequestBodyLimit())
+	scimRouter.Use(middleware.SCIMAuth())
+	{
+		scimRouter.GET("/ServiceProviderConfig", controller.SCIMServiceProviderConfig)
+		scimRouter.GET("/ResourceTypes", controller.SCIMResourceTypes)
+
+		scimRouter.GET("/Users", controller.GetSCIMUsers)
+		scimRouter.POST("/Users", controller.CreateSCIMUser)
+		scimRouter.GET("/Users/:id", controller.GetSCIMUser)
+		scimRouter.PUT("/Users/:id", controller.ReplaceSCIMUser)
+		scimRouter.PATCH("/Users/:id", controller.PatchSCIMUser)
+		scimRouter.DELETE("/Users/:id", controller.DeleteSCIMUser)
+
+		scimRouter.GET("/Groups", controller.GetSCIMGroups)
+		scimRouter.POST("/Groups", controller.CreateSCIMGroup)
+		scimRouter.GET("/Groups/:id", controller.GetSCIMGroup)
+		scimRouter.PUT("/Groups/:id", controller.ReplaceSCIMGroup)
+		scimRouter.PATCH("/Groups/:id", controller.PatchSCIMGroup)
+		scimRouter.DELETE("/Groups/:id", controller.DeleteSCIMGroup)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
@@ -65,6 +66,7 @@ func (s *BillingSession) Settle(actualQuota int) error {
 		} else {
 			tokenErr = model.IncreaseTokenQuota(s.relayInfo.TokenId, s.relayInfo.TokenKey, -delta)
 		}
+		adjustDerivedTokenQuota(s.relayInfo, delta)
 		if tokenErr != nil {
 			// 资金来源已提交，令牌调整失败只能记录日志；标记 settled 防止 Refund 误退资金
 			common.SysLog(fmt.Sprintf("error adjusting token quota after funding settled (userId=%d, tokenId=%d, delta=%d): %s",
@@ -100,6 +102,7 @@ func (s *BillingSession) Refund(c *gin.Context) {
 	tokenKey := s.relayInfo.TokenKey
 	isPlayground := s.relayInfo.IsPlayground
 	tokenConsumed := s.tokenConsumed
+	relayInfo := s.relayInfo
 	extraReserved := s.extraReserved
 	subscriptionId := s.relayInfo.SubscriptionId
 	funding := s.funding
@@ -119,6 +122,7 @@ func (s *BillingSession) Refund(c *gin.Context) {
 			if err := model.IncreaseTokenQuota(tokenId, tokenKey, tokenConsumed); err != nil {
 				common.SysLog("error refunding token quota: " + err.Error())
 			}
+			adjustDerivedTokenQuota(relayInfo, -tokenConsumed)
 		}
 	})
 }
@@ -212,8 +216,21 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 				common.SysLog(fmt.Sprintf("error rolling back token quota (userId=%d, tokenId=%d, amount=%d, fundingErr=%s): %s",
 					s.relayInfo.UserId, s.relayInfo.TokenId, s.tokenConsumed, err.Error(), rollbackErr.Error()))
 			}
+			adjustDerivedTokenQuota(s.relayInfo, -s.tokenConsumed)
 			s.tokenConsumed = 0
 		}
+		if errors.Is(err, ErrInsufficientResellerQuota) {
+			return types.NewErrorWithStatusCode(
+				fmt.Errorf("上级账户额度不足, 请联系您的服务商"),
+				types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+				types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		if errors.Is(err, ErrInsufficientOrganizationQuota) {
+			return types.NewErrorWithStatusCode(
+				fmt.Errorf("组织额度不足或已达到成员额度上限, 需要预扣费额度: %s", logger.FormatQuota(effectiveQuota)),
+				types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+				types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
 		// TODO: model 层应定义哨兵错误（如 ErrNoActiveSubscription），用 errors.Is 替代字符串匹配
 		if errors.Is(err, ErrInsufficientWalletQuota) {
 			userQuota, quotaErr := model.GetUserQuota(s.relayInfo.UserId, false)
@@ -251,6 +268,7 @@ func (s *BillingSession) reserveFunding(delta int) error {
 			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
 		}
 		funding.consumed += delta
+		funding.chargeReseller(delta)
 		return nil
 	case *SubscriptionFunding:
 		if err := model.PostConsumeUserSubscriptionDelta(funding.subscriptionId, int64(delta)); err != nil {
@@ -263,6 +281,19 @@ func (s *BillingSession) reserveFunding(delta int) error {
 			)
 		}
 		return nil
+	case *OrganizationFunding:
+		reserved, err := model.TryReserveOrganizationQuota(funding.orgId, funding.userId, delta)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+		}
+		if !reserved {
+			return types.NewErrorWithStatusCode(
+				fmt.Errorf("组织额度不足或已达到成员额度上限, 需要预扣费额度: %s", logger.FormatQuota(delta)),
+				types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+				types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		funding.consumed += delta
+		return nil
 	default:
 		return types.NewError(fmt.Errorf("unsupported funding source: %s", s.funding.Source()), types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
 	}
@@ -275,11 +306,18 @@ func (s *BillingSession) rollbackFundingReserve(delta int) {
 			common.SysLog("error rolling back wallet funding reserve: " + err.Error())
 		} else {
 			funding.consumed -= delta
+			funding.chargeReseller(-delta)
 		}
 	case *SubscriptionFunding:
 		if err := model.PostConsumeUserSubscriptionDelta(funding.subscriptionId, -int64(delta)); err != nil {
 			common.SysLog("error rolling back subscription funding reserve: " + err.Error())
 		}
+	case *OrganizationFunding:
+		if err := model.AdjustOrganizationQuota(funding.orgId, funding.userId, -delta); err != nil {
+			common.SysLog("error rolling back organization funding reserve: " + err.Error())
+		} else {
+			funding.consumed -= delta
+		}
 	}
 }
 
@@ -299,6 +337,10 @@ func (s *BillingSession) shouldTrust(c *gin.Context) bool {
 	if s.relayInfo.ForcePreConsume {
 		return false
 	}
+	// 周期预算与子令牌的消费上限在预扣时校验，受其限制的令牌不能跳过预扣
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenBudgetLimited) {
+		return false
+	}
 
 	trustQuota := common.GetTrustQuota()
 	if trustQuota <= 0 {
@@ -317,7 +359,14 @@ func (s *BillingSession) shouldTrust(c *gin.Context) bool {
 
 	switch s.funding.Source() {
 	case BillingSourceWallet:
+		// 转售商的余额需要在预扣时校验
+		if s.relayInfo.ResellerId > 0 {
+			return false
+		}
 		return s.relayInfo.UserQuota > trustQuota
+	case BillingSourceOrganization:
+		// 成员额度上限需要在预扣时校验
+		return false
 	case BillingSourceSubscription:
 		// 订阅不能启用信任旁路。原因：
 		// 1. PreConsumeUserSubscription 要求 amount>0 来创建预扣记录并锁定订阅
@@ -359,7 +408,23 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return nil, types.NewError(fmt.Errorf("relayInfo is nil"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	// 组织令牌只从组织钱包扣费，不使用成员个人的钱包或订阅
+	if relayInfo.OrgId > 0 {
+		session := &BillingSession{
+			relayInfo: relayInfo,
+			funding:   &OrganizationFunding{orgId: relayInfo.OrgId, userId: relayInfo.UserId},
+		}
+		if apiErr := session.preConsume(c, preConsumedQuota); apiErr != nil {
+			return nil, apiErr
+		}
+		return session, nil
+	}
+
 	pref := common.NormalizeBillingPreference(relayInfo.UserSetting.BillingPreference)
+	if relayInfo.ResellerId > 0 {
+		// 子账户只使用转售商分配的钱包额度，转售商按平台价二次结算
+		pref = "wallet_only"
+	}
 
 	// 钱包路径需要先检查用户额度
 	tryWallet := func() (*BillingSession, *types.NewAPIError) {
@@ -383,7 +448,7 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 
 		session := &BillingSession{
 			relayInfo: relayInfo,
-			funding:   &WalletFunding{userId: relayInfo.UserId},
+			funding:   newWalletFunding(relayInfo),
 		}
 		if apiErr := session.preConsume(c, preConsumedQuota); apiErr != nil {
 			return nil, apiErr
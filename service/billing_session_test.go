@@ -0,0 +1,61 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillingSessionDoesNotTrustBudgetLimitedToken(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	session := &BillingSession{
+		relayInfo: &relaycommon.RelayInfo{TokenUnlimited: true, UserQuota: common.GetTrustQuota() * 2},
+		funding:   &WalletFunding{userId: 1},
+	}
+	require.True(t, session.shouldTrust(c))
+
+	common.SetContextKey(c, constant.ContextKeyTokenBudgetLimited, true)
+	require.False(t, session.shouldTrust(c))
+}
+
+func TestBillingSessionDrawsFromOrganizationWallet(t *testing.T) {
+	truncate(t)
+	seedUser(t, 2, 5000)
+	org, err := model.CreateOrganization("acme", 1)
+	require.NoError(t, err)
+	require.NoError(t, model.IncreaseOrganizationQuota(org.Id, 1000))
+	_, err = model.AddOrganizationMember(org.Id, 2, model.OrganizationRoleDeveloper, 400)
+	require.NoError(t, err)
+	seedToken(t, 1, 2, "org-token-key", 10000)
+	require.NoError(t, model.DB.Model(&model.Token{}).Where("id = ?", 1).Update("org_id", org.Id).Error)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	relayInfo := &relaycommon.RelayInfo{UserId: 2, TokenId: 1, TokenKey: "org-token-key", OrgId: org.Id, ForcePreConsume: true}
+	session, apiErr := NewBillingSession(c, relayInfo, 300)
+	require.Nil(t, apiErr)
+	assert.Equal(t, BillingSourceOrganization, session.funding.Source())
+	require.NoError(t, session.Settle(250))
+
+	reloadedOrg, err := model.GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 750, reloadedOrg.Quota)
+	member, err := model.GetOrganizationMember(org.Id, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 250, member.UsedQuota)
+	// 成员个人钱包不变，令牌额度照常扣减
+	assert.Equal(t, 5000, getUserQuota(t, 2))
+	assert.Equal(t, 9750, getTokenRemainQuota(t, 1))
+
+	// 超出成员额度上限时拒绝，且不扣减令牌
+	_, apiErr = NewBillingSession(c, relayInfo, 200)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, 9750, getTokenRemainQuota(t, 1))
+}
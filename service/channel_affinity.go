@@ -25,6 +25,7 @@ const (
 	ginKeyChannelAffinityMeta       = "channel_affinity_meta"
 	ginKeyChannelAffinityLogInfo    = "channel_affinity_log_info"
 	ginKeyChannelAffinitySkipRetry  = "channel_affinity_skip_retry_on_failure"
+	ginKeyChannelAffinityApplied    = "channel_affinity_applied"
 
 	channelAffinityCacheNamespace           = "new-api:channel_affinity:v1"
 	channelAffinityUsageCacheStatsNamespace = "new-api:channel_affinity_usage_cache_stats:v1"
@@ -61,6 +62,8 @@ type ChannelAffinityStatsContext struct {
 	UsingGroup     string
 	KeyFingerprint string
 	TTLSeconds     int64
+	// Applied reports whether the channel came from an existing affinity entry.
+	Applied bool
 }
 
 const (
@@ -307,6 +310,16 @@ func extractChannelAffinityValue(c *gin.Context, src operation_setting.ChannelAf
 			return ""
 		}
 		return strings.TrimSpace(c.Request.Header.Get(src.Key))
+	case channelAffinityKeySourcePromptPrefix:
+		storage, err := common.GetBodyStorage(c)
+		if err != nil {
+			return ""
+		}
+		body, err := storage.Bytes()
+		if err != nil {
+			return ""
+		}
+		return buildChannelAffinityPromptPrefix(body, src.PrefixTokens)
 	case "gjson":
 		if src.Path == "" {
 			return ""
@@ -407,6 +420,7 @@ func GetChannelAffinityStatsContext(c *gin.Context) (ChannelAffinityStatsContext
 		UsingGroup:     usingGroup,
 		KeyFingerprint: keyFp,
 		TTLSeconds:     ttlSeconds,
+		Applied:        c.GetBool(ginKeyChannelAffinityApplied),
 	}, true
 }
 
@@ -665,6 +679,22 @@ func ClearCurrentChannelAffinityCache(c *gin.Context) bool {
 	return false
 }
 
+// GetChannelAffinityKeySeed returns a stable seed for choosing a multi-key
+// channel key. Only prompt_prefix rules pin the key, because provider prompt
+// caches are scoped to the API key as well as the prefix.
+func GetChannelAffinityKeySeed(c *gin.Context) (uint64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	meta, ok := getChannelAffinityMeta(c)
+	if !ok || meta.KeySourceType != channelAffinityKeySourcePromptPrefix || meta.CacheKey == "" {
+		return 0, false
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(meta.CacheKey))
+	return h.Sum64(), true
+}
+
 func ShouldKeepChannelAffinityOnChannelDisabled() bool {
 	setting := operation_setting.GetChannelAffinitySetting()
 	if setting == nil {
@@ -682,6 +712,7 @@ func MarkChannelAffinityUsed(c *gin.Context, selectedGroup string, channelID int
 		return
 	}
 	c.Set(ginKeyChannelAffinitySkipRetry, meta.SkipRetry)
+	c.Set(ginKeyChannelAffinityApplied, true)
 	info := map[string]interface{}{
 		"reason":         meta.RuleName,
 		"rule_name":      meta.RuleName,
@@ -748,6 +779,8 @@ type ChannelAffinityUsageCacheStats struct {
 	Hit           int64 `json:"hit"`
 	Total         int64 `json:"total"`
 	WindowSeconds int64 `json:"window_seconds"`
+	AffinityHit   int64 `json:"affinity_hit"`
+	AffinityTotal int64 `json:"affinity_total"`
 
 	PromptTokens         int64 `json:"prompt_tokens"`
 	CompletionTokens     int64 `json:"completion_tokens"`
@@ -763,6 +796,10 @@ type ChannelAffinityUsageCacheCounters struct {
 	Hit           int64 `json:"hit"`
 	Total         int64 `json:"total"`
 	WindowSeconds int64 `json:"window_seconds"`
+	// AffinityHit/AffinityTotal only count requests routed by an existing
+	// affinity entry, so they can be compared with the overall hit rate.
+	AffinityHit   int64 `json:"affinity_hit"`
+	AffinityTotal int64 `json:"affinity_total"`
 
 	PromptTokens         int64 `json:"prompt_tokens"`
 	CompletionTokens     int64 `json:"completion_tokens"`
@@ -800,7 +837,25 @@ func GetChannelAffinityUsageCacheStats(ruleName, usingGroup, keyFp string) Chann
 			KeyFingerprint: keyFp,
 		}
 	}
+	return getChannelAffinityUsageCacheStatsByEntry(entryKey, ruleName, usingGroup, keyFp)
+}
+
+// GetChannelAffinityRuleUsageCacheStats returns the counters of all keys of a
+// rule within the using group, i.e. the cache effect of the rule as a whole.
+func GetChannelAffinityRuleUsageCacheStats(ruleName, usingGroup string) ChannelAffinityUsageCacheStats {
+	ruleName = strings.TrimSpace(ruleName)
+	usingGroup = strings.TrimSpace(usingGroup)
+	entryKey := channelAffinityRuleUsageCacheEntryKey(ruleName, usingGroup)
+	if entryKey == "" {
+		return ChannelAffinityUsageCacheStats{
+			RuleName:   ruleName,
+			UsingGroup: usingGroup,
+		}
+	}
+	return getChannelAffinityUsageCacheStatsByEntry(entryKey, ruleName, usingGroup, "")
+}
 
+func getChannelAffinityUsageCacheStatsByEntry(entryKey, ruleName, usingGroup, keyFp string) ChannelAffinityUsageCacheStats {
 	cache := getChannelAffinityUsageCacheStatsCache()
 	v, found, err := cache.Get(entryKey)
 	if err != nil || !found {
@@ -818,6 +873,8 @@ func GetChannelAffinityUsageCacheStats(ruleName, usingGroup, keyFp string) Chann
 		Hit:                  v.Hit,
 		Total:                v.Total,
 		WindowSeconds:        v.WindowSeconds,
+		AffinityHit:          v.AffinityHit,
+		AffinityTotal:        v.AffinityTotal,
 		PromptTokens:         v.PromptTokens,
 		CompletionTokens:     v.CompletionTokens,
 		TotalTokens:          v.TotalTokens,
@@ -838,6 +895,12 @@ func observeChannelAffinityUsageCache(statsCtx ChannelAffinityStatsContext, usag
 		return
 	}
 
+	observeChannelAffinityUsageCacheEntry(entryKey, statsCtx, usage, cachedTokenRateMode)
+	observeChannelAffinityUsageCacheEntry(channelAffinityRuleUsageCacheEntryKey(statsCtx.RuleName, statsCtx.UsingGroup), statsCtx, usage, cachedTokenRateMode)
+}
+
+func observeChannelAffinityUsageCacheEntry(entryKey string, statsCtx ChannelAffinityStatsContext, usage *dto.Usage, cachedTokenRateMode string) {
+	windowSeconds := statsCtx.TTLSeconds
 	cache := getChannelAffinityUsageCacheStatsCache()
 	ttl := time.Duration(windowSeconds) * time.Second
 
@@ -866,6 +929,12 @@ func observeChannelAffinityUsageCache(statsCtx ChannelAffinityStatsContext, usag
 	if hit {
 		next.Hit++
 	}
+	if statsCtx.Applied {
+		next.AffinityTotal++
+		if hit {
+			next.AffinityHit++
+		}
+	}
 	next.WindowSeconds = windowSeconds
 	next.LastSeenAt = time.Now().Unix()
 	next.CachedTokens += cachedTokens
@@ -910,6 +979,12 @@ func channelAffinityUsageCacheEntryKey(ruleName, usingGroup, keyFp string) strin
 	return ruleName + "\n" + usingGroup + "\n" + keyFp
 }
 
+// channelAffinityRuleUsageCacheEntryKey aggregates all keys of a rule. Key
+// fingerprints are hex, so "*" never collides with a per-key entry.
+func channelAffinityRuleUsageCacheEntryKey(ruleName, usingGroup string) string {
+	return channelAffinityUsageCacheEntryKey(ruleName, usingGroup, "*")
+}
+
 func usageCacheSignals(usage *dto.Usage) (hit bool, cachedTokens int64, promptCacheHitTokens int64) {
 	if usage == nil {
 		return false, 0, 0
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	channelAffinityKeySourcePromptPrefix = "prompt_prefix"
+
+	defaultChannelAffinityPromptPrefixTokens = 1024
+)
+
+// promptPrefixBuilder collects normalized prompt text until the token budget is
+// used up. Tokens are counted coarsely (a run of letters/digits, a CJK character
+// or a symbol is one token) so the cut point does not depend on the model.
+type promptPrefixBuilder struct {
+	sb      strings.Builder
+	limit   int
+	tokens  int
+	inWord  bool
+	inSpace bool
+}
+
+func (b *promptPrefixBuilder) full() bool {
+	return b.tokens >= b.limit
+}
+
+func (b *promptPrefixBuilder) write(text string) {
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			b.inWord = false
+			if b.sb.Len() > 0 && !b.inSpace {
+				b.sb.WriteByte(' ')
+				b.inSpace = true
+			}
+			continue
+		}
+		b.inSpace = false
+		if (unicode.IsLetter(r) || unicode.IsNumber(r)) && !isCJK(r) {
+			if !b.inWord {
+				if b.full() {
+					return
+				}
+				b.tokens++
+				b.inWord = true
+			}
+			b.sb.WriteRune(r)
+			continue
+		}
+		b.inWord = false
+		if b.full() {
+			return
+		}
+		b.tokens++
+		b.sb.WriteRune(r)
+	}
+}
+
+// segment writes one logical part of the prompt, separated from the previous one.
+func (b *promptPrefixBuilder) segment(label string, text string) {
+	if b.full() || strings.TrimSpace(text) == "" {
+		return
+	}
+	b.write("\n" + label + ": ")
+	b.write(text)
+}
+
+// promptContentText flattens a message content (string, OpenAI/Claude/Responses
+// parts or Gemini parts) to text. Non-text parts only contribute their type so
+// that re-encoded images do not break the prefix.
+func promptContentText(content gjson.Result) string {
+	if !content.Exists() {
+		return ""
+	}
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	if !content.IsArray() {
+		return content.Raw
+	}
+	var sb strings.Builder
+	content.ForEach(func(_, part gjson.Result) bool {
+		if part.Type == gjson.String {
+			sb.WriteString(part.String())
+			return true
+		}
+		if text := part.Get("text"); text.Exists() {
+			sb.WriteString(text.String())
+		} else if partType := part.Get("type").String(); partType != "" {
+			sb.WriteString("[" + partType + "]")
+		} else {
+			part.ForEach(func(key, _ gjson.Result) bool {
+				sb.WriteString("[" + key.String() + "]")
+				return false
+			})
+		}
+		sb.WriteByte('\n')
+		return true
+	})
+	return sb.String()
+}
+
+// buildChannelAffinityPromptPrefix returns the first prefixTokens tokens of the
+// system prompt, tool definitions and leading messages, in that order, which is
+// the order providers use when matching prompt caches. Requests shorter than
+// the budget return "" since their key would change with every new turn.
+func buildChannelAffinityPromptPrefix(body []byte, prefixTokens int) string {
+	if prefixTokens <= 0 {
+		prefixTokens = defaultChannelAffinityPromptPrefixTokens
+	}
+	if len(body) == 0 || !gjson.ValidBytes(body) {
+		return ""
+	}
+	b := &promptPrefixBuilder{limit: prefixTokens}
+
+	// system prompt: Claude system, Responses instructions, Gemini systemInstruction
+	b.segment("system", promptContentText(gjson.GetBytes(body, "system")))
+	b.segment("system", gjson.GetBytes(body, "instructions").String())
+	b.segment("system", promptContentText(gjson.GetBytes(body, "systemInstruction.parts")))
+	b.segment("system", promptContentText(gjson.GetBytes(body, "system_instruction.parts")))
+	messages := gjson.GetBytes(body, "messages")
+	messages.ForEach(func(_, msg gjson.Result) bool {
+		role := msg.Get("role").String()
+		if role == "system" || role == "developer" {
+			b.segment("system", promptContentText(msg.Get("content")))
+		}
+		return !b.full()
+	})
+
+	gjson.GetBytes(body, "tools").ForEach(func(_, tool gjson.Result) bool {
+		raw := []byte(tool.Raw)
+		// clients move cache_control between requests, it is not part of the prefix
+		if stripped, err := sjson.DeleteBytes(raw, "cache_control"); err == nil {
+			raw = stripped
+		}
+		b.segment("tool", gjson.GetBytes(raw, "@ugly").Raw)
+		return !b.full()
+	})
+
+	messages.ForEach(func(_, msg gjson.Result) bool {
+		role := msg.Get("role").String()
+		if role != "system" && role != "developer" {
+			b.segment(role, promptContentText(msg.Get("content")))
+		}
+		return !b.full()
+	})
+	gjson.GetBytes(body, "contents").ForEach(func(_, msg gjson.Result) bool {
+		b.segment(msg.Get("role").String(), promptContentText(msg.Get("parts")))
+		return !b.full()
+	})
+	input := gjson.GetBytes(body, "input")
+	if input.Type == gjson.String {
+		b.segment("user", input.String())
+	} else {
+		input.ForEach(func(_, item gjson.Result) bool {
+			if content := item.Get("content"); content.Exists() {
+				b.segment(item.Get("role").String(), promptContentText(content))
+			} else {
+				b.segment(item.Get("type").String(), item.Raw)
+			}
+			return !b.full()
+		})
+	}
+
+	if !b.full() {
+		return ""
+	}
+	return common.Sha1([]byte(b.sb.String()))
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildChannelAffinityPromptPrefix(t *testing.T) {
+	system := strings.Repeat("you are a helpful assistant ", 10)
+	first := `{"model":"gpt-4o","messages":[{"role":"system","content":"` + system + `"},{"role":"user","content":"hi"}]}`
+	later := `{"model":"gpt-4o","stream":true,"messages":[{"role":"system","content":"` + strings.ReplaceAll(system, " ", "  ") + `"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"next"}]}`
+	other := `{"model":"gpt-4o","messages":[{"role":"system","content":"` + strings.Repeat("you are a pirate ", 20) + `"}]}`
+
+	key := buildChannelAffinityPromptPrefix([]byte(first), 20)
+	require.NotEmpty(t, key)
+	assert.Equal(t, key, buildChannelAffinityPromptPrefix([]byte(later), 20), "same leading tokens share the key")
+	assert.NotEqual(t, key, buildChannelAffinityPromptPrefix([]byte(other), 20))
+	assert.Empty(t, buildChannelAffinityPromptPrefix([]byte(first), 10_000), "prompts shorter than the budget have no key")
+	assert.Empty(t, buildChannelAffinityPromptPrefix([]byte("not json"), 20))
+}
+
+func TestBuildChannelAffinityPromptPrefixIgnoresCacheControl(t *testing.T) {
+	tools := `[{"name":"search","description":"search the web for the latest documents and news","input_schema":{"type":"object"}}]`
+	withCache := `[{"name":"search","description":"search the web for the latest documents and news","input_schema":{"type":"object"},"cache_control":{"type":"ephemeral"}}]`
+	a := `{"system":[{"type":"text","text":"be brief"}],"tools":` + tools + `,"messages":[{"role":"user","content":[{"type":"text","text":"one two three four five"}]}]}`
+	b := `{"system":[{"type":"text","text":"be brief"}],"tools":` + withCache + `,"messages":[{"role":"user","content":[{"type":"text","text":"one two three four five six"}]}]}`
+	assert.Equal(t, buildChannelAffinityPromptPrefix([]byte(a), 30), buildChannelAffinityPromptPrefix([]byte(b), 30))
+}
+
+func TestGetPreferredChannelByAffinityPromptPrefixPinsKey(t *testing.T) {
+	setting := operation_setting.GetChannelAffinitySetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.Enabled = true
+	setting.Rules = []operation_setting.ChannelAffinityRule{{
+		Name:            "prefix",
+		ModelRegex:      []string{"^gpt-"},
+		KeySources:      []operation_setting.ChannelAffinityKeySource{{Type: "prompt_prefix", PrefixTokens: 5}},
+		IncludeRuleName: true,
+	}}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	c.Set(common.KeyRequestBody, []byte(`{"messages":[{"role":"system","content":"one two three four five six"}]}`))
+	_, found := GetPreferredChannelByAffinity(c, "gpt-4o", "default")
+	assert.False(t, found)
+	seed, ok := GetChannelAffinityKeySeed(c)
+	require.True(t, ok)
+
+	again, _ := gin.CreateTestContext(httptest.NewRecorder())
+	again.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	again.Set(common.KeyRequestBody, []byte(`{"messages":[{"role":"system","content":"one two three four five seven"}]}`))
+	GetPreferredChannelByAffinity(again, "gpt-4o", "default")
+	againSeed, ok := GetChannelAffinityKeySeed(again)
+	require.True(t, ok)
+	assert.Equal(t, seed, againSeed)
+}
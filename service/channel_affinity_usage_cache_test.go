@@ -103,3 +103,29 @@ func TestObserveChannelAffinityUsageCacheByRelayFormat_UnsupportedModeKeepsEmpty
 	require.EqualValues(t, 25, stats.CachedTokens)
 	require.Equal(t, "", stats.CachedTokenRateMode)
 }
+
+func TestObserveChannelAffinityUsageCache_RuleAggregate(t *testing.T) {
+	ruleName := fmt.Sprintf("rule_%d", time.Now().UnixNano())
+	usingGroup := "default"
+	first := buildChannelAffinityStatsContextForTest(ruleName, usingGroup, "fp_a")
+	second := buildChannelAffinityStatsContextForTest(ruleName, usingGroup, "fp_b")
+	MarkChannelAffinityUsed(second, usingGroup, 7)
+
+	ObserveChannelAffinityUsageCacheByRelayFormat(first, &dto.Usage{PromptTokens: 100}, types.RelayFormatOpenAI)
+	ObserveChannelAffinityUsageCacheByRelayFormat(second, &dto.Usage{
+		PromptTokens:        100,
+		PromptTokensDetails: dto.InputTokenDetails{CachedTokens: 80},
+	}, types.RelayFormatOpenAI)
+
+	stats := GetChannelAffinityRuleUsageCacheStats(ruleName, usingGroup)
+	require.EqualValues(t, 2, stats.Total)
+	require.EqualValues(t, 1, stats.Hit)
+	require.EqualValues(t, 1, stats.AffinityTotal)
+	require.EqualValues(t, 1, stats.AffinityHit)
+	require.EqualValues(t, 200, stats.PromptTokens)
+	require.EqualValues(t, 80, stats.CachedTokens)
+
+	perKey := GetChannelAffinityUsageCacheStats(ruleName, usingGroup, "fp_a")
+	require.EqualValues(t, 1, perKey.Total)
+	require.EqualValues(t, 0, perKey.AffinityTotal)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+const (
+	channelKeyRotationBatchSize            = 100
+	channelKeyRotationDefaultIntervalHours = 24
+)
+
+// channelKeyRotationHandler re-encrypts channel keys that are still plaintext or
+// encrypted with an older master key. It is scheduled while encryption is
+// enabled, so adding a new key version rotates the existing rows on the next run;
+// admins can also trigger it manually.
+type channelKeyRotationHandler struct{}
+
+type ChannelKeyRotationResult struct {
+	KeyVersion int `json:"key_version"`
+	Scanned    int `json:"scanned"`
+	Rotated    int `json:"rotated"`
+}
+
+func (channelKeyRotationHandler) Type() string { return model.SystemTaskTypeChannelKeyRotation }
+
+func (channelKeyRotationHandler) Enabled() bool {
+	return common.SecretEncryptionEnabled() && common.GetEnvOrDefaultBool("CHANNEL_KEY_ROTATION_TASK_ENABLED", true)
+}
+
+func (channelKeyRotationHandler) Interval() time.Duration {
+	intervalHours := common.GetEnvOrDefault("CHANNEL_KEY_ROTATION_TASK_INTERVAL_HOURS", channelKeyRotationDefaultIntervalHours)
+	if intervalHours < 1 {
+		intervalHours = channelKeyRotationDefaultIntervalHours
+	}
+	return time.Duration(intervalHours) * time.Hour
+}
+
+func (channelKeyRotationHandler) NewPayload() any { return nil }
+
+func (channelKeyRotationHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	result, err := runChannelKeyRotation(ctx, NewSystemTaskProgressReporter(task, runnerID))
+	if err != nil {
+		failSystemTask(task, runnerID, err)
+		return
+	}
+	if err := model.FinishSystemTask(task.TaskID, runnerID, model.SystemTaskStatusSucceeded, result, ""); err != nil {
+		logSystemTaskLockError(ctx, task, err)
+	}
+}
+
+func init() {
+	RegisterSystemTaskHandler(channelKeyRotationHandler{})
+}
+
+func runChannelKeyRotation(ctx context.Context, report func(processed, total int)) (*ChannelKeyRotationResult, error) {
+	if !common.SecretEncryptionEnabled() {
+		return nil, errors.New("channel key encryption is not enabled")
+	}
+	total, err := model.CountAllChannels()
+	if err != nil {
+		return nil, err
+	}
+	result := &ChannelKeyRotationResult{KeyVersion: common.LatestSecretKeyVersion()}
+	lastId := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		nextId, scanned, rotated, err := model.ChannelKeyRotationBatch(lastId, channelKeyRotationBatchSize)
+		result.Scanned += scanned
+		result.Rotated += rotated
+		if err != nil {
+			return nil, err
+		}
+		if int64(result.Scanned) > total {
+			total = int64(result.Scanned)
+		}
+		report(result.Scanned, int(total))
+		if scanned < channelKeyRotationBatchSize {
+			break
+		}
+		lastId = nextId
+	}
+	report(result.Scanned, result.Scanned)
+	return result, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+)
+
+// maxRetryAfter bounds how far into the future a Retry-After hint is trusted.
+const maxRetryAfter = 10 * time.Minute
+
+// ParseRetryAfter parses a Retry-After header in either delta-seconds or
+// HTTP-date form. Missing, malformed or past values yield zero.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	} else if at, err := http.ParseTime(value); err == nil {
+		d = at.Sub(now)
+	}
+	if d <= 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	return d
+}
+
+// SameChannelRetry tracks same-channel retry attempts for one channel selection.
+// 同渠道重试：在切换渠道之前，对瞬时错误按退避策略重试当前渠道。
+type SameChannelRetry struct {
+	policy   dto.SameChannelRetryPolicy
+	attempts int
+	waited   time.Duration
+	delays   []int64
+}
+
+// NewSameChannelRetry returns nil when the policy is absent or disabled.
+func NewSameChannelRetry(policy *dto.SameChannelRetryPolicy) *SameChannelRetry {
+	if policy == nil || !policy.Enabled {
+		return nil
+	}
+	return &SameChannelRetry{policy: policy.Normalized()}
+}
+
+// Attempts returns the number of same-channel retries granted so far.
+func (r *SameChannelRetry) Attempts() int {
+	if r == nil {
+		return 0
+	}
+	return r.attempts
+}
+
+// DelaysMs returns the wait applied before each granted retry, in milliseconds.
+func (r *SameChannelRetry) DelaysMs() []int64 {
+	if r == nil {
+		return nil
+	}
+	return r.delays
+}
+
+// Next decides whether err should be retried on the same channel and, if so,
+// how long to wait first. Errors excluded from cross-channel retry (skip-retry,
+// channel affinity failures, always-skip codes) are never retried here either.
+// Granting a retry consumes one attempt and the delay from the total wait budget.
+func (r *SameChannelRetry) Next(c *gin.Context, err *types.NewAPIError) (time.Duration, bool) {
+	if r == nil || err == nil {
+		return 0, false
+	}
+	if types.IsSkipRetryError(err) || types.IsChannelError(err) {
+		return 0, false
+	}
+	if ShouldSkipRetryAfterChannelAffinityFailure(c) {
+		return 0, false
+	}
+	if operation_setting.IsAlwaysSkipRetryCode(err.GetErrorCode()) || operation_setting.IsAlwaysSkipRetryStatusCode(err.StatusCode) {
+		return 0, false
+	}
+	if r.attempts >= r.policy.MaxAttempts {
+		return 0, false
+	}
+	if !r.policy.MatchStatusCode(err.StatusCode) {
+		return 0, false
+	}
+	if ShouldDisableChannel(err) {
+		return 0, false
+	}
+	delay := r.backoff()
+	if r.policy.RespectRetryAfter {
+		if retryAfter := err.GetRetryAfter(); retryAfter > 0 {
+			delay = retryAfter
+		}
+	}
+	budget := time.Duration(r.policy.MaxTotalWaitMs) * time.Millisecond
+	if r.waited+delay > budget {
+		return 0, false
+	}
+	r.attempts++
+	r.waited += delay
+	r.delays = append(r.delays, delay.Milliseconds())
+	return delay, true
+}
+
+// backoff returns an exponential step with equal jitter: a uniformly random
+// value in [step/2, step], where step doubles per attempt and is capped.
+func (r *SameChannelRetry) backoff() time.Duration {
+	step := time.Duration(r.policy.BaseDelayMs) * time.Millisecond
+	maxStep := time.Duration(r.policy.MaxDelayMs) * time.Millisecond
+	for i := 0; i < r.attempts && step < maxStep; i++ {
+		step *= 2
+	}
+	if step > maxStep {
+		step = maxStep
+	}
+	half := step / 2
+	if half <= 0 {
+		return step
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// WaitSameChannelRetry sleeps for delay unless ctx is done first.
+func WaitSameChannelRetry(ctx context.Context, delay time.Duration) bool {
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// AppendSameChannelRetryAdminInfo copies the recorded same-channel retry delays
+// into the admin-only log info.
+func AppendSameChannelRetryAdminInfo(c *gin.Context, adminInfo map[string]interface{}) {
+	if c == nil || adminInfo == nil {
+		return
+	}
+	retries, ok := common.GetContextKeyType[map[string][]int64](c, constant.ContextKeySameChannelRetries)
+	if !ok || len(retries) == 0 {
+		return
+	}
+	adminInfo["same_channel_retries"] = retries
+}
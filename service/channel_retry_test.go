@@ -0,0 +1,108 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, 3*time.Second, ParseRetryAfter("3", now))
+	require.Equal(t, 1500*time.Millisecond, ParseRetryAfter("1.5", now))
+	require.Equal(t, 5*time.Second, ParseRetryAfter(now.Add(5*time.Second).Format(http.TimeFormat), now))
+	require.Zero(t, ParseRetryAfter("", now))
+	require.Zero(t, ParseRetryAfter("-1", now))
+	require.Zero(t, ParseRetryAfter("soon", now))
+	require.Zero(t, ParseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	require.Equal(t, maxRetryAfter, ParseRetryAfter("86400", now))
+}
+
+func TestSameChannelRetryDisabled(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, NewSameChannelRetry(nil))
+	require.Nil(t, NewSameChannelRetry(&dto.SameChannelRetryPolicy{Enabled: false, MaxAttempts: 3}))
+
+	var retry *SameChannelRetry
+	_, ok := retry.Next(nil, types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, http.StatusServiceUnavailable))
+	require.False(t, ok)
+}
+
+func TestSameChannelRetryBackoffAndBudget(t *testing.T) {
+	t.Parallel()
+
+	retry := NewSameChannelRetry(&dto.SameChannelRetryPolicy{
+		Enabled:        true,
+		MaxAttempts:    3,
+		BaseDelayMs:    100,
+		MaxDelayMs:     400,
+		MaxTotalWaitMs: 1000,
+	})
+	require.NotNil(t, retry)
+
+	err := types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, http.StatusServiceUnavailable)
+	bounds := [][2]time.Duration{
+		{50 * time.Millisecond, 100 * time.Millisecond},
+		{100 * time.Millisecond, 200 * time.Millisecond},
+		{200 * time.Millisecond, 400 * time.Millisecond},
+	}
+	for i, bound := range bounds {
+		delay, ok := retry.Next(nil, err)
+		require.True(t, ok, "attempt %d", i+1)
+		require.GreaterOrEqual(t, delay, bound[0])
+		require.LessOrEqual(t, delay, bound[1])
+	}
+	_, ok := retry.Next(nil, err)
+	require.False(t, ok, "max attempts reached")
+	require.Equal(t, 3, retry.Attempts())
+	require.Len(t, retry.DelaysMs(), 3)
+}
+
+func TestSameChannelRetryStatusCodeFilter(t *testing.T) {
+	t.Parallel()
+
+	retry := NewSameChannelRetry(&dto.SameChannelRetryPolicy{Enabled: true, MaxAttempts: 2})
+	_, ok := retry.Next(nil, types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest))
+	require.False(t, ok)
+	_, ok = retry.Next(nil, types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests))
+	require.False(t, ok, "429 is not retried by default")
+
+	retry = NewSameChannelRetry(&dto.SameChannelRetryPolicy{Enabled: true, StatusCodes: []int{http.StatusTooManyRequests}})
+	_, ok = retry.Next(nil, types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests))
+	require.True(t, ok)
+
+	retry = NewSameChannelRetry(&dto.SameChannelRetryPolicy{Enabled: true, MaxAttempts: 2})
+	_, ok = retry.Next(nil, types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, http.StatusBadGateway, types.ErrOptionWithSkipRetry()))
+	require.False(t, ok, "skip-retry errors are never retried")
+
+	retry = NewSameChannelRetry(&dto.SameChannelRetryPolicy{Enabled: true, StatusCodes: []int{http.StatusGatewayTimeout, http.StatusBadGateway}})
+	_, ok = retry.Next(nil, types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, http.StatusGatewayTimeout))
+	require.False(t, ok, "always-skip status codes are never retried")
+	_, ok = retry.Next(nil, types.InitOpenAIError(types.ErrorCodeBadResponseBody, http.StatusBadGateway))
+	require.False(t, ok, "always-skip error codes are never retried")
+}
+
+func TestSameChannelRetryRespectsRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	retry := NewSameChannelRetry(&dto.SameChannelRetryPolicy{
+		Enabled:           true,
+		MaxAttempts:       2,
+		MaxTotalWaitMs:    3000,
+		RespectRetryAfter: true,
+	})
+	err := types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, http.StatusServiceUnavailable, types.ErrOptionWithRetryAfter(2*time.Second))
+	delay, ok := retry.Next(nil, err)
+	require.True(t, ok)
+	require.Equal(t, 2*time.Second, delay)
+
+	_, ok = retry.Next(nil, err)
+	require.False(t, ok, "second Retry-After would exceed the total wait budget")
+}
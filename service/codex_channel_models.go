@@ -19,7 +19,7 @@ func FetchCodexChannelModels(channel *model.Channel) ([]string, error) {
 		return nil, fmt.Errorf("codex channel does not support multi-key model discovery")
 	}
 
-	client, err := NewProxyHttpClient(channel.GetSetting().Proxy)
+	client, err := GetHttpClientWithProxy(ResolveProxyForChannel(channel))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	DerivedTokenDefaultTTL       = time.Hour
+	derivedTokenDefaultMaxTTL    = 24 * time.Hour
+	derivedTokenUse              = "derived"
+	derivedTokenAudience         = "new-api-relay"
+	derivedTokenNameMaxLength    = 64
+	derivedTokenMaxModelsPerMint = 100
+)
+
+// DerivedTokenClaims 是子令牌 JWT 的内容。模型与权限范围在签发时已与父令牌取交集，
+// 校验时还会再与父令牌当前的限制取交集，父令牌收紧限制后立即对子令牌生效。
+type DerivedTokenClaims struct {
+	TokenUse      string             `json:"token_use"`
+	ParentTokenId int                `json:"pid"`
+	Models        []string           `json:"models,omitempty"`
+	Scopes        *model.TokenScopes `json:"scopes,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// DerivedTokenRequest is the body of a mint request.
+type DerivedTokenRequest struct {
+	Name      string             `json:"name"`
+	Models    []string           `json:"models"`
+	Scopes    *model.TokenScopes `json:"scopes"`
+	SpendCap  int                `json:"spend_cap"`
+	ExpiresIn int64              `json:"expires_in"` // 秒，默认 1 小时
+}
+
+// DerivedTokenResult is returned once, when a derived token is minted.
+type DerivedTokenResult struct {
+	Id        string             `json:"id"`
+	Key       string             `json:"key"`
+	Name      string             `json:"name"`
+	Models    []string           `json:"models"`
+	Scopes    *model.TokenScopes `json:"scopes"`
+	SpendCap  int                `json:"spend_cap"`
+	ExpiresAt int64              `json:"expires_at"`
+}
+
+// DerivedTokenMaxTTL is the longest lifetime a derived token can be minted with.
+func DerivedTokenMaxTTL() time.Duration {
+	seconds := common.GetEnvOrDefault("DERIVED_TOKEN_MAX_TTL_SECONDS", int(derivedTokenDefaultMaxTTL/time.Second))
+	if seconds <= 0 {
+		return derivedTokenDefaultMaxTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// IsDerivedTokenKey reports whether a presented API key (without the sk-
+// prefix) looks like a derived token JWT rather than a regular token key.
+func IsDerivedTokenKey(key string) bool {
+	return strings.HasPrefix(key, "eyJ") && strings.Count(key, ".") == 2
+}
+
+// MintDerivedToken creates a derived token of parent. Models and scopes must
+// stay within those of the parent, and the expiry cannot outlive the parent.
+func MintDerivedToken(parent *model.Token, request DerivedTokenRequest) (*DerivedTokenResult, error) {
+	name := strings.TrimSpace(request.Name)
+	if len(name) > derivedTokenNameMaxLength {
+		return nil, fmt.Errorf("name must not exceed %d characters", derivedTokenNameMaxLength)
+	}
+	if request.SpendCap < 0 {
+		return nil, errors.New("spend_cap must not be negative")
+	}
+	ttl := DerivedTokenDefaultTTL
+	if request.ExpiresIn < 0 {
+		return nil, errors.New("expires_in must not be negative")
+	}
+	if request.ExpiresIn > 0 {
+		ttl = time.Duration(request.ExpiresIn) * time.Second
+	}
+	if maxTTL := DerivedTokenMaxTTL(); ttl > maxTTL {
+		return nil, fmt.Errorf("expires_in must not exceed %d seconds", int64(maxTTL/time.Second))
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	if parent.ExpiredTime != -1 && expiresAt.Unix() > parent.ExpiredTime {
+		expiresAt = time.Unix(parent.ExpiredTime, 0)
+	}
+
+	models, err := deriveTokenModels(parent, request.Models)
+	if err != nil {
+		return nil, err
+	}
+	parentScopes, err := parent.GetScopes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse scopes of parent token: %w", err)
+	}
+	if request.Scopes != nil {
+		if err := request.Scopes.Normalize(); err != nil {
+			return nil, err
+		}
+		for _, endpoint := range request.Scopes.Endpoints {
+			if !parentScopes.AllowsEndpoint(endpoint) {
+				return nil, fmt.Errorf("endpoint %q is not allowed for the parent token", endpoint)
+			}
+		}
+	}
+	scopes := model.IntersectTokenScopes(parentScopes, request.Scopes)
+
+	derived := &model.DerivedToken{
+		Id:             uuid.NewString(),
+		ParentTokenId:  parent.Id,
+		ParentTokenKey: parent.Key,
+		UserId:         parent.UserId,
+		Name:           name,
+		SpendCap:       request.SpendCap,
+		CreatedTime:    now.Unix(),
+		ExpiredTime:    expiresAt.Unix(),
+	}
+	claims := DerivedTokenClaims{
+		TokenUse:      derivedTokenUse,
+		ParentTokenId: parent.Id,
+		Models:        models,
+		Scopes:        scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    authTokenIssuer,
+			Subject:   strconv.Itoa(parent.UserId),
+			Audience:  jwt.ClaimStrings{derivedTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now.Add(-5 * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        derived.Id,
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(authSigningKey(derivedTokenUse))
+	if err != nil {
+		return nil, err
+	}
+	if err := model.DeleteExpiredDerivedTokens(parent.Id); err != nil {
+		common.SysLog(fmt.Sprintf("failed to delete expired derived tokens of token %d: %s", parent.Id, err.Error()))
+	}
+	if err := derived.Insert(); err != nil {
+		return nil, err
+	}
+	return &DerivedTokenResult{
+		Id:        derived.Id,
+		Key:       signed,
+		Name:      derived.Name,
+		Models:    models,
+		Scopes:    scopes,
+		SpendCap:  derived.SpendCap,
+		ExpiresAt: derived.ExpiredTime,
+	}, nil
+}
+
+// deriveTokenModels checks the requested models against the model limits of
+// the parent. An empty request inherits the limits of the parent.
+func deriveTokenModels(parent *model.Token, requested []string) ([]string, error) {
+	if len(requested) > derivedTokenMaxModelsPerMint {
+		return nil, fmt.Errorf("models must not exceed %d entries", derivedTokenMaxModelsPerMint)
+	}
+	var parentModels map[string]bool
+	if parent.ModelLimitsEnabled {
+		parentModels = parent.GetModelLimitsMap()
+	}
+	models := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, name := range requested {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if parentModels != nil && !parentModels[name] {
+			return nil, fmt.Errorf("model %q is not allowed for the parent token", name)
+		}
+		seen[name] = true
+		models = append(models, name)
+	}
+	if len(models) == 0 {
+		if parentModels == nil {
+			return nil, nil
+		}
+		return parent.GetModelLimits(), nil
+	}
+	return models, nil
+}
+
+// ParseDerivedToken verifies the signature and lifetime of a derived token.
+func ParseDerivedToken(raw string) (*DerivedTokenClaims, error) {
+	claims := &DerivedTokenClaims{}
+	parsed, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		return authSigningKey(derivedTokenUse), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(authTokenIssuer), jwt.WithAudience(derivedTokenAudience), jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithLeeway(5*time.Second))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrAuthTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %v", ErrAuthTokenInvalid, err)
+	}
+	if !parsed.Valid || claims.TokenUse != derivedTokenUse || claims.ID == "" || claims.ParentTokenId <= 0 {
+		return nil, ErrAuthTokenInvalid
+	}
+	return claims, nil
+}
+
+// ValidateDerivedToken authenticates a derived token key. It returns a copy of
+// the parent token whose model limits and scopes are narrowed to the derived
+// token, so the rest of the relay treats the request as made by the parent.
+func ValidateDerivedToken(raw string) (*model.Token, *model.DerivedToken, error) {
+	claims, err := ParseDerivedToken(raw)
+	if err != nil {
+		return nil, nil, model.ErrTokenInvalid
+	}
+	derived, parent, err := model.ValidateDerivedToken(claims.ID, claims.ParentTokenId)
+	if err != nil {
+		return parent, derived, err
+	}
+	if strconv.Itoa(parent.UserId) != claims.Subject {
+		return nil, nil, model.ErrTokenInvalid
+	}
+	effective := *parent
+	if len(claims.Models) > 0 {
+		var parentModels map[string]bool
+		if parent.ModelLimitsEnabled {
+			parentModels = parent.GetModelLimitsMap()
+		}
+		models := make([]string, 0, len(claims.Models))
+		for _, name := range claims.Models {
+			if parentModels == nil || parentModels[name] {
+				models = append(models, name)
+			}
+		}
+		effective.ModelLimitsEnabled = true
+		effective.ModelLimits = strings.Join(models, ",")
+	}
+	parentScopes, err := parent.GetScopes()
+	if err != nil {
+		return nil, nil, model.ErrTokenInvalid
+	}
+	if err := effective.SetScopes(model.IntersectTokenScopes(parentScopes, claims.Scopes)); err != nil {
+		return nil, nil, model.ErrTokenInvalid
+	}
+	return &effective, derived, nil
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedDerivedTokenParent(t *testing.T) *model.Token {
+	t.Helper()
+	seedUser(t, 1, 100000)
+	parent := &model.Token{
+		Id:                 1,
+		UserId:             1,
+		Key:                "derived-parent-key",
+		Name:               "parent",
+		Status:             common.TokenStatusEnabled,
+		ExpiredTime:        -1,
+		RemainQuota:        10000,
+		ModelLimitsEnabled: true,
+		ModelLimits:        "gpt-4o,gpt-4o-mini",
+	}
+	require.NoError(t, parent.SetScopes(&model.TokenScopes{Endpoints: []string{model.TokenScopeEndpointChat, model.TokenScopeEndpointEmbeddings}}))
+	require.NoError(t, model.DB.Create(parent).Error)
+	return parent
+}
+
+func TestMintAndValidateDerivedToken(t *testing.T) {
+	truncate(t)
+	useTestSessionSecret(t)
+	parent := seedDerivedTokenParent(t)
+
+	result, err := MintDerivedToken(parent, DerivedTokenRequest{
+		Name:      "ci",
+		Models:    []string{"gpt-4o-mini"},
+		Scopes:    &model.TokenScopes{Endpoints: []string{model.TokenScopeEndpointChat}, MaxTokens: 1024},
+		SpendCap:  500,
+		ExpiresIn: 600,
+	})
+	require.NoError(t, err)
+	assert.True(t, IsDerivedTokenKey(result.Key))
+	assert.InDelta(t, time.Now().Add(10*time.Minute).Unix(), result.ExpiresAt, 5)
+
+	effective, derived, err := ValidateDerivedToken(result.Key)
+	require.NoError(t, err)
+	assert.Equal(t, result.Id, derived.Id)
+	assert.Equal(t, parent.Id, effective.Id)
+	assert.Equal(t, parent.Key, effective.Key)
+	assert.Equal(t, map[string]bool{"gpt-4o-mini": true}, effective.GetModelLimitsMap())
+	scopes, err := effective.GetScopes()
+	require.NoError(t, err)
+	assert.True(t, scopes.AllowsEndpoint(model.TokenScopeEndpointChat))
+	assert.False(t, scopes.AllowsEndpoint(model.TokenScopeEndpointEmbeddings))
+	assert.Equal(t, 1024, scopes.MaxTokens)
+
+	// 吊销后立即失效
+	revoked, err := model.RevokeDerivedToken(result.Id, parent.Id)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	_, _, err = ValidateDerivedToken(result.Key)
+	assert.ErrorIs(t, err, model.ErrTokenInvalid)
+
+	_, _, err = ValidateDerivedToken(result.Key + "x")
+	assert.ErrorIs(t, err, model.ErrTokenInvalid)
+}
+
+func TestMintDerivedTokenCannotWidenParent(t *testing.T) {
+	truncate(t)
+	useTestSessionSecret(t)
+	parent := seedDerivedTokenParent(t)
+
+	_, err := MintDerivedToken(parent, DerivedTokenRequest{Models: []string{"claude-sonnet-4"}})
+	assert.ErrorContains(t, err, "not allowed for the parent token")
+
+	_, err = MintDerivedToken(parent, DerivedTokenRequest{Scopes: &model.TokenScopes{Endpoints: []string{model.TokenScopeEndpointImages}}})
+	assert.ErrorContains(t, err, "not allowed for the parent token")
+
+	_, err = MintDerivedToken(parent, DerivedTokenRequest{ExpiresIn: int64(DerivedTokenMaxTTL()/time.Second) + 1})
+	assert.Error(t, err)
+
+	// 未指定模型时继承父令牌的模型限制，过期时间不能晚于父令牌
+	parent.ExpiredTime = time.Now().Add(5 * time.Minute).Unix()
+	result, err := MintDerivedToken(parent, DerivedTokenRequest{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"gpt-4o", "gpt-4o-mini"}, result.Models)
+	assert.Equal(t, parent.ExpiredTime, result.ExpiresAt)
+}
+
+func TestPreConsumeTokenQuotaEnforcesDerivedTokenSpendCap(t *testing.T) {
+	truncate(t)
+	useTestSessionSecret(t)
+	parent := seedDerivedTokenParent(t)
+	result, err := MintDerivedToken(parent, DerivedTokenRequest{SpendCap: 300})
+	require.NoError(t, err)
+
+	relayInfo := &relaycommon.RelayInfo{UserId: 1, TokenId: parent.Id, TokenKey: parent.Key, DerivedTokenId: result.Id}
+	require.NoError(t, PreConsumeTokenQuota(relayInfo, 200))
+	assert.ErrorContains(t, PreConsumeTokenQuota(relayInfo, 200), "spend cap exceeded")
+
+	// 用量计入父令牌
+	reloadedParent, err := model.GetTokenById(parent.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 9800, reloadedParent.RemainQuota)
+
+	// 父令牌额度不足时归还子令牌占用的上限
+	require.NoError(t, model.DB.Model(&model.Token{}).Where("id = ?", parent.Id).Update("remain_quota", 50).Error)
+	assert.ErrorContains(t, PreConsumeTokenQuota(relayInfo, 80), "token quota is not enough")
+	derived, err := model.GetDerivedTokenById(result.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 200, derived.UsedQuota)
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	taskdto "github.com/QuantumNous/new-api/dto"
@@ -86,6 +87,10 @@ func ClaudeErrorWrapperLocal(err error, code string, statusCode int) *dto.Claude
 
 func RelayErrorHandler(ctx context.Context, resp *http.Response, showBodyWhenFail bool) (newApiErr *types.NewAPIError) {
 	newApiErr = types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, resp.StatusCode)
+	retryAfter := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	defer func() {
+		types.ErrOptionWithRetryAfter(retryAfter)(newApiErr)
+	}()
 
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -2,18 +2,21 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
 )
 
 // ---------------------------------------------------------------------------
-// FundingSource — 资金来源接口（钱包 or 订阅）
+// FundingSource — 资金来源接口（钱包、订阅或组织钱包）
 // ---------------------------------------------------------------------------
 
 // FundingSource 抽象了预扣费的资金来源。
 type FundingSource interface {
-	// Source 返回资金来源标识："wallet" 或 "subscription"
+	// Source 返回资金来源标识："wallet"、"subscription" 或 "organization"
 	Source() string
 	// PreConsume 从该资金来源预扣 amount 额度
 	PreConsume(amount int) error
@@ -32,9 +35,26 @@ type FundingSource interface {
 // 使 wallet_first 等计费偏好可以回退到订阅。
 var ErrInsufficientWalletQuota = errors.New("wallet quota insufficient")
 
+// ErrInsufficientResellerQuota 子账户所属转售商的钱包余额不足以支付平台价，未发生任何扣减。
+var ErrInsufficientResellerQuota = errors.New("reseller quota insufficient")
+
 type WalletFunding struct {
 	userId   int
 	consumed int // 实际预扣的用户额度
+
+	// 转售商子账户的第二阶段结算：转售商按平台价（子账户扣费 ÷ 加价倍率）同步扣费
+	resellerId      int
+	resellerMarkup  float64
+	charged         int // 子账户累计扣费
+	resellerCharged int // 转售商累计扣费
+}
+
+func newWalletFunding(relayInfo *relaycommon.RelayInfo) *WalletFunding {
+	return &WalletFunding{
+		userId:         relayInfo.UserId,
+		resellerId:     relayInfo.ResellerId,
+		resellerMarkup: relayInfo.ResellerMarkup,
+	}
 }
 
 func (w *WalletFunding) Source() string { return BillingSourceWallet }
@@ -50,7 +70,22 @@ func (w *WalletFunding) PreConsume(amount int) error {
 	if !reserved {
 		return ErrInsufficientWalletQuota
 	}
+	if w.resellerId > 0 {
+		resellerAmount := resellerQuota(amount, w.resellerMarkup)
+		reserved, err = model.TryReserveUserQuota(w.resellerId, resellerAmount)
+		if err != nil || !reserved {
+			if rollbackErr := model.IncreaseUserQuota(w.userId, amount, false); rollbackErr != nil {
+				common.SysLog("error rolling back wallet pre-consume: " + rollbackErr.Error())
+			}
+			if err != nil {
+				return err
+			}
+			return ErrInsufficientResellerQuota
+		}
+		w.resellerCharged = resellerAmount
+	}
 	w.consumed = amount
+	w.charged = amount
 	return nil
 }
 
@@ -58,10 +93,17 @@ func (w *WalletFunding) Settle(delta int) error {
 	if delta == 0 {
 		return nil
 	}
+	var err error
 	if delta > 0 {
-		return model.DecreaseUserQuota(w.userId, delta, false)
+		err = model.DecreaseUserQuota(w.userId, delta, false)
+	} else {
+		err = model.IncreaseUserQuota(w.userId, -delta, false)
 	}
-	return model.IncreaseUserQuota(w.userId, -delta, false)
+	if err != nil {
+		return err
+	}
+	w.chargeReseller(delta)
+	return nil
 }
 
 func (w *WalletFunding) Refund() error {
@@ -70,7 +112,69 @@ func (w *WalletFunding) Refund() error {
 	}
 	// IncreaseUserQuota 是 quota += N 的非幂等操作，不能重试，否则会多退额度。
 	// 订阅的 RefundSubscriptionPreConsume 有 requestId 幂等保护所以可以重试。
-	return model.IncreaseUserQuota(w.userId, w.consumed, false)
+	if err := model.IncreaseUserQuota(w.userId, w.consumed, false); err != nil {
+		return err
+	}
+	w.chargeReseller(-w.consumed)
+	return nil
+}
+
+// chargeReseller 记录子账户的扣费变化，并把转售商的累计扣费对齐到
+// 子账户累计扣费对应的平台价，避免逐笔取整产生的误差。
+func (w *WalletFunding) chargeReseller(delta int) {
+	if w.resellerId <= 0 {
+		return
+	}
+	w.charged += delta
+	resellerDelta := resellerQuota(w.charged, w.resellerMarkup) - w.resellerCharged
+	if err := adjustResellerQuota(w.resellerId, resellerDelta); err != nil {
+		common.SysLog(fmt.Sprintf("error settling reseller quota (userId=%d, resellerId=%d, delta=%d): %s",
+			w.userId, w.resellerId, resellerDelta, err.Error()))
+		return
+	}
+	w.resellerCharged += resellerDelta
+}
+
+// ---------------------------------------------------------------------------
+// OrganizationFunding — 组织钱包资金来源实现
+// ---------------------------------------------------------------------------
+
+// ErrInsufficientOrganizationQuota 组织钱包余额或成员额度上限不足，未发生任何扣减。
+var ErrInsufficientOrganizationQuota = errors.New("organization quota insufficient")
+
+type OrganizationFunding struct {
+	orgId    int
+	userId   int // 令牌所属成员，用于成员额度上限
+	consumed int
+}
+
+func (o *OrganizationFunding) Source() string { return BillingSourceOrganization }
+
+func (o *OrganizationFunding) PreConsume(amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	reserved, err := model.TryReserveOrganizationQuota(o.orgId, o.userId, amount)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return ErrInsufficientOrganizationQuota
+	}
+	o.consumed = amount
+	return nil
+}
+
+func (o *OrganizationFunding) Settle(delta int) error {
+	return model.AdjustOrganizationQuota(o.orgId, o.userId, delta)
+}
+
+func (o *OrganizationFunding) Refund() error {
+	if o.consumed <= 0 {
+		return nil
+	}
+	// AdjustOrganizationQuota 不是幂等操作，不能重试
+	return model.AdjustOrganizationQuota(o.orgId, o.userId, -o.consumed)
 }
 
 // ---------------------------------------------------------------------------
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/billingexpr"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/billing_setting"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const geminiCachedContentPrefix = "cachedContents/"
+
+// GeminiCachedContentMeta is the part of an upstream cachedContents resource
+// the gateway keeps track of.
+type GeminiCachedContentMeta struct {
+	Name        string
+	DisplayName string
+	TokenCount  int
+	ExpireTime  int64
+}
+
+// ParseGeminiCachedContent reads a cachedContents resource returned by Gemini
+// or Vertex.
+func ParseGeminiCachedContent(body []byte) (GeminiCachedContentMeta, error) {
+	values := gjson.GetManyBytes(body, "name", "displayName", "usageMetadata.totalTokenCount", "expireTime")
+	meta := GeminiCachedContentMeta{
+		Name:        values[0].String(),
+		DisplayName: values[1].String(),
+		TokenCount:  int(values[2].Int()),
+	}
+	if meta.Name == "" {
+		return meta, fmt.Errorf("cachedContents response has no name")
+	}
+	if values[3].String() != "" {
+		expireTime, err := time.Parse(time.RFC3339Nano, values[3].String())
+		if err != nil {
+			return meta, fmt.Errorf("invalid cachedContents expireTime: %w", err)
+		}
+		meta.ExpireTime = expireTime.Unix()
+	}
+	return meta, nil
+}
+
+// GeminiCachedContentName maps an upstream resource name to the name shown to
+// clients. Vertex names carry the channel's project and location, only the
+// trailing id is kept.
+func GeminiCachedContentName(upstreamName string) string {
+	id := upstreamName
+	if idx := strings.LastIndex(upstreamName, "/"); idx >= 0 {
+		id = upstreamName[idx+1:]
+	}
+	return geminiCachedContentPrefix + id
+}
+
+// RewriteGeminiCachedContent replaces the upstream name and model of a
+// cachedContents resource with the client-facing ones.
+func RewriteGeminiCachedContent(body []byte, cache *model.GeminiCachedContent) []byte {
+	if rewritten, err := sjson.SetBytes(body, "name", cache.Name); err == nil {
+		body = rewritten
+	}
+	if gjson.GetBytes(body, "model").Exists() {
+		if rewritten, err := sjson.SetBytes(body, "model", "models/"+cache.ModelName); err == nil {
+			body = rewritten
+		}
+	}
+	return body
+}
+
+// GeminiCachedContentView renders a stored cache for cachedContents.list, which
+// is answered locally since the caches of one user can live on many channels.
+func GeminiCachedContentView(cache *model.GeminiCachedContent) map[string]any {
+	view := map[string]any{
+		"name":       cache.Name,
+		"model":      "models/" + cache.ModelName,
+		"createTime": time.Unix(cache.CreatedAt, 0).UTC().Format(time.RFC3339),
+		"updateTime": time.Unix(cache.UpdatedAt, 0).UTC().Format(time.RFC3339),
+		"expireTime": time.Unix(cache.ExpireTime, 0).UTC().Format(time.RFC3339),
+		"usageMetadata": map[string]any{
+			"totalTokenCount": cache.TokenCount,
+		},
+	}
+	if cache.DisplayName != "" {
+		view["displayName"] = cache.DisplayName
+	}
+	return view
+}
+
+// GeminiCachedContentStorageQuota prices tokenHours of cache storage. Models
+// billed by expression use their own csh price; the others multiply the model
+// ratio by the configured storage ratio.
+func GeminiCachedContentStorageQuota(modelName string, groupRatio float64, tokenHours float64) (int, map[string]interface{}, error) {
+	other := map[string]interface{}{
+		"group_ratio": groupRatio,
+	}
+	if billing_setting.GetBillingMode(modelName) == billing_setting.BillingModeTieredExpr {
+		if exprStr, ok := billing_setting.GetBillingExpr(modelName); ok && billingexpr.UsedVars(exprStr)["csh"] {
+			cost, _, err := billingexpr.RunExpr(exprStr, billingexpr.TokenParams{CSH: tokenHours})
+			if err != nil {
+				return 0, other, err
+			}
+			other["billing_mode"] = billing_setting.BillingModeTieredExpr
+			other["expr_b64"] = common.EncodeBase64(exprStr)
+			quota, _ := common.QuotaFromFloatChecked(cost / 1_000_000 * common.QuotaPerUnit * groupRatio)
+			return quota, other, nil
+		}
+	}
+	storageRatio := model_setting.GetGeminiCachedContentStorageRatio(modelName)
+	modelRatio, _, _ := ratio_setting.GetModelRatio(modelName)
+	other["model_ratio"] = modelRatio
+	other["storage_ratio"] = storageRatio
+	quota, _ := common.QuotaFromFloatChecked(tokenHours * modelRatio * storageRatio * groupRatio)
+	return quota, other, nil
+}
+
+// GeminiCachedContentDefaultTTL is the upstream default when a create request
+// sets neither ttl nor expireTime.
+const GeminiCachedContentDefaultTTL = time.Hour
+
+// EstimateGeminiCachedContentExpireTime reads the expire time a create or patch
+// request asks for. ok is false when the request sets neither ttl nor expireTime.
+func EstimateGeminiCachedContentExpireTime(body []byte, now time.Time) (int64, bool) {
+	values := gjson.GetManyBytes(body, "ttl", "expireTime")
+	if ttl := values[0].String(); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil && d > 0 {
+			return now.Add(d).Unix(), true
+		}
+	}
+	if expireTime := values[1].String(); expireTime != "" {
+		if t, err := time.Parse(time.RFC3339Nano, expireTime); err == nil {
+			return t.Unix(), true
+		}
+	}
+	return 0, false
+}
+
+// EstimateGeminiCachedContentTokens counts the text of a create request. Inline
+// files are not counted, so the estimate is a lower bound that the reservation
+// only uses to refuse obviously unaffordable caches.
+func EstimateGeminiCachedContentTokens(body []byte, modelName string) int {
+	var text strings.Builder
+	for _, path := range []string{"systemInstruction.parts.#.text", "contents.#.parts.#.text"} {
+		gjson.GetBytes(body, path).ForEach(func(_, value gjson.Result) bool {
+			if value.IsArray() {
+				value.ForEach(func(_, part gjson.Result) bool {
+					text.WriteString(part.String())
+					return true
+				})
+			} else {
+				text.WriteString(value.String())
+			}
+			return true
+		})
+	}
+	if text.Len() == 0 {
+		return 0
+	}
+	return CountTextToken(text.String(), modelName)
+}
+
+// GeminiCachedContentReservation holds the estimated storage cost of a cache
+// call while it is relayed. Storage is settled only after the upstream call
+// succeeds, so the reservation is always released afterwards.
+type GeminiCachedContentReservation struct {
+	relayInfo *relaycommon.RelayInfo
+	funding   FundingSource
+	quota     int
+}
+
+// ReserveGeminiCachedContentStorage takes quota (at least 1, so exhausted
+// accounts are refused) from the token and from the wallet or organization
+// wallet that storage is billed to.
+func ReserveGeminiCachedContentStorage(relayInfo *relaycommon.RelayInfo, quota int) (*GeminiCachedContentReservation, *types.NewAPIError) {
+	if quota < 1 {
+		quota = 1
+	}
+	var funding FundingSource = newWalletFunding(relayInfo)
+	if relayInfo.OrgId > 0 {
+		funding = &OrganizationFunding{orgId: relayInfo.OrgId, userId: relayInfo.UserId}
+	}
+	if err := PreConsumeTokenQuota(relayInfo, quota); err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+	if err := funding.PreConsume(quota); err != nil {
+		releaseGeminiCachedContentTokenQuota(relayInfo, quota)
+		if errors.Is(err, ErrInsufficientWalletQuota) || errors.Is(err, ErrInsufficientOrganizationQuota) || errors.Is(err, ErrInsufficientResellerQuota) {
+			return nil, types.NewErrorWithStatusCode(
+				fmt.Errorf("额度不足以支付上下文缓存存储费用, 需要预扣费额度: %s", logger.FormatQuota(quota)),
+				types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+				types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	return &GeminiCachedContentReservation{relayInfo: relayInfo, funding: funding, quota: quota}, nil
+}
+
+// Release returns the reserved quota.
+func (r *GeminiCachedContentReservation) Release() {
+	if r == nil {
+		return
+	}
+	if err := r.funding.Refund(); err != nil {
+		common.SysLog(fmt.Sprintf("error releasing cached content storage reservation (userId=%d): %s", r.relayInfo.UserId, err.Error()))
+	}
+	releaseGeminiCachedContentTokenQuota(r.relayInfo, r.quota)
+}
+
+func releaseGeminiCachedContentTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) {
+	if relayInfo.IsPlayground {
+		return
+	}
+	if err := model.IncreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota); err != nil {
+		common.SysLog(fmt.Sprintf("error releasing cached content token reservation (tokenId=%d): %s", relayInfo.TokenId, err.Error()))
+	}
+	adjustDerivedTokenQuota(relayInfo, -quota)
+}
+
+// SettleGeminiCachedContentStorage bills (or refunds) the storage between the
+// time already paid for and until, task-style: the wallet and token quota are
+// adjusted directly and a billing log is written. The caller persists cache.
+func SettleGeminiCachedContentStorage(ctx context.Context, cache *model.GeminiCachedContent, until int64, reason string) {
+	seconds := until - cache.BilledUntil
+	if seconds == 0 || cache.TokenCount <= 0 {
+		cache.BilledUntil = until
+		return
+	}
+	tokenHours := float64(cache.TokenCount) * float64(seconds) / 3600
+	sign := 1
+	if tokenHours < 0 {
+		sign = -1
+		tokenHours = -tokenHours
+	}
+	quota, other, err := GeminiCachedContentStorageQuota(cache.ModelName, cache.GroupRatio, tokenHours)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("计算上下文缓存 %s 存储费用失败: %s", cache.Name, err.Error()))
+		return
+	}
+	// 退款不超过已收取的存储费
+	if sign < 0 && quota > cache.Quota {
+		quota = cache.Quota
+	}
+	cache.BilledUntil = until
+	if quota <= 0 {
+		return
+	}
+	delta := sign * quota
+
+	var token *model.Token
+	if cache.TokenId > 0 {
+		if token, err = model.GetTokenById(cache.TokenId); err != nil {
+			token = nil
+		}
+	}
+	switch {
+	case token != nil && token.OrgId > 0:
+		// 组织令牌创建的缓存从组织钱包扣费
+		err = model.AdjustOrganizationQuota(token.OrgId, cache.UserId, delta)
+	case delta > 0:
+		err = model.DecreaseUserQuota(cache.UserId, quota, false)
+	default:
+		err = model.IncreaseUserQuota(cache.UserId, quota, false)
+	}
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("上下文缓存 %s 存储费用结算失败: %s", cache.Name, err.Error()))
+		return
+	}
+	if token == nil || token.OrgId == 0 {
+		settleGeminiCachedContentReseller(cache, delta)
+	}
+	if token != nil && !token.UnlimitedQuota {
+		if delta > 0 {
+			err = model.DecreaseTokenQuota(token.Id, token.Key, quota)
+		} else {
+			err = model.IncreaseTokenQuota(token.Id, token.Key, quota)
+		}
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("调整令牌额度失败 (delta=%d, cache=%s): %s", delta, cache.Name, err.Error()))
+		}
+	}
+	cache.Quota += delta
+	model.UpdateUserUsedQuota(cache.UserId, delta)
+	model.UpdateChannelUsedQuota(cache.ChannelId, delta)
+
+	logType := model.LogTypeConsume
+	if delta < 0 {
+		logType = model.LogTypeRefund
+	}
+	other["is_task"] = true
+	other["cached_content"] = cache.Name
+	other["cached_tokens"] = cache.TokenCount
+	other["storage_seconds"] = seconds * int64(sign)
+	other["storage_token_hours"] = tokenHours
+	model.RecordTaskBillingLog(model.RecordTaskBillingLogParams{
+		UserId:    cache.UserId,
+		LogType:   logType,
+		Content:   fmt.Sprintf("上下文缓存存储（%s）", reason),
+		ChannelId: cache.ChannelId,
+		ModelName: cache.ModelName,
+		Quota:     quota,
+		TokenId:   cache.TokenId,
+		Group:     cache.Group,
+		Other:     other,
+	})
+}
+
+// settleGeminiCachedContentReseller 子账户创建的缓存，存储费同样由转售商按平台价结算。
+// 使用创建时冻结的加价倍率，与子账户扣费所用的 GroupRatio 保持一致。
+func settleGeminiCachedContentReseller(cache *model.GeminiCachedContent, delta int) {
+	if cache.ResellerId > 0 {
+		settleResellerQuota(cache.ResellerId, cache.ResellerMarkup, delta)
+		return
+	}
+	// 升级前创建的缓存没有记录转售商，按当前加价倍率结算
+	user, err := model.GetUserCache(cache.UserId)
+	if err != nil || user.ParentId == 0 {
+		return
+	}
+	markup, err := model.GetResellerMarkup(user.ParentId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to load reseller markup for user %d: %s", cache.UserId, err.Error()))
+	}
+	settleResellerQuota(user.ParentId, markup.Ratio(cache.Group, cache.ModelName), delta)
+}
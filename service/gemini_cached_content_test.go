@@ -0,0 +1,135 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/config"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestParseGeminiCachedContent(t *testing.T) {
+	body := []byte(`{
+		"name": "projects/p1/locations/us-central1/cachedContents/4567",
+		"model": "projects/p1/locations/us-central1/publishers/google/models/gemini-2.5-flash",
+		"displayName": "docs",
+		"usageMetadata": {"totalTokenCount": 32768},
+		"expireTime": "2026-10-18T12:30:00.123456Z"
+	}`)
+	meta, err := ParseGeminiCachedContent(body)
+	require.NoError(t, err)
+	require.Equal(t, "projects/p1/locations/us-central1/cachedContents/4567", meta.Name)
+	require.Equal(t, "docs", meta.DisplayName)
+	require.Equal(t, 32768, meta.TokenCount)
+	require.Equal(t, int64(1792326600), meta.ExpireTime)
+
+	require.Equal(t, "cachedContents/4567", GeminiCachedContentName(meta.Name))
+	require.Equal(t, "cachedContents/abc", GeminiCachedContentName("cachedContents/abc"))
+
+	rewritten := RewriteGeminiCachedContent(body, &model.GeminiCachedContent{
+		Name:      "cachedContents/4567",
+		ModelName: "gemini-2.5-flash",
+	})
+	require.Equal(t, "cachedContents/4567", gjson.GetBytes(rewritten, "name").String())
+	require.Equal(t, "models/gemini-2.5-flash", gjson.GetBytes(rewritten, "model").String())
+
+	_, err = ParseGeminiCachedContent([]byte(`{"error":{}}`))
+	require.Error(t, err)
+}
+
+func TestGeminiCachedContentStorageQuotaByRatio(t *testing.T) {
+	originalRatios := ratio_setting.ModelRatio2JSONString()
+	require.NoError(t, ratio_setting.UpdateModelRatioByJSONString(`{"gemini-cache-test":0.15}`))
+	settings := model_setting.GetGeminiSettings()
+	originalStorage := settings.CachedContentStorageRatio
+	t.Cleanup(func() {
+		settings.CachedContentStorageRatio = originalStorage
+		require.NoError(t, ratio_setting.UpdateModelRatioByJSONString(originalRatios))
+	})
+
+	settings.CachedContentStorageRatio = map[string]float64{}
+	quota, _, err := GeminiCachedContentStorageQuota("gemini-cache-test", 1, 100000)
+	require.NoError(t, err)
+	require.Equal(t, 0, quota, "storage is free until a storage ratio is configured")
+
+	settings.CachedContentStorageRatio = map[string]float64{"default": 4}
+	quota, other, err := GeminiCachedContentStorageQuota("gemini-cache-test", 2, 100000)
+	require.NoError(t, err)
+	// 100000 token-hours * 0.15 * 4 * 2
+	require.Equal(t, 120000, quota)
+	require.Equal(t, 4.0, other["storage_ratio"])
+}
+
+func TestGeminiCachedContentStorageQuotaByExpr(t *testing.T) {
+	require.NoError(t, config.GlobalConfig.LoadFromDB(map[string]string{
+		"billing_setting.billing_mode": `{"gemini-cache-expr":"tiered_expr"}`,
+		"billing_setting.billing_expr": `{"gemini-cache-expr":"tier(\"base\", p * 0.3 + c * 2.5 + cr * 0.075 + csh * 1)"}`,
+	}))
+	t.Cleanup(func() {
+		require.NoError(t, config.GlobalConfig.LoadFromDB(map[string]string{
+			"billing_setting.billing_mode": `{}`,
+			"billing_setting.billing_expr": `{}`,
+		}))
+	})
+
+	// 1M token-hours at $1 = 1 USD
+	quota, other, err := GeminiCachedContentStorageQuota("gemini-cache-expr", 1, 1_000_000)
+	require.NoError(t, err)
+	require.Equal(t, int(common.QuotaPerUnit), quota)
+	require.Equal(t, "tiered_expr", other["billing_mode"])
+}
+
+func TestEstimateGeminiCachedContentRequest(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	expireTime, ok := EstimateGeminiCachedContentExpireTime([]byte(`{"ttl":"7200s"}`), now)
+	require.True(t, ok)
+	require.Equal(t, now.Unix()+7200, expireTime)
+	expireTime, ok = EstimateGeminiCachedContentExpireTime([]byte(`{"expireTime":"2023-11-14T22:30:00Z"}`), now)
+	require.True(t, ok)
+	require.Equal(t, now.Unix()+1000, expireTime)
+	_, ok = EstimateGeminiCachedContentExpireTime([]byte(`{"displayName":"docs"}`), now)
+	require.False(t, ok)
+
+	require.Zero(t, EstimateGeminiCachedContentTokens([]byte(`{"contents":[{"parts":[{"fileData":{}}]}]}`), "gemini-2.5-flash"))
+	require.Positive(t, EstimateGeminiCachedContentTokens([]byte(`{
+		"systemInstruction":{"parts":[{"text":"You are a librarian."}]},
+		"contents":[{"role":"user","parts":[{"text":"The quick brown fox jumps over the lazy dog."}]}]
+	}`), "gemini-2.5-flash"))
+}
+
+func TestReserveGeminiCachedContentStorage(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 0)
+	seedToken(t, 1, 1, "sk-cache", 1000)
+	info := &relaycommon.RelayInfo{UserId: 1, TokenId: 1, TokenKey: "sk-cache"}
+
+	_, apiErr := ReserveGeminiCachedContentStorage(info, 0)
+	require.NotNil(t, apiErr, "an exhausted wallet cannot create caches even when the estimate is zero")
+	require.Equal(t, types.ErrorCodeInsufficientUserQuota, apiErr.GetErrorCode())
+	token, err := model.GetTokenById(1)
+	require.NoError(t, err)
+	require.Equal(t, 1000, token.RemainQuota, "the token reservation is rolled back")
+
+	require.NoError(t, model.DB.Model(&model.User{}).Where("id = ?", 1).Update("quota", 500).Error)
+	reservation, apiErr := ReserveGeminiCachedContentStorage(info, 400)
+	require.Nil(t, apiErr)
+	quota, err := model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	require.Equal(t, 100, quota)
+
+	reservation.Release()
+	quota, err = model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	require.Equal(t, 500, quota)
+	token, err = model.GetTokenById(1)
+	require.NoError(t, err)
+	require.Equal(t, 1000, token.RemainQuota)
+}
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	GuardrailActionAllow  = "allow"
+	GuardrailActionBlock  = "block"
+	GuardrailActionModify = "modify"
+)
+
+// maxGuardrailResponseBytes caps how much of a hook response is read.
+const maxGuardrailResponseBytes = 4 << 20
+
+const defaultGuardrailModelPrompt = `You are a content moderation classifier. Decide whether the user message below violates the usage policy.
+Reply with a single JSON object and nothing else: {"action":"allow"} or {"action":"block","reason":"<short reason>"}.`
+
+// GuardrailDecision is the answer of a hook. Body is the replacement request or
+// response body of a modify decision, in the client's format.
+type GuardrailDecision struct {
+	Action string          `json:"action"`
+	Reason string          `json:"reason,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// GuardrailRecord is the audit record of one hook call. Action is the effect
+// on the request; Error is set when the call failed and the failure policy
+// decided the action.
+type GuardrailRecord struct {
+	Hook      string `json:"hook"`
+	Stage     string `json:"stage"`
+	Action    string `json:"action"`
+	Reason    string `json:"reason,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// guardrailPayload is the body sent to webhook hooks.
+type guardrailPayload struct {
+	Stage       string            `json:"stage"`
+	Hook        string            `json:"hook"`
+	RequestId   string            `json:"request_id"`
+	UserId      int               `json:"user_id"`
+	TokenId     int               `json:"token_id"`
+	Group       string            `json:"group"`
+	Model       string            `json:"model"`
+	RelayFormat types.RelayFormat `json:"relay_format"`
+	Text        string            `json:"text"`
+	Body        json.RawMessage   `json:"body"`
+}
+
+// Guardrail runs the guardrail pipeline of one request and keeps its audit
+// records for the consume log.
+type Guardrail struct {
+	relayFormat types.RelayFormat
+	group       string
+	modelName   string
+	requestId   string
+	userId      int
+	tokenId     int
+	hooks       []operation_setting.GuardrailHook
+
+	Records []GuardrailRecord
+}
+
+// guardrailTextKeys returns the fields whose strings are sent as text.
+func guardrailTextKeys(stage string) map[string]bool {
+	if stage == operation_setting.GuardrailStagePre {
+		return piiTextKeys
+	}
+	return sensitiveResponseTextKeys
+}
+
+// guardrailText joins the user or model text of a JSON body.
+func guardrailText(stage string, body []byte) string {
+	keys := guardrailTextKeys(stage)
+	var parts []string
+	_, _ = rewriteJSONStrings(body, func(key string, value string) (string, bool) {
+		if keys[key] && value != "" {
+			parts = append(parts, value)
+		}
+		return value, false
+	})
+	return strings.Join(parts, "\n")
+}
+
+func (g *Guardrail) hasStage(stage string) bool {
+	for _, hook := range g.hooks {
+		if hook.Stage == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// run passes body through the hooks of stage in order. It returns the body to
+// use, which differs from the input after a modify decision, or the error to
+// answer with when a hook blocks or fails closed.
+func (g *Guardrail) run(ctx context.Context, stage string, body []byte) ([]byte, *types.NewAPIError) {
+	for _, hook := range g.hooks {
+		if hook.Stage != stage {
+			continue
+		}
+		start := time.Now()
+		decision, err := g.call(ctx, hook, stage, body)
+		record := GuardrailRecord{Hook: hook.Name, Stage: stage, LatencyMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			if newAPIError := g.fail(hook, record, err); newAPIError != nil {
+				return nil, newAPIError
+			}
+			continue
+		}
+		record.Action = decision.Action
+		record.Reason = decision.Reason
+		g.Records = append(g.Records, record)
+		switch decision.Action {
+		case GuardrailActionBlock:
+			message := "request blocked by guardrail"
+			if stage == operation_setting.GuardrailStagePost {
+				message = "response blocked by guardrail"
+			}
+			if decision.Reason != "" {
+				message += ": " + decision.Reason
+			}
+			return nil, types.NewErrorWithStatusCode(errors.New(message), types.ErrorCodeGuardrailBlocked, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		case GuardrailActionModify:
+			body = decision.Body
+		}
+	}
+	return body, nil
+}
+
+// fail records a hook that could not judge the content and applies its
+// failure policy: nil lets the content through, otherwise the error to answer
+// with.
+func (g *Guardrail) fail(hook operation_setting.GuardrailHook, record GuardrailRecord, err error) *types.NewAPIError {
+	record.Error = err.Error()
+	if hook.FailOpen() {
+		record.Action = GuardrailActionAllow
+		g.Records = append(g.Records, record)
+		return nil
+	}
+	record.Action = GuardrailActionBlock
+	g.Records = append(g.Records, record)
+	return types.NewErrorWithStatusCode(fmt.Errorf("guardrail %s unavailable", hook.Name), types.ErrorCodeGuardrailFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+}
+
+// failAll applies the failure policy of every hook of stage when the content
+// cannot be sent to them at all, such as a body that is not JSON.
+func (g *Guardrail) failAll(stage string, err error) *types.NewAPIError {
+	for _, hook := range g.hooks {
+		if hook.Stage != stage {
+			continue
+		}
+		if newAPIError := g.fail(hook, GuardrailRecord{Hook: hook.Name, Stage: stage}, err); newAPIError != nil {
+			return newAPIError
+		}
+	}
+	return nil
+}
+
+func (g *Guardrail) call(ctx context.Context, hook operation_setting.GuardrailHook, stage string, body []byte) (*GuardrailDecision, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(hook.Timeout())*time.Millisecond)
+	defer cancel()
+	text := guardrailText(stage, body)
+
+	var decision GuardrailDecision
+	if hook.Type == operation_setting.GuardrailHookTypeModel {
+		content, err := callGuardrailModel(ctx, hook, text)
+		if err != nil {
+			return nil, err
+		}
+		if err := common.UnmarshalJsonStr(extractJSONObject(content), &decision); err != nil {
+			return nil, fmt.Errorf("invalid moderation model reply: %w", err)
+		}
+		if decision.Action == GuardrailActionModify {
+			return nil, errors.New("moderation model hooks cannot modify content")
+		}
+	} else {
+		payload, err := common.Marshal(guardrailPayload{
+			Stage:       stage,
+			Hook:        hook.Name,
+			RequestId:   g.requestId,
+			UserId:      g.userId,
+			TokenId:     g.tokenId,
+			Group:       g.group,
+			Model:       g.modelName,
+			RelayFormat: g.relayFormat,
+			Text:        text,
+			Body:        body,
+		})
+		if err != nil {
+			return nil, err
+		}
+		respBody, err := doGuardrailRequest(ctx, hook, hook.URL, payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := common.Unmarshal(respBody, &decision); err != nil {
+			return nil, fmt.Errorf("invalid guardrail response: %w", err)
+		}
+	}
+
+	switch decision.Action {
+	case GuardrailActionAllow, GuardrailActionBlock:
+	case GuardrailActionModify:
+		if !gjson.ValidBytes(decision.Body) || !gjson.ParseBytes(decision.Body).IsObject() {
+			return nil, errors.New("modify decision must carry a JSON object body")
+		}
+	default:
+		return nil, fmt.Errorf("unknown guardrail action: %s", decision.Action)
+	}
+	return &decision, nil
+}
+
+func doGuardrailRequest(ctx context.Context, hook operation_setting.GuardrailHook, url string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.Header {
+		req.Header.Set(key, value)
+	}
+	if hook.Secret != "" {
+		req.Header.Set("X-Guardrail-Signature", generateSignature(hook.Secret, payload))
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxGuardrailResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return respBody, nil
+}
+
+// callGuardrailModel asks a moderation model served by this gateway and
+// returns the text of its reply.
+func callGuardrailModel(ctx context.Context, hook operation_setting.GuardrailHook, text string) (string, error) {
+	url := hook.URL
+	if url == "" {
+		url = strings.TrimRight(system_setting.ServerAddress, "/") + "/v1/chat/completions"
+	}
+	prompt := hook.Prompt
+	if prompt == "" {
+		prompt = defaultGuardrailModelPrompt
+	}
+	payload, err := common.Marshal(gin.H{
+		"model": hook.Model,
+		"messages": []gin.H{
+			{"role": "system", "content": prompt},
+			{"role": "user", "content": text},
+		},
+		"stream": false,
+	})
+	if err != nil {
+		return "", err
+	}
+	hook.Header = mergeHeader(hook.Header, "Authorization", "Bearer "+hook.Key)
+	respBody, err := doGuardrailRequest(ctx, hook, url, payload)
+	if err != nil {
+		return "", err
+	}
+	content := gjson.GetBytes(respBody, "choices.0.message.content")
+	if !content.Exists() {
+		return "", errors.New("moderation model returned no content")
+	}
+	return content.String(), nil
+}
+
+func mergeHeader(header map[string]string, key string, value string) map[string]string {
+	merged := make(map[string]string, len(header)+1)
+	for k, v := range header {
+		merged[k] = v
+	}
+	merged[key] = value
+	return merged
+}
+
+// extractJSONObject returns the outermost {...} of a model reply, which may be
+// wrapped in prose or a code fence.
+func extractJSONObject(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return text
+	}
+	return text[start : end+1]
+}
+
+// isGuardrailTraffic reports whether the request was sent by a model hook, so
+// the moderation call is not moderated again.
+func isGuardrailTraffic(c *gin.Context, hooks []operation_setting.GuardrailHook) bool {
+	tokenKey := c.GetString("token_key")
+	if tokenKey == "" {
+		return false
+	}
+	for _, hook := range hooks {
+		if hook.Type == operation_setting.GuardrailHookTypeModel && model.IsTokenKeyOf(tokenKey, strings.TrimPrefix(hook.Key, "sk-")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyGuardrails runs the pre-request hooks on the raw request body. It must
+// run before the body is parsed, since a modify decision replaces the body.
+// The pipeline is kept in the context for the post-response hooks.
+func ApplyGuardrails(c *gin.Context, relayFormat types.RelayFormat) *types.NewAPIError {
+	setting := operation_setting.GetGuardrailSetting()
+	if !setting.Enabled || len(setting.Hooks) == 0 {
+		return nil
+	}
+	switch relayFormat {
+	case types.RelayFormatOpenAI, types.RelayFormatOpenAIResponses, types.RelayFormatClaude, types.RelayFormatGemini, types.RelayFormatEmbedding:
+	default:
+		return nil
+	}
+	if isGuardrailTraffic(c, setting.Hooks) {
+		return nil
+	}
+
+	g := &Guardrail{
+		relayFormat: relayFormat,
+		group:       common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		modelName:   common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		requestId:   c.GetString(common.RequestIdKey),
+		userId:      c.GetInt("id"),
+		tokenId:     c.GetInt("token_id"),
+	}
+	for _, hook := range setting.Hooks {
+		if hook.Matches(g.group, g.modelName) {
+			g.hooks = append(g.hooks, hook)
+		}
+	}
+	if len(g.hooks) == 0 {
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeyGuardrail, g)
+	if !g.hasStage(operation_setting.GuardrailStagePre) {
+		return nil
+	}
+
+	body, err := guardrailRequestBody(c)
+	if err != nil {
+		if newAPIError := g.failAll(operation_setting.GuardrailStagePre, err); newAPIError != nil {
+			g.recordBlock(c, newAPIError)
+			return newAPIError
+		}
+		return nil
+	}
+	result, newAPIError := g.run(c.Request.Context(), operation_setting.GuardrailStagePre, body)
+	if newAPIError != nil {
+		g.recordBlock(c, newAPIError)
+		return newAPIError
+	}
+	if !bytes.Equal(result, body) {
+		common.CleanupBodyStorage(c)
+		c.Set(common.KeyRequestBody, result)
+	}
+	return nil
+}
+
+func guardrailRequestBody(c *gin.Context) ([]byte, error) {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil, err
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if !gjson.ValidBytes(body) {
+		return nil, errors.New("request body is not JSON")
+	}
+	return body, nil
+}
+
+// CheckGuardrailStream refuses a stream request when a post-response hook
+// applies. The hooks judge the whole completion, which a stream has already
+// sent by the time it is complete.
+func CheckGuardrailStream(c *gin.Context, isStream bool) *types.NewAPIError {
+	g := GetGuardrail(c)
+	if !isStream || g == nil || !g.hasStage(operation_setting.GuardrailStagePost) {
+		return nil
+	}
+	newAPIError := types.NewErrorWithStatusCode(errors.New("streaming is not supported while a response guardrail applies, retry with stream disabled"),
+		types.ErrorCodeGuardrailStream, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	g.recordBlock(c, newAPIError)
+	return newAPIError
+}
+
+// recordBlock writes an error log for a request stopped before it reached a
+// channel, so the block is audited even though no consume log follows.
+func (g *Guardrail) recordBlock(c *gin.Context, newAPIError *types.NewAPIError) {
+	logger.LogWarn(c, newAPIError.Error())
+	other := map[string]interface{}{
+		"error_type":  newAPIError.GetErrorType(),
+		"error_code":  newAPIError.GetErrorCode(),
+		"status_code": newAPIError.StatusCode,
+		"guardrail":   g.Records,
+	}
+	if c.Request != nil && c.Request.URL != nil {
+		other["request_path"] = c.Request.URL.Path
+	}
+	model.RecordErrorLog(c, g.userId, 0, g.modelName, c.GetString("token_name"), newAPIError.Error(), g.tokenId, 0,
+		false, g.group, other)
+}
+
+// FilterResponse runs the post-response hooks on a non-stream response body.
+func (g *Guardrail) FilterResponse(ctx context.Context, data []byte) ([]byte, *types.NewAPIError) {
+	if g == nil || !g.hasStage(operation_setting.GuardrailStagePost) {
+		return data, nil
+	}
+	if !gjson.ValidBytes(data) {
+		if newAPIError := g.failAll(operation_setting.GuardrailStagePost, errors.New("response body is not JSON")); newAPIError != nil {
+			return nil, newAPIError
+		}
+		return data, nil
+	}
+	return g.run(ctx, operation_setting.GuardrailStagePost, data)
+}
+
+// GetGuardrail returns the guardrail pipeline of the request, or nil when no
+// hook applies.
+func GetGuardrail(c *gin.Context) *Guardrail {
+	g, _ := common.GetContextKeyType[*Guardrail](c, constant.ContextKeyGuardrail)
+	return g
+}
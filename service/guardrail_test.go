@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func withGuardrailHooks(t *testing.T, hooks ...operation_setting.GuardrailHook) {
+	InitHttpClient()
+	current := operation_setting.GetGuardrailSetting()
+	previous := *current
+	*current = operation_setting.GuardrailSetting{Enabled: true, Hooks: hooks}
+	t.Cleanup(func() { *current = previous })
+}
+
+func newGuardrailContext(t *testing.T, body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(body)))
+	c.Set(common.KeyRequestBody, []byte(body))
+	c.Set("id", 1)
+	c.Set("token_id", 2)
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "gpt-4o")
+	return c
+}
+
+func requestBody(t *testing.T, c *gin.Context) string {
+	storage, err := common.GetBodyStorage(c)
+	require.NoError(t, err)
+	body, err := storage.Bytes()
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestGuardrailPreHooks(t *testing.T) {
+	var payloads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		payloads = append(payloads, string(payload))
+		switch r.URL.Path {
+		case "/modify":
+			_, _ = w.Write([]byte(`{"action":"modify","reason":"masked","body":{"model":"gpt-4o","messages":[{"role":"user","content":"hello ***"}]}}`))
+		case "/block":
+			if gjson.GetBytes(payload, "text").String() == "hello ***" {
+				_, _ = w.Write([]byte(`{"action":"allow"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"action":"block","reason":"policy"}`))
+		}
+	}))
+	defer server.Close()
+
+	withGuardrailHooks(t,
+		operation_setting.GuardrailHook{Name: "mask", Enabled: true, Stage: "pre", Type: "webhook", URL: server.URL + "/modify"},
+		operation_setting.GuardrailHook{Name: "check", Enabled: true, Stage: "pre", Type: "webhook", URL: server.URL + "/block"},
+		operation_setting.GuardrailHook{Name: "other", Enabled: true, Stage: "pre", Type: "webhook", URL: server.URL + "/block", Models: []string{"claude"}},
+	)
+
+	// 后一个钩子收到前一个钩子修改后的请求体
+	c := newGuardrailContext(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello secret"}]}`)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	require.JSONEq(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello ***"}]}`, requestBody(t, c))
+	require.Len(t, payloads, 2)
+	require.Equal(t, "hello secret", gjson.Get(payloads[0], "text").String())
+	require.Equal(t, "gpt-4o", gjson.Get(payloads[0], "model").String())
+	records := GetGuardrail(c).Records
+	require.Len(t, records, 2)
+	require.Equal(t, "modify", records[0].Action)
+	require.Equal(t, "allow", records[1].Action)
+
+	withGuardrailHooks(t, operation_setting.GuardrailHook{Name: "check", Enabled: true, Stage: "pre", Type: "webhook", URL: server.URL + "/block"})
+	c = newGuardrailContext(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"hello secret"}]}`)
+	newAPIError := ApplyGuardrails(c, types.RelayFormatOpenAI)
+	require.NotNil(t, newAPIError)
+	require.Equal(t, types.ErrorCodeGuardrailBlocked, newAPIError.GetErrorCode())
+	require.Contains(t, newAPIError.Error(), "policy")
+
+	var log model.Log
+	require.NoError(t, model.LOG_DB.Where("type = ?", model.LogTypeError).Order("id desc").First(&log).Error)
+	require.Contains(t, log.Other, `"guardrail"`)
+}
+
+func TestGuardrailFailurePolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"action":"allow"}`))
+	}))
+	defer server.Close()
+
+	hook := operation_setting.GuardrailHook{Name: "slow", Enabled: true, Stage: "pre", Type: "webhook", URL: server.URL, TimeoutMs: 20, FailurePolicy: "open"}
+	withGuardrailHooks(t, hook)
+	c := newGuardrailContext(t, `{"messages":[{"role":"user","content":"hi"}]}`)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	require.Equal(t, "allow", GetGuardrail(c).Records[0].Action)
+	require.NotEmpty(t, GetGuardrail(c).Records[0].Error)
+
+	hook.FailurePolicy = "closed"
+	withGuardrailHooks(t, hook)
+	c = newGuardrailContext(t, `{"messages":[{"role":"user","content":"hi"}]}`)
+	newAPIError := ApplyGuardrails(c, types.RelayFormatOpenAI)
+	require.NotNil(t, newAPIError)
+	require.Equal(t, types.ErrorCodeGuardrailFailed, newAPIError.GetErrorCode())
+
+	// 无法解析的请求体同样按失败策略处理，不能绕过钩子
+	c = newGuardrailContext(t, `{"messages":`)
+	newAPIError = ApplyGuardrails(c, types.RelayFormatOpenAI)
+	require.NotNil(t, newAPIError)
+	require.Equal(t, types.ErrorCodeGuardrailFailed, newAPIError.GetErrorCode())
+
+	hook.FailurePolicy = "open"
+	withGuardrailHooks(t, hook)
+	c = newGuardrailContext(t, `{"messages":`)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	require.Equal(t, "allow", GetGuardrail(c).Records[0].Action)
+	require.Equal(t, "request body is not JSON", GetGuardrail(c).Records[0].Error)
+}
+
+func TestGuardrailPostHookNonJSONResponse(t *testing.T) {
+	hook := operation_setting.GuardrailHook{Name: "post", Enabled: true, Stage: "post", Type: "webhook", URL: "http://127.0.0.1:0"}
+	withGuardrailHooks(t, hook)
+	c := newGuardrailContext(t, `{"messages":[{"role":"user","content":"hi"}]}`)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	_, newAPIError := RewriteResponseBody(c, []byte("plain text"))
+	require.NotNil(t, newAPIError)
+	require.Equal(t, types.ErrorCodeGuardrailFailed, newAPIError.GetErrorCode())
+
+	hook.FailurePolicy = "open"
+	withGuardrailHooks(t, hook)
+	c = newGuardrailContext(t, `{"messages":[{"role":"user","content":"hi"}]}`)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	out, newAPIError := RewriteResponseBody(c, []byte("plain text"))
+	require.Nil(t, newAPIError)
+	require.Equal(t, "plain text", string(out))
+	require.Equal(t, "response body is not JSON", GetGuardrail(c).Records[0].Error)
+}
+
+func TestGuardrailRefusesStreamWithPostHook(t *testing.T) {
+	withGuardrailHooks(t,
+		operation_setting.GuardrailHook{Name: "pre", Enabled: true, Stage: "pre", Type: "webhook", URL: "http://127.0.0.1:0", FailurePolicy: "open"},
+	)
+	c := newGuardrailContext(t, `{"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	require.Nil(t, CheckGuardrailStream(c, true), "pre hooks do not restrict streaming")
+
+	withGuardrailHooks(t,
+		operation_setting.GuardrailHook{Name: "post", Enabled: true, Stage: "post", Type: "webhook", URL: "http://127.0.0.1:0"},
+		operation_setting.GuardrailHook{Name: "claude-only", Enabled: true, Stage: "post", Type: "webhook", URL: "http://127.0.0.1:0", Models: []string{"claude"}},
+	)
+	c = newGuardrailContext(t, `{"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	require.Nil(t, CheckGuardrailStream(c, false))
+	newAPIError := CheckGuardrailStream(c, true)
+	require.NotNil(t, newAPIError)
+	require.Equal(t, types.ErrorCodeGuardrailStream, newAPIError.GetErrorCode())
+	require.Equal(t, http.StatusBadRequest, newAPIError.StatusCode)
+
+	c = newGuardrailContext(t, `{"stream":true}`)
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "o3")
+	withGuardrailHooks(t,
+		operation_setting.GuardrailHook{Name: "claude-only", Enabled: true, Stage: "post", Type: "webhook", URL: "http://127.0.0.1:0", Models: []string{"claude"}},
+	)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	require.Nil(t, CheckGuardrailStream(c, true), "only matching post hooks refuse streaming")
+}
+
+func TestGuardrailPostModelHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer sk-moderation", r.Header.Get("Authorization"))
+		payload, _ := io.ReadAll(r.Body)
+		reply := `{"action":"allow"}`
+		if gjson.GetBytes(payload, "messages.1.content").String() == "bad answer" {
+			reply = "```json\n{\"action\":\"block\",\"reason\":\"unsafe\"}\n```"
+		}
+		resp, _ := common.Marshal(gin.H{"choices": []gin.H{{"message": gin.H{"role": "assistant", "content": reply}}}})
+		_, _ = w.Write(resp)
+	}))
+	defer server.Close()
+
+	withGuardrailHooks(t, operation_setting.GuardrailHook{Name: "mod", Enabled: true, Stage: "post", Type: "model", URL: server.URL, Model: "moderator", Key: "sk-moderation"})
+	c := newGuardrailContext(t, `{"messages":[{"role":"user","content":"hi"}]}`)
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+
+	out, newAPIError := RewriteResponseBody(c, []byte(`{"choices":[{"message":{"role":"assistant","content":"good answer"}}]}`))
+	require.Nil(t, newAPIError)
+	require.JSONEq(t, `{"choices":[{"message":{"role":"assistant","content":"good answer"}}]}`, string(out))
+
+	_, newAPIError = RewriteResponseBody(c, []byte(`{"choices":[{"message":{"role":"assistant","content":"bad answer"}}]}`))
+	require.NotNil(t, newAPIError)
+	require.Contains(t, newAPIError.Error(), "unsafe")
+
+	// 审核模型自身的请求不再经过钩子
+	c = newGuardrailContext(t, `{"messages":[{"role":"user","content":"hi"}]}`)
+	c.Set("token_key", "moderation")
+	require.Nil(t, ApplyGuardrails(c, types.RelayFormatOpenAI))
+	require.Nil(t, GetGuardrail(c))
+}
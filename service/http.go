@@ -9,6 +9,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
 
 	"github.com/gin-gonic/gin"
 )
@@ -46,30 +47,53 @@ func IOCopyBytesGracefully(c *gin.Context, src *http.Response, data []byte) {
 		return
 	}
 
-	body := io.NopCloser(bytes.NewBuffer(data))
-
-	// We shouldn't set the header before we parse the response body, because the parse part may fail.
-	// And then we will have to send an error response, but in this case, the header has already been set.
-	// So the httpClient will be confused by the response.
-	// For example, Postman will report error, and we cannot check the response at all.
+	statusCode := http.StatusOK
+	if src != nil {
+		statusCode = src.StatusCode
+	}
+	data, newAPIError := RewriteResponseBody(c, data)
+	if newAPIError != nil {
+		src = nil
+		statusCode = newAPIError.StatusCode
+		data = relaycommon.ErrorResponseBody(responseRelayFormat(c), newAPIError)
+		c.Writer.Header().Set("Content-Type", "application/json")
+	}
+	header := http.Header{}
 	if src != nil {
 		for k, v := range src.Header {
 			if !ShouldCopyUpstreamHeader(c, k, v) {
 				continue
 			}
-			c.Writer.Header().Set(k, v[0])
+			header.Set(k, v[0])
+		}
+	}
+	if override := relaycommon.GetResponseOverride(c); override != nil && newAPIError == nil {
+		result, newAPIError := override.ApplyWithHeader(data, statusCode, header)
+		if newAPIError != nil {
+			// return_error 替换整个响应，不再透传上游响应头
+			header = http.Header{}
+			statusCode = newAPIError.StatusCode
+			result = override.ErrorResponseBody(newAPIError)
+			c.Writer.Header().Set("Content-Type", "application/json")
 		}
+		data = result
+	}
+
+	body := io.NopCloser(bytes.NewBuffer(data))
+
+	// We shouldn't set the header before we parse the response body, because the parse part may fail.
+	// And then we will have to send an error response, but in this case, the header has already been set.
+	// So the httpClient will be confused by the response.
+	// For example, Postman will report error, and we cannot check the response at all.
+	for k, v := range header {
+		c.Writer.Header().Set(k, v[0])
 	}
 
 	// set Content-Length header manually BEFORE calling WriteHeader
 	c.Writer.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
 
 	// Write header with status code (this sends the headers)
-	if src != nil {
-		c.Writer.WriteHeader(src.StatusCode)
-	} else {
-		c.Writer.WriteHeader(http.StatusOK)
-	}
+	c.Writer.WriteHeader(statusCode)
 
 	_, err := io.Copy(c.Writer, body)
 	if err != nil {
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// ImagePolicyEnabled reports whether image inputs have to be collected for
+// CheckImagePolicy.
+func ImagePolicyEnabled() bool {
+	return operation_setting.GetImagePolicySetting().Enabled
+}
+
+func imagePolicyError(index int, format string, args ...interface{}) *types.NewAPIError {
+	message := fmt.Sprintf("image #%d: ", index+1) + fmt.Sprintf(format, args...)
+	return types.NewErrorWithStatusCode(errors.New(message), types.ErrorCodeImagePolicyViolation, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+// CheckImagePolicy checks the image inputs of a request against the image
+// policy of the user group. It runs before any upstream call, so a violation
+// costs nothing.
+func CheckImagePolicy(c *gin.Context, files []*types.FileMeta, group string) *types.NewAPIError {
+	setting := operation_setting.GetImagePolicySetting()
+	rule, ok := setting.RuleFor(group)
+	if !ok {
+		return nil
+	}
+	// 审核模型自身的请求不再检查
+	if model.IsTokenKeyOf(c.GetString("token_key"), strings.TrimPrefix(setting.Moderation.Key, "sk-")) {
+		return nil
+	}
+	var images []*types.FileMeta
+	for _, file := range files {
+		if file != nil && file.FileType == types.FileTypeImage && file.Source != nil {
+			images = append(images, file)
+		}
+	}
+	if rule.MaxImages > 0 && len(images) > rule.MaxImages {
+		return types.NewErrorWithStatusCode(fmt.Errorf("too many images: %d, at most %d allowed", len(images), rule.MaxImages), types.ErrorCodeImagePolicyViolation, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	for i, image := range images {
+		if image.IsURL() {
+			if rule.ForbidURL {
+				return imagePolicyError(i, "image URLs are not allowed, send the image as base64")
+			}
+			parsed, err := url.Parse(image.Source.GetRawData())
+			if err != nil || parsed.Hostname() == "" {
+				return imagePolicyError(i, "invalid image URL")
+			}
+			host := parsed.Hostname()
+			if operation_setting.MatchImageDomain(host, rule.DeniedDomains) {
+				return imagePolicyError(i, "images from %s are not allowed", host)
+			}
+			if len(rule.AllowedDomains) > 0 && !operation_setting.MatchImageDomain(host, rule.AllowedDomains) {
+				return imagePolicyError(i, "images from %s are not allowed", host)
+			}
+		} else if rule.ForbidBase64 {
+			return imagePolicyError(i, "base64 images are not allowed, send an image URL")
+		}
+
+		if rule.MaxBytes > 0 || rule.MaxWidth > 0 || rule.MaxHeight > 0 {
+			if newAPIError := checkImageSize(c, i, image.Source, rule); newAPIError != nil {
+				return newAPIError
+			}
+		}
+		if rule.Moderation {
+			if newAPIError := moderateImage(c, i, image.Source, setting.Moderation); newAPIError != nil {
+				return newAPIError
+			}
+		}
+	}
+	return nil
+}
+
+func checkImageSize(c *gin.Context, index int, source types.FileSource, rule operation_setting.ImagePolicyRule) *types.NewAPIError {
+	cachedData, err := LoadFileSource(c, source, "image_policy")
+	if err != nil {
+		return imagePolicyError(index, "failed to load image: %s", err.Error())
+	}
+	if rule.MaxBytes > 0 && cachedData.Size > rule.MaxBytes {
+		return imagePolicyError(index, "image size %d bytes exceeds the limit of %d bytes", cachedData.Size, rule.MaxBytes)
+	}
+	if rule.MaxWidth == 0 && rule.MaxHeight == 0 {
+		return nil
+	}
+	config, _, err := GetImageConfig(c, source)
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return imagePolicyError(index, "failed to decode image")
+	}
+	if (rule.MaxWidth > 0 && config.Width > rule.MaxWidth) || (rule.MaxHeight > 0 && config.Height > rule.MaxHeight) {
+		return imagePolicyError(index, "image dimensions %dx%d exceed the limit of %dx%d", config.Width, config.Height, rule.MaxWidth, rule.MaxHeight)
+	}
+	return nil
+}
+
+// moderateImage asks the moderation model whether the image is flagged.
+func moderateImage(c *gin.Context, index int, source types.FileSource, moderation operation_setting.ImageModerationSetting) *types.NewAPIError {
+	flagged, categories, err := callImageModeration(c, source, moderation)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("image moderation failed: %s", err.Error()))
+		if moderation.FailOpen() {
+			return nil
+		}
+		return types.NewErrorWithStatusCode(errors.New("image moderation unavailable"), types.ErrorCodeGuardrailFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+	}
+	if !flagged {
+		return nil
+	}
+	if len(categories) == 0 {
+		return imagePolicyError(index, "image rejected by moderation")
+	}
+	return imagePolicyError(index, "image rejected by moderation: %s", strings.Join(categories, ", "))
+}
+
+func callImageModeration(c *gin.Context, source types.FileSource, moderation operation_setting.ImageModerationSetting) (bool, []string, error) {
+	if moderation.Model == "" || moderation.Key == "" {
+		return false, nil, errors.New("image moderation model is not configured")
+	}
+	imageURL := source.GetRawData()
+	if !source.IsURL() {
+		base64Data, mimeType, err := GetBase64Data(c, source, "image_moderation")
+		if err != nil {
+			return false, nil, err
+		}
+		imageURL = fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data)
+	}
+	payload, err := common.Marshal(gin.H{
+		"model": moderation.Model,
+		"input": []gin.H{{"type": "image_url", "image_url": gin.H{"url": imageURL}}},
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	endpoint := moderation.URL
+	if endpoint == "" {
+		endpoint = strings.TrimRight(system_setting.ServerAddress, "/") + "/v1/moderations"
+	}
+	timeout := moderation.TimeoutMs
+	if timeout <= 0 {
+		timeout = 5000
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+	hook := operation_setting.GuardrailHook{Header: map[string]string{"Authorization": "Bearer " + moderation.Key}}
+	respBody, err := doGuardrailRequest(ctx, hook, endpoint, payload)
+	if err != nil {
+		return false, nil, err
+	}
+	result := gjson.GetBytes(respBody, "results.0")
+	if !result.Exists() {
+		return false, nil, errors.New("moderation response has no results")
+	}
+	var categories []string
+	result.Get("categories").ForEach(func(key, value gjson.Result) bool {
+		if value.Bool() {
+			categories = append(categories, key.String())
+		}
+		return true
+	})
+	return result.Get("flagged").Bool(), categories, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withImagePolicySetting(t *testing.T, setting operation_setting.ImagePolicySetting) {
+	current := operation_setting.GetImagePolicySetting()
+	previous := *current
+	*current = setting
+	t.Cleanup(func() { *current = previous })
+}
+
+func testPNGBase64(t *testing.T, width int, height int) string {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))))
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func newImagePolicyContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c
+}
+
+func TestCheckImagePolicy(t *testing.T) {
+	withImagePolicySetting(t, operation_setting.ImagePolicySetting{
+		Enabled: true,
+		Default: operation_setting.ImagePolicyRule{
+			AllowedDomains: []string{"*.example.com"},
+			DeniedDomains:  []string{"bad.example.com"},
+		},
+		GroupRules: map[string]operation_setting.ImagePolicyRule{
+			"small":  {MaxWidth: 16, MaxHeight: 16},
+			"strict": {ForbidBase64: true, MaxImages: 1},
+		},
+	})
+
+	urlImage := func(url string) *types.FileMeta {
+		return types.NewImageFileMeta(types.NewURLFileSource(url), "")
+	}
+	base64Image := func(data string) *types.FileMeta {
+		return types.NewImageFileMeta(types.NewBase64FileSource(data, ""), "")
+	}
+	check := func(group string, files ...*types.FileMeta) *types.NewAPIError {
+		return CheckImagePolicy(newImagePolicyContext(), files, group)
+	}
+
+	require.Nil(t, check("default", urlImage("https://img.example.com/a.png")))
+	newAPIError := check("default", urlImage("https://bad.example.com/a.png"))
+	require.NotNil(t, newAPIError)
+	require.Equal(t, types.ErrorCodeImagePolicyViolation, newAPIError.GetErrorCode())
+	require.NotNil(t, check("default", urlImage("https://example.org/a.png")))
+
+	require.Nil(t, check("small", base64Image(testPNGBase64(t, 8, 8))))
+	newAPIError = check("small", base64Image(testPNGBase64(t, 8, 8)), base64Image(testPNGBase64(t, 32, 8)))
+	require.NotNil(t, newAPIError)
+	require.Contains(t, newAPIError.Error(), "image #2")
+	require.Contains(t, newAPIError.Error(), "32x8")
+
+	// 分组规则整条替换默认规则
+	require.Nil(t, check("strict", urlImage("https://example.org/a.png")))
+	require.NotNil(t, check("strict", base64Image(testPNGBase64(t, 8, 8))))
+	require.NotNil(t, check("strict", urlImage("https://example.org/a.png"), urlImage("https://example.org/b.png")))
+}
+
+func TestCheckImagePolicyModeration(t *testing.T) {
+	InitHttpClient()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer sk-moderation", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"results":[{"flagged":true,"categories":{"violence":true,"sexual":false}}]}`))
+	}))
+	defer server.Close()
+
+	withImagePolicySetting(t, operation_setting.ImagePolicySetting{
+		Enabled: true,
+		Default: operation_setting.ImagePolicyRule{Moderation: true},
+		Moderation: operation_setting.ImageModerationSetting{
+			URL:   server.URL,
+			Model: "omni-moderation-latest",
+			Key:   "sk-moderation",
+		},
+	})
+	files := []*types.FileMeta{types.NewImageFileMeta(types.NewBase64FileSource(testPNGBase64(t, 4, 4), ""), "")}
+	newAPIError := CheckImagePolicy(newImagePolicyContext(), files, "default")
+	require.NotNil(t, newAPIError)
+	require.Contains(t, newAPIError.Error(), "violence")
+
+	// 审核模型不可用时按失败策略处理
+	server.Close()
+	newAPIError = CheckImagePolicy(newImagePolicyContext(), files, "default")
+	require.NotNil(t, newAPIError)
+	require.Equal(t, types.ErrorCodeGuardrailFailed, newAPIError.GetErrorCode())
+	operation_setting.GetImagePolicySetting().Moderation.FailurePolicy = "open"
+	require.Nil(t, CheckImagePolicy(newImagePolicyContext(), files, "default"))
+}
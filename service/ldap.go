@@ -0,0 +1,324 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/authz"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	ldapTimeout       = 10 * time.Second
+	ldapSyncPageSize  = 500
+	ldapUsernameToken = "{username}"
+)
+
+var (
+	ErrLDAPDisabled           = errors.New("LDAP login is disabled")
+	ErrLDAPInvalidCredentials = errors.New("invalid LDAP credentials")
+	ErrLDAPUserNotFound       = errors.New("LDAP user not found")
+	ErrLDAPUserAmbiguous      = errors.New("LDAP user filter matched more than one entry")
+)
+
+// LDAPEntry is a directory user after attribute mapping.
+type LDAPEntry struct {
+	DN          string
+	Subject     string // external_identity_claims.subject
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+// ldapConn is the subset of *ldap.Conn used here, so tests can swap in a
+// fake directory.
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	SearchWithPaging(request *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error)
+	Close() error
+}
+
+var dialLDAP = func(settings *system_setting.LDAPSettings) (ldapConn, error) {
+	tlsConfig, err := ldapTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ldap.DialURL(settings.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	if settings.StartTLS && strings.HasPrefix(strings.ToLower(settings.URL), "ldap://") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func ldapTLSConfig(settings *system_setting.LDAPSettings) (*tls.Config, error) {
+	parsed, err := url.Parse(settings.URL)
+	if err != nil || parsed.Hostname() == "" {
+		return nil, errors.New("invalid LDAP URL")
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         parsed.Hostname(),
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	if strings.TrimSpace(settings.RootCA) != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(settings.RootCA)) {
+			return nil, errors.New("invalid LDAP root CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// ValidateLDAPSettings checks the settings needed to reach the directory.
+func ValidateLDAPSettings(settings *system_setting.LDAPSettings) error {
+	parsed, err := url.Parse(settings.URL)
+	if err != nil || (parsed.Scheme != "ldap" && parsed.Scheme != "ldaps") || parsed.Hostname() == "" {
+		return errors.New("LDAP URL 必须为 ldap:// 或 ldaps:// 地址")
+	}
+	if strings.TrimSpace(settings.BaseDN) == "" {
+		return errors.New("LDAP Base DN 不能为空")
+	}
+	if !strings.Contains(settings.UserFilter, ldapUsernameToken) {
+		return errors.New("LDAP 用户过滤器必须包含 {username}")
+	}
+	if _, err := ldap.CompileFilter(strings.ReplaceAll(settings.UserFilter, ldapUsernameToken, "x")); err != nil {
+		return fmt.Errorf("LDAP 用户过滤器无效: %w", err)
+	}
+	if strings.TrimSpace(settings.UniqueIDAttribute) == "" {
+		return errors.New("LDAP 唯一标识属性不能为空")
+	}
+	return nil
+}
+
+func openLDAPServiceConn(settings *system_setting.LDAPSettings) (ldapConn, error) {
+	conn, err := dialLDAP(settings)
+	if err != nil {
+		return nil, err
+	}
+	if settings.BindDN != "" {
+		if err := conn.Bind(settings.BindDN, settings.BindPassword); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("LDAP service bind failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func ldapSearchAttributes(settings *system_setting.LDAPSettings) []string {
+	attributes := []string{settings.UniqueIDAttribute}
+	for _, name := range []string{settings.UsernameAttribute, settings.EmailAttribute, settings.DisplayNameAttribute, settings.GroupAttribute} {
+		if name != "" {
+			attributes = append(attributes, name)
+		}
+	}
+	return attributes
+}
+
+// AuthenticateLDAP finds the user with the service account and verifies the
+// password by binding as the user's own DN.
+func AuthenticateLDAP(username, password string) (*LDAPEntry, error) {
+	settings := system_setting.GetLDAPSettings()
+	if !settings.Enabled {
+		return nil, ErrLDAPDisabled
+	}
+	username = strings.TrimSpace(username)
+	// 空密码会变成匿名绑定并"成功"，必须在这里拒绝
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	conn, err := openLDAPServiceConn(settings)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := strings.ReplaceAll(settings.UserFilter, ldapUsernameToken, ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		settings.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		filter, ldapSearchAttributes(settings), nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrLDAPUserNotFound
+	case 1:
+	default:
+		return nil, ErrLDAPUserAmbiguous
+	}
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, err
+	}
+	return ldapEntryFromResult(settings, entry), nil
+}
+
+func ldapEntryFromResult(settings *system_setting.LDAPSettings, entry *ldap.Entry) *LDAPEntry {
+	return &LDAPEntry{
+		DN:          entry.DN,
+		Subject:     ldapEntrySubject(settings, entry),
+		Username:    entry.GetEqualFoldAttributeValue(settings.UsernameAttribute),
+		Email:       entry.GetEqualFoldAttributeValue(settings.EmailAttribute),
+		DisplayName: entry.GetEqualFoldAttributeValue(settings.DisplayNameAttribute),
+		Groups:      entry.GetEqualFoldAttributeValues(settings.GroupAttribute),
+	}
+}
+
+// ldapEntrySubject 优先使用唯一标识属性（entryUUID / objectGUID），二进制值按十六进制编码；
+// 缺失时退回到小写 DN，DN 在改名后会变化。
+func ldapEntrySubject(settings *system_setting.LDAPSettings, entry *ldap.Entry) string {
+	raw := entry.GetEqualFoldRawAttributeValues(settings.UniqueIDAttribute)
+	if len(raw) > 0 && len(raw[0]) > 0 {
+		value := raw[0]
+		if utf8.Valid(value) && strings.IndexFunc(string(value), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+			return model.ExternalIdentitySubject(string(value))
+		}
+		return model.ExternalIdentitySubject(hex.EncodeToString(value))
+	}
+	return model.ExternalIdentitySubject(strings.ToLower(entry.DN))
+}
+
+// SearchLDAPUsers returns every directory user matched by the user filter,
+// keyed by subject.
+func SearchLDAPUsers() (map[string]*LDAPEntry, error) {
+	settings := system_setting.GetLDAPSettings()
+	conn, err := openLDAPServiceConn(settings)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := strings.ReplaceAll(settings.UserFilter, ldapUsernameToken, "*")
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		settings.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, ldapSearchAttributes(settings), nil,
+	), ldapSyncPageSize)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*LDAPEntry, len(result.Entries))
+	for _, entry := range result.Entries {
+		mapped := ldapEntryFromResult(settings, entry)
+		entries[mapped.Subject] = mapped
+	}
+	return entries, nil
+}
+
+// SyncLDAPUserAccess applies the group mapping to a bound user: the user group
+// follows the first matching mapping and, when the mapping assigns roles, the
+// admin role follows the directory. Root users are never changed.
+func SyncLDAPUserAccess(user *model.User, match system_setting.LDAPGroupMatch) (bool, error) {
+	changed := false
+	if match.Group != "" && user.Group != match.Group {
+		groupChanged, err := model.UpdateUserGroupFromIdentityProvider(user.Id, match.Group)
+		if err != nil {
+			return false, err
+		}
+		user.Group = match.Group
+		changed = changed || groupChanged
+	}
+	if match.ManagesRole && user.Role != common.RoleRootUser {
+		roleChanged, err := setLDAPUserAdmin(user, match.Admin)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || roleChanged
+	}
+	return changed, nil
+}
+
+func setLDAPUserAdmin(user *model.User, admin bool) (bool, error) {
+	role := common.RoleCommonUser
+	if admin {
+		role = common.RoleAdminUser
+	}
+	if user.Role == role {
+		return false, nil
+	}
+	current, err := model.GetUserById(user.Id, false)
+	if err != nil {
+		return false, err
+	}
+	current.Role = role
+	if admin {
+		if err := current.Update(false); err != nil {
+			return false, err
+		}
+	} else {
+		// 与管理员降级相同：清除细粒度权限并吊销会话
+		if err := model.DB.Transaction(func(tx *gorm.DB) error {
+			if err := current.UpdateWithTx(tx, false); err != nil {
+				return err
+			}
+			return authz.ClearUserAuthorizationInTx(tx, current.Id)
+		}); err != nil {
+			return false, err
+		}
+		if err := authz.ReloadPolicy(); err != nil {
+			common.SysLog(fmt.Sprintf("failed to reload authz policy after LDAP demote of user %d: %s", current.Id, err.Error()))
+		}
+		if err := model.PublishUserAuthCache(current.Id); err != nil {
+			return false, err
+		}
+		if _, err := model.RevokeAllUserSessions(current.Id, "ldap_role_sync"); err != nil {
+			return false, err
+		}
+	}
+	if err := model.InvalidateUserTokensCache(current.Id); err != nil {
+		common.SysLog(fmt.Sprintf("failed to invalidate tokens cache for user %d: %s", current.Id, err.Error()))
+	}
+	user.Role = role
+	user.AuthVersion = current.AuthVersion
+	return true, nil
+}
+
+// DisableLDAPUser disables a user whose directory account is gone. Update bumps
+// the auth version, which revokes every session and invalidates token caches.
+func DisableLDAPUser(userId int) (bool, error) {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return false, err
+	}
+	if user.Role == common.RoleRootUser || user.Status == common.UserStatusDisabled {
+		return false, nil
+	}
+	user.Status = common.UserStatusDisabled
+	if err := user.Update(false); err != nil {
+		return false, err
+	}
+	if err := model.InvalidateUserTokensCache(user.Id); err != nil {
+		common.SysLog(fmt.Sprintf("failed to invalidate tokens cache for user %d: %s", user.Id, err.Error()))
+	}
+	return true, nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+const (
+	ldapSyncBatchSize              = 200
+	ldapSyncDefaultIntervalMinutes = 60
+)
+
+// ldapSyncHandler reconciles LDAP-bound users with the directory: users whose
+// entry is gone (or no longer matches a required group mapping) are disabled,
+// the others get their group and role mapping re-applied. Disabled users are
+// never re-enabled automatically.
+type ldapSyncHandler struct{}
+
+type LDAPSyncResult struct {
+	DirectoryUsers int `json:"directory_users"`
+	Scanned        int `json:"scanned"`
+	Disabled       int `json:"disabled"`
+	Updated        int `json:"updated"`
+}
+
+func (ldapSyncHandler) Type() string { return model.SystemTaskTypeLDAPSync }
+
+func (ldapSyncHandler) Enabled() bool {
+	settings := system_setting.GetLDAPSettings()
+	return settings.Enabled && settings.SyncEnabled
+}
+
+func (ldapSyncHandler) Interval() time.Duration {
+	intervalMinutes := system_setting.GetLDAPSettings().SyncIntervalMinutes
+	if intervalMinutes < 1 {
+		intervalMinutes = ldapSyncDefaultIntervalMinutes
+	}
+	return time.Duration(intervalMinutes) * time.Minute
+}
+
+func (ldapSyncHandler) NewPayload() any { return nil }
+
+func (ldapSyncHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	result, err := runLDAPSync(ctx, NewSystemTaskProgressReporter(task, runnerID))
+	if err != nil {
+		failSystemTask(task, runnerID, err)
+		return
+	}
+	if err := model.FinishSystemTask(task.TaskID, runnerID, model.SystemTaskStatusSucceeded, result, ""); err != nil {
+		logSystemTaskLockError(ctx, task, err)
+	}
+}
+
+func init() {
+	RegisterSystemTaskHandler(ldapSyncHandler{})
+}
+
+func runLDAPSync(ctx context.Context, report func(processed, total int)) (*LDAPSyncResult, error) {
+	settings := system_setting.GetLDAPSettings()
+	if !settings.Enabled {
+		return nil, ErrLDAPDisabled
+	}
+	total, err := model.CountExternalIdentities(model.ExternalIdentityProviderLDAP)
+	if err != nil {
+		return nil, err
+	}
+	directory, err := SearchLDAPUsers()
+	if err != nil {
+		return nil, err
+	}
+	// 目录返回空结果多半是过滤器或权限配置错误，不能据此停用全部账号
+	if len(directory) == 0 && total > 0 {
+		return nil, errors.New("LDAP directory returned no users, refusing to disable bound accounts")
+	}
+
+	result := &LDAPSyncResult{DirectoryUsers: len(directory)}
+	var lastId int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		claims, err := model.GetExternalIdentityClaimsAfter(model.ExternalIdentityProviderLDAP, lastId, ldapSyncBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, claim := range claims {
+			lastId = claim.Id
+			result.Scanned++
+			disabled, updated, err := syncLDAPClaim(settings, directory[claim.Subject], claim.UserId)
+			if err != nil {
+				common.SysError(fmt.Sprintf("LDAP sync failed for user %d: %s", claim.UserId, err.Error()))
+				continue
+			}
+			if disabled {
+				result.Disabled++
+			}
+			if updated {
+				result.Updated++
+			}
+		}
+		if int64(result.Scanned) > total {
+			total = int64(result.Scanned)
+		}
+		report(result.Scanned, int(total))
+		if len(claims) < ldapSyncBatchSize {
+			break
+		}
+	}
+	report(result.Scanned, result.Scanned)
+	return result, nil
+}
+
+func syncLDAPClaim(settings *system_setting.LDAPSettings, entry *LDAPEntry, userId int) (disabled bool, updated bool, err error) {
+	if entry == nil {
+		disabled, err = DisableLDAPUser(userId)
+		return disabled, false, err
+	}
+	match := settings.MapGroups(entry.Groups)
+	if settings.RequireGroupMatch && !match.Matched {
+		disabled, err = DisableLDAPUser(userId)
+		return disabled, false, err
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return false, false, err
+	}
+	if user.Status != common.UserStatusEnabled {
+		return false, false, nil
+	}
+	updated, err = SyncLDAPUserAccess(user, match)
+	return false, updated, err
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeLDAPDirectory implements ldapConn over an in-memory list of entries. It
+// only understands the "(uid=<value>)" filter used by the tests.
+type fakeLDAPDirectory struct {
+	entries   []*ldap.Entry
+	passwords map[string]string // DN -> password
+}
+
+func (d *fakeLDAPDirectory) Bind(username, password string) error {
+	if expected, ok := d.passwords[username]; ok && expected == password {
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+}
+
+func (d *fakeLDAPDirectory) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	value := strings.TrimSuffix(strings.TrimPrefix(request.Filter, "(uid="), ")")
+	result := &ldap.SearchResult{}
+	for _, entry := range d.entries {
+		if value == "*" || entry.GetAttributeValue("uid") == value {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeLDAPDirectory) SearchWithPaging(request *ldap.SearchRequest, _ uint32) (*ldap.SearchResult, error) {
+	return d.Search(request)
+}
+
+func (d *fakeLDAPDirectory) Close() error { return nil }
+
+func (d *fakeLDAPDirectory) add(uid, uuid, password string, groups ...string) {
+	dn := "uid=" + uid + ",ou=people,dc=example,dc=com"
+	d.entries = append(d.entries, ldap.NewEntry(dn, map[string][]string{
+		"uid":         {uid},
+		"entryUUID":   {uuid},
+		"mail":        {uid + "@example.com"},
+		"displayName": {strings.ToUpper(uid)},
+		"memberOf":    groups,
+	}))
+	d.passwords[dn] = password
+}
+
+func setupLDAPTest(t *testing.T) *fakeLDAPDirectory {
+	t.Helper()
+	previousDB, previousRedis := model.DB, common.RedisEnabled
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.UserSession{}, &model.ExternalIdentityClaim{}, &model.CasbinRule{}))
+	model.DB = db
+	common.RedisEnabled = false
+
+	settings := system_setting.GetLDAPSettings()
+	previousSettings := *settings
+	previousDial := dialLDAP
+	settings.Enabled = true
+	settings.URL = "ldap://ldap.example.com"
+	settings.BindDN = "cn=service,dc=example,dc=com"
+	settings.BindPassword = "service-password"
+	settings.BaseDN = "dc=example,dc=com"
+	settings.GroupMapping = ""
+	settings.RequireGroupMatch = false
+
+	directory := &fakeLDAPDirectory{passwords: map[string]string{settings.BindDN: settings.BindPassword}}
+	dialLDAP = func(*system_setting.LDAPSettings) (ldapConn, error) { return directory, nil }
+	t.Cleanup(func() {
+		dialLDAP = previousDial
+		*settings = previousSettings
+		model.DB = previousDB
+		common.RedisEnabled = previousRedis
+		_ = sqlDB.Close()
+	})
+	return directory
+}
+
+func seedLDAPUser(t *testing.T, username, subject string) *model.User {
+	t.Helper()
+	user := &model.User{Username: username, AffCode: "aff-" + username, Role: common.RoleCommonUser, Status: common.UserStatusEnabled, Group: "default", AuthVersion: 1}
+	require.NoError(t, model.DB.Create(user).Error)
+	require.NoError(t, model.ClaimExternalIdentityWithTx(model.DB, model.ExternalIdentityProviderLDAP, subject, user.Id))
+	return user
+}
+
+func TestAuthenticateLDAP(t *testing.T) {
+	directory := setupLDAPTest(t)
+	directory.add("alice", "uuid-alice", "alice-password", "cn=engineering,ou=groups,dc=example,dc=com")
+
+	entry, err := AuthenticateLDAP("alice", "alice-password")
+	require.NoError(t, err)
+	assert.Equal(t, "uuid-alice", entry.Subject)
+	assert.Equal(t, "alice", entry.Username)
+	assert.Equal(t, "alice@example.com", entry.Email)
+	assert.Equal(t, "ALICE", entry.DisplayName)
+	assert.Equal(t, []string{"cn=engineering,ou=groups,dc=example,dc=com"}, entry.Groups)
+
+	_, err = AuthenticateLDAP("alice", "wrong")
+	assert.ErrorIs(t, err, ErrLDAPInvalidCredentials)
+	_, err = AuthenticateLDAP("alice", "")
+	assert.ErrorIs(t, err, ErrLDAPInvalidCredentials, "empty password must not fall through to an anonymous bind")
+	_, err = AuthenticateLDAP("bob", "bob-password")
+	assert.ErrorIs(t, err, ErrLDAPUserNotFound)
+
+	system_setting.GetLDAPSettings().Enabled = false
+	_, err = AuthenticateLDAP("alice", "alice-password")
+	assert.ErrorIs(t, err, ErrLDAPDisabled)
+}
+
+func TestLDAPSyncDisablesUsersRemovedFromDirectory(t *testing.T) {
+	directory := setupLDAPTest(t)
+	directory.add("alice", "uuid-alice", "alice-password")
+	alice := seedLDAPUser(t, "alice", "uuid-alice")
+	bob := seedLDAPUser(t, "bob", "uuid-bob")
+	root := &model.User{Username: "root", AffCode: "aff-root", Role: common.RoleRootUser, Status: common.UserStatusEnabled, AuthVersion: 1}
+	require.NoError(t, model.DB.Create(root).Error)
+	require.NoError(t, model.ClaimExternalIdentityWithTx(model.DB, model.ExternalIdentityProviderLDAP, "uuid-root", root.Id))
+
+	result, err := runLDAPSync(context.Background(), func(int, int) {})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.DirectoryUsers)
+	assert.Equal(t, 3, result.Scanned)
+	assert.Equal(t, 1, result.Disabled)
+
+	reloaded, err := model.GetUserById(bob.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, common.UserStatusDisabled, reloaded.Status)
+	assert.Greater(t, reloaded.AuthVersion, bob.AuthVersion, "disabling must invalidate existing sessions")
+
+	reloaded, err = model.GetUserById(alice.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, common.UserStatusEnabled, reloaded.Status)
+	reloaded, err = model.GetUserById(root.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, common.UserStatusEnabled, reloaded.Status, "root is never disabled by the directory")
+}
+
+func TestLDAPSyncRefusesEmptyDirectory(t *testing.T) {
+	setupLDAPTest(t)
+	user := seedLDAPUser(t, "alice", "uuid-alice")
+
+	_, err := runLDAPSync(context.Background(), func(int, int) {})
+	require.Error(t, err)
+
+	reloaded, err := model.GetUserById(user.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, common.UserStatusEnabled, reloaded.Status)
+}
+
+func TestLDAPSyncAppliesGroupAndRoleMapping(t *testing.T) {
+	directory := setupLDAPTest(t)
+	settings := system_setting.GetLDAPSettings()
+	settings.GroupMapping = `[{"ldap_group":"engineering","group":"vip"},{"ldap_group":"ops","role":"admin"}]`
+	settings.RequireGroupMatch = true
+	directory.add("alice", "uuid-alice", "pw", "cn=Engineering,ou=groups,dc=example,dc=com")
+	directory.add("bob", "uuid-bob", "pw", "cn=ops,ou=groups,dc=example,dc=com")
+	directory.add("carol", "uuid-carol", "pw")
+	alice := seedLDAPUser(t, "alice", "uuid-alice")
+	bob := seedLDAPUser(t, "bob", "uuid-bob")
+	carol := seedLDAPUser(t, "carol", "uuid-carol")
+	require.NoError(t, model.DB.Model(&model.User{}).Where("id = ?", alice.Id).Update("role", common.RoleAdminUser).Error)
+
+	result, err := runLDAPSync(context.Background(), func(int, int) {})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Disabled)
+	assert.Equal(t, 2, result.Updated)
+
+	reloaded, err := model.GetUserById(alice.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, "vip", reloaded.Group)
+	assert.Equal(t, common.RoleCommonUser, reloaded.Role, "admin role follows the directory once roles are mapped")
+
+	reloaded, err = model.GetUserById(bob.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, "default", reloaded.Group)
+	assert.Equal(t, common.RoleAdminUser, reloaded.Role)
+
+	reloaded, err = model.GetUserById(carol.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, common.UserStatusDisabled, reloaded.Status, "require_group_match disables users outside every mapped group")
+}
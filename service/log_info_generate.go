@@ -87,6 +87,31 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if alias := common.GetContextKeyString(ctx, constant.ContextKeyModelSplitAlias); alias != "" {
+		other["model_alias"] = alias
+	}
+	if template, ok := common.GetContextKeyType[*PromptTemplateUsage](ctx, constant.ContextKeyPromptTemplate); ok {
+		other["prompt_template"] = template
+	}
+	if sources := common.GetContextKeyStringSlice(ctx, constant.ContextKeySystemPromptInjected); len(sources) > 0 {
+		other["system_prompt_injected"] = sources
+	}
+	if redaction := GetPIIRedaction(ctx); redaction.Detected() {
+		other["pii_redaction"] = redaction.Counts
+	}
+	if filter := GetSensitiveCompletionFilter(ctx); filter != nil && filter.hit {
+		action := "replace"
+		if filter.abort {
+			action = "abort"
+		}
+		other["completion_sensitive"] = map[string]interface{}{
+			"action": action,
+			"words":  filter.Words,
+		}
+	}
+	if g := GetGuardrail(ctx); g != nil && len(g.Records) > 0 {
+		other["guardrail"] = g.Records
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
@@ -107,6 +132,7 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	}
 
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
+	AppendSameChannelRetryAdminInfo(ctx, adminInfo)
 
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
@@ -163,6 +189,13 @@ func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interf
 	if relayInfo.UserSetting.BillingPreference != "" {
 		other["billing_preference"] = relayInfo.UserSetting.BillingPreference
 	}
+	if relayInfo.OrgId != 0 {
+		other["org_id"] = relayInfo.OrgId
+	}
+	if relayInfo.ResellerId != 0 && relayInfo.OrgId == 0 {
+		other["reseller_id"] = relayInfo.ResellerId
+		other["reseller_markup"] = relayInfo.ResellerMarkup
+	}
 	if relayInfo.BillingSource == "subscription" {
 		if relayInfo.SubscriptionId != 0 {
 			other["subscription_id"] = relayInfo.SubscriptionId
@@ -51,6 +51,12 @@ func PrepareMidjourneyTaskBilling(relayInfo *relaycommon.RelayInfo, task *model.
 	if relayInfo.BillingSource == BillingSourceSubscription {
 		return false, errors.New("legacy Midjourney billing does not support subscriptions")
 	}
+	if relayInfo.OrgId > 0 {
+		return false, errors.New("legacy Midjourney billing does not support organization tokens")
+	}
+	if relayInfo.ResellerId > 0 {
+		return false, errors.New("legacy Midjourney billing does not support reseller child accounts")
+	}
 
 	task.Quota = quota
 	task.BillingChannelId = task.ChannelId
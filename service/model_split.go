@@ -0,0 +1,78 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResolveModelSplit maps a split alias to one of its concrete models. The alias
+// is kept on the context so logs can attribute the request to its arm.
+func ResolveModelSplit(c *gin.Context, modelName string) (string, bool) {
+	settings := model_setting.GetModelSplitSettings()
+	if !settings.Enabled {
+		return "", false
+	}
+	alias, ok := settings.FindAlias(modelName)
+	if !ok {
+		return "", false
+	}
+	target := PickModelSplitArm(alias, modelSplitStickyKey(c, alias.StickyBy))
+	if target == "" {
+		return "", false
+	}
+	common.SetContextKey(c, constant.ContextKeyModelSplitAlias, alias.Alias)
+	return target, true
+}
+
+func modelSplitStickyKey(c *gin.Context, stickyBy string) string {
+	switch stickyBy {
+	case model_setting.ModelSplitStickyNone:
+		return ""
+	case model_setting.ModelSplitStickyToken:
+		if tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId); tokenId > 0 {
+			return fmt.Sprintf("token:%d", tokenId)
+		}
+	}
+	if userId := common.GetContextKeyInt(c, constant.ContextKeyUserId); userId > 0 {
+		return fmt.Sprintf("user:%d", userId)
+	}
+	return ""
+}
+
+// PickModelSplitArm places the sticky key on a fixed point of [0, total weight)
+// and returns the arm covering it. Arms keep their order, so raising a canary's
+// weight only moves the keys at the boundary instead of reshuffling everyone.
+// An empty key picks a random point per request.
+func PickModelSplitArm(alias model_setting.ModelSplitAlias, stickyKey string) string {
+	total := alias.TotalWeight()
+	if total <= 0 {
+		return ""
+	}
+	var point int
+	if stickyKey == "" {
+		point = rand.Intn(total)
+	} else {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(alias.Alias))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(stickyKey))
+		point = int(h.Sum64() % uint64(total))
+	}
+	for _, arm := range alias.Arms {
+		if arm.Weight <= 0 {
+			continue
+		}
+		if point < arm.Weight {
+			return arm.Model
+		}
+		point -= arm.Weight
+	}
+	return ""
+}
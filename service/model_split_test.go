@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickModelSplitArmIsStickyAndWeighted(t *testing.T) {
+	alias := model_setting.ModelSplitAlias{
+		Alias: "chat-default",
+		Arms: []model_setting.ModelSplitArm{
+			{Model: "gpt-x", Weight: 90},
+			{Model: "claude-y", Weight: 10},
+		},
+	}
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		picked := PickModelSplitArm(alias, key)
+		require.Equal(t, picked, PickModelSplitArm(alias, key), "same key must stay on the same arm")
+		counts[picked]++
+	}
+	assert.InDelta(t, 9000, counts["gpt-x"], 300)
+	assert.InDelta(t, 1000, counts["claude-y"], 300)
+}
+
+func TestPickModelSplitArmCanaryIncreaseKeepsExistingAssignments(t *testing.T) {
+	before := model_setting.ModelSplitAlias{
+		Alias: "chat-default",
+		Arms:  []model_setting.ModelSplitArm{{Model: "canary", Weight: 10}, {Model: "stable", Weight: 90}},
+	}
+	after := before
+	after.Arms = []model_setting.ModelSplitArm{{Model: "canary", Weight: 20}, {Model: "stable", Weight: 80}}
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("token:%d", i)
+		if PickModelSplitArm(before, key) == "canary" {
+			assert.Equal(t, "canary", PickModelSplitArm(after, key))
+		}
+	}
+}
+
+func TestResolveModelSplit(t *testing.T) {
+	settings := model_setting.GetModelSplitSettings()
+	saved := *settings
+	t.Cleanup(func() { *settings = saved })
+	*settings = model_setting.ModelSplitSettings{
+		Enabled: true,
+		Aliases: []model_setting.ModelSplitAlias{{
+			Alias:    "chat-default",
+			StickyBy: model_setting.ModelSplitStickyToken,
+			Arms:     []model_setting.ModelSplitArm{{Model: "gpt-x", Weight: 0}, {Model: "claude-y", Weight: 1}},
+		}},
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(c, constant.ContextKeyTokenId, 5)
+
+	_, ok := ResolveModelSplit(c, "gpt-x")
+	assert.False(t, ok)
+	target, ok := ResolveModelSplit(c, "chat-default")
+	require.True(t, ok)
+	assert.Equal(t, "claude-y", target)
+	assert.Equal(t, "chat-default", common.GetContextKeyString(c, constant.ContextKeyModelSplitAlias))
+
+	settings.Enabled = false
+	_, ok = ResolveModelSplit(c, "chat-default")
+	assert.False(t, ok)
+}
+
+func TestValidateModelSplitAliases(t *testing.T) {
+	require.NoError(t, model_setting.ValidateModelSplitAliases(`[{"alias":"chat-default","arms":[{"model":"gpt-x","weight":90},{"model":"claude-y","weight":10}]}]`))
+	assert.ErrorContains(t, model_setting.ValidateModelSplitAliases(`[{"alias":"a","arms":[{"model":"b","weight":1}]},{"alias":"a","arms":[{"model":"b","weight":1}]}]`), "duplicate")
+	assert.ErrorContains(t, model_setting.ValidateModelSplitAliases(`[{"alias":"a","arms":[{"model":"b","weight":0}]}]`), "positive weight")
+	assert.ErrorContains(t, model_setting.ValidateModelSplitAliases(`[{"alias":"a","arms":[{"model":"a","weight":1}]}]`), "itself")
+	assert.ErrorContains(t, model_setting.ValidateModelSplitAliases(`[{"alias":"a","arms":[{"model":"b","weight":1}]},{"alias":"b","arms":[{"model":"c","weight":1}]}]`), "another alias")
+	assert.ErrorContains(t, model_setting.ValidateModelSplitAliases(`[{"alias":"a","sticky_by":"ip","arms":[{"model":"b","weight":1}]}]`), "sticky_by")
+}
@@ -0,0 +1,397 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const piiPlaceholderPrefix = "[PII_"
+
+var (
+	piiEmailRegexp      = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+	piiPhoneRegexp      = regexp.MustCompile(`(?:\+?86[\- ]?)?1[3-9]\d{9}|\+[1-9]\d{7,14}`)
+	piiIdCardRegexp     = regexp.MustCompile(`\d{17}[\dXx]`)
+	piiCreditCardRegexp = regexp.MustCompile(`\d(?:[ \-]?\d){12,18}`)
+
+	piiCustomRegexpCache sync.Map // pattern -> *regexp.Regexp
+)
+
+// piiTextKeys are the request fields whose string values carry user text.
+// Strings inside arrays inherit the key of the array, e.g. "input": ["..."].
+var piiTextKeys = map[string]bool{
+	"content":      true,
+	"text":         true,
+	"input":        true,
+	"instructions": true,
+	"system":       true,
+	"prompt":       true,
+	"arguments":    true,
+	"partial_json": true,
+	"output":       true,
+	"query":        true,
+}
+
+type piiDetector struct {
+	name string
+	find func(text string) [][]int
+}
+
+// PIIRedaction holds the placeholder mapping of one request. Originals never
+// leave the process: they are neither sent upstream nor logged.
+type PIIRedaction struct {
+	relayFormat  types.RelayFormat
+	detectors    []piiDetector
+	placeholders map[string]string // original -> placeholder
+	originals    map[string]string // placeholder -> original
+	sequences    map[string]int
+	// Counts 按检测器统计命中次数，只记录数量
+	Counts map[string]int
+
+	restorer        *strings.Replacer
+	escapedRestorer *strings.Replacer
+	stream          *streamTextRewriter
+}
+
+func newPIIRedaction(relayFormat types.RelayFormat, group string) *PIIRedaction {
+	setting := operation_setting.GetPIIRedactionSetting()
+	r := &PIIRedaction{
+		relayFormat:  relayFormat,
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		sequences:    make(map[string]int),
+		Counts:       make(map[string]int),
+	}
+	// 先匹配结构化程度高的类型，避免身份证号被识别成银行卡号或手机号
+	for _, name := range []string{operation_setting.PIIDetectorEmail, operation_setting.PIIDetectorIdCard, operation_setting.PIIDetectorCreditCard, operation_setting.PIIDetectorPhone} {
+		if common.StringsContains(setting.Detectors, name) {
+			r.detectors = append(r.detectors, builtinPIIDetector(name))
+		}
+	}
+	for _, rule := range setting.CustomRules[group] {
+		re, err := compilePIICustomRegexp(rule.Pattern)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid pii custom rule %s: %s", rule.Name, err.Error()))
+			continue
+		}
+		r.detectors = append(r.detectors, piiDetector{
+			name: rule.Name,
+			find: func(text string) [][]int { return re.FindAllStringIndex(text, -1) },
+		})
+	}
+	return r
+}
+
+func compilePIICustomRegexp(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := piiCustomRegexpCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	piiCustomRegexpCache.Store(pattern, re)
+	return re, nil
+}
+
+func builtinPIIDetector(name string) piiDetector {
+	switch name {
+	case operation_setting.PIIDetectorEmail:
+		return piiDetector{name: name, find: func(text string) [][]int {
+			return piiEmailRegexp.FindAllStringIndex(text, -1)
+		}}
+	case operation_setting.PIIDetectorIdCard:
+		return piiDetector{name: name, find: func(text string) [][]int {
+			return filterPIIDigitMatches(text, piiIdCardRegexp.FindAllStringIndex(text, -1), isValidChineseIdCard)
+		}}
+	case operation_setting.PIIDetectorCreditCard:
+		return piiDetector{name: name, find: func(text string) [][]int {
+			return filterPIIDigitMatches(text, piiCreditCardRegexp.FindAllStringIndex(text, -1), isValidCreditCard)
+		}}
+	default:
+		return piiDetector{name: name, find: func(text string) [][]int {
+			return filterPIIDigitMatches(text, piiPhoneRegexp.FindAllStringIndex(text, -1), nil)
+		}}
+	}
+}
+
+// filterPIIDigitMatches drops matches that are part of a longer digit run and
+// those rejected by validate.
+func filterPIIDigitMatches(text string, matches [][]int, validate func(string) bool) [][]int {
+	result := matches[:0]
+	for _, match := range matches {
+		if match[0] > 0 && isASCIIDigit(text[match[0]-1]) {
+			continue
+		}
+		if match[1] < len(text) && isASCIIDigit(text[match[1]]) {
+			continue
+		}
+		if validate != nil && !validate(text[match[0]:match[1]]) {
+			continue
+		}
+		result = append(result, match)
+	}
+	return result
+}
+
+func isASCIIDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// isValidCreditCard checks the length and Luhn checksum of a card number that
+// may contain space or dash separators.
+func isValidCreditCard(value string) bool {
+	digits := make([]int, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if isASCIIDigit(value[i]) {
+			digits = append(digits, int(value[i]-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+var chineseIdCardWeights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+const chineseIdCardCheckCodes = "10X98765432"
+
+// isValidChineseIdCard validates an 18 digit resident identity card number by
+// its birth date and GB 11643 check code.
+func isValidChineseIdCard(value string) bool {
+	if len(value) != 18 {
+		return false
+	}
+	month := int(value[10]-'0')*10 + int(value[11]-'0')
+	day := int(value[12]-'0')*10 + int(value[13]-'0')
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return false
+	}
+	sum := 0
+	for i, weight := range chineseIdCardWeights {
+		sum += int(value[i]-'0') * weight
+	}
+	check := value[17]
+	if check == 'x' {
+		check = 'X'
+	}
+	return chineseIdCardCheckCodes[sum%11] == check
+}
+
+// RedactText replaces every detected value with a placeholder such as
+// [PII_EMAIL_1]. The same value always maps to the same placeholder within a
+// request, so the model can still tell values apart.
+func (r *PIIRedaction) RedactText(text string) string {
+	if text == "" {
+		return text
+	}
+	for _, detector := range r.detectors {
+		matches := detector.find(text)
+		if len(matches) == 0 {
+			continue
+		}
+		var builder strings.Builder
+		last := 0
+		for _, match := range matches {
+			builder.WriteString(text[last:match[0]])
+			builder.WriteString(r.placeholderFor(detector.name, text[match[0]:match[1]]))
+			last = match[1]
+		}
+		builder.WriteString(text[last:])
+		text = builder.String()
+	}
+	return text
+}
+
+func (r *PIIRedaction) placeholderFor(detector string, original string) string {
+	r.Counts[detector]++
+	if placeholder, ok := r.placeholders[original]; ok {
+		return placeholder
+	}
+	r.sequences[detector]++
+	placeholder := fmt.Sprintf("%s%s_%d]", piiPlaceholderPrefix, strings.ToUpper(detector), r.sequences[detector])
+	r.placeholders[original] = placeholder
+	r.originals[placeholder] = original
+	r.restorer = nil
+	r.escapedRestorer = nil
+	return placeholder
+}
+
+// Detected reports whether anything was redacted.
+func (r *PIIRedaction) Detected() bool {
+	return r != nil && len(r.originals) > 0
+}
+
+// RedactRequestBody redacts the text fields of a raw request body.
+func (r *PIIRedaction) RedactRequestBody(body []byte) ([]byte, error) {
+	return rewriteJSONStrings(body, func(key string, value string) (string, bool) {
+		if !piiTextKeys[key] {
+			return value, false
+		}
+		redacted := r.RedactText(value)
+		return redacted, redacted != value
+	})
+}
+
+// Restore puts the original values back into text.
+func (r *PIIRedaction) Restore(text string) string {
+	if !r.Detected() || !strings.Contains(text, piiPlaceholderPrefix) {
+		return text
+	}
+	if r.restorer == nil {
+		pairs := make([]string, 0, len(r.originals)*2)
+		for placeholder, original := range r.originals {
+			pairs = append(pairs, placeholder, original)
+		}
+		r.restorer = strings.NewReplacer(pairs...)
+	}
+	return r.restorer.Replace(text)
+}
+
+// restoreEscaped restores text that is itself a fragment of a JSON document.
+func (r *PIIRedaction) restoreEscaped(text string) string {
+	if !r.Detected() || !strings.Contains(text, piiPlaceholderPrefix) {
+		return text
+	}
+	if r.escapedRestorer == nil {
+		pairs := make([]string, 0, len(r.originals)*2)
+		for placeholder, original := range r.originals {
+			quoted, err := common.Marshal(original)
+			if err != nil {
+				continue
+			}
+			pairs = append(pairs, placeholder, string(quoted[1:len(quoted)-1]))
+		}
+		r.escapedRestorer = strings.NewReplacer(pairs...)
+	}
+	return r.escapedRestorer.Replace(text)
+}
+
+// RestoreJSON restores the placeholders in every string of a JSON response
+// except the provider-signed reasoning fields. Non-JSON data is restored as
+// plain text.
+func (r *PIIRedaction) RestoreJSON(data []byte) []byte {
+	if !r.Detected() || !strings.Contains(string(data), piiPlaceholderPrefix) {
+		return data
+	}
+	if !gjson.ValidBytes(data) {
+		return []byte(r.Restore(string(data)))
+	}
+	restored, err := rewriteJSONStrings(data, func(key string, value string) (string, bool) {
+		if opaqueResponseKeys[key] || !strings.Contains(value, piiPlaceholderPrefix) {
+			return value, false
+		}
+		if jsonTextKeys[key] {
+			return r.restoreEscaped(value), true
+		}
+		return r.Restore(value), true
+	})
+	if err != nil {
+		return data
+	}
+	return restored
+}
+
+// splitPending keeps back a trailing fragment that may still grow into a
+// known placeholder in the next stream chunk.
+func (r *PIIRedaction) splitPending(text string) (string, string) {
+	i := strings.LastIndexByte(text, '[')
+	if i < 0 {
+		return text, ""
+	}
+	tail := text[i:]
+	for placeholder := range r.originals {
+		if len(tail) < len(placeholder) && strings.HasPrefix(placeholder, tail) {
+			return text[:i], tail
+		}
+	}
+	return text, ""
+}
+
+func (r *PIIRedaction) restoreDelta(text string, escaped bool) string {
+	if escaped {
+		return r.restoreEscaped(text)
+	}
+	return r.Restore(text)
+}
+
+// RestoreStreamChunk restores one SSE data payload in the client's format.
+// Placeholders split across chunks are reassembled; see
+// streamTextRewriter.RewriteChunk for the extra chunks it may return.
+func (r *PIIRedaction) RestoreStreamChunk(data []byte) [][]byte {
+	if !r.Detected() || !gjson.ValidBytes(data) {
+		return [][]byte{data}
+	}
+	if r.stream == nil {
+		r.stream = newStreamTextRewriter(r.relayFormat, r.restoreDelta, r.splitPending)
+	}
+	chunks := r.stream.RewriteChunk(data)
+	for i := range chunks {
+		chunks[i] = r.RestoreJSON(chunks[i])
+	}
+	return chunks
+}
+
+// ApplyPIIRedaction redacts personal data from the raw request body before it
+// is parsed, converted and sent upstream. The mapping is kept on the context
+// so responses can be restored; only per-detector counts are logged.
+func ApplyPIIRedaction(c *gin.Context, relayFormat types.RelayFormat) *types.NewAPIError {
+	group := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	if !operation_setting.GetPIIRedactionSetting().AppliesTo(group) {
+		return nil
+	}
+	switch relayFormat {
+	case types.RelayFormatOpenAI, types.RelayFormatOpenAIResponses, types.RelayFormatClaude, types.RelayFormatGemini, types.RelayFormatEmbedding:
+	default:
+		return nil
+	}
+
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil
+	}
+	body, err := storage.Bytes()
+	if err != nil || !gjson.ValidBytes(body) {
+		return nil
+	}
+	redaction := newPIIRedaction(relayFormat, group)
+	body, err = redaction.RedactRequestBody(body)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+	if !redaction.Detected() {
+		return nil
+	}
+	common.CleanupBodyStorage(c)
+	c.Set(common.KeyRequestBody, body)
+	common.SetContextKey(c, constant.ContextKeyPIIRedaction, redaction)
+	return nil
+}
+
+// GetPIIRedaction returns the redaction of the current request, or nil when
+// nothing was redacted.
+func GetPIIRedaction(c *gin.Context) *PIIRedaction {
+	redaction, _ := common.GetContextKeyType[*PIIRedaction](c, constant.ContextKeyPIIRedaction)
+	return redaction
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func withPIIRedactionSetting(t *testing.T, setting operation_setting.PIIRedactionSetting) {
+	current := operation_setting.GetPIIRedactionSetting()
+	previous := *current
+	*current = setting
+	t.Cleanup(func() { *current = previous })
+}
+
+func TestPIIDetectors(t *testing.T) {
+	require.True(t, isValidCreditCard("4111 1111 1111 1111"))
+	require.False(t, isValidCreditCard("4111 1111 1111 1112"))
+	require.True(t, isValidChineseIdCard("11010519491231002X"))
+	require.False(t, isValidChineseIdCard("110105194912310021"))
+
+	withPIIRedactionSetting(t, operation_setting.PIIRedactionSetting{
+		Enabled:   true,
+		Detectors: []string{"email", "phone", "id_card", "credit_card"},
+		CustomRules: map[string][]operation_setting.PIICustomRule{
+			"vip": {{Name: "employee_id", Pattern: `EMP-\d{6}`}},
+		},
+	})
+	r := newPIIRedaction(types.RelayFormatOpenAI, "vip")
+	redacted := r.RedactText("mail ada@example.com or ada@example.com, call 13812345678, id 11010519491231002x, card 4111-1111-1111-1111, order 1234567890123, EMP-004211")
+	require.Equal(t, "mail [PII_EMAIL_1] or [PII_EMAIL_1], call [PII_PHONE_1], id [PII_ID_CARD_1], card [PII_CREDIT_CARD_1], order 1234567890123, [PII_EMPLOYEE_ID_1]", redacted)
+	require.Equal(t, map[string]int{"email": 2, "phone": 1, "id_card": 1, "credit_card": 1, "employee_id": 1}, r.Counts)
+	require.Equal(t, "reach ada@example.com", r.Restore("reach [PII_EMAIL_1]"))
+
+	// 其他分组不使用 vip 的自定义规则
+	require.Equal(t, "EMP-004211", newPIIRedaction(types.RelayFormatOpenAI, "default").RedactText("EMP-004211"))
+}
+
+func TestPIIRedactRequestBody(t *testing.T) {
+	withPIIRedactionSetting(t, operation_setting.PIIRedactionSetting{Enabled: true, Detectors: []string{"email"}})
+	r := newPIIRedaction(types.RelayFormatClaude, "default")
+	body, err := r.RedactRequestBody([]byte(`{"model":"a@b.co","system":"owner a@b.co","messages":[{"role":"user","content":[{"type":"text","text":"to c@d.io"},{"type":"thinking","thinking":"a@b.co","signature":"x"}]}]}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"a@b.co","system":"owner [PII_EMAIL_1]","messages":[{"role":"user","content":[{"type":"text","text":"to [PII_EMAIL_2]"},{"type":"thinking","thinking":"a@b.co","signature":"x"}]}]}`, string(body))
+
+	restored := r.RestoreJSON([]byte(`{"content":[{"type":"thinking","thinking":"[PII_EMAIL_1]"},{"type":"text","text":"sent to [PII_EMAIL_2]"},{"type":"tool_use","input":{"to":"[PII_EMAIL_1]"}}]}`))
+	require.JSONEq(t, `{"content":[{"type":"thinking","thinking":"[PII_EMAIL_1]"},{"type":"text","text":"sent to c@d.io"},{"type":"tool_use","input":{"to":"a@b.co"}}]}`, string(restored))
+}
+
+func TestPIIRestoreStreamChunk(t *testing.T) {
+	withPIIRedactionSetting(t, operation_setting.PIIRedactionSetting{Enabled: true, Detectors: []string{"email"}})
+
+	r := newPIIRedaction(types.RelayFormatOpenAI, "default")
+	r.RedactText("a@b.co")
+	chunks := [][]byte{
+		[]byte(`{"choices":[{"index":0,"delta":{"content":"mail [PII_EM"}}]}`),
+		[]byte(`{"choices":[{"index":0,"delta":{"content":"AIL_1] now ["}}]}`),
+		[]byte(`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`),
+	}
+	want := []string{
+		`{"choices":[{"index":0,"delta":{"content":"mail "}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"a@b.co now "}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"["},"finish_reason":"stop"}]}`,
+	}
+	for i, chunk := range chunks {
+		out := r.RestoreStreamChunk(chunk)
+		require.Len(t, out, 1)
+		require.JSONEq(t, want[i], string(out[0]))
+	}
+
+	// Claude 在内容块结束前补发被保留的文本
+	r = newPIIRedaction(types.RelayFormatClaude, "default")
+	r.RedactText("a@b.co")
+	out := r.RestoreStreamChunk([]byte(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"x [PII_"}}`))
+	require.JSONEq(t, `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"x "}}`, string(out[0]))
+	out = r.RestoreStreamChunk([]byte(`{"type":"content_block_stop","index":0}`))
+	require.Len(t, out, 2)
+	require.JSONEq(t, `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"[PII_"}}`, string(out[0]))
+	require.JSONEq(t, `{"type":"content_block_stop","index":0}`, string(out[1]))
+
+	// 工具参数是 JSON 文本，还原值需要转义
+	r = newPIIRedaction(types.RelayFormatOpenAIResponses, "default")
+	r.placeholderFor("quote", `say "hi"`)
+	out = r.RestoreStreamChunk([]byte(`{"type":"response.function_call_arguments.delta","item_id":"fc_1","output_index":0,"delta":"{\"q\":\"[PII_QUOTE_1]\"}"}`))
+	require.JSONEq(t, `{"type":"response.function_call_arguments.delta","item_id":"fc_1","output_index":0,"delta":"{\"q\":\"say \\\"hi\\\"\"}"}`, string(out[0]))
+}
+
+func TestApplyPIIRedaction(t *testing.T) {
+	withPIIRedactionSetting(t, operation_setting.PIIRedactionSetting{Enabled: true, Detectors: []string{"email"}, Groups: []string{"vip"}})
+
+	run := func(group string, body string) (*gin.Context, string) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		c.Set(common.KeyRequestBody, []byte(body))
+		common.SetContextKey(c, constant.ContextKeyUserGroup, group)
+		require.Nil(t, ApplyPIIRedaction(c, types.RelayFormatOpenAI))
+		storage, err := common.GetBodyStorage(c)
+		require.NoError(t, err)
+		out, err := storage.Bytes()
+		require.NoError(t, err)
+		return c, string(out)
+	}
+
+	c, out := run("vip", `{"messages":[{"role":"user","content":"I am a@b.co"}]}`)
+	require.JSONEq(t, `{"messages":[{"role":"user","content":"I am [PII_EMAIL_1]"}]}`, out)
+	require.Equal(t, map[string]int{"email": 1}, GetPIIRedaction(c).Counts)
+
+	c, out = run("default", `{"messages":[{"role":"user","content":"I am a@b.co"}]}`)
+	require.JSONEq(t, `{"messages":[{"role":"user","content":"I am a@b.co"}]}`, out)
+	require.False(t, GetPIIRedaction(c).Detected())
+}
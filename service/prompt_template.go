@@ -0,0 +1,152 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var promptTemplateVariableRegexp = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// PromptTemplateUsage records which template version a request rendered.
+type PromptTemplateUsage struct {
+	PromptId string `json:"id"`
+	Name     string `json:"name"`
+	Version  int    `json:"version"`
+}
+
+// PromptTemplateVariableNames returns the distinct {{variable}} names used by
+// content, in order of first appearance.
+func PromptTemplateVariableNames(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range promptTemplateVariableRegexp.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// RenderPromptTemplate substitutes {{variable}} placeholders. Request
+// variables win over the version defaults; a placeholder with neither is an
+// error. Variables may be plain values or OpenAI input_text objects.
+func RenderPromptTemplate(content string, defaults map[string]string, variables map[string]gjson.Result) (string, error) {
+	var renderErr error
+	rendered := promptTemplateVariableRegexp.ReplaceAllStringFunc(content, func(placeholder string) string {
+		name := promptTemplateVariableRegexp.FindStringSubmatch(placeholder)[1]
+		if value, ok := variables[name]; ok {
+			text, err := promptTemplateVariableText(name, value)
+			if err != nil && renderErr == nil {
+				renderErr = err
+			}
+			return text
+		}
+		if value, ok := defaults[name]; ok {
+			return value
+		}
+		if renderErr == nil {
+			renderErr = fmt.Errorf("missing prompt variable: %s", name)
+		}
+		return placeholder
+	})
+	return rendered, renderErr
+}
+
+func promptTemplateVariableText(name string, value gjson.Result) (string, error) {
+	switch {
+	case value.IsObject():
+		if value.Get("type").String() == "input_text" {
+			return value.Get("text").String(), nil
+		}
+		return "", fmt.Errorf("prompt variable %s: only input_text objects are supported", name)
+	case value.IsArray():
+		return "", fmt.Errorf("prompt variable %s: arrays are not supported", name)
+	default:
+		return value.String(), nil
+	}
+}
+
+// ApplyPromptTemplate renders a gateway-managed template referenced by
+// `prompt: {id, version, variables}` into the request body, before the body
+// is parsed and converted. Prompt ids without the gateway prefix are left for
+// the upstream.
+func ApplyPromptTemplate(c *gin.Context, relayFormat types.RelayFormat) *types.NewAPIError {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return nil
+	}
+	ref := gjson.GetBytes(body, "prompt")
+	if !ref.IsObject() || !strings.HasPrefix(ref.Get("id").String(), model.PromptTemplateIdPrefix) {
+		return nil
+	}
+	promptId := ref.Get("id").String()
+
+	template, err := model.GetPromptTemplateByPromptId(promptId)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	if template == nil || !template.UsableBy(userId, tokenId) {
+		// 无权限与不存在返回同样的错误，避免探测他人的模板
+		return types.NewErrorWithStatusCode(fmt.Errorf("prompt template %s not found", promptId), types.ErrorCodeInvalidRequest, http.StatusNotFound, types.ErrOptionWithSkipRetry())
+	}
+
+	version := 0
+	if rawVersion := ref.Get("version").String(); rawVersion != "" {
+		version, err = strconv.Atoi(rawVersion)
+		if err != nil || version <= 0 {
+			return types.NewErrorWithStatusCode(fmt.Errorf("invalid prompt template version: %s", rawVersion), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+	}
+	templateVersion, err := model.GetPromptTemplateVersion(template, version)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if templateVersion == nil {
+		return types.NewErrorWithStatusCode(fmt.Errorf("prompt template %s has no version %d", promptId, version), types.ErrorCodeInvalidRequest, http.StatusNotFound, types.ErrOptionWithSkipRetry())
+	}
+
+	variables := make(map[string]gjson.Result)
+	ref.Get("variables").ForEach(func(key, value gjson.Result) bool {
+		variables[key.String()] = value
+		return true
+	})
+	rendered, err := RenderPromptTemplate(templateVersion.Content, templateVersion.GetVariables(), variables)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	body, err = sjson.DeleteBytes(body, "prompt")
+	if err == nil {
+		body, err = InjectSystemPrompt(body, relayFormat, rendered)
+	}
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	common.CleanupBodyStorage(c)
+	c.Set(common.KeyRequestBody, body)
+	common.SetContextKey(c, constant.ContextKeyPromptTemplate, &PromptTemplateUsage{
+		PromptId: template.PromptId,
+		Name:     template.Name,
+		Version:  templateVersion.Version,
+	})
+	return nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+)
+
+func TestRenderPromptTemplate(t *testing.T) {
+	variables := map[string]gjson.Result{
+		"customer": gjson.Parse(`"Ada"`),
+		"tier":     gjson.Parse(`{"type":"input_text","text":"gold"}`),
+		"count":    gjson.Parse(`3`),
+	}
+	rendered, err := RenderPromptTemplate("Hi {{customer}} ({{ tier }}), {{count}} orders, lang={{lang}}", map[string]string{"lang": "en", "customer": "x"}, variables)
+	require.NoError(t, err)
+	require.Equal(t, "Hi Ada (gold), 3 orders, lang=en", rendered)
+
+	_, err = RenderPromptTemplate("Hi {{customer}}", nil, nil)
+	require.ErrorContains(t, err, "missing prompt variable: customer")
+
+	_, err = RenderPromptTemplate("{{img}}", nil, map[string]gjson.Result{"img": gjson.Parse(`{"type":"input_image","image_url":"x"}`)})
+	require.Error(t, err)
+
+	require.Equal(t, []string{"customer", "tier"}, PromptTemplateVariableNames("{{customer}} {{tier}} {{ customer }}"))
+}
+
+func TestApplyPromptTemplate(t *testing.T) {
+	previousDB := model.DB
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.PromptTemplate{}, &model.PromptTemplateVersion{}))
+	model.DB = db
+	t.Cleanup(func() { model.DB = previousDB })
+
+	template := &model.PromptTemplate{UserId: 1, Name: "support"}
+	require.NoError(t, template.SetTokenIds([]int{10}))
+	first := &model.PromptTemplateVersion{Content: "v1 {{name}}"}
+	require.NoError(t, template.Insert(first))
+	second := &model.PromptTemplateVersion{Content: "v2 {{name}}"}
+	require.NoError(t, second.SetVariables(map[string]string{"name": "guest"}))
+	require.NoError(t, template.AddVersion(second))
+	require.Equal(t, 2, second.Version)
+
+	run := func(userId, tokenId int, body string) (*gin.Context, *types.NewAPIError) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader([]byte(body)))
+		c.Set(common.KeyRequestBody, []byte(body))
+		common.SetContextKey(c, constant.ContextKeyUserId, userId)
+		common.SetContextKey(c, constant.ContextKeyTokenId, tokenId)
+		return c, ApplyPromptTemplate(c, types.RelayFormatOpenAIResponses)
+	}
+	requestBody := func(c *gin.Context) string {
+		storage, err := common.GetBodyStorage(c)
+		require.NoError(t, err)
+		body, err := storage.Bytes()
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	c, newAPIError := run(1, 10, `{"input":"hi","prompt":{"id":"`+template.PromptId+`"}}`)
+	require.Nil(t, newAPIError)
+	require.JSONEq(t, `{"input":"hi","instructions":"v2 guest"}`, requestBody(c))
+	usage, ok := common.GetContextKeyType[*PromptTemplateUsage](c, constant.ContextKeyPromptTemplate)
+	require.True(t, ok)
+	require.Equal(t, 2, usage.Version)
+
+	c, newAPIError = run(1, 10, `{"input":"hi","prompt":{"id":"`+template.PromptId+`","version":"1","variables":{"name":"Ada"}}}`)
+	require.Nil(t, newAPIError)
+	require.JSONEq(t, `{"input":"hi","instructions":"v1 Ada"}`, requestBody(c))
+
+	// 未共享的令牌、其他用户都视为不存在
+	_, newAPIError = run(1, 11, `{"prompt":{"id":"`+template.PromptId+`"}}`)
+	require.NotNil(t, newAPIError)
+	require.Equal(t, http.StatusNotFound, newAPIError.StatusCode)
+	_, newAPIError = run(2, 20, `{"prompt":{"id":"`+template.PromptId+`"}}`)
+	require.NotNil(t, newAPIError)
+
+	// 第一个版本没有默认值
+	_, newAPIError = run(1, 10, `{"prompt":{"id":"`+template.PromptId+`","version":"1"}}`)
+	require.NotNil(t, newAPIError)
+	require.Equal(t, http.StatusBadRequest, newAPIError.StatusCode)
+
+	// 非本站前缀的 prompt 原样透传给上游
+	c, newAPIError = run(1, 10, `{"input":"hi","prompt":{"id":"pmpt_abc"}}`)
+	require.Nil(t, newAPIError)
+	require.JSONEq(t, `{"input":"hi","prompt":{"id":"pmpt_abc"}}`, requestBody(c))
+}
@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// proxyHealth tracks one pooled proxy. A proxy is ejected after
+// FailureThreshold consecutive failures (passive request errors or active
+// health checks) and is eligible again once EjectDurationSeconds have passed
+// or a health check succeeds, whichever comes first.
+type proxyHealth struct {
+	consecutiveFailures int
+	ejectedUntil        time.Time
+	lastCheckedAt       time.Time
+	lastError           string
+}
+
+type proxyPoolRegistry struct {
+	mutex    sync.Mutex
+	health   map[string]*proxyHealth // trimmed proxy URL -> health
+	counters map[string]uint64       // pool key -> round-robin cursor
+}
+
+var proxyPools = proxyPoolRegistry{
+	health:   make(map[string]*proxyHealth),
+	counters: make(map[string]uint64),
+}
+
+var proxyPoolHealthCheckOnce sync.Once
+
+// ProxyHealthStatus is the admin-facing view of one pooled proxy.
+type ProxyHealthStatus struct {
+	Proxy               string `json:"proxy"`
+	Healthy             bool   `json:"healthy"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	EjectedUntil        int64  `json:"ejected_until,omitempty"`
+	LastCheckedAt       int64  `json:"last_checked_at,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// ResolveChannelProxy picks the outbound proxy for one upstream request. Without
+// a proxy pool it returns settings.Proxy unchanged. stickyKey (normally the
+// channel key in use) keeps sticky pools on the same proxy per upstream key.
+func ResolveChannelProxy(channelId int, settings dto.ChannelSettings, stickyKey string) string {
+	if settings.ProxyPool == nil {
+		return settings.Proxy
+	}
+	poolKey, proxies, strategy := resolveProxyPoolMembers(channelId, settings.ProxyPool)
+	if len(proxies) == 0 {
+		return settings.Proxy
+	}
+	candidates := proxyPools.healthyMembers(proxies, time.Now())
+	if len(candidates) == 0 {
+		// Every member is ejected: fail open rather than blocking the channel.
+		candidates = proxies
+	}
+	if strategy == dto.ProxyPoolStrategySticky && stickyKey != "" {
+		return pickStickyProxy(candidates, stickyKey)
+	}
+	return candidates[proxyPools.nextCursor(poolKey)%uint64(len(candidates))]
+}
+
+// ResolveProxyForChannel resolves the outbound proxy for requests made on behalf
+// of channel outside the relay path, such as task polling, balance queries and
+// model list fetches, so they share the channel's proxy pool.
+func ResolveProxyForChannel(channel *model.Channel) string {
+	if channel == nil {
+		return ""
+	}
+	return ResolveChannelProxy(channel.Id, channel.GetSetting(), channel.Key)
+}
+
+func resolveProxyPoolMembers(channelId int, pool *dto.ChannelProxyPool) (string, []string, string) {
+	if name := strings.TrimSpace(pool.Name); name != "" {
+		shared, ok := system_setting.GetProxyPoolSetting().FindProxyPool(name)
+		if !ok {
+			return "", nil, ""
+		}
+		return "pool:" + name, normalizeProxyPoolMembers(shared.Proxies), shared.Strategy
+	}
+	return fmt.Sprintf("channel:%d", channelId), normalizeProxyPoolMembers(pool.Proxies), pool.Strategy
+}
+
+func normalizeProxyPoolMembers(proxies []string) []string {
+	members := make([]string, 0, len(proxies))
+	for _, proxyURL := range proxies {
+		if trimmed := strings.TrimSpace(proxyURL); trimmed != "" {
+			members = append(members, trimmed)
+		}
+	}
+	return members
+}
+
+// pickStickyProxy uses rendezvous hashing so that ejecting one proxy only
+// moves the keys that were pinned to it.
+func pickStickyProxy(candidates []string, stickyKey string) string {
+	var (
+		best      string
+		bestScore uint64
+	)
+	for _, candidate := range candidates {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(stickyKey))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(candidate))
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+func (r *proxyPoolRegistry) nextCursor(poolKey string) uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	cursor := r.counters[poolKey]
+	r.counters[poolKey] = cursor + 1
+	return cursor
+}
+
+// healthyMembers registers every member for health checks and returns those
+// that are not currently ejected.
+func (r *proxyPoolRegistry) healthyMembers(proxies []string, now time.Time) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	healthy := make([]string, 0, len(proxies))
+	for _, proxyURL := range proxies {
+		state, ok := r.health[proxyURL]
+		if !ok {
+			state = &proxyHealth{}
+			r.health[proxyURL] = state
+		}
+		if now.Before(state.ejectedUntil) {
+			continue
+		}
+		healthy = append(healthy, proxyURL)
+	}
+	return healthy
+}
+
+func (r *proxyPoolRegistry) record(proxyURL string, err error, now time.Time, fromHealthCheck bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	state, ok := r.health[proxyURL]
+	if !ok {
+		// Only pooled proxies are tracked; single-proxy channels are left alone.
+		return
+	}
+	if fromHealthCheck {
+		state.lastCheckedAt = now
+	}
+	if err == nil {
+		state.consecutiveFailures = 0
+		state.ejectedUntil = time.Time{}
+		state.lastError = ""
+		return
+	}
+	setting := system_setting.GetProxyPoolSetting()
+	state.consecutiveFailures++
+	state.lastError = err.Error()
+	threshold := setting.FailureThreshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+	if state.consecutiveFailures >= threshold {
+		ejectFor := time.Duration(setting.EjectDurationSeconds) * time.Second
+		if ejectFor <= 0 {
+			ejectFor = time.Minute
+		}
+		if state.ejectedUntil.IsZero() || !now.Before(state.ejectedUntil) {
+			common.SysLog(fmt.Sprintf("proxy ejected from pool for %s after %d consecutive failures: %s", ejectFor, state.consecutiveFailures, proxyDisplayName(proxyURL)))
+		}
+		state.ejectedUntil = now.Add(ejectFor)
+	}
+}
+
+// prune drops the health of proxies that are no longer in any pool, so a
+// removed proxy neither lingers in the health report nor keeps being probed.
+func (r *proxyPoolRegistry) prune(configured map[string]struct{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for proxyURL := range r.health {
+		if _, ok := configured[proxyURL]; !ok {
+			delete(r.health, proxyURL)
+		}
+	}
+}
+
+func (r *proxyPoolRegistry) members() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	members := make([]string, 0, len(r.health))
+	for proxyURL := range r.health {
+		members = append(members, proxyURL)
+	}
+	return members
+}
+
+// ReportProxyResult feeds the outcome of a request sent through proxyURL into
+// passive health tracking. Only failures to reach the proxy itself count
+// against it; upstream timeouts, resets and client cancellations do not.
+func ReportProxyResult(proxyURL string, err error) {
+	proxyURL = strings.TrimSpace(proxyURL)
+	if proxyURL == "" {
+		return
+	}
+	if err != nil && !IsProxyConnectionError(err) {
+		return
+	}
+	proxyPools.record(proxyURL, err, time.Now(), false)
+}
+
+// IsProxyConnectionError reports whether err comes from connecting to the proxy
+// rather than from the upstream behind it. net/http wraps dial and TLS failures
+// towards an HTTP(S) proxy as "proxyconnect"; the SOCKS dialer reports a failed
+// dial to the proxy as "socks connect" wrapping a *net.OpError, while SOCKS
+// replies about the target (host unreachable etc.) are not wrapped that way.
+func IsProxyConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	switch opErr.Op {
+	case "proxyconnect":
+		return true
+	case "socks connect":
+		var inner *net.OpError
+		return errors.As(opErr.Err, &inner)
+	default:
+		return false
+	}
+}
+
+// GetProxyPoolHealth returns the health of every pooled proxy seen by this node.
+func GetProxyPoolHealth() []ProxyHealthStatus {
+	now := time.Now()
+	proxyPools.mutex.Lock()
+	statuses := make([]ProxyHealthStatus, 0, len(proxyPools.health))
+	for proxyURL, state := range proxyPools.health {
+		status := ProxyHealthStatus{
+			Proxy:               proxyDisplayName(proxyURL),
+			Healthy:             !now.Before(state.ejectedUntil),
+			ConsecutiveFailures: state.consecutiveFailures,
+			LastError:           state.lastError,
+		}
+		if !state.ejectedUntil.IsZero() {
+			status.EjectedUntil = state.ejectedUntil.Unix()
+		}
+		if !state.lastCheckedAt.IsZero() {
+			status.LastCheckedAt = state.lastCheckedAt.Unix()
+		}
+		statuses = append(statuses, status)
+	}
+	proxyPools.mutex.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Proxy < statuses[j].Proxy })
+	return statuses
+}
+
+// StartProxyPoolHealthCheck probes pooled proxies periodically on every node,
+// since each node has its own egress path to the proxies.
+func StartProxyPoolHealthCheck() {
+	proxyPoolHealthCheckOnce.Do(func() {
+		gopool.Go(func() {
+			for {
+				setting := system_setting.GetProxyPoolSetting()
+				interval := time.Duration(setting.HealthCheckIntervalSeconds) * time.Second
+				if interval <= 0 {
+					interval = 30 * time.Second
+				}
+				time.Sleep(interval)
+				pruneProxyPoolHealth()
+				if setting.HealthCheckEnabled {
+					runProxyPoolHealthCheck()
+				}
+			}
+		})
+	})
+}
+
+// pruneProxyPoolHealth forgets proxies removed from the shared pools or from
+// the channels' own pools since the configuration was last loaded.
+func pruneProxyPoolHealth() {
+	configured := make(map[string]struct{})
+	for _, pool := range system_setting.GetProxyPoolSetting().Pools {
+		for _, proxyURL := range normalizeProxyPoolMembers(pool.Proxies) {
+			configured[proxyURL] = struct{}{}
+		}
+	}
+	channels, err := model.GetChannelsWithProxyPool()
+	if err != nil {
+		common.SysLog("failed to load channel proxy pools: " + err.Error())
+		return
+	}
+	for _, channel := range channels {
+		var settings dto.ChannelSettings
+		if channel.Setting == nil || common.UnmarshalJsonStr(*channel.Setting, &settings) != nil || settings.ProxyPool == nil {
+			continue
+		}
+		for _, proxyURL := range normalizeProxyPoolMembers(settings.ProxyPool.Proxies) {
+			configured[proxyURL] = struct{}{}
+		}
+	}
+	proxyPools.prune(configured)
+}
+
+func runProxyPoolHealthCheck() {
+	setting := system_setting.GetProxyPoolSetting()
+	// Shared pools are checked even before the first request uses them.
+	for _, pool := range setting.Pools {
+		proxyPools.healthyMembers(normalizeProxyPoolMembers(pool.Proxies), time.Now())
+	}
+	timeout := time.Duration(setting.HealthCheckTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	var wg sync.WaitGroup
+	for _, proxyURL := range proxyPools.members() {
+		wg.Add(1)
+		proxyURL := proxyURL
+		gopool.Go(func() {
+			defer wg.Done()
+			proxyPools.record(proxyURL, probeProxy(proxyURL, timeout), time.Now(), true)
+		})
+	}
+	wg.Wait()
+}
+
+// proxyDialAddress returns host:port of the proxy, filling in the default port
+// of its scheme the same way the HTTP and SOCKS dialers do.
+func proxyDialAddress(parsedURL *url.URL) string {
+	if parsedURL.Port() != "" {
+		return parsedURL.Host
+	}
+	port := "80"
+	switch parsedURL.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(parsedURL.Hostname(), port)
+}
+
+// proxyDisplayName renders a proxy as scheme://host without credentials.
+func proxyDisplayName(proxyURL string) string {
+	parsedURL, _, err := common.ParseProxyURLRuntime(proxyURL)
+	if err != nil || parsedURL == nil {
+		return "invalid proxy"
+	}
+	return parsedURL.Scheme + "://" + parsedURL.Host
+}
+
+// probeProxy checks that the proxy endpoint accepts TCP connections.
+func probeProxy(proxyURL string, timeout time.Duration) error {
+	parsedURL, _, err := common.ParseProxyURLRuntime(proxyURL)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", proxyDialAddress(parsedURL), timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resetProxyPoolsForTest(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		proxyPools.mutex.Lock()
+		proxyPools.health = make(map[string]*proxyHealth)
+		proxyPools.counters = make(map[string]uint64)
+		proxyPools.mutex.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestResolveChannelProxyWithoutPool(t *testing.T) {
+	resetProxyPoolsForTest(t)
+
+	settings := dto.ChannelSettings{Proxy: "http://single.example:8080"}
+	assert.Equal(t, "http://single.example:8080", ResolveChannelProxy(1, settings, "sk-a"))
+	assert.Empty(t, GetProxyPoolHealth())
+}
+
+func TestResolveChannelProxyRoundRobin(t *testing.T) {
+	resetProxyPoolsForTest(t)
+
+	settings := dto.ChannelSettings{ProxyPool: &dto.ChannelProxyPool{
+		Proxies: []string{"http://a.example:8080", "http://b.example:8080", "http://c.example:8080"},
+	}}
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		seen[ResolveChannelProxy(7, settings, "sk-a")]++
+	}
+	assert.Equal(t, map[string]int{
+		"http://a.example:8080": 2,
+		"http://b.example:8080": 2,
+		"http://c.example:8080": 2,
+	}, seen)
+}
+
+func TestResolveChannelProxyStickyPerKey(t *testing.T) {
+	resetProxyPoolsForTest(t)
+
+	settings := dto.ChannelSettings{ProxyPool: &dto.ChannelProxyPool{
+		Proxies:  []string{"http://a.example:8080", "http://b.example:8080", "http://c.example:8080"},
+		Strategy: dto.ProxyPoolStrategySticky,
+	}}
+	first := ResolveChannelProxy(7, settings, "sk-a")
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, ResolveChannelProxy(7, settings, "sk-a"))
+	}
+}
+
+func TestProxyPoolEjectsFailingProxy(t *testing.T) {
+	resetProxyPoolsForTest(t)
+
+	setting := system_setting.GetProxyPoolSetting()
+	threshold, ejectSeconds := setting.FailureThreshold, setting.EjectDurationSeconds
+	setting.FailureThreshold, setting.EjectDurationSeconds = 2, 60
+	t.Cleanup(func() {
+		setting.FailureThreshold, setting.EjectDurationSeconds = threshold, ejectSeconds
+	})
+
+	settings := dto.ChannelSettings{ProxyPool: &dto.ChannelProxyPool{
+		Proxies:  []string{"http://a.example:8080", "http://b.example:8080"},
+		Strategy: dto.ProxyPoolStrategySticky,
+	}}
+	pinned := ResolveChannelProxy(7, settings, "sk-a")
+
+	ReportProxyResult(pinned, proxyConnectError())
+	assert.Equal(t, pinned, ResolveChannelProxy(7, settings, "sk-a"), "below threshold")
+	ReportProxyResult(pinned, proxyConnectError())
+
+	moved := ResolveChannelProxy(7, settings, "sk-a")
+	assert.NotEqual(t, pinned, moved, "ejected proxy is skipped")
+
+	// A successful health check restores the proxy before the ejection expires.
+	proxyPools.record(pinned, nil, time.Now(), true)
+	assert.Equal(t, pinned, ResolveChannelProxy(7, settings, "sk-a"))
+}
+
+func TestProxyPoolFailsOpenWhenAllEjected(t *testing.T) {
+	resetProxyPoolsForTest(t)
+
+	settings := dto.ChannelSettings{ProxyPool: &dto.ChannelProxyPool{Proxies: []string{"http://a.example:8080"}}}
+	require.Equal(t, "http://a.example:8080", ResolveChannelProxy(7, settings, ""))
+	for i := 0; i < 10; i++ {
+		ReportProxyResult("http://a.example:8080", proxyConnectError())
+	}
+	assert.Equal(t, "http://a.example:8080", ResolveChannelProxy(7, settings, ""))
+	health := GetProxyPoolHealth()
+	require.Len(t, health, 1)
+	assert.False(t, health[0].Healthy)
+}
+
+func proxyConnectError() error {
+	return &net.OpError{Op: "proxyconnect", Net: "tcp", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+}
+
+func TestProxyPoolIgnoresUpstreamErrors(t *testing.T) {
+	resetProxyPoolsForTest(t)
+
+	setting := system_setting.GetProxyPoolSetting()
+	threshold := setting.FailureThreshold
+	setting.FailureThreshold = 1
+	t.Cleanup(func() { setting.FailureThreshold = threshold })
+
+	settings := dto.ChannelSettings{ProxyPool: &dto.ChannelProxyPool{Proxies: []string{"http://a.example:8080", "http://b.example:8080"}}}
+	ResolveChannelProxy(7, settings, "")
+	for _, err := range []error{
+		context.DeadlineExceeded,
+		context.Canceled,
+		&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")},
+		&net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("host unreachable")},
+		errors.New("http2: server sent GOAWAY"),
+	} {
+		ReportProxyResult("http://a.example:8080", err)
+	}
+	for _, status := range GetProxyPoolHealth() {
+		assert.True(t, status.Healthy, status.Proxy)
+		assert.Zero(t, status.ConsecutiveFailures, status.Proxy)
+	}
+
+	assert.True(t, IsProxyConnectionError(&net.OpError{Op: "socks connect", Net: "tcp", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}))
+	ReportProxyResult("http://a.example:8080", proxyConnectError())
+	health := GetProxyPoolHealth()
+	require.Len(t, health, 2)
+	assert.False(t, health[0].Healthy)
+}
+
+func TestProbeProxy(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, probeProxy("http://"+addr, time.Second))
+	require.NoError(t, listener.Close())
+	require.Error(t, probeProxy("http://"+addr, time.Second))
+}
+
+func TestProxyDialAddressDefaultPorts(t *testing.T) {
+	for raw, want := range map[string]string{
+		"http://proxy.example":         "proxy.example:80",
+		"https://proxy.example":        "proxy.example:443",
+		"socks5://proxy.example":       "proxy.example:1080",
+		"socks5h://user:pw@proxy.test": "proxy.test:1080",
+		"socks5://proxy.example:9050":  "proxy.example:9050",
+	} {
+		parsedURL, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, want, proxyDialAddress(parsedURL), raw)
+	}
+}
+
+func TestPruneProxyPoolHealthDropsRemovedProxies(t *testing.T) {
+	truncate(t)
+	resetProxyPoolsForTest(t)
+
+	setting := system_setting.GetProxyPoolSetting()
+	pools := setting.Pools
+	setting.Pools = []system_setting.ProxyPool{{Name: "shared", Proxies: []string{"http://shared.example:8080"}}}
+	t.Cleanup(func() { setting.Pools = pools })
+	channelSetting := common.GetJsonString(dto.ChannelSettings{ProxyPool: &dto.ChannelProxyPool{Proxies: []string{" http://own.example:8080 "}}})
+	require.NoError(t, model.DB.Create(&model.Channel{Id: 1, Name: "pooled", Key: "sk-test", Setting: &channelSetting}).Error)
+
+	proxyPools.healthyMembers([]string{"http://shared.example:8080", "http://own.example:8080", "http://removed.example:8080"}, time.Now())
+	pruneProxyPoolHealth()
+
+	proxies := make([]string, 0)
+	for _, status := range GetProxyPoolHealth() {
+		proxies = append(proxies, status.Proxy)
+	}
+	assert.Equal(t, []string{"http://own.example:8080", "http://shared.example:8080"}, proxies)
+}
+
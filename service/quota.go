@@ -90,7 +90,14 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	var userQuota int
+	var err error
+	if relayInfo.OrgId > 0 {
+		// 组织令牌从组织钱包扣费
+		userQuota, err = model.GetOrganizationQuota(relayInfo.OrgId)
+	} else {
+		userQuota, err = model.GetUserQuota(relayInfo.UserId, false)
+	}
 	if err != nil {
 		return err
 	}
@@ -120,6 +127,9 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if ok {
 		actualGroupRatio = userGroupRatio
 	}
+	if relayInfo.ResellerMarkup > 0 {
+		actualGroupRatio *= relayInfo.ResellerMarkup
+	}
 
 	quotaInfo := QuotaInfo{
 		InputDetails: TokenDetails{
@@ -280,6 +290,9 @@ func CalcOpenRouterCacheCreateTokens(usage dto.Usage, priceData types.PriceData)
 }
 
 func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
+	if captureShadowTrafficUsage(ctx, relayInfo, usage) {
+		return
+	}
 
 	var tieredUsedVars map[string]bool
 	if snap := relayInfo.TieredBillingSnapshot; snap != nil {
@@ -391,8 +404,21 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if relayInfo.IsPlayground {
 		return nil
 	}
+	// 子令牌先占用自己的消费上限，父令牌预扣失败时归还
+	if relayInfo.DerivedTokenId != "" {
+		reserved, err := model.TryReserveDerivedTokenQuota(relayInfo.DerivedTokenId, quota)
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			return fmt.Errorf("derived token spend cap exceeded, need quota: %s", logger.FormatQuota(quota))
+		}
+	}
 	// 原子预扣：检查与扣减在同一操作中完成，并发请求不可能同时通过检查后超扣。
 	reserved, err := model.TryReserveTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota, relayInfo.TokenUnlimited)
+	if err != nil || !reserved {
+		adjustDerivedTokenQuota(relayInfo, -quota)
+	}
 	if err != nil {
 		return err
 	}
@@ -400,12 +426,29 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 		remainQuota := 0
 		if token, tokenErr := model.GetTokenByKey(relayInfo.TokenKey, false); tokenErr == nil && token != nil {
 			remainQuota = token.RemainQuota
+			// 剩余额度足够时，拒绝来自周期预算
+			if token.BudgetEnabled() && !token.BudgetSoftLimit && (relayInfo.TokenUnlimited || remainQuota >= quota) {
+				return fmt.Errorf("token %s budget exceeded, used: %s, budget: %s, need quota: %s, resets at %s",
+					token.BudgetPeriod, logger.FormatQuota(token.GetBudgetUsed()), logger.FormatQuota(token.BudgetQuota),
+					logger.FormatQuota(quota), token.BudgetResetTime().Format(time.RFC3339))
+			}
 		}
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(remainQuota), logger.FormatQuota(quota))
 	}
 	return nil
 }
 
+// adjustDerivedTokenQuota 同步子令牌的已用额度，子令牌的用量同时计入父令牌。
+func adjustDerivedTokenQuota(relayInfo *relaycommon.RelayInfo, delta int) {
+	if relayInfo == nil || relayInfo.DerivedTokenId == "" {
+		return
+	}
+	if err := model.AdjustDerivedTokenQuota(relayInfo.DerivedTokenId, delta); err != nil {
+		common.SysLog(fmt.Sprintf("error adjusting derived token quota (tokenId=%d, derivedTokenId=%s, delta=%d): %s",
+			relayInfo.TokenId, relayInfo.DerivedTokenId, delta, err.Error()))
+	}
+}
+
 type postConsumeQuotaResult struct {
 	FundingApplied bool
 	TokenApplied   bool
@@ -430,6 +473,10 @@ func postConsumeQuotaWithResult(relayInfo *relaycommon.RelayInfo, quota int, pre
 			}
 			relayInfo.SubscriptionPostDelta += delta
 		}
+	} else if relayInfo != nil && relayInfo.OrgId > 0 {
+		if err := model.AdjustOrganizationQuota(relayInfo.OrgId, relayInfo.UserId, quota); err != nil {
+			return result, err
+		}
 	} else {
 		// Wallet
 		if quota > 0 {
@@ -440,6 +487,7 @@ func postConsumeQuotaWithResult(relayInfo *relaycommon.RelayInfo, quota int, pre
 		if err != nil {
 			return result, err
 		}
+		settleResellerQuota(relayInfo.ResellerId, relayInfo.ResellerMarkup, quota)
 	}
 	result.FundingApplied = true
 
@@ -452,6 +500,7 @@ func postConsumeQuotaWithResult(relayInfo *relaycommon.RelayInfo, quota int, pre
 		if err != nil {
 			return result, err
 		}
+		adjustDerivedTokenQuota(relayInfo, quota)
 		result.TokenApplied = true
 	}
 
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// resellerQuota 返回子账户扣费额度对应的平台价，即转售商应支付的额度。
+// 子账户按 平台价 × 加价倍率 扣费，因此平台价 = 子账户扣费 ÷ 加价倍率。
+func resellerQuota(childQuota int, markup float64) int {
+	if markup <= 0 || markup == 1 {
+		return childQuota
+	}
+	return int(math.Round(float64(childQuota) / markup))
+}
+
+// adjustResellerQuota 子账户扣费的第二阶段：按平台价调整转售商的钱包额度
+// （正数扣费，负数退还）。与钱包结算一致，余额不足时记为欠费。
+func adjustResellerQuota(resellerId int, quota int) error {
+	if resellerId <= 0 || quota == 0 {
+		return nil
+	}
+	if quota > 0 {
+		return model.DecreaseUserQuota(resellerId, quota, false)
+	}
+	return model.IncreaseUserQuota(resellerId, -quota, false)
+}
+
+// settleResellerQuota 按子账户的扣费差额调整转售商额度，失败只记录日志，
+// 子账户的扣费已经提交，不能因为第二阶段失败而中断结算。
+func settleResellerQuota(resellerId int, markup float64, childDelta int) {
+	if resellerId <= 0 || childDelta == 0 {
+		return
+	}
+	if err := adjustResellerQuota(resellerId, resellerQuota(childDelta, markup)); err != nil {
+		common.SysLog(fmt.Sprintf("error settling reseller quota (resellerId=%d, childDelta=%d, markup=%f): %s",
+			resellerId, childDelta, markup, err.Error()))
+	}
+}
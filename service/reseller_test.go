@@ -0,0 +1,78 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedResellerChild(t *testing.T, resellerQuota int, childQuota int) *relaycommon.RelayInfo {
+	t.Helper()
+	require.NoError(t, model.DB.Create(&model.User{Id: 1, Username: "reseller", AffCode: "aff-reseller", Quota: resellerQuota, Status: common.UserStatusEnabled}).Error)
+	require.NoError(t, model.DB.Create(&model.User{Id: 2, Username: "child", AffCode: "aff-child", Quota: childQuota, ParentId: 1, Status: common.UserStatusEnabled}).Error)
+	seedToken(t, 1, 2, "child-token-key", 10000)
+	return &relaycommon.RelayInfo{UserId: 2, TokenId: 1, TokenKey: "child-token-key", ResellerId: 1, ResellerMarkup: 2, ForcePreConsume: true}
+}
+
+func TestResellerQuotaRounding(t *testing.T) {
+	assert.Equal(t, 100, resellerQuota(100, 0))
+	assert.Equal(t, 100, resellerQuota(100, 1))
+	assert.Equal(t, 50, resellerQuota(100, 2))
+	assert.Equal(t, 67, resellerQuota(100, 1.5))
+	assert.Equal(t, -50, resellerQuota(-100, 2))
+}
+
+func TestBillingSessionChargesResellerPlatformPrice(t *testing.T) {
+	truncate(t)
+	relayInfo := seedResellerChild(t, 1000, 5000)
+	relayInfo.UserSetting.BillingPreference = "subscription_first"
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	session, apiErr := NewBillingSession(c, relayInfo, 300)
+	require.Nil(t, apiErr)
+	assert.Equal(t, BillingSourceWallet, session.funding.Source(), "child accounts only use the wallet")
+	assert.Equal(t, 4700, getUserQuota(t, 2))
+	assert.Equal(t, 850, getUserQuota(t, 1))
+
+	require.NoError(t, session.Settle(501))
+	assert.Equal(t, 4499, getUserQuota(t, 2))
+	assert.Equal(t, 749, getUserQuota(t, 1), "reseller pays round(501 / 2)")
+
+	// 旧结算路径同样由转售商按平台价支付
+	require.NoError(t, PostConsumeQuota(relayInfo, 100, 0, false))
+	assert.Equal(t, 4399, getUserQuota(t, 2))
+	assert.Equal(t, 699, getUserQuota(t, 1))
+}
+
+func TestBillingSessionRejectsChildWhenResellerQuotaInsufficient(t *testing.T) {
+	truncate(t)
+	relayInfo := seedResellerChild(t, 100, 5000)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, apiErr := NewBillingSession(c, relayInfo, 300)
+	require.NotNil(t, apiErr)
+	assert.Contains(t, apiErr.Error(), "上级账户额度不足")
+	assert.Equal(t, 5000, getUserQuota(t, 2), "child pre-consume is rolled back")
+	assert.Equal(t, 100, getUserQuota(t, 1))
+	assert.Equal(t, 10000, getTokenRemainQuota(t, 1))
+}
+
+func TestGeminiCachedContentResellerSettlesAtCreationMarkup(t *testing.T) {
+	truncate(t)
+	seedResellerChild(t, 1000, 5000)
+
+	// 转售商当前没有加价，但缓存创建时的倍率为 2
+	cache := &model.GeminiCachedContent{UserId: 2, ResellerId: 1, ResellerMarkup: 2}
+	settleGeminiCachedContentReseller(cache, 300)
+	assert.Equal(t, 850, getUserQuota(t, 1))
+	settleGeminiCachedContentReseller(cache, -100)
+	assert.Equal(t, 900, getUserQuota(t, 1))
+}
+
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"gorm.io/gorm"
+)
+
+// SCIMDefaultGroup is the user group a SCIM user falls back to when it is
+// removed from its group.
+const SCIMDefaultGroup = "default"
+
+var ErrSCIMInvalidUserName = errors.New("scim userName is required")
+
+// SCIMUserAttributes are the user attributes an IdP can provision.
+type SCIMUserAttributes struct {
+	UserName    string
+	ExternalId  string
+	DisplayName string
+	Email       string
+	Active      bool
+}
+
+func (attrs *SCIMUserAttributes) normalize() error {
+	attrs.UserName = strings.TrimSpace(attrs.UserName)
+	attrs.ExternalId = strings.TrimSpace(attrs.ExternalId)
+	attrs.DisplayName = strings.TrimSpace(attrs.DisplayName)
+	attrs.Email = model.NormalizeEmail(attrs.Email)
+	if attrs.UserName == "" || len(attrs.UserName) > model.SCIMUserNameMaxLength || len(attrs.ExternalId) > model.SCIMUserNameMaxLength {
+		return ErrSCIMInvalidUserName
+	}
+	if attrs.DisplayName == "" {
+		attrs.DisplayName = attrs.UserName
+	}
+	return nil
+}
+
+// SCIMGroupNames returns the user groups exposed as SCIM groups.
+func SCIMGroupNames() []string {
+	groups := ratio_setting.GetGroupRatioCopy()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProvisionSCIMUser creates a local user for a SCIM identity. The local
+// username follows userName when it fits and is free, otherwise scim_<id>.
+// SCIM users have no local password and sign in through SSO.
+func ProvisionSCIMUser(attrs SCIMUserAttributes) (*model.User, *model.SCIMUser, error) {
+	if err := attrs.normalize(); err != nil {
+		return nil, nil, err
+	}
+	user := &model.User{
+		Username:    "scim_" + strconv.Itoa(model.GetMaxUserId()+1),
+		DisplayName: attrs.DisplayName,
+		Email:       attrs.Email,
+		Role:        common.RoleCommonUser,
+		Status:      common.UserStatusEnabled,
+	}
+	if !attrs.Active {
+		user.Status = common.UserStatusDisabled
+	}
+	if len(attrs.UserName) <= model.UserNameMaxLength {
+		if exists, err := model.CheckUserExistOrDeleted(attrs.UserName, ""); err == nil && !exists {
+			user.Username = attrs.UserName
+		}
+	}
+	scimUser := &model.SCIMUser{UserName: attrs.UserName, ExternalId: attrs.ExternalId}
+	err := model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := user.InsertWithTx(tx, 0); err != nil {
+			return err
+		}
+		scimUser.UserId = user.Id
+		return model.SaveSCIMUserWithTx(tx, scimUser)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	user.FinalizeOAuthUserCreation(0)
+	return user, scimUser, nil
+}
+
+// UpdateSCIMUser applies a full set of SCIM attributes to a provisioned user.
+// Setting active=false deprovisions the user; setting it back to true only
+// re-enables the account, tokens disabled at deprovisioning stay disabled.
+func UpdateSCIMUser(userId int, attrs SCIMUserAttributes) error {
+	if err := attrs.normalize(); err != nil {
+		return err
+	}
+	scimUser, err := model.GetSCIMUser(userId)
+	if err != nil {
+		return err
+	}
+	scimUser.UserName = attrs.UserName
+	scimUser.ExternalId = attrs.ExternalId
+	if err := model.DB.Transaction(func(tx *gorm.DB) error {
+		return model.SaveSCIMUserWithTx(tx, scimUser)
+	}); err != nil {
+		return err
+	}
+	if err := model.UpdateUserProfileFromIdentityProvider(userId, attrs.DisplayName, attrs.Email); err != nil {
+		return err
+	}
+	if !attrs.Active {
+		return DeprovisionUser(userId, "scim_deprovision")
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	if user.Status == common.UserStatusEnabled {
+		return nil
+	}
+	user.Status = common.UserStatusEnabled
+	return user.Update(false)
+}
+
+// DeprovisionUser disables a user and cuts off every credential at once: the
+// status change bumps the auth version, all sessions are revoked and all
+// tokens are disabled. It is idempotent so a retried request still revokes
+// anything issued in between. Root users cannot be deprovisioned.
+func DeprovisionUser(userId int, reason string) error {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	if user.Role == common.RoleRootUser {
+		return errors.New("root user cannot be deprovisioned")
+	}
+	if user.Status != common.UserStatusDisabled {
+		user.Status = common.UserStatusDisabled
+		if err := user.Update(false); err != nil {
+			return err
+		}
+	}
+	if _, err := model.RevokeAllUserSessions(userId, reason); err != nil {
+		return err
+	}
+	_, err = model.DisableUserTokens(userId)
+	return err
+}
+
+// DeleteSCIMUser deprovisions and soft-deletes a SCIM user and removes its
+// SCIM link, so the same userName can be provisioned again.
+func DeleteSCIMUser(userId int) error {
+	if err := DeprovisionUser(userId, "scim_delete"); err != nil {
+		return err
+	}
+	if err := model.DeleteUserById(userId); err != nil {
+		return err
+	}
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		return model.DeleteSCIMUserWithTx(tx, userId)
+	})
+}
+
+// SetSCIMUserGroup moves a user into group; the change revokes the user's
+// sessions like any other group change.
+func SetSCIMUserGroup(userId int, group string) error {
+	if !ratio_setting.ContainsGroupRatio(group) {
+		return fmt.Errorf("group %s does not exist", group)
+	}
+	_, err := model.UpdateUserGroupFromIdentityProvider(userId, group)
+	return err
+}
+
+// RemoveSCIMUserFromGroup moves a user back to the default group if it is
+// currently in group.
+func RemoveSCIMUserFromGroup(userId int, group string) error {
+	if group == SCIMDefaultGroup {
+		return nil
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	if user.Group != group {
+		return nil
+	}
+	_, err = model.UpdateUserGroupFromIdentityProvider(userId, SCIMDefaultGroup)
+	return err
+}
+
+// SCIMSSOIdentity is what an SSO login asserts about the user. It is matched
+// against SCIM users by the scim.sso_link_attribute setting.
+type SCIMSSOIdentity struct {
+	UserName      string
+	ExternalId    string
+	Email         string
+	EmailVerified bool
+}
+
+// findSCIMUserForSSO returns the id of the SCIM user identity links to, or
+// gorm.ErrRecordNotFound when linking is off or no single user matches.
+func findSCIMUserForSSO(identity SCIMSSOIdentity) (int, error) {
+	var query model.SCIMUserQuery
+	switch system_setting.GetSCIMSettings().SSOLinkAttribute {
+	case system_setting.SCIMSSOLinkUserName:
+		query.UserName = strings.TrimSpace(identity.UserName)
+	case system_setting.SCIMSSOLinkExternalId:
+		query.ExternalId = strings.TrimSpace(identity.ExternalId)
+	case system_setting.SCIMSSOLinkEmail:
+		// 只信任 IdP 已验证的邮箱，否则任何人都能用同名邮箱接管账号
+		if identity.EmailVerified {
+			query.Email = model.NormalizeEmail(identity.Email)
+		}
+	}
+	if query == (model.SCIMUserQuery{}) {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return model.FindSCIMUserId(query)
+}
+
+// LinkSCIMUserExternalIdentity claims provider/subject for the SCIM user the
+// identity links to and returns its id. A SCIM user already bound to another
+// subject of the same provider is not linked again.
+func LinkSCIMUserExternalIdentity(provider, subject string, identity SCIMSSOIdentity) (int, error) {
+	userId, err := findSCIMUserForSSO(identity)
+	if err != nil {
+		return 0, err
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		return model.ClaimExternalIdentityWithTx(tx, provider, subject, userId)
+	})
+	if errors.Is(err, model.ErrExternalIdentityAlreadyClaimed) {
+		return 0, gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userId, nil
+}
+
+// LinkSCIMUserOidcId binds oidcId to the SCIM user the identity links to,
+// unless that user is already bound to another OIDC account.
+func LinkSCIMUserOidcId(oidcId string, identity SCIMSSOIdentity) (int, error) {
+	userId, err := findSCIMUserForSSO(identity)
+	if err != nil {
+		return 0, err
+	}
+	bound, err := model.BindUserColumnIfEmpty(userId, "oidc_id", oidcId)
+	if err != nil {
+		return 0, err
+	}
+	if !bound {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return userId, nil
+}
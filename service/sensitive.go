@@ -2,10 +2,23 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
 	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
 )
 
 func CheckSensitiveMessages(messages []dto.Message) ([]string, error) {
@@ -17,7 +30,7 @@ func CheckSensitiveMessages(messages []dto.Message) ([]string, error) {
 		arrayContent := message.ParseContent()
 		for _, m := range arrayContent {
 			if m.Type == "image_url" {
-				// TODO: check image url
+				// 图片输入由 CheckImagePolicy 检查
 				continue
 			}
 			// 检查 text 是否为空
@@ -75,3 +88,299 @@ func SensitiveWordReplace(text string, returnImmediately bool) (bool, []string,
 	}
 	return false, nil, text
 }
+
+// sensitiveMask 替换命中的敏感词
+const sensitiveMask = "**###**"
+
+// sensitiveStreamPatternWindow is how many runes of streamed text are held
+// back for regex patterns, whose match length is unbounded. Matches longer
+// than this that span two deltas can be missed.
+const sensitiveStreamPatternWindow = 32
+
+var sensitivePatternCache sync.Map // pattern -> *regexp.Regexp
+
+type sensitiveMatch struct {
+	start int
+	end   int
+	word  string
+}
+
+// SensitiveMatcher combines the global word list and patterns with the extra
+// rules of one user group.
+type SensitiveMatcher struct {
+	words        []string
+	patterns     []*regexp.Regexp
+	maxWordRunes int
+}
+
+func NewSensitiveMatcher(group string) *SensitiveMatcher {
+	words := setting.SensitiveWords
+	patterns := setting.SensitivePatterns
+	if rule, ok := setting.GetSensitiveGroupRule(group); ok {
+		words = append(append([]string(nil), words...), rule.Words...)
+		patterns = append(append([]string(nil), patterns...), rule.Patterns...)
+	}
+	m := &SensitiveMatcher{}
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		m.words = append(m.words, word)
+		if n := utf8.RuneCountInString(word); n > m.maxWordRunes {
+			m.maxWordRunes = n
+		}
+	}
+	for _, pattern := range patterns {
+		re, err := compileSensitivePattern(pattern)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid sensitive pattern %s: %s", pattern, err.Error()))
+			continue
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m
+}
+
+func compileSensitivePattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := sensitivePatternCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sensitivePatternCache.Store(pattern, re)
+	return re, nil
+}
+
+// Empty reports whether the matcher has no word or pattern at all.
+func (m *SensitiveMatcher) Empty() bool {
+	return len(m.words) == 0 && len(m.patterns) == 0
+}
+
+// find returns the hits in text as byte offsets, ordered by start.
+func (m *SensitiveMatcher) find(text string) []sensitiveMatch {
+	if text == "" {
+		return nil
+	}
+	var matches []sensitiveMatch
+	if ac := getOrBuildAC(m.words); ac != nil {
+		runes := []rune(text)
+		offsets := make([]int, len(runes)+1)
+		lowered := make([]rune, len(runes))
+		pos := 0
+		for i, r := range runes {
+			offsets[i] = pos
+			pos += utf8.RuneLen(r)
+			lowered[i] = unicode.ToLower(r)
+		}
+		offsets[len(runes)] = pos
+		for _, hit := range ac.MultiPatternSearch(lowered, false) {
+			end := hit.Pos + len(hit.Word)
+			if hit.Pos < 0 || end > len(runes) {
+				continue
+			}
+			matches = append(matches, sensitiveMatch{start: offsets[hit.Pos], end: offsets[end], word: string(hit.Word)})
+		}
+	}
+	for _, re := range m.patterns {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			matches = append(matches, sensitiveMatch{start: loc[0], end: loc[1], word: text[loc[0]:loc[1]]})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	return matches
+}
+
+// Contains 是否包含敏感词，返回是否包含敏感词和敏感词列表
+func (m *SensitiveMatcher) Contains(text string) (bool, []string) {
+	matches := m.find(text)
+	if len(matches) == 0 {
+		return false, nil
+	}
+	words := make([]string, 0, len(matches))
+	for _, match := range matches {
+		words = append(words, match.word)
+	}
+	return true, RemoveDuplicate(words)
+}
+
+// Replace 敏感词替换，重叠的命中合并为一个替换
+func (m *SensitiveMatcher) Replace(text string) (string, []string) {
+	matches := m.find(text)
+	if len(matches) == 0 {
+		return text, nil
+	}
+	words := make([]string, 0, len(matches))
+	var builder strings.Builder
+	builder.Grow(len(text))
+	last := 0
+	for _, match := range matches {
+		words = append(words, match.word)
+		if match.end <= last {
+			continue
+		}
+		if match.start >= last {
+			builder.WriteString(text[last:match.start])
+			builder.WriteString(sensitiveMask)
+		}
+		last = match.end
+	}
+	builder.WriteString(text[last:])
+	return builder.String(), RemoveDuplicate(words)
+}
+
+// CheckSensitiveTextForGroup checks text against the global rules and the
+// rules of the user group.
+func CheckSensitiveTextForGroup(text string, group string) (bool, []string) {
+	return NewSensitiveMatcher(group).Contains(text)
+}
+
+// sensitiveResponseTextKeys are the response fields checked by the completion
+// filter; strings in arrays inherit the key of the array.
+var sensitiveResponseTextKeys = map[string]bool{
+	"content":           true,
+	"text":              true,
+	"reasoning_content": true,
+	"refusal":           true,
+	"arguments":         true,
+	"partial_json":      true,
+	"delta":             true,
+}
+
+// SensitiveCompletionFilter checks the completion returned to the client.
+// Streamed text is checked through a sliding window: the tail of each delta
+// that could still be the beginning of a word is held back until the next
+// delta arrives. In replace mode hits are masked; in abort mode the first hit
+// ends the response with an error.
+type SensitiveCompletionFilter struct {
+	relayFormat types.RelayFormat
+	matcher     *SensitiveMatcher
+	abort       bool
+	window      int
+	stream      *streamTextRewriter
+
+	hit     bool
+	blocked bool
+	// Words 命中的敏感词，去重
+	Words []string
+}
+
+func newSensitiveCompletionFilter(relayFormat types.RelayFormat, matcher *SensitiveMatcher, abort bool) *SensitiveCompletionFilter {
+	f := &SensitiveCompletionFilter{
+		relayFormat: relayFormat,
+		matcher:     matcher,
+		abort:       abort,
+		window:      matcher.maxWordRunes - 1,
+	}
+	if len(matcher.patterns) > 0 && f.window < sensitiveStreamPatternWindow {
+		f.window = sensitiveStreamPatternWindow
+	}
+	f.stream = newStreamTextRewriter(relayFormat, f.check, f.splitWindow)
+	return f
+}
+
+func (f *SensitiveCompletionFilter) check(text string, _ bool) string {
+	replaced, words := f.matcher.Replace(text)
+	if len(words) == 0 {
+		return text
+	}
+	f.hit = true
+	f.Words = RemoveDuplicate(append(f.Words, words...))
+	return replaced
+}
+
+func (f *SensitiveCompletionFilter) splitWindow(text string) (string, string) {
+	if f.window <= 0 {
+		return text, ""
+	}
+	n := utf8.RuneCountInString(text)
+	if n <= f.window {
+		return "", text
+	}
+	cut := len(text)
+	for i := 0; i < f.window; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:cut])
+		cut -= size
+	}
+	return text[:cut], text[cut:]
+}
+
+func (f *SensitiveCompletionFilter) checkJSON(data []byte) []byte {
+	if !gjson.ValidBytes(data) {
+		return []byte(f.check(string(data), false))
+	}
+	checked, err := rewriteJSONStrings(data, func(key string, value string) (string, bool) {
+		if !sensitiveResponseTextKeys[key] {
+			return value, false
+		}
+		checked := f.check(value, false)
+		return checked, checked != value
+	})
+	if err != nil {
+		return data
+	}
+	return checked
+}
+
+func (f *SensitiveCompletionFilter) abortError() *types.NewAPIError {
+	f.blocked = true
+	return types.NewErrorWithStatusCode(errors.New("sensitive words detected in completion"), types.ErrorCodeSensitiveWordsDetected, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+// Blocked reports whether the stream was aborted, in which case nothing else
+// may be sent.
+func (f *SensitiveCompletionFilter) Blocked() bool {
+	return f != nil && f.blocked
+}
+
+// FilterStreamChunk checks one SSE data payload. See
+// streamTextRewriter.RewriteChunk for the extra chunks it may return.
+func (f *SensitiveCompletionFilter) FilterStreamChunk(data []byte) ([][]byte, *types.NewAPIError) {
+	if f.blocked {
+		return nil, nil
+	}
+	chunks := f.stream.RewriteChunk(data)
+	for i := range chunks {
+		chunks[i] = f.checkJSON(chunks[i])
+	}
+	if f.hit && f.abort {
+		return nil, f.abortError()
+	}
+	return chunks, nil
+}
+
+// FilterResponse checks a non-stream response body.
+func (f *SensitiveCompletionFilter) FilterResponse(data []byte) ([]byte, *types.NewAPIError) {
+	data = f.checkJSON(data)
+	if f.hit && f.abort {
+		return nil, f.abortError()
+	}
+	return data, nil
+}
+
+// InitSensitiveCompletionFilter prepares the completion filter of the request
+// when completion checking is enabled.
+func InitSensitiveCompletionFilter(c *gin.Context, relayFormat types.RelayFormat) {
+	if !setting.ShouldCheckCompletionSensitive() {
+		return
+	}
+	switch relayFormat {
+	case types.RelayFormatOpenAI, types.RelayFormatOpenAIResponses, types.RelayFormatClaude, types.RelayFormatGemini:
+	default:
+		return
+	}
+	matcher := NewSensitiveMatcher(common.GetContextKeyString(c, constant.ContextKeyUserGroup))
+	if matcher.Empty() {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeySensitiveCompletionFilter, newSensitiveCompletionFilter(relayFormat, matcher, setting.StopOnSensitiveEnabled))
+}
+
+// GetSensitiveCompletionFilter returns the completion filter of the request,
+// or nil when completion checking is off.
+func GetSensitiveCompletionFilter(c *gin.Context) *SensitiveCompletionFilter {
+	filter, _ := common.GetContextKeyType[*SensitiveCompletionFilter](c, constant.ContextKeySensitiveCompletionFilter)
+	return filter
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func withSensitiveRules(t *testing.T, words []string, patterns []string, groupRules string) {
+	previousWords, previousPatterns := setting.SensitiveWords, setting.SensitivePatterns
+	previousGroupRules := setting.SensitiveGroupRules2JSONString()
+	setting.SensitiveWords = words
+	setting.SensitivePatterns = patterns
+	require.NoError(t, setting.UpdateSensitiveGroupRulesByJSONString(groupRules))
+	t.Cleanup(func() {
+		setting.SensitiveWords, setting.SensitivePatterns = previousWords, previousPatterns
+		_ = setting.UpdateSensitiveGroupRulesByJSONString(previousGroupRules)
+	})
+}
+
+func TestSensitiveMatcher(t *testing.T) {
+	withSensitiveRules(t, []string{"坏词", "BadWord"}, []string{`\d{3}-\d{4}`}, `{"vip":{"words":["内部代号"],"patterns":["PRJ-\\d{4}"]}}`)
+
+	m := NewSensitiveMatcher("default")
+	contains, words := m.Contains("这是坏词 and badword, call 555-1234")
+	require.True(t, contains)
+	require.ElementsMatch(t, []string{"坏词", "badword", "555-1234"}, words)
+
+	replaced, _ := m.Replace("前缀坏词后缀 BADWORD")
+	require.Equal(t, "前缀**###**后缀 **###**", replaced)
+
+	contains, _ = m.Contains("内部代号 PRJ-0001")
+	require.False(t, contains)
+	contains, words = CheckSensitiveTextForGroup("内部代号 PRJ-0001", "vip")
+	require.True(t, contains)
+	require.ElementsMatch(t, []string{"内部代号", "PRJ-0001"}, words)
+}
+
+func TestSensitiveCompletionFilterStream(t *testing.T) {
+	withSensitiveRules(t, []string{"forbidden"}, nil, `{}`)
+
+	// 替换模式：跨分片的敏感词也会被替换，保留的尾部在 finish_reason 时补发
+	f := newSensitiveCompletionFilter(types.RelayFormatOpenAI, NewSensitiveMatcher("default"), false)
+	chunks := []string{
+		`{"choices":[{"index":0,"delta":{"content":"this is forb"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"idden text"}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	}
+	var content string
+	for _, chunk := range chunks {
+		out, newAPIError := f.FilterStreamChunk([]byte(chunk))
+		require.Nil(t, newAPIError)
+		require.Len(t, out, 1)
+		for _, data := range out {
+			content += gjson.GetBytes(data, "choices.0.delta.content").String()
+		}
+	}
+	require.Equal(t, "this is **###** text", content)
+	require.Equal(t, []string{"forbidden"}, f.Words)
+
+	// 中止模式：命中后返回错误，之后的分片全部丢弃
+	f = newSensitiveCompletionFilter(types.RelayFormatOpenAI, NewSensitiveMatcher("default"), true)
+	out, newAPIError := f.FilterStreamChunk([]byte(chunks[0]))
+	require.Nil(t, newAPIError)
+	require.Len(t, out, 1)
+	_, newAPIError = f.FilterStreamChunk([]byte(chunks[1]))
+	require.NotNil(t, newAPIError)
+	require.Equal(t, types.ErrorCodeSensitiveWordsDetected, newAPIError.GetErrorCode())
+	require.True(t, f.Blocked())
+	out, newAPIError = f.FilterStreamChunk([]byte(chunks[2]))
+	require.Nil(t, newAPIError)
+	require.Empty(t, out)
+}
+
+func TestSensitiveCompletionFilterResponse(t *testing.T) {
+	withSensitiveRules(t, []string{"forbidden"}, nil, `{}`)
+
+	body := []byte(`{"content":[{"type":"thinking","thinking":"forbidden","signature":"x"},{"type":"text","text":"a forbidden word"}]}`)
+	f := newSensitiveCompletionFilter(types.RelayFormatClaude, NewSensitiveMatcher("default"), false)
+	out, newAPIError := f.FilterResponse(body)
+	require.Nil(t, newAPIError)
+	require.JSONEq(t, `{"content":[{"type":"thinking","thinking":"forbidden","signature":"x"},{"type":"text","text":"a **###** word"}]}`, string(out))
+
+	f = newSensitiveCompletionFilter(types.RelayFormatClaude, NewSensitiveMatcher("default"), true)
+	_, newAPIError = f.FilterResponse(body)
+	require.NotNil(t, newAPIError)
+}
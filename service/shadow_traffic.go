@@ -0,0 +1,245 @@
+package service
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/tidwall/gjson"
+)
+
+// MaxShadowTrafficResponseBytes caps how much of each response body is kept for diffing.
+const MaxShadowTrafficResponseBytes = 16 << 10
+
+// ShadowTrafficSample is attached to a primary request that was sampled for mirroring.
+type ShadowTrafficSample struct {
+	Rule     operation_setting.ShadowTrafficRule
+	response *shadowTrafficResponseWriter
+}
+
+// PrimaryResponse returns the captured client response, if the rule records diffs.
+func (s *ShadowTrafficSample) PrimaryResponse() []byte {
+	if s == nil || s.response == nil {
+		return nil
+	}
+	return s.response.body.Bytes()
+}
+
+// shadowTrafficResponseWriter 复制一份写给客户端的响应体（有上限），用于与影子渠道的响应对比。
+type shadowTrafficResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *shadowTrafficResponseWriter) Write(b []byte) (int, error) {
+	if remain := MaxShadowTrafficResponseBytes - w.body.Len(); remain > 0 {
+		if remain >= len(b) {
+			w.body.Write(b)
+		} else {
+			w.body.Write(b[:remain])
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *shadowTrafficResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+var shadowTrafficInFlight atomic.Int64
+
+// SampleShadowTraffic decides whether the current request is mirrored. It must
+// run before the primary relay so the client response can be captured for diffs.
+func SampleShadowTraffic(c *gin.Context, relayFormat types.RelayFormat, info *relaycommon.RelayInfo) *ShadowTrafficSample {
+	setting := operation_setting.GetShadowTrafficSetting()
+	if !setting.Enabled || info == nil || !isShadowTrafficFormat(relayFormat) {
+		return nil
+	}
+	for _, rule := range setting.Rules {
+		if !rule.Matches(info.UsingGroup, info.OriginModelName, info.TokenId) {
+			continue
+		}
+		if rand.Float64()*100 >= rule.Percentage {
+			return nil
+		}
+		sample := &ShadowTrafficSample{Rule: rule}
+		if rule.RecordResponseDiff {
+			sample.response = &shadowTrafficResponseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+			c.Writer = sample.response
+		}
+		common.SetContextKey(c, constant.ContextKeyShadowTraffic, sample)
+		return sample
+	}
+	return nil
+}
+
+// Realtime sessions and async tasks cannot be replayed from a single request body.
+func isShadowTrafficFormat(relayFormat types.RelayFormat) bool {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime, types.RelayFormatTask, types.RelayFormatMjProxy:
+		return false
+	}
+	return true
+}
+
+// AcquireShadowTrafficSlot reserves one of MaxConcurrency in-flight shadow calls.
+// Mirroring is best effort: when the limit is reached the sample is dropped.
+func AcquireShadowTrafficSlot() bool {
+	limit := int64(operation_setting.GetShadowTrafficSetting().MaxConcurrency)
+	if limit <= 0 {
+		limit = 16
+	}
+	if shadowTrafficInFlight.Add(1) > limit {
+		shadowTrafficInFlight.Add(-1)
+		return false
+	}
+	return true
+}
+
+func ReleaseShadowTrafficSlot() {
+	shadowTrafficInFlight.Add(-1)
+}
+
+// captureShadowTrafficUsage keeps the final usage of a mirrored primary call or
+// of a shadow call for comparison, and reports whether billing must be skipped.
+func captureShadowTrafficUsage(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) bool {
+	if relayInfo.IsShadowTraffic {
+		if usage != nil {
+			common.SetContextKey(ctx, constant.ContextKeyShadowTrafficUsage, *usage)
+		}
+		return true
+	}
+	if _, ok := ctx.Get(string(constant.ContextKeyShadowTraffic)); ok && usage != nil {
+		common.SetContextKey(ctx, constant.ContextKeyShadowTrafficUsage, *usage)
+	}
+	return false
+}
+
+// GetShadowTrafficUsage returns the usage captured by captureShadowTrafficUsage.
+func GetShadowTrafficUsage(c *gin.Context) (dto.Usage, bool) {
+	return common.GetContextKeyType[dto.Usage](c, constant.ContextKeyShadowTrafficUsage)
+}
+
+// ExtractShadowTrafficResponseText pulls the generated text out of a JSON or SSE
+// response so primary and shadow outputs can be diffed regardless of format.
+// Bodies without recognizable text are returned as-is.
+func ExtractShadowTrafficResponseText(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ""
+	}
+	if trimmed[0] == '{' {
+		if text := extractResponseTextFromJSON(trimmed, false); text != "" {
+			return truncateShadowTrafficText(text)
+		}
+		return truncateShadowTrafficText(string(trimmed))
+	}
+	var sb strings.Builder
+	for _, line := range bytes.Split(trimmed, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		payload := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if len(payload) == 0 || payload[0] != '{' {
+			continue
+		}
+		sb.WriteString(extractResponseTextFromJSON(payload, true))
+	}
+	if sb.Len() == 0 {
+		return truncateShadowTrafficText(string(trimmed))
+	}
+	return truncateShadowTrafficText(sb.String())
+}
+
+func extractResponseTextFromJSON(payload []byte, stream bool) string {
+	var paths []string
+	if stream {
+		paths = []string{
+			"choices.0.delta.content",           // OpenAI chat
+			"delta.text",                        // Claude content_block_delta
+			"candidates.0.content.parts.#.text", // Gemini
+			"delta",                             // Responses response.output_text.delta
+			"choices.0.text",                    // OpenAI completions
+		}
+	} else {
+		paths = []string{
+			"choices.0.message.content",
+			"content.#(type==\"text\")#.text",
+			"candidates.0.content.parts.#.text",
+			"output.#.content.#.text",
+			"choices.0.text",
+		}
+	}
+	for _, path := range paths {
+		result := gjson.GetBytes(payload, path)
+		if !result.Exists() {
+			continue
+		}
+		if result.IsArray() {
+			var sb strings.Builder
+			collectShadowTrafficText(result, &sb)
+			if sb.Len() > 0 {
+				return sb.String()
+			}
+			continue
+		}
+		if result.Type == gjson.String && result.String() != "" {
+			return result.String()
+		}
+	}
+	return ""
+}
+
+func collectShadowTrafficText(result gjson.Result, sb *strings.Builder) {
+	if result.IsArray() {
+		for _, item := range result.Array() {
+			collectShadowTrafficText(item, sb)
+		}
+		return
+	}
+	if result.Type == gjson.String {
+		sb.WriteString(result.String())
+	}
+}
+
+func truncateShadowTrafficText(text string) string {
+	if len(text) <= MaxShadowTrafficResponseBytes {
+		return text
+	}
+	cut := MaxShadowTrafficResponseBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
+
+// BuildShadowTrafficDiff renders a line-based unified diff between the primary
+// and shadow response texts. Identical outputs yield an empty diff.
+func BuildShadowTrafficDiff(primary string, shadow string) string {
+	if primary == shadow {
+		return ""
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(primary),
+		B:        difflib.SplitLines(shadow),
+		FromFile: "primary",
+		ToFile:   "shadow",
+		Context:  2,
+	})
+	if err != nil {
+		return ""
+	}
+	return truncateShadowTrafficText(diff)
+}
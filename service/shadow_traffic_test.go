@@ -0,0 +1,112 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withShadowTrafficSetting(t *testing.T, setting operation_setting.ShadowTrafficSetting) {
+	t.Helper()
+	current := operation_setting.GetShadowTrafficSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func TestSampleShadowTrafficMatchesRule(t *testing.T) {
+	withShadowTrafficSetting(t, operation_setting.ShadowTrafficSetting{
+		Enabled: true,
+		Rules: []operation_setting.ShadowTrafficRule{
+			{Name: "other-group", Enabled: true, Groups: []string{"vip"}, Percentage: 100, ShadowChannelId: 9},
+			{Name: "gpt", Enabled: true, Models: []string{"gpt-4o"}, Percentage: 100, ShadowChannelId: 7, RecordResponseDiff: true},
+		},
+	})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{UsingGroup: "default", OriginModelName: "gpt-4o", TokenId: 3}
+
+	sample := SampleShadowTraffic(c, types.RelayFormatOpenAI, info)
+	require.NotNil(t, sample)
+	assert.Equal(t, "gpt", sample.Rule.Name)
+
+	_, _ = c.Writer.WriteString(`{"choices":[{"message":{"content":"hello"}}]}`)
+	assert.Contains(t, string(sample.PrimaryResponse()), "hello")
+
+	assert.Nil(t, SampleShadowTraffic(c, types.RelayFormatOpenAIRealtime, info))
+	info.OriginModelName = "claude-sonnet"
+	assert.Nil(t, SampleShadowTraffic(c, types.RelayFormatOpenAI, info))
+}
+
+func TestSampleShadowTrafficDisabled(t *testing.T) {
+	withShadowTrafficSetting(t, operation_setting.ShadowTrafficSetting{
+		Enabled: false,
+		Rules:   []operation_setting.ShadowTrafficRule{{Name: "all", Enabled: true, Percentage: 100, ShadowChannelId: 7}},
+	})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.Nil(t, SampleShadowTraffic(c, types.RelayFormatOpenAI, &relaycommon.RelayInfo{}))
+}
+
+func TestCaptureShadowTrafficUsageSkipsBillingForShadow(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	usage := &dto.Usage{PromptTokens: 12, CompletionTokens: 34}
+
+	assert.False(t, captureShadowTrafficUsage(c, &relaycommon.RelayInfo{}, usage))
+	_, ok := GetShadowTrafficUsage(c)
+	assert.False(t, ok, "unsampled primary requests keep nothing")
+
+	common.SetContextKey(c, constant.ContextKeyShadowTraffic, &ShadowTrafficSample{})
+	assert.False(t, captureShadowTrafficUsage(c, &relaycommon.RelayInfo{}, usage))
+	captured, ok := GetShadowTrafficUsage(c)
+	require.True(t, ok)
+	assert.Equal(t, 34, captured.CompletionTokens)
+
+	shadow, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.True(t, captureShadowTrafficUsage(shadow, &relaycommon.RelayInfo{IsShadowTraffic: true}, usage))
+	captured, ok = GetShadowTrafficUsage(shadow)
+	require.True(t, ok)
+	assert.Equal(t, 12, captured.PromptTokens)
+}
+
+func TestExtractShadowTrafficResponseText(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "openai", body: `{"choices":[{"message":{"role":"assistant","content":"hi there"}}]}`, want: "hi there"},
+		{name: "claude", body: `{"content":[{"type":"thinking","thinking":"x"},{"type":"text","text":"a"},{"type":"text","text":"b"}]}`, want: "ab"},
+		{name: "gemini", body: `{"candidates":[{"content":{"parts":[{"text":"g1"},{"text":"g2"}]}}]}`, want: "g1g2"},
+		{name: "openai stream", body: "data: {\"choices\":[{\"delta\":{\"content\":\"he\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"llo\"}}]}\n\ndata: [DONE]\n", want: "hello"},
+		{name: "claude stream", body: "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"hey\"}}\n\nevent: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"}}\n", want: "hey"},
+		{name: "unknown json", body: `{"data":[1,2]}`, want: `{"data":[1,2]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExtractShadowTrafficResponseText([]byte(tt.body)))
+		})
+	}
+}
+
+func TestBuildShadowTrafficDiff(t *testing.T) {
+	assert.Empty(t, BuildShadowTrafficDiff("same\n", "same\n"))
+	diff := BuildShadowTrafficDiff("line one\nline two\n", "line one\nline 2\n")
+	assert.Contains(t, diff, "--- primary")
+	assert.Contains(t, diff, "-line two")
+	assert.Contains(t, diff, "+line 2")
+}
+
+func TestValidateShadowTrafficRules(t *testing.T) {
+	require.NoError(t, operation_setting.ValidateShadowTrafficRules(`[{"name":"a","shadow_channel_id":1,"percentage":5}]`))
+	assert.ErrorContains(t, operation_setting.ValidateShadowTrafficRules(`[{"name":"a","percentage":5}]`), "shadow_channel_id")
+	assert.ErrorContains(t, operation_setting.ValidateShadowTrafficRules(`[{"name":"a","shadow_channel_id":1,"percentage":120}]`), "between 0 and 100")
+	assert.ErrorContains(t, operation_setting.ValidateShadowTrafficRules(`[{"name":"a","shadow_channel_id":1},{"name":"a","shadow_channel_id":2}]`), "duplicate")
+}
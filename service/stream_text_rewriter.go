@@ -0,0 +1,386 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/relaykit/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// opaqueResponseKeys are response fields that must reach the client verbatim:
+// reasoning that is signed by the provider is replayed in later turns and
+// would fail verification if it were rewritten.
+var opaqueResponseKeys = map[string]bool{
+	"thinking":            true,
+	"signature":           true,
+	"thoughtSignature":    true,
+	"thought_signature":   true,
+	"encrypted_content":   true,
+	"redacted_thinking":   true,
+	"reasoning_opaque":    true,
+	"reasoning_encrypted": true,
+}
+
+// jsonTextKeys hold JSON documents serialized as strings (tool call
+// arguments), so text inserted into them has to be JSON escaped.
+var jsonTextKeys = map[string]bool{
+	"arguments":    true,
+	"partial_json": true,
+}
+
+type streamPending struct {
+	text    string
+	escaped bool
+}
+
+// streamTextRewriter rewrites the text deltas of an SSE stream in the client's
+// format. rewrite sees the text held back from the previous delta of the same
+// key joined with the new delta; split then decides which tail has to wait
+// for the next delta. Held-back text is flushed when its choice, candidate or
+// content block ends.
+type streamTextRewriter struct {
+	relayFormat types.RelayFormat
+	rewrite     func(text string, escaped bool) string
+	split       func(text string) (string, string)
+	pending     map[string]*streamPending
+}
+
+func newStreamTextRewriter(relayFormat types.RelayFormat, rewrite func(string, bool) string, split func(string) (string, string)) *streamTextRewriter {
+	return &streamTextRewriter{
+		relayFormat: relayFormat,
+		rewrite:     rewrite,
+		split:       split,
+		pending:     make(map[string]*streamPending),
+	}
+}
+
+// text rewrites one delta identified by key and returns the part that can be
+// sent now.
+func (s *streamTextRewriter) text(key string, text string, escaped bool, flush bool) string {
+	if pending, ok := s.pending[key]; ok {
+		text = pending.text + text
+		delete(s.pending, key)
+	}
+	text = s.rewrite(text, escaped)
+	if flush {
+		return text
+	}
+	text, hold := s.split(text)
+	if hold != "" {
+		s.pending[key] = &streamPending{text: hold, escaped: escaped}
+	}
+	return text
+}
+
+func (s *streamTextRewriter) hasPending(key string) bool {
+	_, ok := s.pending[key]
+	return ok
+}
+
+// setField rewrites the string at path in place.
+func (s *streamTextRewriter) setField(data []byte, key string, path string, escaped bool, flush bool) []byte {
+	value := gjson.GetBytes(data, path)
+	if value.Type != gjson.String && !(flush && s.hasPending(key)) {
+		return data
+	}
+	rewritten := s.text(key, value.String(), escaped, flush)
+	if value.Type != gjson.String && rewritten == "" {
+		return data
+	}
+	if updated, err := sjson.SetBytes(data, path, rewritten); err == nil {
+		return updated
+	}
+	return data
+}
+
+// RewriteChunk rewrites one SSE data payload. The result ends with the given
+// chunk and may start with extra chunks that flush held-back text at the end
+// of a Claude content block or a Responses output part.
+func (s *streamTextRewriter) RewriteChunk(data []byte) [][]byte {
+	var flushed [][]byte
+	switch s.relayFormat {
+	case types.RelayFormatOpenAI:
+		data = s.rewriteOpenAIChunk(data)
+	case types.RelayFormatGemini:
+		data = s.rewriteGeminiChunk(data)
+	case types.RelayFormatClaude:
+		flushed, data = s.rewriteClaudeChunk(data)
+	case types.RelayFormatOpenAIResponses:
+		flushed, data = s.rewriteResponsesChunk(data)
+	}
+	return append(flushed, data)
+}
+
+func (s *streamTextRewriter) rewriteOpenAIChunk(data []byte) []byte {
+	for i, choice := range gjson.GetBytes(data, "choices").Array() {
+		key := "choice:" + choice.Get("index").String()
+		finished := choice.Get("finish_reason").String() != ""
+		prefix := fmt.Sprintf("choices.%d.", i)
+		if choice.Get("text").Exists() {
+			// 旧版 completions
+			data = s.setField(data, key, prefix+"text", false, finished)
+			continue
+		}
+		data = s.setField(data, key, prefix+"delta.content", false, finished)
+		data = s.setField(data, key+":reasoning", prefix+"delta.reasoning_content", false, finished)
+		toolCalls := choice.Get("delta.tool_calls").Array()
+		for j, toolCall := range toolCalls {
+			toolKey := key + ":tool:" + toolCall.Get("index").String()
+			data = s.setField(data, toolKey, fmt.Sprintf("%sdelta.tool_calls.%d.function.arguments", prefix, j), true, finished)
+		}
+		if finished {
+			data = s.flushOpenAIToolCalls(data, key, prefix, len(toolCalls))
+		}
+	}
+	return data
+}
+
+// flushOpenAIToolCalls appends the held-back arguments of tool calls that do
+// not appear in the finishing chunk.
+func (s *streamTextRewriter) flushOpenAIToolCalls(data []byte, key string, prefix string, next int) []byte {
+	toolPrefix := key + ":tool:"
+	var indexes []string
+	for pendingKey := range s.pending {
+		if strings.HasPrefix(pendingKey, toolPrefix) {
+			indexes = append(indexes, strings.TrimPrefix(pendingKey, toolPrefix))
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return gjson.Parse(indexes[i]).Int() < gjson.Parse(indexes[j]).Int() })
+	for _, index := range indexes {
+		toolCall := map[string]interface{}{
+			"index":    gjson.Parse(index).Value(),
+			"function": map[string]string{"arguments": s.text(toolPrefix+index, "", true, true)},
+		}
+		if updated, err := sjson.SetBytes(data, fmt.Sprintf("%sdelta.tool_calls.%d", prefix, next), toolCall); err == nil {
+			data = updated
+			next++
+		}
+	}
+	return data
+}
+
+func (s *streamTextRewriter) rewriteGeminiChunk(data []byte) []byte {
+	for i, candidate := range gjson.GetBytes(data, "candidates").Array() {
+		key := fmt.Sprintf("candidate:%d", i)
+		lastTextPart := -1
+		for j, part := range candidate.Get("content.parts").Array() {
+			if part.Get("text").Type != gjson.String {
+				continue
+			}
+			data = s.setField(data, key, fmt.Sprintf("candidates.%d.content.parts.%d.text", i, j), false, false)
+			lastTextPart = j
+		}
+		if candidate.Get("finishReason").String() == "" || !s.hasPending(key) {
+			continue
+		}
+		rest := s.text(key, "", false, true)
+		if lastTextPart >= 0 {
+			path := fmt.Sprintf("candidates.%d.content.parts.%d.text", i, lastTextPart)
+			data, _ = sjson.SetBytes(data, path, gjson.GetBytes(data, path).String()+rest)
+		} else {
+			data, _ = sjson.SetBytes(data, fmt.Sprintf("candidates.%d.content.parts.-1", i), map[string]string{"text": rest})
+		}
+	}
+	return data
+}
+
+func (s *streamTextRewriter) rewriteClaudeChunk(data []byte) ([][]byte, []byte) {
+	key := "block:" + gjson.GetBytes(data, "index").String()
+	switch gjson.GetBytes(data, "type").String() {
+	case "content_block_delta":
+		switch gjson.GetBytes(data, "delta.type").String() {
+		case "text_delta":
+			data = s.setField(data, key, "delta.text", false, false)
+		case "input_json_delta":
+			data = s.setField(data, key, "delta.partial_json", true, false)
+		}
+	case "content_block_stop":
+		pending, ok := s.pending[key]
+		if !ok {
+			break
+		}
+		delta := map[string]string{"type": "text_delta"}
+		if pending.escaped {
+			delta["type"] = "input_json_delta"
+			delta["partial_json"] = s.text(key, "", true, true)
+		} else {
+			delta["text"] = s.text(key, "", false, true)
+		}
+		flush, err := common.Marshal(map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": gjson.GetBytes(data, "index").Int(),
+			"delta": delta,
+		})
+		if err == nil {
+			return [][]byte{flush}, data
+		}
+	}
+	return nil, data
+}
+
+func (s *streamTextRewriter) rewriteResponsesChunk(data []byte) ([][]byte, []byte) {
+	eventType := gjson.GetBytes(data, "type").String()
+	switch {
+	case strings.HasSuffix(eventType, ".delta"):
+		if gjson.GetBytes(data, "delta").Type == gjson.String {
+			data = s.setField(data, responsesStreamKey(data, eventType), "delta", strings.Contains(eventType, "arguments"), false)
+		}
+	case strings.HasSuffix(eventType, ".done"):
+		deltaType := strings.TrimSuffix(eventType, ".done") + ".delta"
+		key := responsesStreamKey(data, deltaType)
+		pending, ok := s.pending[key]
+		if !ok {
+			break
+		}
+		event := map[string]interface{}{
+			"type":  deltaType,
+			"delta": s.text(key, "", pending.escaped, true),
+		}
+		for _, field := range []string{"item_id", "output_index", "content_index", "summary_index"} {
+			if value := gjson.GetBytes(data, field); value.Exists() {
+				event[field] = value.Value()
+			}
+		}
+		if flush, err := common.Marshal(event); err == nil {
+			return [][]byte{flush}, data
+		}
+	}
+	return nil, data
+}
+
+func responsesStreamKey(data []byte, deltaType string) string {
+	return strings.Join([]string{
+		deltaType,
+		gjson.GetBytes(data, "item_id").String(),
+		gjson.GetBytes(data, "output_index").String(),
+		gjson.GetBytes(data, "content_index").String(),
+		gjson.GetBytes(data, "summary_index").String(),
+	}, ":")
+}
+
+// rewriteJSONStrings calls rewrite for every string value of a JSON document
+// with the nearest object key; strings inside arrays inherit the key of the
+// array, e.g. "input": ["..."]. Values for which rewrite reports no change are
+// left untouched.
+func rewriteJSONStrings(data []byte, rewrite func(key string, value string) (string, bool)) ([]byte, error) {
+	type edit struct {
+		path  string
+		value string
+	}
+	var edits []edit
+	var walk func(value gjson.Result, path string, key string)
+	walk = func(value gjson.Result, path string, key string) {
+		switch {
+		case value.IsObject():
+			value.ForEach(func(k, v gjson.Result) bool {
+				walk(v, joinJSONPath(path, escapeJSONPathKey(k.String())), k.String())
+				return true
+			})
+		case value.IsArray():
+			for i, item := range value.Array() {
+				walk(item, joinJSONPath(path, fmt.Sprintf("%d", i)), key)
+			}
+		case value.Type == gjson.String:
+			if rewritten, changed := rewrite(key, value.Str); changed {
+				edits = append(edits, edit{path: path, value: rewritten})
+			}
+		}
+	}
+	walk(gjson.ParseBytes(data), "", "")
+
+	var err error
+	for _, e := range edits {
+		data, err = sjson.SetBytes(data, e.path, e.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func joinJSONPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func escapeJSONPathKey(key string) string {
+	var builder strings.Builder
+	for _, ch := range key {
+		switch ch {
+		case '.', '*', '?', '|', '#', '@', '\\', '!', '=', '<', '>', '%':
+			builder.WriteByte('\\')
+		}
+		builder.WriteRune(ch)
+	}
+	return builder.String()
+}
+
+// RewriteStreamChunk applies the gateway's response rewrites to one SSE data
+// payload before it is sent: PII placeholders are restored first, then the
+// completion sensitive-word filter runs. A non-nil error replaces the chunk
+// and ends the stream.
+func RewriteStreamChunk(c *gin.Context, data string) ([]string, *types.NewAPIError) {
+	chunks := [][]byte{[]byte(data)}
+	if redaction := GetPIIRedaction(c); redaction.Detected() {
+		chunks = redaction.RestoreStreamChunk(chunks[0])
+	}
+	if filter := GetSensitiveCompletionFilter(c); filter != nil {
+		var filtered [][]byte
+		for _, chunk := range chunks {
+			result, newAPIError := filter.FilterStreamChunk(chunk)
+			if newAPIError != nil {
+				return nil, newAPIError
+			}
+			filtered = append(filtered, result...)
+		}
+		chunks = filtered
+	}
+	result := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		result = append(result, string(chunk))
+	}
+	return result, nil
+}
+
+// StreamBlocked reports whether the completion filter aborted the stream.
+func StreamBlocked(c *gin.Context) bool {
+	return GetSensitiveCompletionFilter(c).Blocked()
+}
+
+// RewriteResponseBody is the non-stream counterpart of RewriteStreamChunk;
+// the post-response guardrail hooks run last.
+func RewriteResponseBody(c *gin.Context, data []byte) ([]byte, *types.NewAPIError) {
+	if redaction := GetPIIRedaction(c); redaction.Detected() {
+		data = redaction.RestoreJSON(data)
+	}
+	if filter := GetSensitiveCompletionFilter(c); filter != nil {
+		var newAPIError *types.NewAPIError
+		if data, newAPIError = filter.FilterResponse(data); newAPIError != nil {
+			return nil, newAPIError
+		}
+	}
+	if g := GetGuardrail(c); g != nil {
+		return g.FilterResponse(c.Request.Context(), data)
+	}
+	return data, nil
+}
+
+// responseRelayFormat returns the client format a rewritten response error is
+// rendered in.
+func responseRelayFormat(c *gin.Context) types.RelayFormat {
+	if filter := GetSensitiveCompletionFilter(c); filter != nil {
+		return filter.relayFormat
+	}
+	if g := GetGuardrail(c); g != nil {
+		return g.relayFormat
+	}
+	return types.RelayFormatOpenAI
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// InjectSystemPrompt prepends prompt to the system instructions of a raw
+// request body in the given inbound format, keeping any system prompt the
+// client already sent.
+func InjectSystemPrompt(body []byte, relayFormat types.RelayFormat, prompt string) ([]byte, error) {
+	switch relayFormat {
+	case types.RelayFormatOpenAI:
+		messages := gjson.GetBytes(body, "messages")
+		if !messages.IsArray() {
+			return nil, errors.New("request has no messages")
+		}
+		systemMessage, err := common.Marshal(map[string]string{"role": "system", "content": prompt})
+		if err != nil {
+			return nil, err
+		}
+		return sjson.SetRawBytes(body, "messages", insertRawArray(messages, 0, systemMessage))
+	case types.RelayFormatOpenAIResponses:
+		if existing := gjson.GetBytes(body, "instructions").String(); existing != "" {
+			prompt = prompt + "\n\n" + existing
+		}
+		return sjson.SetBytes(body, "instructions", prompt)
+	case types.RelayFormatClaude:
+		system := gjson.GetBytes(body, "system")
+		if system.IsArray() {
+			block, err := common.Marshal(map[string]string{"type": "text", "text": prompt})
+			if err != nil {
+				return nil, err
+			}
+			return sjson.SetRawBytes(body, "system", insertRawArray(system, 0, block))
+		}
+		if existing := system.String(); existing != "" {
+			prompt = prompt + "\n\n" + existing
+		}
+		return sjson.SetBytes(body, "system", prompt)
+	case types.RelayFormatGemini:
+		path := geminiSystemInstructionPath(body)
+		part, err := common.Marshal(map[string]string{"text": prompt})
+		if err != nil {
+			return nil, err
+		}
+		return sjson.SetRawBytes(body, path+".parts", insertRawArray(gjson.GetBytes(body, path+".parts"), 0, part))
+	default:
+		return nil, fmt.Errorf("system prompt injection is not supported for %s requests", relayFormat)
+	}
+}
+
+// AppendSystemPrompt is the counterpart of InjectSystemPrompt that adds suffix
+// after the system instructions. For OpenAI chat it becomes a system message
+// placed right after the leading system/developer messages.
+func AppendSystemPrompt(body []byte, relayFormat types.RelayFormat, suffix string) ([]byte, error) {
+	switch relayFormat {
+	case types.RelayFormatOpenAI:
+		messages := gjson.GetBytes(body, "messages")
+		if !messages.IsArray() {
+			return nil, errors.New("request has no messages")
+		}
+		index := 0
+		for _, message := range messages.Array() {
+			role := message.Get("role").String()
+			if role != "system" && role != "developer" {
+				break
+			}
+			index++
+		}
+		systemMessage, err := common.Marshal(map[string]string{"role": "system", "content": suffix})
+		if err != nil {
+			return nil, err
+		}
+		return sjson.SetRawBytes(body, "messages", insertRawArray(messages, index, systemMessage))
+	case types.RelayFormatOpenAIResponses:
+		if existing := gjson.GetBytes(body, "instructions").String(); existing != "" {
+			suffix = existing + "\n\n" + suffix
+		}
+		return sjson.SetBytes(body, "instructions", suffix)
+	case types.RelayFormatClaude:
+		system := gjson.GetBytes(body, "system")
+		if system.IsArray() {
+			block, err := common.Marshal(map[string]string{"type": "text", "text": suffix})
+			if err != nil {
+				return nil, err
+			}
+			return sjson.SetRawBytes(body, "system", insertRawArray(system, len(system.Array()), block))
+		}
+		if existing := system.String(); existing != "" {
+			suffix = existing + "\n\n" + suffix
+		}
+		return sjson.SetBytes(body, "system", suffix)
+	case types.RelayFormatGemini:
+		path := geminiSystemInstructionPath(body)
+		parts := gjson.GetBytes(body, path+".parts")
+		part, err := common.Marshal(map[string]string{"text": suffix})
+		if err != nil {
+			return nil, err
+		}
+		return sjson.SetRawBytes(body, path+".parts", insertRawArray(parts, len(parts.Array()), part))
+	default:
+		return nil, fmt.Errorf("system prompt injection is not supported for %s requests", relayFormat)
+	}
+}
+
+func geminiSystemInstructionPath(body []byte) string {
+	if !gjson.GetBytes(body, "systemInstruction").Exists() && gjson.GetBytes(body, "system_instruction").Exists() {
+		return "system_instruction"
+	}
+	return "systemInstruction"
+}
+
+func insertRawArray(array gjson.Result, index int, item []byte) []byte {
+	raws := make([]string, 0, len(array.Array())+1)
+	for _, element := range array.Array() {
+		raws = append(raws, element.Raw)
+	}
+	raws = append(raws[:index], append([]string{string(item)}, raws[index:]...)...)
+	return []byte("[" + strings.Join(raws, ",") + "]")
+}
+
+func joinSystemPrompts(prompts ...string) string {
+	nonEmpty := make([]string, 0, len(prompts))
+	for _, prompt := range prompts {
+		if strings.TrimSpace(prompt) != "" {
+			nonEmpty = append(nonEmpty, prompt)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
+
+// ApplySystemPromptInjection adds the system prompts configured on the user
+// group and on the token to the raw request body, before it is parsed and
+// converted. The group prompt wraps the token prompt:
+//
+//	group prompt, token prompt, <client system prompt>, token suffix, group suffix
+//
+// Requests without chat-style system instructions (embeddings, legacy
+// completions, ...) are left untouched.
+func ApplySystemPromptInjection(c *gin.Context, relayFormat types.RelayFormat) *types.NewAPIError {
+	groupPrompt, _ := model_setting.GetGroupSystemPrompt(common.GetContextKeyString(c, constant.ContextKeyUserGroup))
+	tokenPrompt := common.GetContextKeyString(c, constant.ContextKeyTokenSystemPrompt)
+	tokenSuffix := common.GetContextKeyString(c, constant.ContextKeyTokenSystemSuffix)
+	prefix := joinSystemPrompts(groupPrompt.Prompt, tokenPrompt)
+	suffix := joinSystemPrompts(tokenSuffix, groupPrompt.Suffix)
+	if prefix == "" && suffix == "" {
+		return nil
+	}
+	switch relayFormat {
+	case types.RelayFormatOpenAI, types.RelayFormatOpenAIResponses, types.RelayFormatClaude, types.RelayFormatGemini:
+	default:
+		return nil
+	}
+
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return nil
+	}
+	if relayFormat == types.RelayFormatOpenAI && !gjson.GetBytes(body, "messages").IsArray() {
+		return nil
+	}
+	if relayFormat == types.RelayFormatGemini && !gjson.GetBytes(body, "contents").Exists() {
+		// embedContent/countTokens 等没有系统指令
+		return nil
+	}
+
+	if prefix != "" {
+		body, err = InjectSystemPrompt(body, relayFormat, prefix)
+	}
+	if err == nil && suffix != "" {
+		body, err = AppendSystemPrompt(body, relayFormat, suffix)
+	}
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	common.CleanupBodyStorage(c)
+	c.Set(common.KeyRequestBody, body)
+
+	sources := make([]string, 0, 2)
+	if groupPrompt.Prompt != "" || groupPrompt.Suffix != "" {
+		sources = append(sources, "group")
+	}
+	if tokenPrompt != "" || tokenSuffix != "" {
+		sources = append(sources, "token")
+	}
+	common.SetContextKey(c, constant.ContextKeySystemPromptInjected, sources)
+	return nil
+}
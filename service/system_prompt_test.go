@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relaykit/types"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectSystemPrompt(t *testing.T) {
+	cases := []struct {
+		name   string
+		format types.RelayFormat
+		body   string
+		want   string
+	}{
+		{"openai chat", types.RelayFormatOpenAI,
+			`{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`,
+			`{"messages":[{"role":"system","content":"P"},{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`},
+		{"responses", types.RelayFormatOpenAIResponses, `{"input":"hi","instructions":"be brief"}`, `{"input":"hi","instructions":"P\n\nbe brief"}`},
+		{"claude string", types.RelayFormatClaude, `{"messages":[]}`, `{"messages":[],"system":"P"}`},
+		{"claude blocks", types.RelayFormatClaude,
+			`{"system":[{"type":"text","text":"be brief"}]}`,
+			`{"system":[{"type":"text","text":"P"},{"type":"text","text":"be brief"}]}`},
+		{"gemini", types.RelayFormatGemini, `{"contents":[]}`, `{"contents":[],"systemInstruction":{"parts":[{"text":"P"}]}}`},
+		{"gemini snake case", types.RelayFormatGemini,
+			`{"system_instruction":{"parts":[{"text":"be brief"}]}}`,
+			`{"system_instruction":{"parts":[{"text":"P"},{"text":"be brief"}]}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := InjectSystemPrompt([]byte(tc.body), tc.format, "P")
+			require.NoError(t, err)
+			require.JSONEq(t, tc.want, string(out))
+		})
+	}
+
+	_, err := InjectSystemPrompt([]byte(`{}`), types.RelayFormatEmbedding, "P")
+	require.Error(t, err)
+}
+
+func TestAppendSystemPrompt(t *testing.T) {
+	cases := []struct {
+		name   string
+		format types.RelayFormat
+		body   string
+		want   string
+	}{
+		{"openai chat", types.RelayFormatOpenAI,
+			`{"messages":[{"role":"system","content":"be brief"},{"role":"developer","content":"d"},{"role":"user","content":"hi"}]}`,
+			`{"messages":[{"role":"system","content":"be brief"},{"role":"developer","content":"d"},{"role":"system","content":"S"},{"role":"user","content":"hi"}]}`},
+		{"openai chat without system", types.RelayFormatOpenAI,
+			`{"messages":[{"role":"user","content":"hi"}]}`,
+			`{"messages":[{"role":"system","content":"S"},{"role":"user","content":"hi"}]}`},
+		{"responses", types.RelayFormatOpenAIResponses, `{"input":"hi","instructions":"be brief"}`, `{"input":"hi","instructions":"be brief\n\nS"}`},
+		{"claude string", types.RelayFormatClaude, `{"system":"be brief"}`, `{"system":"be brief\n\nS"}`},
+		{"claude blocks", types.RelayFormatClaude,
+			`{"system":[{"type":"text","text":"be brief"}]}`,
+			`{"system":[{"type":"text","text":"be brief"},{"type":"text","text":"S"}]}`},
+		{"gemini", types.RelayFormatGemini,
+			`{"contents":[],"systemInstruction":{"parts":[{"text":"be brief"}]}}`,
+			`{"contents":[],"systemInstruction":{"parts":[{"text":"be brief"},{"text":"S"}]}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := AppendSystemPrompt([]byte(tc.body), tc.format, "S")
+			require.NoError(t, err)
+			require.JSONEq(t, tc.want, string(out))
+		})
+	}
+}
+
+func TestApplySystemPromptInjection(t *testing.T) {
+	settings := model_setting.GetSystemPromptSettings()
+	previousGroups := settings.Groups
+	settings.Groups = map[string]model_setting.GroupSystemPrompt{
+		"vip": {Prompt: "group prefix", Suffix: "group suffix"},
+	}
+	t.Cleanup(func() { settings.Groups = previousGroups })
+
+	run := func(group, tokenPrompt, tokenSuffix string, format types.RelayFormat, body string) (*gin.Context, string) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		c.Set(common.KeyRequestBody, []byte(body))
+		common.SetContextKey(c, constant.ContextKeyUserGroup, group)
+		if tokenPrompt != "" {
+			common.SetContextKey(c, constant.ContextKeyTokenSystemPrompt, tokenPrompt)
+		}
+		if tokenSuffix != "" {
+			common.SetContextKey(c, constant.ContextKeyTokenSystemSuffix, tokenSuffix)
+		}
+		require.Nil(t, ApplySystemPromptInjection(c, format))
+		storage, err := common.GetBodyStorage(c)
+		require.NoError(t, err)
+		out, err := storage.Bytes()
+		require.NoError(t, err)
+		return c, string(out)
+	}
+
+	// 分组包裹令牌：分组前缀、令牌前缀、客户端系统提示词、令牌后缀、分组后缀
+	c, out := run("vip", "token prefix", "token suffix", types.RelayFormatClaude, `{"system":"client","messages":[]}`)
+	require.JSONEq(t, `{"system":"group prefix\n\ntoken prefix\n\nclient\n\ntoken suffix\n\ngroup suffix","messages":[]}`, out)
+	require.Equal(t, []string{"group", "token"}, common.GetContextKeyStringSlice(c, constant.ContextKeySystemPromptInjected))
+
+	c, out = run("default", "token prefix", "", types.RelayFormatOpenAI, `{"messages":[{"role":"user","content":"hi"}]}`)
+	require.JSONEq(t, `{"messages":[{"role":"system","content":"token prefix"},{"role":"user","content":"hi"}]}`, out)
+	require.Equal(t, []string{"token"}, common.GetContextKeyStringSlice(c, constant.ContextKeySystemPromptInjected))
+
+	// 没有配置或不支持系统提示词的请求保持原样
+	c, out = run("default", "", "", types.RelayFormatOpenAI, `{"messages":[]}`)
+	require.JSONEq(t, `{"messages":[]}`, out)
+	require.Empty(t, common.GetContextKeyStringSlice(c, constant.ContextKeySystemPromptInjected))
+	_, out = run("vip", "", "", types.RelayFormatOpenAI, `{"prompt":"hi"}`)
+	require.JSONEq(t, `{"prompt":"hi"}`, out)
+	_, out = run("vip", "", "", types.RelayFormatEmbedding, `{"input":"hi"}`)
+	require.JSONEq(t, `{"input":"hi"}`, out)
+}
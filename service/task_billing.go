@@ -86,15 +86,25 @@ func taskIsSubscription(task *model.Task) bool {
 	return task.PrivateData.BillingSource == BillingSourceSubscription && task.PrivateData.SubscriptionId > 0
 }
 
-// taskAdjustFunding 调整任务的资金来源（钱包或订阅），delta > 0 表示扣费，delta < 0 表示退还。
+// taskAdjustFunding 调整任务的资金来源（钱包、订阅或组织钱包），delta > 0 表示扣费，delta < 0 表示退还。
 func taskAdjustFunding(task *model.Task, delta int) error {
 	if taskIsSubscription(task) {
 		return model.PostConsumeUserSubscriptionDelta(task.PrivateData.SubscriptionId, int64(delta))
 	}
+	if task.PrivateData.BillingSource == BillingSourceOrganization && task.PrivateData.OrgId > 0 {
+		return model.AdjustOrganizationQuota(task.PrivateData.OrgId, task.UserId, delta)
+	}
+	var err error
 	if delta > 0 {
-		return model.DecreaseUserQuota(task.UserId, delta, false)
+		err = model.DecreaseUserQuota(task.UserId, delta, false)
+	} else {
+		err = model.IncreaseUserQuota(task.UserId, -delta, false)
 	}
-	return model.IncreaseUserQuota(task.UserId, -delta, false)
+	if err != nil {
+		return err
+	}
+	settleResellerQuota(task.PrivateData.ResellerId, task.PrivateData.ResellerMarkup, delta)
+	return nil
 }
 
 // taskAdjustTokenQuota 调整任务的令牌额度，delta > 0 表示扣费，delta < 0 表示退还。
@@ -318,6 +328,9 @@ func RecalculateTaskQuotaByTokens(ctx context.Context, task *model.Task, totalTo
 	} else {
 		finalGroupRatio = groupRatio
 	}
+	if task.PrivateData.ResellerMarkup > 0 {
+		finalGroupRatio *= task.PrivateData.ResellerMarkup
+	}
 
 	// 计算 OtherRatios 乘积（视频折扣、时长等）
 	otherMultiplier := 1.0
@@ -35,6 +35,10 @@ func TestMain(m *testing.M) {
 	model.LOG_DB = db
 
 	common.SetDatabaseTypes(common.DatabaseTypeSQLite, common.DatabaseTypeSQLite)
+	// 未设置 LOG_SQL_DSN 时只复用主库并初始化列名（如 key、group）
+	if err := model.InitLogDB(); err != nil {
+		panic("failed to init log db: " + err.Error())
+	}
 	common.RedisEnabled = false
 	common.BatchUpdateEnabled = false
 	common.LogConsumeEnabled = true
@@ -43,6 +47,10 @@ func TestMain(m *testing.M) {
 		&model.Task{},
 		&model.User{},
 		&model.Token{},
+		&model.DerivedToken{},
+		&model.Organization{},
+		&model.OrganizationMember{},
+		&model.Reseller{},
 		&model.Log{},
 		&model.Channel{},
 		&model.Midjourney{},
@@ -67,6 +75,10 @@ func truncate(t *testing.T) {
 		model.DB.Exec("DELETE FROM tasks")
 		model.DB.Exec("DELETE FROM users")
 		model.DB.Exec("DELETE FROM tokens")
+		model.DB.Exec("DELETE FROM derived_tokens")
+		model.DB.Exec("DELETE FROM organizations")
+		model.DB.Exec("DELETE FROM organization_members")
+		model.DB.Exec("DELETE FROM resellers")
 		model.DB.Exec("DELETE FROM logs")
 		model.DB.Exec("DELETE FROM channels")
 		model.DB.Exec("DELETE FROM midjourneys")
@@ -395,6 +395,9 @@ func usageSemanticFromUsage(relayInfo *relaycommon.RelayInfo, usage *dto.Usage)
 }
 
 func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent []string) {
+	if captureShadowTrafficUsage(ctx, relayInfo, usage) {
+		return
+	}
 	originUsage := usage
 	billingUsage := effectiveBillingUsage(usage)
 	if usage == nil {
@@ -517,6 +520,9 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 		// prompt/cache fields here, otherwise old upstream payloads may be double-counted.
 		other["input_tokens_total"] = billingUsage.InputTokens
 	}
+	if relayInfo.AutoCacheBreakpoints > 0 {
+		other["auto_cache_control"] = autoCacheControlLogInfo(relayInfo, summary, cacheWriteTokens)
+	}
 	if tieredBillingApplied {
 		InjectTieredBillingInfo(other, relayInfo, tieredResult)
 	}
@@ -541,3 +547,22 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 		perfmetrics.RecordRelaySample(relayInfo, true, int64(summary.CompletionTokens))
 	})
 }
+
+// autoCacheControlLogInfo reports what the automatically inserted cache
+// breakpoints saved: cache reads cost less than fresh input, cache writes cost
+// more, so the net figure can be negative on the request that fills the cache.
+func autoCacheControlLogInfo(relayInfo *relaycommon.RelayInfo, summary textQuotaSummary, cacheWriteTokens int) map[string]interface{} {
+	info := map[string]interface{}{
+		"breakpoints":        relayInfo.AutoCacheBreakpoints,
+		"cache_read_tokens":  summary.CacheTokens,
+		"cache_write_tokens": cacheWriteTokens,
+	}
+	if relayInfo.PriceData.UsePrice {
+		return info
+	}
+	readSaving := decimal.NewFromInt(int64(summary.CacheTokens)).Mul(decimal.NewFromFloat(1 - summary.CacheRatio))
+	writeCost := decimal.NewFromInt(int64(cacheWriteTokens)).Mul(decimal.NewFromFloat(summary.CacheCreationRatio - 1))
+	saved := readSaving.Sub(writeCost).Mul(decimal.NewFromFloat(summary.ModelRatio)).Mul(decimal.NewFromFloat(summary.GroupRatio))
+	info["saved_quota"] = saved.Round(0).IntPart()
+	return info
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+)
+
+const (
+	tokenBudgetBatchSize              = 200
+	tokenBudgetDefaultIntervalMinutes = 10
+)
+
+// tokenBudgetHandler rolls token budget periods over at their reset time and
+// notifies token owners whose period usage reached the alert threshold. Reserve
+// also rolls an ended period lazily, so a late run never blocks requests; the
+// task keeps budget_used accurate for idle tokens and delivers the alerts.
+type tokenBudgetHandler struct{}
+
+type TokenBudgetResult struct {
+	Scanned int `json:"scanned"`
+	Rolled  int `json:"rolled"`
+	Alerted int `json:"alerted"`
+}
+
+func (tokenBudgetHandler) Type() string { return model.SystemTaskTypeTokenBudget }
+
+func (tokenBudgetHandler) Enabled() bool {
+	if !common.GetEnvOrDefaultBool("TOKEN_BUDGET_TASK_ENABLED", true) {
+		return false
+	}
+	enabled, err := model.HasTokenBudgets()
+	return err == nil && enabled
+}
+
+func (tokenBudgetHandler) Interval() time.Duration {
+	intervalMinutes := common.GetEnvOrDefault("TOKEN_BUDGET_TASK_INTERVAL_MINUTES", tokenBudgetDefaultIntervalMinutes)
+	if intervalMinutes < 1 {
+		intervalMinutes = tokenBudgetDefaultIntervalMinutes
+	}
+	return time.Duration(intervalMinutes) * time.Minute
+}
+
+func (tokenBudgetHandler) NewPayload() any { return nil }
+
+func (tokenBudgetHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	result, err := runTokenBudgetMaintenance(ctx, time.Now(), NewSystemTaskProgressReporter(task, runnerID))
+	if err != nil {
+		failSystemTask(task, runnerID, err)
+		return
+	}
+	if err := model.FinishSystemTask(task.TaskID, runnerID, model.SystemTaskStatusSucceeded, result, ""); err != nil {
+		logSystemTaskLockError(ctx, task, err)
+	}
+}
+
+func init() {
+	RegisterSystemTaskHandler(tokenBudgetHandler{})
+}
+
+func runTokenBudgetMaintenance(ctx context.Context, now time.Time, report func(processed, total int)) (*TokenBudgetResult, error) {
+	total, err := model.CountTokenBudgets()
+	if err != nil {
+		return nil, err
+	}
+	result := &TokenBudgetResult{}
+	lastId := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		nextId, scanned, rolled, alerts, err := model.TokenBudgetMaintenanceBatch(lastId, tokenBudgetBatchSize, now)
+		result.Scanned += scanned
+		result.Rolled += rolled
+		result.Alerted += len(alerts)
+		for i := range alerts {
+			notifyTokenBudgetAlert(&alerts[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+		if int64(result.Scanned) > total {
+			total = int64(result.Scanned)
+		}
+		report(result.Scanned, int(total))
+		if scanned < tokenBudgetBatchSize {
+			break
+		}
+		lastId = nextId
+	}
+	report(result.Scanned, result.Scanned)
+	return result, nil
+}
+
+func notifyTokenBudgetAlert(token *model.Token) {
+	user, err := model.GetUserById(token.UserId, false)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to load user %d for token budget notify: %s", token.UserId, err.Error()))
+		return
+	}
+	userSetting := user.GetSetting()
+	used := token.GetBudgetUsed()
+	percent := used * 100 / token.BudgetQuota
+	prompt := fmt.Sprintf("令牌 %s 的周期预算已使用 %d%%", token.Name, percent)
+	resetAt := token.BudgetResetTime().Format("2006-01-02 15:04:05 MST")
+
+	var content string
+	var values []interface{}
+	notifyType := userSetting.NotifyType
+	if notifyType == "" {
+		notifyType = dto.NotifyTypeEmail
+	}
+	if notifyType == dto.NotifyTypeBark || notifyType == dto.NotifyTypeGotify {
+		content = "{{value}}，已用 {{value}} / {{value}}，{{value}} 重置"
+		values = []interface{}{prompt, logger.FormatQuota(used), logger.FormatQuota(token.BudgetQuota), resetAt}
+	} else {
+		content = "{{value}}，本周期已用 {{value}}，预算 {{value}}，将于 {{value}} 重置。{{value}}"
+		action := "超出预算后该令牌的请求将被拒绝。"
+		if token.BudgetSoftLimit {
+			action = "超出预算后该令牌仍可继续使用。"
+		}
+		values = []interface{}{prompt, logger.FormatQuota(used), logger.FormatQuota(token.BudgetQuota), resetAt, action}
+	}
+	if err := NotifyUser(user.Id, user.Email, userSetting, dto.NewNotify(dto.NotifyTypeTokenBudget, prompt, content, values)); err != nil {
+		common.SysError(fmt.Sprintf("failed to send token budget notify to user %d: %s", user.Id, err.Error()))
+	}
+}
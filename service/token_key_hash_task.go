@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+const tokenKeyHashBatchSize = 200
+
+// tokenKeyHashHandler migrates tokens created before keys were stored hashed:
+// each plaintext key is replaced by its salted hash and display prefix. The
+// task only runs when an admin starts it, because the users of these tokens
+// lose the ability to view their keys again.
+type tokenKeyHashHandler struct{}
+
+type TokenKeyHashResult struct {
+	Scanned int `json:"scanned"`
+	Hashed  int `json:"hashed"`
+}
+
+func (tokenKeyHashHandler) Type() string { return model.SystemTaskTypeTokenKeyHash }
+
+func (tokenKeyHashHandler) Run(ctx context.Context, task *model.SystemTask, runnerID string) {
+	result, err := runTokenKeyHashMigration(ctx, NewSystemTaskProgressReporter(task, runnerID))
+	if err != nil {
+		failSystemTask(task, runnerID, err)
+		return
+	}
+	if err := model.FinishSystemTask(task.TaskID, runnerID, model.SystemTaskStatusSucceeded, result, ""); err != nil {
+		logSystemTaskLockError(ctx, task, err)
+	}
+}
+
+func init() {
+	RegisterSystemTaskHandler(tokenKeyHashHandler{})
+}
+
+func runTokenKeyHashMigration(ctx context.Context, report func(processed, total int)) (*TokenKeyHashResult, error) {
+	total, err := model.CountAllTokens()
+	if err != nil {
+		return nil, err
+	}
+	result := &TokenKeyHashResult{}
+	lastId := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		nextId, scanned, hashed, err := model.HashLegacyTokenKeysBatch(lastId, tokenKeyHashBatchSize)
+		result.Scanned += scanned
+		result.Hashed += hashed
+		if err != nil {
+			return nil, err
+		}
+		if int64(result.Scanned) > total {
+			total = int64(result.Scanned)
+		}
+		report(result.Scanned, int(total))
+		if scanned < tokenKeyHashBatchSize {
+			break
+		}
+		lastId = nextId
+	}
+	report(result.Scanned, result.Scanned)
+	return result, nil
+}
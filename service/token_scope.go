@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTokenScopes returns the scopes of the token that authenticated the request,
+// or nil when the token is unrestricted.
+func GetTokenScopes(c *gin.Context) *model.TokenScopes {
+	scopes, ok := common.GetContextKeyType[*model.TokenScopes](c, constant.ContextKeyTokenScopes)
+	if !ok || scopes.IsEmpty() {
+		return nil
+	}
+	return scopes
+}
+
+// TokenScopeEndpoint maps a relay request path to the endpoint category used by
+// token scopes. It returns "" for paths that are not relay endpoints.
+func TokenScopeEndpoint(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/v1beta/cachedContents"):
+		// 上下文缓存只能被 Gemini 对话接口引用
+		return model.TokenScopeEndpointGemini
+	case strings.HasPrefix(path, "/v1/messages"):
+		return model.TokenScopeEndpointMessages
+	case strings.Contains(path, "/mj/"):
+		return model.TokenScopeEndpointMidjourney
+	case strings.HasPrefix(path, "/suno/"):
+		return model.TokenScopeEndpointSuno
+	case strings.HasPrefix(path, "/v1/video"), strings.HasPrefix(path, "/kling/"), strings.HasPrefix(path, "/jimeng"):
+		return model.TokenScopeEndpointVideo
+	case strings.HasPrefix(path, "/v1/engines/"):
+		return model.TokenScopeEndpointEmbeddings
+	}
+	switch relayconstant.Path2RelayMode(path) {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions:
+		return model.TokenScopeEndpointChat
+	case relayconstant.RelayModeEmbeddings:
+		return model.TokenScopeEndpointEmbeddings
+	case relayconstant.RelayModeModerations:
+		return model.TokenScopeEndpointModerations
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeEdits:
+		return model.TokenScopeEndpointImages
+	case relayconstant.RelayModeAudioSpeech, relayconstant.RelayModeAudioTranscription, relayconstant.RelayModeAudioTranslation:
+		return model.TokenScopeEndpointAudio
+	case relayconstant.RelayModeRerank:
+		return model.TokenScopeEndpointRerank
+	case relayconstant.RelayModeRealtime:
+		return model.TokenScopeEndpointRealtime
+	case relayconstant.RelayModeResponses, relayconstant.RelayModeResponsesCompact:
+		return model.TokenScopeEndpointResponses
+	case relayconstant.RelayModeAlphaSearch:
+		return model.TokenScopeEndpointSearch
+	case relayconstant.RelayModeGemini:
+		// Gemini 的向量接口与对话接口共用 /models/{model}:{action} 路径
+		if strings.Contains(path, ":embedContent") || strings.Contains(path, ":batchEmbedContents") {
+			return model.TokenScopeEndpointEmbeddings
+		}
+		return model.TokenScopeEndpointGemini
+	}
+	return ""
+}
+
+// CheckTokenScopeEndpoint returns the endpoint category of the request path and
+// whether the token scopes allow it. Disabling web search also denies the
+// standalone search endpoint. A token with an endpoint allow-list cannot call
+// paths that map to no category; the path itself is returned as the endpoint.
+func CheckTokenScopeEndpoint(scopes *model.TokenScopes, path string) (string, bool) {
+	if scopes == nil {
+		return "", true
+	}
+	endpoint := TokenScopeEndpoint(path)
+	if endpoint == "" {
+		return path, len(scopes.Endpoints) == 0
+	}
+	if !scopes.AllowsEndpoint(endpoint) || (endpoint == model.TokenScopeEndpointSearch && scopes.DisableWebSearch) {
+		return endpoint, false
+	}
+	return endpoint, true
+}
+
+func tokenScopeError(format string, args ...interface{}) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(fmt.Errorf(format, args...), types.ErrorCodeTokenScopeViolation, http.StatusForbidden, types.ErrOptionWithSkipRetry())
+}
+
+// TokenScopesNeedRequestMeta reports whether CheckTokenScopeRequest needs the
+// full token count meta (image inputs, max_tokens of every format) instead of
+// the pricing-only one.
+func TokenScopesNeedRequestMeta(c *gin.Context) bool {
+	scopes := GetTokenScopes(c)
+	return scopes != nil && (scopes.DisableImageInput || scopes.MaxTokens > 0)
+}
+
+// CheckTokenScopeRequest checks the parsed request against the token scopes:
+// max_tokens, tool definitions, web search and image inputs.
+func CheckTokenScopeRequest(c *gin.Context, request dto.Request, meta *types.TokenCountMeta) *types.NewAPIError {
+	scopes := GetTokenScopes(c)
+	if scopes == nil {
+		return nil
+	}
+	if scopes.MaxTokens > 0 && meta != nil && meta.MaxTokens > scopes.MaxTokens {
+		return tokenScopeError("max_tokens %d exceeds the limit of this token (%d)", meta.MaxTokens, scopes.MaxTokens)
+	}
+	if scopes.DisableTools || scopes.DisableWebSearch {
+		hasTools, hasWebSearch := inspectRequestTools(request)
+		if scopes.DisableWebSearch && hasWebSearch {
+			return tokenScopeError("web search is not allowed for this token")
+		}
+		if scopes.DisableTools && hasTools {
+			return tokenScopeError("tools are not allowed for this token")
+		}
+	}
+	if scopes.DisableImageInput && meta != nil {
+		for _, file := range meta.Files {
+			if file != nil && file.FileType == types.FileTypeImage {
+				return tokenScopeError("image inputs are not allowed for this token")
+			}
+		}
+	}
+	return nil
+}
+
+// CheckTokenScopeCost rejects a request whose estimated cost (the quota that is
+// about to be pre-consumed) exceeds the per-request limit of the token.
+func CheckTokenScopeCost(c *gin.Context, quota int) *types.NewAPIError {
+	scopes := GetTokenScopes(c)
+	if scopes == nil || scopes.MaxRequestQuota <= 0 || quota <= scopes.MaxRequestQuota {
+		return nil
+	}
+	return tokenScopeError("estimated cost %s exceeds the per-request limit of this token (%s)",
+		logger.FormatQuota(quota), logger.FormatQuota(scopes.MaxRequestQuota))
+}
+
+// inspectRequestTools reports whether the request carries tool definitions and
+// whether any of them (or a request option) enables web search.
+func inspectRequestTools(request dto.Request) (hasTools bool, hasWebSearch bool) {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		hasTools = len(r.Tools) > 0 || len(r.Functions) > 0
+		hasWebSearch = r.WebSearchOptions != nil || len(r.WebSearch) > 0 ||
+			strings.HasSuffix(r.Model, "search-preview")
+	case *dto.OpenAIResponsesRequest:
+		var tools []map[string]any
+		if len(r.Tools) > 0 && common.Unmarshal(r.Tools, &tools) == nil {
+			hasTools = len(tools) > 0
+			for _, tool := range tools {
+				if isWebSearchToolType(tool["type"]) {
+					hasWebSearch = true
+				}
+			}
+		}
+	case *dto.ClaudeRequest:
+		tools := r.GetTools()
+		hasTools = len(tools) > 0
+		for _, tool := range tools {
+			switch t := tool.(type) {
+			case map[string]any:
+				hasWebSearch = hasWebSearch || isWebSearchToolType(t["type"])
+			case *dto.ClaudeWebSearchTool, dto.ClaudeWebSearchTool:
+				hasWebSearch = true
+			}
+		}
+	case *dto.GeminiChatRequest:
+		tools := r.GetTools()
+		hasTools = len(tools) > 0
+		for _, tool := range tools {
+			if tool.GoogleSearch != nil || tool.GoogleSearchRetrieval != nil {
+				hasWebSearch = true
+			}
+		}
+	}
+	return hasTools, hasWebSearch
+}
+
+func isWebSearchToolType(value any) bool {
+	toolType, _ := value.(string)
+	return strings.HasPrefix(toolType, dto.BuildInToolWebSearch)
+}
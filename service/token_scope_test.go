@@ -0,0 +1,138 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relaykit/dto"
+	"github.com/QuantumNous/new-api/relaykit/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenScopeContext(scopes *model.TokenScopes) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if scopes != nil {
+		common.SetContextKey(c, constant.ContextKeyTokenScopes, scopes)
+	}
+	return c
+}
+
+func TestTokenScopeEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"/v1/chat/completions":                           model.TokenScopeEndpointChat,
+		"/v1/completions":                                model.TokenScopeEndpointChat,
+		"/v1/messages":                                   model.TokenScopeEndpointMessages,
+		"/v1/responses":                                  model.TokenScopeEndpointResponses,
+		"/v1/responses/compact":                          model.TokenScopeEndpointResponses,
+		"/v1/embeddings":                                 model.TokenScopeEndpointEmbeddings,
+		"/v1/engines/text-embedding-004/embeddings":      model.TokenScopeEndpointEmbeddings,
+		"/v1beta/models/gemini-2.5-pro:generateContent":  model.TokenScopeEndpointGemini,
+		"/v1beta/models/text-embedding-004:embedContent": model.TokenScopeEndpointEmbeddings,
+		"/v1/images/generations":                         model.TokenScopeEndpointImages,
+		"/v1/images/edits":                               model.TokenScopeEndpointImages,
+		"/v1/audio/speech":                               model.TokenScopeEndpointAudio,
+		"/v1/rerank":                                     model.TokenScopeEndpointRerank,
+		"/v1/realtime":                                   model.TokenScopeEndpointRealtime,
+		"/v1/alpha/search":                               model.TokenScopeEndpointSearch,
+		"/mj/submit/imagine":                             model.TokenScopeEndpointMidjourney,
+		"/fast/mj/submit/imagine":                        model.TokenScopeEndpointMidjourney,
+		"/suno/submit/music":                             model.TokenScopeEndpointSuno,
+		"/v1/video/generations":                          model.TokenScopeEndpointVideo,
+		"/kling/v1/videos/text2video":                    model.TokenScopeEndpointVideo,
+		"/v1beta/cachedContents":                         model.TokenScopeEndpointGemini,
+		"/v1beta/cachedContents/abc":                     model.TokenScopeEndpointGemini,
+		"/v1/files":                                      "",
+	}
+	for path, expected := range cases {
+		require.Equal(t, expected, TokenScopeEndpoint(path), path)
+	}
+}
+
+func TestCheckTokenScopeEndpoint(t *testing.T) {
+	embeddingsOnly := &model.TokenScopes{Endpoints: []string{model.TokenScopeEndpointEmbeddings}}
+	_, allowed := CheckTokenScopeEndpoint(embeddingsOnly, "/v1/embeddings")
+	require.True(t, allowed)
+	endpoint, allowed := CheckTokenScopeEndpoint(embeddingsOnly, "/v1/chat/completions")
+	require.False(t, allowed)
+	require.Equal(t, model.TokenScopeEndpointChat, endpoint)
+	_, allowed = CheckTokenScopeEndpoint(embeddingsOnly, "/v1beta/cachedContents")
+	require.False(t, allowed)
+	// 白名单令牌不能调用未归类的接口
+	endpoint, allowed = CheckTokenScopeEndpoint(embeddingsOnly, "/v1/files")
+	require.False(t, allowed)
+	require.Equal(t, "/v1/files", endpoint)
+
+	noImages := &model.TokenScopes{DeniedEndpoints: []string{model.TokenScopeEndpointImages}}
+	_, allowed = CheckTokenScopeEndpoint(noImages, "/v1/images/generations")
+	require.False(t, allowed)
+	_, allowed = CheckTokenScopeEndpoint(noImages, "/v1/chat/completions")
+	require.True(t, allowed)
+	_, allowed = CheckTokenScopeEndpoint(noImages, "/v1/files")
+	require.True(t, allowed)
+
+	noSearch := &model.TokenScopes{DisableWebSearch: true}
+	_, allowed = CheckTokenScopeEndpoint(noSearch, "/v1/alpha/search")
+	require.False(t, allowed)
+
+	_, allowed = CheckTokenScopeEndpoint(nil, "/v1/images/generations")
+	require.True(t, allowed)
+}
+
+func TestCheckTokenScopeRequest(t *testing.T) {
+	maxTokens := uint(2048)
+	openaiRequest := &dto.GeneralOpenAIRequest{
+		Model:     "gpt-4o",
+		MaxTokens: &maxTokens,
+		Tools:     []dto.ToolCallRequest{{Type: "function"}},
+	}
+
+	c := newTokenScopeContext(&model.TokenScopes{MaxTokens: 1024})
+	err := CheckTokenScopeRequest(c, openaiRequest, openaiRequest.GetTokenCountMeta())
+	require.NotNil(t, err)
+	require.Equal(t, types.ErrorCodeTokenScopeViolation, err.GetErrorCode())
+	require.Equal(t, http.StatusForbidden, err.StatusCode)
+
+	c = newTokenScopeContext(&model.TokenScopes{MaxTokens: 4096, DisableTools: true})
+	require.NotNil(t, CheckTokenScopeRequest(c, openaiRequest, openaiRequest.GetTokenCountMeta()))
+
+	c = newTokenScopeContext(&model.TokenScopes{DisableWebSearch: true})
+	require.Nil(t, CheckTokenScopeRequest(c, openaiRequest, openaiRequest.GetTokenCountMeta()))
+
+	responsesRequest := &dto.OpenAIResponsesRequest{
+		Model: "gpt-4o",
+		Tools: json.RawMessage(`[{"type":"web_search_preview"}]`),
+	}
+	require.NotNil(t, CheckTokenScopeRequest(c, responsesRequest, responsesRequest.GetTokenCountMeta()))
+
+	claudeRequest := &dto.ClaudeRequest{Model: "claude-sonnet-4"}
+	require.NoError(t, common.Unmarshal([]byte(`{"model":"claude-sonnet-4","tools":[{"type":"web_search_20250305","name":"web_search"}]}`), claudeRequest))
+	require.NotNil(t, CheckTokenScopeRequest(c, claudeRequest, claudeRequest.GetTokenCountMeta()))
+
+	c = newTokenScopeContext(&model.TokenScopes{DisableImageInput: true})
+	meta := &types.TokenCountMeta{Files: []*types.FileMeta{{FileType: types.FileTypeImage}}}
+	require.NotNil(t, CheckTokenScopeRequest(c, openaiRequest, meta))
+	require.Nil(t, CheckTokenScopeRequest(c, openaiRequest, &types.TokenCountMeta{}))
+
+	// 未设置权限范围的令牌不受限制
+	c = newTokenScopeContext(nil)
+	require.Nil(t, CheckTokenScopeRequest(c, openaiRequest, meta))
+}
+
+func TestCheckTokenScopeCost(t *testing.T) {
+	c := newTokenScopeContext(&model.TokenScopes{MaxRequestQuota: 1000})
+	require.Nil(t, CheckTokenScopeCost(c, 1000))
+	err := CheckTokenScopeCost(c, 1001)
+	require.NotNil(t, err)
+	require.Equal(t, types.ErrorCodeTokenScopeViolation, err.GetErrorCode())
+
+	c = newTokenScopeContext(&model.TokenScopes{MaxTokens: 100})
+	require.Nil(t, CheckTokenScopeCost(c, 1000000))
+}
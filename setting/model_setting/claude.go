@@ -21,6 +21,10 @@ type ClaudeSettings struct {
 	DefaultMaxTokens                      map[string]int                 `json:"default_max_tokens"`
 	ThinkingAdapterEnabled                bool                           `json:"thinking_adapter_enabled"`
 	ThinkingAdapterBudgetTokensPercentage float64                        `json:"thinking_adapter_budget_tokens_percentage"`
+	// 转换为 Claude 请求时自动插入 cache_control 的分组，渠道级配置优先
+	AutoCacheControlGroups    []string `json:"auto_cache_control_groups"`
+	AutoCacheControlMinTokens int      `json:"auto_cache_control_min_tokens"`
+	AutoCacheControlTTL       string   `json:"auto_cache_control_ttl"`
 }
 
 // 默认配置
@@ -31,6 +35,9 @@ var defaultClaudeSettings = ClaudeSettings{
 		"default": 8192,
 	},
 	ThinkingAdapterBudgetTokensPercentage: 0.8,
+	AutoCacheControlGroups:                []string{},
+	AutoCacheControlMinTokens:             1024,
+	AutoCacheControlTTL:                   "5m",
 }
 
 // 全局实例
@@ -109,3 +116,17 @@ func ValidateClaudeDefaultMaxTokens(value string) error {
 	}
 	return nil
 }
+
+// IsAutoCacheControlGroup reports whether the group opted in to automatic
+// cache_control insertion.
+func (c *ClaudeSettings) IsAutoCacheControlGroup(group string) bool {
+	if group == "" {
+		return false
+	}
+	for _, g := range c.AutoCacheControlGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
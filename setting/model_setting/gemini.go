@@ -27,6 +27,9 @@ type GeminiSettings struct {
 	ThinkingAdapterBudgetTokensPercentage float64           `json:"thinking_adapter_budget_tokens_percentage"`
 	FunctionCallThoughtSignatureEnabled   bool              `json:"function_call_thought_signature_enabled"`
 	RemoveFunctionResponseIdEnabled       bool              `json:"remove_function_response_id_enabled"`
+	// CachedContentStorageRatio 上下文缓存存储价格相对输入倍率的系数（每 token·小时），
+	// 按模型名配置，default 兜底；按表达式计费且使用了 csh 的模型不读取此项
+	CachedContentStorageRatio map[string]float64 `json:"cached_content_storage_ratio"`
 }
 
 // 默认配置
@@ -51,6 +54,7 @@ var defaultGeminiSettings = GeminiSettings{
 	ThinkingAdapterBudgetTokensPercentage: 0.6,
 	FunctionCallThoughtSignatureEnabled:   true,
 	RemoveFunctionResponseIdEnabled:       true,
+	CachedContentStorageRatio:             map[string]float64{},
 }
 
 // 全局实例
@@ -107,6 +111,15 @@ func GetGeminiVersionSetting(key string) string {
 	return geminiSettings.VersionSettings["default"]
 }
 
+// GetGeminiCachedContentStorageRatio returns the storage ratio for model, or 0
+// when neither the model nor "default" is configured (storage is not billed).
+func GetGeminiCachedContentStorageRatio(model string) float64 {
+	if ratio, ok := geminiSettings.CachedContentStorageRatio[model]; ok {
+		return ratio
+	}
+	return geminiSettings.CachedContentStorageRatio["default"]
+}
+
 func IsGeminiModelSupportImagine(model string) bool {
 	for _, v := range geminiSettings.SupportedImagineModels {
 		if v == model {
@@ -0,0 +1,123 @@
+package model_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	ModelSplitStickyUser  = "user"
+	ModelSplitStickyToken = "token"
+	ModelSplitStickyNone  = "none"
+)
+
+type ModelSplitArm struct {
+	Model  string `json:"model"`
+	Weight int    `json:"weight"`
+}
+
+// ModelSplitAlias is a virtual model name whose traffic is split by weight
+// across concrete models, e.g. chat-default -> 90% gpt-x / 10% claude-y.
+type ModelSplitAlias struct {
+	Alias    string          `json:"alias"`
+	StickyBy string          `json:"sticky_by"` // user (默认), token 或 none
+	Arms     []ModelSplitArm `json:"arms"`
+}
+
+type ModelSplitSettings struct {
+	Enabled bool              `json:"enabled"`
+	Aliases []ModelSplitAlias `json:"aliases"`
+}
+
+var modelSplitSettings = ModelSplitSettings{
+	Enabled: false,
+	Aliases: []ModelSplitAlias{},
+}
+
+func init() {
+	config.GlobalConfig.Register("model_split", &modelSplitSettings)
+}
+
+func GetModelSplitSettings() *ModelSplitSettings {
+	return &modelSplitSettings
+}
+
+// FindAlias returns the split configured for alias, if any.
+func (s *ModelSplitSettings) FindAlias(alias string) (ModelSplitAlias, bool) {
+	if alias == "" {
+		return ModelSplitAlias{}, false
+	}
+	for _, item := range s.Aliases {
+		if item.Alias == alias {
+			return item, true
+		}
+	}
+	return ModelSplitAlias{}, false
+}
+
+// TotalWeight sums the positive arm weights.
+func (a ModelSplitAlias) TotalWeight() int {
+	total := 0
+	for _, arm := range a.Arms {
+		if arm.Weight > 0 {
+			total += arm.Weight
+		}
+	}
+	return total
+}
+
+// ValidateModelSplitAliases validates the model_split.aliases option value.
+func ValidateModelSplitAliases(jsonStr string) error {
+	var aliases []ModelSplitAlias
+	if err := common.UnmarshalJsonStr(jsonStr, &aliases); err != nil {
+		return fmt.Errorf("invalid model split aliases: %w", err)
+	}
+	names := make(map[string]struct{}, len(aliases))
+	for _, alias := range aliases {
+		names[alias.Alias] = struct{}{}
+	}
+	seen := make(map[string]struct{}, len(aliases))
+	for i, alias := range aliases {
+		name := alias.Alias
+		if strings.TrimSpace(name) == "" || name != strings.TrimSpace(name) {
+			return fmt.Errorf("aliases[%d].alias must be a non-empty model name without surrounding spaces", i)
+		}
+		if strings.ContainsAny(name, `%"`) {
+			return fmt.Errorf("alias %s must not contain %% or \"", name)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("duplicate model split alias: %s", name)
+		}
+		seen[name] = struct{}{}
+		switch alias.StickyBy {
+		case "", ModelSplitStickyUser, ModelSplitStickyToken, ModelSplitStickyNone:
+		default:
+			return fmt.Errorf("alias %s has invalid sticky_by: %s", name, alias.StickyBy)
+		}
+		if len(alias.Arms) == 0 {
+			return fmt.Errorf("alias %s has no arms", name)
+		}
+		for _, arm := range alias.Arms {
+			if strings.TrimSpace(arm.Model) == "" {
+				return fmt.Errorf("alias %s has an arm without model", name)
+			}
+			if arm.Model == name {
+				return fmt.Errorf("alias %s must not route to itself", name)
+			}
+			// 分流只解析一次，别名之间不能嵌套
+			if _, ok := names[arm.Model]; ok {
+				return fmt.Errorf("alias %s must not route to another alias %s", name, arm.Model)
+			}
+			if arm.Weight < 0 {
+				return fmt.Errorf("alias %s arm %s has negative weight", name, arm.Model)
+			}
+		}
+		if alias.TotalWeight() == 0 {
+			return fmt.Errorf("alias %s needs at least one arm with positive weight", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package model_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// GroupSystemPrompt 是注入到某个用户分组全部请求中的系统提示词
+type GroupSystemPrompt struct {
+	// Prompt 注入到系统提示词开头
+	Prompt string `json:"prompt"`
+	// Suffix 追加到系统提示词末尾
+	Suffix string `json:"suffix"`
+}
+
+// SystemPromptSettings 定义按用户分组注入的系统提示词，令牌级配置见 model.Token
+type SystemPromptSettings struct {
+	Groups map[string]GroupSystemPrompt `json:"groups"`
+}
+
+var systemPromptSettings = SystemPromptSettings{
+	Groups: map[string]GroupSystemPrompt{},
+}
+
+func init() {
+	config.GlobalConfig.Register("system_prompt", &systemPromptSettings)
+}
+
+func GetSystemPromptSettings() *SystemPromptSettings {
+	return &systemPromptSettings
+}
+
+// GetGroupSystemPrompt returns the prompt configured for the user group.
+func GetGroupSystemPrompt(group string) (GroupSystemPrompt, bool) {
+	prompt, ok := systemPromptSettings.Groups[group]
+	if !ok || (prompt.Prompt == "" && prompt.Suffix == "") {
+		return GroupSystemPrompt{}, false
+	}
+	return prompt, true
+}
@@ -3,9 +3,11 @@ package operation_setting
 import "github.com/QuantumNous/new-api/setting/config"
 
 type ChannelAffinityKeySource struct {
-	Type string `json:"type"` // context_int, context_string, request_header, gjson
+	Type string `json:"type"` // context_int, context_string, request_header, gjson, prompt_prefix
 	Key  string `json:"key,omitempty"`
 	Path string `json:"path,omitempty"`
+	// PrefixTokens is the number of leading prompt tokens hashed by prompt_prefix (default 1024).
+	PrefixTokens int `json:"prefix_tokens,omitempty"`
 }
 
 type ChannelAffinityRule struct {
@@ -0,0 +1,144 @@
+package operation_setting
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	GuardrailStagePre  = "pre"
+	GuardrailStagePost = "post"
+
+	GuardrailHookTypeWebhook = "webhook"
+	GuardrailHookTypeModel   = "model"
+
+	GuardrailFailOpen   = "open"
+	GuardrailFailClosed = "closed"
+)
+
+const defaultGuardrailTimeoutMs = 3000
+
+// GuardrailHook is one step of the guardrail pipeline. A webhook receives the
+// request or response and answers allow/block/modify; a model hook asks a
+// moderation model served by this gateway and only answers allow/block.
+// Empty Groups/Models match everything.
+type GuardrailHook struct {
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Stage   string   `json:"stage"` // pre / post
+	Type    string   `json:"type"`  // webhook / model
+	Groups  []string `json:"groups,omitempty"`
+	Models  []string `json:"models,omitempty"`
+
+	// URL webhook 地址；model 类型可留空，默认为本站的 /v1/chat/completions
+	URL string `json:"url,omitempty"`
+	// Secret 用于 webhook 请求签名（X-Guardrail-Signature）
+	Secret string            `json:"secret,omitempty"`
+	Header map[string]string `json:"header,omitempty"`
+
+	// Model 审核模型名称，Key 为调用本站时使用的令牌
+	Model string `json:"model,omitempty"`
+	Key   string `json:"key,omitempty"`
+	// Prompt 审核模型的系统提示词，为空时使用默认提示词
+	Prompt string `json:"prompt,omitempty"`
+
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+	// FailurePolicy 调用失败或超时时的处理：open 放行，closed 拦截（默认）
+	FailurePolicy string `json:"failure_policy,omitempty"`
+}
+
+// GuardrailSetting 外部审核钩子，在请求发往上游之前（pre）和非流式响应返回客户端之前（post）调用
+type GuardrailSetting struct {
+	Enabled bool            `json:"enabled"`
+	Hooks   []GuardrailHook `json:"hooks"`
+}
+
+var guardrailSetting = GuardrailSetting{
+	Enabled: false,
+	Hooks:   []GuardrailHook{},
+}
+
+func init() {
+	config.GlobalConfig.Register("guardrail_setting", &guardrailSetting)
+}
+
+func GetGuardrailSetting() *GuardrailSetting {
+	return &guardrailSetting
+}
+
+// Matches reports whether the hook runs for a request of the given group and
+// model.
+func (h GuardrailHook) Matches(group string, modelName string) bool {
+	if !h.Enabled {
+		return false
+	}
+	if len(h.Groups) > 0 && !common.StringsContains(h.Groups, group) {
+		return false
+	}
+	if len(h.Models) > 0 && !common.StringsContains(h.Models, modelName) {
+		return false
+	}
+	return true
+}
+
+// FailOpen reports whether a failed call lets the request through.
+func (h GuardrailHook) FailOpen() bool {
+	return h.FailurePolicy == GuardrailFailOpen
+}
+
+func (h GuardrailHook) Timeout() int {
+	if h.TimeoutMs <= 0 {
+		return defaultGuardrailTimeoutMs
+	}
+	return h.TimeoutMs
+}
+
+// ValidateGuardrailHooks validates the guardrail_setting.hooks option value.
+func ValidateGuardrailHooks(jsonStr string) error {
+	var hooks []GuardrailHook
+	if err := common.UnmarshalJsonStr(jsonStr, &hooks); err != nil {
+		return fmt.Errorf("invalid guardrail hooks: %w", err)
+	}
+	names := make(map[string]bool, len(hooks))
+	for i, hook := range hooks {
+		if strings.TrimSpace(hook.Name) == "" {
+			return fmt.Errorf("hooks[%d].name is required", i)
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("duplicate guardrail hook name: %s", hook.Name)
+		}
+		names[hook.Name] = true
+		if hook.Stage != GuardrailStagePre && hook.Stage != GuardrailStagePost {
+			return fmt.Errorf("hook %s: stage must be pre or post", hook.Name)
+		}
+		switch hook.Type {
+		case GuardrailHookTypeWebhook:
+			if hook.URL == "" {
+				return fmt.Errorf("hook %s: url is required", hook.Name)
+			}
+		case GuardrailHookTypeModel:
+			if hook.Model == "" || hook.Key == "" {
+				return fmt.Errorf("hook %s: model and key are required", hook.Name)
+			}
+		default:
+			return fmt.Errorf("hook %s: type must be webhook or model", hook.Name)
+		}
+		if hook.URL != "" {
+			parsed, err := url.Parse(hook.URL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("hook %s: invalid url", hook.Name)
+			}
+		}
+		if hook.TimeoutMs < 0 || hook.TimeoutMs > 60000 {
+			return fmt.Errorf("hook %s: timeout_ms must be between 0 and 60000", hook.Name)
+		}
+		if hook.FailurePolicy != "" && hook.FailurePolicy != GuardrailFailOpen && hook.FailurePolicy != GuardrailFailClosed {
+			return fmt.Errorf("hook %s: failure_policy must be open or closed", hook.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package operation_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ImagePolicyRule limits the images of a request. Zero values mean no limit.
+// Domains match the host exactly or, written as *.example.com, any subdomain.
+type ImagePolicyRule struct {
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+	DeniedDomains  []string `json:"denied_domains,omitempty"`
+	ForbidURL      bool     `json:"forbid_url,omitempty"`
+	ForbidBase64   bool     `json:"forbid_base64,omitempty"`
+	MaxImages      int      `json:"max_images,omitempty"`
+	MaxBytes       int64    `json:"max_bytes,omitempty"`
+	MaxWidth       int      `json:"max_width,omitempty"`
+	MaxHeight      int      `json:"max_height,omitempty"`
+	// Moderation 使用审核模型检查图片内容
+	Moderation bool `json:"moderation,omitempty"`
+}
+
+// ImageModerationSetting 图片审核模型，以 OpenAI /v1/moderations 格式调用
+type ImageModerationSetting struct {
+	// URL 为空时使用本站的 /v1/moderations
+	URL       string `json:"url,omitempty"`
+	Model     string `json:"model"`
+	Key       string `json:"key"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	// FailurePolicy 调用失败时的处理：open 放行，closed 拦截（默认）
+	FailurePolicy string `json:"failure_policy,omitempty"`
+}
+
+// ImagePolicySetting 请求中图片输入的检查策略，在请求发往上游之前执行
+type ImagePolicySetting struct {
+	Enabled bool            `json:"enabled"`
+	Default ImagePolicyRule `json:"default"`
+	// GroupRules 按用户分组覆盖默认规则（整条替换，不合并）
+	GroupRules map[string]ImagePolicyRule `json:"group_rules"`
+	Moderation ImageModerationSetting     `json:"moderation"`
+}
+
+var imagePolicySetting = ImagePolicySetting{
+	Enabled:    false,
+	GroupRules: map[string]ImagePolicyRule{},
+	Moderation: ImageModerationSetting{
+		Model:     "omni-moderation-latest",
+		TimeoutMs: 5000,
+	},
+}
+
+func init() {
+	config.GlobalConfig.Register("image_policy_setting", &imagePolicySetting)
+}
+
+func GetImagePolicySetting() *ImagePolicySetting {
+	return &imagePolicySetting
+}
+
+// RuleFor returns the rule of the user group, or false when the policy is off.
+func (s *ImagePolicySetting) RuleFor(group string) (ImagePolicyRule, bool) {
+	if !s.Enabled {
+		return ImagePolicyRule{}, false
+	}
+	if rule, ok := s.GroupRules[group]; ok {
+		return rule, true
+	}
+	return s.Default, true
+}
+
+// FailOpen reports whether a failed moderation call lets the request through.
+func (s ImageModerationSetting) FailOpen() bool {
+	return s.FailurePolicy == GuardrailFailOpen
+}
+
+// MatchImageDomain reports whether host matches one of the domain patterns.
+func MatchImageDomain(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if suffix, ok := strings.CutPrefix(domain, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func validateImagePolicyRule(name string, rule ImagePolicyRule) error {
+	if rule.MaxImages < 0 || rule.MaxBytes < 0 || rule.MaxWidth < 0 || rule.MaxHeight < 0 {
+		return fmt.Errorf("%s: limits must not be negative", name)
+	}
+	for _, domain := range append(append([]string(nil), rule.AllowedDomains...), rule.DeniedDomains...) {
+		if strings.TrimSpace(domain) == "" || strings.Contains(domain, "/") {
+			return fmt.Errorf("%s: invalid domain %q", name, domain)
+		}
+	}
+	return nil
+}
+
+// ValidateImagePolicyRule validates the image_policy_setting.default option value.
+func ValidateImagePolicyRule(jsonStr string) error {
+	var rule ImagePolicyRule
+	if err := common.UnmarshalJsonStr(jsonStr, &rule); err != nil {
+		return fmt.Errorf("invalid image policy: %w", err)
+	}
+	return validateImagePolicyRule("default", rule)
+}
+
+// ValidateImagePolicyGroupRules validates the image_policy_setting.group_rules option value.
+func ValidateImagePolicyGroupRules(jsonStr string) error {
+	var rules map[string]ImagePolicyRule
+	if err := common.UnmarshalJsonStr(jsonStr, &rules); err != nil {
+		return fmt.Errorf("invalid image policy group rules: %w", err)
+	}
+	for group, rule := range rules {
+		if err := validateImagePolicyRule(group, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package operation_setting
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	PIIDetectorEmail      = "email"
+	PIIDetectorPhone      = "phone"
+	PIIDetectorIdCard     = "id_card"
+	PIIDetectorCreditCard = "credit_card"
+)
+
+var piiBuiltinDetectors = []string{PIIDetectorEmail, PIIDetectorPhone, PIIDetectorIdCard, PIIDetectorCreditCard}
+
+var piiRuleNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,31}$`)
+
+// PIICustomRule is a group specific regex detector. Name becomes part of the
+// placeholder, e.g. employee_id -> [PII_EMPLOYEE_ID_1].
+type PIICustomRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// PIIRedactionSetting 控制发往上游前的敏感个人信息脱敏，响应中的占位符会被还原
+type PIIRedactionSetting struct {
+	Enabled bool `json:"enabled"`
+	// Detectors 启用的内置检测器：email, phone, id_card, credit_card
+	Detectors []string `json:"detectors"`
+	// Groups 生效的用户分组，为空表示全部分组
+	Groups []string `json:"groups"`
+	// CustomRules 按用户分组追加的自定义正则
+	CustomRules map[string][]PIICustomRule `json:"custom_rules"`
+}
+
+var piiRedactionSetting = PIIRedactionSetting{
+	Enabled:     false,
+	Detectors:   append([]string(nil), piiBuiltinDetectors...),
+	Groups:      []string{},
+	CustomRules: map[string][]PIICustomRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("pii_redaction_setting", &piiRedactionSetting)
+}
+
+func GetPIIRedactionSetting() *PIIRedactionSetting {
+	return &piiRedactionSetting
+}
+
+// AppliesTo reports whether redaction is enabled for the user group.
+func (s *PIIRedactionSetting) AppliesTo(group string) bool {
+	if !s.Enabled {
+		return false
+	}
+	return len(s.Groups) == 0 || common.StringsContains(s.Groups, group)
+}
+
+// ValidatePIIDetectors validates the pii_redaction_setting.detectors option value.
+func ValidatePIIDetectors(jsonStr string) error {
+	var detectors []string
+	if err := common.UnmarshalJsonStr(jsonStr, &detectors); err != nil {
+		return fmt.Errorf("invalid pii detectors: %w", err)
+	}
+	for _, detector := range detectors {
+		if !common.StringsContains(piiBuiltinDetectors, detector) {
+			return fmt.Errorf("unknown pii detector: %s", detector)
+		}
+	}
+	return nil
+}
+
+// ValidatePIICustomRules validates the pii_redaction_setting.custom_rules option value.
+func ValidatePIICustomRules(jsonStr string) error {
+	var rules map[string][]PIICustomRule
+	if err := common.UnmarshalJsonStr(jsonStr, &rules); err != nil {
+		return fmt.Errorf("invalid pii custom rules: %w", err)
+	}
+	for group, groupRules := range rules {
+		for i, rule := range groupRules {
+			if !piiRuleNameRegexp.MatchString(rule.Name) {
+				return fmt.Errorf("custom_rules[%s][%d].name must start with a letter and contain only letters, digits and underscores", group, i)
+			}
+			if common.StringsContains(piiBuiltinDetectors, rule.Name) {
+				return fmt.Errorf("custom rule name %s conflicts with a built-in detector", rule.Name)
+			}
+			if rule.Pattern == "" {
+				return fmt.Errorf("custom rule %s has an empty pattern", rule.Name)
+			}
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("custom rule %s has an invalid pattern: %w", rule.Name, err)
+			}
+			if re.MatchString("") {
+				return fmt.Errorf("custom rule %s must not match empty text", rule.Name)
+			}
+		}
+	}
+	return nil
+}
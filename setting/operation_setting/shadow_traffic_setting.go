@@ -0,0 +1,100 @@
+package operation_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ShadowTrafficRule mirrors a sampled share of live requests to a shadow channel.
+// Empty Groups/Models/TokenIds match everything; the first matching rule wins.
+type ShadowTrafficRule struct {
+	Name       string   `json:"name"`
+	Enabled    bool     `json:"enabled"`
+	Groups     []string `json:"groups,omitempty"`
+	Models     []string `json:"models,omitempty"`
+	TokenIds   []int    `json:"token_ids,omitempty"`
+	Percentage float64  `json:"percentage"` // 0-100
+
+	ShadowChannelId int    `json:"shadow_channel_id"`
+	ShadowModel     string `json:"shadow_model,omitempty"` // 为空时使用原请求模型
+
+	RecordResponseDiff bool `json:"record_response_diff"`
+}
+
+type ShadowTrafficSetting struct {
+	Enabled        bool                `json:"enabled"`
+	MaxConcurrency int                 `json:"max_concurrency"` // 同时进行的影子请求上限，超出时直接丢弃
+	TimeoutSeconds int                 `json:"timeout_seconds"`
+	Rules          []ShadowTrafficRule `json:"rules"`
+}
+
+var shadowTrafficSetting = ShadowTrafficSetting{
+	Enabled:        false,
+	MaxConcurrency: 16,
+	TimeoutSeconds: 120,
+	Rules:          []ShadowTrafficRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("shadow_traffic_setting", &shadowTrafficSetting)
+}
+
+func GetShadowTrafficSetting() *ShadowTrafficSetting {
+	return &shadowTrafficSetting
+}
+
+// Matches reports whether a request of the given group, model and token falls
+// under this rule. Sampling by Percentage is left to the caller.
+func (r ShadowTrafficRule) Matches(group string, modelName string, tokenId int) bool {
+	if !r.Enabled || r.ShadowChannelId <= 0 || r.Percentage <= 0 {
+		return false
+	}
+	if len(r.Groups) > 0 && !common.StringsContains(r.Groups, group) {
+		return false
+	}
+	if len(r.Models) > 0 && !common.StringsContains(r.Models, modelName) {
+		return false
+	}
+	if len(r.TokenIds) > 0 {
+		matched := false
+		for _, id := range r.TokenIds {
+			if id == tokenId {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateShadowTrafficRules validates the shadow_traffic_setting.rules option value.
+func ValidateShadowTrafficRules(jsonStr string) error {
+	var rules []ShadowTrafficRule
+	if err := common.UnmarshalJsonStr(jsonStr, &rules); err != nil {
+		return fmt.Errorf("invalid shadow traffic rules: %w", err)
+	}
+	seen := make(map[string]struct{}, len(rules))
+	for i, rule := range rules {
+		name := strings.TrimSpace(rule.Name)
+		if name == "" {
+			return fmt.Errorf("rules[%d].name is required", i)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("duplicate shadow traffic rule name: %s", name)
+		}
+		seen[name] = struct{}{}
+		if rule.ShadowChannelId <= 0 {
+			return fmt.Errorf("shadow traffic rule %s requires shadow_channel_id", name)
+		}
+		if rule.Percentage < 0 || rule.Percentage > 100 {
+			return fmt.Errorf("shadow traffic rule %s percentage must be between 0 and 100", name)
+		}
+	}
+	return nil
+}
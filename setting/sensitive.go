@@ -1,11 +1,18 @@
 package setting
 
-import "strings"
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+)
 
 var CheckSensitiveEnabled = true
 var CheckSensitiveOnPromptEnabled = true
-
-//var CheckSensitiveOnCompletionEnabled = true
+var CheckSensitiveOnCompletionEnabled = false
 
 // StopOnSensitiveEnabled 如果检测到敏感词，是否立刻停止生成，否则替换敏感词
 var StopOnSensitiveEnabled = true
@@ -19,6 +26,18 @@ var SensitiveWords = []string{
 	"test_sensitive",
 }
 
+// SensitivePatterns 正则敏感词，每行一个
+var SensitivePatterns = []string{}
+
+// SensitiveGroupRule 按用户分组追加的敏感词和正则
+type SensitiveGroupRule struct {
+	Words    []string `json:"words"`
+	Patterns []string `json:"patterns"`
+}
+
+var SensitiveGroupRules = map[string]SensitiveGroupRule{}
+var sensitiveGroupRulesMutex sync.RWMutex
+
 func SensitiveWordsToString() string {
 	return strings.Join(SensitiveWords, "\n")
 }
@@ -34,10 +53,93 @@ func SensitiveWordsFromString(s string) {
 	}
 }
 
+func SensitivePatternsToString() string {
+	return strings.Join(SensitivePatterns, "\n")
+}
+
+func SensitivePatternsFromString(s string) {
+	patterns := []string{}
+	for _, p := range strings.Split(s, "\n") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	SensitivePatterns = patterns
+}
+
+func CheckSensitivePatterns(s string) error {
+	for _, p := range strings.Split(s, "\n") {
+		if err := checkSensitivePattern(strings.TrimSpace(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSensitivePattern(p string) error {
+	if p == "" {
+		return nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return fmt.Errorf("invalid sensitive pattern %s: %w", p, err)
+	}
+	if re.MatchString("") {
+		return fmt.Errorf("sensitive pattern %s must not match empty text", p)
+	}
+	return nil
+}
+
+func SensitiveGroupRules2JSONString() string {
+	sensitiveGroupRulesMutex.RLock()
+	defer sensitiveGroupRulesMutex.RUnlock()
+
+	jsonBytes, err := json.Marshal(SensitiveGroupRules)
+	if err != nil {
+		common.SysLog("error marshalling sensitive group rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateSensitiveGroupRulesByJSONString(jsonStr string) error {
+	rules := make(map[string]SensitiveGroupRule)
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return err
+	}
+	sensitiveGroupRulesMutex.Lock()
+	defer sensitiveGroupRulesMutex.Unlock()
+	SensitiveGroupRules = rules
+	return nil
+}
+
+func CheckSensitiveGroupRules(jsonStr string) error {
+	rules := make(map[string]SensitiveGroupRule)
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return err
+	}
+	for group, rule := range rules {
+		for _, p := range rule.Patterns {
+			if err := checkSensitivePattern(p); err != nil {
+				return fmt.Errorf("group %s: %w", group, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetSensitiveGroupRule returns the extra words and patterns of the user group.
+func GetSensitiveGroupRule(group string) (SensitiveGroupRule, bool) {
+	sensitiveGroupRulesMutex.RLock()
+	defer sensitiveGroupRulesMutex.RUnlock()
+	rule, ok := SensitiveGroupRules[group]
+	return rule, ok
+}
+
 func ShouldCheckPromptSensitive() bool {
 	return CheckSensitiveEnabled && CheckSensitiveOnPromptEnabled
 }
 
-//func ShouldCheckCompletionSensitive() bool {
-//	return CheckSensitiveEnabled && CheckSensitiveOnCompletionEnabled
-//}
+func ShouldCheckCompletionSensitive() bool {
+	return CheckSensitiveEnabled && CheckSensitiveOnCompletionEnabled
+}
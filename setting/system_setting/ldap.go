@@ -0,0 +1,143 @@
+package system_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const LDAPRoleAdmin = "admin"
+
+type LDAPSettings struct {
+	Enabled     bool   `json:"enabled"`
+	DisplayName string `json:"display_name"`
+
+	URL                string `json:"url"`       // ldap://host:389 or ldaps://host:636
+	StartTLS           bool   `json:"start_tls"` // Upgrade ldap:// with StartTLS
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	RootCA             string `json:"root_ca"` // PEM, empty uses the system pool
+
+	BindDN       string `json:"bind_dn"` // Service account used to search users, empty binds anonymously
+	BindPassword string `json:"bind_password"`
+	BaseDN       string `json:"base_dn"`
+	UserFilter   string `json:"user_filter"` // {username} is replaced by the escaped login name
+
+	UniqueIDAttribute    string `json:"unique_id_attribute"` // Stable ID used for binding, entryUUID / objectGUID
+	UsernameAttribute    string `json:"username_attribute"`
+	EmailAttribute       string `json:"email_attribute"`
+	DisplayNameAttribute string `json:"display_name_attribute"`
+	GroupAttribute       string `json:"group_attribute"`
+
+	GroupMapping      string `json:"group_mapping"` // JSON []LDAPGroupMapping
+	RequireGroupMatch bool   `json:"require_group_match"`
+	AutoProvision     bool   `json:"auto_provision"`
+
+	SyncEnabled         bool `json:"sync_enabled"` // Periodically disable users removed from the directory
+	SyncIntervalMinutes int  `json:"sync_interval_minutes"`
+}
+
+// LDAPGroupMapping maps one directory group (DN or CN) to a user group and/or
+// an authorization role. Group mappings are evaluated in order and the first
+// match wins; Role is granted when any matching mapping carries it.
+type LDAPGroupMapping struct {
+	LDAPGroup string `json:"ldap_group"`
+	Group     string `json:"group"`
+	Role      string `json:"role"`
+}
+
+// LDAPGroupMatch is the result of applying the group mapping to a user.
+type LDAPGroupMatch struct {
+	Matched bool
+	Group   string
+	Admin   bool
+	// ManagesRole is true when the mapping assigns roles at all, in which case
+	// the directory is authoritative for the admin role.
+	ManagesRole bool
+}
+
+// 默认配置
+var defaultLDAPSettings = LDAPSettings{
+	UserFilter:           "(uid={username})",
+	UniqueIDAttribute:    "entryUUID",
+	UsernameAttribute:    "uid",
+	EmailAttribute:       "mail",
+	DisplayNameAttribute: "displayName",
+	GroupAttribute:       "memberOf",
+	SyncIntervalMinutes:  60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("ldap", &defaultLDAPSettings)
+}
+
+func GetLDAPSettings() *LDAPSettings {
+	return &defaultLDAPSettings
+}
+
+func (s *LDAPSettings) GetEffectiveDisplayName() string {
+	if trimmed := strings.TrimSpace(s.DisplayName); trimmed != "" {
+		return trimmed
+	}
+	return "LDAP"
+}
+
+func ParseLDAPGroupMapping(value string) ([]LDAPGroupMapping, error) {
+	var mappings []LDAPGroupMapping
+	if strings.TrimSpace(value) == "" {
+		return mappings, nil
+	}
+	if err := common.UnmarshalJsonStr(value, &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// MapGroups applies the group mapping to the user's directory groups.
+func (s *LDAPSettings) MapGroups(ldapGroups []string) LDAPGroupMatch {
+	var match LDAPGroupMatch
+	mappings, err := ParseLDAPGroupMapping(s.GroupMapping)
+	if err != nil {
+		return match
+	}
+	for _, mapping := range mappings {
+		if mapping.Role != "" {
+			match.ManagesRole = true
+		}
+		if !ldapGroupsContain(ldapGroups, mapping.LDAPGroup) {
+			continue
+		}
+		match.Matched = true
+		if mapping.Group != "" && match.Group == "" {
+			match.Group = mapping.Group
+		}
+		if mapping.Role == LDAPRoleAdmin {
+			match.Admin = true
+		}
+	}
+	return match
+}
+
+// ldapGroupsContain 支持按完整 DN 或 CN 匹配，不区分大小写。
+func ldapGroupsContain(ldapGroups []string, want string) bool {
+	want = strings.TrimSpace(want)
+	if want == "" {
+		return false
+	}
+	for _, group := range ldapGroups {
+		if strings.EqualFold(group, want) || strings.EqualFold(ldapGroupCN(group), want) {
+			return true
+		}
+	}
+	return false
+}
+
+func ldapGroupCN(dn string) string {
+	first, _, _ := strings.Cut(dn, ",")
+	name, value, ok := strings.Cut(first, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(name), "cn") {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,37 @@
+package system_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLDAPSettings_MapGroups(t *testing.T) {
+	settings := &LDAPSettings{GroupMapping: `[
+		{"ldap_group": "cn=engineering,ou=groups,dc=example,dc=com", "group": "vip"},
+		{"ldap_group": "Admins", "role": "admin"},
+		{"ldap_group": "staff", "group": "default"}
+	]`}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   LDAPGroupMatch
+	}{
+		{name: "no groups", groups: nil, want: LDAPGroupMatch{ManagesRole: true}},
+		{name: "full DN matches case-insensitively", groups: []string{"CN=Engineering,OU=Groups,DC=example,DC=com"}, want: LDAPGroupMatch{Matched: true, Group: "vip", ManagesRole: true}},
+		{name: "CN matches", groups: []string{"cn=admins,ou=groups,dc=example,dc=com"}, want: LDAPGroupMatch{Matched: true, Admin: true, ManagesRole: true}},
+		{name: "first group mapping wins", groups: []string{"cn=staff,dc=example,dc=com", "cn=engineering,ou=groups,dc=example,dc=com"}, want: LDAPGroupMatch{Matched: true, Group: "vip", ManagesRole: true}},
+		{name: "non-CN RDN is not a group name", groups: []string{"ou=staff,dc=example,dc=com"}, want: LDAPGroupMatch{ManagesRole: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, settings.MapGroups(tt.groups))
+		})
+	}
+
+	withoutRoles := &LDAPSettings{GroupMapping: `[{"ldap_group": "staff", "group": "vip"}]`}
+	assert.False(t, withoutRoles.MapGroups([]string{"cn=staff"}).ManagesRole)
+	invalid := &LDAPSettings{GroupMapping: `not json`}
+	assert.Equal(t, LDAPGroupMatch{}, invalid.MapGroups([]string{"cn=staff"}))
+}
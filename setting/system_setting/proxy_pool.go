@@ -0,0 +1,87 @@
+package system_setting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ProxyPool is a shared, named list of outbound proxies that channels can
+// reference through ChannelSettings.ProxyPool.Name.
+type ProxyPool struct {
+	Name     string   `json:"name"`
+	Proxies  []string `json:"proxies"`
+	Strategy string   `json:"strategy"` // round_robin (default) or sticky
+}
+
+type ProxyPoolSetting struct {
+	HealthCheckEnabled         bool        `json:"health_check_enabled"`
+	HealthCheckIntervalSeconds int         `json:"health_check_interval_seconds"`
+	HealthCheckTimeoutSeconds  int         `json:"health_check_timeout_seconds"`
+	FailureThreshold           int         `json:"failure_threshold"`      // 连续失败多少次后剔除
+	EjectDurationSeconds       int         `json:"eject_duration_seconds"` // 剔除后多久允许重新尝试
+	Pools                      []ProxyPool `json:"pools"`
+}
+
+var defaultProxyPoolSetting = ProxyPoolSetting{
+	HealthCheckEnabled:         true,
+	HealthCheckIntervalSeconds: 30,
+	HealthCheckTimeoutSeconds:  5,
+	FailureThreshold:           3,
+	EjectDurationSeconds:       60,
+	Pools:                      []ProxyPool{},
+}
+
+func init() {
+	config.GlobalConfig.Register("proxy_pool_setting", &defaultProxyPoolSetting)
+}
+
+func GetProxyPoolSetting() *ProxyPoolSetting {
+	return &defaultProxyPoolSetting
+}
+
+// FindProxyPool returns the shared pool with the given name.
+func (s *ProxyPoolSetting) FindProxyPool(name string) (ProxyPool, bool) {
+	name = strings.TrimSpace(name)
+	for _, pool := range s.Pools {
+		if pool.Name == name {
+			return pool, true
+		}
+	}
+	return ProxyPool{}, false
+}
+
+// ValidateProxyPools validates the proxy_pool_setting.pools option value.
+func ValidateProxyPools(jsonStr string) error {
+	var pools []ProxyPool
+	if err := common.UnmarshalJsonStr(jsonStr, &pools); err != nil {
+		return fmt.Errorf("invalid proxy pools: %w", err)
+	}
+	seen := make(map[string]struct{}, len(pools))
+	for i, pool := range pools {
+		name := strings.TrimSpace(pool.Name)
+		if name == "" {
+			return fmt.Errorf("pools[%d].name is required", i)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("duplicate proxy pool name: %s", name)
+		}
+		seen[name] = struct{}{}
+		if len(pool.Proxies) == 0 {
+			return fmt.Errorf("proxy pool %s has no proxies", name)
+		}
+		switch pool.Strategy {
+		case "", "round_robin", "sticky":
+		default:
+			return fmt.Errorf("proxy pool %s has invalid strategy: %s", name, pool.Strategy)
+		}
+		for _, proxyURL := range pool.Proxies {
+			if _, err := common.ParseProxyURLStrict(proxyURL); err != nil {
+				return fmt.Errorf("proxy pool %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
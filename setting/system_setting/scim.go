@@ -0,0 +1,59 @@
+package system_setting
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type SCIMSettings struct {
+	Enabled bool `json:"enabled"`
+	// TokenHash is the hex SHA-256 of the bearer token used by the IdP. The
+	// token itself is only shown once when it is generated.
+	TokenHash string `json:"token_hash"`
+	// SSOLinkAttribute links a SCIM user that has no SSO identity yet to the
+	// first SAML, LDAP or OIDC login asserting the same value. Empty disables
+	// linking.
+	SSOLinkAttribute string `json:"sso_link_attribute"`
+}
+
+const (
+	SCIMSSOLinkUserName   = "user_name"
+	SCIMSSOLinkExternalId = "external_id"
+	SCIMSSOLinkEmail      = "email"
+)
+
+func IsValidSCIMSSOLinkAttribute(attribute string) bool {
+	switch attribute {
+	case "", SCIMSSOLinkUserName, SCIMSSOLinkExternalId, SCIMSSOLinkEmail:
+		return true
+	}
+	return false
+}
+
+// 默认配置
+var defaultSCIMSettings = SCIMSettings{}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("scim", &defaultSCIMSettings)
+}
+
+func GetSCIMSettings() *SCIMSettings {
+	return &defaultSCIMSettings
+}
+
+func HashSCIMToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyToken reports whether token matches the configured bearer token.
+func (s *SCIMSettings) VerifyToken(token string) bool {
+	if s.TokenHash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashSCIMToken(token)), []byte(s.TokenHash)) == 1
+}
@@ -54,6 +54,20 @@ export async function login(payload: LoginPayload) {
   return res.data
 }
 
+// LDAP / Active Directory login with directory credentials
+export async function ldapLogin(payload: LoginPayload) {
+  const turnstile = payload.turnstile ?? ''
+  const res = await api.post<LoginResponse>(
+    `/api/user/ldap/login?turnstile=${turnstile}`,
+    {
+      username: payload.username,
+      password: payload.password,
+    },
+    { skipAuthRefresh: true }
+  )
+  return res.data
+}
+
 // Two-factor authentication login
 export async function login2fa(payload: TwoFAPayload) {
   const res = await api.post<Login2FAResponse>('/api/user/login/2fa', payload, {
@@ -157,6 +171,23 @@ export async function createOAuthFlow(
   throw new Error(res.data?.message || 'Failed to initialize OAuth')
 }
 
+// Start a SAML SSO flow, returns the IdP redirect URL
+export async function startSAMLFlow(
+  slug: string,
+  intent: 'login' | 'bind'
+): Promise<string> {
+  const aff = intent === 'login' ? getAffiliateCode() : ''
+  const res = await api.post(
+    `/api/saml/${encodeURIComponent(slug)}/start`,
+    { intent, aff: aff || undefined },
+    { skipAuthRefresh: intent === 'login' }
+  )
+  if (res.data?.success && typeof res.data.data?.redirect_url === 'string') {
+    return res.data.data.redirect_url
+  }
+  throw new Error(res.data?.message || 'Failed to initialize SAML')
+}
+
 // WeChat login by authorization code
 export async function wechatLoginByCode(code: string): Promise<ApiResponse> {
   const res = await api.get('/api/oauth/wechat', { params: { code } })
@@ -181,7 +212,9 @@ export async function telegramLogin(
 // ----------------------------------------------------------------------------
 
 // User registration
-export async function register(payload: RegisterPayload): Promise<ApiResponse> {
+export async function register(
+  payload: RegisterPayload
+): Promise<ApiResponse<{ key?: string }>> {
   const res = await api.post(`/api/user/register`, payload, {
     params: { turnstile: payload.turnstile ?? '' },
   })
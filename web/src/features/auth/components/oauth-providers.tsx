@@ -69,6 +69,7 @@ export function OAuthProviders({
     handleLinuxDOLogin,
     handleTelegramLogin,
     handleCustomOAuthLogin,
+    handleSAMLLogin,
     isTelegramDialogOpen,
     isTelegramPending,
     handleTelegramAuthorization,
@@ -147,6 +148,14 @@ export function OAuthProviders({
     }
   }
 
+  for (const provider of status?.saml_providers ?? []) {
+    providerButtons.push({
+      key: `saml-${provider.slug}`,
+      label: t('Continue with {{name}}', { name: provider.name }),
+      onClick: () => handleSAMLLogin(provider),
+    })
+  }
+
   if (providerButtons.length === 0) return null
 
   return (
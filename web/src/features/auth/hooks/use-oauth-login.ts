@@ -22,7 +22,12 @@ import { toast } from 'sonner'
 
 import { clearAuthentication, isAuthBundle } from '@/lib/api'
 
-import { createOAuthFlow, logout, telegramLogin } from '../api'
+import {
+  createOAuthFlow,
+  logout,
+  startSAMLFlow,
+  telegramLogin,
+} from '../api'
 import {
   buildGitHubOAuthUrl,
   buildDiscordOAuthUrl,
@@ -30,7 +35,11 @@ import {
   buildLinuxDOOAuthUrl,
 } from '../lib/oauth'
 import { pickTelegramAuthorization } from '../lib/telegram-login'
-import type { SystemStatus, CustomOAuthProviderInfo } from '../types'
+import type {
+  SystemStatus,
+  CustomOAuthProviderInfo,
+  SAMLProviderInfo,
+} from '../types'
 import { useAuthRedirect } from './use-auth-redirect'
 
 /**
@@ -231,6 +240,21 @@ export function useOAuthLogin(
     }
   }
 
+  const handleSAMLLogin = async (provider: SAMLProviderInfo) => {
+    setIsLoading(true)
+    try {
+      await resetSession()
+      const redirectURL = await startSAMLFlow(provider.slug, 'login')
+      window.open(redirectURL, '_self')
+    } catch {
+      toast.error(
+        t('Failed to start {{provider}} login', { provider: provider.name })
+      )
+    } finally {
+      setIsLoading(false)
+    }
+  }
+
   return {
     isLoading,
     githubButtonText,
@@ -245,5 +269,6 @@ export function useOAuthLogin(
     handleTelegramAuthorization,
     setIsTelegramDialogOpen,
     handleCustomOAuthLogin,
+    handleSAMLLogin,
   }
 }
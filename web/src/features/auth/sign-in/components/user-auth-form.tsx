@@ -40,7 +40,7 @@ import {
 } from '@/components/ui/form'
 import { Input } from '@/components/ui/input'
 import { Label } from '@/components/ui/label'
-import { login, wechatLoginByCode } from '@/features/auth/api'
+import { ldapLogin, login, wechatLoginByCode } from '@/features/auth/api'
 import { LegalConsent } from '@/features/auth/components/legal-consent'
 import { OAuthProviders } from '@/features/auth/components/oauth-providers'
 import { loginFormSchema } from '@/features/auth/constants'
@@ -84,6 +84,13 @@ export function UserAuthForm({
     (status?.password_login_enabled ??
       status?.data?.password_login_enabled ??
       true) !== false
+  const ldapLoginEnabled = Boolean(
+    status?.ldap_login ?? status?.data?.ldap_login
+  )
+  const ldapDisplayName = status?.ldap_display_name?.trim() || 'LDAP'
+  const [preferLDAP, setPreferLDAP] = useState(false)
+  // 关闭密码登录时，用户名密码表单只用于 LDAP
+  const isLDAPMode = ldapLoginEnabled && (preferLDAP || !passwordLoginEnabled)
   const {
     isTurnstileEnabled,
     turnstileSiteKey,
@@ -110,7 +117,8 @@ export function UserAuthForm({
     status?.oidc_enabled ||
     status?.linuxdo_oauth ||
     status?.telegram_oauth ||
-    (status?.custom_oauth_providers?.length ?? 0) > 0
+    (status?.custom_oauth_providers?.length ?? 0) > 0 ||
+    (status?.saml_providers?.length ?? 0) > 0
   )
   const hasAlternativeLogin =
     passkeyLoginEnabled || hasWeChatLogin || hasOAuthLogin
@@ -167,7 +175,8 @@ export function UserAuthForm({
 
     setIsLoading(true)
     try {
-      const res = await login({
+      const submit = isLDAPMode ? ldapLogin : login
+      const res = await submit({
         username: data.username,
         password: data.password,
         turnstile: submittedTurnstileToken,
@@ -357,7 +366,7 @@ export function UserAuthForm({
       >
         {hasAlternativeLogin && alternativeLoginMethods}
 
-        {passwordLoginEnabled && (
+        {(passwordLoginEnabled || ldapLoginEnabled) && (
           <>
             {/* Username Field */}
             <FormField
@@ -365,10 +374,18 @@ export function UserAuthForm({
               name='username'
               render={({ field }) => (
                 <FormItem>
-                  <FormLabel>{t('Username or Email')}</FormLabel>
+                  <FormLabel>
+                    {isLDAPMode
+                      ? t('Directory username')
+                      : t('Username or Email')}
+                  </FormLabel>
                   <FormControl>
                     <Input
-                      placeholder={t('Enter your username or email')}
+                      placeholder={
+                        isLDAPMode
+                          ? t('Directory username')
+                          : t('Enter your username or email')
+                      }
                       {...field}
                     />
                   </FormControl>
@@ -391,12 +408,14 @@ export function UserAuthForm({
                     />
                   </FormControl>
                   <FormMessage />
-                  <Link
-                    to='/forgot-password'
-                    className='text-muted-foreground absolute end-0 -top-0.5 z-10 text-sm font-medium hover:opacity-75'
-                  >
-                    {t('Forgot password?')}
-                  </Link>
+                  {!isLDAPMode && (
+                    <Link
+                      to='/forgot-password'
+                      className='text-muted-foreground absolute end-0 -top-0.5 z-10 text-sm font-medium hover:opacity-75'
+                    >
+                      {t('Forgot password?')}
+                    </Link>
+                  )}
                 </FormItem>
               )}
             />
@@ -408,9 +427,24 @@ export function UserAuthForm({
               disabled={isLoading || (requiresLegalConsent && !agreedToLegal)}
             >
               {isLoading ? <Loader2 className='animate-spin' /> : <LogIn />}
-              {t('Sign in')}
+              {isLDAPMode
+                ? t('Sign in with {{name}}', { name: ldapDisplayName })
+                : t('Sign in')}
             </Button>
 
+            {passwordLoginEnabled && ldapLoginEnabled && (
+              <Button
+                type='button'
+                variant='link'
+                className='text-muted-foreground h-auto p-0 text-sm'
+                onClick={() => setPreferLDAP((current) => !current)}
+              >
+                {isLDAPMode
+                  ? t('Sign in with password')
+                  : t('Sign in with {{name}}', { name: ldapDisplayName })}
+              </Button>
+            )}
+
             {/* Turnstile */}
             {isTurnstileEnabled && (
               <div className='mt-2'>
@@ -170,7 +170,20 @@ export function SignUpForm({
       })
 
       if (res?.success) {
-        toast.success(t('Account created! Please sign in'))
+        const defaultKey = res.data?.key
+        if (defaultKey) {
+          // The default token is stored hashed, so this is the only chance to
+          // copy its key.
+          toast.success(t('Account created! Please sign in'), {
+            description: t(
+              'Your default API key is sk-{{key}}. Copy it now, it will not be shown again.',
+              { key: defaultKey }
+            ),
+            duration: Infinity,
+          })
+        } else {
+          toast.success(t('Account created! Please sign in'))
+        }
         redirectToLogin()
       } else {
         toast.error(res?.message || t('Failed to create account'))
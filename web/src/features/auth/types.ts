@@ -135,6 +135,9 @@ export interface SystemStatus {
     password_login_enabled?: boolean
     password_register_enabled?: boolean
     custom_oauth_providers?: CustomOAuthProviderInfo[]
+    saml_providers?: SAMLProviderInfo[]
+    ldap_login?: boolean
+    ldap_display_name?: string
     [key: string]: unknown
   }
   // Allow direct access to common properties
@@ -180,6 +183,9 @@ export interface SystemStatus {
   password_login_enabled?: boolean
   password_register_enabled?: boolean
   custom_oauth_providers?: CustomOAuthProviderInfo[]
+  saml_providers?: SAMLProviderInfo[]
+  ldap_login?: boolean
+  ldap_display_name?: string
   [key: string]: unknown
 }
 
@@ -205,6 +211,13 @@ export interface CustomOAuthProviderInfo {
   scopes: string
 }
 
+export interface SAMLProviderInfo {
+  id: number
+  name: string
+  slug: string
+  icon: string
+}
+
 // ============================================================================
 // Form Props
 // ============================================================================
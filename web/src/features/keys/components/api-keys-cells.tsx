@@ -58,11 +58,11 @@ export function ApiKeyCell({ apiKey }: { apiKey: ApiKey }) {
   const handlePopoverOpen = useCallback(
     (open: boolean) => {
       setPopoverOpen(open)
-      if (open && !resolvedFullKey) {
+      if (open && !resolvedFullKey && !apiKey.key_hashed) {
         resolveRealKey(apiKey.id)
       }
     },
-    [resolvedFullKey, resolveRealKey, apiKey.id]
+    [resolvedFullKey, resolveRealKey, apiKey.id, apiKey.key_hashed]
   )
 
   const handleCopy = useCallback(async () => {
@@ -103,7 +103,13 @@ export function ApiKeyCell({ apiKey }: { apiKey: ApiKey }) {
         >
           <div className='space-y-2'>
             <p className='text-muted-foreground text-xs'>{t('Full API Key')}</p>
-            {isLoading ? (
+            {apiKey.key_hashed && !resolvedFullKey ? (
+              <p className='text-muted-foreground max-w-[280px] text-xs'>
+                {t(
+                  'This key was only shown once when it was created and cannot be viewed again.'
+                )}
+              </p>
+            ) : isLoading ? (
               <div className='flex items-center gap-2 py-2'>
                 <Loader2 className='size-3.5 animate-spin' />
                 <span className='text-muted-foreground text-xs'>
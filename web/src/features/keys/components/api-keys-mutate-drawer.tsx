@@ -103,7 +103,7 @@ export function ApiKeysMutateDrawer({
   const { t } = useTranslation()
   const isUpdate = !!currentRow
   const currentRowId = currentRow?.id
-  const { triggerRefresh } = useApiKeys()
+  const { triggerRefresh, rememberCreatedKey } = useApiKeys()
   const { status, loading: statusLoading } = useStatus()
   const [isSubmitting, setIsSubmitting] = useState(false)
   const [advancedOpen, setAdvancedOpen] = useState(false)
@@ -309,6 +309,9 @@ export function ApiKeysMutateDrawer({
           })
           if (result.success) {
             successCount++
+            if (result.data?.id && result.data.key) {
+              rememberCreatedKey(result.data.id, result.data.key)
+            }
           } else {
             toast.error(result.message || t(ERROR_MESSAGES.CREATE_FAILED))
             break
@@ -319,7 +322,12 @@ export function ApiKeysMutateDrawer({
           toast.success(
             t('Successfully created {{count}} API Key(s)', {
               count: successCount,
-            })
+            }),
+            {
+              description: t(
+                'Copy your new API key now. It will not be shown again after you leave this page.'
+              ),
+            }
           )
           onOpenChange(false)
           triggerRefresh()
@@ -41,6 +41,7 @@ type ApiKeysContextType = {
   loadingKeys: Record<number, boolean>
   copiedKeyId: number | null
   markKeyCopied: (id: number) => void
+  rememberCreatedKey: (id: number, key: string) => void
 }
 
 const ApiKeysContext = React.createContext<ApiKeysContextType | null>(null)
@@ -69,6 +70,12 @@ export function ApiKeysProvider({ children }: { children: React.ReactNode }) {
     copiedTimerRef.current = setTimeout(() => setCopiedKeyId(null), 2000)
   }, [])
 
+  // The creation response is the only place a hashed key is returned, keep it
+  // for this page session so it can still be copied from the list.
+  const rememberCreatedKey = useCallback((id: number, key: string) => {
+    setResolvedKeys((prev) => ({ ...prev, [id]: `sk-${key}` }))
+  }, [])
+
   const triggerRefresh = useCallback(() => {
     setRefreshTrigger((prev) => prev + 1)
   }, [])
@@ -171,6 +178,7 @@ export function ApiKeysProvider({ children }: { children: React.ReactNode }) {
         loadingKeys,
         copiedKeyId,
         markKeyCopied,
+        rememberCreatedKey,
       }}
     >
       {children}
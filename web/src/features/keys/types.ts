@@ -22,6 +22,19 @@ import { z } from 'zod'
 // API Key Schema & Types
 // ============================================================================
 
+// Token scopes, enforced by the relay; unset fields mean no restriction
+export const apiKeyScopesSchema = z.object({
+  endpoints: z.array(z.string()).optional(),
+  denied_endpoints: z.array(z.string()).optional(),
+  max_tokens: z.number().optional(),
+  max_request_quota: z.number().optional(),
+  disable_tools: z.boolean().optional(),
+  disable_web_search: z.boolean().optional(),
+  disable_image_input: z.boolean().optional(),
+})
+
+export type ApiKeyScopes = z.infer<typeof apiKeyScopesSchema>
+
 export const apiKeySchema = z.object({
   id: z.number(),
   name: z.string(),
@@ -46,6 +59,19 @@ export const apiKeySchema = z.object({
   model_limits_enabled: z.boolean(),
   model_limits: z.string().nullish().default(''),
   allow_ips: z.string().nullish().default(''),
+  scopes: apiKeyScopesSchema.nullish().default(null),
+  // Recurring budget; budget_quota 0 means disabled
+  budget_period: z.enum(['daily', 'weekly', 'monthly', '']).optional().default(''),
+  budget_quota: z.number().optional().default(0),
+  budget_timezone: z.string().nullish().default(''),
+  budget_alert_percent: z.number().optional().default(0),
+  budget_soft_limit: z.boolean().optional().default(false),
+  budget_window_end: z.number().optional().default(0),
+  budget_used: z.number().optional().default(0),
+  // Organization tokens are charged to the organization wallet; 0 means personal
+  org_id: z.number().optional().default(0),
+  // Hashed keys are only returned once, in the creation response
+  key_hashed: z.boolean().optional().default(false),
 })
 
 export type ApiKey = z.infer<typeof apiKeySchema>
@@ -71,14 +71,20 @@ function OAuthCallback() {
     telegram_bind?: string
     flow_token?: string
     error_code?: string
+    intent?: string
+    status?: string
   }
   const callbackState = search.state ?? ''
   const isTelegramBindCallback =
     provider === 'telegram' &&
     (search.telegram_bind === 'success' || search.telegram_bind === 'error')
+  // SAML 回调由 ACS 整页跳转而来，意图由后端在查询参数中给出
+  const isSAMLCallback = provider === 'saml'
   let mode: 'login' | 'bind' = 'login'
-  if (isTelegramBindCallback) {
+  if (isTelegramBindCallback || (isSAMLCallback && search.intent === 'bind')) {
     mode = 'bind'
+  } else if (isSAMLCallback) {
+    mode = 'login'
   } else if (typeof window !== 'undefined') {
     mode = resolveOAuthCallbackMode(provider, callbackState, {
       opener: window.opener,
@@ -116,6 +122,47 @@ function OAuthCallback() {
       return
     }
 
+    if (isSAMLCallback) {
+      const fallback = mode === 'bind' ? '/profile' : '/sign-in'
+      if (search.status !== 'success') {
+        toast.error(
+          i18next.t('SAML sign-in failed: {{code}}', {
+            code: search.error_code || 'SAML_INTERNAL_ERROR',
+          })
+        )
+        void navigate({ href: fallback, replace: true })
+        return
+      }
+      if (mode === 'bind') {
+        toast.success(i18next.t('Binding successful!'))
+        void navigate({ href: '/profile', replace: true })
+        return
+      }
+      void (async () => {
+        try {
+          const config: OAuthRequestConfig = { skipBusinessError: true }
+          const response = await api.post(
+            '/api/saml/login',
+            { flow_token: search.flow_token ?? '' },
+            config
+          )
+          if (response.data?.success && isAuthBundle(response.data?.data)) {
+            applyAuthBundle(response.data.data)
+            toast.success(i18next.t('Signed in successfully!'))
+            void navigate({ href: '/dashboard', replace: true })
+            return
+          }
+          toast.error(response.data?.message || i18next.t('OAuth failed'))
+        } catch (error: unknown) {
+          toast.error(
+            error instanceof Error ? error.message : i18next.t('OAuth failed')
+          )
+        }
+        void navigate({ href: fallback, replace: true })
+      })()
+      return
+    }
+
     if (mode === 'bind') {
       const opener = window.opener
       if (!opener || opener.closed) {
@@ -228,6 +275,7 @@ function OAuthCallback() {
     })()
   }, [
     callbackState,
+    isSAMLCallback,
     mode,
     navigate,
     provider,
@@ -236,7 +284,9 @@ function OAuthCallback() {
     search.error_code,
     search.error_description,
     search.flow_token,
+    search.intent,
     search.redirect,
+    search.status,
     search.telegram_bind,
   ])
 